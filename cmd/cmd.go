@@ -19,53 +19,162 @@ import (
 	"fmt"
 	"time"
 
+	sp "cloud.google.com/go/spanner"
+
 	"github.com/cloudspannerecosystem/harbourbridge/conversion"
 	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/validate"
 )
 
 var (
-	badDataFile = "dropped.txt"
-	reportFile  = "report.txt"
-	schemaFile  = "schema.txt"
-	sessionFile = "session.json"
+	badDataFile    = "dropped.txt"
+	changesFile    = "changes.json"
+	checkpointFile = "checkpoint.json"
+	diffFile       = "diff.jsonl"
+	reportFile     = "report.txt"
+	schemaFile     = "schema.txt"
+	sessionFile    = "session.json"
+	validationFile = "validation.json"
 )
 
+// Config holds the options of a command-line run of HarbourBridge
+// (see CommandLine and Diff), which mostly correspond to its flags.
+type Config struct {
+	Driver           string // Source driver (see source.Get).
+	ProjectID        string // Spanner project.
+	InstanceID       string // Spanner instance.
+	DBName           string // Spanner database.
+	DataOnly         bool   // If true, skip schema conversion and use the schema in SessionJSON.
+	SchemaOnly       bool   // If true, only run schema conversion.
+	SkipForeignKeys  bool   // If true, don't add foreign keys after data conversion.
+	Resume           bool   // If true, resume an interrupted data conversion (or change streaming).
+	ValidateData     bool   // If true, compare the data in Spanner with the source data after data conversion.
+	SchemaSampleSize int64  // Number of rows to sample when inferring schema (for drivers that infer it).
+	ReadWorkers      int    // Number of source tables to read concurrently (for drivers that support it).
+	ChunkRows        int64  // Tables with more rows than this are read in chunks (0 disables chunking).
+	SessionJSON      string // Session file with the schema to use (data-only and diff runs).
+	ExportDir        string // If set, write converted data to files in this directory instead of Spanner.
+	ExportFormat     string // Format of the files written to ExportDir (see conversion.DataExport).
+	Dialect          string // Dialect of the Spanner database; if empty, the session's dialect (or GoogleSQL).
+	WriteMode        string // Kind of mutation used to write rows (see spanner.WriteMode).
+	CDC              string // If set, driver-specific location of the change log to stream changes from.
+	OutputFilePrefix string // Prefix of the names of the files written (report, schema, session, etc).
+}
+
 // CommandLine provides the core processing for HarbourBridge when run as a command-line tool.
 // It performs the following steps:
-// 1. Run schema conversion (if dataOnly is set to false)
-// 2. Create database (if schemaOnly is set to false)
-// 3. Run data conversion (if schemaOnly is set to false)
+// 1. Run schema conversion (if c.DataOnly is set to false)
+// 2. Create database (if c.SchemaOnly is set to false)
+// 3. Run data conversion (if c.SchemaOnly is set to false)
 // 4. Generate report
-func CommandLine(driver, projectID, instanceID, dbName string, dataOnly, schemaOnly, skipForeignKeys bool, schemaSampleSize int64, sessionJSON string, ioHelper *conversion.IOStreams, outputFilePrefix string, now time.Time) error {
+// If c.ExportDir is set, steps 2 and 3 are replaced by data conversion
+// to files in c.ExportDir, using c.ExportFormat (see
+// conversion.DataExport). If c.Dialect is set, it specifies the
+// dialect of the Spanner database (otherwise we use the dialect from
+// the session file, or GoogleSQL). Progress of data conversion is
+// checkpointed to a file, and if c.Resume is set, we skip step 2 and
+// resume data conversion from the checkpoint of an earlier run that
+// wrote to the (existing) database c.DBName, using InsertOrUpdate
+// mutations (unless c.WriteMode is spanner.Replace). c.WriteMode
+// specifies how rows are written to Spanner (see spanner.WriteMode);
+// if it is not spanner.Insert and database c.DBName already exists, we
+// skip step 2 and write rows to the existing database. c.ReadWorkers
+// is the number of source tables to read concurrently during data
+// conversion (for drivers that support it), and tables with more than
+// c.ChunkRows rows are split into chunks that are read concurrently
+// (if c.ChunkRows is positive). If c.ValidateData is set, after step 4
+// we read the data back from Spanner and compare it with the converted
+// source data (see conversion.ValidateData). If c.CDC is set, data
+// conversion records the position of the source data in the source's
+// change log, and after step 4 (and validation) we stream changes made
+// since then from c.CDC, a driver-specific change log location, until
+// interrupted (see conversion.StreamChanges). With c.Resume, we skip
+// data conversion and restart streaming from the position saved by an
+// earlier run.
+func CommandLine(c Config, ioHelper *conversion.IOStreams, now time.Time) error {
 	var conv *internal.Conv
 	var err error
-	if !dataOnly {
-		conv, err = conversion.SchemaConv(driver, ioHelper, schemaSampleSize)
+	if !c.DataOnly {
+		conv, err = conversion.SchemaConv(c.Driver, ioHelper, c.SchemaSampleSize)
 		if err != nil {
 			return err
 		}
+		if c.Dialect != "" {
+			conv.SetDialect(ddl.Dialect(c.Dialect))
+		}
 		if ioHelper.SeekableIn != nil {
 			defer ioHelper.In.Close()
 		}
 
-		conversion.WriteSchemaFile(conv, now, outputFilePrefix+schemaFile, ioHelper.Out)
-		conversion.WriteSessionFile(conv, outputFilePrefix+sessionFile, ioHelper.Out)
-		if schemaOnly {
-			conversion.Report(driver, nil, ioHelper.BytesRead, "", conv, outputFilePrefix+reportFile, ioHelper.Out)
+		conversion.WriteSchemaFile(conv, now, c.OutputFilePrefix+schemaFile, ioHelper.Out)
+		conversion.WriteSessionFile(conv, c.OutputFilePrefix+sessionFile, ioHelper.Out)
+		if c.SchemaOnly {
+			conversion.Report(c.Driver, nil, ioHelper.BytesRead, "", conv, c.OutputFilePrefix+reportFile, ioHelper.Out)
 			return nil
 		}
 	} else {
 		conv = internal.MakeConv()
-		err = conversion.ReadSessionFile(conv, sessionJSON)
+		err = conversion.ReadSessionFile(conv, c.SessionJSON)
 		if err != nil {
 			return err
 		}
+		if c.Dialect != "" {
+			conv.SetDialect(ddl.Dialect(c.Dialect))
+		}
 	}
 
-	db, err := conversion.CreateDatabase(projectID, instanceID, dbName, conv, ioHelper.Out)
-	if err != nil {
-		fmt.Printf("\nCan't create database: %v\n", err)
-		return fmt.Errorf("can't create database")
+	if c.ExportDir != "" {
+		w, err := conversion.DataExport(c.Driver, ioHelper, c.ExportDir, c.ExportFormat, conv, c.DataOnly, c.ReadWorkers, c.ChunkRows)
+		if err != nil {
+			fmt.Printf("\nCan't finish data export to %s: %v\n", c.ExportDir, err)
+			return fmt.Errorf("can't finish data export")
+		}
+		fmt.Fprintf(ioHelper.Out, "Wrote %s files to %s\n", c.ExportFormat, c.ExportDir)
+		banner := conversion.GetBanner(now, c.DBName)
+		conversion.Report(c.Driver, w.DroppedRowsByTable(), ioHelper.BytesRead, banner, conv, c.OutputFilePrefix+reportFile, ioHelper.Out)
+		conversion.WriteBadData(w, conv, banner, c.OutputFilePrefix+badDataFile, ioHelper.Out)
+		return nil
+	}
+
+	var db string
+	var checkpoint *spanner.Checkpoint
+	mode := spanner.WriteMode(c.WriteMode)
+	exists := false
+	if !c.Resume && mode != "" && mode != spanner.Insert {
+		exists, err = conversion.CheckExistingDb(c.ProjectID, c.InstanceID, c.DBName)
+		if err != nil {
+			fmt.Printf("\nCan't check for existing database: %v\n", err)
+			return fmt.Errorf("can't check for existing database")
+		}
+	}
+	switch {
+	case c.Resume:
+		db = conversion.GetDatabasePath(c.ProjectID, c.InstanceID, c.DBName)
+		checkpoint, err = spanner.LoadCheckpoint(c.OutputFilePrefix+checkpointFile, conv.SpSchema)
+		if err != nil {
+			fmt.Printf("\nCan't resume data conversion for db %s: %v\n", db, err)
+			return fmt.Errorf("can't resume data conversion")
+		}
+		fmt.Fprintf(ioHelper.Out, "Resuming data conversion for db %s from checkpoint %s\n", db, c.OutputFilePrefix+checkpointFile)
+		// Rows written after the first unwritten row of a table are
+		// written again (see spanner.Checkpoint), so they must not
+		// fail with AlreadyExists.
+		if mode != spanner.Replace {
+			mode = spanner.InsertOrUpdate
+		}
+	case exists:
+		db = conversion.GetDatabasePath(c.ProjectID, c.InstanceID, c.DBName)
+		fmt.Fprintf(ioHelper.Out, "Writing data to existing db %s using %s mutations\n", db, mode)
+		checkpoint = spanner.NewCheckpoint(c.OutputFilePrefix+checkpointFile, conv.SpSchema)
+	default:
+		db, err = conversion.CreateDatabase(c.ProjectID, c.InstanceID, c.DBName, conv, ioHelper.Out)
+		if err != nil {
+			fmt.Printf("\nCan't create database: %v\n", err)
+			return fmt.Errorf("can't create database")
+		}
+		checkpoint = spanner.NewCheckpoint(c.OutputFilePrefix+checkpointFile, conv.SpSchema)
 	}
 
 	client, err := conversion.GetClient(db)
@@ -74,19 +183,134 @@ func CommandLine(driver, projectID, instanceID, dbName string, dataOnly, schemaO
 		return fmt.Errorf("can't create Spanner client")
 	}
 
-	bw, err := conversion.DataConv(driver, ioHelper, client, conv, dataOnly)
+	if c.Resume && c.CDC != "" {
+		// Data conversion finished, and streaming was interrupted. (Rows
+		// skipped when resuming data conversion might have changed since
+		// they were written, so data conversion can't be resumed.)
+		pos, err := conversion.ReadChangePosition(c.OutputFilePrefix + changesFile)
+		if err != nil {
+			fmt.Printf("\nCan't resume streaming changes to db %s: %v\n", db, err)
+			return fmt.Errorf("can't resume streaming changes")
+		}
+		return streamChanges(c.Driver, client, conv, c.CDC, pos, db, ioHelper, c.OutputFilePrefix)
+	}
+	var rec *validate.Recorder
+	if c.ValidateData {
+		rec = validate.NewRecorder(conv.SpSchema)
+	}
+	conv.CaptureChanges = c.CDC
+	bw, err := conversion.DataConv(c.Driver, ioHelper, client, conv, c.DataOnly, c.ReadWorkers, c.ChunkRows, mode, checkpoint, rec)
 	if err != nil {
 		fmt.Printf("\nCan't finish data conversion for db %s: %v\n", db, err)
 		return fmt.Errorf("can't finish data conversion")
 	}
-	if !skipForeignKeys {
-		if err = conversion.UpdateDDLForeignKeys(projectID, instanceID, dbName, conv, ioHelper.Out); err != nil {
+	if !c.SkipForeignKeys {
+		if err = conversion.UpdateDDLForeignKeys(c.ProjectID, c.InstanceID, c.DBName, conv, ioHelper.Out); err != nil {
 			fmt.Printf("\nCan't perform update operation on db %s with foreign keys: %v\n", db, err)
 			return fmt.Errorf("can't perform update schema with foreign keys")
 		}
 	}
 	banner := conversion.GetBanner(now, db)
-	conversion.Report(driver, bw.DroppedRowsByTable(), ioHelper.BytesRead, banner, conv, outputFilePrefix+reportFile, ioHelper.Out)
-	conversion.WriteBadData(bw, conv, banner, outputFilePrefix+badDataFile, ioHelper.Out)
+	if c.Resume {
+		// Rows processed by earlier runs are either re-read from the
+		// source and skipped, or not read (and rows written are
+		// counted as good rows), so the report's statistics cover all
+		// runs. Rows dropped by earlier runs aren't retried.
+		skipped := fmt.Sprintf("Resumed from checkpoint: skipped %d rows processed by earlier runs", checkpoint.SkippedRows())
+		if n := checkpoint.EarlierDroppedRows(); n > 0 {
+			skipped += fmt.Sprintf(" (earlier runs dropped %d rows, which were not retried: see their reports)", n)
+		}
+		skipped += "\n\n"
+		fmt.Fprint(ioHelper.Out, skipped)
+		banner += skipped
+	}
+	conversion.Report(c.Driver, bw.DroppedRowsByTable(), ioHelper.BytesRead, banner, conv, c.OutputFilePrefix+reportFile, ioHelper.Out)
+	conversion.WriteBadData(bw, conv, banner, c.OutputFilePrefix+badDataFile, ioHelper.Out)
+	if rec != nil {
+		if n := conversion.ValidateData(client, conv, rec, c.OutputFilePrefix+reportFile, c.OutputFilePrefix+validationFile, ioHelper.Out); n > 0 {
+			return fmt.Errorf("data validation failed for %d tables", n)
+		}
+	}
+	if c.CDC != "" {
+		if conv.ChangePosition == "" {
+			fmt.Printf("\nCan't stream changes: the position of the source data in the change log wasn't recorded (see report)\n")
+			return fmt.Errorf("can't stream changes")
+		}
+		return streamChanges(c.Driver, client, conv, c.CDC, conv.ChangePosition, db, ioHelper, c.OutputFilePrefix)
+	}
+	return nil
+}
+
+// streamChanges streams changes from cdc to db using client, starting at
+// pos, until interrupted.
+func streamChanges(driver string, client *sp.Client, conv *internal.Conv, cdc, pos, db string, ioHelper *conversion.IOStreams, outputFilePrefix string) error {
+	if err := conversion.StreamChanges(driver, client, conv, cdc, true, pos, outputFilePrefix+changesFile, outputFilePrefix+reportFile, ioHelper.Out); err != nil {
+		fmt.Printf("\nCan't stream changes to db %s: %v\n", db, err)
+		return fmt.Errorf("can't stream changes")
+	}
+	return nil
+}
+
+// Diff provides the processing for HarbourBridge's diff mode, which
+// compares the source data with an existing Spanner database c.DBName
+// (typically written by an earlier run of CommandLine), row by row. It
+// converts the source data as CommandLine does, using the schema and
+// name mapping of session file c.SessionJSON if it is set (otherwise we
+// rerun schema conversion, which maps names as the earlier run did,
+// unless its session was edited). Rows that differ are written to a
+// diff file (see conversion.DiffData), and a summary of differences by
+// table is printed. c.ReadWorkers and c.ChunkRows are as for
+// CommandLine; options that only apply to migration are ignored.
+func Diff(c Config, ioHelper *conversion.IOStreams) error {
+	var conv *internal.Conv
+	var err error
+	dataOnly := c.SessionJSON != ""
+	if dataOnly {
+		conv = internal.MakeConv()
+		if err = conversion.ReadSessionFile(conv, c.SessionJSON); err != nil {
+			return err
+		}
+	} else {
+		conv, err = conversion.SchemaConv(c.Driver, ioHelper, c.SchemaSampleSize)
+		if err != nil {
+			return err
+		}
+		if ioHelper.SeekableIn != nil {
+			defer ioHelper.In.Close()
+		}
+	}
+	if c.Dialect != "" {
+		conv.SetDialect(ddl.Dialect(c.Dialect))
+	}
+	db := conversion.GetDatabasePath(c.ProjectID, c.InstanceID, c.DBName)
+	client, err := conversion.GetClient(db)
+	if err != nil {
+		fmt.Printf("\nCan't create client for db %s: %v\n", db, err)
+		return fmt.Errorf("can't create Spanner client")
+	}
+	stats, err := conversion.DiffData(c.Driver, ioHelper, client, conv, dataOnly, c.ReadWorkers, c.ChunkRows, c.OutputFilePrefix+diffFile)
+	if err != nil {
+		fmt.Printf("\nCan't compare data with db %s: %v\n", db, err)
+		return fmt.Errorf("can't finish data comparison")
+	}
+	differ := 0
+	for _, s := range stats {
+		switch {
+		case s.Err != nil:
+			fmt.Fprintf(ioHelper.Out, "  %s: can't read table: %v\n", s.Table, s.Err)
+		case s.Missing+s.Extra+s.Changed+s.Dropped == 0:
+			fmt.Fprintf(ioHelper.Out, "  %s: %d rows match\n", s.Table, s.SpannerRows)
+			continue
+		default:
+			fmt.Fprintf(ioHelper.Out, "  %s: %d source rows, %d Spanner rows: %d missing, %d extra, %d changed, %d not compared\n",
+				s.Table, s.SourceRows, s.SpannerRows, s.Missing, s.Extra, s.Changed, s.Dropped)
+		}
+		differ++
+	}
+	fmt.Fprintf(ioHelper.Out, "Compared %d tables with db %s: %d differ. See file '%s' for details of rows that differ.\n",
+		len(stats), db, differ, c.OutputFilePrefix+diffFile)
+	if conv.BadRows() > 0 {
+		fmt.Fprintf(ioHelper.Out, "Note: %d source rows couldn't be converted, and were not compared.\n", conv.BadRows())
+	}
 	return nil
 }
@@ -35,6 +35,7 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -43,22 +44,27 @@ import (
 	sp "cloud.google.com/go/spanner"
 	database "cloud.google.com/go/spanner/admin/database/apiv1"
 	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	dydb "github.com/aws/aws-sdk-go/service/dynamodb"
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/lib/pq"
 	"golang.org/x/crypto/ssh/terminal"
 	"google.golang.org/api/iterator"
 	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
 	instancepb "google.golang.org/genproto/googleapis/spanner/admin/instance/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
-	"github.com/cloudspannerecosystem/harbourbridge/dynamodb"
+	_ "github.com/cloudspannerecosystem/harbourbridge/csv" // Register the built-in source drivers.
+	_ "github.com/cloudspannerecosystem/harbourbridge/dynamodb"
 	"github.com/cloudspannerecosystem/harbourbridge/internal"
-	"github.com/cloudspannerecosystem/harbourbridge/mysql"
-	"github.com/cloudspannerecosystem/harbourbridge/postgres"
+	_ "github.com/cloudspannerecosystem/harbourbridge/mysql"
+	_ "github.com/cloudspannerecosystem/harbourbridge/oracle"
+	_ "github.com/cloudspannerecosystem/harbourbridge/postgres"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
 	"github.com/cloudspannerecosystem/harbourbridge/spanner"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/avro"
 	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/filesink"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/validate"
+	_ "github.com/cloudspannerecosystem/harbourbridge/sqlite"
+	_ "github.com/cloudspannerecosystem/harbourbridge/sqlserver"
 )
 
 const (
@@ -70,200 +76,289 @@ const (
 	MYSQLDUMP string = "mysqldump"
 	// MYSQL is the driver name for MySQL.
 	MYSQL string = "mysql"
+	// SQLSERVER is the driver name for Microsoft SQL Server.
+	SQLSERVER string = "sqlserver"
+	// ORACLE is the driver name for Oracle Database.
+	ORACLE string = "oracle"
+	// SQLITE is the driver name for SQLite database files.
+	SQLITE string = "sqlite"
+	// CSV is the driver name for tables stored in CSV files.
+	CSV string = "csv"
 	// DYNAMODB is the driver name for AWS DynamoDB.
 	// This is an experimental driver; implementation in progress.
 	DYNAMODB string = "dynamodb"
 )
 
+// SchemaConv performs schema conversion using the source driver
+// registered under the name driver.
 func SchemaConv(driver string, ioHelper *IOStreams, schemaSampleSize int64) (*internal.Conv, error) {
-	switch driver {
-	case POSTGRES, MYSQL:
-		return schemaFromSQL(driver)
-	case PGDUMP, MYSQLDUMP:
-		return schemaFromDump(driver, ioHelper)
-	case DYNAMODB:
-		return schemaFromDynamoDB(schemaSampleSize)
-	default:
+	d, err := source.Get(driver)
+	if err != nil {
 		return nil, fmt.Errorf("schema conversion for driver %s not supported", driver)
 	}
+	switch d.Kind() {
+	case source.SQL:
+		return schemaFromSQL(d, schemaSampleSize)
+	case source.Dump:
+		return schemaFromDump(driver, d, ioHelper)
+	default:
+		return schemaFromClient(d, schemaSampleSize)
+	}
 }
 
-func DataConv(driver string, ioHelper *IOStreams, client *sp.Client, conv *internal.Conv, dataOnly bool) (*spanner.BatchWriter, error) {
-	config := spanner.BatchWriterConfig{
-		BytesLimit: 100 * 1000 * 1000,
-		WriteLimit: 40,
-		RetryLimit: 1000,
-		Verbose:    internal.Verbose(),
+// DataConv performs data conversion using the source driver registered
+// under the name driver, and writes the data to Spanner using client,
+// using mutations of kind writeMode. For drivers that support it, up to
+// workers source tables (or chunks of tables with more than chunkRows
+// rows, if chunkRows is positive) are read concurrently. If checkpoint is not
+// nil, it records the rows written (and rows it already records as
+// written are skipped, or not read at all by drivers that can seek to
+// the last row written), so that the data conversion can be resumed if
+// it is interrupted. If rec is not nil, it records the rows written, so
+// that they can be checked using ValidateData.
+func DataConv(driver string, ioHelper *IOStreams, client *sp.Client, conv *internal.Conv, dataOnly bool, workers int, chunkRows int64, writeMode spanner.WriteMode, checkpoint *spanner.Checkpoint, rec *validate.Recorder) (*spanner.BatchWriter, error) {
+	if IsDump(driver) && conv.SpSchema.CheckInterleaved() {
+		return nil, fmt.Errorf("HarbourBridge does not currently support data conversion from dump files\nif the schema contains interleaved tables. Suggest using direct access to source database\ni.e. using drivers postgres and mysql.")
+	}
+	var bw *spanner.BatchWriter
+	sink := dataSink{
+		message: "Writing data to Spanner",
+		newWriter: func(p *internal.Progress) (DataWriter, error) {
+			rows := int64(0)
+			bw = spanner.NewBatchWriter(spanner.BatchWriterConfig{
+				BytesLimit: 100 * 1000 * 1000,
+				WriteLimit: 40,
+				RetryLimit: 1000,
+				Verbose:    internal.Verbose(),
+				WriteMode:  writeMode,
+				Checkpoint: checkpoint,
+				Write: func(m []*sp.Mutation) error {
+					_, err := client.Apply(context.Background(), m)
+					if err != nil {
+						return err
+					}
+					atomic.AddInt64(&rows, int64(len(m)))
+					p.MaybeReport(atomic.LoadInt64(&rows))
+					return nil
+				},
+			})
+			if rec != nil {
+				return recordingWriter{bw, rec}, nil
+			}
+			return bw, nil
+		},
+	}
+	if checkpoint != nil && rec == nil {
+		// Drivers that can seek to a key read tables from the last
+		// row the checkpoint records as written. (Validation needs
+		// all rows, so then rows are re-read and skipped instead.)
+		conv.SetSeek(checkpoint.Seek)
+	}
+	if err := dataConv(driver, ioHelper, sink, conv, dataOnly, workers, chunkRows); err != nil {
+		return nil, err
 	}
-	switch driver {
-	case POSTGRES, MYSQL:
-		return dataFromSQL(driver, config, client, conv)
-	case PGDUMP, MYSQLDUMP:
-		if conv.SpSchema.CheckInterleaved() {
-			return nil, fmt.Errorf("HarbourBridge does not currently support data conversion from dump files\nif the schema contains interleaved tables. Suggest using direct access to source database\ni.e. using drivers postgres and mysql.")
+	if checkpoint != nil {
+		for _, t := range checkpoint.Mismatched() {
+			conv.Unexpected(fmt.Sprintf("Rows of table %s were read in a different order from the checkpointed run: rewrote rows after the first difference", t))
+		}
+		if err := checkpoint.Save(); err != nil {
+			fmt.Fprintf(ioHelper.Out, "Warning: %v\n", err)
 		}
-		return dataFromDump(driver, config, ioHelper, client, conv, dataOnly)
-	case DYNAMODB:
-		return dataFromDynamoDB(config, client, conv)
-	default:
-		return nil, fmt.Errorf("data conversion for driver %s not supported", driver)
 	}
+	return bw, nil
 }
 
-func driverConfig(driver string) (string, error) {
-	switch driver {
-	case POSTGRES:
-		return pgDriverConfig()
-	case MYSQL:
-		return mysqlDriverConfig()
-	default:
-		return "", fmt.Errorf("Driver %s not supported", driver)
-	}
+// recordingWriter is a BatchWriter that records the rows added to it
+// using rec.
+type recordingWriter struct {
+	*spanner.BatchWriter
+	rec *validate.Recorder
 }
 
-func pgDriverConfig() (string, error) {
-	server := os.Getenv("PGHOST")
-	port := os.Getenv("PGPORT")
-	user := os.Getenv("PGUSER")
-	dbname := os.Getenv("PGDATABASE")
-	if server == "" || port == "" || user == "" || dbname == "" {
-		fmt.Printf("Please specify host, port, user and database using PGHOST, PGPORT, PGUSER and PGDATABASE environment variables\n")
-		return "", fmt.Errorf("Could not connect to source database")
-	}
-	password := os.Getenv("PGPASSWORD")
-	if password == "" {
-		password = getPassword()
-	}
-	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", server, port, user, password, dbname), nil
+func (w recordingWriter) AddRow(table string, cols []string, vals []interface{}) {
+	w.rec.Add(table, cols, vals)
+	w.BatchWriter.AddRow(table, cols, vals)
 }
 
-func mysqlDriverConfig() (string, error) {
-	server := os.Getenv("MYSQLHOST")
-	port := os.Getenv("MYSQLPORT")
-	user := os.Getenv("MYSQLUSER")
-	dbname := os.Getenv("MYSQLDATABASE")
-	if server == "" || port == "" || user == "" || dbname == "" {
-		fmt.Printf("Please specify host, port, user and database using MYSQLHOST, MYSQLPORT, MYSQLUSER and MYSQLDATABASE environment variables\n")
-		return "", fmt.Errorf("Could not connect to source database")
-	}
-	password := os.Getenv("MYSQLPWD")
-	if password == "" {
-		password = getPassword()
-	}
-	return fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", user, password, server, port, dbname), nil
+func (w recordingWriter) AddChunkRow(table string, chunk int, cols []string, vals []interface{}) {
+	w.rec.Add(table, cols, vals)
+	w.BatchWriter.AddChunkRow(table, chunk, cols, vals)
 }
 
-func schemaFromSQL(driver string) (*internal.Conv, error) {
-	driverConfig, err := driverConfig(driver)
-	if err != nil {
-		return nil, err
+// DataExport performs data conversion using the source driver registered
+// under the name driver, and writes the data to files in dir instead of
+// Spanner. For drivers that support it, up to workers source tables (or
+// chunks of tables, see DataConv) are read concurrently. format is one of:
+//   - "avro": Avro files using the layout of a Spanner export, which can
+//     be loaded into Spanner using Spanner's import pipeline.
+//   - "csv" or "jsonl": one CSV or JSON-lines file per table (see package
+//     filesink).
+//
+// Unlike DataConv, DataExport supports interleaved tables for all
+// drivers since rows don't need to be written in parent-child order.
+func DataExport(driver string, ioHelper *IOStreams, dir, format string, conv *internal.Conv, dataOnly bool, workers int, chunkRows int64) (DataWriter, error) {
+	// Exporters write files when closed.
+	var w interface {
+		DataWriter
+		Close() error
+	}
+	sink := dataSink{
+		message: "Writing data to files",
+		newWriter: func(p *internal.Progress) (DataWriter, error) {
+			if format == "avro" {
+				aw, err := avro.NewWriter(dir, conv.SpSchema, p)
+				if err != nil {
+					return nil, err
+				}
+				w = aw
+			} else {
+				fw, err := filesink.NewWriter(dir, filesink.Format(format), conv.SpSchema, p)
+				if err != nil {
+					return nil, err
+				}
+				w = fw
+			}
+			return w, nil
+		},
 	}
-	sourceDB, err := sql.Open(driver, driverConfig)
-	if err != nil {
+	if err := dataConv(driver, ioHelper, sink, conv, dataOnly, workers, chunkRows); err != nil {
 		return nil, err
 	}
-	conv := internal.MakeConv()
-	err = ProcessInfoSchema(driver, conv, sourceDB)
-	if err != nil {
-		return nil, err
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("can't write %s files: %w", format, err)
 	}
-	return conv, nil
+	return w, nil
+}
+
+// DataWriter is the destination for converted rows of data. It is
+// implemented by spanner.BatchWriter, avro.Writer and filesink.Writer.
+type DataWriter interface {
+	AddRow(table string, cols []string, vals []interface{})
+	Flush()
+	DroppedRowsByTable() map[string]int64
+	SampleBadRows(n int) []string
 }
 
-func dataFromSQL(driver string, config spanner.BatchWriterConfig, client *sp.Client, conv *internal.Conv) (*spanner.BatchWriter, error) {
-	// TODO: Refactor to avoid redundant calls to driverConfig and
-	// Open in schemaFromSQL and dataFromSQL. Also refactor to
-	// share code with dataFromPgDump. Use single transaction for
-	// reading schema and data from source db to get consistent
-	// dump.
-	driverConfig, err := driverConfig(driver)
+// dataSink describes where data conversion writes rows.
+type dataSink struct {
+	message string // Message for reporting progress.
+	// newWriter returns the DataWriter to write rows to. The writer
+	// should report the number of rows written using p.
+	newWriter func(p *internal.Progress) (DataWriter, error)
+}
+
+func dataConv(driver string, ioHelper *IOStreams, sink dataSink, conv *internal.Conv, dataOnly bool, workers int, chunkRows int64) error {
+	d, err := source.Get(driver)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("data conversion for driver %s not supported", driver)
 	}
-	sourceDB, err := sql.Open(driver, driverConfig)
+	switch d.Kind() {
+	case source.SQL:
+		return dataFromSQL(d, sink, conv, workers, chunkRows)
+	case source.Dump:
+		return dataFromDump(driver, d, sink, ioHelper, conv, dataOnly)
+	default:
+		return dataFromClient(d, sink, conv)
+	}
+}
+
+// IsDump returns true if driver reads its input from a dump file.
+func IsDump(driver string) bool {
+	d, err := source.Get(driver)
+	return err == nil && d.Kind() == source.Dump
+}
+
+// openSQL opens a connection to the source database using the
+// connection parameters for driver d, which must be of Kind SQL.
+func openSQL(d source.Driver) (*sql.DB, source.Config, error) {
+	c, ok := d.(source.Connector)
+	if !ok {
+		return nil, source.Config{}, fmt.Errorf("driver does not support direct connections")
+	}
+	cfg, err := c.ConfigFromEnv()
 	if err != nil {
-		return nil, err
+		return nil, cfg, err
 	}
-	err = SetRowStats(driver, conv, sourceDB)
+	// Sources without users (such as SQLite files) don't need a password.
+	if cfg.Password == "" && cfg.User != "" {
+		cfg.Password = getPassword()
+	}
+	sqlDriver, dataSourceName := c.DataSourceName(cfg)
+	db, err := sql.Open(sqlDriver, dataSourceName)
+	return db, cfg, err
+}
+
+func schemaFromSQL(d source.Driver, schemaSampleSize int64) (*internal.Conv, error) {
+	sourceDB, cfg, err := openSQL(d)
 	if err != nil {
 		return nil, err
 	}
-	totalRows := conv.Rows()
-	p := internal.NewProgress(totalRows, "Writing data to Spanner", internal.Verbose())
-	rows := int64(0)
-	config.Write = func(m []*sp.Mutation) error {
-		_, err := client.Apply(context.Background(), m)
-		if err != nil {
-			return err
-		}
-		atomic.AddInt64(&rows, int64(len(m)))
-		p.MaybeReport(atomic.LoadInt64(&rows))
-		return nil
-	}
-	writer := spanner.NewBatchWriter(config)
-	conv.SetDataMode()
-	conv.SetDataSink(
-		func(table string, cols []string, vals []interface{}) {
-			writer.AddRow(table, cols, vals)
-		})
-	err = ProcessSQLData(driver, conv, sourceDB)
+	conv := internal.MakeConv()
+	err = d.ProcessSchema(conv, source.Source{DB: sourceDB, DBName: cfg.Database, SampleSize: schemaSampleSize})
 	if err != nil {
 		return nil, err
 	}
-	writer.Flush()
-	return writer, nil
+	return conv, nil
 }
 
-func getDynamoDBClientConfig() *aws.Config {
-	cfg := aws.Config{}
-	endpointOverride := os.Getenv("DYNAMODB_ENDPOINT_OVERRIDE")
-	if endpointOverride != "" {
-		cfg.Endpoint = aws.String(endpointOverride)
+func dataFromSQL(d source.Driver, sink dataSink, conv *internal.Conv, workers int, chunkRows int64) error {
+	// TODO: Refactor to avoid redundant calls to openSQL in
+	// schemaFromSQL and dataFromSQL. Also refactor to
+	// share code with dataFromPgDump. Drivers read data from a
+	// consistent snapshot, but schema is read separately.
+	sourceDB, cfg, err := openSQL(d)
+	if err != nil {
+		return err
 	}
-	return &cfg
+	_, dsn := d.(source.Connector).DataSourceName(cfg)
+	src := source.Source{DB: sourceDB, DBName: cfg.Database, DSN: dsn, Workers: workers, ChunkRows: chunkRows}
+	return dataFromSource(d, src, sink, conv)
 }
 
-func schemaFromDynamoDB(sampleSize int64) (*internal.Conv, error) {
+func schemaFromClient(d source.Driver, sampleSize int64) (*internal.Conv, error) {
 	conv := internal.MakeConv()
-	mySession := session.Must(session.NewSession())
-	dydbClient := dydb.New(mySession, getDynamoDBClientConfig())
-	err := dynamodb.ProcessSchema(conv, dydbClient, []string{}, sampleSize)
+	err := d.ProcessSchema(conv, source.Source{SampleSize: sampleSize})
 	if err != nil {
 		return nil, err
 	}
 	return conv, nil
 }
 
-func dataFromDynamoDB(config spanner.BatchWriterConfig, client *sp.Client, conv *internal.Conv) (*spanner.BatchWriter, error) {
-	mySession := session.Must(session.NewSession())
-	dydbClient := dydb.New(mySession, getDynamoDBClientConfig())
-	dynamodb.SetRowStats(conv, dydbClient)
-	totalRows := conv.Rows()
-	p := internal.NewProgress(totalRows, "Writing data to Spanner", internal.Verbose())
+func dataFromClient(d source.Driver, sink dataSink, conv *internal.Conv) error {
+	return dataFromSource(d, source.Source{}, sink, conv)
+}
 
-	rows := int64(0)
-	config.Write = func(m []*sp.Mutation) error {
-		_, err := client.Apply(context.Background(), m)
-		if err != nil {
-			return err
-		}
-		atomic.AddInt64(&rows, int64(len(m)))
-		p.MaybeReport(atomic.LoadInt64(&rows))
-		return nil
+// dataFromSource performs data conversion for drivers that read from
+// a live source (drivers of Kind SQL or Client).
+func dataFromSource(d source.Driver, src source.Source, sink dataSink, conv *internal.Conv) error {
+	err := d.SetRowStats(conv, src)
+	if err != nil {
+		return err
+	}
+	totalRows := conv.Rows()
+	p := internal.NewProgress(totalRows, sink.message, internal.Verbose())
+	writer, err := sink.newWriter(p)
+	if err != nil {
+		return err
 	}
-	writer := spanner.NewBatchWriter(config)
 	conv.SetDataMode()
 	conv.SetDataSink(
 		func(table string, cols []string, vals []interface{}) {
 			writer.AddRow(table, cols, vals)
 		})
-
-	err := dynamodb.ProcessData(conv, dydbClient)
+	// Writers that track the order of rows (such as BatchWriter with a
+	// checkpoint) need to know which chunk of a table each row is from.
+	if cw, ok := writer.(interface {
+		AddChunkRow(table string, chunk int, cols []string, vals []interface{})
+	}); ok {
+		conv.SetChunkDataSink(cw.AddChunkRow)
+	}
+	err = d.ProcessData(conv, src)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	writer.Flush()
-	return writer, nil
+	return nil
 }
 
 type IOStreams struct {
@@ -271,7 +366,24 @@ type IOStreams struct {
 	BytesRead           int64
 }
 
-func schemaFromDump(driver string, ioHelper *IOStreams) (*internal.Conv, error) {
+func schemaFromDump(driver string, d source.Driver, ioHelper *IOStreams) (*internal.Conv, error) {
+	conv := internal.MakeConv()
+	conv.SetSchemaMode() // Build schema and ignore data in dump.
+	conv.SetDataSink(nil)
+	if dir, ok := dumpDir(ioHelper.In); ok {
+		// Directory dumps (e.g. pg_dump -Fd) are read by the driver,
+		// so we don't report progress.
+		n, err := getDirSize(dir)
+		if err != nil {
+			return nil, err
+		}
+		ioHelper.BytesRead = n
+		if err := d.ProcessSchema(conv, source.Source{Dir: dir}); err != nil {
+			fmt.Fprintf(ioHelper.Out, "Failed to parse the dump directory: %v", err)
+			return nil, fmt.Errorf("failed to parse the dump directory")
+		}
+		return conv, nil
+	}
 	f, n, err := getSeekable(ioHelper.In)
 	if err != nil {
 		printSeekError(driver, err, ioHelper.Out)
@@ -279,12 +391,14 @@ func schemaFromDump(driver string, ioHelper *IOStreams) (*internal.Conv, error)
 	}
 	ioHelper.SeekableIn = f
 	ioHelper.BytesRead = n
-	conv := internal.MakeConv()
 	p := internal.NewProgress(n, "Generating schema", internal.Verbose())
-	r := internal.NewReader(bufio.NewReader(f), p)
-	conv.SetSchemaMode() // Build schema and ignore data in dump.
-	conv.SetDataSink(nil)
-	err = ProcessDump(driver, conv, r)
+	r, err := internal.NewDumpReader(f, p)
+	if err != nil {
+		fmt.Fprintf(ioHelper.Out, "Failed to read the data file: %v", err)
+		return nil, fmt.Errorf("failed to read the data file")
+	}
+	defer r.Close()
+	err = d.ProcessSchema(conv, source.Source{Reader: r})
 	if err != nil {
 		fmt.Fprintf(ioHelper.Out, "Failed to parse the data file: %v", err)
 		return nil, fmt.Errorf("failed to parse the data file")
@@ -293,51 +407,62 @@ func schemaFromDump(driver string, ioHelper *IOStreams) (*internal.Conv, error)
 	return conv, nil
 }
 
-func dataFromDump(driver string, config spanner.BatchWriterConfig, ioHelper *IOStreams, client *sp.Client, conv *internal.Conv, dataOnly bool) (*spanner.BatchWriter, error) {
-	// TODO: refactor of the way we handle getSeekable
-	// to avoid the code duplication here
-	if !dataOnly {
-		_, err := ioHelper.SeekableIn.Seek(0, 0)
-		if err != nil {
-			fmt.Printf("\nCan't seek to start of file (preparation for second pass): %v\n", err)
-			return nil, fmt.Errorf("can't seek to start of file")
+func dataFromDump(driver string, d source.Driver, sink dataSink, ioHelper *IOStreams, conv *internal.Conv, dataOnly bool) error {
+	var src source.Source
+	if dir, ok := dumpDir(ioHelper.In); ok {
+		if dataOnly {
+			n, err := getDirSize(dir)
+			if err != nil {
+				return err
+			}
+			ioHelper.BytesRead = n
 		}
+		src.Dir = dir
 	} else {
-		// Note: input file is kept seekable to plan for future
-		// changes in showing progress for data migration.
-		f, n, err := getSeekable(ioHelper.In)
+		// TODO: refactor of the way we handle getSeekable
+		// to avoid the code duplication here
+		if !dataOnly {
+			_, err := ioHelper.SeekableIn.Seek(0, 0)
+			if err != nil {
+				fmt.Printf("\nCan't seek to start of file (preparation for second pass): %v\n", err)
+				return fmt.Errorf("can't seek to start of file")
+			}
+		} else {
+			// Note: input file is kept seekable to plan for future
+			// changes in showing progress for data migration.
+			f, n, err := getSeekable(ioHelper.In)
+			if err != nil {
+				printSeekError(driver, err, ioHelper.Out)
+				return fmt.Errorf("can't get seekable input file")
+			}
+			ioHelper.SeekableIn = f
+			ioHelper.BytesRead = n
+		}
+		r, err := internal.NewDumpReader(ioHelper.SeekableIn, nil)
 		if err != nil {
-			printSeekError(driver, err, ioHelper.Out)
-			return nil, fmt.Errorf("can't get seekable input file")
+			fmt.Fprintf(ioHelper.Out, "Failed to read the data file: %v", err)
+			return fmt.Errorf("failed to read the data file")
 		}
-		ioHelper.SeekableIn = f
-		ioHelper.BytesRead = n
+		defer r.Close()
+		src.Reader = r
 	}
 	totalRows := conv.Rows()
 
-	p := internal.NewProgress(totalRows, "Writing data to Spanner", internal.Verbose())
-	r := internal.NewReader(bufio.NewReader(ioHelper.SeekableIn), nil)
-	rows := int64(0)
-	config.Write = func(m []*sp.Mutation) error {
-		_, err := client.Apply(context.Background(), m)
-		if err != nil {
-			return err
-		}
-		atomic.AddInt64(&rows, int64(len(m)))
-		p.MaybeReport(atomic.LoadInt64(&rows))
-		return nil
+	p := internal.NewProgress(totalRows, sink.message, internal.Verbose())
+	writer, err := sink.newWriter(p)
+	if err != nil {
+		return err
 	}
-	writer := spanner.NewBatchWriter(config)
 	conv.SetDataMode() // Process data in dump; schema is unchanged.
 	conv.SetDataSink(
 		func(table string, cols []string, vals []interface{}) {
 			writer.AddRow(table, cols, vals)
 		})
-	ProcessDump(driver, conv, r)
+	d.ProcessData(conv, src)
 	writer.Flush()
 	p.Done()
 
-	return writer, nil
+	return nil
 }
 
 // Report generates a report of schema and data conversion.
@@ -355,11 +480,7 @@ func Report(driver string, badWrites map[string]int64, BytesRead int64, banner s
 
 	summary := internal.GenerateReport(driver, conv, w, badWrites, true, true)
 	w.Flush()
-	var isDump bool
-	if strings.Contains(driver, "dump") {
-		isDump = true
-	}
-	if isDump {
+	if IsDump(driver) {
 		fmt.Fprintf(out, "Processed %d bytes of %s data (%d statements, %d rows of data, %d errors, %d unexpected conditions).\n",
 			BytesRead, driver, conv.Statements(), conv.Rows(), conv.StatementErrors(), conv.Unexpecteds())
 	} else {
@@ -374,6 +495,231 @@ func Report(driver string, badWrites map[string]int64, BytesRead int64, banner s
 	}
 }
 
+// ValidateData reads the tables written by data conversion back from
+// Spanner using client, and compares them with the rows recorded by rec
+// (see DataConv). It appends a per-table pass/fail section to the
+// report file reportFileName, and writes the full result, including
+// the keys of mismatched rows, as JSON to diffFileName. It returns the
+// number of tables that failed validation.
+func ValidateData(client *sp.Client, conv *internal.Conv, rec *validate.Recorder, reportFileName, diffFileName string, out *os.File) int {
+	fmt.Fprintf(out, "Validating data in Spanner...\n")
+	r := validate.Validate(client, conv.Dialect, rec)
+	f, err := os.OpenFile(reportFileName, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		fmt.Fprintf(out, "Can't write out report file %s: %v\n", reportFileName, err)
+		fmt.Fprintf(out, "Writing validation report to stdout\n")
+		f = out
+	} else {
+		defer f.Close()
+	}
+	w := bufio.NewWriter(f)
+	r.WriteReport(w)
+	w.Flush()
+	b, err := json.MarshalIndent(r, "", " ")
+	if err == nil {
+		err = ioutil.WriteFile(diffFileName, b, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Can't write out validation diff file %s: %v\n", diffFileName, err)
+	}
+	failed := r.Failed()
+	fmt.Fprintf(out, "Validated %d tables: %d passed, %d failed. See file '%s' for details of mismatched rows.\n",
+		len(r.Tables), len(r.Tables)-failed, failed, diffFileName)
+	return failed
+}
+
+// DiffData performs data conversion using the source driver registered
+// under the name driver, and compares the converted rows with the
+// tables of the existing Spanner database of client, row by row (see
+// validate.Diff). Rows that are missing from Spanner, unexpected in
+// Spanner or have different values are written to diffFileName as JSON
+// lines. Converted rows are held in memory until they are compared.
+// workers and chunkRows are as for DataConv.
+func DiffData(driver string, ioHelper *IOStreams, client *sp.Client, conv *internal.Conv, dataOnly bool, workers int, chunkRows int64, diffFileName string) ([]validate.DiffStats, error) {
+	var dw *validate.DiffWriter
+	sink := dataSink{
+		message: "Reading source data",
+		newWriter: func(p *internal.Progress) (DataWriter, error) {
+			dw = validate.NewDiffWriter(conv.SpSchema, p)
+			return dw, nil
+		},
+	}
+	if err := dataConv(driver, ioHelper, sink, conv, dataOnly, workers, chunkRows); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(diffFileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(ioHelper.Out, "Comparing data with Spanner...\n")
+	stats, err := validate.Diff(client, conv.Dialect, dw, conv.ToSource, w)
+	if err != nil {
+		return nil, fmt.Errorf("can't write diff file %s: %w", diffFileName, err)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("can't write diff file %s: %w", diffFileName, err)
+	}
+	return stats, nil
+}
+
+// StreamChanges streams changes made to the source database after data
+// conversion to Spanner using client, for source drivers that support
+// change data capture (see source.ChangeStreamer). Changes are read
+// from changes (a driver-specific change log location) starting at
+// position pos, and are applied one source transaction at a time. After
+// each transaction, the position of the next change is saved to
+// positionFile (see ReadChangePosition), so that streaming can be
+// restarted. A section on the progress of streaming, including the lag
+// behind the source and the changes applied to each table, is appended
+// to the report file reportFileName, and kept up to date as changes are
+// applied. If follow is set, StreamChanges waits for new changes until
+// it is interrupted or fails.
+func StreamChanges(driver string, client *sp.Client, conv *internal.Conv, changes string, follow bool, pos, positionFile, reportFileName string, out *os.File) error {
+	d, err := source.Get(driver)
+	if err != nil {
+		return err
+	}
+	cs, ok := d.(source.ChangeStreamer)
+	if !ok {
+		return fmt.Errorf("driver %s does not support change data capture", driver)
+	}
+	src := source.Source{Changes: changes, Follow: follow}
+	if d.Kind() == source.SQL {
+		db, cfg, err := openSQL(d)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		src.DB, src.DBName = db, cfg.Database
+	}
+	if err := writeChangePosition(positionFile, pos); err != nil {
+		return err
+	}
+	r, err := newChangeReport(conv, reportFileName)
+	if err != nil {
+		fmt.Fprintf(out, "Can't write out report file %s: %v\n", reportFileName, err)
+	}
+	fmt.Fprintf(out, "Streaming changes from %s, starting at %s...\n", changes, pos)
+	s := internal.ChangeSummary{Position: pos}
+	problems := conv.Unexpecteds() + conv.ChangeErrors()
+	warn := func() {
+		// Changes that can't be replicated are reported as unexpected
+		// conditions, which are only printed in verbose mode.
+		if n := conv.Unexpecteds() + conv.ChangeErrors(); n > problems {
+			problems = n
+			fmt.Fprintf(out, "Warning: some changes were not replicated (run with -v for details)\n")
+		}
+	}
+	err = cs.StreamChanges(conv, src, pos, func(ms []*sp.Mutation, pos string, commitTime time.Time) error {
+		if _, err := client.Apply(context.Background(), ms); err != nil {
+			return fmt.Errorf("can't apply changes: %w", err)
+		}
+		s.Position = pos
+		s.Transactions++
+		s.Mutations += int64(len(ms))
+		s.LastCommit = commitTime
+		s.Lag = time.Since(commitTime)
+		if internal.Verbose() {
+			fmt.Fprintf(out, "Applied %d mutations: now at %s (lag %s)\n", len(ms), pos, s.Lag.Round(time.Second))
+		}
+		warn()
+		if r != nil && time.Since(r.written) > changeReportInterval {
+			r.write(s)
+		}
+		return writeChangePosition(positionFile, pos)
+	})
+	warn()
+	if r != nil {
+		r.write(s)
+	}
+	fmt.Fprintf(out, "Applied %d transactions (%d mutations) from %s\n", s.Transactions, s.Mutations, changes)
+	return err
+}
+
+// changeReportInterval is the minimum time between updates of the
+// change data capture section of the report file.
+const changeReportInterval = 10 * time.Second
+
+// changeReport maintains the change data capture section at the end
+// of a report file.
+type changeReport struct {
+	conv    *internal.Conv
+	name    string
+	offset  int64 // Size of the report file before the section.
+	written time.Time
+}
+
+func newChangeReport(conv *internal.Conv, name string) (*changeReport, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	return &changeReport{conv: conv, name: name, offset: offset}, nil
+}
+
+// write replaces the change data capture section of the report file
+// with a report of s. Errors are ignored: the report is rewritten
+// after later changes, and the final report is also printed.
+func (r *changeReport) write(s internal.ChangeSummary) {
+	r.written = time.Now()
+	f, err := os.OpenFile(r.name, os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if err := f.Truncate(r.offset); err != nil {
+		return
+	}
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		return
+	}
+	w := bufio.NewWriter(f)
+	internal.WriteChangeReport(r.conv, w, s)
+	w.Flush()
+}
+
+// changePosition is the content of a change position file.
+type changePosition struct {
+	Position string `json:"position"`
+}
+
+// ReadChangePosition returns the position saved in positionFile by
+// StreamChanges.
+func ReadChangePosition(positionFile string) (string, error) {
+	b, err := ioutil.ReadFile(positionFile)
+	if err != nil {
+		return "", err
+	}
+	var p changePosition
+	if err := json.Unmarshal(b, &p); err != nil {
+		return "", fmt.Errorf("can't parse %s: %w", positionFile, err)
+	}
+	return p.Position, nil
+}
+
+// writeChangePosition saves pos to positionFile. The file is replaced
+// atomically, so that it always holds a valid position.
+func writeChangePosition(positionFile, pos string) error {
+	b, err := json.Marshal(changePosition{Position: pos})
+	if err == nil {
+		tmp := positionFile + ".tmp"
+		if err = ioutil.WriteFile(tmp, b, 0644); err == nil {
+			err = os.Rename(tmp, positionFile)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("can't save change position: %w", err)
+	}
+	return nil
+}
+
 // getSeekable returns a seekable file (with same content as f) and the size of the content (in bytes).
 func getSeekable(f *os.File) (*os.File, int64, error) {
 	_, err := f.Seek(0, 0)
@@ -405,6 +751,34 @@ func getSeekable(f *os.File) (*os.File, int64, error) {
 	return fcopy, n, nil
 }
 
+// dumpDir returns the name of f if f is a directory (such as the
+// output of pg_dump -Fd).
+func dumpDir(f *os.File) (string, bool) {
+	info, err := f.Stat()
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	return f.Name(), true
+}
+
+// getDirSize returns the total size of the files in directory dir.
+func getDirSize(dir string) (int64, error) {
+	var n int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			n += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("can't read dump directory: %w", err)
+	}
+	return n, nil
+}
+
 // CreateDatabase returns a newly create Spanner DB.
 // It automatically determines an appropriate project, selects a
 // Spanner instance to use, generates a new Spanner DB name,
@@ -420,20 +794,76 @@ func CreateDatabase(project, instance, dbName string, conv *internal.Conv, out *
 	// The schema we send to Spanner excludes comments (since Cloud
 	// Spanner DDL doesn't accept them), and protects table and col names
 	// using backticks (to avoid any issues with Spanner reserved words).
-	schema := conv.SpSchema.GetDDL(ddl.Config{Comments: false, ProtectIds: true, Tables: true, ForeignKeys: false})
-	op, err := adminClient.CreateDatabase(ctx, &adminpb.CreateDatabaseRequest{
+	schema := conv.SpSchema.GetDDL(ddl.Config{Comments: false, ProtectIds: true, Tables: true, ForeignKeys: false, Dialect: conv.Dialect})
+	// Views must be created after the tables they use.
+	schema = append(schema, conv.SpViews.GetDDL(ddl.Config{Comments: false, ProtectIds: true, Dialect: conv.Dialect})...)
+	req := &adminpb.CreateDatabaseRequest{
 		Parent:          fmt.Sprintf("projects/%s/instances/%s", project, instance),
 		CreateStatement: "CREATE DATABASE `" + dbName + "`",
 		ExtraStatements: schema,
-	})
+	}
+	if conv.Dialect == ddl.PostgreSQL {
+		// PostgreSQL-dialect databases must be created without extra
+		// statements, so we create the schema once the database exists.
+		req.CreateStatement = `CREATE DATABASE "` + dbName + `"`
+		req.ExtraStatements = nil
+		req.DatabaseDialect = adminpb.DatabaseDialect_POSTGRESQL
+	}
+	op, err := adminClient.CreateDatabase(ctx, req)
 	if err != nil {
 		return "", fmt.Errorf("can't build CreateDatabaseRequest: %w", analyzeError(err, project, instance))
 	}
 	if _, err := op.Wait(ctx); err != nil {
 		return "", fmt.Errorf("createDatabase call failed: %w", analyzeError(err, project, instance))
 	}
+	if conv.Dialect == ddl.PostgreSQL && len(schema) > 0 {
+		if err := createSchema(ctx, adminClient, project, instance, dbName, schema); err != nil {
+			// Don't leave behind an empty database that would make a
+			// rerun with the same name fail.
+			dbURI := GetDatabasePath(project, instance, dbName)
+			if dropErr := adminClient.DropDatabase(ctx, &adminpb.DropDatabaseRequest{Database: dbURI}); dropErr != nil {
+				return "", fmt.Errorf("%w (the empty database %s was left behind and must be dropped manually: %v)", err, dbURI, dropErr)
+			}
+			return "", err
+		}
+	}
 	fmt.Fprintf(out, "done.\n")
-	return fmt.Sprintf("projects/%s/instances/%s/databases/%s", project, instance, dbName), nil
+	return GetDatabasePath(project, instance, dbName), nil
+}
+
+// createSchema creates the tables and views in schema in an existing
+// database.
+func createSchema(ctx context.Context, adminClient *database.DatabaseAdminClient, project, instance, dbName string, schema []string) error {
+	op, err := adminClient.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
+		Database:   GetDatabasePath(project, instance, dbName),
+		Statements: schema,
+	})
+	if err != nil {
+		return fmt.Errorf("can't build UpdateDatabaseDdlRequest: %w", analyzeError(err, project, instance))
+	}
+	if err := op.Wait(ctx); err != nil {
+		return fmt.Errorf("can't create schema: %w", analyzeError(err, project, instance))
+	}
+	return nil
+}
+
+// CheckExistingDb returns whether database dbName exists in the given
+// project and instance.
+func CheckExistingDb(project, instance, dbName string) (bool, error) {
+	ctx := context.Background()
+	adminClient, err := database.NewDatabaseAdminClient(ctx)
+	if err != nil {
+		return false, fmt.Errorf("can't create admin client: %w", analyzeError(err, project, instance))
+	}
+	defer adminClient.Close()
+	_, err = adminClient.GetDatabase(ctx, &adminpb.GetDatabaseRequest{Name: GetDatabasePath(project, instance, dbName)})
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("can't get database %s: %w", dbName, analyzeError(err, project, instance))
+	}
+	return true, nil
 }
 
 // UpdateDDLForeignKeys updates the Spanner database with foreign key
@@ -448,7 +878,7 @@ func UpdateDDLForeignKeys(project, instance, dbName string, conv *internal.Conv,
 	// The schema we send to Spanner excludes comments (since Cloud
 	// Spanner DDL doesn't accept them), and protects table and col names
 	// using backticks (to avoid any issues with Spanner reserved words).
-	fkStmts := conv.SpSchema.GetDDL(ddl.Config{Comments: false, ProtectIds: true, Tables: false, ForeignKeys: true})
+	fkStmts := conv.SpSchema.GetDDL(ddl.Config{Comments: false, ProtectIds: true, Tables: false, ForeignKeys: true, Dialect: conv.Dialect})
 	if len(fkStmts) == 0 {
 		return nil
 	}
@@ -560,7 +990,8 @@ func WriteSchemaFile(conv *internal.Conv, now time.Time, name string, out *os.Fi
 	// and doesn't add backticks around table and column names. This file is
 	// intended for explanatory and documentation purposes, and is not strictly
 	// legal Cloud Spanner DDL (Cloud Spanner doesn't currently support comments).
-	spDDL := conv.SpSchema.GetDDL(ddl.Config{Comments: true, ProtectIds: false, Tables: true, ForeignKeys: true})
+	spDDL := conv.SpSchema.GetDDL(ddl.Config{Comments: true, ProtectIds: false, Tables: true, ForeignKeys: true, Dialect: conv.Dialect})
+	spDDL = append(spDDL, conv.SpViews.GetDDL(ddl.Config{Comments: true, ProtectIds: false, Dialect: conv.Dialect})...)
 	if len(spDDL) == 0 {
 		spDDL = []string{"\n-- Schema is empty -- no tables found\n"}
 	}
@@ -587,7 +1018,8 @@ func WriteSchemaFile(conv *internal.Conv, now time.Time, name string, out *os.Fi
 
 	// We change 'Comments' to false and 'ProtectIds' to true below to write out a
 	// schema file that is a legal Cloud Spanner DDL.
-	spDDL = conv.SpSchema.GetDDL(ddl.Config{Comments: false, ProtectIds: true, Tables: true, ForeignKeys: true})
+	spDDL = conv.SpSchema.GetDDL(ddl.Config{Comments: false, ProtectIds: true, Tables: true, ForeignKeys: true, Dialect: conv.Dialect})
+	spDDL = append(spDDL, conv.SpViews.GetDDL(ddl.Config{Comments: false, ProtectIds: true, Dialect: conv.Dialect})...)
 	if len(spDDL) == 0 {
 		spDDL = []string{"\n-- Schema is empty -- no tables found\n"}
 	}
@@ -658,7 +1090,7 @@ func ReadSessionFile(conv *internal.Conv, sessionJSON string) error {
 
 // WriteBadData prints summary stats about bad rows and writes detailed info
 // to file 'name'.
-func WriteBadData(bw *spanner.BatchWriter, conv *internal.Conv, banner, name string, out *os.File) {
+func WriteBadData(bw DataWriter, conv *internal.Conv, banner, name string, out *os.File) {
 	badConversions := conv.BadRows()
 	badWrites := sum(bw.DroppedRowsByTable())
 	if badConversions == 0 && badWrites == 0 {
@@ -786,6 +1218,12 @@ func generateName(prefix string) (string, error) {
 	return fmt.Sprintf("%s_%x-%x", prefix, b[0:2], b[2:4]), nil
 }
 
+// GetDatabasePath returns the path of database dbName in the given
+// project and instance.
+func GetDatabasePath(project, instance, dbName string) string {
+	return fmt.Sprintf("projects/%s/instances/%s/databases/%s", project, instance, dbName)
+}
+
 // GetClient returns new spanner client.
 func GetClient(db string) (*sp.Client, error) {
 	ctx := context.Background()
@@ -840,53 +1278,3 @@ func sum(m map[string]int64) int64 {
 func GetBanner(now time.Time, db string) string {
 	return fmt.Sprintf("Generated at %s for db %s\n\n", now.Format("2006-01-02 15:04:05"), db)
 }
-
-// ProcessDump invokes process dump function from a sql package based on driver selected.
-func ProcessDump(driver string, conv *internal.Conv, r *internal.Reader) error {
-	switch driver {
-	case MYSQLDUMP:
-		return mysql.ProcessMySQLDump(conv, r)
-	case PGDUMP:
-		return postgres.ProcessPgDump(conv, r)
-	default:
-		return fmt.Errorf("process dump for driver %s not supported", driver)
-	}
-}
-
-// ProcessInfoSchema invokes process infoschema function from a sql package based on driver selected.
-func ProcessInfoSchema(driver string, conv *internal.Conv, db *sql.DB) error {
-	switch driver {
-	case MYSQL:
-		return mysql.ProcessInfoSchema(conv, db, os.Getenv("MYSQLDATABASE"))
-	case POSTGRES:
-		return postgres.ProcessInfoSchema(conv, db)
-	default:
-		return fmt.Errorf("schema conversion for driver %s not supported", driver)
-	}
-}
-
-// SetRowStats invokes SetRowStats function from a sql package based on driver selected.
-func SetRowStats(driver string, conv *internal.Conv, db *sql.DB) error {
-	switch driver {
-	case MYSQL:
-		mysql.SetRowStats(conv, db, os.Getenv("MYSQLDATABASE"))
-	case POSTGRES:
-		postgres.SetRowStats(conv, db)
-	default:
-		return fmt.Errorf("Could not set rows stats for '%s' driver", driver)
-	}
-	return nil
-}
-
-// ProcessSQLData invokes ProcessSQLData function from a sql package based on driver selected.
-func ProcessSQLData(driver string, conv *internal.Conv, db *sql.DB) error {
-	switch driver {
-	case MYSQL:
-		mysql.ProcessSQLData(conv, db, os.Getenv("MYSQLDATABASE"))
-	case POSTGRES:
-		postgres.ProcessSQLData(conv, db)
-	default:
-		return fmt.Errorf("Data conversion for driver %s is not supported", driver)
-	}
-	return nil
-}
@@ -0,0 +1,211 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// ProcessData performs data conversion for tables stored in CSV files.
+// For each table, we read each record, convert it to Spanner data
+// (based on the source and Spanner schemas), and write it to Spanner.
+// Records that can't be converted (including records with the wrong
+// number of fields) are recorded as bad rows. If we can't read the
+// files for a table, we skip the rest of that table and process the
+// remaining tables.
+func ProcessData(conv *internal.Conv, tables []tableSpec) error {
+	for _, t := range tables {
+		srcTable := t.Name
+		srcSchema, ok1 := conv.SrcSchema[srcTable]
+		spTable, err1 := internal.GetSpannerTable(conv, srcTable)
+		spCols, err2 := internal.GetSpannerCols(conv, srcTable, srcSchema.ColNames)
+		spSchema, ok2 := conv.SpSchema[spTable]
+		if !ok1 || err1 != nil || err2 != nil || !ok2 {
+			conv.StatsAddBadTable(srcTable)
+			conv.Unexpected(fmt.Sprintf("Can't get cols and schemas for table %s: ok1=%t, err1=%s, err2=%s, ok2=%t",
+				srcTable, ok1, err1, err2, ok2))
+			continue
+		}
+		err := t.forEachRecord(func(file string, record []string) (bool, error) {
+			cols, vals, err := convertRecord(conv, t, srcSchema, spTable, spCols, spSchema, record)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Data conversion error for table %s (file %s): %s", srcTable, file, err))
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				conv.CollectBadRow(srcTable, srcSchema.ColNames, record)
+				return true, nil
+			}
+			conv.WriteRow(srcTable, spTable, cols, vals)
+			return true, nil
+		})
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't read data for table %s: %s", srcTable, err))
+		}
+	}
+	return nil
+}
+
+// SetRowStats populates conv with the number of rows in each table.
+// This requires a pass over all the files, but it's cheap compared to
+// writing the data to Spanner.
+func SetRowStats(conv *internal.Conv, tables []tableSpec) {
+	for _, t := range tables {
+		err := t.forEachRecord(func(string, []string) (bool, error) {
+			conv.StatsAddRow(t.Name, true)
+			return true, nil
+		})
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't count rows for table %s: %s", t.Name, err))
+		}
+	}
+}
+
+// convertRecord performs data conversion for a single CSV record. As
+// with ConvertSQLRow in the SQL drivers, convertRecord returns cols as
+// well as converted values, because NULL values are dropped and a
+// synthetic primary key may be added.
+func convertRecord(conv *internal.Conv, t tableSpec, srcSchema schema.Table, spTable string, spCols []string, spSchema ddl.CreateTable, record []string) ([]string, []interface{}, error) {
+	if len(record) != len(srcSchema.ColNames) {
+		return nil, nil, fmt.Errorf("record has %d fields, but table has %d columns", len(record), len(srcSchema.ColNames))
+	}
+	var vs []interface{}
+	var cs []string
+	for i, v := range record {
+		if v == t.NullString {
+			continue
+		}
+		spCd, ok := spSchema.ColDefs[spCols[i]]
+		if !ok {
+			return nil, nil, fmt.Errorf("can't find schema for column %s", srcSchema.ColNames[i])
+		}
+		spVal, err := convScalar(conv, spCd.T, v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't convert value for column %s: %w", srcSchema.ColNames[i], err)
+		}
+		vs = append(vs, spVal)
+		cs = append(cs, spCols[i])
+	}
+	if col, seq, ok := conv.NextSyntheticPKey(spTable); ok {
+		cs = append(cs, col)
+		vs = append(vs, int64(bits.Reverse64(uint64(seq))))
+	}
+	return cs, vs, nil
+}
+
+// convScalar converts a CSV field to a Spanner value of type ty. BYTES
+// values are expected to be base64 encoded.
+func convScalar(conv *internal.Conv, ty ddl.Type, val string) (interface{}, error) {
+	switch ty.Name {
+	case ddl.Bool:
+		return convBool(val)
+	case ddl.Bytes:
+		return convBytes(val)
+	case ddl.Date:
+		return convDate(val)
+	case ddl.Float64:
+		return convFloat64(val)
+	case ddl.Int64:
+		return convInt64(val)
+	case ddl.Numeric:
+		return convNumeric(val)
+	case ddl.String:
+		return val, nil
+	case ddl.Timestamp:
+		return convTimestamp(conv.Location, val)
+	}
+	return nil, fmt.Errorf("can't convert value to Spanner type %s", ty.Name)
+}
+
+func convBool(val string) (bool, error) {
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return b, fmt.Errorf("can't convert to bool: %w", err)
+	}
+	return b, err
+}
+
+func convBytes(val string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(val)
+	if err != nil {
+		return b, fmt.Errorf("can't convert to bytes: %w", err)
+	}
+	return b, err
+}
+
+func convDate(val string) (civil.Date, error) {
+	d, err := civil.ParseDate(val)
+	if err != nil {
+		return d, fmt.Errorf("can't convert to date: %w", err)
+	}
+	return d, err
+}
+
+func convFloat64(val string) (float64, error) {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return f, fmt.Errorf("can't convert to float64: %w", err)
+	}
+	return f, err
+}
+
+func convInt64(val string) (int64, error) {
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return i, fmt.Errorf("can't convert to int64: %w", err)
+	}
+	return i, err
+}
+
+// convNumeric maps a string value (representing a numeric) into a
+// string representing a valid Spanner numeric.
+// Ideally we would just return a *big.Rat, but spanner.Mutation
+// doesn't currently support use of *big.Rat.
+// TODO: return *big.Rat when client library supports it.
+func convNumeric(val string) (string, error) {
+	r := new(big.Rat)
+	if _, ok := r.SetString(val); !ok {
+		return "", fmt.Errorf("can't convert %q to big.Rat", val)
+	}
+	return spanner.NumericString(r), nil
+}
+
+// convTimestamp maps a timestamp string into a go Time. We accept
+// RFC3339 timestamps and the more common "2006-01-02 15:04:05" form
+// (with optional fractional seconds and time zone offset). Values
+// without a time zone offset are interpreted using loc.
+func convTimestamp(loc *time.Location, val string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999 Z07:00"} {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"} {
+		if t, err := time.ParseInLocation(layout, val, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't convert to timestamp: %q", val)
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+type spannerData struct {
+	table string
+	cols  []string
+	vals  []interface{}
+}
+
+func TestProcessData(t *testing.T) {
+	dir, cleanup := mkTestDir(t, map[string]string{
+		"manifest.json": `[
+			{
+				"table_name": "t",
+				"file_patterns": ["t.csv"],
+				"columns": [
+					{"column_name": "a", "type_name": "INT64"},
+					{"column_name": "b", "type_name": "STRING(MAX)"},
+					{"column_name": "c", "type_name": "BYTES(MAX)"},
+					{"column_name": "d", "type_name": "DATE"},
+					{"column_name": "e", "type_name": "TIMESTAMP"},
+					{"column_name": "f", "type_name": "NUMERIC"},
+					{"column_name": "g", "type_name": "BOOL"}
+				],
+				"primary_keys": ["a"],
+				"null_string": "NULL"
+			}
+		]`,
+		"t.csv": "a,b,c,d,e,f,g\n" +
+			"1,\"x, y\",aGk=,2021-03-04,2021-03-04 05:06:07,1.25,true\n" +
+			"2,,NULL,NULL,NULL,NULL,NULL\n" +
+			"3,bad date,,2021-13-01,,,\n" +
+			"4,too few fields\n",
+	})
+	defer cleanup()
+	tables, err := loadManifest(filepath.Join(dir, "manifest.json"))
+	assert.Nil(t, err)
+	conv := internal.MakeConv()
+	conv.SetLocation(time.UTC)
+	assert.Nil(t, ProcessSchema(conv, tables, 100))
+	SetRowStats(conv, tables)
+	assert.Equal(t, int64(4), conv.Stats.Rows["t"])
+	conv.SetDataMode()
+	var rows []spannerData
+	conv.SetDataSink(
+		func(table string, cols []string, vals []interface{}) {
+			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
+		})
+	assert.Nil(t, ProcessData(conv, tables))
+	assert.Equal(t,
+		[]spannerData{
+			{
+				table: "t",
+				cols:  []string{"a", "b", "c", "d", "e", "f", "g"},
+				vals: []interface{}{int64(1), "x, y", []byte("hi"), civil.Date{Year: 2021, Month: 3, Day: 4},
+					time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC), "1.250000000", true},
+			},
+			{
+				table: "t",
+				cols:  []string{"a", "b"},
+				vals:  []interface{}{int64(2), ""},
+			},
+		},
+		rows,
+	)
+	assert.Equal(t, int64(2), conv.Stats.BadRows["t"])
+}
+
+func TestConvScalar(t *testing.T) {
+	conv := internal.MakeConv()
+	tests := []struct {
+		ty       string
+		in       string
+		expected interface{}
+	}{
+		{ddl.Bool, "false", false},
+		{ddl.Bytes, "AAE=", []byte{0, 1}},
+		{ddl.Date, "2019-10-29", civil.Date{Year: 2019, Month: 10, Day: 29}},
+		{ddl.Float64, "-1.5e3", float64(-1500)},
+		{ddl.Int64, "42", int64(42)},
+		{ddl.Numeric, "-0.5", "-0.500000000"},
+		{ddl.String, "abc", "abc"},
+		{ddl.Timestamp, "2019-10-29T05:30:00Z", time.Date(2019, time.October, 29, 5, 30, 0, 0, time.UTC)},
+		{ddl.Timestamp, "2019-10-29 05:30:00.5+02:00", time.Date(2019, time.October, 29, 5, 30, 0, 500000000, time.FixedZone("", 2*60*60))},
+	}
+	for _, tc := range tests {
+		v, err := convScalar(conv, ddl.Type{Name: tc.ty}, tc.in)
+		assert.Nil(t, err, tc.in)
+		if ts, ok := v.(time.Time); ok {
+			assert.True(t, ts.Equal(tc.expected.(time.Time)), tc.in)
+			continue
+		}
+		assert.Equal(t, tc.expected, v, tc.in)
+	}
+	for _, tc := range []struct{ ty, in string }{
+		{ddl.Bool, "maybe"},
+		{ddl.Bytes, "not base64!"},
+		{ddl.Date, "2019-02-30"},
+		{ddl.Int64, "1.5"},
+		{ddl.Numeric, "abc"},
+		{ddl.Timestamp, "yesterday"},
+	} {
+		_, err := convScalar(conv, ddl.Type{Name: tc.ty}, tc.in)
+		assert.NotNil(t, err, tc.in)
+	}
+}
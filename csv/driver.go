@@ -0,0 +1,69 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package csv implements a source driver for tables stored in
+// directories of CSV files.
+package csv
+
+import (
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func init() {
+	source.Register("csv", driver{})
+}
+
+// driver implements source.Driver for CSV files. Tables are described
+// by a manifest (see tableSpec) or by a directory of CSV files; see
+// getTables.
+type driver struct{}
+
+func (driver) Kind() source.Kind { return source.Client }
+
+func (driver) ProcessSchema(conv *internal.Conv, src source.Source) error {
+	tables, err := getTables()
+	if err != nil {
+		return err
+	}
+	return ProcessSchema(conv, tables, src.SampleSize)
+}
+
+func (driver) SetRowStats(conv *internal.Conv, src source.Source) error {
+	tables, err := getTables()
+	if err != nil {
+		return err
+	}
+	SetRowStats(conv, tables)
+	return nil
+}
+
+func (driver) ProcessData(conv *internal.Conv, src source.Source) error {
+	tables, err := getTables()
+	if err != nil {
+		return err
+	}
+	return ProcessData(conv, tables)
+}
+
+// ToSpannerType returns the default Spanner type for srcType. Since
+// every type can be represented as a string in a CSV file, STRING is
+// also allowed.
+func (driver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	if spType == ddl.String && srcType != ddl.String {
+		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.Widened}
+	}
+	return toSpannerType(nil, srcType, mods)
+}
@@ -0,0 +1,229 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// tableSpec describes a table stored in CSV files. A manifest is a
+// JSON array of tableSpecs, for example:
+//
+//	[
+//	  {
+//	    "table_name": "singers",
+//	    "file_patterns": ["singers-*.csv"],
+//	    "columns": [
+//	      {"column_name": "id", "type_name": "INT64", "not_null": true},
+//	      {"column_name": "name", "type_name": "STRING(100)"}
+//	    ],
+//	    "primary_keys": ["id"]
+//	  }
+//	]
+//
+// If columns are omitted, column names are taken from the header row
+// and types are inferred from a sample of the data.
+type tableSpec struct {
+	Name         string       `json:"table_name"`
+	FilePatterns []string     `json:"file_patterns"`
+	Columns      []columnSpec `json:"columns"`
+	PrimaryKeys  []string     `json:"primary_keys"`
+	// Header specifies whether the first row of each file is a header
+	// row. Defaults to true.
+	Header *bool `json:"header"`
+	// Delimiter is the field delimiter. Defaults to ",".
+	Delimiter string `json:"delimiter"`
+	// NullString is the value used to represent NULL. Defaults to the
+	// empty string.
+	NullString string `json:"null_string"`
+
+	files []string // Files matching FilePatterns.
+}
+
+// columnSpec describes a column of a table stored in CSV files. The
+// type is a Spanner type e.g. INT64 or STRING(100).
+type columnSpec struct {
+	Name    string `json:"column_name"`
+	Type    string `json:"type_name"`
+	NotNull bool   `json:"not_null"`
+}
+
+// getTables returns the tables to convert. Tables are described by
+// the manifest file specified by the CSV_MANIFEST environment variable
+// or, if that isn't set, by the CSV files in the directory specified
+// by the CSV_DIR environment variable.
+func getTables() ([]tableSpec, error) {
+	if m := os.Getenv("CSV_MANIFEST"); m != "" {
+		return loadManifest(m)
+	}
+	if d := os.Getenv("CSV_DIR"); d != "" {
+		return tablesFromDir(d)
+	}
+	return nil, fmt.Errorf("please specify a manifest file or a directory of CSV files using the CSV_MANIFEST or CSV_DIR environment variables")
+}
+
+// loadManifest reads the manifest at path. Relative file patterns are
+// interpreted relative to the directory containing the manifest.
+func loadManifest(path string) ([]tableSpec, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read manifest: %w", err)
+	}
+	var tables []tableSpec
+	if err := json.Unmarshal(b, &tables); err != nil {
+		return nil, fmt.Errorf("can't parse manifest %s: %w", path, err)
+	}
+	dir := filepath.Dir(path)
+	for i := range tables {
+		t := &tables[i]
+		if t.Name == "" {
+			return nil, fmt.Errorf("manifest entry %d has no table_name", i)
+		}
+		for _, p := range t.FilePatterns {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			files, err := filepath.Glob(p)
+			if err != nil {
+				return nil, fmt.Errorf("bad file pattern %q for table %s: %w", p, t.Name, err)
+			}
+			t.files = append(t.files, files...)
+		}
+		if len(t.files) == 0 {
+			return nil, fmt.Errorf("no files found for table %s", t.Name)
+		}
+		if len(t.Columns) == 0 && !t.hasHeader() {
+			return nil, fmt.Errorf("table %s has no columns and no header row", t.Name)
+		}
+		if _, err := t.comma(); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+// tablesFromDir returns a table for each .csv file in dir, named after
+// the file. Each file must have a header row.
+func tablesFromDir(dir string) ([]tableSpec, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no CSV files found in %s", dir)
+	}
+	sort.Strings(files)
+	var tables []tableSpec
+	for _, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), filepath.Ext(f))
+		tables = append(tables, tableSpec{Name: name, files: []string{f}})
+	}
+	return tables, nil
+}
+
+func (t tableSpec) hasHeader() bool {
+	return t.Header == nil || *t.Header
+}
+
+func (t tableSpec) comma() (rune, error) {
+	if t.Delimiter == "" {
+		return ',', nil
+	}
+	r, n := utf8.DecodeRuneInString(t.Delimiter)
+	if n != len(t.Delimiter) {
+		return 0, fmt.Errorf("delimiter for table %s must be a single character", t.Name)
+	}
+	return r, nil
+}
+
+// forEachRecord calls f for each record in the files of table t,
+// skipping header rows. It stops at the first error returned by f, or
+// when f returns false.
+func (t tableSpec) forEachRecord(f func(file string, record []string) (bool, error)) error {
+	comma, err := t.comma()
+	if err != nil {
+		return err
+	}
+	for _, file := range t.files {
+		more, err := func() (bool, error) {
+			fh, err := os.Open(file)
+			if err != nil {
+				return false, err
+			}
+			defer fh.Close()
+			r := csv.NewReader(fh)
+			r.Comma = comma
+			r.FieldsPerRecord = -1 // We check the number of fields ourselves.
+			first := true
+			for {
+				record, err := r.Read()
+				if err == io.EOF {
+					return true, nil
+				}
+				if err != nil {
+					return false, fmt.Errorf("can't read %s: %w", file, err)
+				}
+				if first && t.hasHeader() {
+					first = false
+					continue
+				}
+				first = false
+				more, err := f(file, record)
+				if !more || err != nil {
+					return false, err
+				}
+			}
+		}()
+		if !more || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// header returns the header row of the first file of table t.
+func (t tableSpec) header() ([]string, error) {
+	comma, err := t.comma()
+	if err != nil {
+		return nil, err
+	}
+	fh, err := os.Open(t.files[0])
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	r := csv.NewReader(fh)
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("can't read header of %s: %w", t.files[0], err)
+	}
+	if len(header) > 0 {
+		// Drop UTF-8 byte order mark (which is common in CSV files
+		// exported from spreadsheets).
+		header[0] = strings.TrimPrefix(header[0], "\uFEFF")
+	}
+	return header, nil
+}
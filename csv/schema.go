@@ -0,0 +1,197 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+const (
+	// Thresholds used to infer types from data. These match the
+	// thresholds used by the dynamodb driver.
+	errThreshold      = float64(0.001)
+	conflictThreshold = float64(0.05)
+)
+
+// ProcessSchema performs schema conversion for tables stored in CSV
+// files. Column types come from the table's manifest entry or, when
+// the manifest doesn't list columns, are inferred from the first
+// sampleSize records of the table.
+func ProcessSchema(conv *internal.Conv, tables []tableSpec, sampleSize int64) error {
+	for _, t := range tables {
+		if err := processTable(conv, t, sampleSize); err != nil {
+			return err
+		}
+	}
+	if err := internal.SchemaToDDL(conv, toSpannerType); err != nil {
+		return err
+	}
+	conv.AddPrimaryKeys()
+	return nil
+}
+
+func processTable(conv *internal.Conv, t tableSpec, sampleSize int64) error {
+	if _, found := conv.SrcSchema[t.Name]; found {
+		return fmt.Errorf("table %s is specified more than once", t.Name)
+	}
+	s := schema.Table{Name: t.Name, ColDefs: make(map[string]schema.Column)}
+	if len(t.Columns) > 0 {
+		for _, c := range t.Columns {
+			s.ColNames = append(s.ColNames, c.Name)
+			s.ColDefs[c.Name] = schema.Column{Name: c.Name, Type: parseType(c.Type), NotNull: c.NotNull}
+		}
+	} else {
+		header, err := t.header()
+		if err != nil {
+			return err
+		}
+		stats, count, err := scanSampleData(t, len(header), sampleSize)
+		if err != nil {
+			return err
+		}
+		for i, c := range header {
+			ty, nullable := inferType(stats[i], count)
+			s.ColNames = append(s.ColNames, c)
+			s.ColDefs[c] = schema.Column{Name: c, Type: schema.Type{Name: ty}, NotNull: !nullable}
+		}
+	}
+	for _, k := range t.PrimaryKeys {
+		cd, found := s.ColDefs[k]
+		if !found {
+			return fmt.Errorf("primary key column %s is not a column of table %s", k, t.Name)
+		}
+		// Primary key columns cannot be null.
+		cd.NotNull = true
+		s.ColDefs[k] = cd
+		s.PrimaryKeys = append(s.PrimaryKeys, schema.Key{Column: k})
+	}
+	conv.SrcSchema[t.Name] = s
+	return nil
+}
+
+// scanSampleData returns, for each of the n columns of table t, a count
+// map of the types of values in the first sampleSize records, along
+// with the number of records sampled. NULL values aren't counted.
+// Records with the wrong number of fields are skipped.
+func scanSampleData(t tableSpec, n int, sampleSize int64) ([]map[string]int64, int64, error) {
+	stats := make([]map[string]int64, n)
+	for i := range stats {
+		stats[i] = make(map[string]int64)
+	}
+	var count int64
+	err := t.forEachRecord(func(_ string, record []string) (bool, error) {
+		if len(record) != n {
+			return true, nil
+		}
+		for i, v := range record {
+			if v == t.NullString {
+				continue
+			}
+			stats[i][valueType(v)]++
+		}
+		count++
+		return count < sampleSize, nil
+	})
+	return stats, count, err
+}
+
+// valueType returns the narrowest Spanner type that can represent v.
+func valueType(v string) string {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return ddl.Int64
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return ddl.Float64
+	}
+	if _, err := strconv.ParseBool(v); err == nil {
+		return ddl.Bool
+	}
+	if _, err := time.Parse("2006-01-02", v); err == nil {
+		return ddl.Date
+	}
+	if _, err := convTimestamp(time.UTC, v); err == nil {
+		return ddl.Timestamp
+	}
+	return ddl.String
+}
+
+// inferType picks a type for a column given counts of the types of its
+// values in rows sampled records, along the lines of the dynamodb
+// driver's inferDataTypes. Types that appear in only a tiny fraction of
+// records are treated as errors and ignored, and if more than one type
+// remains (with the exception of a mix of INT64 and FLOAT64 values,
+// which we type as FLOAT64), we fall back to STRING. Columns with no
+// data are typed as STRING. inferType also returns whether the column
+// appears to be nullable.
+func inferType(counts map[string]int64, rows int64) (string, bool) {
+	var presentRows int64
+	for _, v := range counts {
+		presentRows += v
+	}
+	if presentRows == 0 {
+		return ddl.String, true
+	}
+	nullable := float64(rows-presentRows)/float64(rows) > errThreshold
+	var candidates []string
+	for k, v := range counts {
+		if float64(v)/float64(rows) <= errThreshold {
+			// If the percentage is less than the error threshold, then
+			// this type has a high chance to be mistakenly inserted and
+			// we should discard it.
+			continue
+		}
+		if float64(v)/float64(presentRows) > conflictThreshold {
+			candidates = append(candidates, k)
+		}
+	}
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], nullable
+	case len(candidates) == 2 && (candidates[0] == ddl.Int64 && candidates[1] == ddl.Float64 ||
+		candidates[0] == ddl.Float64 && candidates[1] == ddl.Int64):
+		return ddl.Float64, nullable
+	}
+	return ddl.String, nullable
+}
+
+// typeLen matches the length of a STRING or BYTES type name.
+var typeLen = regexp.MustCompile(`^([A-Z0-9]+)\(([0-9]+|MAX)\)$`)
+
+// parseType parses a Spanner type name from a manifest e.g. INT64 or
+// STRING(100) into a schema.Type. A length of MAX is represented by
+// an empty list of mods.
+func parseType(s string) schema.Type {
+	s = strings.ToUpper(strings.Replace(s, " ", "", -1))
+	m := typeLen.FindStringSubmatch(s)
+	if m == nil {
+		return schema.Type{Name: s}
+	}
+	if m[2] == "MAX" {
+		return schema.Type{Name: m[1]}
+	}
+	n, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return schema.Type{Name: s}
+	}
+	return schema.Type{Name: m[1], Mods: []int64{n}}
+}
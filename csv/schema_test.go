@@ -0,0 +1,183 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func TestProcessSchema_Manifest(t *testing.T) {
+	dir, cleanup := mkTestDir(t, map[string]string{
+		"manifest.json": `[
+			{
+				"table_name": "singers",
+				"file_patterns": ["singers-*.csv"],
+				"columns": [
+					{"column_name": "id", "type_name": "INT64"},
+					{"column_name": "name", "type_name": "string(100)", "not_null": true},
+					{"column_name": "photo", "type_name": "BYTES(MAX)"},
+					{"column_name": "weird", "type_name": "MONEY"}
+				],
+				"primary_keys": ["id"],
+				"header": false,
+				"delimiter": "|"
+			}
+		]`,
+		"singers-1.csv": "1|Alice|\n",
+		"singers-2.csv": "2|Bob|\n",
+	})
+	defer cleanup()
+	tables, err := loadManifest(filepath.Join(dir, "manifest.json"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "singers-1.csv"), filepath.Join(dir, "singers-2.csv")}, tables[0].files)
+	conv := internal.MakeConv()
+	assert.Nil(t, ProcessSchema(conv, tables, 100))
+	expectedSchema := map[string]ddl.CreateTable{
+		"singers": ddl.CreateTable{
+			Name:     "singers",
+			ColNames: []string{"id", "name", "photo", "weird"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"id":    ddl.ColumnDef{Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"name":  ddl.ColumnDef{Name: "name", T: ddl.Type{Name: ddl.String, Len: int64(100)}, NotNull: true},
+				"photo": ddl.ColumnDef{Name: "photo", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
+				"weird": ddl.ColumnDef{Name: "weird", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+			},
+			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "id"}},
+		},
+	}
+	assert.Equal(t, expectedSchema, stripSchemaComments(conv.SpSchema))
+	assert.Equal(t, map[string][]internal.SchemaIssue{"weird": []internal.SchemaIssue{internal.NoGoodType}}, conv.Issues["singers"])
+}
+
+func TestProcessSchema_Infer(t *testing.T) {
+	dir, cleanup := mkTestDir(t, map[string]string{
+		"albums.csv": "\uFEFFid,title,price,released,updated,live,notes\n" +
+			"1,Help,9.99,1965-08-06,2021-01-02 03:04:05,false,\n" +
+			"2,Abbey Road,10,1969-09-26,2021-01-02T03:04:05Z,true,x\n" +
+			"3,Let It Be,11.5,1970-05-08,2021-01-02 03:04:05.123+01:00,false,3\n",
+		"empty.csv": "a,b\n",
+	})
+	defer cleanup()
+	tables, err := tablesFromDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"albums", "empty"}, []string{tables[0].Name, tables[1].Name})
+	conv := internal.MakeConv()
+	assert.Nil(t, ProcessSchema(conv, tables, 100))
+	expectedSchema := map[string]ddl.CreateTable{
+		"albums": ddl.CreateTable{
+			Name:     "albums",
+			ColNames: []string{"id", "title", "price", "released", "updated", "live", "notes", "synth_id"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"id":       ddl.ColumnDef{Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"title":    ddl.ColumnDef{Name: "title", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, NotNull: true},
+				"price":    ddl.ColumnDef{Name: "price", T: ddl.Type{Name: ddl.Float64}, NotNull: true},
+				"released": ddl.ColumnDef{Name: "released", T: ddl.Type{Name: ddl.Date}, NotNull: true},
+				"updated":  ddl.ColumnDef{Name: "updated", T: ddl.Type{Name: ddl.Timestamp}, NotNull: true},
+				"live":     ddl.ColumnDef{Name: "live", T: ddl.Type{Name: ddl.Bool}, NotNull: true},
+				"notes":    ddl.ColumnDef{Name: "notes", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"synth_id": ddl.ColumnDef{Name: "synth_id", T: ddl.Type{Name: ddl.Int64}},
+			},
+			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "synth_id"}},
+		},
+		"empty": ddl.CreateTable{
+			Name:     "empty",
+			ColNames: []string{"a", "b", "synth_id"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"a":        ddl.ColumnDef{Name: "a", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"b":        ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"synth_id": ddl.ColumnDef{Name: "synth_id", T: ddl.Type{Name: ddl.Int64}},
+			},
+			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "synth_id"}},
+		},
+	}
+	assert.Equal(t, expectedSchema, stripSchemaComments(conv.SpSchema))
+}
+
+func TestLoadManifest_Errors(t *testing.T) {
+	dir, cleanup := mkTestDir(t, map[string]string{
+		"no_name.json":    `[{"file_patterns": ["a.csv"]}]`,
+		"no_files.json":   `[{"table_name": "t", "file_patterns": ["missing.csv"]}]`,
+		"no_columns.json": `[{"table_name": "t", "file_patterns": ["a.csv"], "header": false}]`,
+		"bad_delim.json":  `[{"table_name": "t", "file_patterns": ["a.csv"], "delimiter": "||"}]`,
+		"bad_json.json":   `{`,
+		"a.csv":           "x\n1\n",
+	})
+	defer cleanup()
+	for _, m := range []string{"no_name.json", "no_files.json", "no_columns.json", "bad_delim.json", "bad_json.json", "missing.json"} {
+		_, err := loadManifest(filepath.Join(dir, m))
+		assert.NotNil(t, err, m)
+	}
+}
+
+func TestInferType(t *testing.T) {
+	tests := []struct {
+		counts   map[string]int64
+		rows     int64
+		ty       string
+		nullable bool
+	}{
+		{map[string]int64{ddl.Int64: 100}, 100, ddl.Int64, false},
+		{map[string]int64{ddl.Int64: 50}, 100, ddl.Int64, true},
+		{map[string]int64{ddl.Int64: 50, ddl.Float64: 50}, 100, ddl.Float64, false},
+		{map[string]int64{ddl.Int64: 50, ddl.Date: 50}, 100, ddl.String, false},
+		{map[string]int64{ddl.Int64: 99999, ddl.Date: 1}, 100000, ddl.Int64, false}, // Ignore errors.
+		{map[string]int64{}, 100, ddl.String, true},
+		{map[string]int64{}, 0, ddl.String, true},
+	}
+	for _, tc := range tests {
+		ty, nullable := inferType(tc.counts, tc.rows)
+		assert.Equal(t, tc.ty, ty, tc.counts)
+		assert.Equal(t, tc.nullable, nullable, tc.counts)
+	}
+}
+
+func TestParseType(t *testing.T) {
+	assert.Equal(t, schema.Type{Name: "INT64"}, parseType("int64"))
+	assert.Equal(t, schema.Type{Name: "STRING", Mods: []int64{100}}, parseType("STRING(100)"))
+	assert.Equal(t, schema.Type{Name: "BYTES"}, parseType("BYTES( MAX )"))
+	assert.Equal(t, schema.Type{Name: "NUMERIC(10,2)"}, parseType("NUMERIC(10, 2)"))
+}
+
+// mkTestDir creates a temporary directory containing files (a map
+// from file name to contents).
+func mkTestDir(t *testing.T, files map[string]string) (dir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "csv_test")
+	assert.Nil(t, err)
+	for name, contents := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func stripSchemaComments(spSchema map[string]ddl.CreateTable) map[string]ddl.CreateTable {
+	for t, ct := range spSchema {
+		for c, cd := range ct.ColDefs {
+			cd.Comment = ""
+			ct.ColDefs[c] = cd
+		}
+		ct.Comment = ""
+		spSchema[t] = ct
+	}
+	return spSchema
+}
@@ -0,0 +1,40 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csv
+
+import (
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// toSpannerType maps a scalar source schema type (defined by id and
+// mods) into a Spanner type. CSV files don't have types of their own:
+// source types are Spanner types, either specified in the manifest or
+// inferred from the data, so this mapping is mostly the identity.
+// toSpannerType returns the Spanner type and a list of type conversion
+// issues encountered.
+func toSpannerType(conv *internal.Conv, id string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	switch id {
+	case ddl.Bool, ddl.Date, ddl.Float64, ddl.Int64, ddl.Numeric, ddl.Timestamp:
+		return ddl.Type{Name: id}, nil
+	case ddl.Bytes, ddl.String:
+		if len(mods) > 0 {
+			return ddl.Type{Name: id, Len: mods[0]}, nil
+		}
+		return ddl.Type{Name: id, Len: ddl.MaxLength}, nil
+	default:
+		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}
+	}
+}
@@ -30,8 +30,17 @@ import (
 // we extract data using Scan requests, convert the data to Spanner data (based
 // on the source and Spanner schemas), and write it to Spanner. If we can't
 // get/process data for a table, we skip that table and process the remaining
-// tables.
+// tables. If conv.CaptureChanges is set, we first record the position
+// from which to stream changes made during and after the scan (see
+// StreamChanges) in conv.ChangePosition.
 func ProcessData(conv *internal.Conv, client dynamoClient) error {
+	if conv.CaptureChanges != "" {
+		pos, err := captureChanges(conv, client)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't start capturing changes: %s", err))
+		}
+		conv.ChangePosition = pos
+	}
 	for srcTable, srcSchema := range conv.SrcSchema {
 		spTable, err1 := internal.GetSpannerTable(conv, srcTable)
 		spCols, err2 := internal.GetSpannerCols(conv, srcTable, srcSchema.ColNames)
@@ -129,26 +138,15 @@ func cvtColValue(attrVal *dynamodb.AttributeValue, srcType string, spType string
 		case typeBinarySet:
 			return attrVal.BS, nil
 		}
+	case ddl.JSON:
+		switch srcType {
+		case typeMap, typeList:
+			return cvtToJSON(attrVal)
+		}
 	case ddl.String:
 		switch srcType {
 		case typeMap, typeList:
-			// For typeMap and typeList, attrVal is a very verbose data
-			// structure that contains null entries for unused type cases. We
-			// strip these out using stripNull. If it is important that the
-			// Spanner values can be easily unmarshalled back to
-			// dynamodb.AttributeValue types, then replace the following five
-			// lines with just:
-			// b, err := json.Marshal(attrVal)
-			// but note that this will consume extra Spanner storage.
-			val, err := stripNull(attrVal)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert %v to a go struct", attrVal.GoString())
-			}
-			b, err := json.Marshal(val)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert %v to a json string", attrVal.GoString())
-			}
-			return string(b), nil
+			return cvtToJSON(attrVal)
 		case typeString:
 			return *attrVal.S, nil
 		case typeStringSet:
@@ -190,6 +188,25 @@ func cvtColValue(attrVal *dynamodb.AttributeValue, srcType string, spType string
 	return nil, fmt.Errorf("can't convert value of type %s to Spanner type %s", attrVal.GoString(), spType)
 }
 
+// cvtToJSON converts a typeMap or typeList attrVal to a json string.
+// For these types, attrVal is a very verbose data structure that contains
+// null entries for unused type cases. We strip these out using stripNull.
+// If it is important that the Spanner values can be easily unmarshalled
+// back to dynamodb.AttributeValue types, then replace the stripNull call
+// with json.Marshal(attrVal), but note that this will consume extra
+// Spanner storage.
+func cvtToJSON(attrVal *dynamodb.AttributeValue) (string, error) {
+	val, err := stripNull(attrVal)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert %v to a go struct", attrVal.GoString())
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert %v to a json string", attrVal.GoString())
+	}
+	return string(b), nil
+}
+
 // stripNull converts a dynamodb.AttributeValue to a Go struct which can
 // be easily encoded to a json string. If we use the normal json encoder, it
 // will have many null values. The purpose of this function is to remove the
@@ -175,6 +175,8 @@ func TestCvtColValue(t *testing.T) {
 		{"bool", typeBool, ddl.Bool, &dynamodb.AttributeValue{BOOL: &boolVal}, true},
 		{"binary", typeBinary, ddl.Bytes, &dynamodb.AttributeValue{B: binaryVal}, binaryVal},
 		{"binary set", typeBinarySet, ddl.Bytes, &dynamodb.AttributeValue{BS: binarySetVal}, binarySetVal},
+		{"map", typeMap, ddl.JSON, &dynamodb.AttributeValue{M: mapVal}, "{\"list\":[\"str-1\",\"1234.56789\"]}"},
+		{"list", typeList, ddl.JSON, &dynamodb.AttributeValue{L: listVal}, "[\"str-1\",\"1234.56789\"]"},
 		{"map", typeMap, ddl.String, &dynamodb.AttributeValue{M: mapVal}, "{\"list\":[\"str-1\",\"1234.56789\"]}"},
 		{"list", typeList, ddl.String, &dynamodb.AttributeValue{L: listVal}, "[\"str-1\",\"1234.56789\"]"},
 		{"string", typeString, ddl.String, &dynamodb.AttributeValue{S: &str}, str},
@@ -0,0 +1,85 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"os"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func init() {
+	source.Register("dynamodb", driver{})
+}
+
+// driver implements source.Driver (and source.ChangeStreamer) for AWS
+// DynamoDB. This is an experimental driver; implementation in progress.
+type driver struct{}
+
+func (driver) Kind() source.Kind { return source.Client }
+
+func (driver) ProcessSchema(conv *internal.Conv, src source.Source) error {
+	return ProcessSchema(conv, newClient(), []string{}, src.SampleSize)
+}
+
+func (driver) SetRowStats(conv *internal.Conv, src source.Source) error {
+	SetRowStats(conv, newClient())
+	return nil
+}
+
+func (driver) ProcessData(conv *internal.Conv, src source.Source) error {
+	return ProcessData(conv, newClient())
+}
+
+func (driver) StreamChanges(conv *internal.Conv, src source.Source, pos string, apply func(ms []*sp.Mutation, pos string, commitTime time.Time) error) error {
+	return StreamChanges(conv, newClient(), pos, src.Follow, apply)
+}
+
+// ToSpannerType returns the default Spanner type for srcType: we don't
+// currently support alternative type mappings for DynamoDB.
+func (driver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	return toSpannerType(nil, srcType, mods)
+}
+
+// awsClient combines the DynamoDB and DynamoDB Streams clients, to
+// implement dynamoClient.
+type awsClient struct {
+	*dynamodb.DynamoDB
+	*dynamodbstreams.DynamoDBStreams
+}
+
+// newClient returns a DynamoDB client. Credentials and region are taken
+// from the standard AWS environment variables and config files. The
+// DynamoDB endpoint can be overridden (e.g. to use DynamoDB local) via
+// environment variable DYNAMODB_ENDPOINT_OVERRIDE (which also applies to
+// DynamoDB Streams).
+func newClient() awsClient {
+	cfg := aws.Config{}
+	endpointOverride := os.Getenv("DYNAMODB_ENDPOINT_OVERRIDE")
+	if endpointOverride != "" {
+		cfg.Endpoint = aws.String(endpointOverride)
+	}
+	s := session.Must(session.NewSession())
+	return awsClient{dynamodb.New(s, &cfg), dynamodbstreams.New(s, &cfg)}
+}
@@ -23,6 +23,7 @@ import (
 	sp "cloud.google.com/go/spanner"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
 	"github.com/cloudspannerecosystem/harbourbridge/internal"
 	"github.com/cloudspannerecosystem/harbourbridge/schema"
 )
@@ -44,10 +45,15 @@ const (
 	conflictThreshold = float64(0.05)
 )
 
+// dynamoClient is the subset of the DynamoDB and DynamoDB Streams APIs
+// that we use.
 type dynamoClient interface {
 	ListTables(input *dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error)
 	DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error)
 	Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error)
+	DescribeStream(input *dynamodbstreams.DescribeStreamInput) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(input *dynamodbstreams.GetShardIteratorInput) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(input *dynamodbstreams.GetRecordsInput) (*dynamodbstreams.GetRecordsOutput, error)
 }
 
 // ProcessSchema performs schema conversion for source tables in a DynamoDB
@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
 	"github.com/cloudspannerecosystem/harbourbridge/internal"
 	"github.com/cloudspannerecosystem/harbourbridge/schema"
 	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
@@ -32,6 +33,14 @@ type mockDynamoClient struct {
 	describeTableOutputs   []dynamodb.DescribeTableOutput
 	scanCallCount          int
 	scanOutputs            []dynamodb.ScanOutput
+	// getShardIteratorInputs records the inputs of GetShardIterator calls.
+	describeStreamCallCount   int
+	describeStreamOutputs     []dynamodbstreams.DescribeStreamOutput
+	getShardIteratorCallCount int
+	getShardIteratorOutputs   []dynamodbstreams.GetShardIteratorOutput
+	getShardIteratorInputs    []dynamodbstreams.GetShardIteratorInput
+	getRecordsCallCount       int
+	getRecordsOutputs         []dynamodbstreams.GetRecordsOutput
 }
 
 func (m *mockDynamoClient) ListTables(input *dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error) {
@@ -58,6 +67,31 @@ func (m *mockDynamoClient) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput
 	return &m.scanOutputs[m.scanCallCount-1], nil
 }
 
+func (m *mockDynamoClient) DescribeStream(input *dynamodbstreams.DescribeStreamInput) (*dynamodbstreams.DescribeStreamOutput, error) {
+	if m.describeStreamCallCount >= len(m.describeStreamOutputs) {
+		return nil, fmt.Errorf("unexpected call to DescribeStream: %v", input)
+	}
+	m.describeStreamCallCount++
+	return &m.describeStreamOutputs[m.describeStreamCallCount-1], nil
+}
+
+func (m *mockDynamoClient) GetShardIterator(input *dynamodbstreams.GetShardIteratorInput) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	if m.getShardIteratorCallCount >= len(m.getShardIteratorOutputs) {
+		return nil, fmt.Errorf("unexpected call to GetShardIterator: %v", input)
+	}
+	m.getShardIteratorCallCount++
+	m.getShardIteratorInputs = append(m.getShardIteratorInputs, *input)
+	return &m.getShardIteratorOutputs[m.getShardIteratorCallCount-1], nil
+}
+
+func (m *mockDynamoClient) GetRecords(input *dynamodbstreams.GetRecordsInput) (*dynamodbstreams.GetRecordsOutput, error) {
+	if m.getRecordsCallCount >= len(m.getRecordsOutputs) {
+		return nil, fmt.Errorf("unexpected call to GetRecords: %v", input)
+	}
+	m.getRecordsCallCount++
+	return &m.getRecordsOutputs[m.getRecordsCallCount-1], nil
+}
+
 func TestProcessSchema(t *testing.T) {
 	tableNameA := "test_a"
 	tableNameB := "test_b"
@@ -255,8 +289,8 @@ func TestProcessSchema_FullDataTypes(t *testing.T) {
 				"c": {Name: "c", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
 				"d": {Name: "d", T: ddl.Type{Name: ddl.Bool}},
 				"e": {Name: "e", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
-				"f": {Name: "f", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
-				"g": {Name: "g", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"f": {Name: "f", T: ddl.Type{Name: ddl.JSON}},
+				"g": {Name: "g", T: ddl.Type{Name: ddl.JSON}},
 				"h": {Name: "h", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength, IsArray: true}},
 				"i": {Name: "i", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength, IsArray: true}},
 				"j": {Name: "j", T: ddl.Type{Name: ddl.Numeric, IsArray: true}},
@@ -0,0 +1,322 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+)
+
+// Changes are read from the DynamoDB stream of each table. This is the
+// only change log location (value of the -cdc flag) we support.
+const changeStreams = "streams"
+
+// shardDone marks shards that were read to their end in
+// streamPosition.Shards.
+const shardDone = "done"
+
+// pollInterval is the time to wait for new records when following the
+// streams.
+var pollInterval = time.Second
+
+// streamPosition is the position of streaming changes from DynamoDB
+// Streams, saved (as JSON) in conv.ChangePosition and passed to the
+// apply function of StreamChanges.
+type streamPosition struct {
+	// Records created before Start were read by data conversion.
+	Start time.Time `json:"start"`
+	// ARN of the stream of each table, when data conversion started.
+	Streams map[string]string `json:"streams"`
+	// Sequence number of the last record read from each shard (keyed
+	// by table and shard id), or shardDone.
+	Shards map[string]string `json:"shards,omitempty"`
+}
+
+func (p streamPosition) String() string {
+	b, _ := json.Marshal(p)
+	return string(b)
+}
+
+// captureChanges returns the position from which to stream changes to
+// the tables of conv once they have been scanned. Streams must be
+// enabled on every table, and include new images of items.
+func captureChanges(conv *internal.Conv, client dynamoClient) (string, error) {
+	if conv.CaptureChanges != changeStreams {
+		return "", fmt.Errorf("unsupported change log %q: changes can only be read from %q", conv.CaptureChanges, changeStreams)
+	}
+	p := streamPosition{Start: time.Now(), Streams: make(map[string]string)}
+	for srcTable := range conv.SrcSchema {
+		result, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(srcTable)})
+		if err != nil {
+			return "", fmt.Errorf("failed to make a DescribeTable API call for table %v: %v", srcTable, err)
+		}
+		spec := result.Table.StreamSpecification
+		if spec == nil || !aws.BoolValue(spec.StreamEnabled) || result.Table.LatestStreamArn == nil {
+			return "", fmt.Errorf("stream is not enabled for table %s", srcTable)
+		}
+		if v := aws.StringValue(spec.StreamViewType); v != dynamodb.StreamViewTypeNewImage && v != dynamodb.StreamViewTypeNewAndOldImages {
+			return "", fmt.Errorf("stream of table %s doesn't include new images (view type is %s)", srcTable, v)
+		}
+		p.Streams[srcTable] = *result.Table.LatestStreamArn
+	}
+	return p.String(), nil
+}
+
+// StreamChanges reads changes to the tables of conv from their DynamoDB
+// streams, starting at position pos (as recorded in
+// conv.ChangePosition), and converts them to Spanner mutations. Records
+// are read one shard at a time, reading parent shards before their
+// children so that changes to each item are applied in order. It calls
+// apply with the mutations of the records returned by each GetRecords
+// call, the position after them and the creation time of the last
+// record. If follow is set, StreamChanges polls the streams for new
+// records, and only returns on error (including errors from apply).
+//
+// Records created before data conversion started are skipped. Records
+// created while tables were scanned are applied again: items are
+// written with InsertOrUpdate mutations, so this is harmless. Streams
+// only keep records for 24 hours, so data conversion and streaming
+// must be done within that time.
+func StreamChanges(conv *internal.Conv, client dynamoClient, pos string, follow bool, apply func(ms []*sp.Mutation, pos string, commitTime time.Time) error) error {
+	var p streamPosition
+	if err := json.Unmarshal([]byte(pos), &p); err != nil {
+		return fmt.Errorf("bad stream position %q: %w", pos, err)
+	}
+	if p.Shards == nil {
+		p.Shards = make(map[string]string)
+	}
+	// Approximate creation times are rounded down to the second.
+	p.Start = p.Start.Truncate(time.Second)
+	var tables []string
+	for t := range p.Streams {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	r := &streamReader{conv: conv, client: client, pos: p, apply: apply}
+	for {
+		n := 0
+		for _, t := range tables {
+			m, err := r.readStream(t)
+			if err != nil {
+				return err
+			}
+			n += m
+		}
+		if n == 0 {
+			if !follow {
+				return nil
+			}
+			time.Sleep(pollInterval)
+		}
+	}
+}
+
+// streamReader reads records from DynamoDB streams, and applies them.
+type streamReader struct {
+	conv   *internal.Conv
+	client dynamoClient
+	pos    streamPosition
+	apply  func(ms []*sp.Mutation, pos string, commitTime time.Time) error
+}
+
+// readStream reads the new records of the stream of srcTable, and
+// returns the number of records read.
+func (r *streamReader) readStream(srcTable string) (int, error) {
+	arn := r.pos.Streams[srcTable]
+	shards, err := listShards(r.client, arn)
+	if err != nil {
+		return 0, fmt.Errorf("can't read stream of table %s: %w", srcTable, err)
+	}
+	key := func(id string) string { return srcTable + "/" + id }
+	ids := make(map[string]bool)
+	for _, s := range shards {
+		ids[key(*s.ShardId)] = true
+	}
+	// Shards are deleted after 24 hours, so we can forget them.
+	for k := range r.pos.Shards {
+		if strings.HasPrefix(k, key("")) && !ids[k] {
+			delete(r.pos.Shards, k)
+		}
+	}
+	n := 0
+	for progress := true; progress; {
+		progress = false
+		for _, s := range shards {
+			if r.pos.Shards[key(*s.ShardId)] == shardDone {
+				continue
+			}
+			if parent := aws.StringValue(s.ParentShardId); parent != "" && ids[key(parent)] && r.pos.Shards[key(parent)] != shardDone {
+				continue
+			}
+			m, done, err := r.readShard(srcTable, arn, key(*s.ShardId), s)
+			if err != nil {
+				return n, fmt.Errorf("can't read stream of table %s: %w", srcTable, err)
+			}
+			n += m
+			if done {
+				// Children of s can now be read.
+				progress = true
+			}
+		}
+	}
+	return n, nil
+}
+
+// listShards returns the shards of stream arn.
+func listShards(client dynamoClient, arn string) ([]*dynamodbstreams.Shard, error) {
+	var shards []*dynamodbstreams.Shard
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(arn)}
+	for {
+		result, err := client.DescribeStream(input)
+		if err != nil {
+			return nil, err
+		}
+		shards = append(shards, result.StreamDescription.Shards...)
+		if result.StreamDescription.LastEvaluatedShardId == nil {
+			return shards, nil
+		}
+		input.ExclusiveStartShardId = result.StreamDescription.LastEvaluatedShardId
+	}
+}
+
+// readShard reads the new records of shard s (with position key key)
+// of the stream arn of srcTable, and applies them. It returns the
+// number of records read, and whether the shard was read to its end.
+func (r *streamReader) readShard(srcTable, arn, key string, s *dynamodbstreams.Shard) (int, bool, error) {
+	input := &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(arn),
+		ShardId:           s.ShardId,
+		ShardIteratorType: aws.String(dynamodbstreams.ShardIteratorTypeTrimHorizon),
+	}
+	if seq := r.pos.Shards[key]; seq != "" {
+		input.ShardIteratorType = aws.String(dynamodbstreams.ShardIteratorTypeAfterSequenceNumber)
+		input.SequenceNumber = aws.String(seq)
+	}
+	result, err := r.client.GetShardIterator(input)
+	if err != nil {
+		return 0, false, err
+	}
+	// Open shards have no ending sequence number. We read them until we
+	// catch up, and read closed shards until there's no next iterator.
+	open := s.SequenceNumberRange == nil || s.SequenceNumberRange.EndingSequenceNumber == nil
+	n := 0
+	for it := result.ShardIterator; it != nil; {
+		records, err := r.client.GetRecords(&dynamodbstreams.GetRecordsInput{ShardIterator: it})
+		if err != nil {
+			return n, false, err
+		}
+		if len(records.Records) == 0 && open {
+			return n, false, nil
+		}
+		n += len(records.Records)
+		if err := r.applyRecords(srcTable, key, records.Records); err != nil {
+			return n, false, err
+		}
+		it = records.NextShardIterator
+	}
+	r.pos.Shards[key] = shardDone
+	return n, true, nil
+}
+
+// applyRecords converts records of srcTable (from the shard with
+// position key key) to Spanner mutations and applies them.
+func (r *streamReader) applyRecords(srcTable, key string, records []*dynamodbstreams.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	var ms []*sp.Mutation
+	var commitTime time.Time
+	counts := make(internal.ChangeCounts)
+	for _, rec := range records {
+		t := aws.TimeValue(rec.Dynamodb.ApproximateCreationDateTime)
+		if t.Before(r.pos.Start) {
+			continue
+		}
+		commitTime = t
+		if m := recordMutation(r.conv, srcTable, rec, counts); m != nil {
+			ms = append(ms, m)
+		}
+	}
+	r.pos.Shards[key] = aws.StringValue(records[len(records)-1].Dynamodb.SequenceNumber)
+	if len(ms) == 0 {
+		return nil
+	}
+	if err := r.apply(ms, r.pos.String(), commitTime); err != nil {
+		return err
+	}
+	r.conv.StatsAddChanges(counts)
+	return nil
+}
+
+// recordMutation converts stream record rec of srcTable to a Spanner
+// mutation, and counts it in counts. Records that can't be converted
+// are reported as unexpected conditions, and counted as change errors
+// in conv.
+func recordMutation(conv *internal.Conv, srcTable string, rec *dynamodbstreams.Record, counts internal.ChangeCounts) *sp.Mutation {
+	srcSchema := conv.SrcSchema[srcTable]
+	spTable, err1 := internal.GetSpannerTable(conv, srcTable)
+	spCols, err2 := internal.GetSpannerCols(conv, srcTable, srcSchema.ColNames)
+	spSchema, ok := conv.SpSchema[spTable]
+	if err1 != nil || err2 != nil || !ok {
+		conv.Unexpected(fmt.Sprintf("Can't get cols and schemas for table %s: err1=%s, err2=%s, ok=%t",
+			srcTable, err1, err2, ok))
+		conv.StatsAddChange(srcTable, internal.ChangeError)
+		return nil
+	}
+	switch aws.StringValue(rec.EventName) {
+	case dynamodbstreams.OperationTypeInsert, dynamodbstreams.OperationTypeModify:
+		spVals, badCols, _ := cvtRow(rec.Dynamodb.NewImage, srcSchema, spSchema, spCols)
+		if len(badCols) > 0 {
+			conv.Unexpected(fmt.Sprintf("Data conversion error for table %s in column(s) %s\n", srcTable, badCols))
+			conv.StatsAddChange(srcTable, internal.ChangeError)
+			return nil
+		}
+		if aws.StringValue(rec.EventName) == dynamodbstreams.OperationTypeInsert {
+			counts.Add(srcTable, internal.ChangeInsert)
+		} else {
+			counts.Add(srcTable, internal.ChangeUpdate)
+		}
+		return sp.InsertOrUpdate(spTable, spCols, spVals)
+	case dynamodbstreams.OperationTypeRemove:
+		// Only the key attributes are needed (and set).
+		spVals, badCols, _ := cvtRow(rec.Dynamodb.Keys, srcSchema, spSchema, spCols)
+		var key sp.Key
+		for _, k := range spSchema.Pks {
+			for i, c := range spCols {
+				if c == k.Col && spVals[i] != nil {
+					key = append(key, spVals[i])
+				}
+			}
+		}
+		if len(badCols) > 0 || len(key) != len(spSchema.Pks) {
+			conv.Unexpected(fmt.Sprintf("Can't get key of item removed from table %s: bad column(s) %s\n", srcTable, badCols))
+			conv.StatsAddChange(srcTable, internal.ChangeError)
+			return nil
+		}
+		counts.Add(srcTable, internal.ChangeDelete)
+		return sp.Delete(spTable, key)
+	}
+	conv.Unexpected(fmt.Sprintf("Unknown event in stream of table %s: %s", srcTable, aws.StringValue(rec.EventName)))
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamodb
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodbstreams"
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+	"github.com/stretchr/testify/assert"
+)
+
+func streamsConv() *internal.Conv {
+	cols := []string{"a", "b"}
+	return buildConv(
+		ddl.CreateTable{
+			Name:     "testtable",
+			ColNames: cols,
+			ColDefs: map[string]ddl.ColumnDef{
+				"a": {Name: "a", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"b": {Name: "b", T: ddl.Type{Name: ddl.Numeric}},
+			},
+			Pks: []ddl.IndexKey{{Col: "a"}},
+		},
+		schema.Table{
+			Name:     "testtable",
+			ColNames: cols,
+			ColDefs: map[string]schema.Column{
+				"a": {Name: "a", Type: schema.Type{Name: typeString}},
+				"b": {Name: "b", Type: schema.Type{Name: typeNumber}},
+			},
+			PrimaryKeys: []schema.Key{{Column: "a"}},
+		},
+	)
+}
+
+func record(seq, event string, t time.Time, item map[string]*dynamodb.AttributeValue) *dynamodbstreams.Record {
+	r := &dynamodbstreams.Record{
+		EventName: aws.String(event),
+		Dynamodb: &dynamodbstreams.StreamRecord{
+			ApproximateCreationDateTime: aws.Time(t),
+			SequenceNumber:              aws.String(seq),
+		},
+	}
+	if event == dynamodbstreams.OperationTypeRemove {
+		r.Dynamodb.Keys = item
+	} else {
+		r.Dynamodb.NewImage = item
+	}
+	return r
+}
+
+func TestCaptureChanges(t *testing.T) {
+	conv := streamsConv()
+	conv.CaptureChanges = changeStreams
+	client := &mockDynamoClient{
+		describeTableOutputs: []dynamodb.DescribeTableOutput{{
+			Table: &dynamodb.TableDescription{
+				LatestStreamArn: aws.String("arn1"),
+				StreamSpecification: &dynamodb.StreamSpecification{
+					StreamEnabled:  aws.Bool(true),
+					StreamViewType: aws.String(dynamodb.StreamViewTypeNewAndOldImages),
+				},
+			},
+		}},
+	}
+	pos, err := captureChanges(conv, client)
+	assert.Nil(t, err)
+	var p streamPosition
+	assert.Nil(t, json.Unmarshal([]byte(pos), &p))
+	assert.Equal(t, map[string]string{"testtable": "arn1"}, p.Streams)
+
+	// Streams must include new images.
+	client = &mockDynamoClient{
+		describeTableOutputs: []dynamodb.DescribeTableOutput{{
+			Table: &dynamodb.TableDescription{
+				LatestStreamArn: aws.String("arn1"),
+				StreamSpecification: &dynamodb.StreamSpecification{
+					StreamEnabled:  aws.Bool(true),
+					StreamViewType: aws.String(dynamodb.StreamViewTypeKeysOnly),
+				},
+			},
+		}},
+	}
+	_, err = captureChanges(conv, client)
+	assert.NotNil(t, err)
+}
+
+func TestStreamChanges(t *testing.T) {
+	start := time.Date(2021, 6, 1, 12, 0, 0, 500000000, time.UTC)
+	second := start.Truncate(time.Second)
+	shards := dynamodbstreams.DescribeStreamOutput{
+		StreamDescription: &dynamodbstreams.StreamDescription{
+			// Children can be listed before their parents.
+			Shards: []*dynamodbstreams.Shard{
+				{
+					ShardId:             aws.String("shard-2"),
+					ParentShardId:       aws.String("shard-1"),
+					SequenceNumberRange: &dynamodbstreams.SequenceNumberRange{StartingSequenceNumber: aws.String("400")},
+				},
+				{
+					ShardId:             aws.String("shard-1"),
+					SequenceNumberRange: &dynamodbstreams.SequenceNumberRange{StartingSequenceNumber: aws.String("100"), EndingSequenceNumber: aws.String("300")},
+				},
+			},
+		},
+	}
+	item := func(a string, b *string) map[string]*dynamodb.AttributeValue {
+		m := map[string]*dynamodb.AttributeValue{"a": {S: aws.String(a)}}
+		if b != nil {
+			m["b"] = &dynamodb.AttributeValue{N: b}
+		}
+		return m
+	}
+	client := &mockDynamoClient{
+		describeStreamOutputs: []dynamodbstreams.DescribeStreamOutput{shards, shards},
+		getShardIteratorOutputs: []dynamodbstreams.GetShardIteratorOutput{
+			{ShardIterator: aws.String("it1")},
+			{ShardIterator: aws.String("it3")},
+			{ShardIterator: aws.String("it5")},
+		},
+		getRecordsOutputs: []dynamodbstreams.GetRecordsOutput{
+			// shard-1.
+			{
+				Records: []*dynamodbstreams.Record{
+					// Changes before the scan started are skipped.
+					record("100", dynamodbstreams.OperationTypeInsert, start.Add(-10*time.Second), item("x", aws.String("1"))),
+					record("200", dynamodbstreams.OperationTypeModify, second, item("y", aws.String("2"))),
+				},
+				NextShardIterator: aws.String("it2"),
+			},
+			{
+				Records: []*dynamodbstreams.Record{
+					record("300", dynamodbstreams.OperationTypeRemove, start.Add(5*time.Second), item("x", nil)),
+				},
+			},
+			// shard-2, which is open.
+			{
+				Records: []*dynamodbstreams.Record{
+					record("400", dynamodbstreams.OperationTypeInsert, start.Add(10*time.Second), item("z", nil)),
+				},
+				NextShardIterator: aws.String("it4"),
+			},
+			{NextShardIterator: aws.String("it4")},
+			// shard-2, on the next poll.
+			{NextShardIterator: aws.String("it5")},
+		},
+	}
+	conv := streamsConv()
+	type appliedRecords struct {
+		ms     []*sp.Mutation
+		shards map[string]string
+		commit time.Time
+	}
+	var got []appliedRecords
+	apply := func(ms []*sp.Mutation, pos string, commitTime time.Time) error {
+		var p streamPosition
+		assert.Nil(t, json.Unmarshal([]byte(pos), &p))
+		got = append(got, appliedRecords{ms, p.Shards, commitTime})
+		return nil
+	}
+	pos := streamPosition{Start: start, Streams: map[string]string{"testtable": "arn1"}}.String()
+	err := StreamChanges(conv, client, pos, false, apply)
+	assert.Nil(t, err)
+	cols := []string{"a", "b"}
+	assert.Equal(t, []appliedRecords{
+		{
+			[]*sp.Mutation{sp.InsertOrUpdate("testtable", cols, []interface{}{"y", *big.NewRat(2, 1)})},
+			map[string]string{"testtable/shard-1": "200"},
+			second,
+		},
+		{
+			[]*sp.Mutation{sp.Delete("testtable", sp.Key{"x"})},
+			map[string]string{"testtable/shard-1": "300"},
+			start.Add(5 * time.Second),
+		},
+		{
+			// Missing attributes are set to NULL.
+			[]*sp.Mutation{sp.InsertOrUpdate("testtable", cols, []interface{}{"z", nil})},
+			map[string]string{"testtable/shard-1": shardDone, "testtable/shard-2": "400"},
+			start.Add(10 * time.Second),
+		},
+	}, got)
+	assert.Equal(t, dynamodbstreams.ShardIteratorTypeTrimHorizon, *client.getShardIteratorInputs[1].ShardIteratorType)
+	assert.Equal(t, dynamodbstreams.ShardIteratorTypeAfterSequenceNumber, *client.getShardIteratorInputs[2].ShardIteratorType)
+	assert.Equal(t, "400", *client.getShardIteratorInputs[2].SequenceNumber)
+	c := conv.Stats.Changes["testtable"]
+	assert.Equal(t, []int64{1, 1, 1, 0}, []int64{c.Insert, c.Update, c.Delete, c.Error})
+}
@@ -77,8 +77,10 @@ func toSpannerType(conv *internal.Conv, id string, mods []int64) (ddl.Type, []in
 	switch id {
 	case typeNumber:
 		return ddl.Type{Name: ddl.Numeric}, nil
-	case typeNumberString, typeString, typeList, typeMap:
+	case typeNumberString, typeString:
 		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+	case typeList, typeMap:
+		return ddl.Type{Name: ddl.JSON}, nil
 	case typeBool:
 		return ddl.Type{Name: ddl.Bool}, nil
 	case typeBinary:
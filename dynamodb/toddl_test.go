@@ -57,8 +57,8 @@ func TestToSpannerType(t *testing.T) {
 			"c": {Name: "c", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
 			"d": {Name: "d", T: ddl.Type{Name: ddl.Bool}},
 			"e": {Name: "e", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
-			"f": {Name: "f", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
-			"g": {Name: "g", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+			"f": {Name: "f", T: ddl.Type{Name: ddl.JSON}},
+			"g": {Name: "g", T: ddl.Type{Name: ddl.JSON}},
 			"h": {Name: "h", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength, IsArray: true}},
 			"i": {Name: "i", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength, IsArray: true}},
 			"j": {Name: "j", T: ddl.Type{Name: ddl.Numeric, IsArray: true}},
@@ -1,29 +1,28 @@
 module github.com/cloudspannerecosystem/harbourbridge
 
-go 1.13
+go 1.15
 
 require (
-	cloud.google.com/go v0.78.0
-	cloud.google.com/go/spanner v1.10.0
+	cloud.google.com/go v0.100.2
+	cloud.google.com/go/spanner v1.31.0
 	github.com/DATA-DOG/go-sqlmock v1.4.1
 	github.com/aws/aws-sdk-go v1.34.5
-	github.com/davecgh/go-spew v1.1.1
+	github.com/denisenkom/go-mssqldb v0.9.0
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/gorilla/handlers v1.5.0
 	github.com/gorilla/mux v1.7.3
-	github.com/goware/modvendor v0.0.0-20190516042800-ce72b408a8fe // indirect
-	github.com/juju/errors v0.0.0-20200330140219-3fe23663418f
+	github.com/klauspost/compress v1.11.7
 	github.com/lfittl/pg_query_go v1.0.0
 	github.com/lib/pq v1.9.0
-	github.com/mattn/go-zglob v0.0.1 // indirect
+	github.com/mattn/go-sqlite3 v2.0.1+incompatible
 	//github.com/pingcap/parser v3.0.12+incompatible
 	github.com/pingcap/parser v0.0.0-20200422082501-7329d80eaf2c
 	github.com/pingcap/tidb v1.1.0-beta.0.20200423105559-af376db3dc46
-	github.com/pingcap/tipb v0.0.0-20200417094153-7316d94df1ee // indirect
+	github.com/sijms/go-ora/v2 v2.2.17
 	github.com/sirupsen/logrus v1.5.0 // indirect
-	github.com/stretchr/testify v1.5.1
+	github.com/stretchr/testify v1.7.0
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
-	google.golang.org/api v0.40.0
-	google.golang.org/genproto v0.0.0-20210222152913-aa3ee6e6a81c
-	google.golang.org/grpc v1.35.0
+	google.golang.org/api v0.74.0
+	google.golang.org/genproto v0.0.0-20220324131243-acbaeb5b85eb
+	google.golang.org/grpc v1.45.0
 )
@@ -0,0 +1,657 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"strings"
+
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// ToSpannerCheck translates the expression expr of a CHECK constraint
+// (source DB SQL text, as recorded in schema.CheckConstraint) to the
+// expression of a Spanner check constraint. col maps source column
+// names to Spanner column names, and returns false for names that
+// aren't columns of the table. We handle the expressions commonly used
+// in check constraints:
+//   - comparisons, AND, OR and NOT
+//   - IS [NOT] NULL, IS [NOT] TRUE/FALSE, [NOT] IN, [NOT] BETWEEN and
+//     [NOT] LIKE (including PostgreSQL's ~~ and !~~ operators)
+//   - PostgreSQL's x = ANY (ARRAY[...]) and x <> ALL (ARRAY[...]), which
+//     pg_dump uses for IN and NOT IN
+//   - +, - and *, and the functions CHAR_LENGTH, LOWER, UPPER, ABS and
+//     CONCAT
+//   - literals (including MySQL strings with a character set
+//     introducer, such as _utf8mb4'abc')
+//
+// Casts of literals and casts to string types are dropped: in the first
+// case, Spanner coerces the literal to the type it is compared with; in
+// the second, the source column is (almost always) mapped to a Spanner
+// STRING column. Other casts can't be translated. ToSpannerCheck
+// returns false if expr can't be translated. Either way, it returns the
+// source columns that expr refers to (as far as we can tell), for
+// reporting.
+func ToSpannerCheck(expr string, col func(string) (string, bool)) ([]ddl.ExprToken, []string, bool) {
+	toks, cols, ok := tokenizeCheck(expr, col)
+	if !ok {
+		return nil, cols, false
+	}
+	p := &checkParser{toks: toks, col: col}
+	e, ok := p.or()
+	if !ok || e.isArray || p.i != len(p.toks) {
+		return nil, cols, false
+	}
+	return e.toks, cols, true
+}
+
+// ToSpannerGenerated translates the expression of a generated column
+// (source DB SQL text, as recorded in schema.Column.Generated) to
+// Spanner, in the same way as ToSpannerCheck: generated columns mostly
+// use the kinds of expressions that check constraints use, such as
+// arithmetic, string functions and comparisons.
+func ToSpannerGenerated(expr string, col func(string) (string, bool)) ([]ddl.ExprToken, []string, bool) {
+	return ToSpannerCheck(expr, col)
+}
+
+// CvtCheckConstraints translates the check constraints of source table
+// srcTable, for the schema conversion of drivers, naming them uniquely
+// among usedNames. Constraints that can't be translated are dropped,
+// and reported as issues of the columns they refer to.
+func CvtCheckConstraints(conv *Conv, srcTable schema.Table, usedNames map[string]bool) []ddl.CheckConstraint {
+	var checks []ddl.CheckConstraint
+	for _, ck := range srcTable.CheckConstraints {
+		expr, cols, ok := ToSpannerCheck(ck.Expr, spannerColFunc(conv, srcTable))
+		if !ok {
+			if len(cols) == 0 && len(srcTable.ColNames) > 0 {
+				// Report constraints that don't refer to any
+				// columns against the first column.
+				cols = srcTable.ColNames[:1]
+			}
+			for _, c := range cols {
+				conv.Issues[srcTable.Name][c] = append(conv.Issues[srcTable.Name][c], CheckConstraint)
+			}
+			continue
+		}
+		checks = append(checks, ddl.CheckConstraint{Name: ToSpannerCheckName(ck.Name, usedNames), Expr: expr})
+	}
+	return checks
+}
+
+// CvtGeneratedColumns translates the expressions of the generated
+// columns of source table srcTable, for the schema conversion of
+// drivers, and adds them to the Spanner columns in spColDef. Generated
+// columns with expressions that can't be translated are left as regular
+// columns, and reported as issues.
+func CvtGeneratedColumns(conv *Conv, srcTable schema.Table, spColDef map[string]ddl.ColumnDef) {
+	for _, srcColName := range srcTable.ColNames {
+		srcCol := srcTable.ColDefs[srcColName]
+		if !srcCol.Ignored.Generated {
+			continue
+		}
+		colName, err := GetSpannerCol(conv, srcTable.Name, srcCol.Name, true)
+		if err != nil {
+			// Already reported by the caller.
+			continue
+		}
+		expr, _, ok := ToSpannerGenerated(srcCol.Generated, spannerColFunc(conv, srcTable))
+		if !ok {
+			conv.Issues[srcTable.Name][srcCol.Name] = append(conv.Issues[srcTable.Name][srcCol.Name], GeneratedColumn)
+			continue
+		}
+		cd := spColDef[colName]
+		cd.Generated = expr
+		spColDef[colName] = cd
+	}
+}
+
+// spannerColFunc returns a function that maps the source columns of
+// srcTable to Spanner columns, for ToSpannerCheck and
+// ToSpannerGenerated.
+func spannerColFunc(conv *Conv, srcTable schema.Table) func(string) (string, bool) {
+	return func(c string) (string, bool) {
+		if _, ok := srcTable.ColDefs[c]; !ok {
+			return "", false
+		}
+		spCol, err := GetSpannerCol(conv, srcTable.Name, c, true)
+		return spCol, err == nil
+	}
+}
+
+// Kinds of check constraint tokens.
+const (
+	checkName   = iota // Keyword, function name or column name.
+	checkQuoted        // Quoted identifier.
+	checkString        // String literal (unquoted).
+	checkNumber
+	checkOp // Operator or punctuation.
+)
+
+type checkToken struct {
+	kind int
+	text string
+}
+
+var checkOps = []string{"::", "<>", "!=", "<=", ">=", "||", "!~~", "~~", "=", "<", ">", "(", ")", "[", "]", ",", ".", "+", "-", "*"}
+
+// tokenizeCheck splits expr into tokens. It also returns the columns
+// that expr refers to.
+func tokenizeCheck(expr string, col func(string) (string, bool)) ([]checkToken, []string, bool) {
+	var toks []checkToken
+	var cols []string
+	seen := make(map[string]bool)
+	addCol := func(name string) {
+		if _, ok := col(name); ok && !seen[name] {
+			seen[name] = true
+			cols = append(cols, name)
+		}
+	}
+	p := &defaultParser{s: expr}
+	for p.space(); p.i < len(p.s); p.space() {
+		c := p.s[p.i]
+		switch {
+		case c == '\'':
+			v, ok := p.str()
+			if !ok {
+				return nil, cols, false
+			}
+			toks = append(toks, checkToken{checkString, v.val})
+		case c == '"' || c == '`':
+			s, ok := quotedIdent(p)
+			if !ok {
+				return nil, cols, false
+			}
+			addCol(s)
+			toks = append(toks, checkToken{checkQuoted, s})
+		case isDigit(c) || (c == '.' && p.i+1 < len(p.s) && isDigit(p.s[p.i+1])):
+			n := defaultNumberRe.FindString(p.s[p.i:])
+			p.i += len(n)
+			toks = append(toks, checkToken{checkNumber, n})
+		case isNameChar(c):
+			name := p.name()
+			if name[0] == '_' && p.i < len(p.s) && p.s[p.i] == '\'' {
+				// A MySQL character set introducer, such as _utf8mb4'abc'.
+				continue
+			}
+			addCol(name)
+			toks = append(toks, checkToken{checkName, name})
+		default:
+			op := ""
+			for _, o := range checkOps {
+				if strings.HasPrefix(p.s[p.i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				// An operator we don't handle: keep going, to find
+				// the columns of the expression.
+				op = p.s[p.i : p.i+1]
+			}
+			p.i += len(op)
+			toks = append(toks, checkToken{checkOp, op})
+		}
+	}
+	return toks, cols, true
+}
+
+// quotedIdent reads an identifier quoted with double quotes
+// (PostgreSQL) or backticks (MySQL), in which quotes are doubled.
+func quotedIdent(p *defaultParser) (string, bool) {
+	q := p.s[p.i]
+	var b strings.Builder
+	for p.i++; p.i < len(p.s); p.i++ {
+		if p.s[p.i] == q {
+			if p.i+1 < len(p.s) && p.s[p.i+1] == q {
+				p.i++
+			} else {
+				p.i++
+				return b.String(), true
+			}
+		}
+		b.WriteByte(p.s[p.i])
+	}
+	return "", false
+}
+
+// checkExpr is a translated expression.
+type checkExpr struct {
+	toks    []ddl.ExprToken
+	simple  bool        // True if toks needs no parentheses when used as an operand.
+	literal bool        // True for literals (and arrays of literals).
+	isArray bool        // True for ARRAY[...] (which is only valid with ANY and ALL).
+	elems   []checkExpr // Elements of arrays.
+}
+
+// checkParser parses check constraint expressions, and translates
+// them to Spanner. Its grammar is:
+//
+//	or:        and { OR and }
+//	and:       not { AND not }
+//	not:       NOT not | predicate
+//	predicate: sum [ cmp_op sum | cmp_op { ANY | SOME | ALL } primary
+//	                 | IS [ NOT ] { NULL | TRUE | FALSE }
+//	                 | [ NOT ] IN ( sum { , sum } )
+//	                 | [ NOT ] BETWEEN sum AND sum | [ NOT ] LIKE sum | [ ! ] ~~ sum ]
+//	sum:       product { { + | - | '||' } product }
+//	product:   unary { * unary }
+//	unary:     - unary | primary { :: type_name }
+//	primary:   ( or ) | number | string | TRUE | FALSE | NULL
+//	           | ARRAY [ or { , or } ] | function ( or { , or } ) | column
+type checkParser struct {
+	toks []checkToken
+	i    int // Position of the next token to read.
+	col  func(string) (string, bool)
+}
+
+// keyword reads keyword k, if it comes next.
+func (p *checkParser) keyword(k string) bool {
+	if p.i < len(p.toks) && p.toks[p.i].kind == checkName && strings.EqualFold(p.toks[p.i].text, k) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// op reads operator o, if it comes next.
+func (p *checkParser) op(o string) bool {
+	if p.i < len(p.toks) && p.toks[p.i].kind == checkOp && p.toks[p.i].text == o {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// peekKeyword returns whether the (n+1)th next token is keyword k.
+func (p *checkParser) peekKeyword(n int, k string) bool {
+	return p.i+n < len(p.toks) && p.toks[p.i+n].kind == checkName && strings.EqualFold(p.toks[p.i+n].text, k)
+}
+
+func (p *checkParser) or() (checkExpr, bool) {
+	return p.list("OR", p.and)
+}
+
+func (p *checkParser) and() (checkExpr, bool) {
+	return p.list("AND", p.not)
+}
+
+// list reads a list of operands (read by f) separated by keyword k.
+func (p *checkParser) list(k string, f func() (checkExpr, bool)) (checkExpr, bool) {
+	e, ok := f()
+	if !ok {
+		return e, false
+	}
+	l := []checkExpr{e}
+	for p.keyword(k) {
+		e, ok := f()
+		if !ok {
+			return e, false
+		}
+		l = append(l, e)
+	}
+	if len(l) == 1 {
+		return l[0], true
+	}
+	var toks []ddl.ExprToken
+	for i, e := range l {
+		if e.isArray {
+			return checkExpr{}, false
+		}
+		if i > 0 {
+			toks = append(toks, symbol(k))
+		}
+		toks = append(toks, operand(e)...)
+	}
+	return checkExpr{toks: toks}, true
+}
+
+func (p *checkParser) not() (checkExpr, bool) {
+	if p.keyword("NOT") {
+		e, ok := p.not()
+		if !ok || e.isArray {
+			return checkExpr{}, false
+		}
+		return checkExpr{toks: append([]ddl.ExprToken{symbol("NOT")}, operand(e)...)}, true
+	}
+	return p.predicate()
+}
+
+var checkCmpOps = map[string]string{"=": "=", "<>": "<>", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">="}
+
+func (p *checkParser) predicate() (checkExpr, bool) {
+	l, ok := p.sum()
+	if !ok || p.i == len(p.toks) {
+		return l, ok
+	}
+	t := p.toks[p.i]
+	if cmp, found := checkCmpOps[t.text]; t.kind == checkOp && found {
+		p.i++
+		switch {
+		case p.keyword("ANY") || p.keyword("SOME"):
+			if cmp != "=" {
+				return checkExpr{}, false
+			}
+			return p.in(l, false, p.primary)
+		case p.keyword("ALL"):
+			if cmp != "<>" {
+				return checkExpr{}, false
+			}
+			return p.in(l, true, p.primary)
+		}
+		r, ok := p.sum()
+		if !ok {
+			return r, false
+		}
+		return binary(l, cmp, r)
+	}
+	if p.op("~~") || p.op("!~~") {
+		r, ok := p.sum()
+		if !ok {
+			return r, false
+		}
+		if t.text == "!~~" {
+			return binary(l, "NOT LIKE", r)
+		}
+		return binary(l, "LIKE", r)
+	}
+	if p.keyword("IS") {
+		not := p.keyword("NOT")
+		for _, k := range []string{"NULL", "TRUE", "FALSE"} {
+			if p.keyword(k) {
+				if l.isArray {
+					return checkExpr{}, false
+				}
+				toks := append(operand(l), symbol("IS"))
+				if not {
+					toks = append(toks, symbol("NOT"))
+				}
+				return checkExpr{toks: append(toks, symbol(k))}, true
+			}
+		}
+		return checkExpr{}, false
+	}
+	not := false
+	if p.peekKeyword(0, "NOT") && (p.peekKeyword(1, "IN") || p.peekKeyword(1, "BETWEEN") || p.peekKeyword(1, "LIKE")) {
+		p.i++
+		not = true
+	}
+	switch {
+	case p.keyword("IN"):
+		return p.in(l, not, func() (checkExpr, bool) {
+			if !p.op("(") {
+				return checkExpr{}, false
+			}
+			elems, ok := p.exprList(")", p.sum)
+			return checkExpr{isArray: true, elems: elems}, ok
+		})
+	case p.keyword("BETWEEN"):
+		lo, ok := p.sum()
+		if !ok || !p.keyword("AND") {
+			return checkExpr{}, false
+		}
+		hi, ok := p.sum()
+		if !ok || l.isArray || lo.isArray || hi.isArray {
+			return checkExpr{}, false
+		}
+		op := "BETWEEN"
+		if not {
+			op = "NOT BETWEEN"
+		}
+		toks := append(operand(l), symbol(op))
+		toks = append(toks, operand(lo)...)
+		toks = append(toks, symbol("AND"))
+		return checkExpr{toks: append(toks, operand(hi)...)}, true
+	case p.keyword("LIKE"):
+		r, ok := p.sum()
+		if !ok {
+			return r, false
+		}
+		if not {
+			return binary(l, "NOT LIKE", r)
+		}
+		return binary(l, "LIKE", r)
+	}
+	return l, true
+}
+
+// in reads an array with f, and returns l [NOT] IN (array elements).
+func (p *checkParser) in(l checkExpr, not bool, f func() (checkExpr, bool)) (checkExpr, bool) {
+	a, ok := f()
+	if !ok || !a.isArray || l.isArray || len(a.elems) == 0 {
+		return checkExpr{}, false
+	}
+	toks := operand(l)
+	if not {
+		toks = append(toks, symbol("NOT"))
+	}
+	toks = append(toks, symbol("IN"), symbol("("))
+	for i, e := range a.elems {
+		if i > 0 {
+			toks = append(toks, symbol(","))
+		}
+		toks = append(toks, e.toks...)
+	}
+	return checkExpr{toks: append(toks, symbol(")"))}, true
+}
+
+func (p *checkParser) sum() (checkExpr, bool) {
+	l, ok := p.product()
+	for ok {
+		var op string
+		switch {
+		case p.op("+"):
+			op = "+"
+		case p.op("-"):
+			op = "-"
+		case p.op("||"):
+			op = "||"
+		default:
+			return l, true
+		}
+		var r checkExpr
+		if r, ok = p.product(); ok {
+			l, ok = binary(l, op, r)
+		}
+	}
+	return l, false
+}
+
+func (p *checkParser) product() (checkExpr, bool) {
+	l, ok := p.unary()
+	for ok && p.op("*") {
+		var r checkExpr
+		if r, ok = p.unary(); ok {
+			l, ok = binary(l, "*", r)
+		}
+	}
+	return l, ok
+}
+
+func (p *checkParser) unary() (checkExpr, bool) {
+	if p.op("-") {
+		e, ok := p.unary()
+		if !ok || e.isArray {
+			return checkExpr{}, false
+		}
+		if len(e.toks) == 1 && e.literal && e.toks[0].Kind == ddl.ExprSymbol && isDigit(e.toks[0].Text[0]) {
+			// A negative number.
+			return checkExpr{toks: []ddl.ExprToken{symbol("-" + e.toks[0].Text)}, simple: true, literal: true}, true
+		}
+		return checkExpr{toks: append([]ddl.ExprToken{symbol("-")}, operand(e)...)}, true
+	}
+	e, ok := p.primary()
+	for ok && p.op("::") {
+		var str bool
+		str, ok = p.typeName()
+		// Casts of literals and casts to strings are dropped.
+		ok = ok && (e.literal || str)
+	}
+	return e, ok
+}
+
+// Type names used in casts to strings.
+var checkStringTypes = map[string]bool{
+	"text": true, "varchar": true, "character varying": true, "bpchar": true, "character": true, "char": true,
+}
+
+// typeName reads the type name of a cast, and returns whether it is a
+// string type.
+func (p *checkParser) typeName() (bool, bool) {
+	var words []string
+	for p.i < len(p.toks) {
+		t := p.toks[p.i]
+		switch {
+		case len(words) == 0 && (t.kind == checkName || t.kind == checkQuoted):
+			words = append(words, strings.ToLower(t.text))
+		case len(words) > 0 && t.kind == checkName && strings.Contains(" varying precision with without time zone ", " "+strings.ToLower(t.text)+" "):
+			// Multi-word type names, such as "timestamp with time zone".
+			words = append(words, strings.ToLower(t.text))
+		case len(words) > 0 && t.kind == checkOp && t.text == ".":
+			// Qualified names, such as pg_catalog.int4.
+			words = nil
+		case len(words) > 0 && t.kind == checkOp && (t.text == "(" || t.text == "["):
+			// Type modifiers and array bounds.
+			closing := map[string]string{"(": ")", "[": "]"}[t.text]
+			for p.i++; p.i < len(p.toks) && p.toks[p.i].text != closing; p.i++ {
+				if p.toks[p.i].kind != checkNumber && p.toks[p.i].text != "," {
+					return false, false
+				}
+			}
+			if p.i == len(p.toks) {
+				return false, false
+			}
+			if closing == "]" {
+				words = append(words, "[]")
+			}
+		default:
+			return checkStringTypes[strings.Join(words, " ")], len(words) > 0
+		}
+		p.i++
+	}
+	return checkStringTypes[strings.Join(words, " ")], len(words) > 0
+}
+
+// Functions we translate, and their Spanner names. All of them take
+// one argument, except CONCAT.
+var checkFuncs = map[string]string{
+	"char_length":      "CHAR_LENGTH",
+	"character_length": "CHAR_LENGTH",
+	"lower":            "LOWER",
+	"upper":            "UPPER",
+	"abs":              "ABS",
+	"concat":           "CONCAT",
+}
+
+func (p *checkParser) primary() (checkExpr, bool) {
+	if p.i == len(p.toks) {
+		return checkExpr{}, false
+	}
+	t := p.toks[p.i]
+	p.i++
+	switch t.kind {
+	case checkNumber:
+		return checkExpr{toks: []ddl.ExprToken{symbol(t.text)}, simple: true, literal: true}, true
+	case checkString:
+		return checkExpr{toks: []ddl.ExprToken{{Kind: ddl.ExprString, Text: t.text}}, simple: true, literal: true}, true
+	case checkQuoted:
+		return p.column(t.text)
+	case checkOp:
+		if t.text != "(" {
+			return checkExpr{}, false
+		}
+		// The structure of expressions is explicit in checkExpr, so
+		// we drop parentheses and add them back as needed.
+		e, ok := p.or()
+		return e, ok && p.op(")")
+	}
+	name := strings.ToLower(t.text)
+	switch {
+	case p.op("("):
+		f, found := checkFuncs[name]
+		if !found {
+			return checkExpr{}, false
+		}
+		args, ok := p.exprList(")", p.or)
+		if !ok || (len(args) != 1 && f != "CONCAT") {
+			return checkExpr{}, false
+		}
+		toks := []ddl.ExprToken{symbol(f + "(")}
+		for i, a := range args {
+			if i > 0 {
+				toks = append(toks, symbol(","))
+			}
+			toks = append(toks, a.toks...)
+		}
+		return checkExpr{toks: append(toks, symbol(")")), simple: true}, true
+	case name == "array" && p.op("["):
+		elems, ok := p.exprList("]", p.or)
+		literal := true
+		for _, e := range elems {
+			literal = literal && e.literal
+		}
+		return checkExpr{isArray: true, elems: elems, literal: literal}, ok
+	case name == "true" || name == "false" || name == "null":
+		return checkExpr{toks: []ddl.ExprToken{symbol(strings.ToUpper(name))}, simple: true, literal: true}, true
+	}
+	return p.column(t.text)
+}
+
+func (p *checkParser) column(name string) (checkExpr, bool) {
+	c, ok := p.col(name)
+	if !ok {
+		return checkExpr{}, false
+	}
+	return checkExpr{toks: []ddl.ExprToken{{Kind: ddl.ExprColumn, Text: c}}, simple: true}, true
+}
+
+// exprList reads a list of expressions (read by f) separated by
+// commas, up to closing token end.
+func (p *checkParser) exprList(end string, f func() (checkExpr, bool)) ([]checkExpr, bool) {
+	var l []checkExpr
+	for {
+		e, ok := f()
+		if !ok || e.isArray {
+			return nil, false
+		}
+		l = append(l, e)
+		if p.op(end) {
+			return l, true
+		}
+		if !p.op(",") {
+			return nil, false
+		}
+	}
+}
+
+func binary(l checkExpr, op string, r checkExpr) (checkExpr, bool) {
+	if l.isArray || r.isArray {
+		return checkExpr{}, false
+	}
+	toks := append(operand(l), symbol(op))
+	return checkExpr{toks: append(toks, operand(r)...)}, true
+}
+
+// operand returns the tokens of e, in parentheses if needed.
+func operand(e checkExpr) []ddl.ExprToken {
+	if e.simple {
+		return append([]ddl.ExprToken(nil), e.toks...)
+	}
+	toks := append([]ddl.ExprToken{symbol("(")}, e.toks...)
+	return append(toks, symbol(")"))
+}
+
+func symbol(s string) ddl.ExprToken {
+	return ddl.ExprToken{Kind: ddl.ExprSymbol, Text: s}
+}
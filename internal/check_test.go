@@ -0,0 +1,130 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToSpannerCheck(t *testing.T) {
+	// Column "Price" is renamed in Spanner.
+	cols := map[string]string{"a": "a", "b": "b", "status": "status", "Price": "price_"}
+	col := func(c string) (string, bool) {
+		sp, ok := cols[c]
+		return sp, ok
+	}
+	tests := []struct {
+		expr string
+		want string // Empty if the expression can't be translated.
+		cols []string
+	}{
+		// pg_dump.
+		{`("a" > 0::pg_catalog.numeric)`, "a > 0", []string{"a"}},
+		{`(("a" >= 0) AND ("b" <= 100) AND ("Price" <> -1.5))`, "(a >= 0) AND (b <= 100) AND (price_ <> -1.5)", []string{"a", "b", "Price"}},
+		{`("status"::text = ANY (ARRAY['x'::character varying, 'it''s'::character varying]::text[]))`, `status IN ("x", "it's")`, []string{"status"}},
+		{`("status"::text <> ALL (ARRAY['x'::text]))`, `status NOT IN ("x")`, []string{"status"}},
+		{`(char_length("status"::text) > 0)`, "CHAR_LENGTH(status) > 0", []string{"status"}},
+		{`("status" ~~ '%@%'::text)`, `status LIKE "%@%"`, []string{"status"}},
+		{`(("a" IS NOT NULL) OR ("b" IS NULL))`, "(a IS NOT NULL) OR (b IS NULL)", []string{"a", "b"}},
+		{`("a" > ("b" * 2))`, "a > (b * 2)", []string{"a", "b"}},
+		{`(NOT ("a" = "b"))`, "NOT (a = b)", []string{"a", "b"}},
+		{`("a"::integer > 0)`, "", []string{"a"}}, // Not a literal or string cast.
+		{`("status" ~ '^x'::text)`, "", []string{"status"}},
+		{`(length("status"::text) > 0)`, "", []string{"status"}},
+		{`("c" > 0)`, "", nil}, // Unknown column.
+		// mysqldump and MySQL.
+		{"`a`>0", "a > 0", []string{"a"}},
+		{"`status` IN ('x','y')", `status IN ("x", "y")`, []string{"status"}},
+		{"(`status` in (_utf8mb4'x',_utf8mb4'y'))", `status IN ("x", "y")`, []string{"status"}},
+		{"`a` NOT BETWEEN 1 AND 10 AND `b` != 2", "(a NOT BETWEEN 1 AND 10) AND (b <> 2)", []string{"a", "b"}},
+		{"`status` NOT LIKE 'x%'", `status NOT LIKE "x%"`, []string{"status"}},
+		{"`a` IS TRUE OR NOT `b`", "(a IS TRUE) OR (NOT b)", []string{"a", "b"}},
+		{"LOWER(`status`)=`status`", "LOWER(status) = status", []string{"status"}},
+		{"concat(`status`,_utf8mb4' ',`b`)", `CONCAT(status, " ", b)`, []string{"status", "b"}},
+		{"`a` % 2 = 0", "", []string{"a"}},
+		{"`a` > NOW()", "", []string{"a"}},
+		// Malformed expressions.
+		{"`a` >", "", []string{"a"}},
+		{"(`a` > 0", "", []string{"a"}},
+		{"`a` IN ()", "", []string{"a"}},
+		{"'abc", "", nil},
+		{"", "", nil},
+	}
+	for _, tc := range tests {
+		e, cols, ok := ToSpannerCheck(tc.expr, col)
+		assert.Equal(t, tc.want != "", ok, tc.expr)
+		assert.Equal(t, tc.want, ddl.PrintExpr(ddl.Config{}, e), tc.expr)
+		assert.Equal(t, tc.cols, cols, tc.expr)
+	}
+}
+
+func TestCvtCheckConstraints(t *testing.T) {
+	conv := MakeConv()
+	st := schema.Table{
+		Name:     "t",
+		ColNames: []string{"a", "b"},
+		ColDefs:  map[string]schema.Column{"a": {Name: "a"}, "b": {Name: "b"}},
+		CheckConstraints: []schema.CheckConstraint{
+			{Name: "ck", Expr: "a > 0"},
+			{Expr: "b ~ 'x'"}, // Unsupported operator.
+			{Expr: "now() > '2020-01-01'"},
+		},
+	}
+	conv.SrcSchema["t"] = st
+	conv.Issues["t"] = make(map[string][]SchemaIssue)
+	_, err := GetSpannerTable(conv, "t")
+	assert.Nil(t, err)
+	_, err = GetSpannerCols(conv, "t", st.ColNames)
+	assert.Nil(t, err)
+	usedNames := map[string]bool{"ck": true}
+	checks := CvtCheckConstraints(conv, st, usedNames)
+	assert.Equal(t, 1, len(checks))
+	assert.NotEqual(t, "ck", checks[0].Name)
+	assert.Equal(t, "a > 0", ddl.PrintExpr(ddl.Config{}, checks[0].Expr))
+	// Constraints that can't be translated are reported against the
+	// columns they use, or the first column.
+	assert.Equal(t, map[string][]SchemaIssue{"a": {CheckConstraint}, "b": {CheckConstraint}}, conv.Issues["t"])
+}
+
+func TestCvtGeneratedColumns(t *testing.T) {
+	conv := MakeConv()
+	st := schema.Table{
+		Name:     "t",
+		ColNames: []string{"a", "b", "c"},
+		ColDefs: map[string]schema.Column{
+			"a": {Name: "a"},
+			"b": {Name: "b", Generated: "a * 2", Ignored: schema.Ignored{Generated: true}},
+			"c": {Name: "c", Generated: "md5(a)", Ignored: schema.Ignored{Generated: true}},
+		},
+	}
+	conv.SrcSchema["t"] = st
+	conv.Issues["t"] = make(map[string][]SchemaIssue)
+	_, err := GetSpannerTable(conv, "t")
+	assert.Nil(t, err)
+	_, err = GetSpannerCols(conv, "t", st.ColNames)
+	assert.Nil(t, err)
+	spColDef := map[string]ddl.ColumnDef{"a": {Name: "a"}, "b": {Name: "b"}, "c": {Name: "c"}}
+	CvtGeneratedColumns(conv, st, spColDef)
+	assert.Nil(t, spColDef["a"].Generated)
+	assert.Equal(t, "a * 2", ddl.PrintExpr(ddl.Config{}, spColDef["b"].Generated))
+	// Columns with expressions that can't be translated are left as
+	// regular columns.
+	assert.Nil(t, spColDef["c"].Generated)
+	assert.Equal(t, map[string][]SchemaIssue{"c": {GeneratedColumn}}, conv.Issues["t"])
+}
@@ -0,0 +1,96 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"reflect"
+	"time"
+)
+
+// KeyRange describes a chunk of a source table: the rows whose primary
+// key is at least Lower and less than Upper, in primary key order. A
+// nil bound means the range is unbounded on that side, so the first
+// and last chunks of a table also cover rows outside the range of keys
+// seen when the table was split.
+type KeyRange struct {
+	Lower []interface{}
+	Upper []interface{}
+}
+
+// ChunkCount returns the number of chunks of about chunkRows rows
+// needed for a table with rows rows. It returns 1 if chunkRows isn't
+// positive (chunking is disabled).
+func ChunkCount(rows, chunkRows int64) int {
+	if chunkRows <= 0 || rows <= chunkRows {
+		return 1
+	}
+	return int((rows + chunkRows - 1) / chunkRows)
+}
+
+// RetryDelay returns how long to wait before retrying a query that has
+// failed failures times in a row (exponential backoff): base after the
+// first failure, doubling with each further failure.
+func RetryDelay(base time.Duration, failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+	return base << uint(failures-1)
+}
+
+// IntKeyRanges splits a table with a single integer primary key whose
+// values are in [min, max] into (at most) n ranges of equal width.
+func IntKeyRanges(min, max int64, n int) []KeyRange {
+	if n < 2 || max <= min {
+		return []KeyRange{{}}
+	}
+	// Use unsigned arithmetic: max-min can overflow int64.
+	span := uint64(max) - uint64(min)
+	step := span / uint64(n)
+	if step == 0 {
+		step = 1
+	}
+	var splits [][]interface{}
+	for i := uint64(1); i < uint64(n) && i*step <= span; i++ {
+		splits = append(splits, []interface{}{int64(uint64(min) + i*step)})
+	}
+	return keyRanges(splits)
+}
+
+// SampleKeyRanges splits a table into (at most) n ranges, using
+// samples, a sample of the table's primary keys sorted in primary key
+// order, to choose split points that give ranges with similar numbers
+// of rows.
+func SampleKeyRanges(samples [][]interface{}, n int) []KeyRange {
+	var splits [][]interface{}
+	for i := 1; i < n && len(samples) > 0; i++ {
+		s := samples[i*len(samples)/n]
+		if len(splits) > 0 && reflect.DeepEqual(splits[len(splits)-1], s) {
+			continue
+		}
+		splits = append(splits, s)
+	}
+	return keyRanges(splits)
+}
+
+// keyRanges returns the ranges between consecutive split points.
+func keyRanges(splits [][]interface{}) []KeyRange {
+	var l []KeyRange
+	var lower []interface{}
+	for _, s := range splits {
+		l = append(l, KeyRange{Lower: lower, Upper: s})
+		lower = s
+	}
+	return append(l, KeyRange{Lower: lower})
+}
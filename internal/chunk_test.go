@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkCount(t *testing.T) {
+	assert.Equal(t, 1, ChunkCount(1000, 0))
+	assert.Equal(t, 1, ChunkCount(1000, 1000))
+	assert.Equal(t, 2, ChunkCount(1001, 1000))
+	assert.Equal(t, 10, ChunkCount(10000, 1000))
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, time.Duration(0), RetryDelay(time.Second, 0))
+	assert.Equal(t, time.Second, RetryDelay(time.Second, 1))
+	assert.Equal(t, 2*time.Second, RetryDelay(time.Second, 2))
+	assert.Equal(t, 16*time.Second, RetryDelay(time.Second, 5))
+}
+
+func TestIntKeyRanges(t *testing.T) {
+	k := func(i int64) []interface{} { return []interface{}{i} }
+	assert.Equal(t, []KeyRange{{}}, IntKeyRanges(1, 100, 1))
+	assert.Equal(t, []KeyRange{{}}, IntKeyRanges(5, 5, 4))
+	assert.Equal(t, []KeyRange{
+		{Upper: k(25)},
+		{Lower: k(25), Upper: k(49)},
+		{Lower: k(49), Upper: k(73)},
+		{Lower: k(73)},
+	}, IntKeyRanges(1, 100, 4))
+	// Fewer keys than chunks.
+	assert.Equal(t, []KeyRange{
+		{Upper: k(2)},
+		{Lower: k(2), Upper: k(3)},
+		{Lower: k(3)},
+	}, IntKeyRanges(1, 3, 10))
+	// The full range of int64 doesn't overflow.
+	assert.Equal(t, []KeyRange{
+		{Upper: k(-1)},
+		{Lower: k(-1)},
+	}, IntKeyRanges(math.MinInt64, math.MaxInt64, 2))
+}
+
+func TestSampleKeyRanges(t *testing.T) {
+	k := func(s string) []interface{} { return []interface{}{s, 1} }
+	samples := [][]interface{}{k("a"), k("b"), k("b"), k("b"), k("c"), k("d")}
+	assert.Equal(t, []KeyRange{{}}, SampleKeyRanges(nil, 3))
+	assert.Equal(t, []KeyRange{
+		{Upper: k("b")},
+		{Lower: k("b"), Upper: k("c")},
+		{Lower: k("c")},
+	}, SampleKeyRanges(samples, 3))
+	// Duplicate split points are dropped.
+	assert.Equal(t, []KeyRange{
+		{Upper: k("b")},
+		{Lower: k("b"), Upper: k("c")},
+		{Lower: k("c"), Upper: k("d")},
+		{Lower: k("d")},
+	}, SampleKeyRanges(samples, 6))
+}
@@ -16,6 +16,7 @@ package internal
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/cloudspannerecosystem/harbourbridge/schema"
@@ -28,14 +29,32 @@ type Conv struct {
 	SpSchema       ddl.Schema                          // Maps Spanner table name to Spanner schema.
 	SyntheticPKeys map[string]SyntheticPKey            // Maps Spanner table name to synthetic primary key (if needed).
 	SrcSchema      map[string]schema.Table             // Maps source-DB table name to schema information.
+	SrcViews       map[string]schema.View              // Maps source-DB view name to view definition.
+	SpViews        ddl.Views                           // Maps Spanner view name to view definition.
+	ViewIssues     map[string]string                   // Maps source-DB view name to the reason it couldn't be converted.
 	Issues         map[string]map[string][]SchemaIssue // Maps source-DB table/col to list of schema conversion issues.
 	ToSpanner      map[string]NameAndCols              // Maps from source-DB table name to Spanner name and column mapping.
 	ToSource       map[string]NameAndCols              // Maps from Spanner table name to source-DB table name and column mapping.
 	dataSink       func(table string, cols []string, values []interface{})
+	chunkDataSink  func(table string, chunk int, cols []string, values []interface{})
+	seek           func(table string, chunk int) ([]string, int64)
 	Location       *time.Location // Timezone (for timestamp conversion).
 	sampleBadRows  rowSamples     // Rows that generated errors during conversion.
 	Stats          stats
-	TimezoneOffset string // Timezone offset for timestamp conversion.
+	TimezoneOffset string      // Timezone offset for timestamp conversion.
+	Dialect        ddl.Dialect // Dialect of the Spanner database (defaults to GoogleSQL).
+	// If CaptureChanges is set, drivers that support change data capture
+	// (see source.ChangeStreamer) prepare to stream changes from the
+	// change log it names (see source.Source.Changes) and record the
+	// position in the change log at which data conversion reads the
+	// source, in ChangePosition. Neither is saved in session files.
+	CaptureChanges string `json:"-"`
+	ChangePosition string `json:"-"`
+	// statsLock protects Stats, sampleBadRows and synthetic primary
+	// key sequences, and mappingLock protects ToSpanner and ToSource,
+	// so that data conversion can process tables concurrently.
+	statsLock   sync.Mutex
+	mappingLock sync.Mutex
 }
 
 type mode int
@@ -75,6 +94,15 @@ const (
 	Datetime
 	Widened
 	Time
+	Money
+	RowVersion
+	DatetimeNoOffset
+	NumberNoPrecision
+	NumberToFloat
+	NumberToString
+	OracleDate
+	CheckConstraint
+	GeneratedColumn
 )
 
 // NameAndCols contains the name of a table and its columns.
@@ -108,6 +136,7 @@ type stats struct {
 	BadRows    map[string]int64          // Count of rows where conversion failed (d), broken down by source table.
 	Statement  map[string]*statementStat // Count of processed statements, broken down by statement type.
 	Unexpected map[string]int64          // Count of unexpected conditions, broken down by condition description.
+	Changes    map[string]*changeStat    // Count of changes streamed after data conversion (see source.ChangeStreamer), broken down by source table.
 	Reparsed   int64                     // Count of times we re-parse dump data looking for end-of-statement.
 }
 
@@ -118,12 +147,32 @@ type statementStat struct {
 	Error  int64
 }
 
+type changeStat struct {
+	Insert int64
+	Update int64
+	Delete int64
+	Error  int64
+}
+
+// ChangeKind is the kind of a change streamed after data conversion.
+type ChangeKind int
+
+const (
+	ChangeInsert ChangeKind = iota
+	ChangeUpdate
+	ChangeDelete
+	ChangeError // A change that couldn't be converted.
+)
+
 // MakeConv returns a default-configured Conv.
 func MakeConv() *Conv {
 	return &Conv{
 		SpSchema:       ddl.NewSchema(),
 		SyntheticPKeys: make(map[string]SyntheticPKey),
 		SrcSchema:      make(map[string]schema.Table),
+		SrcViews:       make(map[string]schema.View),
+		SpViews:        make(ddl.Views),
+		ViewIssues:     make(map[string]string),
 		Issues:         make(map[string]map[string][]SchemaIssue),
 		ToSpanner:      make(map[string]NameAndCols),
 		ToSource:       make(map[string]NameAndCols),
@@ -135,6 +184,7 @@ func MakeConv() *Conv {
 			BadRows:    make(map[string]int64),
 			Statement:  make(map[string]*statementStat),
 			Unexpected: make(map[string]int64),
+			Changes:    make(map[string]*changeStat),
 		},
 		TimezoneOffset: "+00:00", // By default, use +00:00 offset which is equal to UTC timezone
 	}
@@ -145,6 +195,151 @@ func (conv *Conv) SetDataSink(ds func(table string, cols []string, values []inte
 	conv.dataSink = ds
 }
 
+// SetChunkDataSink configures conv to use the specified data sink for
+// rows written by WriteChunkRow. If it isn't set, WriteChunkRow uses
+// the data sink set by SetDataSink.
+func (conv *Conv) SetChunkDataSink(ds func(table string, chunk int, cols []string, values []interface{})) {
+	conv.chunkDataSink = ds
+}
+
+// SetDialect sets the dialect of the Spanner database to d. Check
+// constraints, generated column expressions and views that use
+// expressions that can't be printed in d (see ddl.PrintableExpr) are
+// dropped and reported, as if they couldn't be translated: constraints
+// are reported as issues of the columns they use, generated columns
+// are converted to regular columns, and views are reported in
+// conv.ViewIssues.
+func (conv *Conv) SetDialect(d ddl.Dialect) {
+	conv.Dialect = d
+	for spTable, ct := range conv.SpSchema {
+		src := conv.ToSource[spTable]
+		issue := func(e []ddl.ExprToken, i SchemaIssue) {
+			var cols []string
+			for _, tok := range e {
+				if c, ok := src.Cols[tok.Text]; ok && tok.Kind == ddl.ExprColumn {
+					cols = append(cols, c)
+				}
+			}
+			if st, ok := conv.SrcSchema[src.Name]; ok && len(cols) == 0 && len(st.ColNames) > 0 {
+				cols = st.ColNames[:1]
+			}
+			for _, c := range cols {
+				if conv.Issues[src.Name] == nil {
+					conv.Issues[src.Name] = make(map[string][]SchemaIssue)
+				}
+				conv.Issues[src.Name][c] = append(conv.Issues[src.Name][c], i)
+			}
+		}
+		checks := ct.Checks[:0:0]
+		for _, ck := range ct.Checks {
+			if !ddl.PrintableExpr(d, ck.Expr) {
+				issue(ck.Expr, CheckConstraint)
+				continue
+			}
+			checks = append(checks, ck)
+		}
+		ct.Checks = checks
+		for _, col := range ct.ColNames {
+			cd := ct.ColDefs[col]
+			if cd.Generated != nil && !ddl.PrintableExpr(d, cd.Generated) {
+				issue([]ddl.ExprToken{{Kind: ddl.ExprColumn, Text: col}}, GeneratedColumn)
+				cd.Generated = nil
+				ct.ColDefs[col] = cd
+			}
+		}
+		conv.SpSchema[spTable] = ct
+	}
+	for spView, cv := range conv.SpViews {
+		if !ddl.PrintableExpr(d, cv.Query) {
+			conv.ViewIssues[conv.ToSource[spView].Name] = fmt.Sprintf("uses functions or operators that can't be expressed in the %s dialect", d)
+			delete(conv.SpViews, spView)
+		}
+	}
+	dropDependentViews(conv)
+}
+
+// SetSeek configures conv to use seek to find where drivers should
+// resume reading a table (or chunk of a table, if chunk isn't
+// negative) that was partly written by an earlier run. seek is called
+// with the Spanner table name, and returns the primary key of the last
+// row written (formatted as strings), and the number of rows up to it,
+// or nil if the table should be read from the start. See ResumeKey.
+func (conv *Conv) SetSeek(seek func(table string, chunk int) ([]string, int64)) {
+	conv.seek = seek
+}
+
+// ResumeKey returns the primary key of the last row of srcTable (or of
+// chunk of srcTable, if chunk isn't negative) written by an earlier run
+// of an interrupted data conversion, for drivers that resume reading
+// the table after this key. It returns nil if the table should be read
+// from the start: if no seek function has been set, no rows of the
+// table have been written, or the table's key can't be used to resume
+// reading. Keys are returned as strings, so we only resume reading
+// tables whose primary key columns are mapped to INT64 or STRING
+// (whose values are literals of the source type). Drivers must call
+// ResumeKey before reading the table, and then only read rows after
+// the key. The rows that aren't read are counted as good rows.
+func (conv *Conv) ResumeKey(srcTable string, chunk int) []interface{} {
+	if conv.seek == nil {
+		return nil
+	}
+	spTable, err := GetSpannerTable(conv, srcTable)
+	if err != nil {
+		return nil
+	}
+	st, ct := conv.SrcSchema[srcTable], conv.SpSchema[spTable]
+	if len(st.PrimaryKeys) == 0 || len(st.PrimaryKeys) != len(ct.Pks) {
+		return nil
+	}
+	for i, k := range st.PrimaryKeys {
+		spCol, err := GetSpannerCol(conv, srcTable, k.Column, true)
+		if err != nil || spCol != ct.Pks[i].Col {
+			return nil
+		}
+		if t := ct.ColDefs[spCol].T.Name; t != ddl.Int64 && t != ddl.String {
+			return nil
+		}
+	}
+	key, rows := conv.seek(spTable, chunk)
+	if key == nil {
+		return nil
+	}
+	conv.statsLock.Lock()
+	conv.Stats.GoodRows[srcTable] += rows
+	conv.statsLock.Unlock()
+	var l []interface{}
+	for _, k := range key {
+		l = append(l, k)
+	}
+	return l
+}
+
+// DataCols returns the columns of source table srcTable that drivers
+// read for data conversion: all its columns except those converted to
+// Spanner generated columns, whose values Spanner computes (and rejects
+// writes to). Primary key columns are always read, since rows are
+// ordered and paginated by key.
+func (conv *Conv) DataCols(srcTable string) []string {
+	st := conv.SrcSchema[srcTable]
+	spTable, err := GetSpannerTable(conv, srcTable)
+	if err != nil {
+		return st.ColNames
+	}
+	key := make(map[string]bool)
+	for _, k := range st.PrimaryKeys {
+		key[k.Column] = true
+	}
+	var cols []string
+	for _, c := range st.ColNames {
+		spCol, err := GetSpannerCol(conv, srcTable, c, true)
+		if err == nil && conv.SpSchema[spTable].ColDefs[spCol].Generated != nil && !key[c] {
+			continue
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
 // Note on modes.
 // We process the dump output twice. In the first pass (schema mode) we
 // build the schema, and the second pass (data mode) we write data to
@@ -167,7 +362,8 @@ func (conv *Conv) SetDataMode() {
 	conv.mode = dataOnly
 }
 
-// WriteRow calls dataSink and updates row stats.
+// WriteRow calls dataSink and updates row stats. WriteRow is
+// threadsafe if dataSink is.
 func (conv *Conv) WriteRow(srcTable, spTable string, spCols []string, spVals []interface{}) {
 	if conv.dataSink == nil {
 		msg := "Internal error: ProcessDataRow called but dataSink not configured"
@@ -180,8 +376,24 @@ func (conv *Conv) WriteRow(srcTable, spTable string, spCols []string, spVals []i
 	}
 }
 
+// WriteChunkRow is like WriteRow, for a row read from a chunk of a
+// source table that is read in several chunks (possibly concurrently,
+// in which case rows of different chunks are interleaved). chunk
+// identifies the chunk: sinks that track the position of rows (such as
+// checkpoints) track the rows of each chunk separately.
+func (conv *Conv) WriteChunkRow(srcTable, spTable string, chunk int, spCols []string, spVals []interface{}) {
+	if conv.chunkDataSink == nil {
+		conv.WriteRow(srcTable, spTable, spCols, spVals)
+		return
+	}
+	conv.chunkDataSink(spTable, chunk, spCols, spVals)
+	conv.statsAddGoodRow(srcTable, conv.DataMode())
+}
+
 // Rows returns the total count of data rows processed.
 func (conv *Conv) Rows() int64 {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
 	n := int64(0)
 	for _, c := range conv.Stats.Rows {
 		n += c
@@ -192,6 +404,8 @@ func (conv *Conv) Rows() int64 {
 // BadRows returns the total count of bad rows encountered during
 // data conversion.
 func (conv *Conv) BadRows() int64 {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
 	n := int64(0)
 	for _, c := range conv.Stats.BadRows {
 		n += c
@@ -201,6 +415,8 @@ func (conv *Conv) BadRows() int64 {
 
 // Statements returns the total number of statements processed.
 func (conv *Conv) Statements() int64 {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
 	n := int64(0)
 	for _, x := range conv.Stats.Statement {
 		n += x.Schema + x.Data + x.Skip + x.Error
@@ -210,6 +426,8 @@ func (conv *Conv) Statements() int64 {
 
 // StatementErrors returns the number of statement errors encountered.
 func (conv *Conv) StatementErrors() int64 {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
 	n := int64(0)
 	for _, x := range conv.Stats.Statement {
 		n += x.Error
@@ -220,6 +438,8 @@ func (conv *Conv) StatementErrors() int64 {
 // Unexpecteds returns the total number of distinct unexpected conditions
 // encountered during processing.
 func (conv *Conv) Unexpecteds() int64 {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
 	return int64(len(conv.Stats.Unexpected))
 }
 
@@ -228,6 +448,8 @@ func (conv *Conv) Unexpecteds() int64 {
 func (conv *Conv) CollectBadRow(srcTable string, srcCols, vals []string) {
 	r := &row{table: srcTable, cols: srcCols, vals: vals}
 	bytes := byteSize(r)
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
 	// Cap storage used by badRows. Keep at least one bad row.
 	if len(conv.sampleBadRows.rows) == 0 || bytes+conv.sampleBadRows.bytes < conv.sampleBadRows.bytesLimit {
 		conv.sampleBadRows.rows = append(conv.sampleBadRows.rows, r)
@@ -238,6 +460,8 @@ func (conv *Conv) CollectBadRow(srcTable string, srcCols, vals []string) {
 // SampleBadRows returns a string-formatted list of rows that generated errors.
 // Returns at most n rows.
 func (conv *Conv) SampleBadRows(n int) []string {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
 	var l []string
 	for _, x := range conv.sampleBadRows.rows {
 		l = append(l, fmt.Sprintf("table=%s cols=%v data=%v\n", x.table, x.cols, x.vals))
@@ -292,6 +516,8 @@ func (conv *Conv) buildPrimaryKey(spTable string) string {
 // because we process dump data twice.
 func (conv *Conv) Unexpected(u string) {
 	VerbosePrintf("Unexpected condition: %s\n", u)
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
 	// Limit size of unexpected map. If over limit, then only
 	// update existing entries.
 	if _, ok := conv.Stats.Unexpected[u]; ok || len(conv.Stats.Unexpected) < 1000 {
@@ -309,6 +535,8 @@ func (conv *Conv) Unexpected(u string) {
 // otherwise stats will be dropped.
 func (conv *Conv) StatsAddRow(srcTable string, b bool) {
 	if b {
+		conv.statsLock.Lock()
+		defer conv.statsLock.Unlock()
 		conv.Stats.Rows[srcTable]++
 	}
 }
@@ -317,6 +545,8 @@ func (conv *Conv) StatsAddRow(srcTable string, b bool) {
 // is true.  See StatsAddRow comments for context.
 func (conv *Conv) statsAddGoodRow(srcTable string, b bool) {
 	if b {
+		conv.statsLock.Lock()
+		defer conv.statsLock.Unlock()
 		conv.Stats.GoodRows[srcTable]++
 	}
 }
@@ -325,10 +555,98 @@ func (conv *Conv) statsAddGoodRow(srcTable string, b bool) {
 // true.  See StatsAddRow comments for context.
 func (conv *Conv) StatsAddBadRow(srcTable string, b bool) {
 	if b {
+		conv.statsLock.Lock()
+		defer conv.statsLock.Unlock()
 		conv.Stats.BadRows[srcTable]++
 	}
 }
 
+// ChangeCounts counts the changes of a source transaction, broken down
+// by source table, until the transaction is applied (see
+// Conv.StatsAddChanges).
+type ChangeCounts map[string]*changeStat
+
+// Add increments the count of changes of kind to srcTable.
+func (c ChangeCounts) Add(srcTable string, kind ChangeKind) {
+	s := c[srcTable]
+	if s == nil {
+		s = &changeStat{}
+		c[srcTable] = s
+	}
+	switch kind {
+	case ChangeInsert:
+		s.Insert++
+	case ChangeUpdate:
+		s.Update++
+	case ChangeDelete:
+		s.Delete++
+	case ChangeError:
+		s.Error++
+	}
+}
+
+// StatsAddChange increments the count of changes of kind to srcTable
+// streamed after data conversion.
+func (conv *Conv) StatsAddChange(srcTable string, kind ChangeKind) {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
+	ChangeCounts(conv.Stats.Changes).Add(srcTable, kind)
+}
+
+// StatsAddChanges adds the counts of changes c to the counts of
+// changes streamed after data conversion.
+func (conv *Conv) StatsAddChanges(c ChangeCounts) {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
+	for t, x := range c {
+		s := conv.Stats.Changes[t]
+		if s == nil {
+			s = &changeStat{}
+			conv.Stats.Changes[t] = s
+		}
+		s.Insert += x.Insert
+		s.Update += x.Update
+		s.Delete += x.Delete
+		s.Error += x.Error
+	}
+}
+
+// ChangeErrors returns the total number of changes that couldn't be
+// converted.
+func (conv *Conv) ChangeErrors() int64 {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
+	n := int64(0)
+	for _, s := range conv.Stats.Changes {
+		n += s.Error
+	}
+	return n
+}
+
+// StatsAddBadTable records all rows of 'srcTable' as bad rows. Used
+// when we can't process any of the table's data.
+func (conv *Conv) StatsAddBadTable(srcTable string) {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
+	conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
+}
+
+// NextSyntheticPKey returns the synthetic primary key column of
+// 'spTable' and the next value of its sequence, which it increments.
+// Returns false if 'spTable' doesn't have a synthetic primary key.
+func (conv *Conv) NextSyntheticPKey(spTable string) (string, int64, bool) {
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
+	aux, ok := conv.SyntheticPKeys[spTable]
+	if !ok {
+		return "", 0, false
+	}
+	seq := aux.Sequence
+	aux.Sequence++
+	conv.SyntheticPKeys[spTable] = aux
+	return aux.Col, seq, true
+}
+
 func (conv *Conv) getStatementStat(s string) *statementStat {
 	if conv.Stats.Statement[s] == nil {
 		conv.Stats.Statement[s] = &statementStat{}
@@ -339,6 +657,8 @@ func (conv *Conv) getStatementStat(s string) *statementStat {
 // SkipStatement increments the skip statement stats for 'stmtType'.
 func (conv *Conv) SkipStatement(stmtType string) {
 	if conv.SchemaMode() { // Record statement stats on first pass only.
+		conv.statsLock.Lock()
+		defer conv.statsLock.Unlock()
 		VerbosePrintf("Skipping statement: %s\n", stmtType)
 		conv.getStatementStat(stmtType).Skip++
 	}
@@ -347,6 +667,8 @@ func (conv *Conv) SkipStatement(stmtType string) {
 // ErrorInStatement increments the error statement stats for 'stmtType'.
 func (conv *Conv) ErrorInStatement(stmtType string) {
 	if conv.SchemaMode() { // Record statement stats on first pass only.
+		conv.statsLock.Lock()
+		defer conv.statsLock.Unlock()
 		VerbosePrintf("Error processing statement: %s\n", stmtType)
 		conv.getStatementStat(stmtType).Error++
 	}
@@ -355,6 +677,8 @@ func (conv *Conv) ErrorInStatement(stmtType string) {
 // SchemaStatement increments the schema statement stats for 'stmtType'.
 func (conv *Conv) SchemaStatement(stmtType string) {
 	if conv.SchemaMode() { // Record statement stats on first pass only.
+		conv.statsLock.Lock()
+		defer conv.statsLock.Unlock()
 		conv.getStatementStat(stmtType).Schema++
 	}
 }
@@ -362,6 +686,8 @@ func (conv *Conv) SchemaStatement(stmtType string) {
 // DataStatement increments the data statement stats for 'stmtType'.
 func (conv *Conv) DataStatement(stmtType string) {
 	if conv.SchemaMode() { // Record statement stats on first pass only.
+		conv.statsLock.Lock()
+		defer conv.statsLock.Unlock()
 		conv.getStatementStat(stmtType).Data++
 	}
 }
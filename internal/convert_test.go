@@ -21,6 +21,7 @@ import (
 	nodes "github.com/lfittl/pg_query_go/nodes"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
 	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
 )
 
@@ -77,6 +78,22 @@ func TestUnexpecteds(t *testing.T) {
 	assert.Equal(t, int64(1), conv.Unexpecteds())
 }
 
+func TestStatsAddChange(t *testing.T) {
+	conv := MakeConv()
+	conv.StatsAddChange("t1", ChangeInsert)
+	conv.StatsAddChange("t1", ChangeInsert)
+	conv.StatsAddChange("t1", ChangeDelete)
+	conv.StatsAddChange("t2", ChangeError)
+	assert.Equal(t, changeStat{Insert: 2, Delete: 1}, *conv.Stats.Changes["t1"])
+	assert.Equal(t, int64(1), conv.ChangeErrors())
+	c := make(ChangeCounts)
+	c.Add("t1", ChangeUpdate)
+	c.Add("t3", ChangeInsert)
+	conv.StatsAddChanges(c)
+	assert.Equal(t, changeStat{Insert: 2, Update: 1, Delete: 1}, *conv.Stats.Changes["t1"])
+	assert.Equal(t, changeStat{Insert: 1}, *conv.Stats.Changes["t3"])
+}
+
 func TestGetBadRows(t *testing.T) {
 	conv := MakeConv()
 	row1 := row{"table", []string{"col1", "col2"}, []string{"a", "1"}}
@@ -114,3 +131,102 @@ func parse(t *testing.T, s string) []nodes.Node {
 	assert.Nil(t, err, "Failed to parse")
 	return tree.Statements
 }
+
+func TestResumeKey(t *testing.T) {
+	conv := MakeConv()
+	for _, tc := range []struct{ name, spType string }{{"i", ddl.Int64}, {"ts", ddl.Timestamp}} {
+		conv.SrcSchema[tc.name] = schema.Table{Name: tc.name, ColNames: []string{"a"}, PrimaryKeys: []schema.Key{{Column: "a"}}}
+		_, err := GetSpannerTable(conv, tc.name)
+		assert.Nil(t, err)
+		_, err = GetSpannerCols(conv, tc.name, []string{"a"})
+		assert.Nil(t, err)
+		conv.SpSchema[tc.name] = ddl.CreateTable{
+			Name:     tc.name,
+			ColNames: []string{"a"},
+			ColDefs:  map[string]ddl.ColumnDef{"a": {Name: "a", T: ddl.Type{Name: tc.spType}}},
+			Pks:      []ddl.IndexKey{{Col: "a"}},
+		}
+	}
+	assert.Nil(t, conv.ResumeKey("i", -1)) // No seek function.
+	var seeks []string
+	conv.SetSeek(func(table string, chunk int) ([]string, int64) {
+		seeks = append(seeks, table)
+		return []string{"7"}, 3
+	})
+	assert.Equal(t, []interface{}{"7"}, conv.ResumeKey("i", 2))
+	assert.Equal(t, int64(3), conv.Stats.GoodRows["i"])
+	// Timestamps formatted as strings aren't source literals.
+	assert.Nil(t, conv.ResumeKey("ts", -1))
+	assert.Equal(t, []string{"i"}, seeks)
+}
+
+func TestDataCols(t *testing.T) {
+	conv := MakeConv()
+	conv.SrcSchema["t"] = schema.Table{Name: "t", ColNames: []string{"a", "b", "c", "d"}, PrimaryKeys: []schema.Key{{Column: "a"}}}
+	_, err := GetSpannerTable(conv, "t")
+	assert.Nil(t, err)
+	_, err = GetSpannerCols(conv, "t", []string{"a", "b", "c", "d"})
+	assert.Nil(t, err)
+	gen := []ddl.ExprToken{{Text: "b"}}
+	conv.SpSchema["t"] = ddl.CreateTable{
+		Name:     "t",
+		ColNames: []string{"a", "b", "c", "d"},
+		ColDefs: map[string]ddl.ColumnDef{
+			"a": {Name: "a", T: ddl.Type{Name: ddl.Int64}, Generated: gen},
+			"b": {Name: "b", T: ddl.Type{Name: ddl.Int64}},
+			"c": {Name: "c", T: ddl.Type{Name: ddl.Int64}, Generated: gen},
+			"d": {Name: "d", T: ddl.Type{Name: ddl.Int64}},
+		},
+		Pks: []ddl.IndexKey{{Col: "a"}},
+	}
+	// Generated columns are skipped, except for key columns.
+	assert.Equal(t, []string{"a", "b", "d"}, conv.DataCols("t"))
+}
+
+func TestSetDialect(t *testing.T) {
+	conv := MakeConv()
+	conv.SrcSchema["t"] = schema.Table{Name: "t", ColNames: []string{"a", "b", "c"}}
+	_, err := GetSpannerTable(conv, "t")
+	assert.Nil(t, err)
+	_, err = GetSpannerCols(conv, "t", []string{"a", "b", "c"})
+	assert.Nil(t, err)
+	conv.Issues["t"] = make(map[string][]SchemaIssue)
+	div := []ddl.ExprToken{{Kind: ddl.ExprColumn, Text: "a"}, {Kind: ddl.ExprSymbol, Text: "/"}, {Kind: ddl.ExprSymbol, Text: "2"}}
+	lower := []ddl.ExprToken{{Kind: ddl.ExprSymbol, Text: "LOWER("}, {Kind: ddl.ExprColumn, Text: "b"}, {Kind: ddl.ExprSymbol, Text: ")"}}
+	conv.SpSchema["t"] = ddl.CreateTable{
+		Name:     "t",
+		ColNames: []string{"a", "b", "c"},
+		ColDefs: map[string]ddl.ColumnDef{
+			"a": {Name: "a", T: ddl.Type{Name: ddl.Int64}},
+			"b": {Name: "b", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, Generated: lower},
+			"c": {Name: "c", T: ddl.Type{Name: ddl.Float64}, Generated: div},
+		},
+		Checks: []ddl.CheckConstraint{{Name: "ck1", Expr: div}, {Name: "ck2", Expr: lower}},
+	}
+	conv.SrcViews["v"] = schema.View{Name: "v"}
+	conv.SrcViews["w"] = schema.View{Name: "w"}
+	for _, v := range []string{"v", "w"} {
+		_, err = GetSpannerTable(conv, v)
+		assert.Nil(t, err)
+	}
+	conv.SpViews["v"] = ddl.CreateView{Name: "v", Query: div}
+	conv.SpViews["w"] = ddl.CreateView{Name: "w", Query: []ddl.ExprToken{{Kind: ddl.ExprSymbol, Text: "SELECT * FROM"}, {Kind: ddl.ExprTable, Text: "v"}}}
+
+	// Nothing is dropped for GoogleSQL.
+	conv.SetDialect(ddl.GoogleSQL)
+	assert.Equal(t, 2, len(conv.SpSchema["t"].Checks))
+	assert.Equal(t, 2, len(conv.SpViews))
+
+	// Division can't be printed in the PostgreSQL dialect, so the
+	// check constraint, generated column and view (and the view that
+	// uses it) that use it are dropped and reported.
+	conv.SetDialect(ddl.PostgreSQL)
+	assert.Equal(t, ddl.PostgreSQL, conv.Dialect)
+	assert.Equal(t, []ddl.CheckConstraint{{Name: "ck2", Expr: lower}}, conv.SpSchema["t"].Checks)
+	assert.Equal(t, lower, conv.SpSchema["t"].ColDefs["b"].Generated)
+	assert.Nil(t, conv.SpSchema["t"].ColDefs["c"].Generated)
+	assert.Equal(t, map[string][]SchemaIssue{"a": {CheckConstraint}, "c": {GeneratedColumn}}, conv.Issues["t"])
+	assert.Empty(t, conv.SpViews)
+	assert.Contains(t, conv.ViewIssues["v"], "can't be expressed")
+	assert.Contains(t, conv.ViewIssues["w"], "uses view v")
+}
@@ -0,0 +1,209 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"math/big"
+	"math/bits"
+	"reflect"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// ConvertSQLRow performs data conversion for a single row of data
+// returned from a SELECT query, using cvtScalar (which differs between
+// source databases) to convert each value. ConvertSQLRow assumes that
+// srcCols, spCols and srcVals all have the same length. Note that
+// ConvertSQLRow returns cols as well as converted values. This is
+// because cols can change when we add a column (synthetic primary key)
+// or because we drop columns (handling of NULL values).
+func ConvertSQLRow(conv *Conv, srcTable string, srcCols []string, srcSchema schema.Table, spTable string, spCols []string, spSchema ddl.CreateTable, srcVals []interface{}, cvtScalar func(conv *Conv, srcCd schema.Column, spCd ddl.ColumnDef, val interface{}) (interface{}, error)) ([]string, []interface{}, error) {
+	var vs []interface{}
+	var cs []string
+	for i := range srcCols {
+		srcCd, ok1 := srcSchema.ColDefs[srcCols[i]]
+		spCd, ok2 := spSchema.ColDefs[spCols[i]]
+		if !ok1 || !ok2 {
+			return nil, nil, fmt.Errorf("data conversion: can't find schema for column %s of table %s", srcCols[i], srcTable)
+		}
+		if srcVals[i] == nil {
+			continue // Skip NULL values (nil is used by database/sql to represent NULL values).
+		}
+		spVal, err := cvtScalar(conv, srcCd, spCd, srcVals[i])
+		if err != nil { // Skip entire row if we hit error.
+			return nil, nil, fmt.Errorf("can't convert sql data for column %s of table %s: %w", srcCols[i], srcTable, err)
+		}
+		vs = append(vs, spVal)
+		cs = append(cs, spCols[i])
+	}
+	if col, seq, ok := conv.NextSyntheticPKey(spTable); ok {
+		cs = append(cs, col)
+		vs = append(vs, int64(bits.Reverse64(uint64(seq))))
+	}
+	return cs, vs, nil
+}
+
+// CvtSQLScalar converts a value returned from a SQL query to a Spanner
+// value of type spCd.T. It handles the types of values that
+// database/sql drivers return:
+//
+//	[]byte, bool, float32, float64, int64, string and time.Time
+//
+// Strings are parsed as values of the Spanner type, except for
+// timestamps, whose formats differ between source databases. Drivers
+// handle these, and any other values that need source-specific
+// conversion, before calling CvtSQLScalar. Note that the caller is
+// responsible for handling nil values (used to represent NULL).
+func CvtSQLScalar(spCd ddl.ColumnDef, val interface{}) (interface{}, error) {
+	if f, ok := val.(float32); ok {
+		val = float64(f)
+	}
+	switch spCd.T.Name {
+	case ddl.Bool:
+		switch v := val.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		case string:
+			return convBool(v)
+		}
+	case ddl.Bytes:
+		switch v := val.(type) {
+		case []byte:
+			return v, nil
+		case string:
+			return []byte(v), nil
+		}
+	case ddl.Date:
+		switch v := val.(type) {
+		case string:
+			return convDate(v)
+		case time.Time:
+			return civil.DateOf(v), nil
+		}
+	case ddl.Int64:
+		switch v := val.(type) {
+		case []byte: // Parse as int64.
+			return convInt64(string(v))
+		case bool:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case int64:
+			return v, nil
+		case float64: // Truncate.
+			return int64(v), nil
+		case string: // Parse as int64.
+			return convInt64(v)
+		}
+	case ddl.Float64:
+		switch v := val.(type) {
+		case []byte: // Some drivers use []byte for decimals.
+			return convFloat64(string(v))
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			return convFloat64(v)
+		}
+	case ddl.Numeric:
+		switch v := val.(type) {
+		case []byte: // Some drivers use []byte for decimals.
+			return convNumeric(string(v))
+		case int64:
+			return convNumeric(strconv.FormatInt(v, 10))
+		case float64:
+			return convNumeric(strconv.FormatFloat(v, 'f', -1, 64))
+		case string:
+			return convNumeric(v)
+		}
+	case ddl.String:
+		switch v := val.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case []byte:
+			return string(v), nil
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), nil
+		case string:
+			return v, nil
+		case time.Time:
+			return v.String(), nil
+		}
+	case ddl.Timestamp:
+		switch v := val.(type) {
+		case time.Time:
+			return v, nil
+		}
+	}
+	return nil, fmt.Errorf("can't convert value of type %s to Spanner type %s", reflect.TypeOf(val), reflect.TypeOf(spCd.T))
+}
+
+func convBool(val string) (bool, error) {
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return b, fmt.Errorf("can't convert to bool: %w", err)
+	}
+	return b, err
+}
+
+func convDate(val string) (civil.Date, error) {
+	d, err := civil.ParseDate(val)
+	if err != nil {
+		return d, fmt.Errorf("can't convert to date: %w", err)
+	}
+	return d, err
+}
+
+func convFloat64(val string) (float64, error) {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return f, fmt.Errorf("can't convert to float64: %w", err)
+	}
+	return f, err
+}
+
+func convInt64(val string) (int64, error) {
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return i, fmt.Errorf("can't convert to int64: %w", err)
+	}
+	return i, err
+}
+
+// convNumeric maps a source database string value (representing a numeric)
+// into a string representing a valid Spanner numeric.
+// Ideally we would just return a *big.Rat, but spanner.Mutation
+// doesn't currently support use of *big.Rat.
+// TODO: return *big.Rat when client library supports it.
+func convNumeric(val string) (string, error) {
+	r := new(big.Rat)
+	if _, ok := r.SetString(val); !ok {
+		return "", fmt.Errorf("can't convert %q to big.Rat", val)
+	}
+	return spanner.NumericString(r), nil
+}
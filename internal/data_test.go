@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"math/bits"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func TestCvtSQLScalar(t *testing.T) {
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		spType string
+		val    interface{}
+		want   interface{}
+	}{
+		{ddl.Bool, int64(1), true},
+		{ddl.Bool, "false", false},
+		{ddl.Bytes, "ab", []byte("ab")},
+		{ddl.Date, "2021-03-04", civil.Date{Year: 2021, Month: 3, Day: 4}},
+		{ddl.Date, ts, civil.Date{Year: 2021, Month: 3, Day: 4}},
+		{ddl.Int64, []byte("42"), int64(42)},
+		{ddl.Int64, true, int64(1)},
+		{ddl.Int64, 4.7, int64(4)},
+		{ddl.Float64, float32(1.5), 1.5},
+		{ddl.Float64, []byte("2.25"), 2.25},
+		{ddl.Numeric, []byte("12.50"), "12.500000000"},
+		{ddl.Numeric, int64(7), "7.000000000"},
+		{ddl.String, int64(7), "7"},
+		{ddl.String, []byte("x"), "x"},
+		{ddl.Timestamp, ts, ts},
+	}
+	for _, tc := range tests {
+		got, err := CvtSQLScalar(ddl.ColumnDef{Name: "c", T: ddl.Type{Name: tc.spType}}, tc.val)
+		assert.Nil(t, err, tc.spType)
+		assert.Equal(t, tc.want, got, tc.spType)
+	}
+	_, err := CvtSQLScalar(ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.Timestamp}}, "2021-03-04")
+	assert.NotNil(t, err) // Timestamp strings are parsed by drivers.
+	_, err = CvtSQLScalar(ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.Int64}}, "x")
+	assert.NotNil(t, err)
+}
+
+func TestConvertSQLRow(t *testing.T) {
+	conv := MakeConv()
+	conv.SyntheticPKeys["t"] = SyntheticPKey{Col: "synth_id", Sequence: 5}
+	srcSchema := schema.Table{ColDefs: map[string]schema.Column{"a": {Name: "a"}, "b": {Name: "b"}}}
+	spSchema := ddl.CreateTable{ColDefs: map[string]ddl.ColumnDef{
+		"a": {Name: "a", T: ddl.Type{Name: ddl.Int64}},
+		"b": {Name: "b", T: ddl.Type{Name: ddl.String}},
+	}}
+	cvt := func(conv *Conv, srcCd schema.Column, spCd ddl.ColumnDef, val interface{}) (interface{}, error) {
+		return CvtSQLScalar(spCd, val)
+	}
+	cols, vals, err := ConvertSQLRow(conv, "t", []string{"a", "b"}, srcSchema, "t", []string{"a", "b"}, spSchema, []interface{}{"3", nil}, cvt)
+	assert.Nil(t, err)
+	// NULL values are dropped, and the synthetic key is added.
+	assert.Equal(t, []string{"a", "synth_id"}, cols)
+	assert.Equal(t, []interface{}{int64(3), int64(bits.Reverse64(5))}, vals)
+	assert.Equal(t, int64(6), conv.SyntheticPKeys["t"].Sequence)
+	_, _, err = ConvertSQLRow(conv, "t", []string{"a"}, srcSchema, "t", []string{"a"}, spSchema, []interface{}{"x"}, cvt)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Magic bytes at the start of compressed input.
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// NewDumpReader returns a Reader for dump input r. If r is compressed
+// (using gzip, bzip2 or zstd, detected by the magic bytes at the start
+// of the input), the Reader returns decompressed data. In either case,
+// progress is reported in terms of the number of bytes read from r, so
+// that it can be compared with the size of r. The Reader must be closed
+// once the input has been read, to release the decompressor (the zstd
+// decoder runs go routines until it is closed).
+func NewDumpReader(r io.Reader, progress *Progress) (*Reader, error) {
+	cr := &countingReader{r: r, progress: progress}
+	br := bufio.NewReader(cr)
+	magic, _ := br.Peek(len(zstdMagic)) // Errors will resurface when we read.
+	var dr io.ReadCloser
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("can't read gzip input: %w", err)
+		}
+		dr = zr
+	case bytes.HasPrefix(magic, bzip2Magic):
+		dr = ioutil.NopCloser(bzip2.NewReader(br))
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("can't read zstd input: %w", err)
+		}
+		dr = zr.IOReadCloser()
+	default:
+		return NewReader(br, nil), nil
+	}
+	rd := NewReader(bufio.NewReader(dr), nil)
+	rd.closer = dr
+	return rd, nil
+}
+
+// countingReader wraps an io.Reader, reporting progress based on the
+// number of bytes read.
+type countingReader struct {
+	r        io.Reader
+	n        int64
+	progress *Progress
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.progress != nil {
+		c.progress.MaybeReport(c.n)
+	}
+	return n, err
+}
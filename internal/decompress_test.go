@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDumpReader(t *testing.T) {
+	const dump = "CREATE TABLE t (a bigint);\n"
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(dump))
+	gw.Close()
+	var zs bytes.Buffer
+	zw, err := zstd.NewWriter(&zs)
+	assert.Nil(t, err)
+	zw.Write([]byte(dump))
+	zw.Close()
+	// Output of bzip2 (there's no bzip2 compressor in go's standard library).
+	bz := []byte("\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\x3f\xb3\x6c\xff\x00\x00\x05\xdf\x80\x00\x10\x40\x60\x00\x08\x3a\x04\x14\x00\x30\xa1\x04\x00\x20\x00\x22\x8c\x26\x9a\x36\xa3\x21\x4d\x32\x31\x31\x31\x12\x9c\x61\x4d\x82\x3e\x8e\x04\x0d\xb0\x29\xf4\x91\xd7\xc5\xdc\x91\x4e\x14\x24\x0f\xec\xdb\x3f\xc0")
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"plain", []byte(dump)},
+		{"gzip", gz.Bytes()},
+		{"bzip2", bz},
+		{"zstd", zs.Bytes()},
+	}
+	for _, tc := range tests {
+		p := NewProgress(int64(len(tc.in)), tc.name, false)
+		r, err := NewDumpReader(bytes.NewReader(tc.in), p)
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, dump, string(r.ReadLine()), tc.name)
+		r.ReadLine()
+		assert.True(t, r.EOF, tc.name)
+		// Progress is based on bytes of (compressed) input.
+		assert.Equal(t, 100, p.pct, tc.name)
+		assert.Equal(t, int64(len(tc.in)), p.progress, tc.name)
+		assert.Nil(t, r.Close(), tc.name)
+	}
+}
+
+func TestNewDumpReader_Close(t *testing.T) {
+	var zs bytes.Buffer
+	zw, err := zstd.NewWriter(&zs)
+	assert.Nil(t, err)
+	zw.Write([]byte("CREATE TABLE t (a bigint);\n"))
+	zw.Close()
+	r, err := NewDumpReader(bytes.NewReader(zs.Bytes()), nil)
+	assert.Nil(t, err)
+	// Closing the Reader closes the zstd decoder, which then can't be
+	// read.
+	assert.Nil(t, r.Close())
+	r.ReadLine()
+	assert.True(t, r.EOF)
+	_, err = r.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+}
+
+func TestNewDumpReader_BadInput(t *testing.T) {
+	_, err := NewDumpReader(bytes.NewReader([]byte{0x1f, 0x8b, 0x00}), nil)
+	assert.NotNil(t, err)
+}
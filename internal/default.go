@@ -0,0 +1,275 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// ToSpannerDefault translates the default value expression expr of a
+// source column (SQL text, as recorded in schema.Column.Default) to the
+// default value of a Spanner column of type ty. We handle literals
+// (including PostgreSQL casts such as 'abc'::text), TRUE and FALSE, and
+// the current time (e.g. now(), CURRENT_TIMESTAMP and CURRENT_DATE).
+// Timestamp literals must include a time zone offset. ToSpannerDefault
+// returns nil for DEFAULT NULL (which needs no translation), and false
+// if expr can't be translated.
+func ToSpannerDefault(expr string, ty ddl.Type) (*ddl.Default, bool) {
+	v, ok := parseDefault(expr)
+	switch {
+	case !ok:
+		return nil, false
+	case v.kind == defaultNull:
+		return nil, true
+	case ty.IsArray:
+		return nil, false
+	case v.kind == defaultNow && (ty.Name == ddl.Timestamp || ty.Name == ddl.Date),
+		v.kind == defaultToday && ty.Name == ddl.Date:
+		return &ddl.Default{Now: true}, true
+	case v.kind == defaultNow, v.kind == defaultToday:
+		return nil, false
+	}
+	s, ok := literalValue(v, ty)
+	if !ok {
+		return nil, false
+	}
+	return &ddl.Default{Value: s}, true
+}
+
+// Kinds of default values.
+const (
+	defaultNull   = iota
+	defaultBool   // TRUE or FALSE.
+	defaultNumber // A numeric literal.
+	defaultString // A string literal.
+	defaultNow    // The current timestamp.
+	defaultToday  // The current date.
+)
+
+// defaultValue is a parsed default value expression.
+type defaultValue struct {
+	kind int
+	val  string // Value of literals.
+}
+
+// literalValue returns literal v as the value of a ddl.Default for a
+// column of type ty.
+func literalValue(v defaultValue, ty ddl.Type) (string, bool) {
+	s := v.val
+	switch ty.Name {
+	case ddl.Bool:
+		switch strings.ToLower(s) {
+		case "true", "t", "1":
+			return "true", true
+		case "false", "f", "0":
+			return "false", true
+		}
+	case ddl.Int64:
+		if v.kind == defaultBool {
+			return "", false
+		}
+		if i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64); err == nil {
+			return strconv.FormatInt(i, 10), true
+		}
+	case ddl.Float64:
+		if v.kind == defaultBool {
+			return "", false
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+			return strconv.FormatFloat(f, 'g', -1, 64), true
+		}
+	case ddl.Numeric:
+		if v.kind == defaultBool {
+			return "", false
+		}
+		if r, ok := new(big.Rat).SetString(strings.TrimSpace(s)); ok {
+			s = r.FloatString(9)
+			return strings.TrimSuffix(strings.TrimRight(s, "0"), "."), true
+		}
+	case ddl.String:
+		if v.kind == defaultBool || (ty.Len != ddl.MaxLength && int64(utf8.RuneCountInString(s)) > ty.Len) {
+			return "", false
+		}
+		return s, true
+	case ddl.Date:
+		if t, err := time.Parse("2006-01-02", s); err == nil && v.kind == defaultString {
+			return t.Format("2006-01-02"), true
+		}
+	case ddl.Timestamp:
+		if v.kind != defaultString {
+			return "", false
+		}
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z07"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UTC().Format(time.RFC3339Nano), true
+			}
+		}
+	}
+	return "", false
+}
+
+var defaultNumberRe = regexp.MustCompile(`^[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?`)
+
+// parseDefault parses the default value expressions that
+// ToSpannerDefault handles.
+func parseDefault(s string) (defaultValue, bool) {
+	p := &defaultParser{s: s}
+	v, ok := p.expr()
+	p.space()
+	return v, ok && p.i == len(p.s)
+}
+
+// defaultParser is a parser for the simple expressions used as
+// default values. Its grammar is:
+//
+//	expr:    primary { '::' type_name }
+//	primary: '(' expr ')' | string | number | name [ '(' [ number ] ')' ]
+type defaultParser struct {
+	s string
+	i int // Position of the next character to read.
+}
+
+func (p *defaultParser) space() {
+	for p.i < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+// consume reads token t, if it comes next.
+func (p *defaultParser) consume(t string) bool {
+	p.space()
+	if strings.HasPrefix(p.s[p.i:], t) {
+		p.i += len(t)
+		return true
+	}
+	return false
+}
+
+func (p *defaultParser) expr() (defaultValue, bool) {
+	v, ok := p.primary()
+	for ok && p.consume("::") {
+		// Casts are dropped: the value is checked against the Spanner
+		// column type.
+		ok = p.typeName()
+	}
+	return v, ok
+}
+
+func (p *defaultParser) primary() (defaultValue, bool) {
+	p.space()
+	if p.i == len(p.s) {
+		return defaultValue{}, false
+	}
+	c := p.s[p.i]
+	switch {
+	case c == '(':
+		p.i++
+		v, ok := p.expr()
+		return v, ok && p.consume(")")
+	case c == '\'':
+		return p.str()
+	case isNameChar(c) && !isDigit(c):
+		name := strings.ToUpper(p.name())
+		var args string
+		if p.consume("(") {
+			p.space()
+			args = defaultNumberRe.FindString(p.s[p.i:])
+			p.i += len(args)
+			if !p.consume(")") {
+				return defaultValue{}, false
+			}
+			args = "(" + args + ")"
+		}
+		switch {
+		case args == "" && (name == "TRUE" || name == "FALSE"):
+			return defaultValue{kind: defaultBool, val: strings.ToLower(name)}, true
+		case args == "" && name == "NULL":
+			return defaultValue{kind: defaultNull}, true
+		case name == "CURRENT_TIMESTAMP" || name == "LOCALTIMESTAMP" || name == "NOW":
+			return defaultValue{kind: defaultNow}, true
+		case name == "CURRENT_DATE" || name == "CURDATE":
+			return defaultValue{kind: defaultToday}, true
+		}
+	default:
+		if n := defaultNumberRe.FindString(p.s[p.i:]); n != "" {
+			p.i += len(n)
+			return defaultValue{kind: defaultNumber, val: strings.TrimPrefix(n, "+")}, true
+		}
+	}
+	return defaultValue{}, false
+}
+
+// str reads a string literal, in which quotes are doubled.
+func (p *defaultParser) str() (defaultValue, bool) {
+	var b strings.Builder
+	for p.i++; p.i < len(p.s); p.i++ {
+		if p.s[p.i] == '\'' {
+			if p.i+1 < len(p.s) && p.s[p.i+1] == '\'' {
+				p.i++
+			} else {
+				p.i++
+				return defaultValue{kind: defaultString, val: b.String()}, true
+			}
+		}
+		b.WriteByte(p.s[p.i])
+	}
+	return defaultValue{}, false
+}
+
+func (p *defaultParser) name() string {
+	start := p.i
+	for p.i < len(p.s) && isNameChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// typeName reads a type name, such as "character varying(10)" or
+// pg_catalog.int4[].
+func (p *defaultParser) typeName() bool {
+	p.space()
+	start := p.i
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case isNameChar(c) || c == '.' || c == '"' || c == ' ':
+			p.i++
+		case c == '(' || c == '[':
+			end := strings.IndexByte(p.s[p.i:], map[byte]byte{'(': ')', '[': ']'}[c])
+			if end < 0 {
+				return false
+			}
+			p.i += end + 1
+		default:
+			return p.i > start
+		}
+	}
+	return p.i > start
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || isDigit(c) || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToSpannerDefault(t *testing.T) {
+	value := func(s string) *ddl.Default { return &ddl.Default{Value: s} }
+	now := &ddl.Default{Now: true}
+	tests := []struct {
+		expr string
+		ty   string
+		want *ddl.Default // Nil if the default can't be translated.
+	}{
+		{"true", ddl.Bool, value("true")},
+		{"FALSE", ddl.Bool, value("false")},
+		{"'t'::boolean", ddl.Bool, value("true")},
+		{"'0'", ddl.Bool, value("false")},
+		{"42", ddl.Int64, value("42")},
+		{"-7", ddl.Int64, value("-7")},
+		{"('42'::bigint)", ddl.Int64, value("42")},
+		{"1.5", ddl.Int64, nil},
+		{"true", ddl.Int64, nil},
+		{"-1.5e3", ddl.Float64, value("-1500")},
+		{"'NaN'::double precision", ddl.Float64, nil},
+		{"123.4500", ddl.Numeric, value("123.45")},
+		{"7", ddl.Numeric, value("7")},
+		{"'it''s'::character varying", ddl.String, value("it's")},
+		{"'abc'::character varying(10)", ddl.String, value("abc")},
+		{"''", ddl.String, value("")},
+		{"0", ddl.String, value("0")},
+		{"'2021-06-01'::date", ddl.Date, value("2021-06-01")},
+		{"CURRENT_DATE", ddl.Date, now},
+		{"curdate()", ddl.Date, now},
+		{"now()", ddl.Date, now},
+		{"now()", ddl.Timestamp, now},
+		{"CURRENT_TIMESTAMP", ddl.Timestamp, now},
+		{"CURRENT_TIMESTAMP(6)", ddl.Timestamp, now},
+		{"CURRENT_DATE", ddl.Timestamp, nil},
+		{"now()", ddl.String, nil},
+		{"'2021-06-01 12:00:00+02'::timestamp with time zone", ddl.Timestamp, value("2021-06-01T10:00:00Z")},
+		{"'2021-06-01 12:00:00.5-07:00'", ddl.Timestamp, value("2021-06-01T19:00:00.5Z")},
+		{"'2021-06-01 12:00:00'", ddl.Timestamp, nil}, // No time zone.
+		{"'\\x00'::bytea", ddl.Bytes, nil},
+		{"nextval('t_id_seq'::regclass)", ddl.Int64, nil},
+		{"(1 + 2)", ddl.Int64, nil},
+		{"'abc", ddl.String, nil},
+		{"", ddl.String, nil},
+	}
+	for _, tc := range tests {
+		d, ok := ToSpannerDefault(tc.expr, ddl.Type{Name: tc.ty, Len: ddl.MaxLength})
+		assert.Equal(t, tc.want != nil, ok, tc.expr)
+		assert.Equal(t, tc.want, d, tc.expr)
+	}
+	// DEFAULT NULL needs no translation.
+	d, ok := ToSpannerDefault("NULL::character varying", ddl.Type{Name: ddl.String, Len: ddl.MaxLength})
+	assert.True(t, ok)
+	assert.Nil(t, d)
+	// Strings must fit the column.
+	_, ok = ToSpannerDefault("'abcd'", ddl.Type{Name: ddl.String, Len: 3})
+	assert.False(t, ok)
+	_, ok = ToSpannerDefault("'{1,2}'::integer[]", ddl.Type{Name: ddl.Int64, IsArray: true})
+	assert.False(t, ok)
+}
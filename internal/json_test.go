@@ -0,0 +1,44 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // Empty if in isn't valid JSON.
+	}{
+		{`{"b": [1, 2.50, null], "a": {"y": true, "x": "<&>"}}`, `{"a":{"x":"<&>","y":true},"b":[1,2.50,null]}`},
+		{` 12345678901234567890.123 `, `12345678901234567890.123`},
+		{`"café"`, `"café"`},
+		{`{"a": 1, "a": 2}`, `{"a":2}`},
+		{`[]`, `[]`},
+		{`{"a": 1`, ""},
+		{`{"a": 1} x`, ""},
+		{`{"a": 1} {}`, ""},
+		{``, ""},
+		{`'x'`, ""},
+	}
+	for _, tc := range tests {
+		s, err := NormalizeJSON(tc.in)
+		assert.Equal(t, tc.want == "", err != nil, tc.in)
+		assert.Equal(t, tc.want, s, tc.in)
+	}
+}
@@ -34,6 +34,8 @@ func GetSpannerTable(conv *Conv, srcTable string) (string, error) {
 	if srcTable == "" {
 		return "", fmt.Errorf("bad parameter: table string is empty")
 	}
+	conv.mappingLock.Lock()
+	defer conv.mappingLock.Unlock()
 	if sp, found := conv.ToSpanner[srcTable]; found {
 		return sp.Name, nil
 	}
@@ -77,6 +79,8 @@ func GetSpannerCol(conv *Conv, srcTable, srcCol string, mustExist bool) (string,
 	if srcCol == "" {
 		return "", fmt.Errorf("bad parameter: col string is empty")
 	}
+	conv.mappingLock.Lock()
+	defer conv.mappingLock.Unlock()
 	sp, found := conv.ToSpanner[srcTable]
 	if !found {
 		return "", fmt.Errorf("unknown table %s", srcTable)
@@ -164,6 +168,17 @@ func ToSpannerIndexName(srcId string, used map[string]bool) string {
 	return getSpannerId(srcId, used)
 }
 
+// ToSpannerCheckName maps a source check constraint name to a legal
+// Spanner constraint name. Like foreign key names, check constraint
+// names share the database-wide namespace of Spanner constraints, so
+// we make them unique using used. Unnamed constraints stay unnamed.
+func ToSpannerCheckName(srcId string, used map[string]bool) string {
+	if srcId == "" {
+		return ""
+	}
+	return getSpannerId(srcId, used)
+}
+
 func getSpannerId(srcId string, used map[string]bool) string {
 	spKeyName, _ := FixName(srcId)
 	if _, found := used[spKeyName]; found {
@@ -0,0 +1,65 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import "sync"
+
+// ForEachParallel calls f(i) for each i in [0, n), using up to workers
+// go routines, and waits for all calls to complete. If workers is less
+// than 2, calls are made sequentially, in order. Data conversion uses
+// this to process source tables concurrently, so f must be
+// threadsafe.
+func ForEachParallel(n, workers int, f func(i int)) {
+	ForEachWorker(n, workers, func(_, i int) { f(i) })
+}
+
+// ForEachWorker is like ForEachParallel, but also passes f the index
+// of the go routine making the call, which is in [0, Workers(workers)).
+// Calls with the same worker index are never concurrent, so f can use
+// per-worker resources (such as a connection to the source database)
+// without locking.
+func ForEachWorker(n, workers int, f func(worker, i int)) {
+	if workers < 2 {
+		for i := 0; i < n; i++ {
+			f(0, i)
+		}
+		return
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < n; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := range work {
+				f(w, i)
+			}
+		}(w)
+	}
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// Workers returns the number of go routines ForEachParallel and
+// ForEachWorker use for the given value of workers.
+func Workers(workers int) int {
+	if workers < 2 {
+		return 1
+	}
+	return workers
+}
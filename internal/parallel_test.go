@@ -0,0 +1,80 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForEachParallel(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 100} {
+		var lock sync.Mutex
+		var got []int
+		ForEachParallel(10, workers, func(i int) {
+			lock.Lock()
+			defer lock.Unlock()
+			got = append(got, i)
+		})
+		assert.ElementsMatch(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got)
+		if workers < 2 {
+			assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, got) // Sequential, in order.
+		}
+	}
+}
+
+func TestConv_ConcurrentStats(t *testing.T) {
+	conv := MakeConv()
+	conv.SetDataMode()
+	conv.SyntheticPKeys["t"] = SyntheticPKey{Col: "synth_id"}
+	var lock sync.Mutex
+	seqs := make(map[int64]bool)
+	conv.SetDataSink(func(table string, cols []string, vals []interface{}) {})
+	ForEachParallel(8, 8, func(i int) {
+		for j := 0; j < 100; j++ {
+			conv.StatsAddRow("t", true)
+			conv.WriteRow("t", "t", nil, nil)
+			conv.Unexpected("u")
+			_, seq, ok := conv.NextSyntheticPKey("t")
+			assert.True(t, ok)
+			lock.Lock()
+			seqs[seq] = true
+			lock.Unlock()
+		}
+	})
+	assert.Equal(t, int64(800), conv.Rows())
+	assert.Equal(t, int64(800), conv.Stats.GoodRows["t"])
+	assert.Equal(t, int64(800), conv.Stats.Unexpected["u"])
+	assert.Equal(t, 800, len(seqs)) // Sequence values are unique.
+}
+
+func TestForEachWorker(t *testing.T) {
+	for _, workers := range []int{0, 1, 3} {
+		// Each worker index is used by one go routine at a time.
+		busy := make([]int32, Workers(workers))
+		var count int32
+		ForEachWorker(20, workers, func(w, i int) {
+			assert.Equal(t, int32(1), atomic.AddInt32(&busy[w], 1))
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&busy[w], -1)
+			atomic.AddInt32(&count, 1)
+		})
+		assert.Equal(t, int32(20), count)
+	}
+}
@@ -16,12 +16,16 @@
 // HarbourBridge.
 package internal
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+)
 
 // Progress provides console progress functionality. i.e. it reports what
 // percentage of a task is complete to the console, overwriting previous
-// progress percentage with new progress.
+// progress percentage with new progress. Progress is threadsafe.
 type Progress struct {
+	lock     sync.Mutex
 	total    int64  // How much we have to do.
 	progress int64  // How much we have done so far.
 	pct      int    // Percentage done i.e. progress/total * 100
@@ -31,7 +35,7 @@ type Progress struct {
 
 // NewProgress creates and returns a Progress instance.
 func NewProgress(total int64, message string, verbose bool) *Progress {
-	p := &Progress{total, 0, 0, message, verbose}
+	p := &Progress{total: total, message: message, verbose: verbose}
 	if total == 0 {
 		p.pct = 100
 	}
@@ -44,6 +48,8 @@ func NewProgress(total int64, message string, verbose bool) *Progress {
 // MaybeReport will print out the new percentage, overwriting the previous
 // percentage.
 func (p *Progress) MaybeReport(progress int64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	if progress > p.progress {
 		p.progress = progress
 		var pct int
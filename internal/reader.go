@@ -29,6 +29,7 @@ type Reader struct {
 	EOF        bool
 	r          *bufio.Reader
 	progress   *Progress
+	closer     io.Closer // Closes the decompressor of compressed input (see NewDumpReader); can be nil.
 }
 
 // NewReader builds and returns an instance of Reader.
@@ -46,6 +47,9 @@ func (r *Reader) ReadLine() []byte {
 		r.EOF = true
 	} else if err != nil {
 		fmt.Printf("Error reading input data: %v\n", err)
+		// Read errors persist (e.g. for corrupt compressed input),
+		// and callers read until eof, so treat them as eof.
+		r.EOF = true
 		return []byte{}
 	}
 	r.Offset += len(b)
@@ -58,3 +62,32 @@ func (r *Reader) ReadLine() []byte {
 	}
 	return b
 }
+
+// Read implements io.Reader, for dump formats that aren't line based
+// (such as pg_dump's archive formats). Read updates Offset (but not
+// LineNumber) and reports progress.
+func (r *Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		r.EOF = true
+	}
+	r.Offset += n
+	if r.progress != nil {
+		r.progress.MaybeReport(int64(r.Offset - 1))
+	}
+	return n, err
+}
+
+// Close releases the resources used to decompress compressed input
+// (see NewDumpReader). It doesn't close the underlying input.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Peek returns the next n bytes of input without advancing the reader.
+func (r *Reader) Peek(n int) ([]byte, error) {
+	return r.r.Peek(n)
+}
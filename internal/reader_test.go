@@ -16,6 +16,10 @@ package internal
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
 
@@ -59,3 +63,43 @@ func TestReadLine(t *testing.T) {
 		}
 	}
 }
+
+func TestRead(t *testing.T) {
+	r := NewReader(bufio.NewReader(strings.NewReader("PGDMP\x01\n23")), nil)
+	b, err := r.Peek(5)
+	assert.Nil(t, err)
+	assert.Equal(t, "PGDMP", string(b))
+	assert.Equal(t, 1, r.Offset)
+	b = make([]byte, 6)
+	_, err = io.ReadFull(r, b)
+	assert.Nil(t, err)
+	assert.Equal(t, "PGDMP\x01", string(b))
+	assert.Equal(t, 7, r.Offset)
+	assert.Equal(t, "\n", string(r.ReadLine()))
+	b, err = ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "23", string(b))
+	assert.Equal(t, 10, r.Offset)
+	assert.Equal(t, 2, r.LineNumber)
+	assert.True(t, r.EOF)
+}
+
+func TestReadLine_Error(t *testing.T) {
+	// Truncated gzip input: the gzip reader returns the same error
+	// on every read.
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(strings.Repeat("INSERT INTO t VALUES (1);\n", 1000)))
+	gw.Close()
+	r, err := NewDumpReader(bytes.NewReader(gz.Bytes()[:gz.Len()/2]), nil)
+	assert.Nil(t, err)
+	// Dump parsers read lines until EOF, so read errors must be
+	// treated as EOF, or the parsers would never finish.
+	n := 0
+	for ; !r.EOF && n < 10000; n++ {
+		r.ReadLine()
+	}
+	assert.True(t, r.EOF)
+	assert.True(t, n < 1000)
+	assert.Equal(t, "", string(r.ReadLine()))
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/cloudspannerecosystem/harbourbridge/schema"
 	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
@@ -73,6 +74,7 @@ func GenerateReport(driverName string, conv *Conv, w *bufio.Writer, badWrites ma
 				w.WriteString("\n")
 			}
 		}
+		writeViewReports(conv, w)
 	}
 	if printUnexpecteds {
 		writeUnexpectedConditions(driverName, conv, w)
@@ -190,12 +192,14 @@ func buildTableReportBody(conv *Conv, srcTable string, issues map[string][]Schem
 				// on case of srcType.
 				spType = strings.ToLower(spType)
 				switch i {
-				case DefaultValue:
+				case DefaultValue, CheckConstraint:
 					l = append(l, fmt.Sprintf("%s e.g. column '%s'", IssueDB[i].Brief, srcCol))
 				case ForeignKey:
 					l = append(l, fmt.Sprintf("Column '%s' uses foreign keys which HarbourBridge does not support yet", srcCol))
 				case AutoIncrement:
 					l = append(l, fmt.Sprintf("Column '%s' is an autoincrement column. %s", srcCol, IssueDB[i].Brief))
+				case GeneratedColumn:
+					l = append(l, fmt.Sprintf("Column '%s' is a generated column. %s", srcCol, IssueDB[i].Brief))
 				case Timestamp:
 					// Avoid the confusing "timestamp is mapped to timestamp" message.
 					l = append(l, fmt.Sprintf("Some columns have source DB type 'timestamp without timezone' which is mapped to Spanner type timestamp e.g. column '%s'. %s", srcCol, IssueDB[i].Brief))
@@ -264,6 +268,15 @@ var IssueDB = map[SchemaIssue]struct {
 	Datetime:              {Brief: "Spanner timestamp is closer to MySQL timestamp", severity: note, batch: true},
 	Time:                  {Brief: "Spanner does not support time/year types", severity: note, batch: true},
 	Widened:               {Brief: "Some columns will consume more storage in Spanner", severity: note, batch: true},
+	Money:                 {Brief: "Spanner does not support money types, but numeric preserves their precision", severity: note, batch: true},
+	RowVersion:            {Brief: "Spanner does not support rowversion: values are copied, but are not updated automatically when rows change", severity: warning},
+	DatetimeNoOffset:      {Brief: "Spanner timestamp is closer to types with a time zone offset (such as SQL Server datetimeoffset or Oracle timestamp with time zone)", severity: note, batch: true},
+	NumberNoPrecision:     {Brief: "NUMBER without a precision (or with more than 29 digits before the decimal point) can store values that don't fit in Spanner's numeric (29 digits before and 9 digits after the decimal point)", severity: warning},
+	NumberToFloat:         {Brief: "NUMBER's precision and scale don't fit in Spanner's numeric, so it is mapped to float64. This type mapping could lose precision", severity: warning},
+	NumberToString:        {Brief: "NUMBER is an integer with more digits than Spanner's numeric can store (29), so it is mapped to string to preserve its values", severity: warning},
+	OracleDate:            {Brief: "Oracle DATE includes a time of day, so it is mapped to Spanner timestamp", severity: note, batch: true},
+	CheckConstraint:       {Brief: "Some check constraints use expressions that HarbourBridge can't translate, so they are dropped", severity: warning, batch: true},
+	GeneratedColumn:       {Brief: "HarbourBridge can't translate its expression, so it is converted to a regular column", severity: warning},
 }
 
 type severity int
@@ -410,14 +423,35 @@ func IgnoredStatements(conv *Conv) (l []string) {
 			l = append(l, "triggers")
 		case "IndexStmt", "CreateIndexStmt":
 			l = append(l, "(non-primary) indexes")
-		case "ViewStmt", "CreateViewStmt":
-			l = append(l, "views")
 		}
 	}
 	sort.Strings(l)
 	return l
 }
 
+// writeViewReports writes a section for each source view, saying
+// whether it was converted, and if not, why not.
+func writeViewReports(conv *Conv, w *bufio.Writer) {
+	var names []string
+	for name := range conv.SrcViews {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h := fmt.Sprintf("View %s", name)
+		if sp, ok := conv.ToSpanner[name]; ok && sp.Name != name {
+			h = h + fmt.Sprintf(" (mapped to Spanner view %s)", sp.Name)
+		}
+		writeHeading(w, h)
+		if issue, ok := conv.ViewIssues[name]; ok {
+			justifyLines(w, fmt.Sprintf("View can't be converted: %s. The view has been dropped.\n", issue), 80, 0)
+		} else {
+			justifyLines(w, "Converted to a Spanner view with SQL SECURITY INVOKER.\n", 80, 0)
+		}
+		w.WriteString("\n")
+	}
+}
+
 func writeStmtStats(driverName string, conv *Conv, w *bufio.Writer) {
 	type stat struct {
 		statement string
@@ -455,6 +489,49 @@ func writeStmtStats(driverName string, conv *Conv, w *bufio.Writer) {
 	}
 }
 
+// ChangeSummary describes the progress of streaming changes after data
+// conversion (see source.ChangeStreamer).
+type ChangeSummary struct {
+	Position     string    // Position in the source's change log after the last applied transaction.
+	Transactions int64     // Number of source transactions applied to Spanner.
+	Mutations    int64     // Number of Spanner mutations applied.
+	LastCommit   time.Time // Source commit time of the last applied transaction (zero if none).
+	Lag          time.Duration
+}
+
+// WriteChangeReport writes a report of the changes streamed after data
+// conversion to w: the progress described by s, and the changes
+// counted with conv.StatsAddChange, broken down by source table.
+func WriteChangeReport(conv *Conv, w *bufio.Writer, s ChangeSummary) {
+	writeHeading(w, "Change Data Capture")
+	fmt.Fprintf(w, "Applied %d transactions (%d mutations); now at %s.\n", s.Transactions, s.Mutations, s.Position)
+	if !s.LastCommit.IsZero() {
+		fmt.Fprintf(w, "Last applied transaction was committed at %s (lag %s).\n", s.LastCommit.UTC().Format(time.RFC3339), s.Lag.Round(time.Second))
+	}
+	w.WriteString("\n")
+	conv.statsLock.Lock()
+	defer conv.statsLock.Unlock()
+	if len(conv.Stats.Changes) == 0 {
+		w.WriteString("There were no changes to replicate.\n\n")
+		return
+	}
+	var tables []string
+	for t := range conv.Stats.Changes {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	w.WriteString("Changes applied to Spanner, broken down by source table.\n")
+	w.WriteString("   error: changes that could not be converted (run with -v for details).\n")
+	w.WriteString("  --------------------------------------\n")
+	fmt.Fprintf(w, "  %6s %6s %6s %6s  %s\n", "insert", "update", "delete", "error", "table")
+	w.WriteString("  --------------------------------------\n")
+	for _, t := range tables {
+		c := conv.Stats.Changes[t]
+		fmt.Fprintf(w, "  %6d %6d %6d %6d  %s\n", c.Insert, c.Update, c.Delete, c.Error, t)
+	}
+	w.WriteString("\n")
+}
+
 func writeUnexpectedConditions(driverName string, conv *Conv, w *bufio.Writer) {
 	reparseInfo := func() {
 		if conv.Stats.Reparsed > 0 {
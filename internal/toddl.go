@@ -0,0 +1,203 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// SchemaToDDL performs schema conversion from the source DB schema to
+// Spanner, for source databases whose tables only need their columns,
+// keys and indexes converted. It uses the source schema in
+// conv.SrcSchema, and writes the Spanner schema to conv.SpSchema.
+// toSpannerType maps a scalar source type (defined by id and mods),
+// which differs between source databases, to a Spanner type and a list
+// of type conversion issues.
+func SchemaToDDL(conv *Conv, toSpannerType func(conv *Conv, id string, mods []int64) (ddl.Type, []SchemaIssue)) error {
+	// Tracks Spanner names that have been used for foreign key constraints
+	// and indexes. We use this to ensure we generate unique names when
+	// we map from the source database to Spanner since Spanner requires
+	// all foreign key and index names to be distinct (you can't use the
+	// same name for a foreign key constraint and an index).
+	usedNames := make(map[string]bool)
+	// As Spanner uses same namespace for table names, foreign key constraint
+	// names and index names, we need to pre-populate usedNames with Spanner table
+	// names to handle collision with foreign key names and index names.
+	for _, srcTable := range conv.SrcSchema {
+		spTableName, err := GetSpannerTable(conv, srcTable.Name)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't map source table %s to Spanner: %s", srcTable.Name, err))
+			continue
+		}
+		usedNames[spTableName] = true
+	}
+	for _, srcTable := range conv.SrcSchema {
+		spTableName, err := GetSpannerTable(conv, srcTable.Name)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't map source table %s to Spanner: %s", srcTable.Name, err))
+			continue
+		}
+		var spColNames []string
+		spColDef := make(map[string]ddl.ColumnDef)
+		conv.Issues[srcTable.Name] = make(map[string][]SchemaIssue)
+		// Iterate over columns using ColNames order.
+		for _, srcColName := range srcTable.ColNames {
+			srcCol := srcTable.ColDefs[srcColName]
+			colName, err := GetSpannerCol(conv, srcTable.Name, srcCol.Name, false)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't map source column %s of table %s to Spanner: %s", srcTable.Name, srcCol.Name, err))
+				continue
+			}
+			spColNames = append(spColNames, colName)
+			ty, issues := toSpannerType(conv, srcCol.Type.Name, srcCol.Type.Mods)
+			if len(srcCol.Type.ArrayBounds) > 1 {
+				ty = ddl.Type{Name: ddl.String, Len: ddl.MaxLength}
+				issues = append(issues, MultiDimensionalArray)
+			}
+			// TODO(hengfeng): add issues for all elements of srcCol.Ignored.
+			if srcCol.Ignored.ForeignKey {
+				issues = append(issues, ForeignKey)
+			}
+			if srcCol.Ignored.Default {
+				issues = append(issues, DefaultValue)
+			}
+			if srcCol.Ignored.AutoIncrement {
+				issues = append(issues, AutoIncrement)
+			}
+			if len(issues) > 0 {
+				conv.Issues[srcTable.Name][srcCol.Name] = issues
+			}
+			ty.IsArray = len(srcCol.Type.ArrayBounds) == 1
+			spColDef[colName] = ddl.ColumnDef{
+				Name:    colName,
+				T:       ty,
+				NotNull: srcCol.NotNull,
+				Comment: "From: " + QuoteIfNeeded(srcCol.Name) + " " + srcCol.Type.Print(),
+			}
+		}
+		comment := "Spanner schema for source table " + QuoteIfNeeded(srcTable.Name)
+		conv.SpSchema[spTableName] = ddl.CreateTable{
+			Name:     spTableName,
+			ColNames: spColNames,
+			ColDefs:  spColDef,
+			Pks:      CvtPrimaryKeys(conv, srcTable.Name, srcTable.PrimaryKeys),
+			Fks:      CvtForeignKeys(conv, srcTable.Name, srcTable.ForeignKeys, usedNames),
+			Indexes:  CvtIndexes(conv, spTableName, srcTable.Name, srcTable.Indexes, usedNames),
+			Comment:  comment}
+	}
+	ResolveRefs(conv)
+	return nil
+}
+
+// QuoteIfNeeded quotes source name s (for comments in the Spanner
+// schema) if it contains characters other than letters, digits and
+// punctuation.
+func QuoteIfNeeded(s string) string {
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsPunct(r) {
+			continue
+		}
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// CvtPrimaryKeys maps the primary key srcKeys of source table srcTable
+// to Spanner.
+func CvtPrimaryKeys(conv *Conv, srcTable string, srcKeys []schema.Key) []ddl.IndexKey {
+	var spKeys []ddl.IndexKey
+	for _, k := range srcKeys {
+		spCol, err := GetSpannerCol(conv, srcTable, k.Column, true)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't map key for table %s", srcTable))
+			continue
+		}
+		spKeys = append(spKeys, ddl.IndexKey{Col: spCol, Desc: k.Desc})
+	}
+	return spKeys
+}
+
+// CvtForeignKeys maps the foreign keys srcKeys of source table
+// srcTable to Spanner, naming them uniquely among usedNames.
+func CvtForeignKeys(conv *Conv, srcTable string, srcKeys []schema.ForeignKey, usedNames map[string]bool) []ddl.Foreignkey {
+	var spKeys []ddl.Foreignkey
+	for _, key := range srcKeys {
+		if len(key.Columns) != len(key.ReferColumns) {
+			conv.Unexpected(fmt.Sprintf("ConvertForeignKeys: columns and referColumns don't have the same lengths: len(columns)=%d, len(referColumns)=%d for source table: %s, referenced table: %s", len(key.Columns), len(key.ReferColumns), srcTable, key.ReferTable))
+			continue
+		}
+		spReferTable, err := GetSpannerTable(conv, key.ReferTable)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't map foreign key for source table: %s, referenced table: %s", srcTable, key.ReferTable))
+			continue
+		}
+		var spCols, spReferCols []string
+		for i, col := range key.Columns {
+			spCol, err1 := GetSpannerCol(conv, srcTable, col, false)
+			spReferCol, err2 := GetSpannerCol(conv, key.ReferTable, key.ReferColumns[i], false)
+			if err1 != nil || err2 != nil {
+				conv.Unexpected(fmt.Sprintf("Can't map foreign key for table: %s, referenced table: %s, column: %s", srcTable, key.ReferTable, col))
+				continue
+			}
+			spCols = append(spCols, spCol)
+			spReferCols = append(spReferCols, spReferCol)
+		}
+		spKeyName := ToSpannerForeignKey(key.Name, usedNames)
+		spKey := ddl.Foreignkey{
+			Name:         spKeyName,
+			Columns:      spCols,
+			ReferTable:   spReferTable,
+			ReferColumns: spReferCols}
+		spKeys = append(spKeys, spKey)
+	}
+	return spKeys
+}
+
+// CvtIndexes maps the indexes srcIndexes of source table srcTable
+// (Spanner table spTableName) to Spanner, naming them uniquely among
+// usedNames.
+func CvtIndexes(conv *Conv, spTableName string, srcTable string, srcIndexes []schema.Index, usedNames map[string]bool) []ddl.CreateIndex {
+	var spIndexes []ddl.CreateIndex
+	for _, srcIndex := range srcIndexes {
+		var spKeys []ddl.IndexKey
+		for _, k := range srcIndex.Keys {
+			spCol, err := GetSpannerCol(conv, srcTable, k.Column, true)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Can't map index key column name for table %s", srcTable))
+				continue
+			}
+			spKeys = append(spKeys, ddl.IndexKey{Col: spCol, Desc: k.Desc})
+		}
+		if srcIndex.Name == "" {
+			// Generate a name if index name is empty.
+			// Collision of index name will be handled by ToSpannerIndexName.
+			srcIndex.Name = fmt.Sprintf("Index_%s", srcTable)
+		}
+		spIndexName := ToSpannerIndexName(srcIndex.Name, usedNames)
+		spIndex := ddl.CreateIndex{
+			Name:   spIndexName,
+			Table:  spTableName,
+			Unique: srcIndex.Unique,
+			Keys:   spKeys,
+		}
+		spIndexes = append(spIndexes, spIndex)
+	}
+	return spIndexes
+}
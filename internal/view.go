@@ -0,0 +1,419 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// ReserveViewNames maps the names of the views in conv.SrcViews to
+// Spanner names, and adds them to usedNames. Views share the namespace
+// of tables in Spanner, so drivers call ReserveViewNames after mapping
+// table names (so that tables keep their names if there's a clash), and
+// before naming constraints and indexes.
+func ReserveViewNames(conv *Conv, usedNames map[string]bool) {
+	for _, srcView := range conv.SrcViews {
+		spViewName, err := GetSpannerTable(conv, srcView.Name)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't map source view %s to Spanner: %s", srcView.Name, err))
+			continue
+		}
+		usedNames[spViewName] = true
+	}
+}
+
+// ViewsToDDL translates the views in conv.SrcViews to Spanner views,
+// and adds them to conv.SpViews. Views that can't be translated are
+// dropped, and the reason is recorded in conv.ViewIssues. Drivers map
+// view names with ReserveViewNames before calling ViewsToDDL.
+func ViewsToDDL(conv *Conv) {
+	var names []string
+	for name := range conv.SrcViews {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cv, err := ToSpannerView(conv, conv.SrcViews[name])
+		if err != nil {
+			conv.ViewIssues[name] = err.Error()
+			continue
+		}
+		conv.SpViews[cv.Name] = cv
+	}
+	dropDependentViews(conv)
+}
+
+// dropDependentViews drops the views in conv.SpViews that use views
+// with issues (recorded in conv.ViewIssues), directly or indirectly.
+func dropDependentViews(conv *Conv) {
+	for changed := true; changed; {
+		changed = false
+		for spName, cv := range conv.SpViews {
+			for _, tok := range cv.Query {
+				used := conv.ToSource[tok.Text].Name
+				if _, bad := conv.ViewIssues[used]; tok.Kind == ddl.ExprTable && bad {
+					conv.ViewIssues[conv.ToSource[spName].Name] = fmt.Sprintf("uses view %s, which can't be converted", used)
+					delete(conv.SpViews, spName)
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// ToSpannerView translates source view v to a Spanner view. We don't
+// parse the view's query: we translate it token by token, mapping
+// table, view and column names to their Spanner names, and checking
+// that the query only uses keywords, functions and operators that
+// Spanner supports (with the same meaning). Specifically:
+//   - schema qualifiers of table names (such as pg_dump's public.t) are
+//     dropped
+//   - aliases of tables and select items are kept (made legal with
+//     FixName)
+//   - PostgreSQL's ~~ and !~~ operators become LIKE and NOT LIKE
+//   - casts of literals and casts to string types (which pg_dump adds
+//     to view queries) are dropped, as in ToSpannerCheck
+//
+// ToSpannerView returns an error describing the first construct that
+// can't be translated, such as an unsupported function or a name that
+// isn't a table, column or alias.
+func ToSpannerView(conv *Conv, v schema.View) (ddl.CreateView, error) {
+	sp, ok := conv.ToSpanner[v.Name]
+	if !ok {
+		return ddl.CreateView{}, fmt.Errorf("view name isn't mapped to Spanner")
+	}
+	toks, _, ok := tokenizeCheck(v.Query, func(string) (string, bool) { return "", false })
+	if !ok {
+		return ddl.CreateView{}, fmt.Errorf("can't parse query")
+	}
+	t := &viewTranslator{conv: conv, toks: toks, aliases: make(map[string]string), defs: make(map[int]bool)}
+	t.findRelations()
+	query, err := t.translate()
+	if err != nil {
+		return ddl.CreateView{}, err
+	}
+	return ddl.CreateView{
+		Name:    sp.Name,
+		Query:   query,
+		Comment: "Spanner view for source view " + v.Name,
+	}, nil
+}
+
+// Keywords of view queries that we translate as is. All other names
+// are table, view, column or alias names, or function names (see
+// viewFuncs).
+var viewKeywords = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "ALL": true, "AS": true, "FROM": true, "WHERE": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "OUTER": true, "CROSS": true, "ON": true, "USING": true,
+	"GROUP": true, "BY": true, "HAVING": true, "ORDER": true, "ASC": true, "DESC": true, "LIMIT": true, "OFFSET": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "WITH": true,
+	"AND": true, "OR": true, "NOT": true, "IN": true, "IS": true, "BETWEEN": true, "LIKE": true, "EXISTS": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true,
+	"NULL": true, "TRUE": true, "FALSE": true,
+}
+
+// Functions of view queries that we translate, and their Spanner names.
+var viewFuncs = map[string]string{
+	"count":            "COUNT",
+	"sum":              "SUM",
+	"avg":              "AVG",
+	"min":              "MIN",
+	"max":              "MAX",
+	"coalesce":         "COALESCE",
+	"ifnull":           "IFNULL",
+	"nullif":           "NULLIF",
+	"greatest":         "GREATEST",
+	"least":            "LEAST",
+	"char_length":      "CHAR_LENGTH",
+	"character_length": "CHAR_LENGTH",
+	"lower":            "LOWER",
+	"upper":            "UPPER",
+	"trim":             "TRIM",
+	"ltrim":            "LTRIM",
+	"rtrim":            "RTRIM",
+	"abs":              "ABS",
+	"concat":           "CONCAT",
+}
+
+// Operators of view queries that we translate, and their Spanner
+// equivalents.
+var viewOps = map[string]string{
+	"=": "=", "<>": "<>", "!=": "<>", "<": "<", "<=": "<=", ">": ">", ">=": ">=",
+	"+": "+", "-": "-", "*": "*", "/": "/", "||": "||",
+	"(": "(", ")": ")", ",": ",", ".": ".",
+	"~~": "LIKE", "!~~": "NOT LIKE",
+}
+
+type viewTranslator struct {
+	conv *Conv
+	toks []checkToken
+	// Source tables and views used by the query, and aliases defined
+	// by the query. aliases maps each alias to the table or view it
+	// names, or "" for aliases of select items and subqueries, and defs
+	// records the positions of the tokens that define aliases.
+	relations []string
+	aliases   map[string]string
+	defs      map[int]bool
+}
+
+// isIdent returns whether toks[i] is a name that isn't a keyword.
+func (t *viewTranslator) isIdent(i int) bool {
+	if i < 0 || i >= len(t.toks) {
+		return false
+	}
+	tok := t.toks[i]
+	return tok.kind == checkQuoted || (tok.kind == checkName && !viewKeywords[strings.ToUpper(tok.text)])
+}
+
+func (t *viewTranslator) isOp(i int, op string) bool {
+	return i >= 0 && i < len(t.toks) && t.toks[i].kind == checkOp && t.toks[i].text == op
+}
+
+func (t *viewTranslator) isKeyword(i int, k string) bool {
+	return i >= 0 && i < len(t.toks) && t.toks[i].kind == checkName && strings.EqualFold(t.toks[i].text, k)
+}
+
+// isRelation returns whether name is a source table or view.
+func (t *viewTranslator) isRelation(name string) bool {
+	_, table := t.conv.SrcSchema[name]
+	_, view := t.conv.SrcViews[name]
+	return table || view
+}
+
+// relation returns the table or view named by the tokens at i, and
+// the number of tokens used, or 0 if they don't name a table or view.
+// Names may be qualified by a schema (or MySQL database), which is
+// dropped unless the source table name includes it.
+func (t *viewTranslator) relation(i int) (string, int) {
+	if !t.isIdent(i) || t.isOp(i-1, ".") {
+		return "", 0
+	}
+	name := t.toks[i].text
+	if t.isOp(i+1, ".") && t.isIdent(i+2) {
+		next := t.toks[i+2].text
+		switch {
+		case t.isRelation(name + "." + next):
+			return name + "." + next, 3
+		case t.isRelation(next) && !t.isRelation(name) && !t.isOp(i+3, "."):
+			return next, 3
+		}
+		return "", 0
+	}
+	if t.isRelation(name) {
+		return name, 1
+	}
+	return "", 0
+}
+
+// findRelations finds the tables and views used by the query, and the
+// aliases it defines. An alias is a name that follows AS, a table or
+// view name, or a closing parenthesis (of a subquery).
+func (t *viewTranslator) findRelations() {
+	for i := 0; i < len(t.toks); i++ {
+		if r, n := t.relation(i); n > 0 {
+			t.relations = append(t.relations, r)
+			j := i + n
+			if t.isKeyword(j, "AS") {
+				j++
+			}
+			if t.isIdent(j) && !t.isOp(j+1, "(") && !t.isOp(j+1, ".") {
+				t.aliases[t.toks[j].text] = r
+				t.defs[j] = true
+				i = j
+			} else {
+				i += n - 1
+			}
+			continue
+		}
+		if (t.isKeyword(i-1, "AS") || t.isOp(i-1, ")")) && t.isIdent(i) && !t.isOp(i+1, "(") && !t.isOp(i+1, ".") {
+			t.aliases[t.toks[i].text] = ""
+			t.defs[i] = true
+		}
+	}
+}
+
+// columns returns the Spanner names of the columns of source table or
+// view r, keyed by their source names.
+func (t *viewTranslator) columns(r string) map[string]string {
+	if _, ok := t.conv.SrcSchema[r]; ok {
+		return t.conv.ToSpanner[r].Cols
+	}
+	cols := make(map[string]string)
+	if v, ok := t.conv.SrcViews[r]; ok {
+		if toks, _, ok := tokenizeCheck(v.Query, func(string) (string, bool) { return "", false }); ok {
+			for _, c := range viewColumns(toks) {
+				cols[c], _ = FixName(c)
+			}
+		}
+	}
+	return cols
+}
+
+// column returns the Spanner name of column c of source table or view
+// r, or of the tables and views used by the query if r is "".
+func (t *viewTranslator) column(r, c string) (string, error) {
+	if r != "" {
+		if sp, ok := t.columns(r)[c]; ok {
+			return sp, nil
+		}
+		return "", fmt.Errorf("unknown column %s.%s", r, c)
+	}
+	var found []string
+	for _, r := range t.relations {
+		if sp, ok := t.columns(r)[c]; ok && (len(found) == 0 || found[0] != sp) {
+			found = append(found, sp)
+		}
+	}
+	if len(found) > 1 {
+		return "", fmt.Errorf("ambiguous column %s", c)
+	}
+	if len(found) == 0 {
+		return "", fmt.Errorf("unknown name %s", c)
+	}
+	return found[0], nil
+}
+
+// translate returns the tokens of the Spanner query.
+func (t *viewTranslator) translate() ([]ddl.ExprToken, error) {
+	var out []ddl.ExprToken
+	for i := 0; i < len(t.toks); i++ {
+		tok := t.toks[i]
+		switch {
+		case tok.kind == checkString:
+			out = append(out, ddl.ExprToken{Kind: ddl.ExprString, Text: tok.text})
+		case tok.kind == checkNumber:
+			out = append(out, symbol(tok.text))
+		case tok.kind == checkOp && tok.text == "::":
+			// Casts of literals and casts to strings are dropped.
+			literal := i > 0 && (t.toks[i-1].kind == checkString || t.toks[i-1].kind == checkNumber)
+			p := &checkParser{toks: t.toks, i: i + 1}
+			str, ok := p.typeName()
+			if !ok || !(str || literal) {
+				return nil, fmt.Errorf("unsupported cast")
+			}
+			i = p.i - 1
+		case tok.kind == checkOp:
+			op, ok := viewOps[tok.text]
+			if !ok {
+				return nil, fmt.Errorf("unsupported operator %s", tok.text)
+			}
+			out = append(out, symbol(op))
+		case tok.kind == checkName && viewKeywords[strings.ToUpper(tok.text)]:
+			out = append(out, symbol(strings.ToUpper(tok.text)))
+		case tok.kind == checkName && t.isOp(i+1, "("):
+			f, ok := viewFuncs[strings.ToLower(tok.text)]
+			if !ok {
+				return nil, fmt.Errorf("unsupported function %s", tok.text)
+			}
+			out = append(out, symbol(f+"("))
+			i++
+		default:
+			toks, n, err := t.name(i)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, toks...)
+			i += n - 1
+		}
+	}
+	return out, nil
+}
+
+// name translates the (possibly qualified) name at toks[i], and returns
+// the number of tokens used.
+func (t *viewTranslator) name(i int) ([]ddl.ExprToken, int, error) {
+	if t.defs[i] {
+		return []ddl.ExprToken{alias(t.toks[i].text)}, 1, nil
+	}
+	if r, n := t.relation(i); n > 0 {
+		return []ddl.ExprToken{{Kind: ddl.ExprTable, Text: t.conv.ToSpanner[r].Name}}, n, nil
+	}
+	name := t.toks[i].text
+	if t.isOp(i+1, ".") && t.isIdent(i+2) {
+		// A qualified column name.
+		var q ddl.ExprToken
+		var r string
+		if t.isRelation(name) {
+			r = name
+			q = ddl.ExprToken{Kind: ddl.ExprTable, Text: t.conv.ToSpanner[r].Name}
+		} else if a, ok := t.aliases[name]; ok {
+			r = a
+			q = alias(name)
+		} else {
+			return nil, 0, fmt.Errorf("unknown name %s", name)
+		}
+		c := t.toks[i+2].text
+		if r == "" {
+			// A column of a subquery.
+			return []ddl.ExprToken{q, symbol("."), alias(c)}, 3, nil
+		}
+		sp, err := t.column(r, c)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []ddl.ExprToken{q, symbol("."), {Kind: ddl.ExprColumn, Text: sp}}, 3, nil
+	}
+	sp, err := t.column("", name)
+	if err != nil {
+		if _, ok := t.aliases[name]; ok {
+			return []ddl.ExprToken{alias(name)}, 1, nil
+		}
+		return nil, 0, err
+	}
+	return []ddl.ExprToken{{Kind: ddl.ExprColumn, Text: sp}}, 1, nil
+}
+
+func alias(name string) ddl.ExprToken {
+	a, _ := FixName(name)
+	return ddl.ExprToken{Kind: ddl.ExprColumn, Text: a}
+}
+
+// viewColumns returns the names of the columns of a view, given the
+// tokens of its query: the alias of each select item, or the last name
+// in the item if it has no alias.
+func viewColumns(toks []checkToken) []string {
+	var cols []string
+	depth := 0
+	started := false
+	last := ""
+	for _, tok := range toks {
+		switch {
+		case tok.kind == checkOp && tok.text == "(":
+			depth++
+		case tok.kind == checkOp && tok.text == ")":
+			depth--
+		case depth != 0:
+		case tok.kind == checkName && strings.EqualFold(tok.text, "SELECT"):
+			started = true
+		case !started:
+		case tok.kind == checkOp && tok.text == ",":
+			cols = append(cols, last)
+		case tok.kind == checkName && strings.EqualFold(tok.text, "FROM"):
+			return append(cols, last)
+		case tok.kind == checkQuoted || (tok.kind == checkName && !viewKeywords[strings.ToUpper(tok.text)]):
+			last = tok.text
+		}
+	}
+	if started {
+		cols = append(cols, last)
+	}
+	return cols
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+	"github.com/stretchr/testify/assert"
+)
+
+// viewConv returns a Conv with source tables t (columns a, b and
+// p-q, which is renamed in Spanner) and u (columns a and c).
+func viewConv(t *testing.T) *Conv {
+	conv := MakeConv()
+	conv.SrcSchema["t"] = schema.Table{Name: "t", ColNames: []string{"a", "b", "p-q"}}
+	conv.SrcSchema["u"] = schema.Table{Name: "u", ColNames: []string{"a", "c"}}
+	for _, st := range conv.SrcSchema {
+		_, err := GetSpannerTable(conv, st.Name)
+		assert.Nil(t, err)
+		_, err = GetSpannerCols(conv, st.Name, st.ColNames)
+		assert.Nil(t, err)
+	}
+	return conv
+}
+
+func TestToSpannerView(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string // Empty if the query can't be translated.
+	}{
+		// pg_dump.
+		{` SELECT t.a,
+    t."p-q"
+   FROM public.t
+  WHERE (t.a > 0)`, "SELECT t.a, t.p_q FROM t WHERE (t.a > 0)"},
+		{` SELECT x.a AS total
+   FROM (t x
+     JOIN u ON ((x.a = u.a)))
+  WHERE ((u.c)::text ~~ 'x%'::text)`, `SELECT x.a AS total FROM (t x JOIN u ON ((x.a = u.a))) WHERE ((u.c) LIKE "x%")`},
+		{` SELECT count(*) AS n FROM public.t`, "SELECT COUNT(*) AS n FROM t"},
+		{` SELECT t.a FROM public.t WHERE (t.a = 'x'::bpchar)`, `SELECT t.a FROM t WHERE (t.a = "x")`},
+		{` SELECT t.a FROM t WHERE (t.b)::integer > 0`, ""}, // Unsupported cast.
+		{` SELECT now() AS ts FROM t`, ""},                  // Unsupported function.
+		{` SELECT t.a FROM t WHERE (t.b ~ '^x'::text)`, ""}, // Unsupported operator.
+		{` SELECT a, c FROM t JOIN u USING (a)`, "SELECT a, c FROM t JOIN u USING (a)"},
+		{` SELECT t.d FROM t`, ""}, // Unknown column.
+		{` SELECT a FROM w`, ""},   // Unknown table.
+		// mysqldump.
+		{"SELECT `t`.`a` AS `a`,`t`.`p-q` AS `p-q` FROM `t` WHERE `t`.`b`!=_UTF8MB4'x'",
+			`SELECT t.a AS a, t.p_q AS p_q FROM t WHERE t.b <> "x"`},
+		{"SELECT `c`,SUM(`b`) AS `s` FROM `t` JOIN `u` ON `t`.`a`=`u`.`a` GROUP BY `c`",
+			"SELECT c, SUM(b) AS s FROM t JOIN u ON t.a = u.a GROUP BY c"},
+		{"SELECT `a` FROM `db`.`t`", "SELECT a FROM t"},
+		{"SELECT `a` FROM `t` WHERE `b`='x", ""}, // Malformed query.
+	}
+	for _, tc := range tests {
+		conv := viewConv(t)
+		cv, err := ToSpannerView(conv, schema.View{Name: "v", Query: tc.query})
+		assert.NotNil(t, err, tc.query) // View name isn't mapped.
+		_, err = GetSpannerTable(conv, "v")
+		assert.Nil(t, err)
+		cv, err = ToSpannerView(conv, schema.View{Name: "v", Query: tc.query})
+		assert.Equal(t, tc.want != "", err == nil, tc.query)
+		assert.Equal(t, tc.want, ddl.PrintExpr(ddl.Config{}, cv.Query), tc.query)
+	}
+}
+
+func TestViewsToDDL(t *testing.T) {
+	conv := viewConv(t)
+	conv.SrcViews = map[string]schema.View{
+		"v-1":  {Name: "v-1", Query: "SELECT `a`,`p-q` FROM `t`"},
+		"v2":   {Name: "v2", Query: "SELECT `v`.`p-q` FROM `v-1` `v`"},
+		"bad":  {Name: "bad", Query: "SELECT NOW() AS `ts` FROM `t`"},
+		"bad2": {Name: "bad2", Query: "SELECT `ts` FROM `bad`"},
+	}
+	for name := range conv.SrcViews {
+		_, err := GetSpannerTable(conv, name)
+		assert.Nil(t, err)
+	}
+	ViewsToDDL(conv)
+	assert.Equal(t, []string{
+		"CREATE VIEW v_1 SQL SECURITY INVOKER AS SELECT a, p_q FROM t",
+		"CREATE VIEW v2 SQL SECURITY INVOKER AS SELECT v.p_q FROM v_1 v",
+	}, conv.SpViews.GetDDL(ddl.Config{}))
+	assert.Equal(t, map[string]string{
+		"bad":  "unsupported function NOW",
+		"bad2": "uses view bad, which can't be converted",
+	}, conv.ViewIssues)
+}
+
+func TestReserveViewNames(t *testing.T) {
+	conv := viewConv(t)
+	conv.SrcViews = map[string]schema.View{"v-1": {Name: "v-1"}, "v2": {Name: "v2"}}
+	usedNames := map[string]bool{"t": true, "u": true}
+	ReserveViewNames(conv, usedNames)
+	assert.Equal(t, "v_1", conv.ToSpanner["v-1"].Name)
+	assert.Equal(t, map[string]bool{"t": true, "u": true, "v_1": true, "v2": true}, usedNames)
+}
@@ -21,14 +21,15 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/lib/pq"
-
 	"github.com/cloudspannerecosystem/harbourbridge/cmd"
 	"github.com/cloudspannerecosystem/harbourbridge/conversion"
 	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
 	"github.com/cloudspannerecosystem/harbourbridge/web"
 )
 
@@ -45,21 +46,41 @@ var (
 	sessionJSON      string
 	webapi           bool
 	dumpFilePath     string
+	exportDir        string
+	exportFormat     string
+	targetDialect    string
+	validateData     bool
+	diffData         bool
+	resume           bool
+	writeMode        string
+	readWorkers      int
+	chunkRows        int64
+	cdc              string
 )
 
 func init() {
 	flag.StringVar(&dbNameOverride, "dbname", "", "dbname: name to use for Spanner DB")
 	flag.StringVar(&instanceOverride, "instance", "", "instance: Spanner instance to use")
 	flag.StringVar(&filePrefix, "prefix", "", "prefix: file prefix for generated files")
-	flag.StringVar(&driverName, "driver", "pg_dump", "driver name: flag for accessing source DB or dump files (accepted values are \"pg_dump\", \"postgres\", \"mysqldump\", and \"mysql\")")
-	flag.Int64Var(&schemaSampleSize, "schema-sample-size", int64(100000), "schema-sample-size: the number of rows to use for inferring schema (only for DynamoDB)")
+	flag.StringVar(&driverName, "driver", "pg_dump", "driver name: flag for accessing source DB or dump files (accepted values are "+quoteList(source.Drivers())+")")
+	flag.Int64Var(&schemaSampleSize, "schema-sample-size", int64(100000), "schema-sample-size: the number of rows to use for inferring schema (only for DynamoDB, SQLite and CSV)")
 	flag.BoolVar(&verbose, "v", false, "verbose: print additional output")
 	flag.BoolVar(&schemaOnly, "schema-only", false, "schema-only: in this mode we do schema conversion, but skip data conversion")
 	flag.BoolVar(&dataOnly, "data-only", false, "data-only: in this mode we skip schema conversion and just do data conversion (use the session flag to specify the session file for schema and data mapping)")
 	flag.BoolVar(&skipForeignKeys, "skip-foreign-keys", false, "skip-foreign-keys: if true, skip creating foreign keys after data migration is complete (ddl statements for foreign keys can still be found in the downloaded schema.ddl.txt file and the same can be applied separately)")
 	flag.StringVar(&sessionJSON, "session", "", "session: specifies the file we restore session state from (used in schema-only to provide schema and data mapping)")
 	flag.BoolVar(&webapi, "web", false, "web: run the web interface (experimental)")
-	flag.StringVar(&dumpFilePath, "dump-file", "", "dump-file: location of dump file to process")
+	flag.StringVar(&dumpFilePath, "dump-file", "", "dump-file: location of dump file (or pg_dump -Fd directory) to process")
+	flag.StringVar(&exportDir, "export-dir", "", "export-dir: instead of writing data to Spanner, write it to files in this directory (no Spanner access is needed)")
+	flag.StringVar(&exportFormat, "export-format", "avro", "export-format: format of files written to export-dir (accepted values are \"avro\" for use with Spanner's import pipeline, \"csv\" and \"jsonl\")")
+	flag.BoolVar(&resume, "resume", false, "resume: resume an interrupted data migration to the existing database named by dbname, skipping rows recorded as written in the checkpoint file of the earlier run")
+	flag.BoolVar(&validateData, "validate", false, "validate: after data migration, read each table back from Spanner and compare its row count and checksum with the converted source data, adding the result to the report and writing the keys of mismatched rows to validation.json")
+	flag.BoolVar(&diffData, "diff", false, "diff: instead of migrating data, compare the source data with the existing database named by dbname row by row, writing the rows that are missing, extra or changed in Spanner to diff.jsonl (use the session flag to specify the session file used by the migration, if any)")
+	flag.IntVar(&readWorkers, "read-workers", 1, "read-workers: number of source tables to read concurrently during data conversion, each using its own connection (only for drivers postgres and mysql)")
+	flag.Int64Var(&chunkRows, "chunk-rows", 0, "chunk-rows: split source tables with more than this many rows into primary key ranges of about this many rows, which are read concurrently by read-workers and retried independently (only for drivers postgres and mysql; 0 disables chunking)")
+	flag.StringVar(&writeMode, "write-mode", "insert", "write-mode: how rows are written to Spanner (accepted values are \"insert\", which fails for rows that already exist, \"insert-or-update\" and \"replace\"); with insert-or-update or replace, data is written to the database named by dbname if it already exists")
+	flag.StringVar(&cdc, "cdc", "", "cdc: after data migration, keep the database up to date by streaming changes made to the source database from this change log location until interrupted (for driver mysql, a directory of binlog files, e.g. as copied by mysqlbinlog --read-from-remote-server --raw --stop-never; for driver postgres, the name of an existing publication, and of the logical replication slot to create; for driver dynamodb, streams to read the DynamoDB stream of each table); use with resume to restart streaming from the position saved in changes.json")
+	flag.StringVar(&targetDialect, "target-dialect", "", "target-dialect: dialect of the Spanner database to create (accepted values are \"google_standard_sql\" and \"postgresql\"; defaults to the dialect in the session file, or google_standard_sql)")
 }
 
 func usage() {
@@ -99,13 +120,62 @@ func main() {
 	if schemaOnly && skipForeignKeys {
 		panic(fmt.Errorf("can't use both schema-only and skip-foreign-keys at once. Foreign Key creation can only be skipped when data migration takes place."))
 	}
+	if diffData && dbNameOverride == "" {
+		panic(fmt.Errorf("when using diff mode, dbname must specify the database to compare with"))
+	}
+	if diffData && (schemaOnly || dataOnly || resume || validateData || exportDir != "") {
+		panic(fmt.Errorf("can't use diff with schema-only, data-only, resume, validate or export-dir"))
+	}
+	if validateData && (schemaOnly || exportDir != "") {
+		panic(fmt.Errorf("can't use validate with schema-only or export-dir"))
+	}
+	if schemaOnly && exportDir != "" {
+		panic(fmt.Errorf("can't use both schema-only and export-dir at once"))
+	}
+	if cdc != "" && (schemaOnly || diffData || exportDir != "") {
+		panic(fmt.Errorf("can't use cdc with schema-only, diff or export-dir"))
+	}
+	if cdc != "" {
+		if d, err := source.Get(driverName); err == nil {
+			if _, ok := d.(source.ChangeStreamer); !ok {
+				panic(fmt.Errorf("driver %s does not support cdc", driverName))
+			}
+		}
+	}
+	if resume && dbNameOverride == "" {
+		panic(fmt.Errorf("when using resume mode, dbname must specify the database to resume migrating to"))
+	}
+	if resume && (schemaOnly || exportDir != "") {
+		panic(fmt.Errorf("can't use resume with schema-only or export-dir"))
+	}
+	switch ddl.Dialect(targetDialect) {
+	case "", ddl.GoogleSQL, ddl.PostgreSQL:
+	default:
+		panic(fmt.Errorf("unsupported target-dialect %q", targetDialect))
+	}
+	if readWorkers < 1 {
+		panic(fmt.Errorf("read-workers must be at least 1"))
+	}
+	if chunkRows < 0 {
+		panic(fmt.Errorf("chunk-rows can't be negative"))
+	}
+	switch spanner.WriteMode(writeMode) {
+	case spanner.Insert, spanner.InsertOrUpdate, spanner.Replace:
+	default:
+		panic(fmt.Errorf("unsupported write-mode %q", writeMode))
+	}
+	switch exportFormat {
+	case "avro", "csv", "jsonl":
+	default:
+		panic(fmt.Errorf("unsupported export-format %q", exportFormat))
+	}
 
 	input := loadInput(dumpFilePath)
 	ioHelper := &conversion.IOStreams{In: input, Out: os.Stdout}
 	fmt.Println("Using driver (source DB):", driverName)
 
 	var project, instance string
-	if !schemaOnly {
+	if !schemaOnly && exportDir == "" {
 		project, err = conversion.GetProject()
 		if err != nil {
 			fmt.Printf("\nCan't get project: %v\n", err)
@@ -140,9 +210,35 @@ func main() {
 		filePrefix = dbName + "."
 	}
 
-	// TODO (agasheesh@): Collect all the config state in a single struct and pass the same to CommandLine instead of
-	// passing multiple parameters. Config state would be populated by parsing the flags and environment variables.
-	err = cmd.CommandLine(driverName, project, instance, dbName, dataOnly, schemaOnly, skipForeignKeys, schemaSampleSize, sessionJSON, ioHelper, filePrefix, now)
+	config := cmd.Config{
+		Driver:           driverName,
+		ProjectID:        project,
+		InstanceID:       instance,
+		DBName:           dbName,
+		DataOnly:         dataOnly,
+		SchemaOnly:       schemaOnly,
+		SkipForeignKeys:  skipForeignKeys,
+		Resume:           resume,
+		ValidateData:     validateData,
+		SchemaSampleSize: schemaSampleSize,
+		ReadWorkers:      readWorkers,
+		ChunkRows:        chunkRows,
+		SessionJSON:      sessionJSON,
+		ExportDir:        exportDir,
+		ExportFormat:     exportFormat,
+		Dialect:          targetDialect,
+		WriteMode:        writeMode,
+		CDC:              cdc,
+		OutputFilePrefix: filePrefix,
+	}
+	if diffData {
+		if err := cmd.Diff(config, ioHelper); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	err = cmd.CommandLine(config, ioHelper, now)
 	if err != nil {
 		panic(err)
 	}
@@ -162,3 +258,12 @@ func loadInput(dumpFile string) *os.File {
 	}
 	return os.Stdin
 }
+
+// quoteList returns l as a comma-separated list of quoted strings.
+func quoteList(l []string) string {
+	var q []string
+	for _, s := range l {
+		q = append(q, fmt.Sprintf("%q", s))
+	}
+	return strings.Join(q, ", ")
+}
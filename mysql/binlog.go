@@ -0,0 +1,621 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This file implements a reader for MySQL binary log files (format v4,
+// as written by MySQL 5.6 and later), as needed for change data capture:
+// it decodes table maps and row events, and skips other events. See
+// https://dev.mysql.com/doc/internals/en/binary-log.html for the format.
+
+// Binlog event types.
+const (
+	queryEvent             = 2
+	stopEvent              = 3
+	rotateEvent            = 4
+	formatDescriptionEvent = 15
+	xidEvent               = 16
+	tableMapEvent          = 19
+	writeRowsEventV1       = 23
+	updateRowsEventV1      = 24
+	deleteRowsEventV1      = 25
+	writeRowsEventV2       = 30
+	updateRowsEventV2      = 31
+	deleteRowsEventV2      = 32
+)
+
+const (
+	binlogMagic        = "\xfebin"
+	eventHeaderLen     = 19
+	checksumAlgCRC32   = 1
+	binlogPollInterval = time.Second // How often to check for new events when following.
+)
+
+// binlogPosition is a position in a sequence of binlog files.
+type binlogPosition struct {
+	file string // Base name of the binlog file.
+	pos  uint32 // Offset in file.
+}
+
+// parseBinlogPosition parses a position of the form "file:offset", as
+// returned by binlogPosition.String.
+func parseBinlogPosition(s string) (binlogPosition, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return binlogPosition{}, fmt.Errorf("invalid binlog position %q: want file:offset", s)
+	}
+	n, err := strconv.ParseUint(s[i+1:], 10, 32)
+	if err != nil {
+		return binlogPosition{}, fmt.Errorf("invalid binlog position %q: %w", s, err)
+	}
+	return binlogPosition{file: s[:i], pos: uint32(n)}, nil
+}
+
+func (p binlogPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.file, p.pos)
+}
+
+// binlogEvent is an event read from a binlog file.
+type binlogEvent struct {
+	typ  byte
+	time time.Time      // Time the event was written (for row events, the time of the statement).
+	next binlogPosition // Position of the next event.
+	data []byte         // Event body (after the header, without checksum).
+}
+
+// binlogReader reads events from the binlog files in a directory,
+// starting at a given position, and moving on to the next file (in
+// name order) when a file ends with a rotate or stop event. If follow
+// is set, the reader waits for more events at the end of the last file
+// (as files are appended to, e.g. by mysqlbinlog --stop-never);
+// otherwise it returns io.EOF.
+type binlogReader struct {
+	dir    string
+	follow bool
+	f      *os.File
+	pos    binlogPosition
+	fde    formatDescription
+	tables map[uint64]*tableMap // Table maps, by table id.
+}
+
+// formatDescription holds the parts of a format description event
+// needed to decode other events.
+type formatDescription struct {
+	postHeaderLens []byte // Post-header length of each event type (indexed by type-1).
+	checksum       bool   // Whether events end with a CRC32 checksum.
+}
+
+func newBinlogReader(dir string, start binlogPosition, follow bool) (*binlogReader, error) {
+	r := &binlogReader{dir: dir, follow: follow, tables: make(map[uint64]*tableMap)}
+	if err := r.open(start); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the binlog file of p and positions the reader at p. The
+// format description event at the start of the file is read first.
+func (r *binlogReader) open(p binlogPosition) error {
+	if r.f != nil {
+		r.f.Close()
+	}
+	f, err := os.Open(filepath.Join(r.dir, p.file))
+	if err != nil {
+		return err
+	}
+	r.f = f
+	r.pos = binlogPosition{file: p.file}
+	magic := make([]byte, len(binlogMagic))
+	if err := r.readFull(magic); err != nil {
+		return err
+	}
+	if string(magic) != binlogMagic {
+		return fmt.Errorf("%s is not a binlog file", p.file)
+	}
+	e, err := r.readEvent()
+	if err != nil {
+		return err
+	}
+	if e.typ != formatDescriptionEvent {
+		return fmt.Errorf("binlog file %s doesn't start with a format description event", p.file)
+	}
+	if p.pos > r.pos.pos {
+		if _, err := r.f.Seek(int64(p.pos), io.SeekStart); err != nil {
+			return err
+		}
+		r.pos.pos = p.pos
+	}
+	return nil
+}
+
+func (r *binlogReader) close() {
+	if r.f != nil {
+		r.f.Close()
+	}
+}
+
+// readFull reads len(b) bytes from the current file. At the end of the
+// file, it waits for more data if r.follow is set.
+func (r *binlogReader) readFull(b []byte) error {
+	n := 0
+	for n < len(b) {
+		m, err := r.f.Read(b[n:])
+		n += m
+		if err == io.EOF && r.follow {
+			time.Sleep(binlogPollInterval)
+			continue
+		}
+		if err == io.EOF && n > 0 {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+	r.pos.pos += uint32(n)
+	return nil
+}
+
+// next returns the next event, moving on to the next binlog file as
+// needed. Format description, rotate and stop events are handled by
+// next and not returned.
+func (r *binlogReader) next() (binlogEvent, error) {
+	for {
+		e, err := r.readEvent()
+		if err != nil {
+			return e, err
+		}
+		switch e.typ {
+		case rotateEvent:
+			// Post-header: position in the next file (8 bytes).
+			if len(e.data) < 8 {
+				return e, fmt.Errorf("bad rotate event at %s", r.pos)
+			}
+			p := binlogPosition{file: string(e.data[8:]), pos: uint32(binary.LittleEndian.Uint64(e.data))}
+			if p.file == r.pos.file {
+				// A fake rotate event (sent at the start of a stream).
+				continue
+			}
+			if err := r.open(p); err != nil {
+				return e, err
+			}
+		case stopEvent:
+			// The server stopped; the next file starts after a restart.
+			f, err := r.nextFile()
+			if err != nil {
+				return e, err
+			}
+			if err := r.open(binlogPosition{file: f}); err != nil {
+				return e, err
+			}
+		case formatDescriptionEvent:
+		default:
+			return e, nil
+		}
+	}
+}
+
+// nextFile returns the name of the binlog file after the current one
+// (waiting for it to appear if r.follow is set).
+func (r *binlogReader) nextFile() (string, error) {
+	for {
+		names, err := filepath.Glob(filepath.Join(r.dir, "*"))
+		if err != nil {
+			return "", err
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			b := filepath.Base(n)
+			if b > r.pos.file && binlogBaseName(b) == binlogBaseName(r.pos.file) {
+				return b, nil
+			}
+		}
+		if !r.follow {
+			return "", io.EOF
+		}
+		time.Sleep(binlogPollInterval)
+	}
+}
+
+// binlogBaseName returns the base name of a binlog file name i.e. the
+// name without its sequence number (such as "mysql-bin." for
+// "mysql-bin.000042").
+func binlogBaseName(file string) string {
+	return strings.TrimRight(file, "0123456789")
+}
+
+// readEvent reads the event at the current position. Table map events
+// are recorded in r.tables.
+func (r *binlogReader) readEvent() (binlogEvent, error) {
+	start := r.pos
+	header := make([]byte, eventHeaderLen)
+	if err := r.readFull(header); err != nil {
+		return binlogEvent{}, err
+	}
+	typ := header[4]
+	size := binary.LittleEndian.Uint32(header[9:])
+	if size < eventHeaderLen {
+		return binlogEvent{}, fmt.Errorf("bad event size %d at %s", size, start)
+	}
+	body := make([]byte, size-eventHeaderLen)
+	if err := r.readFull(body); err != nil {
+		return binlogEvent{}, err
+	}
+	e := binlogEvent{typ: typ, time: time.Unix(int64(binary.LittleEndian.Uint32(header)), 0), next: r.pos}
+	if typ == formatDescriptionEvent {
+		fde, err := parseFormatDescription(body)
+		if err != nil {
+			return e, fmt.Errorf("bad format description event at %s: %w", start, err)
+		}
+		r.fde = fde
+	}
+	if r.fde.checksum {
+		if len(body) < 4 {
+			return e, fmt.Errorf("event at %s is too short for its checksum", start)
+		}
+		n := len(body) - 4
+		sum := crc32.ChecksumIEEE(append(append([]byte{}, header...), body[:n]...))
+		if sum != binary.LittleEndian.Uint32(body[n:]) {
+			return e, fmt.Errorf("bad checksum for event at %s", start)
+		}
+		body = body[:n]
+	}
+	e.data = body
+	if typ == tableMapEvent {
+		tm, err := r.parseTableMap(body)
+		if err != nil {
+			return e, fmt.Errorf("bad table map event at %s: %w", start, err)
+		}
+		r.tables[tm.id] = tm
+	}
+	return e, nil
+}
+
+// parseFormatDescription parses the body of a format description event.
+func parseFormatDescription(b []byte) (formatDescription, error) {
+	// binlog-version (2), server-version (50), create-timestamp (4),
+	// event-header-length (1), post-header lengths, checksum algorithm
+	// (1) and checksum (4).
+	const fixed = 2 + 50 + 4 + 1
+	if len(b) < fixed+5 {
+		return formatDescription{}, fmt.Errorf("event too short")
+	}
+	if v := binary.LittleEndian.Uint16(b); v != 4 {
+		return formatDescription{}, fmt.Errorf("unsupported binlog version %d", v)
+	}
+	if b[fixed-1] != eventHeaderLen {
+		return formatDescription{}, fmt.Errorf("unsupported event header length %d", b[fixed-1])
+	}
+	alg := b[len(b)-5]
+	return formatDescription{
+		postHeaderLens: b[fixed : len(b)-5],
+		checksum:       alg == checksumAlgCRC32,
+	}, nil
+}
+
+// postHeaderLen returns the post-header length of events of type typ.
+func (r *binlogReader) postHeaderLen(typ byte) int {
+	if int(typ) > len(r.fde.postHeaderLens) || typ == 0 {
+		return 0
+	}
+	return int(r.fde.postHeaderLens[typ-1])
+}
+
+// tableMap describes a table referenced by row events.
+type tableMap struct {
+	id       uint64
+	schema   string
+	table    string
+	types    []byte   // Column types.
+	meta     []uint16 // Column metadata.
+	unsigned []bool   // Whether each column is unsigned (from optional metadata, if present).
+	names    []string // Column names (from optional metadata, if present).
+	enums    [][]string
+	sets     [][]string
+}
+
+// Optional metadata field types of table map events (MySQL 8.0).
+const (
+	tableMapSignedness = 1
+	tableMapColumnName = 4
+	tableMapSetValues  = 5
+	tableMapEnumValues = 6
+)
+
+func (r *binlogReader) parseTableMap(b []byte) (*tableMap, error) {
+	d := &decoder{b: b}
+	tm := &tableMap{}
+	tm.id = d.tableID(r.postHeaderLen(tableMapEvent))
+	d.skip(2) // Flags.
+	tm.schema = string(d.bytes(int(d.u8())))
+	d.skip(1)
+	tm.table = string(d.bytes(int(d.u8())))
+	d.skip(1)
+	n := int(d.lenenc())
+	tm.types = d.bytes(n)
+	metaBlock := &decoder{b: d.bytes(int(d.lenenc()))}
+	d.skip((n + 7) / 8) // Nullable columns.
+	if d.err != nil {
+		return nil, d.err
+	}
+	for _, t := range tm.types {
+		var m uint16
+		switch t {
+		case typeFloat, typeDouble, typeBlob, typeGeometry, typeJSON, typeTimestamp2, typeDatetime2, typeTime2,
+			typeTinyBlob, typeMediumBlob, typeLongBlob:
+			m = uint16(metaBlock.u8())
+		case typeVarchar, typeVarString, typeBit:
+			m = metaBlock.u16()
+		case typeString, typeNewDecimal, typeEnum, typeSet:
+			// Big endian: real type (or precision), then length (or scale).
+			m = uint16(metaBlock.u8())<<8 | uint16(metaBlock.u8())
+		}
+		tm.meta = append(tm.meta, m)
+	}
+	if metaBlock.err != nil {
+		return nil, metaBlock.err
+	}
+	// Optional metadata (binlog_row_metadata, MySQL 8.0.1 and later).
+	for d.err == nil && d.remaining() > 0 {
+		typ := d.u8()
+		f := &decoder{b: d.bytes(int(d.lenenc()))}
+		switch typ {
+		case tableMapSignedness:
+			bits := f.bytes(f.remaining())
+			i := 0
+			for c, t := range tm.types {
+				if tm.unsigned == nil {
+					tm.unsigned = make([]bool, n)
+				}
+				if isNumericColumn(t) {
+					tm.unsigned[c] = i/8 < len(bits) && bits[i/8]&(0x80>>(uint(i)%8)) != 0
+					i++
+				}
+			}
+		case tableMapColumnName:
+			for f.err == nil && f.remaining() > 0 {
+				tm.names = append(tm.names, string(f.bytes(int(f.lenenc()))))
+			}
+		case tableMapEnumValues:
+			tm.enums = parseStrValues(f)
+		case tableMapSetValues:
+			tm.sets = parseStrValues(f)
+		}
+		if f.err != nil {
+			return nil, f.err
+		}
+	}
+	return tm, d.err
+}
+
+// parseStrValues parses the values of the enum or set columns of a
+// table, from the optional metadata of a table map event.
+func parseStrValues(d *decoder) [][]string {
+	var l [][]string
+	for d.err == nil && d.remaining() > 0 {
+		n := int(d.lenenc())
+		var vals []string
+		for i := 0; i < n; i++ {
+			vals = append(vals, string(d.bytes(int(d.lenenc()))))
+		}
+		l = append(l, vals)
+	}
+	return l
+}
+
+// rowsEvent is a decoded write, update or delete rows event. Each row
+// has the text form of each column's value (as returned by the MySQL
+// text protocol), or nil for NULL values. For updates, before holds the
+// rows before the change and rows holds the rows after it; for deletes,
+// before holds the deleted rows.
+type rowsEvent struct {
+	typ    byte // One of writeRowsEventV2, updateRowsEventV2 or deleteRowsEventV2.
+	table  *tableMap
+	before [][]*string
+	rows   [][]*string
+}
+
+// parseRows decodes the rows event e.
+func (r *binlogReader) parseRows(e binlogEvent) (*rowsEvent, error) {
+	d := &decoder{b: e.data}
+	id := d.tableID(r.postHeaderLen(e.typ))
+	d.skip(2) // Flags.
+	typ := e.typ
+	switch typ {
+	case writeRowsEventV1:
+		typ = writeRowsEventV2
+	case updateRowsEventV1:
+		typ = updateRowsEventV2
+	case deleteRowsEventV1:
+		typ = deleteRowsEventV2
+	default:
+		// Version 2 events have extra data, whose length includes the
+		// length field itself.
+		d.skip(int(d.u16()) - 2)
+	}
+	tm, ok := r.tables[id]
+	if !ok {
+		return nil, fmt.Errorf("rows event for unknown table id %d", id)
+	}
+	n := int(d.lenenc())
+	if n != len(tm.types) {
+		return nil, fmt.Errorf("rows event for table %s has %d columns, but its table map has %d", tm.table, n, len(tm.types))
+	}
+	present := d.bytes((n + 7) / 8)
+	presentAfter := present
+	if typ == updateRowsEventV2 {
+		presentAfter = d.bytes((n + 7) / 8)
+	}
+	ev := &rowsEvent{typ: typ, table: tm}
+	for d.err == nil && d.remaining() > 0 {
+		row, err := d.row(tm, present)
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case writeRowsEventV2:
+			ev.rows = append(ev.rows, row)
+		case deleteRowsEventV2:
+			ev.before = append(ev.before, row)
+		case updateRowsEventV2:
+			after, err := d.row(tm, presentAfter)
+			if err != nil {
+				return nil, err
+			}
+			ev.before = append(ev.before, row)
+			ev.rows = append(ev.rows, after)
+		}
+	}
+	return ev, d.err
+}
+
+// row decodes a row image: a bitmap of NULL values (one bit for each
+// present column), followed by the values of present, non-NULL columns.
+// Columns that aren't present (e.g. with binlog_row_image=MINIMAL) are
+// returned as NULL.
+func (d *decoder) row(tm *tableMap, present []byte) ([]*string, error) {
+	isSet := func(bitmap []byte, i int) bool { return bitmap[i/8]&(1<<(uint(i)%8)) != 0 }
+	count := 0
+	for i := range tm.types {
+		if isSet(present, i) {
+			count++
+		}
+	}
+	nulls := d.bytes((count + 7) / 8)
+	if d.err != nil {
+		return nil, d.err
+	}
+	row := make([]*string, len(tm.types))
+	j := 0
+	for i := range tm.types {
+		if !isSet(present, i) {
+			continue
+		}
+		null := isSet(nulls, j)
+		j++
+		if null {
+			continue
+		}
+		s, err := d.value(tm, i)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode column %d of table %s: %w", i, tm.table, err)
+		}
+		row[i] = &s
+	}
+	return row, nil
+}
+
+// decoder decodes little-endian binlog data. Errors are sticky: after
+// an error, methods return zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) remaining() int {
+	return len(d.b)
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) skip(n int) {
+	d.bytes(n)
+}
+
+func (d *decoder) u8() uint8 {
+	b := d.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) u16() uint16 {
+	return uint16(d.uint(2))
+}
+
+// uint decodes an n-byte little-endian unsigned integer.
+func (d *decoder) uint(n int) uint64 {
+	var v uint64
+	for i, c := range d.bytes(n) {
+		v |= uint64(c) << (8 * uint(i))
+	}
+	return v
+}
+
+// tableID decodes a table id, which is 6 bytes long unless the
+// post-header length of the event is 6 (in which case it's 4 bytes).
+func (d *decoder) tableID(postHeaderLen int) uint64 {
+	if postHeaderLen == 6 {
+		return d.uint(4)
+	}
+	return d.uint(6)
+}
+
+// lenenc decodes a length-encoded integer.
+func (d *decoder) lenenc() uint64 {
+	switch c := d.u8(); c {
+	case 0xfc:
+		return d.uint(2)
+	case 0xfd:
+		return d.uint(3)
+	case 0xfe:
+		return d.uint(8)
+	default:
+		return uint64(c)
+	}
+}
+
+// bigEndian decodes an n-byte big-endian unsigned integer from b.
+func bigEndian(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// isNumericColumn reports whether columns of type t have a bit in the
+// signedness metadata of table map events.
+func isNumericColumn(t byte) bool {
+	switch t {
+	case typeTiny, typeShort, typeInt24, typeLong, typeLongLong, typeFloat, typeDouble, typeNewDecimal:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,348 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// binlogFile builds a binlog file, with events checksummed with CRC32.
+type binlogFile struct {
+	buf bytes.Buffer
+	ts  uint32 // Timestamp of events.
+}
+
+func newBinlogFile() *binlogFile {
+	f := &binlogFile{}
+	f.buf.WriteString(binlogMagic)
+	lens := make([]byte, deleteRowsEventV2)
+	lens[queryEvent-1] = 13
+	lens[rotateEvent-1] = 8
+	lens[tableMapEvent-1] = 8
+	for _, t := range []byte{writeRowsEventV2, updateRowsEventV2, deleteRowsEventV2} {
+		lens[t-1] = 10
+	}
+	body := []byte{4, 0} // Binlog version.
+	body = append(body, make([]byte, 50+4)...)
+	body = append(body, eventHeaderLen)
+	body = append(body, lens...)
+	body = append(body, checksumAlgCRC32)
+	f.event(formatDescriptionEvent, body)
+	return f
+}
+
+func (f *binlogFile) event(typ byte, body []byte) {
+	header := make([]byte, eventHeaderLen)
+	binary.LittleEndian.PutUint32(header, f.ts)
+	header[4] = typ
+	size := eventHeaderLen + len(body) + 4
+	binary.LittleEndian.PutUint32(header[9:], uint32(size))
+	binary.LittleEndian.PutUint32(header[13:], uint32(f.buf.Len()+size))
+	e := append(header, body...)
+	f.buf.Write(e)
+	binary.Write(&f.buf, binary.LittleEndian, crc32.ChecksumIEEE(e))
+}
+
+func (f *binlogFile) query(db, q string) {
+	body := make([]byte, 13)
+	body[8] = byte(len(db))
+	body = append(body, db...)
+	body = append(body, 0)
+	f.event(queryEvent, append(body, q...))
+}
+
+func (f *binlogFile) xid() {
+	f.event(xidEvent, make([]byte, 8))
+}
+
+func (f *binlogFile) rotate(next string) {
+	body := []byte{4, 0, 0, 0, 0, 0, 0, 0}
+	f.event(rotateEvent, append(body, next...))
+}
+
+// tableMap writes a table map event for table id 1, with columns id
+// (INT UNSIGNED), name (VARCHAR(20)) and n (DECIMAL(5, 2)).
+func (f *binlogFile) tableMap(db, table string) {
+	body := []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	body = append(body, byte(len(db)))
+	body = append(body, db...)
+	body = append(body, 0, byte(len(table)))
+	body = append(body, table...)
+	body = append(body, 0, 3, typeLong, typeVarchar, typeNewDecimal)
+	body = append(body, 4, 80, 0, 5, 2) // Metadata.
+	body = append(body, 0x06)           // Nullable columns.
+	body = append(body, tableMapSignedness, 1, 0x80)
+	body = append(body, tableMapColumnName, 10, 2, 'i', 'd', 4, 'n', 'a', 'm', 'e', 1, 'n')
+	f.event(tableMapEvent, body)
+}
+
+// rows writes a rows event of type typ for table id 1, with row images
+// rows (each the encoded null bitmap and values of all 3 columns).
+func (f *binlogFile) rows(typ byte, rows ...[]byte) {
+	body := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 3, 0x07}
+	if typ == updateRowsEventV2 {
+		body = append(body, 0x07)
+	}
+	for _, r := range rows {
+		body = append(body, r...)
+	}
+	f.event(typ, body)
+}
+
+// row encodes a row image of the table of tableMap. name and n are
+// omitted if nil.
+func row(id uint32, name *string, n []byte) []byte {
+	var nulls byte
+	if name == nil {
+		nulls |= 2
+	}
+	if n == nil {
+		nulls |= 4
+	}
+	b := []byte{nulls}
+	b = append(b, byte(id), byte(id>>8), byte(id>>16), byte(id>>24))
+	if name != nil {
+		b = append(b, byte(len(*name)))
+		b = append(b, *name...)
+	}
+	return append(b, n...)
+}
+
+func str(s string) *string { return &s }
+
+func cdcConv() *internal.Conv {
+	return buildConv(
+		ddl.CreateTable{
+			Name:     "t",
+			ColNames: []string{"id", "name", "n"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"id":   {Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"name": {Name: "name", T: ddl.Type{Name: ddl.String, Len: 20}},
+				"n":    {Name: "n", T: ddl.Type{Name: ddl.Numeric}},
+			},
+			Pks: []ddl.IndexKey{{Col: "id"}},
+		},
+		schema.Table{
+			Name:     "t",
+			ColNames: []string{"id", "name", "n"},
+			ColDefs: map[string]schema.Column{
+				"id":   {Name: "id", Type: schema.Type{Name: "int"}},
+				"name": {Name: "name", Type: schema.Type{Name: "varchar"}},
+				"n":    {Name: "n", Type: schema.Type{Name: "decimal"}},
+			},
+		})
+}
+
+type appliedTxn struct {
+	ms  []*sp.Mutation
+	pos string
+}
+
+func TestStreamChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	f1 := newBinlogFile()
+	f1.ts = 1600000000
+	start := f1.buf.Len()
+	f1.query("db", "BEGIN")
+	f1.tableMap("db", "t")
+	// 123.45 and -1.50 as DECIMAL(5, 2).
+	f1.rows(writeRowsEventV2, row(1, str("a"), []byte{0x80, 0x7b, 0x2d}), row(2, nil, []byte{0x7f, 0xfe, 0xcd}))
+	f1.xid()
+	pos1 := f1.buf.Len()
+	f1.query("db", "BEGIN")
+	f1.tableMap("db", "t")
+	f1.rows(updateRowsEventV2, row(1, str("a"), nil), row(1, nil, nil), row(2, nil, nil), row(3, str("c"), nil))
+	f1.xid()
+	pos2 := f1.buf.Len()
+	f1.query("db", "ALTER TABLE t ADD COLUMN x INT")
+	f1.rotate("mysql-bin.000002")
+	f2 := newBinlogFile()
+	f2.query("db", "BEGIN")
+	f2.tableMap("db", "t")
+	f2.rows(deleteRowsEventV2, row(3, str("c"), nil))
+	f2.xid()
+	pos3 := f2.buf.Len()
+	// Changes to other databases are skipped.
+	f2.query("other", "BEGIN")
+	f2.tableMap("other", "t")
+	f2.rows(deleteRowsEventV2, row(1, nil, nil))
+	f2.xid()
+	// Changes of incomplete transactions are dropped.
+	f2.query("db", "BEGIN")
+	f2.tableMap("db", "t")
+	f2.rows(writeRowsEventV2, row(4, nil, nil))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "mysql-bin.000001"), f1.buf.Bytes(), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "mysql-bin.000002"), f2.buf.Bytes(), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "mysql-bin.index"), []byte("mysql-bin.000001\nmysql-bin.000002\n"), 0644))
+
+	conv := cdcConv()
+	var got []appliedTxn
+	var commits []time.Time
+	apply := func(ms []*sp.Mutation, pos string, commitTime time.Time) error {
+		got = append(got, appliedTxn{ms, pos})
+		commits = append(commits, commitTime)
+		return nil
+	}
+	cols := []string{"id", "name", "n"}
+	err = StreamChanges(conv, "db", dir, binlogPosition{"mysql-bin.000001", uint32(start)}.String(), false, apply)
+	assert.Nil(t, err)
+	assert.Equal(t, []appliedTxn{
+		{[]*sp.Mutation{
+			sp.InsertOrUpdate("t", cols, []interface{}{int64(1), "a", "123.450000000"}),
+			sp.InsertOrUpdate("t", []string{"id", "n", "name"}, []interface{}{int64(2), "-1.500000000", nil}),
+		}, binlogPosition{"mysql-bin.000001", uint32(pos1)}.String()},
+		{[]*sp.Mutation{
+			sp.InsertOrUpdate("t", []string{"id", "name", "n"}, []interface{}{int64(1), nil, nil}),
+			// Changing the primary key deletes the old row.
+			sp.Delete("t", sp.Key{int64(2)}),
+			sp.InsertOrUpdate("t", []string{"id", "name", "n"}, []interface{}{int64(3), "c", nil}),
+		}, binlogPosition{"mysql-bin.000001", uint32(pos2)}.String()},
+		{[]*sp.Mutation{
+			sp.Delete("t", sp.Key{int64(3)}),
+		}, binlogPosition{"mysql-bin.000002", uint32(pos3)}.String()},
+	}, got)
+	assert.Equal(t, int64(1), conv.Unexpecteds()) // The ALTER TABLE statement.
+	assert.Equal(t, time.Unix(1600000000, 0), commits[0])
+	assert.Equal(t, time.Unix(0, 0), commits[2])
+	c := conv.Stats.Changes["t"]
+	assert.Equal(t, []int64{2, 2, 1, 0}, []int64{c.Insert, c.Update, c.Delete, c.Error})
+
+	// Streaming can restart from any position passed to apply.
+	got = nil
+	err = StreamChanges(cdcConv(), "db", dir, binlogPosition{"mysql-bin.000001", uint32(pos2)}.String(), false, apply)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, binlogPosition{"mysql-bin.000002", uint32(pos3)}.String(), got[0].pos)
+}
+
+func TestStreamChanges_BadChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	f := newBinlogFile()
+	f.query("db", "BEGIN")
+	b := f.buf.Bytes()
+	b[len(b)-1] ^= 0xff
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "mysql-bin.000001"), b, 0644))
+	err = StreamChanges(cdcConv(), "db", dir, "mysql-bin.000001:4", false, func([]*sp.Mutation, string, time.Time) error { return nil })
+	assert.Contains(t, err.Error(), "bad checksum")
+}
+
+func TestBinlogValues(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  byte
+		meta uint16
+		data []byte
+		want string
+	}{
+		{"tinyint", typeTiny, 0, []byte{0xff}, "-1"},
+		{"bigint", typeLongLong, 0, []byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "-2"},
+		{"float", typeFloat, 4, []byte{0x00, 0x00, 0xc0, 0x3f}, "1.5"},
+		{"double", typeDouble, 8, []byte{0x9a, 0x99, 0x99, 0x99, 0x99, 0x99, 0xb9, 0x3f}, "0.1"},
+		{"decimal", typeNewDecimal, 20<<8 | 10, []byte{0x80, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00}, "1.0000000020"},
+		{"negative decimal", typeNewDecimal, 5<<8 | 2, []byte{0x7f, 0xfe, 0xcd}, "-1.50"},
+		{"year", typeYear, 0, []byte{121}, "2021"},
+		{"date", typeDate, 0, []byte{0x4f, 0xca, 0x0f}, "2021-02-15"},
+		{"datetime(3)", typeDatetime2, 3, []byte{0x99, 0xa8, 0xde, 0xa6, 0x2b, 0x04, 0xce}, "2021-02-15 10:24:43.123"},
+		{"timestamp", typeTimestamp2, 0, []byte{0x60, 0x2a, 0x4b, 0xeb}, "2021-02-15 10:24:43"},
+		{"time", typeTime2, 0, []byte{0x80, 0xa6, 0x2b}, "10:24:43"},
+		{"negative time(2)", typeTime2, 2, []byte{0x7f, 0xff, 0xff, 0xce}, "-00:00:00.50"},
+		{"bit", typeBit, 1<<8 | 2, []byte{0x01, 0x02}, "\x01\x02"},
+		{"blob", typeBlob, 2, []byte{0x03, 0x00, 'a', 'b', 'c'}, "abc"},
+		{"char", typeString, typeString<<8 | 10, []byte{0x02, 'h', 'i'}, "hi"},
+		{"json", typeJSON, 4, jsonDoc(), `{"a": [1, 2.5, "x", true], "b": null}`},
+	}
+	for _, tc := range tests {
+		tm := &tableMap{table: "t", types: []byte{tc.typ}, meta: []uint16{tc.meta}}
+		d := &decoder{b: tc.data}
+		s, err := d.value(tm, 0)
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, tc.want, s, tc.name)
+		assert.Equal(t, 0, d.remaining(), tc.name)
+	}
+}
+
+func TestBinlogEnumAndSet(t *testing.T) {
+	tm := &tableMap{
+		table: "t",
+		types: []byte{typeString, typeString},
+		meta:  []uint16{typeEnum<<8 | 1, typeSet<<8 | 1},
+		enums: [][]string{{"red", "green"}},
+		sets:  [][]string{{"a", "b", "c"}},
+	}
+	d := &decoder{b: []byte{2, 5}}
+	s, err := d.value(tm, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "green", s)
+	s, err = d.value(tm, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "a,c", s)
+
+	// Values of enum and set columns are only logged with
+	// binlog_row_metadata=FULL.
+	tm.enums = nil
+	_, err = (&decoder{b: []byte{1}}).value(tm, 0)
+	assert.NotNil(t, err)
+}
+
+// jsonDoc returns the binary JSON value {"a": [1, 2.5, "x", true], "b": null}
+// prefixed by its length (4 bytes).
+func jsonDoc() []byte {
+	arr := []byte{
+		4, 0, 0, 0, // Element count and size (patched below).
+		jsonInt16, 1, 0,
+		jsonDouble, 0, 0,
+		jsonString, 0, 0,
+		jsonLiteral, 1, 0,
+	}
+	arr[8] = byte(len(arr))
+	arr = append(arr, 0, 0, 0, 0, 0, 0, 0x04, 0x40) // 2.5
+	arr[11] = byte(len(arr))
+	arr = append(arr, 1, 'x')
+	arr[2] = byte(len(arr))
+	obj := []byte{
+		2, 0, 0, 0, // Element count and size (patched below).
+		0, 0, 1, 0, // Key "a" (offset patched below).
+		0, 0, 1, 0, // Key "b".
+		jsonSmallArray, 0, 0,
+		jsonLiteral, 0, 0,
+	}
+	obj[4] = byte(len(obj))
+	obj[8] = byte(len(obj) + 1)
+	obj = append(obj, 'a', 'b')
+	obj[13] = byte(len(obj))
+	obj = append(obj, arr...)
+	obj[2] = byte(len(obj))
+	doc := append([]byte{jsonSmallObject}, obj...)
+	return append([]byte{byte(len(doc)), 0, 0, 0}, doc...)
+}
@@ -0,0 +1,574 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MySQL column types, as used in binlog table map events.
+const (
+	typeDecimal    = 0
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDatetime   = 12
+	typeYear       = 13
+	typeNewDate    = 14
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDatetime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeTinyBlob   = 249
+	typeMediumBlob = 250
+	typeLongBlob   = 251
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// value decodes the value of column i of table tm, and returns it in
+// the text form the MySQL text protocol uses, so that it can be
+// converted with ConvertData just like values read by ProcessSQLData.
+// TIMESTAMP values are returned in UTC.
+func (d *decoder) value(tm *tableMap, i int) (string, error) {
+	meta := tm.meta[i]
+	unsigned := tm.unsigned != nil && tm.unsigned[i]
+	var s string
+	switch t := tm.types[i]; t {
+	case typeTiny, typeShort, typeInt24, typeLong, typeLongLong:
+		size := map[byte]int{typeTiny: 1, typeShort: 2, typeInt24: 3, typeLong: 4, typeLongLong: 8}[t]
+		v := d.uint(size)
+		if unsigned {
+			s = strconv.FormatUint(v, 10)
+		} else {
+			// Sign-extend.
+			shift := uint(64 - 8*size)
+			s = strconv.FormatInt(int64(v<<shift)>>shift, 10)
+		}
+	case typeFloat:
+		s = strconv.FormatFloat(float64(math.Float32frombits(uint32(d.uint(4)))), 'g', -1, 32)
+	case typeDouble:
+		s = strconv.FormatFloat(math.Float64frombits(d.uint(8)), 'g', -1, 64)
+	case typeNewDecimal:
+		s = d.decimal(int(meta>>8), int(meta&0xff))
+	case typeYear:
+		if y := d.u8(); y == 0 {
+			s = "0000"
+		} else {
+			s = strconv.Itoa(1900 + int(y))
+		}
+	case typeDate, typeNewDate:
+		v := d.uint(3)
+		s = fmt.Sprintf("%04d-%02d-%02d", v>>9, (v>>5)&0xf, v&0x1f)
+	case typeTime:
+		v := int64(d.uint(3))
+		if v&0x800000 != 0 {
+			v -= 0x1000000 // Sign-extend.
+		}
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		s = fmt.Sprintf("%s%02d:%02d:%02d", sign, v/10000, (v/100)%100, v%100)
+	case typeTime2:
+		s = d.time2(int(meta))
+	case typeDatetime:
+		v := d.uint(8)
+		date, tod := v/1000000, v%1000000
+		s = fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", date/10000, (date/100)%100, date%100, tod/10000, (tod/100)%100, tod%100)
+	case typeDatetime2:
+		s = d.datetime2(int(meta))
+	case typeTimestamp:
+		s = formatTimestamp(int64(d.uint(4)), 0, 0)
+	case typeTimestamp2:
+		sec := int64(bigEndian(d.bytes(4)))
+		s = formatTimestamp(sec, d.fraction(int(meta)), int(meta))
+	case typeBit:
+		nbits := int(meta>>8)*8 + int(meta&0xff)
+		// BIT values are returned as big-endian bytes.
+		s = string(d.bytes((nbits + 7) / 8))
+	case typeVarchar, typeVarString:
+		n := int(d.u8())
+		if meta >= 256 {
+			n |= int(d.u8()) << 8
+		}
+		s = string(d.bytes(n))
+	case typeString:
+		rt, size := byte(meta>>8), int(meta&0xff)
+		if rt&0x30 != 0x30 {
+			// The length of CHAR columns of more than 255 bytes is
+			// split between the two bytes of metadata.
+			size |= int((rt&0x30)^0x30) << 4
+			rt |= 0x30
+		}
+		switch rt {
+		case typeEnum:
+			return enumValue(tm, i, int(d.uint(size)))
+		case typeSet:
+			return setValue(tm, i, d.uint(size))
+		}
+		n := int(d.u8())
+		if size >= 256 {
+			n |= int(d.u8()) << 8
+		}
+		s = string(d.bytes(n))
+	case typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob:
+		s = string(d.bytes(int(d.uint(int(meta)))))
+	case typeJSON:
+		b := d.bytes(int(d.uint(int(meta))))
+		if d.err != nil {
+			return "", d.err
+		}
+		if len(b) == 0 {
+			// An empty value is a JSON null (e.g. an update that sets
+			// a column to NULL via partial JSON updates).
+			return "null", nil
+		}
+		var sb strings.Builder
+		if err := writeJSONValue(&sb, b[0], b[1:]); err != nil {
+			return "", err
+		}
+		s = sb.String()
+	default:
+		return "", fmt.Errorf("unsupported column type %d", t)
+	}
+	return s, d.err
+}
+
+// enumValue returns the name of value v (1-based) of enum column i.
+func enumValue(tm *tableMap, i, v int) (string, error) {
+	vals, err := strValues(tm, tm.enums, typeEnum, i)
+	if err != nil {
+		return "", err
+	}
+	if v == 0 {
+		return "", nil // The empty string used for invalid values.
+	}
+	if v > len(vals) {
+		return "", fmt.Errorf("enum value %d out of range", v)
+	}
+	return vals[v-1], nil
+}
+
+// setValue returns the comma-separated names of the members of bitmap
+// v, a value of set column i.
+func setValue(tm *tableMap, i int, v uint64) (string, error) {
+	vals, err := strValues(tm, tm.sets, typeSet, i)
+	if err != nil {
+		return "", err
+	}
+	var l []string
+	for j, s := range vals {
+		if v&(1<<uint(j)) != 0 {
+			l = append(l, s)
+		}
+	}
+	return strings.Join(l, ","), nil
+}
+
+// strValues returns the values of enum or set column i, from the
+// optional metadata vals (which lists the values of each column of type
+// typ, in column order).
+func strValues(tm *tableMap, vals [][]string, typ byte, i int) ([]string, error) {
+	j := 0
+	for c := 0; c < i; c++ {
+		if tm.types[c] == typeString && byte(tm.meta[c]>>8) == typ {
+			j++
+		}
+	}
+	if j >= len(vals) {
+		return nil, fmt.Errorf("enum and set values aren't logged (set binlog_row_metadata=FULL)")
+	}
+	return vals[j], nil
+}
+
+// decimal decodes a DECIMAL(precision, scale) value. DECIMAL values are
+// stored as big-endian groups of 9 digits (in 4 bytes), with leftover
+// digits at either end stored in fewer bytes. The sign bit is inverted,
+// and negative values have all bits inverted.
+func (d *decoder) decimal(precision, scale int) string {
+	digitBytes := []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+	intDigits := precision - scale
+	intGroups, intLeft := intDigits/9, intDigits%9
+	fracGroups, fracLeft := scale/9, scale%9
+	size := intGroups*4 + digitBytes[intLeft] + fracGroups*4 + digitBytes[fracLeft]
+	b := append([]byte{}, d.bytes(size)...)
+	if d.err != nil || len(b) == 0 {
+		return ""
+	}
+	negative := b[0]&0x80 == 0
+	b[0] ^= 0x80
+	if negative {
+		for i := range b {
+			b[i] = ^b[i]
+		}
+	}
+	var sb strings.Builder
+	group := func(n, digits int) {
+		fmt.Fprintf(&sb, "%0*d", digits, bigEndian(b[:n]))
+		b = b[n:]
+	}
+	group(digitBytes[intLeft], intLeft)
+	for i := 0; i < intGroups; i++ {
+		group(4, 9)
+	}
+	intPart := strings.TrimLeft(sb.String(), "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	sb.Reset()
+	for i := 0; i < fracGroups; i++ {
+		group(4, 9)
+	}
+	group(digitBytes[fracLeft], fracLeft)
+	s := intPart
+	if scale > 0 {
+		s += "." + sb.String()
+	}
+	if negative {
+		s = "-" + s
+	}
+	return s
+}
+
+// fraction decodes the fractional seconds of a TIME2, DATETIME2 or
+// TIMESTAMP2 value with fsp digits of precision, as microseconds.
+func (d *decoder) fraction(fsp int) int64 {
+	n := (fsp + 1) / 2
+	v := int64(bigEndian(d.bytes(n)))
+	switch n {
+	case 1:
+		return v * 10000
+	case 2:
+		return v * 100
+	}
+	return v
+}
+
+// formatFraction returns the fractional part of a time with fsp digits
+// of precision, for micros microseconds.
+func formatFraction(micros int64, fsp int) string {
+	if fsp == 0 {
+		return ""
+	}
+	return fmt.Sprintf(".%06d", micros)[:fsp+1]
+}
+
+// formatTimestamp formats a TIMESTAMP value, sec seconds since the Unix
+// epoch, in UTC.
+func formatTimestamp(sec, micros int64, fsp int) string {
+	if sec == 0 && micros == 0 {
+		return "0000-00-00 00:00:00" + formatFraction(0, fsp)
+	}
+	return time.Unix(sec, 0).UTC().Format("2006-01-02 15:04:05") + formatFraction(micros, fsp)
+}
+
+// datetime2 decodes a DATETIME2 value: 5 bytes big-endian holding 1
+// sign bit, year*13+month (17 bits), day (5 bits), hour (5 bits),
+// minute (6 bits) and second (6 bits), followed by fractional seconds.
+func (d *decoder) datetime2(fsp int) string {
+	v := int64(bigEndian(d.bytes(5))) - 0x8000000000
+	micros := d.fraction(fsp)
+	ymd, hms := v>>17, v&(1<<17-1)
+	ym := ymd >> 5
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", ym/13, ym%13, ymd&0x1f, hms>>12, (hms>>6)&0x3f, hms&0x3f) +
+		formatFraction(micros, fsp)
+}
+
+// time2 decodes a TIME2 value: 3 bytes big-endian holding 1 sign bit,
+// hour (10 bits), minute (6 bits) and second (6 bits), followed by
+// fractional seconds. Negative values are stored as the complement of
+// the whole value, including the fractional part.
+func (d *decoder) time2(fsp int) string {
+	n := (fsp + 1) / 2
+	b := d.bytes(3 + n)
+	if d.err != nil {
+		return ""
+	}
+	// Combine integer and fractional parts, so that negative values can
+	// be decoded as a single two's complement number.
+	v := int64(bigEndian(b)) - int64(0x800000)<<(8*uint(n))
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	frac := v & (1<<(8*uint(n)) - 1)
+	hms := v >> (8 * uint(n))
+	switch n {
+	case 1:
+		frac *= 10000
+	case 2:
+		frac *= 100
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d", sign, hms>>12, (hms>>6)&0x3f, hms&0x3f) + formatFraction(frac, fsp)
+}
+
+// Types of values in MySQL's binary JSON format.
+const (
+	jsonSmallObject = 0x00
+	jsonLargeObject = 0x01
+	jsonSmallArray  = 0x02
+	jsonLargeArray  = 0x03
+	jsonLiteral     = 0x04
+	jsonInt16       = 0x05
+	jsonUint16      = 0x06
+	jsonInt32       = 0x07
+	jsonUint32      = 0x08
+	jsonInt64       = 0x09
+	jsonUint64      = 0x0a
+	jsonDouble      = 0x0b
+	jsonString      = 0x0c
+	jsonOpaque      = 0x0f
+)
+
+// writeJSONValue writes the text form of the binary JSON value b, of
+// type typ, to sb. The text form matches the one MySQL uses when
+// returning JSON values, so that values read from the binlog convert
+// to the same strings as values read by queries. See
+// https://dev.mysql.com/doc/dev/mysql-server/latest/json__binary_8h.html
+// for the binary format.
+func writeJSONValue(sb *strings.Builder, typ byte, b []byte) error {
+	d := &decoder{b: b}
+	switch typ {
+	case jsonSmallObject, jsonLargeObject, jsonSmallArray, jsonLargeArray:
+		return writeJSONContainer(sb, typ, b)
+	case jsonLiteral:
+		switch d.u8() {
+		case 0:
+			sb.WriteString("null")
+		case 1:
+			sb.WriteString("true")
+		case 2:
+			sb.WriteString("false")
+		default:
+			return fmt.Errorf("bad JSON literal")
+		}
+	case jsonInt16:
+		sb.WriteString(strconv.FormatInt(int64(int16(d.uint(2))), 10))
+	case jsonUint16:
+		sb.WriteString(strconv.FormatUint(d.uint(2), 10))
+	case jsonInt32:
+		sb.WriteString(strconv.FormatInt(int64(int32(d.uint(4))), 10))
+	case jsonUint32:
+		sb.WriteString(strconv.FormatUint(d.uint(4), 10))
+	case jsonInt64:
+		sb.WriteString(strconv.FormatInt(int64(d.uint(8)), 10))
+	case jsonUint64:
+		sb.WriteString(strconv.FormatUint(d.uint(8), 10))
+	case jsonDouble:
+		sb.WriteString(formatJSONDouble(math.Float64frombits(d.uint(8))))
+	case jsonString:
+		n := d.varLen()
+		writeJSONString(sb, string(d.bytes(n)))
+	case jsonOpaque:
+		t := d.u8()
+		n := d.varLen()
+		return writeJSONOpaque(sb, t, d.bytes(n))
+	default:
+		return fmt.Errorf("unknown JSON value type %d", typ)
+	}
+	return d.err
+}
+
+// writeJSONContainer writes a JSON object or array. Containers have an
+// element count and size, followed (for objects) by a key offset and
+// length for each element, and then a type and an offset (or inlined
+// value) for each element. Counts, sizes and offsets are 2 bytes in
+// small containers and 4 bytes in large ones; offsets are relative to
+// the start of the container.
+func writeJSONContainer(sb *strings.Builder, typ byte, b []byte) error {
+	object := typ == jsonSmallObject || typ == jsonLargeObject
+	width := 2
+	if typ == jsonLargeObject || typ == jsonLargeArray {
+		width = 4
+	}
+	d := &decoder{b: b}
+	n := int(d.uint(width))
+	d.skip(width) // Size.
+	var keys []string
+	if object {
+		for i := 0; i < n; i++ {
+			off := int(d.uint(width))
+			l := int(d.uint(2))
+			if off+l > len(b) {
+				return fmt.Errorf("bad JSON object key")
+			}
+			keys = append(keys, string(b[off:off+l]))
+		}
+	}
+	if object {
+		sb.WriteString("{")
+	} else {
+		sb.WriteString("[")
+	}
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if object {
+			writeJSONString(sb, keys[i])
+			sb.WriteString(": ")
+		}
+		t := d.u8()
+		entry := d.bytes(width)
+		if d.err != nil {
+			return d.err
+		}
+		var err error
+		switch {
+		case t == jsonLiteral || t == jsonInt16 || t == jsonUint16 || (width == 4 && (t == jsonInt32 || t == jsonUint32)):
+			// Small values are inlined in the entry.
+			err = writeJSONValue(sb, t, entry)
+		default:
+			off := int((&decoder{b: entry}).uint(width))
+			if off > len(b) {
+				return fmt.Errorf("bad JSON value offset")
+			}
+			err = writeJSONValue(sb, t, b[off:])
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if object {
+		sb.WriteString("}")
+	} else {
+		sb.WriteString("]")
+	}
+	return d.err
+}
+
+// varLen decodes the variable-length integers used for lengths in
+// binary JSON: 7 bits per byte, least significant first, with the high
+// bit set on all but the last byte.
+func (d *decoder) varLen() int {
+	n := 0
+	for i := uint(0); i < 5; i++ {
+		c := d.u8()
+		n |= int(c&0x7f) << (7 * i)
+		if c&0x80 == 0 {
+			break
+		}
+	}
+	return n
+}
+
+// writeJSONOpaque writes an opaque JSON value (a MySQL value of column
+// type t stored in a JSON document). Decimals are written as numbers,
+// and dates and times as strings; other values are written as MySQL
+// does, as "base64:type<t>:<base64 data>".
+func writeJSONOpaque(sb *strings.Builder, t byte, b []byte) error {
+	d := &decoder{b: b}
+	switch t {
+	case typeNewDecimal:
+		precision, scale := int(d.u8()), int(d.u8())
+		s := d.decimal(precision, scale)
+		if d.err != nil {
+			return d.err
+		}
+		sb.WriteString(s)
+		return nil
+	case typeDate, typeDatetime, typeTimestamp, typeTime:
+		// Dates and times are stored as packed 8-byte integers, as for
+		// DATETIME2 and TIME2 but shifted left by 24 bits to hold the
+		// microseconds.
+		v := int64(d.uint(8))
+		if d.err != nil {
+			return d.err
+		}
+		sign := ""
+		if v < 0 {
+			sign, v = "-", -v
+		}
+		micros, x := v&(1<<24-1), v>>24
+		var s string
+		switch t {
+		case typeTime:
+			s = fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, x>>12&0x3ff, (x>>6)&0x3f, x&0x3f, micros)
+		default:
+			ymd, hms := x>>17, x&(1<<17-1)
+			ym := ymd >> 5
+			s = fmt.Sprintf("%04d-%02d-%02d", ym/13, ym%13, ymd&0x1f)
+			if t != typeDate {
+				s += fmt.Sprintf(" %02d:%02d:%02d.%06d", hms>>12, (hms>>6)&0x3f, hms&0x3f, micros)
+			}
+		}
+		writeJSONString(sb, s)
+		return nil
+	}
+	writeJSONString(sb, fmt.Sprintf("base64:type%d:%s", t, base64.StdEncoding.EncodeToString(b)))
+	return nil
+}
+
+// formatJSONDouble formats a double as MySQL does in JSON values: with
+// ".0" for whole numbers, and exponents without "+".
+func formatJSONDouble(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return strings.Replace(s, "e+", "e", 1)
+}
+
+// writeJSONString writes s as a quoted JSON string, escaping only the
+// characters that JSON requires to be escaped (as MySQL does).
+func writeJSONString(sb *strings.Builder, s string) {
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(sb, `\u%04x`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+}
@@ -0,0 +1,257 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// StreamChanges reads row changes to the tables of database dbName
+// from the binlog files in directory dir, starting at binlog position
+// pos (as recorded in conv.ChangePosition), and converts them to
+// Spanner mutations. It calls apply with the mutations of each
+// committed transaction, the binlog position after it and its commit
+// time. If follow is
+// set, StreamChanges waits for new events at the end of the binlog,
+// and only returns on error (including errors from apply).
+//
+// The binlog must use row-based logging (binlog_format=ROW) with full
+// row images (binlog_row_image=FULL). Inserts and updates are written
+// with InsertOrUpdate mutations, so changes that were already applied
+// (e.g. when a stream is restarted from an earlier position) are
+// harmless. Schema changes and changes to tables with synthetic primary
+// keys aren't replicated: they are reported as unexpected conditions.
+func StreamChanges(conv *internal.Conv, dbName, dir, pos string, follow bool, apply func(ms []*sp.Mutation, pos string, commitTime time.Time) error) error {
+	start, err := parseBinlogPosition(pos)
+	if err != nil {
+		return err
+	}
+	r, err := newBinlogReader(dir, start, follow)
+	if err != nil {
+		return fmt.Errorf("can't read binlog: %w", err)
+	}
+	defer r.close()
+	var ms []*sp.Mutation
+	counts := make(internal.ChangeCounts)
+	commit := func(e binlogEvent) error {
+		if len(ms) == 0 {
+			return nil
+		}
+		err := apply(ms, e.next.String(), e.time)
+		if err == nil {
+			conv.StatsAddChanges(counts)
+		}
+		ms, counts = nil, make(internal.ChangeCounts)
+		return err
+	}
+	for {
+		e, err := r.next()
+		if err == io.EOF {
+			// Changes of a transaction that isn't complete yet are dropped:
+			// the transaction is read again when streaming restarts from
+			// the last position passed to apply.
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("can't read binlog: %w", err)
+		}
+		switch e.typ {
+		case xidEvent:
+			if err := commit(e); err != nil {
+				return err
+			}
+		case queryEvent:
+			db, query := r.parseQuery(e)
+			switch strings.ToUpper(query) {
+			case "BEGIN":
+			case "COMMIT":
+				// Transactions on non-transactional tables end with a
+				// COMMIT statement rather than an XID event.
+				if err := commit(e); err != nil {
+					return err
+				}
+			default:
+				// Other statements (e.g. DDL) commit implicitly.
+				if err := commit(e); err != nil {
+					return err
+				}
+				if db == dbName {
+					conv.Unexpected(fmt.Sprintf("Statement in binlog not replicated: %s", query))
+				}
+			}
+		case writeRowsEventV1, updateRowsEventV1, deleteRowsEventV1, writeRowsEventV2, updateRowsEventV2, deleteRowsEventV2:
+			ev, err := r.parseRows(e)
+			if err != nil {
+				return fmt.Errorf("can't read binlog: %w", err)
+			}
+			if ev.table.schema != dbName {
+				continue
+			}
+			ms = append(ms, rowMutations(conv, ev, counts)...)
+		}
+	}
+}
+
+// parseQuery returns the default database and the statement of query
+// event e.
+func (r *binlogReader) parseQuery(e binlogEvent) (string, string) {
+	// The post-header has the thread id (4 bytes), execution time (4),
+	// length of the database name (1), error code (2) and length of the
+	// status variables (2).
+	d := &decoder{b: e.data}
+	d.skip(8)
+	n := int(d.u8())
+	d.skip(2)
+	vars := int(d.u16())
+	d.skip(r.postHeaderLen(queryEvent) - 13 + vars)
+	db := string(d.bytes(n))
+	d.skip(1)
+	return db, strings.TrimSpace(string(d.b))
+}
+
+// rowMutations converts the rows of ev to Spanner mutations, and counts
+// them in counts. Rows that can't be converted are reported as
+// unexpected conditions, and counted as change errors in conv.
+func rowMutations(conv *internal.Conv, ev *rowsEvent, counts internal.ChangeCounts) []*sp.Mutation {
+	srcTable := ev.table.table
+	srcSchema, ok := conv.SrcSchema[srcTable]
+	if !ok {
+		conv.Unexpected(fmt.Sprintf("Changes to table %s not replicated: table not found in source schema", srcTable))
+		return nil
+	}
+	spTable, err := internal.GetSpannerTable(conv, srcTable)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get spanner table : %s", err))
+		return nil
+	}
+	if _, ok := conv.SyntheticPKeys[spTable]; ok {
+		// Rows of tables with synthetic primary keys can't be matched
+		// with rows in Spanner.
+		conv.Unexpected(fmt.Sprintf("Changes to table %s not replicated: table has no primary key", srcTable))
+		return nil
+	}
+	srcCols := ev.table.names
+	if srcCols == nil {
+		// Without column names in the binlog (binlog_row_metadata=FULL),
+		// assume the columns are those of the source schema.
+		srcCols = srcSchema.ColNames
+	}
+	if len(srcCols) != len(ev.table.types) {
+		conv.Unexpected(fmt.Sprintf("Changes to table %s not replicated: binlog has %d columns, source schema has %d", srcTable, len(ev.table.types), len(srcCols)))
+		return nil
+	}
+	spCols, err := internal.GetSpannerCols(conv, srcTable, srcCols)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get spanner columns for table %s : err = %s", srcTable, err))
+		return nil
+	}
+	spSchema, ok := conv.SpSchema[spTable]
+	if !ok {
+		conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
+		return nil
+	}
+	var ms []*sp.Mutation
+	for i := 0; i < len(ev.rows) || i < len(ev.before); i++ {
+		var before, after *changeRow
+		var err error
+		if i < len(ev.before) {
+			before, err = convertChangeRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, ev.before[i])
+		}
+		if err == nil && i < len(ev.rows) {
+			after, err = convertChangeRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, ev.rows[i])
+		}
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Error while converting data: %s\n", err))
+			conv.StatsAddChange(srcTable, internal.ChangeError)
+			continue
+		}
+		// A delete, or an update that changes the primary key, deletes
+		// the old row.
+		if before != nil && (after == nil || !reflect.DeepEqual(before.key, after.key)) {
+			ms = append(ms, sp.Delete(spTable, before.key))
+		}
+		if after != nil {
+			ms = append(ms, sp.InsertOrUpdate(spTable, after.cols, after.vals))
+		}
+		switch {
+		case before == nil:
+			counts.Add(srcTable, internal.ChangeInsert)
+		case after == nil:
+			counts.Add(srcTable, internal.ChangeDelete)
+		default:
+			counts.Add(srcTable, internal.ChangeUpdate)
+		}
+	}
+	return ms
+}
+
+// changeRow is a row image converted to Spanner values.
+type changeRow struct {
+	key  sp.Key
+	cols []string
+	vals []interface{}
+}
+
+// convertChangeRow converts row image vals using ConvertData. Unlike
+// rows read by ProcessSQLData, NULL values are kept (as nil), so that
+// updates can set columns to NULL.
+func convertChangeRow(conv *internal.Conv, srcTable string, srcCols []string, srcSchema schema.Table, spTable string, spCols []string, spSchema ddl.CreateTable, vals []*string) (*changeRow, error) {
+	_, cols, cvtVals, err := ConvertData(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, valsToStrings(changeVals(vals)))
+	if err != nil {
+		return nil, err
+	}
+	r := &changeRow{cols: cols, vals: cvtVals}
+	m := make(map[string]interface{})
+	for i, c := range cols {
+		m[c] = cvtVals[i]
+	}
+	for i, v := range vals {
+		if _, ok := m[spCols[i]]; !ok && v == nil && spSchema.ColDefs[spCols[i]].Generated == nil {
+			r.cols = append(r.cols, spCols[i])
+			r.vals = append(r.vals, nil)
+		}
+	}
+	for _, k := range spSchema.Pks {
+		v, ok := m[k.Col]
+		if !ok {
+			return nil, fmt.Errorf("primary key column %s is missing from binlog row image", k.Col)
+		}
+		r.key = append(r.key, v)
+	}
+	return r, nil
+}
+
+// changeVals converts the values of a row image to the form returned
+// by queries, for valsToStrings.
+func changeVals(vals []*string) []sql.RawBytes {
+	l := make([]sql.RawBytes, len(vals))
+	for i, v := range vals {
+		if v != nil {
+			l[i] = sql.RawBytes(*v)
+		}
+	}
+	return l
+}
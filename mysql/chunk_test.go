@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkWhere(t *testing.T) {
+	keys := []string{"`a`", "`b`"}
+	lower := []interface{}{int64(1), "x"}
+	upper := []interface{}{int64(9), "y"}
+	where, args := chunkWhere(keys, nil, true, nil)
+	assert.Equal(t, "", where)
+	assert.Nil(t, args)
+	where, args = chunkWhere(keys, lower, true, upper)
+	assert.Equal(t, " WHERE (`a`, `b`) >= (?, ?) AND (`a`, `b`) < (?, ?)", where)
+	assert.Equal(t, []interface{}{int64(1), "x", int64(9), "y"}, args)
+	where, args = chunkWhere(keys, lower, false, nil)
+	assert.Equal(t, " WHERE (`a`, `b`) > (?, ?)", where)
+	assert.Equal(t, lower, args)
+}
+
+// chunkConv returns a Conv in data mode with source table db.t, with
+// primary key a (of type keyType) and column b, and the rows written
+// to it.
+func chunkConv(t *testing.T, keyType string) (*internal.Conv, *[]spannerData) {
+	conv := internal.MakeConv()
+	conv.SetSchemaMode()
+	conv.SrcSchema["t"] = schema.Table{
+		Name:     "t",
+		ColNames: []string{"a", "b"},
+		ColDefs: map[string]schema.Column{
+			"a": schema.Column{Name: "a", Type: schema.Type{Name: keyType}, NotNull: true},
+			"b": schema.Column{Name: "b", Type: schema.Type{Name: "text"}},
+		},
+		PrimaryKeys: []schema.Key{schema.Key{Column: "a"}},
+	}
+	assert.Nil(t, schemaToDDL(conv))
+	conv.SetDataMode()
+	var rows []spannerData
+	conv.SetDataSink(func(table string, cols []string, vals []interface{}) {
+		rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
+	})
+	return conv, &rows
+}
+
+func TestSplitTable(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	table := schemaAndName{schema: "db", name: "t"}
+
+	// Integer keys are split into ranges between MIN and MAX.
+	conv, _ := chunkConv(t, "bigint")
+	mock.ExpectQuery("SELECT MIN(`a`), MAX(`a`) FROM `db`.`t`;").
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(int64(1), int64(100)))
+	assert.Equal(t, internal.IntKeyRanges(1, 100, 4), splitTable(conv, db, table, 100, 30))
+
+	// Other keys are split using a sample of keys.
+	conv, _ = chunkConv(t, "varchar")
+	samples := sqlmock.NewRows([]string{"a"})
+	var keys [][]interface{}
+	for _, k := range []string{"b", "d", "f", "h", "j", "l", "n", "p"} {
+		samples.AddRow(k)
+		keys = append(keys, []interface{}{k})
+	}
+	mock.ExpectQuery("SELECT `a` FROM `db`.`t` WHERE RAND(0) < ? ORDER BY `a`;").
+		WithArgs(0.8).WillReturnRows(samples)
+	r := splitTable(conv, db, table, 100, 30)
+	assert.Equal(t, internal.SampleKeyRanges(keys, 4), r)
+	assert.Equal(t, 4, len(r))
+
+	// Small tables are read in one piece.
+	assert.Nil(t, splitTable(conv, db, table, 20, 30))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessChunkData(t *testing.T) {
+	defer func(rows int, delay time.Duration) { chunkPageRows, chunkRetryDelay = rows, delay }(chunkPageRows, chunkRetryDelay)
+	chunkPageRows, chunkRetryDelay = 2, time.Millisecond
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	conv, written := chunkConv(t, "bigint")
+	rows := func(keys ...int64) *sqlmock.Rows {
+		r := sqlmock.NewRows([]string{"a", "b"})
+		for _, k := range keys {
+			r.AddRow(k, fmt.Sprintf("row %d", k))
+		}
+		return r
+	}
+	first := "SELECT `a`,`b` FROM `db`.`t` WHERE (`a`) >= (?) AND (`a`) < (?) ORDER BY `a` LIMIT 2;"
+	next := "SELECT `a`,`b` FROM `db`.`t` WHERE (`a`) > (?) AND (`a`) < (?) ORDER BY `a` LIMIT 2;"
+	// A full page, so another page is read after its last key.
+	mock.ExpectQuery(first).WithArgs(int64(1), int64(10)).WillReturnRows(rows(1, 2))
+	// The query fails, and is retried.
+	mock.ExpectQuery(next).WithArgs("2", int64(10)).WillReturnError(fmt.Errorf("connection reset"))
+	// The query fails after reading one row, and is retried after it.
+	mock.ExpectQuery(next).WithArgs("2", int64(10)).WillReturnRows(rows(3, 4).RowError(1, fmt.Errorf("connection reset")))
+	// A partial page ends the chunk.
+	mock.ExpectQuery(next).WithArgs("3", int64(10)).WillReturnRows(rows(4))
+	processChunkData(conv, db, schemaAndName{schema: "db", name: "t"}, 0, internal.KeyRange{Lower: []interface{}{int64(1)}, Upper: []interface{}{int64(10)}})
+	assert.Nil(t, mock.ExpectationsWereMet())
+	var keys []interface{}
+	for _, r := range *written {
+		keys = append(keys, r.vals[0])
+	}
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), int64(4)}, keys)
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+	assert.Equal(t, int64(0), conv.BadRows())
+}
+
+func TestResumeRead(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	conv, written := chunkConv(t, "bigint")
+	var seeks []int
+	conv.SetSeek(func(table string, chunk int) ([]string, int64) {
+		seeks = append(seeks, chunk)
+		return []string{"5"}, 4
+	})
+	table := schemaAndName{schema: "db", name: "t"}
+	// Chunks are read after the last row written.
+	mock.ExpectQuery("SELECT `a`,`b` FROM `db`.`t` WHERE (`a`) > (?) AND (`a`) < (?) ORDER BY `a` LIMIT 10000;").WithArgs("5", int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow(int64(6), "x"))
+	processChunkData(conv, db, table, 1, internal.KeyRange{Lower: []interface{}{int64(1)}, Upper: []interface{}{int64(10)}})
+	// So are tables read in one piece.
+	mock.ExpectQuery("SELECT `a`,`b` FROM `db`.`t` WHERE (`a`) > (?) ORDER BY `a`;").WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow(int64(6), "x"))
+	processTableData(conv, db, table)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []int{1, -1}, seeks)
+	assert.Equal(t, 2, len(*written))
+	// Rows that weren't read are counted as good rows.
+	assert.Equal(t, int64(10), conv.Stats.GoodRows["t"])
+}
@@ -60,6 +60,11 @@ func ConvertData(conv *internal.Conv, srcTable string, srcCols []string, srcSche
 	}
 	for i, spCol := range spCols {
 		srcCol := srcCols[i]
+		if spSchema.ColDefs[spCol].Generated != nil {
+			// Spanner computes the values of generated columns, and
+			// rejects writes to them.
+			continue
+		}
 		// Skip columns with 'NULL' values. When processing data rows from mysqldump, these values
 		// are represented as nil (by pingcap/tidb/types/parser_driver's ValueExpr), which is
 		// converted to the string '<nil>'. When processing data rows obtained from the MySQL driver,
@@ -85,11 +90,9 @@ func ConvertData(conv *internal.Conv, srcTable string, srcCols []string, srcSche
 		v = append(v, x)
 		c = append(c, spCol)
 	}
-	if aux, ok := conv.SyntheticPKeys[spTable]; ok {
-		c = append(c, aux.Col)
-		v = append(v, int64(bits.Reverse64(uint64(aux.Sequence))))
-		aux.Sequence++
-		conv.SyntheticPKeys[spTable] = aux
+	if col, seq, ok := conv.NextSyntheticPKey(spTable); ok {
+		c = append(c, col)
+		v = append(v, int64(bits.Reverse64(uint64(seq))))
 	}
 	return spTable, c, v, nil
 }
@@ -117,6 +120,8 @@ func convScalar(conv *internal.Conv, spannerType ddl.Type, srcTypeName string, T
 		return convInt64(val)
 	case ddl.Numeric:
 		return convNumeric(val)
+	case ddl.JSON:
+		return convJSON(val)
 	case ddl.String:
 		return val, nil
 	case ddl.Timestamp:
@@ -189,6 +194,16 @@ func convNumeric(val string) (string, error) {
 	return spanner.NumericString(r), nil
 }
 
+// convJSON validates JSON text val, and normalizes it (see
+// internal.NormalizeJSON). We write JSON values to Spanner as text.
+func convJSON(val string) (string, error) {
+	s, err := internal.NormalizeJSON(val)
+	if err != nil {
+		return "", fmt.Errorf("can't convert to json: %w", err)
+	}
+	return s, nil
+}
+
 // convTimestamp maps a source DB timestamp into a go Time Spanner timestamp
 // It handles both datetime and timestamp conversions.
 func convTimestamp(srcTypeName string, TimezoneOffset string, val string) (t time.Time, err error) {
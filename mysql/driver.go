@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func init() {
+	source.Register("mysqldump", dumpDriver{})
+	source.Register("mysql", infoSchemaDriver{})
+}
+
+// dumpDriver implements source.Driver for mysqldump output.
+type dumpDriver struct{}
+
+func (dumpDriver) Kind() source.Kind { return source.Dump }
+
+func (dumpDriver) ProcessSchema(conv *internal.Conv, src source.Source) error {
+	if src.Dir != "" {
+		return fmt.Errorf("mysqldump input must be a file, not a directory")
+	}
+	return ProcessMySQLDump(conv, src.Reader)
+}
+
+// SetRowStats is a no-op: rows are counted during the schema pass.
+func (dumpDriver) SetRowStats(conv *internal.Conv, src source.Source) error { return nil }
+
+func (dumpDriver) ProcessData(conv *internal.Conv, src source.Source) error {
+	if src.Dir != "" {
+		return fmt.Errorf("mysqldump input must be a file, not a directory")
+	}
+	return ProcessMySQLDump(conv, src.Reader)
+}
+
+func (dumpDriver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	return remapType(srcType, spType, mods)
+}
+
+// infoSchemaDriver implements source.Driver (along with
+// source.Connector and source.ChangeStreamer) for direct connections to
+// a MySQL database.
+type infoSchemaDriver struct{}
+
+func (infoSchemaDriver) Kind() source.Kind { return source.SQL }
+
+func (infoSchemaDriver) ProcessSchema(conv *internal.Conv, src source.Source) error {
+	return ProcessInfoSchema(conv, src.DB, src.DBName)
+}
+
+func (infoSchemaDriver) SetRowStats(conv *internal.Conv, src source.Source) error {
+	SetRowStats(conv, src.DB, src.DBName)
+	return nil
+}
+
+func (infoSchemaDriver) ProcessData(conv *internal.Conv, src source.Source) error {
+	ProcessSQLData(conv, src.DB, src.DBName, src.Workers, src.ChunkRows)
+	return nil
+}
+
+func (infoSchemaDriver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	return remapType(srcType, spType, mods)
+}
+
+// ConfigFromEnv builds a connection config using the MYSQLHOST,
+// MYSQLPORT, MYSQLUSER, MYSQLDATABASE and MYSQLPWD environment variables.
+func (infoSchemaDriver) ConfigFromEnv() (source.Config, error) {
+	c := source.Config{
+		Host:     os.Getenv("MYSQLHOST"),
+		Port:     os.Getenv("MYSQLPORT"),
+		User:     os.Getenv("MYSQLUSER"),
+		Database: os.Getenv("MYSQLDATABASE"),
+		Password: os.Getenv("MYSQLPWD"),
+	}
+	if c.Host == "" || c.Port == "" || c.User == "" || c.Database == "" {
+		fmt.Printf("Please specify host, port, user and database using MYSQLHOST, MYSQLPORT, MYSQLUSER and MYSQLDATABASE environment variables\n")
+		return c, fmt.Errorf("Could not connect to source database")
+	}
+	return c, nil
+}
+
+func (infoSchemaDriver) DataSourceName(c source.Config) (string, string) {
+	return "mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", c.User, c.Password, c.Host, c.Port, c.Database)
+}
+
+func (infoSchemaDriver) StreamChanges(conv *internal.Conv, src source.Source, pos string, apply func(ms []*sp.Mutation, pos string, commitTime time.Time) error) error {
+	return StreamChanges(conv, src.DBName, src.Changes, pos, src.Follow, apply)
+}
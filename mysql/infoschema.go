@@ -52,7 +52,14 @@ func ProcessInfoSchema(conv *internal.Conv, db *sql.DB, dbName string) error {
 //
 // Using database/sql library we pass *sql.RawBytes to rows.scan.
 // RawBytes is a byte slice and values can be easily converted to string.
-func ProcessSQLData(conv *internal.Conv, db *sql.DB, dbName string) {
+//
+// If workers is greater than 1, up to workers tables are read
+// concurrently, each using its own connection from db's pool. If
+// chunkRows is positive, tables with more than chunkRows rows are
+// split into primary key ranges that are read concurrently (see
+// processChunkedData). All connections read the same snapshot of db,
+// so data from different tables is consistent.
+func ProcessSQLData(conv *internal.Conv, db *sql.DB, dbName string, workers int, chunkRows int64) {
 	// TODO: refactor to use the set of tables computed by
 	// ProcessInfoSchema instead of computing them again.
 	tables, err := getTables(db, dbName)
@@ -60,60 +67,80 @@ func ProcessSQLData(conv *internal.Conv, db *sql.DB, dbName string) {
 		conv.Unexpected(fmt.Sprintf("Couldn't get list of table: %s", err))
 		return
 	}
-	for _, t := range tables {
-		srcTable := t.name
-		srcSchema, ok := conv.SrcSchema[srcTable]
-		if !ok {
-			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
-			conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
-			continue
-		}
-		srcCols := srcSchema.ColNames
-		if len(srcCols) == 0 {
-			conv.Unexpected(fmt.Sprintf("Couldn't get source columns for table %s ", t.name))
-			continue
-		}
-		colNameList := buildColNameList(srcSchema, srcCols)
-		// MySQL schema and name can be arbitrary strings.
-		// Ideally we would pass schema/name as a query parameter,
-		// but MySQL doesn't support this. So we quote it instead.
-		q := fmt.Sprintf("SELECT %s FROM `%s`.`%s`;", colNameList, t.schema, t.name)
-		rows, err := db.Query(q)
-		if err != nil {
-			conv.Unexpected(fmt.Sprintf("Couldn't get data for table %s : err = %s", t.name, err))
-			continue
-		}
-		defer rows.Close()
-		srcCols, _ = rows.Columns()
-		spTable, err := internal.GetSpannerTable(conv, srcTable)
-		if err != nil {
-			conv.Unexpected(fmt.Sprintf("Couldn't get spanner table : %s", err))
-			continue
-		}
-		spCols, err := internal.GetSpannerCols(conv, srcTable, srcCols)
+	reader, done := readers(conv, db, workers)
+	defer done()
+	if chunkRows > 0 {
+		processChunkedData(conv, reader, tables, workers, chunkRows)
+		return
+	}
+	internal.ForEachWorker(len(tables), workers, func(w, i int) {
+		processTableData(conv, reader(w), tables[i])
+	})
+}
+
+// processTableData performs data conversion for table t.
+func processTableData(conv *internal.Conv, db querier, t schemaAndName) {
+	srcTable := t.name
+	srcSchema, ok := conv.SrcSchema[srcTable]
+	if !ok {
+		conv.StatsAddBadTable(srcTable)
+		conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
+		return
+	}
+	// Generated columns are computed by Spanner, so aren't read.
+	srcCols := conv.DataCols(srcTable)
+	if len(srcCols) == 0 {
+		conv.Unexpected(fmt.Sprintf("Couldn't get source columns for table %s ", t.name))
+		return
+	}
+	colNameList := buildColNameList(srcSchema, srcCols)
+	// MySQL schema and name can be arbitrary strings.
+	// Ideally we would pass schema/name as a query parameter,
+	// but MySQL doesn't support this. So we quote it instead.
+	// Read rows in primary key order, so that a resumed migration
+	// sees rows in the same order as the run it resumes, starting
+	// from the last row written if the table has a suitable key.
+	var where string
+	var args []interface{}
+	if k := conv.ResumeKey(srcTable, -1); k != nil {
+		where, args = chunkWhere(keyCols(srcSchema), k, false, nil)
+	}
+	q := fmt.Sprintf("SELECT %s FROM `%s`.`%s`%s%s;", colNameList, t.schema, t.name, where, orderBy(srcSchema))
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get data for table %s : err = %s", t.name, err))
+		return
+	}
+	defer rows.Close()
+	srcCols, _ = rows.Columns()
+	spTable, err := internal.GetSpannerTable(conv, srcTable)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get spanner table : %s", err))
+		return
+	}
+	spCols, err := internal.GetSpannerCols(conv, srcTable, srcCols)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get spanner columns for table %s : err = %s", t.name, err))
+		return
+	}
+	spSchema, ok := conv.SpSchema[spTable]
+	if !ok {
+		conv.StatsAddBadTable(srcTable)
+		conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
+		return
+	}
+	v, scanArgs := buildVals(len(srcCols))
+	for rows.Next() {
+		// get RawBytes from data.
+		err = rows.Scan(scanArgs...)
 		if err != nil {
-			conv.Unexpected(fmt.Sprintf("Couldn't get spanner columns for table %s : err = %s", t.name, err))
-			continue
-		}
-		spSchema, ok := conv.SpSchema[spTable]
-		if !ok {
-			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
-			conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
+			conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+			// Scan failed, so we don't have any data to add to bad rows.
+			conv.StatsAddBadRow(srcTable, conv.DataMode())
 			continue
 		}
-		v, scanArgs := buildVals(len(srcCols))
-		for rows.Next() {
-			// get RawBytes from data.
-			err = rows.Scan(scanArgs...)
-			if err != nil {
-				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
-				// Scan failed, so we don't have any data to add to bad rows.
-				conv.StatsAddBadRow(srcTable, conv.DataMode())
-				continue
-			}
-			values := valsToStrings(v)
-			ProcessDataRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, values)
-		}
+		values := valsToStrings(v)
+		ProcessDataRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, values)
 	}
 }
 
@@ -229,7 +256,7 @@ func processTable(conv *internal.Conv, db *sql.DB, table schemaAndName) error {
 }
 
 func getColumns(table schemaAndName, db *sql.DB) (*sql.Rows, error) {
-	q := `SELECT c.column_name, c.data_type, c.column_type, c.is_nullable, c.column_default, c.character_maximum_length, c.numeric_precision, c.numeric_scale, c.extra
+	q := `SELECT c.column_name, c.data_type, c.column_type, c.is_nullable, c.column_default, c.character_maximum_length, c.numeric_precision, c.numeric_scale, c.extra, c.generation_expression
               FROM information_schema.COLUMNS c
               where table_schema = ? and table_name = ? ORDER BY c.ordinal_position;`
 	return db.Query(q, table.schema, table.name)
@@ -239,10 +266,10 @@ func processColumns(conv *internal.Conv, cols *sql.Rows, constraints map[string]
 	colDefs := make(map[string]schema.Column)
 	var colNames []string
 	var colName, dataType, isNullable, columnType string
-	var colDefault, colExtra sql.NullString
+	var colDefault, colExtra, generationExpr sql.NullString
 	var charMaxLen, numericPrecision, numericScale sql.NullInt64
 	for cols.Next() {
-		err := cols.Scan(&colName, &dataType, &columnType, &isNullable, &colDefault, &charMaxLen, &numericPrecision, &numericScale, &colExtra)
+		err := cols.Scan(&colName, &dataType, &columnType, &isNullable, &colDefault, &charMaxLen, &numericPrecision, &numericScale, &colExtra, &generationExpr)
 		if err != nil {
 			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
 			continue
@@ -265,12 +292,21 @@ func processColumns(conv *internal.Conv, cols *sql.Rows, constraints map[string]
 		if colExtra.String == "auto_increment" {
 			ignored.AutoIncrement = true
 		}
+		// extra is VIRTUAL GENERATED or STORED GENERATED for
+		// generated columns.
+		var generated string
+		if strings.HasSuffix(colExtra.String, " GENERATED") {
+			ignored.Generated = true
+			generated = generationExpr.String
+		}
 		c := schema.Column{
-			Name:    colName,
-			Type:    toType(dataType, columnType, charMaxLen, numericPrecision, numericScale),
-			NotNull: toNotNull(conv, isNullable),
-			Unique:  unique,
-			Ignored: ignored,
+			Name:      colName,
+			Type:      toType(dataType, columnType, charMaxLen, numericPrecision, numericScale),
+			NotNull:   toNotNull(conv, isNullable),
+			Unique:    unique,
+			Default:   toDefault(dataType, colDefault, colExtra.String),
+			Generated: generated,
+			Ignored:   ignored,
 		}
 		colDefs[colName] = c
 		colNames = append(colNames, colName)
@@ -442,6 +478,23 @@ func toNotNull(conv *internal.Conv, isNullable string) bool {
 	return false
 }
 
+// toDefault returns the default value expression of a column with
+// type dataType, given its information_schema column_default and extra
+// values. column_default holds the value of literal defaults (without
+// quotes), and the expression of other defaults: these are marked as
+// DEFAULT_GENERATED in extra, except for CURRENT_TIMESTAMP before
+// MySQL 8.0.13.
+func toDefault(dataType string, colDefault sql.NullString, extra string) string {
+	switch {
+	case !colDefault.Valid:
+		return ""
+	case strings.Contains(extra, "DEFAULT_GENERATED"),
+		(dataType == "datetime" || dataType == "timestamp") && strings.HasPrefix(strings.ToUpper(colDefault.String), "CURRENT_TIMESTAMP"):
+		return colDefault.String
+	}
+	return "'" + strings.Replace(colDefault.String, "'", "''", -1) + "'"
+}
+
 // buildVals constructs []sql.RawBytes value containers to scan row
 // results into.  Returns both the underlying containers (as a slice)
 // as well as an interface{} of pointers to containers to pass to
@@ -470,3 +523,16 @@ func valsToStrings(vals []sql.RawBytes) []string {
 	}
 	return s
 }
+
+// orderBy returns an ORDER BY clause that sorts rows of table t by its
+// primary key, or "" if t has no primary key.
+func orderBy(t schema.Table) string {
+	var keys []string
+	for _, k := range t.PrimaryKeys {
+		keys = append(keys, fmt.Sprintf("`%s`", k.Column))
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
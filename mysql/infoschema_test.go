@@ -31,6 +31,7 @@ type mockSpec struct {
 	args  []driver.Value   // Query args.
 	cols  []string         // Columns names for returned rows.
 	rows  [][]driver.Value // Set of rows returned.
+	exec  bool             // Statement is run using Exec, and returns no rows.
 }
 
 func TestProcessInfoSchemaMYSQL(t *testing.T) {
@@ -49,11 +50,11 @@ func TestProcessInfoSchemaMYSQL(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"test", "user"},
-			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra"},
+			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra", "generation_expression"},
 			rows: [][]driver.Value{
-				{"user_id", "text", "text", "NO", nil, nil, nil, nil, nil},
-				{"name", "text", "text", "NO", nil, nil, nil, nil, nil},
-				{"ref", "bigint", "bigint", "NO", nil, nil, nil, nil, nil}},
+				{"user_id", "text", "text", "NO", nil, nil, nil, nil, nil, nil},
+				{"name", "text", "text", "NO", nil, nil, nil, nil, nil, nil},
+				{"ref", "bigint", "bigint", "NO", nil, nil, nil, nil, nil, nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"test", "user"},
@@ -76,11 +77,11 @@ func TestProcessInfoSchemaMYSQL(t *testing.T) {
 		{
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"test", "cart"},
-			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra"},
+			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra", "generation_expression"},
 			rows: [][]driver.Value{
-				{"productid", "text", "text", "NO", nil, nil, nil, nil, nil},
-				{"userid", "text", "text", "NO", nil, nil, nil, nil, nil},
-				{"quantity", "bigint", "bigint", "YES", nil, nil, 64, 0, nil}},
+				{"productid", "text", "text", "NO", nil, nil, nil, nil, nil, nil},
+				{"userid", "text", "text", "NO", nil, nil, nil, nil, nil, nil},
+				{"quantity", "bigint", "bigint", "YES", nil, nil, 64, 0, nil, nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"test", "cart"},
@@ -108,10 +109,10 @@ func TestProcessInfoSchemaMYSQL(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"test", "product"},
-			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra"},
+			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra", "generation_expression"},
 			rows: [][]driver.Value{
-				{"product_id", "text", "text", "NO", nil, nil, nil, nil, nil},
-				{"product_name", "text", "text", "NO", nil, nil, nil, nil, nil}},
+				{"product_id", "text", "text", "NO", nil, nil, nil, nil, nil, nil},
+				{"product_name", "text", "text", "NO", nil, nil, nil, nil, nil, nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"test", "product"},
@@ -129,28 +130,28 @@ func TestProcessInfoSchemaMYSQL(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"test", "test"},
-			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra"},
+			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra", "generation_expression"},
 			rows: [][]driver.Value{
-				{"id", "bigint", "bigint", "NO", nil, nil, 64, 0, nil},
-				{"s", "set", "set", "YES", nil, nil, nil, nil, nil},
-				{"txt", "text", "text", "NO", nil, nil, nil, nil, nil},
-				{"b", "boolean", "boolean", "YES", nil, nil, nil, nil, nil},
-				{"bs", "bigint", "bigint", "NO", "nextval('test11_bs_seq'::regclass)", nil, 64, 0, nil},
-				{"bl", "blob", "blob", "YES", nil, nil, nil, nil, nil},
-				{"c", "char", "char(1)", "YES", nil, 1, nil, nil, nil},
-				{"c8", "char", "char(8)", "YES", nil, 8, nil, nil, nil},
-				{"d", "date", "date", "YES", nil, nil, nil, nil, nil},
-				{"dec", "decimal", "decimal(20,5)", "YES", nil, nil, 20, 5, nil},
-				{"f8", "double", "double", "YES", nil, nil, 53, nil, nil},
-				{"f4", "float", "float", "YES", nil, nil, 24, nil, nil},
-				{"i8", "bigint", "bigint", "YES", nil, nil, 64, 0, nil},
-				{"i4", "integer", "integer", "YES", nil, nil, 32, 0, "auto_increment"},
-				{"i2", "smallint", "smallint", "YES", nil, nil, 16, 0, nil},
-				{"si", "integer", "integer", "NO", "nextval('test11_s_seq'::regclass)", nil, 32, 0, nil},
-				{"ts", "datetime", "datetime", "YES", nil, nil, nil, nil, nil},
-				{"tz", "timestamp", "timestamp", "YES", nil, nil, nil, nil, nil},
-				{"vc", "varchar", "varchar", "YES", nil, nil, nil, nil, nil},
-				{"vc6", "varchar", "varchar(6)", "YES", nil, 6, nil, nil, nil}},
+				{"id", "bigint", "bigint", "NO", nil, nil, 64, 0, nil, nil},
+				{"s", "set", "set", "YES", nil, nil, nil, nil, nil, nil},
+				{"txt", "text", "text", "NO", nil, nil, nil, nil, nil, nil},
+				{"b", "boolean", "boolean", "YES", "1", nil, nil, nil, nil, nil},
+				{"bs", "bigint", "bigint", "NO", "nextval('test11_bs_seq'::regclass)", nil, 64, 0, nil, nil},
+				{"bl", "blob", "blob", "YES", nil, nil, nil, nil, nil, nil},
+				{"c", "char", "char(1)", "YES", nil, 1, nil, nil, nil, nil},
+				{"c8", "char", "char(8)", "YES", nil, 8, nil, nil, nil, nil},
+				{"d", "date", "date", "YES", "2021-06-01", nil, nil, nil, nil, nil},
+				{"dec", "decimal", "decimal(20,5)", "YES", nil, nil, 20, 5, nil, nil},
+				{"f8", "double", "double", "YES", nil, nil, 53, nil, nil, nil},
+				{"f4", "float", "float", "YES", nil, nil, 24, nil, nil, nil},
+				{"i8", "bigint", "bigint", "YES", nil, nil, 64, 0, nil, nil},
+				{"i4", "integer", "integer", "YES", nil, nil, 32, 0, "auto_increment", nil},
+				{"i2", "smallint", "smallint", "YES", nil, nil, 16, 0, nil, nil},
+				{"si", "integer", "integer", "NO", "nextval('test11_s_seq'::regclass)", nil, 32, 0, nil, nil},
+				{"ts", "datetime", "datetime", "YES", "2021-06-01 00:00:00", nil, nil, nil, nil, nil},
+				{"tz", "timestamp", "timestamp", "YES", "CURRENT_TIMESTAMP", nil, nil, nil, "DEFAULT_GENERATED", nil},
+				{"vc", "varchar", "varchar", "YES", "it's", nil, nil, nil, nil, nil},
+				{"vc6", "varchar", "varchar(6)", "YES", nil, 6, nil, nil, nil, nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"test", "test"},
@@ -169,11 +170,11 @@ func TestProcessInfoSchemaMYSQL(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"test", "test_ref"},
-			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra"},
+			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra", "generation_expression"},
 			rows: [][]driver.Value{
-				{"ref_id", "bigint", "bigint", "NO", nil, nil, 64, 0, nil},
-				{"ref_txt", "text", "text", "NO", nil, nil, nil, nil, nil},
-				{"abc", "text", "text", "NO", nil, nil, nil, nil, nil}},
+				{"ref_id", "bigint", "bigint", "NO", nil, nil, 64, 0, nil, nil},
+				{"ref_txt", "text", "text", "NO", nil, nil, nil, nil, nil, nil},
+				{"abc", "text", "text", "NO", nil, nil, nil, nil, nil, nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"test", "test_ref"},
@@ -235,12 +236,12 @@ func TestProcessInfoSchemaMYSQL(t *testing.T) {
 				"id":  ddl.ColumnDef{Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
 				"s":   ddl.ColumnDef{Name: "s", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength, IsArray: true}},
 				"txt": ddl.ColumnDef{Name: "txt", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, NotNull: true},
-				"b":   ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.Bool}},
+				"b":   ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.Bool}, Default: &ddl.Default{Value: "true"}},
 				"bs":  ddl.ColumnDef{Name: "bs", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
 				"bl":  ddl.ColumnDef{Name: "bl", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
 				"c":   ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.String, Len: int64(1)}},
 				"c8":  ddl.ColumnDef{Name: "c8", T: ddl.Type{Name: ddl.String, Len: int64(8)}},
-				"d":   ddl.ColumnDef{Name: "d", T: ddl.Type{Name: ddl.Date}},
+				"d":   ddl.ColumnDef{Name: "d", T: ddl.Type{Name: ddl.Date}, Default: &ddl.Default{Value: "2021-06-01"}},
 				"dec": ddl.ColumnDef{Name: "dec", T: ddl.Type{Name: ddl.Numeric}},
 				"f8":  ddl.ColumnDef{Name: "f8", T: ddl.Type{Name: ddl.Float64}},
 				"f4":  ddl.ColumnDef{Name: "f4", T: ddl.Type{Name: ddl.Float64}},
@@ -249,8 +250,8 @@ func TestProcessInfoSchemaMYSQL(t *testing.T) {
 				"i2":  ddl.ColumnDef{Name: "i2", T: ddl.Type{Name: ddl.Int64}},
 				"si":  ddl.ColumnDef{Name: "si", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
 				"ts":  ddl.ColumnDef{Name: "ts", T: ddl.Type{Name: ddl.Timestamp}},
-				"tz":  ddl.ColumnDef{Name: "tz", T: ddl.Type{Name: ddl.Timestamp}},
-				"vc":  ddl.ColumnDef{Name: "vc", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"tz":  ddl.ColumnDef{Name: "tz", T: ddl.Type{Name: ddl.Timestamp}, Default: &ddl.Default{Now: true}},
+				"vc":  ddl.ColumnDef{Name: "vc", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, Default: &ddl.Default{Value: "it's"}},
 				"vc6": ddl.ColumnDef{Name: "vc6", T: ddl.Type{Name: ddl.String, Len: int64(6)}},
 			},
 			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "id"}},
@@ -273,7 +274,7 @@ func TestProcessInfoSchemaMYSQL(t *testing.T) {
 		"i4": []internal.SchemaIssue{internal.Widened, internal.AutoIncrement},
 		"i2": []internal.SchemaIssue{internal.Widened},
 		"si": []internal.SchemaIssue{internal.Widened, internal.DefaultValue},
-		"ts": []internal.SchemaIssue{internal.Datetime},
+		"ts": []internal.SchemaIssue{internal.Datetime, internal.DefaultValue}, // No time zone.
 	}
 	assert.Equal(t, expectedIssues, conv.Issues["test"])
 	assert.Equal(t, int64(0), conv.Unexpecteds())
@@ -286,6 +287,12 @@ func TestProcessSQLData(t *testing.T) {
 			args:  []driver.Value{"test"},
 			cols:  []string{"table_name"},
 			rows:  [][]driver.Value{{"te st"}},
+		}, {
+			query: "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			exec:  true,
+		}, {
+			query: "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+			exec:  true,
 		}, {
 			query: "SELECT (.+) FROM `test`.`te st`",
 			cols:  []string{"a a", " b", " c "},
@@ -293,6 +300,9 @@ func TestProcessSQLData(t *testing.T) {
 				{42.3, 3, "cat"},
 				{6.6, 22, "dog"},
 				{6.6, "2006-01-02", "dog"}}, // Test bad row logic.
+		}, {
+			query: "COMMIT",
+			exec:  true,
 		},
 	}
 	db := mkMockDB(t, ms)
@@ -320,7 +330,7 @@ func TestProcessSQLData(t *testing.T) {
 		func(table string, cols []string, vals []interface{}) {
 			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
 		})
-	ProcessSQLData(conv, db, "test")
+	ProcessSQLData(conv, db, "test", 1, 0)
 	assert.Equal(t,
 		[]spannerData{
 			spannerData{table: "te_st", cols: []string{"a_a", "Ab", "Ac_"}, vals: []interface{}{float64(42.3), int64(3), "cat"}},
@@ -347,11 +357,11 @@ func TestProcessSQLData_MultiCol(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"test", "test"},
-			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra"},
+			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra", "generation_expression"},
 			rows: [][]driver.Value{
-				{"a", "text", "text", "NO", nil, nil, nil, nil, nil},
-				{"b", "double", "double", "YES", nil, nil, 53, nil, nil},
-				{"c", "bigint", "bigint", "YES", nil, nil, 64, 0, nil}},
+				{"a", "text", "text", "NO", nil, nil, nil, nil, nil, nil},
+				{"b", "double", "double", "YES", nil, nil, 53, nil, nil, nil},
+				{"c", "bigint", "bigint", "YES", nil, nil, 64, 0, nil, nil}},
 		},
 		{
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
@@ -376,12 +386,21 @@ func TestProcessSQLData_MultiCol(t *testing.T) {
 			args:  []driver.Value{"test"},
 			cols:  []string{"table_name"},
 			rows:  [][]driver.Value{{"test"}},
+		}, {
+			query: "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			exec:  true,
+		}, {
+			query: "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+			exec:  true,
 		}, {
 			query: "SELECT (.+) FROM `test`.`test`",
 			cols:  []string{"a", "b", "c"},
 			rows: [][]driver.Value{
 				{"cat", 42.3, nil},
 				{"dog", nil, 22}},
+		}, {
+			query: "COMMIT",
+			exec:  true,
 		},
 	}
 	db := mkMockDB(t, ms)
@@ -410,7 +429,7 @@ func TestProcessSQLData_MultiCol(t *testing.T) {
 		func(table string, cols []string, vals []interface{}) {
 			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
 		})
-	ProcessSQLData(conv, db, "test")
+	ProcessSQLData(conv, db, "test", 1, 0)
 	assert.Equal(t, []spannerData{
 		{table: "test", cols: []string{"a", "b", "synth_id"}, vals: []interface{}{"cat", float64(42.3), int64(0)}},
 		{table: "test", cols: []string{"a", "c", "synth_id"}, vals: []interface{}{"dog", int64(22), int64(-9223372036854775808)}}},
@@ -418,6 +437,81 @@ func TestProcessSQLData_MultiCol(t *testing.T) {
 	assert.Equal(t, int64(0), conv.Unexpecteds())
 }
 
+func TestProcessSQLData_Generated(t *testing.T) {
+	// Generated columns are converted to Spanner generated columns,
+	// which aren't read or written, unless their expression can't be
+	// translated.
+	ms := []mockSpec{
+		{
+			query: "SELECT table_name FROM information_schema.tables where table_type = 'BASE TABLE' and (.+)",
+			args:  []driver.Value{"test"},
+			cols:  []string{"table_name"},
+			rows:  [][]driver.Value{{"test"}},
+		}, {
+			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
+			args:  []driver.Value{"test", "test"},
+			cols:  []string{"column_name", "data_type", "column_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "extra", "generation_expression"},
+			rows: [][]driver.Value{
+				{"a", "bigint", "bigint", "NO", nil, nil, 64, 0, nil, nil},
+				{"b", "bigint", "bigint", "YES", nil, nil, 64, 0, nil, nil},
+				{"c", "bigint", "bigint", "YES", nil, nil, 64, 0, "STORED GENERATED", "(`b` * 2)"},
+				{"d", "text", "text", "YES", nil, nil, nil, nil, "VIRTUAL GENERATED", "md5(`b`)"}},
+		}, {
+			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
+			args:  []driver.Value{"test", "test"},
+			cols:  []string{"column_name", "constraint_type"},
+			rows:  [][]driver.Value{{"a", "PRIMARY KEY"}},
+		}, {
+			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
+			args:  []driver.Value{"test", "test"},
+			cols:  []string{"REFERENCED_TABLE_NAME", "COLUMN_NAME", "REFERENCED_COLUMN_NAME", "CONSTRAINT_NAME"},
+		}, {
+			query: "SELECT (.+) FROM INFORMATION_SCHEMA.STATISTICS (.+)",
+			args:  []driver.Value{"test", "test"},
+			cols:  []string{"INDEX_NAME", "COLUMN_NAME", "SEQ_IN_INDEX", "COLLATION", "NON_UNIQUE"},
+		}, {
+			query: "SELECT table_name FROM information_schema.tables where table_type = 'BASE TABLE' and (.+)",
+			args:  []driver.Value{"test"},
+			cols:  []string{"table_name"},
+			rows:  [][]driver.Value{{"test"}},
+		}, {
+			query: "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+			exec:  true,
+		}, {
+			query: "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+			exec:  true,
+		}, {
+			query: "SELECT `a`,`b`,`d` FROM `test`.`test` ORDER BY `a`",
+			cols:  []string{"a", "b", "d"},
+			rows:  [][]driver.Value{{1, 2, "c81e728d9d4c2f636f067f89cc14862c"}},
+		}, {
+			query: "COMMIT",
+			exec:  true,
+		},
+	}
+	db := mkMockDB(t, ms)
+	conv := internal.MakeConv()
+	err := ProcessInfoSchema(conv, db, "test")
+	assert.Nil(t, err)
+	c := conv.SrcSchema["test"].ColDefs["c"]
+	assert.True(t, c.Ignored.Generated)
+	assert.Equal(t, "(`b` * 2)", c.Generated)
+	assert.NotNil(t, conv.SpSchema["test"].ColDefs["c"].Generated)
+	assert.Nil(t, conv.SpSchema["test"].ColDefs["d"].Generated)
+	assert.Contains(t, conv.Issues["test"]["d"], internal.GeneratedColumn)
+	conv.SetDataMode()
+	var rows []spannerData
+	conv.SetDataSink(
+		func(table string, cols []string, vals []interface{}) {
+			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
+		})
+	ProcessSQLData(conv, db, "test", 1, 0)
+	assert.Equal(t, []spannerData{
+		{table: "test", cols: []string{"a", "b", "d"}, vals: []interface{}{int64(1), int64(2), "c81e728d9d4c2f636f067f89cc14862c"}}},
+		rows)
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+}
+
 func TestSetRowStats(t *testing.T) {
 	ms := []mockSpec{
 		{
@@ -452,7 +546,9 @@ func mkMockDB(t *testing.T, ms []mockSpec) *sql.DB {
 		for _, r := range m.rows {
 			rows.AddRow(r...)
 		}
-		if len(m.args) > 0 {
+		if m.exec {
+			mock.ExpectExec(m.query).WillReturnResult(sqlmock.NewResult(0, 0))
+		} else if len(m.args) > 0 {
 			mock.ExpectQuery(m.query).WithArgs(m.args...).WillReturnRows(rows)
 		} else {
 			mock.ExpectQuery(m.query).WillReturnRows(rows)
@@ -25,6 +25,7 @@ import (
 	"github.com/cloudspannerecosystem/harbourbridge/schema"
 	"github.com/pingcap/parser"
 	"github.com/pingcap/parser/ast"
+	"github.com/pingcap/parser/format"
 	"github.com/pingcap/parser/opcode"
 	"github.com/pingcap/tidb/types"
 	driver "github.com/pingcap/tidb/types/parser_driver"
@@ -148,6 +149,10 @@ func processStatement(conv *internal.Conv, stmt ast.StmtNode) bool {
 		if conv.SchemaMode() {
 			processCreateIndex(conv, s)
 		}
+	case *ast.CreateViewStmt:
+		if conv.SchemaMode() {
+			processCreateView(conv, s)
+		}
 	default:
 		conv.SkipStatement(NodeType(stmt))
 	}
@@ -178,6 +183,34 @@ func processCreateIndex(conv *internal.Conv, stmt *ast.CreateIndexStmt) {
 	}
 }
 
+func processCreateView(conv *internal.Conv, stmt *ast.CreateViewStmt) {
+	if stmt.ViewName == nil || stmt.Select == nil {
+		logStmtError(conv, stmt, fmt.Errorf("cannot process view statement with nil name or query"))
+		return
+	}
+	viewName, err := getTableName(stmt.ViewName)
+	if err != nil {
+		logStmtError(conv, stmt, fmt.Errorf("can't get view name: %w", err))
+		return
+	}
+	if len(stmt.Cols) > 0 {
+		conv.SkipStatement(NodeType(stmt))
+		conv.Unexpected(fmt.Sprintf("Found view %s with a column list -- we do not currently handle these", viewName))
+		return
+	}
+	var sb strings.Builder
+	if err := stmt.Select.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		logStmtError(conv, stmt, fmt.Errorf("can't print query of view %s: %w", viewName, err))
+		return
+	}
+	// mysqldump creates a table (or view) with the same columns as each
+	// view before creating any views, so that views can be created in
+	// any order. Drop this stand-in table.
+	delete(conv.SrcSchema, viewName)
+	conv.SchemaStatement(NodeType(stmt))
+	conv.SrcViews[viewName] = schema.View{Name: viewName, Query: sb.String()}
+}
+
 func processSetStmt(conv *internal.Conv, stmt *ast.SetStmt) {
 	if stmt.Variables != nil && len(stmt.Variables) > 0 {
 		for _, variable := range stmt.Variables {
@@ -218,6 +251,7 @@ func processCreateTable(conv *internal.Conv, stmt *ast.CreateTableStmt) {
 	var keys []schema.Key
 	var fkeys []schema.ForeignKey
 	var index []schema.Index
+	var checks []schema.CheckConstraint
 	for _, element := range stmt.Cols {
 		colname, col, constraint, err := processColumn(conv, tableName, element)
 		if err != nil {
@@ -240,15 +274,17 @@ func processCreateTable(conv *internal.Conv, stmt *ast.CreateTableStmt) {
 			// database schemas into schema.go.
 			index = append(index, schema.Index{Name: "", Unique: true, Keys: []schema.Key{schema.Key{Column: colname, Desc: false}}})
 		}
+		checks = append(checks, constraint.checks...)
 	}
 	conv.SchemaStatement(NodeType(stmt))
 	conv.SrcSchema[tableName] = schema.Table{
-		Name:        tableName,
-		ColNames:    colNames,
-		ColDefs:     colDef,
-		PrimaryKeys: keys,
-		ForeignKeys: fkeys,
-		Indexes:     index}
+		Name:             tableName,
+		ColNames:         colNames,
+		ColDefs:          colDef,
+		PrimaryKeys:      keys,
+		ForeignKeys:      fkeys,
+		CheckConstraints: checks,
+		Indexes:          index}
 	for _, constraint := range stmt.Constraints {
 		processConstraint(conv, tableName, constraint, "CREATE TABLE")
 	}
@@ -277,6 +313,8 @@ func processConstraint(conv *internal.Conv, table string, constraint *ast.Constr
 		// appear in toddl.go. This file should focus on generic transformation from source
 		// database schemas into schema.go.
 		st.Indexes = append(st.Indexes, schema.Index{Name: constraint.Name, Unique: true, Keys: toSchemaKeys(constraint.Keys)})
+	case ast.ConstraintCheck:
+		st.CheckConstraints = append(st.CheckConstraints, schema.CheckConstraint{Name: constraint.Name, Expr: exprText(constraint.Expr)})
 	default:
 		updateCols(conv, ct, constraint.Keys, st.ColDefs, table)
 	}
@@ -330,8 +368,6 @@ func updateCols(conv *internal.Conv, ct ast.ConstraintType, colNames []*ast.Inde
 		switch ct {
 		case ast.ConstraintUniq:
 			cd.Unique = true
-		case ast.ConstraintCheck:
-			cd.Ignored.Check = true
 		case ast.ConstraintPrimaryKey:
 			cd.NotNull = true
 			cd.Unique = true
@@ -384,6 +420,11 @@ func processAlterTable(conv *internal.Conv, stmt *ast.AlterTableStmt) {
 					ctable.Indexes = append(ctable.Indexes, schema.Index{Name: "", Unique: true, Keys: []schema.Key{schema.Key{Column: colname, Desc: false}}})
 					conv.SrcSchema[tableName] = ctable
 				}
+				if constraint.checks != nil {
+					ctable := conv.SrcSchema[tableName]
+					ctable.CheckConstraints = append(ctable.CheckConstraints, constraint.checks...)
+					conv.SrcSchema[tableName] = ctable
+				}
 				conv.SchemaStatement(NodeType(stmt))
 			default:
 				conv.SkipStatement(NodeType(stmt))
@@ -439,6 +480,7 @@ type columnConstraint struct {
 	isPk        bool
 	isUniqueKey bool
 	fk          schema.ForeignKey
+	checks      []schema.CheckConstraint
 }
 
 // updateColsByOption is specifially for ColDef constraints.
@@ -466,12 +508,20 @@ func updateColsByOption(conv *internal.Conv, tableName string, col *ast.ColumnDe
 			nullDefault := ok && v.GetValue() == nil
 			if !nullDefault {
 				column.Ignored.Default = true
+				column.Default = defaultText(elem.Expr)
 			}
+		case ast.ColumnOptionGenerated:
+			// Spanner only has stored generated columns, so we
+			// translate virtual ones to stored ones too.
+			column.Ignored.Generated = true
+			column.Generated = exprText(elem.Expr)
 		case ast.ColumnOptionUniqKey:
 			column.Unique = true
 			cc.isUniqueKey = true
 		case ast.ColumnOptionCheck:
-			column.Ignored.Check = true
+			// Column check constraints are unnamed, and apply to
+			// the table just like table check constraints.
+			cc.checks = append(cc.checks, schema.CheckConstraint{Expr: exprText(elem.Expr)})
 		case ast.ColumnOptionReference:
 			column := col.Name.String()
 			referTable, err := getTableName(elem.Refer.Table)
@@ -748,6 +798,54 @@ func getVals(row []ast.ExprNode) ([]string, error) {
 	return values, nil
 }
 
+// defaultText returns the SQL text of default value expression expr,
+// for the expressions that internal.ToSpannerDefault can translate
+// (literals and calls such as CURRENT_TIMESTAMP(3)). It returns "" for
+// other expressions.
+func defaultText(expr ast.ExprNode) string {
+	switch e := expr.(type) {
+	case *driver.ValueExpr:
+		switch v := e.GetValue().(type) {
+		case nil:
+			return "NULL"
+		case string:
+			return "'" + strings.Replace(v, "'", "''", -1) + "'"
+		case int64, uint64, float64, *types.MyDecimal:
+			return fmt.Sprintf("%v", v)
+		}
+	case *ast.UnaryOperationExpr:
+		if v, ok := e.V.(*driver.ValueExpr); ok && e.Op == opcode.Minus {
+			if s, err := getNegativeUnaryVals(v); err == nil {
+				return s
+			}
+		}
+	case *ast.FuncCallExpr:
+		var args []string
+		for _, a := range e.Args {
+			s := defaultText(a)
+			if s == "" {
+				return ""
+			}
+			args = append(args, s)
+		}
+		return e.FnName.O + "(" + strings.Join(args, ", ") + ")"
+	}
+	return ""
+}
+
+// exprText returns the MySQL text of expression expr, or "" if it
+// can't be printed.
+func exprText(expr ast.ExprNode) string {
+	if expr == nil {
+		return ""
+	}
+	var sb strings.Builder
+	if err := expr.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return ""
+	}
+	return sb.String()
+}
+
 func getNegativeUnaryVals(valExpr *driver.ValueExpr) (string, error) {
 	switch val := valExpr.GetValue().(type) {
 	case int64:
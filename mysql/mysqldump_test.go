@@ -557,6 +557,66 @@ CREATE TABLE test (a text PRIMARY KEY, b text);`,
 					},
 					Pks: []ddl.IndexKey{ddl.IndexKey{Col: "a"}}}},
 		},
+		{
+			name:  "Default values",
+			input: "CREATE TABLE test (a text PRIMARY KEY, b text DEFAULT 'it''s', c bigint DEFAULT -7, d timestamp DEFAULT CURRENT_TIMESTAMP);\n",
+			expectedSchema: map[string]ddl.CreateTable{
+				"test": ddl.CreateTable{
+					Name:     "test",
+					ColNames: []string{"a", "b", "c", "d"},
+					ColDefs: map[string]ddl.ColumnDef{
+						"a": ddl.ColumnDef{Name: "a", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, NotNull: true},
+						"b": ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, Default: &ddl.Default{Value: "it's"}},
+						"c": ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.Int64}, Default: &ddl.Default{Value: "-7"}},
+						"d": ddl.ColumnDef{Name: "d", T: ddl.Type{Name: ddl.Timestamp}, Default: &ddl.Default{Now: true}},
+					},
+					Pks: []ddl.IndexKey{ddl.IndexKey{Col: "a"}}}},
+		},
+		{
+			name: "Check constraints",
+			input: "CREATE TABLE test (a text PRIMARY KEY, b text CHECK (b IN ('x','y')), c bigint, " +
+				"CONSTRAINT c_check CHECK (c > 0), CONSTRAINT c_odd CHECK (c % 2 = 1));\n",
+			expectedSchema: map[string]ddl.CreateTable{
+				"test": ddl.CreateTable{
+					Name:     "test",
+					ColNames: []string{"a", "b", "c"},
+					ColDefs: map[string]ddl.ColumnDef{
+						"a": ddl.ColumnDef{Name: "a", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, NotNull: true},
+						"b": ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+						"c": ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.Int64}},
+					},
+					Pks: []ddl.IndexKey{ddl.IndexKey{Col: "a"}},
+					Checks: []ddl.CheckConstraint{
+						ddl.CheckConstraint{Expr: []ddl.ExprToken{{Kind: ddl.ExprColumn, Text: "b"}, {Kind: ddl.ExprSymbol, Text: "IN"}, {Kind: ddl.ExprSymbol, Text: "("},
+							{Kind: ddl.ExprString, Text: "x"}, {Kind: ddl.ExprSymbol, Text: ","}, {Kind: ddl.ExprString, Text: "y"}, {Kind: ddl.ExprSymbol, Text: ")"}}},
+						ddl.CheckConstraint{Name: "c_check", Expr: []ddl.ExprToken{{Kind: ddl.ExprColumn, Text: "c"}, {Kind: ddl.ExprSymbol, Text: ">"}, {Kind: ddl.ExprSymbol, Text: "0"}}},
+					}}},
+			expectIssues: true, // The modulo operator isn't supported.
+		},
+		{
+			name: "Generated columns",
+			input: "CREATE TABLE test (a bigint PRIMARY KEY, b bigint GENERATED ALWAYS AS (a * 2) STORED, " +
+				"c text GENERATED ALWAYS AS (concat(d, '!')) VIRTUAL, d text, e bigint AS (length(d)));\n" +
+				"INSERT INTO test VALUES (1, 2, 'x!', 'x', 1);\n",
+			expectedSchema: map[string]ddl.CreateTable{
+				"test": ddl.CreateTable{
+					Name:     "test",
+					ColNames: []string{"a", "b", "c", "d", "e"},
+					ColDefs: map[string]ddl.ColumnDef{
+						"a": ddl.ColumnDef{Name: "a", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+						"b": ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.Int64}, Generated: []ddl.ExprToken{{Kind: ddl.ExprColumn, Text: "a"}, {Kind: ddl.ExprSymbol, Text: "*"}, {Kind: ddl.ExprSymbol, Text: "2"}}},
+						"c": ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, Generated: []ddl.ExprToken{
+							{Kind: ddl.ExprSymbol, Text: "CONCAT("}, {Kind: ddl.ExprColumn, Text: "d"}, {Kind: ddl.ExprSymbol, Text: ","}, {Kind: ddl.ExprString, Text: "!"}, {Kind: ddl.ExprSymbol, Text: ")"}}},
+						"d": ddl.ColumnDef{Name: "d", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+						"e": ddl.ColumnDef{Name: "e", T: ddl.Type{Name: ddl.Int64}},
+					},
+					Pks: []ddl.IndexKey{ddl.IndexKey{Col: "a"}}}},
+			// Values of generated columns aren't written, except for
+			// e, which we can't translate.
+			expectedData: []spannerData{
+				spannerData{table: "test", cols: []string{"a", "d", "e"}, vals: []interface{}{int64(1), "x", int64(1)}}},
+			expectIssues: true,
+		},
 		{
 			name: "Multiple statements on one line",
 			input: "CREATE TABLE t1 (a text, b text); CREATE TABLE t2 (c text);\n" +
@@ -909,6 +969,29 @@ func TestProcessMySQLDump_AddPrimaryKeys(t *testing.T) {
 	}
 }
 
+func TestProcessMySQLDump_Views(t *testing.T) {
+	conv, _ := runProcessMySQLDump(
+		"CREATE TABLE `t` (`a` bigint NOT NULL, `b-c` text, PRIMARY KEY (`a`));\n" +
+			"/*!50001 CREATE TABLE `v` (\n" +
+			"  `a` tinyint NOT NULL,\n" +
+			"  `b-c` tinyint NOT NULL\n" +
+			") ENGINE=MyISAM */;\n" +
+			"/*!50001 DROP TABLE IF EXISTS `v`*/;\n" +
+			"/*!50001 CREATE ALGORITHM=UNDEFINED */\n" +
+			"/*!50013 DEFINER=`root`@`localhost` SQL SECURITY DEFINER */\n" +
+			"/*!50001 VIEW `v` AS select `t`.`a` AS `a`,`t`.`b-c` AS `b-c` from `t` where (`t`.`a` > 0) */;\n" +
+			"/*!50001 CREATE ALGORITHM=UNDEFINED */\n" +
+			"/*!50013 DEFINER=`root`@`localhost` SQL SECURITY DEFINER */\n" +
+			"/*!50001 VIEW `w` AS select now() AS `ts` from `v` */;\n")
+	// The stand-in table for v is dropped.
+	_, ok := conv.SpSchema["v"]
+	assert.False(t, ok)
+	assert.Equal(t, []string{
+		"CREATE VIEW v SQL SECURITY INVOKER AS SELECT t.a AS a, t.b_c AS b_c FROM t WHERE (t.a > 0)",
+	}, conv.SpViews.GetDDL(ddl.Config{}))
+	assert.Equal(t, map[string]string{"w": "unsupported function NOW"}, conv.ViewIssues)
+}
+
 func runProcessMySQLDump(s string) (*internal.Conv, []spannerData) {
 	conv := internal.MakeConv()
 	conv.SetLocation(time.UTC)
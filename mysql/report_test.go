@@ -72,7 +72,7 @@ func TestReport(t *testing.T) {
 		`----------------------------
 Summary of Conversion
 ----------------------------
-Schema conversion: GOOD (most columns mapped cleanly, but some missing primary keys).
+Schema conversion: GOOD (all columns mapped cleanly, but some missing primary keys).
 Data conversion: POOR (66% of 6000 rows written to Spanner).
 
 The remainder of this report provides stats on the mysqldump statements
@@ -113,13 +113,9 @@ Note
 ----------------------------
 Table default_value
 ----------------------------
-Schema conversion: POOR (many columns did not map cleanly).
+Schema conversion: EXCELLENT (all columns mapped cleanly).
 Data conversion: NONE (no data rows found).
 
-Warning
-1) Some columns have default values which Spanner does not support e.g. column
-   'b'.
-
 ----------------------------
 Table excellent_schema
 ----------------------------
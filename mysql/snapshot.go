@@ -0,0 +1,186 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+)
+
+// querier runs queries against the source database. It is implemented
+// by *sql.DB and by the connections of a snapshot.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// snapshot is a set of connections, one for each worker reading table
+// data, whose transactions all read the same snapshot of the database,
+// so rows read from different tables are consistent with each other.
+type snapshot struct {
+	conns    []*sql.Conn
+	position string // Binlog position of the snapshot, if requested (see newSnapshot).
+}
+
+// newSnapshot starts a transaction WITH CONSISTENT SNAPSHOT on each of
+// n connections to db. Unlike PostgreSQL, MySQL can't share a snapshot
+// between connections, so when there are several connections we hold
+// a global read lock (FLUSH TABLES WITH READ LOCK) while starting the
+// transactions, so that no writes commit between them. The lock is
+// released as soon as the transactions have started. It requires the
+// RELOAD privilege.
+//
+// If binlogPos is set, newSnapshot also records the binlog position of
+// the snapshot in s.position, so that changes made after the snapshot
+// can be read from the binlog (see StreamChanges). This also needs the
+// lock (even for a single connection), and the REPLICATION CLIENT
+// privilege.
+func newSnapshot(db *sql.DB, n int, binlogPos bool) (*snapshot, error) {
+	ctx := context.Background()
+	s := &snapshot{}
+	if n > 1 || binlogPos {
+		lock, err := db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer lock.Close()
+		if _, err := lock.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK;"); err != nil {
+			if binlogPos {
+				return nil, fmt.Errorf("can't lock tables to record the binlog position of the snapshot (the RELOAD privilege is needed): %w", err)
+			}
+			return nil, fmt.Errorf("can't lock tables to share a snapshot between %d readers (use read-workers 1 if the RELOAD privilege isn't available): %w", n, err)
+		}
+		defer lock.ExecContext(ctx, "UNLOCK TABLES;")
+		if binlogPos {
+			// No writes can commit while we hold the lock, so the current
+			// binlog position is the position of the snapshot.
+			if s.position, err = masterStatus(conn{lock}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		c, err := db.Conn(ctx)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.conns = append(s.conns, c)
+		// Consistent snapshots require REPEATABLE READ, which might not
+		// be the server's default isolation level.
+		if _, err := c.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ;"); err != nil {
+			s.close()
+			return nil, err
+		}
+		if _, err := c.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY;"); err != nil {
+			s.close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// masterStatus returns the current binlog position of the server, in
+// the form used by binlogPosition.
+func masterStatus(db querier) (string, error) {
+	rows, err := db.Query("SHOW MASTER STATUS;")
+	if err != nil {
+		return "", fmt.Errorf("can't get binlog position: %w", err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("can't get binlog position: binary logging is disabled")
+	}
+	// The set of columns depends on the MySQL version, so we scan all of
+	// them and pick out File and Position.
+	vals := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", err
+	}
+	var file, pos string
+	for i, c := range cols {
+		switch c {
+		case "File":
+			file = vals[i].String
+		case "Position":
+			pos = vals[i].String
+		}
+	}
+	p, err := parseBinlogPosition(file + ":" + pos)
+	if err != nil {
+		return "", err
+	}
+	return p.String(), nil
+}
+
+// reader returns the querier for worker w.
+func (s *snapshot) reader(w int) querier {
+	return conn{s.conns[w]}
+}
+
+// close ends the snapshot's transactions and releases its connections.
+func (s *snapshot) close() {
+	for _, c := range s.conns {
+		// The transactions are read-only, so there's nothing to commit,
+		// and a failure doesn't affect data already read.
+		c.ExecContext(context.Background(), "COMMIT;")
+		c.Close()
+	}
+}
+
+// conn adapts a *sql.Conn to querier.
+type conn struct {
+	c *sql.Conn
+}
+
+func (c conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.c.QueryContext(context.Background(), query, args...)
+}
+
+func (c conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.c.QueryRowContext(context.Background(), query, args...)
+}
+
+// readers returns a function that gives the querier for each of
+// workers go routines reading data (see internal.ForEachWorker), and a
+// function to call when reading is done. Readers share a consistent
+// snapshot of db. If we can't start the snapshot, readers query db
+// directly, and we report the problem as unexpected. If
+// conv.CaptureChanges is set, the binlog position of the snapshot is
+// saved in conv.ChangePosition (and left empty if there is no
+// snapshot).
+func readers(conv *internal.Conv, db *sql.DB, workers int) (func(w int) querier, func()) {
+	s, err := newSnapshot(db, internal.Workers(workers), conv.CaptureChanges != "")
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't start a consistent snapshot, so tables are read at different times: %s", err))
+		return func(int) querier { return db }, func() {}
+	}
+	conv.ChangePosition = s.position
+	return s.reader, s.close
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mysql
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	ok := sqlmock.NewResult(0, 0)
+	// Transactions are started while holding a global read lock.
+	mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnResult(ok)
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ").WillReturnResult(ok)
+		mock.ExpectExec("START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY").WillReturnResult(ok)
+	}
+	mock.ExpectExec("UNLOCK TABLES").WillReturnResult(ok)
+	mock.ExpectExec("COMMIT").WillReturnResult(ok)
+	mock.ExpectExec("COMMIT").WillReturnResult(ok)
+	s, err := newSnapshot(db, 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(s.conns))
+	s.close()
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestNewSnapshot_BinlogPosition(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	ok := sqlmock.NewResult(0, 0)
+	// The lock is needed to read the binlog position of the snapshot,
+	// even with a single connection.
+	mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnResult(ok)
+	mock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("mysql-bin.000003", "1234", "", "", ""))
+	mock.ExpectExec("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ").WillReturnResult(ok)
+	mock.ExpectExec("START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY").WillReturnResult(ok)
+	mock.ExpectExec("UNLOCK TABLES").WillReturnResult(ok)
+	mock.ExpectExec("COMMIT").WillReturnResult(ok)
+	conv := internal.MakeConv()
+	conv.CaptureChanges = "/var/lib/mysql"
+	_, done := readers(conv, db, 1)
+	done()
+	assert.Equal(t, "mysql-bin.000003:1234", conv.ChangePosition)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReaders_NoSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	mock.ExpectExec("FLUSH TABLES WITH READ LOCK").WillReturnError(errors.New("access denied; you need the RELOAD privilege"))
+	conv := internal.MakeConv()
+	reader, done := readers(conv, db, 2)
+	defer done()
+	// Tables are read without a snapshot, and the problem is reported.
+	assert.Equal(t, db, reader(0))
+	assert.Equal(t, int64(1), conv.Unexpecteds())
+}
@@ -0,0 +1,514 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracle
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	_ "github.com/sijms/go-ora/v2" // The driver should be used via the database/sql package.
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+)
+
+// ProcessInfoSchema performs schema conversion for source database
+// 'db'. Oracle doesn't support INFORMATION_SCHEMA, so we use Oracle's
+// data dictionary views (ALL_TABLES, ALL_TAB_COLUMNS, ALL_CONSTRAINTS
+// and ALL_INDEXES). We convert the tables in the current schema (by
+// default, the schema of the user we connect as).
+func ProcessInfoSchema(conv *internal.Conv, db *sql.DB) error {
+	tables, err := getTables(db)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := processTable(conv, db, t); err != nil {
+			return err
+		}
+	}
+	if err := internal.SchemaToDDL(conv, toSpannerType); err != nil {
+		return err
+	}
+	conv.AddPrimaryKeys()
+	return nil
+}
+
+// ProcessSQLData performs data conversion for source database
+// 'db'. For each table, we extract data using a "SELECT (colNamesList)"
+// query, convert the data to Spanner data (based on the source and
+// Spanner schemas), and write it to Spanner. If we can't get/process
+// data for a table, we skip that table and process the remaining tables.
+func ProcessSQLData(conv *internal.Conv, db *sql.DB) {
+	// TODO: refactor to use the set of tables computed by
+	// ProcessInfoSchema instead of computing them again.
+	tables, err := getTables(db)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get list of table: %s", err))
+		return
+	}
+	for _, t := range tables {
+		srcTable := t.name
+		srcSchema, ok := conv.SrcSchema[srcTable]
+		if !ok {
+			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
+			conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
+			continue
+		}
+		if len(srcSchema.ColNames) == 0 {
+			conv.Unexpected(fmt.Sprintf("Couldn't get source columns for table %s ", srcTable))
+			continue
+		}
+		// Primary key order keeps rows in the same order across runs,
+		// which resuming a migration relies on.
+		q := fmt.Sprintf("SELECT %s FROM %s.%s%s", buildColNameList(srcSchema), quoteIdent(t.schema), quoteIdent(t.name), orderBy(srcSchema))
+		rows, err := db.Query(q)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't get data for table %s : err = %s", srcTable, err))
+			continue
+		}
+		defer rows.Close()
+		srcCols, err1 := rows.Columns()
+		spTable, err2 := internal.GetSpannerTable(conv, srcTable)
+		spCols, err3 := internal.GetSpannerCols(conv, srcTable, srcCols)
+		spSchema, ok := conv.SpSchema[spTable]
+		if err1 != nil || err2 != nil || err3 != nil || !ok {
+			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
+			conv.Unexpected(fmt.Sprintf("Can't get cols and schemas for table %s: err1=%s, err2=%s, err3=%s, ok=%t",
+				srcTable, err1, err2, err3, ok))
+			continue
+		}
+		v, iv := buildVals(len(srcCols))
+		for rows.Next() {
+			err := rows.Scan(iv...)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+				// Scan failed, so we don't have any data to add to bad rows.
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				continue
+			}
+			cvtCols, cvtVals, err := ConvertSQLRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, v)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				conv.CollectBadRow(srcTable, srcCols, valsToStrings(v))
+				continue
+			}
+			conv.WriteRow(srcTable, spTable, cvtCols, cvtVals)
+		}
+	}
+}
+
+// buildColNameList builds the list of columns to select from a table.
+// NUMBER and FLOAT columns are converted to strings on the server
+// (using the 'TM9' text-minimum format) so that we don't lose precision
+// by going through float64 in the driver. INTERVAL columns are also
+// converted to strings since there is no go representation of them.
+// Each column keeps its original name so that results can be matched
+// against the source schema.
+func buildColNameList(srcSchema schema.Table) string {
+	var l []string
+	for _, colName := range srcSchema.ColNames {
+		col := quoteIdent(colName)
+		switch name := srcSchema.ColDefs[colName].Type.Name; {
+		case name == "NUMBER" || name == "FLOAT":
+			col = fmt.Sprintf("TO_CHAR(%s, 'TM9') AS %s", col, col)
+		case strings.HasPrefix(name, "INTERVAL"):
+			col = fmt.Sprintf("TO_CHAR(%s) AS %s", col, col)
+		}
+		l = append(l, col)
+	}
+	return strings.Join(l, ", ")
+}
+
+// SetRowStats populates conv with the number of rows in each table.
+func SetRowStats(conv *internal.Conv, db *sql.DB) {
+	// TODO: refactor to use the set of tables computed by
+	// ProcessInfoSchema instead of computing them again.
+	tables, err := getTables(db)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get list of table: %s", err))
+		return
+	}
+	for _, t := range tables {
+		q := fmt.Sprintf("SELECT COUNT(*) FROM %s.%s", quoteIdent(t.schema), quoteIdent(t.name))
+		rows, err := db.Query(q)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't get number of rows for table %s", t.name))
+			continue
+		}
+		defer rows.Close()
+		var count int64
+		if rows.Next() {
+			err := rows.Scan(&count)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Can't get row count: %s", err))
+				continue
+			}
+			conv.Stats.Rows[t.name] += count
+		}
+	}
+}
+
+type schemaAndName struct {
+	schema string // Oracle schema (the table's owner).
+	name   string
+}
+
+// getTables returns the list of tables in the current schema. We skip
+// temporary, nested and secondary tables, as well as dropped tables
+// (which are still listed in ALL_TABLES while they are in the recycle
+// bin).
+func getTables(db *sql.DB) ([]schemaAndName, error) {
+	q := `SELECT OWNER, TABLE_NAME FROM ALL_TABLES
+              WHERE OWNER = SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA')
+                AND TEMPORARY = 'N' AND NESTED = 'NO' AND SECONDARY = 'N' AND DROPPED = 'NO'
+              ORDER BY TABLE_NAME`
+	rows, err := db.Query(q)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get tables: %w", err)
+	}
+	defer rows.Close()
+	var owner, tableName string
+	var tables []schemaAndName
+	for rows.Next() {
+		rows.Scan(&owner, &tableName)
+		tables = append(tables, schemaAndName{schema: owner, name: tableName})
+	}
+	return tables, nil
+}
+
+func processTable(conv *internal.Conv, db *sql.DB, table schemaAndName) error {
+	cols, err := getColumns(table, db)
+	if err != nil {
+		return fmt.Errorf("couldn't get schema for table %s.%s: %s", table.schema, table.name, err)
+	}
+	defer cols.Close()
+	primaryKeys, constraints, err := getConstraints(conv, db, table)
+	if err != nil {
+		return fmt.Errorf("couldn't get constraints for table %s.%s: %s", table.schema, table.name, err)
+	}
+	foreignKeys, err := getForeignKeys(conv, db, table)
+	if err != nil {
+		return fmt.Errorf("couldn't get foreign key constraints for table %s.%s: %s", table.schema, table.name, err)
+	}
+	indexes, err := getIndexes(conv, db, table)
+	if err != nil {
+		return fmt.Errorf("couldn't get indexes for table %s.%s: %s", table.schema, table.name, err)
+	}
+	colDefs, colNames := processColumns(conv, cols, constraints)
+	var schemaPKeys []schema.Key
+	for _, k := range primaryKeys {
+		schemaPKeys = append(schemaPKeys, schema.Key{Column: k})
+	}
+	conv.SrcSchema[table.name] = schema.Table{
+		Name:        table.name,
+		ColNames:    colNames,
+		ColDefs:     colDefs,
+		PrimaryKeys: schemaPKeys,
+		Indexes:     indexes,
+		ForeignKeys: foreignKeys}
+	return nil
+}
+
+func getColumns(table schemaAndName, db *sql.DB) (*sql.Rows, error) {
+	q := `SELECT COLUMN_NAME, DATA_TYPE, NULLABLE, DATA_DEFAULT, DATA_LENGTH, CHAR_LENGTH, DATA_PRECISION, DATA_SCALE, IDENTITY_COLUMN
+              FROM ALL_TAB_COLUMNS
+              WHERE OWNER = :1 AND TABLE_NAME = :2 ORDER BY COLUMN_ID`
+	return db.Query(q, table.schema, table.name)
+}
+
+func processColumns(conv *internal.Conv, cols *sql.Rows, constraints map[string][]string) (map[string]schema.Column, []string) {
+	colDefs := make(map[string]schema.Column)
+	var colNames []string
+	var colName, dataType, nullable string
+	var colDefault, identity sql.NullString
+	var dataLen, charLen, precision, scale sql.NullInt64
+	for cols.Next() {
+		err := cols.Scan(&colName, &dataType, &nullable, &colDefault, &dataLen, &charLen, &precision, &scale, &identity)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		unique := false
+		ignored := schema.Ignored{}
+		for _, c := range constraints[colName] {
+			// c can be UNIQUE, PRIMARY KEY or CHECK.
+			// We've already filtered out PRIMARY KEY.
+			switch c {
+			case "UNIQUE":
+				unique = true
+			case "CHECK":
+				ignored.Check = true
+			case "PRIMARY KEY":
+				// Nothing to do here -- handled elsewhere.
+			}
+		}
+		ignored.Default = colDefault.Valid && strings.TrimSpace(colDefault.String) != ""
+		ignored.AutoIncrement = identity.String == "YES"
+		c := schema.Column{
+			Name:    colName,
+			Type:    toType(dataType, dataLen, charLen, precision, scale),
+			NotNull: toNotNull(conv, nullable),
+			Unique:  unique,
+			Ignored: ignored,
+		}
+		colDefs[colName] = c
+		colNames = append(colNames, colName)
+	}
+	return colDefs, colNames
+}
+
+// getConstraints returns a list of primary keys and by-column map of
+// other constraints.  Note: we need to preserve ordinal order of
+// columns in primary key constraints.
+// Note that foreign key constraints are handled in getForeignKeys.
+// Oracle implements NOT NULL as a check constraint with a system
+// generated name. We skip these (NOT NULL is handled via the NULLABLE
+// column of ALL_TAB_COLUMNS), at the cost of also skipping any other
+// unnamed check constraints.
+func getConstraints(conv *internal.Conv, db *sql.DB, table schemaAndName) ([]string, map[string][]string, error) {
+	q := `SELECT cc.COLUMN_NAME, c.CONSTRAINT_TYPE
+              FROM ALL_CONSTRAINTS c
+                INNER JOIN ALL_CONS_COLUMNS cc
+                  ON c.OWNER = cc.OWNER AND c.CONSTRAINT_NAME = cc.CONSTRAINT_NAME AND c.TABLE_NAME = cc.TABLE_NAME
+              WHERE c.OWNER = :1 AND c.TABLE_NAME = :2
+                AND (c.CONSTRAINT_TYPE IN ('P', 'U') OR (c.CONSTRAINT_TYPE = 'C' AND c.GENERATED = 'USER NAME'))
+              ORDER BY cc.POSITION`
+	rows, err := db.Query(q, table.schema, table.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var primaryKeys []string
+	var col, constraint string
+	m := make(map[string][]string)
+	for rows.Next() {
+		err := rows.Scan(&col, &constraint)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		if col == "" || constraint == "" {
+			conv.Unexpected(fmt.Sprintf("Got empty col or constraint"))
+			continue
+		}
+		switch constraint {
+		case "P":
+			primaryKeys = append(primaryKeys, col)
+		case "U":
+			m[col] = append(m[col], "UNIQUE")
+		case "C":
+			m[col] = append(m[col], "CHECK")
+		default:
+			conv.Unexpected(fmt.Sprintf("Got unexpected constraint type %s", constraint))
+		}
+	}
+	return primaryKeys, m, nil
+}
+
+type fkConstraint struct {
+	name    string
+	table   string
+	refcols []string
+	cols    []string
+}
+
+// getForeignKeys returns a list of all the foreign key constraints.
+// We ignore foreign keys that reference tables in other schemas
+// because HarbourBridge converts one schema at a time.
+func getForeignKeys(conv *internal.Conv, db *sql.DB, table schemaAndName) (foreignKeys []schema.ForeignKey, err error) {
+	q := `SELECT r.TABLE_NAME, cc.COLUMN_NAME, rc.COLUMN_NAME, c.CONSTRAINT_NAME
+		FROM ALL_CONSTRAINTS c
+		INNER JOIN ALL_CONS_COLUMNS cc
+			ON c.OWNER = cc.OWNER AND c.CONSTRAINT_NAME = cc.CONSTRAINT_NAME
+		INNER JOIN ALL_CONSTRAINTS r
+			ON c.R_OWNER = r.OWNER AND c.R_CONSTRAINT_NAME = r.CONSTRAINT_NAME
+		INNER JOIN ALL_CONS_COLUMNS rc
+			ON r.OWNER = rc.OWNER AND r.CONSTRAINT_NAME = rc.CONSTRAINT_NAME AND cc.POSITION = rc.POSITION
+		WHERE c.OWNER = :1
+			AND c.TABLE_NAME = :2
+			AND c.CONSTRAINT_TYPE = 'R'
+			AND c.R_OWNER = c.OWNER
+		ORDER BY c.CONSTRAINT_NAME, cc.POSITION`
+	rows, err := db.Query(q, table.schema, table.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var col, refCol, refTable, fKeyName string
+	fKeys := make(map[string]fkConstraint)
+	var keyNames []string
+	for rows.Next() {
+		err := rows.Scan(&refTable, &col, &refCol, &fKeyName)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		if _, found := fKeys[fKeyName]; found {
+			fk := fKeys[fKeyName]
+			fk.cols = append(fk.cols, col)
+			fk.refcols = append(fk.refcols, refCol)
+			fKeys[fKeyName] = fk
+			continue
+		}
+		fKeys[fKeyName] = fkConstraint{name: fKeyName, table: refTable, refcols: []string{refCol}, cols: []string{col}}
+		keyNames = append(keyNames, fKeyName)
+	}
+	sort.Strings(keyNames)
+	for _, k := range keyNames {
+		foreignKeys = append(foreignKeys,
+			schema.ForeignKey{
+				Name:         fKeys[k].name,
+				Columns:      fKeys[k].cols,
+				ReferTable:   fKeys[k].table,
+				ReferColumns: fKeys[k].refcols})
+	}
+	return foreignKeys, nil
+}
+
+// getIndexes return a list of all indexes for the specified table.
+// We skip the index used to implement the primary key, as well as
+// function-based indexes (note that Oracle implements descending index
+// keys using function-based indexes, so these are also skipped).
+func getIndexes(conv *internal.Conv, db *sql.DB, table schemaAndName) ([]schema.Index, error) {
+	q := `SELECT i.INDEX_NAME, ic.COLUMN_NAME, ic.COLUMN_POSITION, i.UNIQUENESS, ic.DESCEND
+		FROM ALL_INDEXES i
+		INNER JOIN ALL_IND_COLUMNS ic
+			ON i.OWNER = ic.INDEX_OWNER AND i.INDEX_NAME = ic.INDEX_NAME
+		WHERE i.TABLE_OWNER = :1
+			AND i.TABLE_NAME = :2
+			AND i.INDEX_TYPE = 'NORMAL'
+			AND NOT EXISTS (
+				SELECT 1 FROM ALL_CONSTRAINTS c
+				WHERE c.OWNER = i.TABLE_OWNER AND c.TABLE_NAME = i.TABLE_NAME
+					AND c.INDEX_NAME = i.INDEX_NAME AND c.CONSTRAINT_TYPE = 'P')
+		ORDER BY i.INDEX_NAME, ic.COLUMN_POSITION`
+	rows, err := db.Query(q, table.schema, table.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var name, column, uniqueness, descend string
+	var sequence int64
+	indexMap := make(map[string]schema.Index)
+	var indexNames []string
+	var indexes []schema.Index
+	for rows.Next() {
+		if err := rows.Scan(&name, &column, &sequence, &uniqueness, &descend); err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		if _, found := indexMap[name]; !found {
+			indexNames = append(indexNames, name)
+			indexMap[name] = schema.Index{Name: name, Unique: (uniqueness == "UNIQUE")}
+		}
+		index := indexMap[name]
+		index.Keys = append(index.Keys, schema.Key{Column: column, Desc: (descend == "DESC")})
+		indexMap[name] = index
+	}
+	for _, k := range indexNames {
+		indexes = append(indexes, indexMap[k])
+	}
+	return indexes, nil
+}
+
+// fracPrecision matches the fractional seconds precision in Oracle's
+// TIMESTAMP and INTERVAL type names e.g. "TIMESTAMP(6) WITH TIME ZONE".
+var fracPrecision = regexp.MustCompile(`\([0-9]+\)`)
+
+// toType builds a schema.Type from ALL_TAB_COLUMNS data. We drop the
+// fractional seconds precision from TIMESTAMP and INTERVAL types. For
+// NUMBER, mods are the precision and scale: a NUMBER declared with a
+// scale but no precision (e.g. INTEGER, which is NUMBER(*,0)) has the
+// maximum precision of 38, and a NUMBER declared without precision or
+// scale has no mods.
+func toType(dataType string, dataLen, charLen, precision, scale sql.NullInt64) schema.Type {
+	switch {
+	case strings.HasPrefix(dataType, "TIMESTAMP") || strings.HasPrefix(dataType, "INTERVAL"):
+		return schema.Type{Name: fracPrecision.ReplaceAllString(dataType, "")}
+	case dataType == "NUMBER" && precision.Valid:
+		return schema.Type{Name: dataType, Mods: []int64{precision.Int64, scale.Int64}}
+	case dataType == "NUMBER" && scale.Valid:
+		return schema.Type{Name: dataType, Mods: []int64{38, scale.Int64}}
+	case dataType == "FLOAT" && precision.Valid:
+		return schema.Type{Name: dataType, Mods: []int64{precision.Int64}}
+	case dataType == "RAW" && dataLen.Valid:
+		return schema.Type{Name: dataType, Mods: []int64{dataLen.Int64}}
+	case charLen.Valid && charLen.Int64 > 0:
+		return schema.Type{Name: dataType, Mods: []int64{charLen.Int64}}
+	default:
+		return schema.Type{Name: dataType}
+	}
+}
+
+func toNotNull(conv *internal.Conv, nullable string) bool {
+	switch nullable {
+	case "Y":
+		return false
+	case "N":
+		return true
+	}
+	conv.Unexpected(fmt.Sprintf("nullable column has unknown value: %s", nullable))
+	return false
+}
+
+// buildVals contructs interface{} value containers to scan row
+// results into.  Returns both the underlying containers (as a slice)
+// as well as an interface{} of pointers to containers to pass to
+// rows.Scan.
+func buildVals(n int) (v []interface{}, iv []interface{}) {
+	v = make([]interface{}, n)
+	for i := range v {
+		iv = append(iv, &v[i])
+	}
+	return v, iv
+}
+
+func valsToStrings(vals []interface{}) []string {
+	toString := func(val interface{}) string {
+		if val == nil {
+			return "NULL"
+		}
+		return fmt.Sprintf("%v", val)
+	}
+	var s []string
+	for _, v := range vals {
+		s = append(s, toString(v))
+	}
+	return s
+}
+
+// quoteIdent quotes an Oracle identifier. Oracle schema and table
+// names can't be passed as query parameters, so we quote them instead.
+func quoteIdent(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// orderBy returns an ORDER BY clause that sorts rows of table t by its
+// primary key, or "" if t has no primary key.
+func orderBy(t schema.Table) string {
+	var keys []string
+	for _, k := range t.PrimaryKeys {
+		keys = append(keys, quoteIdent(k.Column))
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
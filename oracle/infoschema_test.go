@@ -0,0 +1,319 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracle
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+type mockSpec struct {
+	query string
+	args  []driver.Value   // Query args.
+	cols  []string         // Columns names for returned rows.
+	rows  [][]driver.Value // Set of rows returned.
+}
+
+type spannerData struct {
+	table string
+	cols  []string
+	vals  []interface{}
+}
+
+func TestProcessInfoSchema(t *testing.T) {
+	colCols := []string{"COLUMN_NAME", "DATA_TYPE", "NULLABLE", "DATA_DEFAULT", "DATA_LENGTH", "CHAR_LENGTH", "DATA_PRECISION", "DATA_SCALE", "IDENTITY_COLUMN"}
+	ms := []mockSpec{
+		{
+			query: "SELECT OWNER, TABLE_NAME FROM ALL_TABLES (.+)",
+			cols:  []string{"OWNER", "TABLE_NAME"},
+			rows: [][]driver.Value{
+				{"HR", "CART"},
+				{"HR", "USERS"}},
+		}, {
+			query: "SELECT (.+) FROM ALL_TAB_COLUMNS (.+)",
+			args:  []driver.Value{"HR", "CART"},
+			cols:  colCols,
+			rows: [][]driver.Value{
+				{"USER_ID", "NUMBER", "N", nil, 22, 0, 10, 0, "NO"},
+				{"QTY", "NUMBER", "Y", nil, 22, 0, 10, 2, "NO"},
+				{"TOTAL", "NUMBER", "Y", nil, 22, 0, nil, nil, "NO"},
+				{"NOTE", "XMLTYPE", "Y", nil, 2000, 0, nil, nil, "NO"}},
+		}, {
+			query: "SELECT (.+) FROM ALL_CONSTRAINTS c INNER JOIN ALL_CONS_COLUMNS cc (.+)c.CONSTRAINT_TYPE IN (.+)",
+			args:  []driver.Value{"HR", "CART"},
+			cols:  []string{"COLUMN_NAME", "CONSTRAINT_TYPE"},
+			rows: [][]driver.Value{
+				{"QTY", "C"}},
+		}, {
+			query: "SELECT (.+) FROM ALL_CONSTRAINTS c (.+) c.CONSTRAINT_TYPE = 'R' (.+)",
+			args:  []driver.Value{"HR", "CART"},
+			cols:  []string{"TABLE_NAME", "COLUMN_NAME", "COLUMN_NAME", "CONSTRAINT_NAME"},
+			rows: [][]driver.Value{
+				{"USERS", "USER_ID", "USER_ID", "FK_CART_USER"}},
+		}, {
+			query: "SELECT (.+) FROM ALL_INDEXES i (.+)",
+			args:  []driver.Value{"HR", "CART"},
+			cols:  []string{"INDEX_NAME", "COLUMN_NAME", "COLUMN_POSITION", "UNIQUENESS", "DESCEND"},
+		}, {
+			query: "SELECT (.+) FROM ALL_TAB_COLUMNS (.+)",
+			args:  []driver.Value{"HR", "USERS"},
+			cols:  colCols,
+			rows: [][]driver.Value{
+				{"USER_ID", "NUMBER", "N", nil, 22, 0, 10, 0, "YES"},
+				{"NAME", "VARCHAR2", "N", nil, 400, 100, nil, nil, "NO"},
+				{"BIO", "CLOB", "Y", nil, 4000, 0, nil, nil, "NO"},
+				{"PHOTO", "RAW", "Y", nil, 16, 0, nil, nil, "NO"},
+				{"SCORE", "BINARY_DOUBLE", "Y", nil, 8, 0, nil, nil, "NO"},
+				{"JOINED", "DATE", "N", "SYSDATE ", 7, 0, nil, nil, "NO"},
+				{"UPDATED", "TIMESTAMP(6) WITH TIME ZONE", "Y", nil, 13, 0, nil, 6, "NO"}},
+		}, {
+			query: "SELECT (.+) FROM ALL_CONSTRAINTS c INNER JOIN ALL_CONS_COLUMNS cc (.+)c.CONSTRAINT_TYPE IN (.+)",
+			args:  []driver.Value{"HR", "USERS"},
+			cols:  []string{"COLUMN_NAME", "CONSTRAINT_TYPE"},
+			rows: [][]driver.Value{
+				{"USER_ID", "P"},
+				{"NAME", "U"}},
+		}, {
+			query: "SELECT (.+) FROM ALL_CONSTRAINTS c (.+) c.CONSTRAINT_TYPE = 'R' (.+)",
+			args:  []driver.Value{"HR", "USERS"},
+			cols:  []string{"TABLE_NAME", "COLUMN_NAME", "COLUMN_NAME", "CONSTRAINT_NAME"},
+		}, {
+			query: "SELECT (.+) FROM ALL_INDEXES i (.+)",
+			args:  []driver.Value{"HR", "USERS"},
+			cols:  []string{"INDEX_NAME", "COLUMN_NAME", "COLUMN_POSITION", "UNIQUENESS", "DESCEND"},
+			rows: [][]driver.Value{
+				{"IX_JOINED", "JOINED", 1, "NONUNIQUE", "ASC"},
+				{"IX_JOINED", "SCORE", 2, "NONUNIQUE", "ASC"}},
+		},
+	}
+	db := mkMockDB(t, ms)
+	conv := internal.MakeConv()
+	err := ProcessInfoSchema(conv, db)
+	assert.Nil(t, err)
+	expectedSchema := map[string]ddl.CreateTable{
+		"USERS": ddl.CreateTable{
+			Name:     "USERS",
+			ColNames: []string{"USER_ID", "NAME", "BIO", "PHOTO", "SCORE", "JOINED", "UPDATED"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"USER_ID": ddl.ColumnDef{Name: "USER_ID", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"NAME":    ddl.ColumnDef{Name: "NAME", T: ddl.Type{Name: ddl.String, Len: int64(100)}, NotNull: true},
+				"BIO":     ddl.ColumnDef{Name: "BIO", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"PHOTO":   ddl.ColumnDef{Name: "PHOTO", T: ddl.Type{Name: ddl.Bytes, Len: int64(16)}},
+				"SCORE":   ddl.ColumnDef{Name: "SCORE", T: ddl.Type{Name: ddl.Float64}},
+				"JOINED":  ddl.ColumnDef{Name: "JOINED", T: ddl.Type{Name: ddl.Timestamp}, NotNull: true},
+				"UPDATED": ddl.ColumnDef{Name: "UPDATED", T: ddl.Type{Name: ddl.Timestamp}},
+			},
+			Pks:     []ddl.IndexKey{ddl.IndexKey{Col: "USER_ID"}},
+			Indexes: []ddl.CreateIndex{ddl.CreateIndex{Name: "IX_JOINED", Table: "USERS", Keys: []ddl.IndexKey{ddl.IndexKey{Col: "JOINED"}, ddl.IndexKey{Col: "SCORE"}}}},
+		},
+		"CART": ddl.CreateTable{
+			Name:     "CART",
+			ColNames: []string{"USER_ID", "QTY", "TOTAL", "NOTE", "synth_id"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"USER_ID":  ddl.ColumnDef{Name: "USER_ID", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"QTY":      ddl.ColumnDef{Name: "QTY", T: ddl.Type{Name: ddl.Numeric}},
+				"TOTAL":    ddl.ColumnDef{Name: "TOTAL", T: ddl.Type{Name: ddl.Numeric}},
+				"NOTE":     ddl.ColumnDef{Name: "NOTE", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"synth_id": ddl.ColumnDef{Name: "synth_id", T: ddl.Type{Name: ddl.Int64}},
+			},
+			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "synth_id"}},
+			Fks: []ddl.Foreignkey{ddl.Foreignkey{Name: "FK_CART_USER", Columns: []string{"USER_ID"}, ReferTable: "USERS", ReferColumns: []string{"USER_ID"}}},
+		},
+	}
+	assert.Equal(t, expectedSchema, stripSchemaComments(conv.SpSchema))
+	assert.Equal(t, 2, len(conv.Issues["USERS"]))
+	assert.Equal(t, []internal.SchemaIssue{internal.AutoIncrement}, conv.Issues["USERS"]["USER_ID"])
+	assert.Equal(t, []internal.SchemaIssue{internal.OracleDate, internal.DefaultValue}, conv.Issues["USERS"]["JOINED"])
+	assert.Equal(t, []internal.SchemaIssue{internal.NumberNoPrecision}, conv.Issues["CART"]["TOTAL"])
+	assert.Equal(t, []internal.SchemaIssue{internal.NoGoodType}, conv.Issues["CART"]["NOTE"])
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+}
+
+func TestProcessSQLData(t *testing.T) {
+	ms := []mockSpec{
+		{
+			query: "SELECT OWNER, TABLE_NAME FROM ALL_TABLES (.+)",
+			cols:  []string{"OWNER", "TABLE_NAME"},
+			rows:  [][]driver.Value{{"HR", "te st"}},
+		}, {
+			query: `SELECT TO_CHAR\("a a", 'TM9'\) AS "a a", " b", " c " FROM "HR"."te st"`, // query is a regexp!
+			cols:  []string{"a a", " b", " c "},
+			rows: [][]driver.Value{
+				{"42.3", []byte{0x1, 0xab}, "cat"},
+				{"6.6", []byte{}, "dog"},
+				{"6.6.6", []byte{}, "bird"}}, // Test bad row logic.
+		},
+	}
+	db := mkMockDB(t, ms)
+	conv := buildConv(
+		ddl.CreateTable{
+			Name:     "te_st",
+			ColNames: []string{"a_a", "Ab", "Ac_"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"a_a": ddl.ColumnDef{Name: "a_a", T: ddl.Type{Name: ddl.Numeric}},
+				"Ab":  ddl.ColumnDef{Name: "Ab", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"Ac_": ddl.ColumnDef{Name: "Ac_", T: ddl.Type{Name: ddl.String, Len: 10}},
+			}},
+		schema.Table{
+			Name:     "te st",
+			ColNames: []string{"a a", " b", " c "},
+			ColDefs: map[string]schema.Column{
+				"a a": schema.Column{Name: "a a", Type: schema.Type{Name: "NUMBER", Mods: []int64{10, 2}}},
+				" b":  schema.Column{Name: " b", Type: schema.Type{Name: "RAW"}},
+				" c ": schema.Column{Name: " c ", Type: schema.Type{Name: "VARCHAR2", Mods: []int64{10}}},
+			}})
+	conv.SetDataMode()
+	var rows []spannerData
+	conv.SetDataSink(
+		func(table string, cols []string, vals []interface{}) {
+			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
+		})
+	ProcessSQLData(conv, db)
+	assert.Equal(t,
+		[]spannerData{
+			spannerData{table: "te_st", cols: []string{"a_a", "Ab", "Ac_"}, vals: []interface{}{"42.300000000", "01AB", "cat"}},
+			spannerData{table: "te_st", cols: []string{"a_a", "Ab", "Ac_"}, vals: []interface{}{"6.600000000", "", "dog"}},
+		},
+		rows)
+	assert.Equal(t, conv.BadRows(), int64(1))
+	assert.Equal(t, int64(1), conv.Unexpecteds()) // Bad row generates an entry in unexpected.
+}
+
+func TestConvertSQLRow(t *testing.T) {
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 8900000, time.UTC)
+	tc := []struct {
+		name    string
+		srcType schema.Type
+		spType  ddl.Type
+		in      interface{} // Input value for conversion.
+		e       interface{} // Expected result.
+	}{
+		{"number to int64", schema.Type{Name: "NUMBER", Mods: []int64{10, 0}}, ddl.Type{Name: ddl.Int64}, "42", int64(42)},
+		{"number to numeric", schema.Type{Name: "NUMBER", Mods: []int64{10, 2}}, ddl.Type{Name: ddl.Numeric}, "-1234.56", "-1234.560000000"},
+		{"number to float64", schema.Type{Name: "NUMBER", Mods: []int64{38, 20}}, ddl.Type{Name: ddl.Float64}, ".5", float64(0.5)},
+		{"integer to string", schema.Type{Name: "NUMBER", Mods: []int64{38, 0}}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, "12345678901234567890123456789012345678", "12345678901234567890123456789012345678"},
+		{"binary_float", schema.Type{Name: "BINARY_FLOAT"}, ddl.Type{Name: ddl.Float64}, float32(2.5), float64(2.5)},
+		{"binary_double", schema.Type{Name: "BINARY_DOUBLE"}, ddl.Type{Name: ddl.Float64}, float64(42.5), float64(42.5)},
+		{"nvarchar2", schema.Type{Name: "NVARCHAR2", Mods: []int64{10}}, ddl.Type{Name: ddl.String, Len: 10}, "héllo", "héllo"},
+		{"blob", schema.Type{Name: "BLOB"}, ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, []byte{0x1, 0xab}, []byte{0x1, 0xab}},
+		{"raw to string", schema.Type{Name: "RAW", Mods: []int64{2}}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []byte{0x1, 0xab}, "01AB"},
+		{"date", schema.Type{Name: "DATE"}, ddl.Type{Name: ddl.Timestamp}, tm, tm},
+		{"date to date", schema.Type{Name: "DATE"}, ddl.Type{Name: ddl.Date}, tm, civil.Date{Year: 2021, Month: 3, Day: 4}},
+		{"timestamp string", schema.Type{Name: "TIMESTAMP"}, ddl.Type{Name: ddl.Timestamp}, "2021-03-04 05:06:07.0089", tm},
+		{"interval", schema.Type{Name: "INTERVAL DAY TO SECOND"}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, "+02 03:04:05.000000", "+02 03:04:05.000000"},
+	}
+	conv := internal.MakeConv()
+	conv.Location = time.UTC
+	for _, tc := range tc {
+		_, vals, err := ConvertSQLRow(conv, "t", []string{"a"}, schema.Table{ColDefs: map[string]schema.Column{"a": schema.Column{Name: "a", Type: tc.srcType}}},
+			"t", []string{"a"}, ddl.CreateTable{ColDefs: map[string]ddl.ColumnDef{"a": ddl.ColumnDef{Name: "a", T: tc.spType}}}, []interface{}{tc.in})
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, []interface{}{tc.e}, vals, tc.name)
+	}
+}
+
+func TestSetRowStats(t *testing.T) {
+	ms := []mockSpec{
+		{
+			query: "SELECT OWNER, TABLE_NAME FROM ALL_TABLES (.+)",
+			cols:  []string{"OWNER", "TABLE_NAME"},
+			rows:  [][]driver.Value{{"HR", "TEST1"}, {"HR", "TEST2"}},
+		}, {
+			query: `SELECT COUNT[(][*][)] FROM "HR"."TEST1"`,
+			cols:  []string{"count"},
+			rows:  [][]driver.Value{{5}},
+		}, {
+			query: `SELECT COUNT[(][*][)] FROM "HR"."TEST2"`,
+			cols:  []string{"count"},
+			rows:  [][]driver.Value{{142}},
+		},
+	}
+	db := mkMockDB(t, ms)
+	conv := internal.MakeConv()
+	conv.SetDataMode()
+	SetRowStats(conv, db)
+	assert.Equal(t, int64(5), conv.Stats.Rows["TEST1"])
+	assert.Equal(t, int64(142), conv.Stats.Rows["TEST2"])
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+}
+
+func TestToType(t *testing.T) {
+	null := sql.NullInt64{}
+	n := func(i int64) sql.NullInt64 { return sql.NullInt64{Int64: i, Valid: true} }
+	assert.Equal(t, schema.Type{Name: "NUMBER", Mods: []int64{10, 2}}, toType("NUMBER", n(22), n(0), n(10), n(2)))
+	assert.Equal(t, schema.Type{Name: "NUMBER", Mods: []int64{38, 0}}, toType("NUMBER", n(22), n(0), null, n(0)))
+	assert.Equal(t, schema.Type{Name: "NUMBER"}, toType("NUMBER", n(22), n(0), null, null))
+	assert.Equal(t, schema.Type{Name: "VARCHAR2", Mods: []int64{10}}, toType("VARCHAR2", n(40), n(10), null, null))
+	assert.Equal(t, schema.Type{Name: "RAW", Mods: []int64{16}}, toType("RAW", n(16), n(0), null, null))
+	assert.Equal(t, schema.Type{Name: "TIMESTAMP WITH LOCAL TIME ZONE"}, toType("TIMESTAMP(6) WITH LOCAL TIME ZONE", n(11), n(0), null, n(6)))
+	assert.Equal(t, schema.Type{Name: "INTERVAL DAY TO SECOND"}, toType("INTERVAL DAY(2) TO SECOND(6)", n(11), n(0), n(2), n(6)))
+}
+
+func TestQuoteIdent(t *testing.T) {
+	assert.Equal(t, `"a b"`, quoteIdent("a b"))
+	assert.Equal(t, `"a""b"`, quoteIdent(`a"b`))
+}
+
+func buildConv(spTable ddl.CreateTable, srcTable schema.Table) *internal.Conv {
+	conv := internal.MakeConv()
+	conv.SpSchema[spTable.Name] = spTable
+	conv.SrcSchema[srcTable.Name] = srcTable
+	conv.ToSource[spTable.Name] = internal.NameAndCols{Name: srcTable.Name, Cols: make(map[string]string)}
+	conv.ToSpanner[srcTable.Name] = internal.NameAndCols{Name: spTable.Name, Cols: make(map[string]string)}
+	for i := range spTable.ColNames {
+		conv.ToSource[spTable.Name].Cols[spTable.ColNames[i]] = srcTable.ColNames[i]
+		conv.ToSpanner[srcTable.Name].Cols[srcTable.ColNames[i]] = spTable.ColNames[i]
+	}
+	return conv
+}
+
+func stripSchemaComments(spSchema map[string]ddl.CreateTable) map[string]ddl.CreateTable {
+	for t, ct := range spSchema {
+		for c, cd := range ct.ColDefs {
+			cd.Comment = ""
+			ct.ColDefs[c] = cd
+		}
+		ct.Comment = ""
+		spSchema[t] = ct
+	}
+	return spSchema
+}
+
+func mkMockDB(t *testing.T, ms []mockSpec) *sql.DB {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	for _, m := range ms {
+		rows := sqlmock.NewRows(m.cols)
+		for _, r := range m.rows {
+			rows.AddRow(r...)
+		}
+		if len(m.args) > 0 {
+			mock.ExpectQuery(m.query).WithArgs(m.args...).WillReturnRows(rows)
+		} else {
+			mock.ExpectQuery(m.query).WillReturnRows(rows)
+		}
+	}
+	return db
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracle
+
+import (
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// toSpannerType maps a scalar source schema type (defined by id and
+// mods) into a Spanner type. This is the core source-to-Spanner type
+// mapping.  toSpannerType returns the Spanner type and a list of type
+// conversion issues encountered.
+func toSpannerType(conv *internal.Conv, id string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	switch id {
+	case "NUMBER":
+		// Oracle uses NUMBER for integers as well as fixed and floating
+		// point decimals, so we use precision and scale to pick the
+		// closest Spanner type. Spanner's NUMERIC type can store up to
+		// 29 digits before the decimal point and up to 9 after it.
+		if len(mods) < 2 {
+			return ddl.Type{Name: ddl.Numeric}, []internal.SchemaIssue{internal.NumberNoPrecision}
+		}
+		p, s := mods[0], mods[1]
+		switch {
+		case s <= 0 && p-s <= 18:
+			return ddl.Type{Name: ddl.Int64}, nil
+		case p-s <= 29 && s <= 9:
+			return ddl.Type{Name: ddl.Numeric}, nil
+		case s <= 0:
+			// Integers with more than 29 digits (including INTEGER,
+			// which is NUMBER(38,0)) don't fit in NUMERIC, and would
+			// lose precision in FLOAT64, so we keep them as strings.
+			return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NumberToString}
+		}
+		return ddl.Type{Name: ddl.Float64}, []internal.SchemaIssue{internal.NumberToFloat}
+	case "FLOAT", "BINARY_FLOAT":
+		// Oracle's FLOAT is a NUMBER with binary precision, so it can
+		// store more digits than a FLOAT64.
+		return ddl.Type{Name: ddl.Float64}, []internal.SchemaIssue{internal.Widened}
+	case "BINARY_DOUBLE":
+		return ddl.Type{Name: ddl.Float64}, nil
+	case "VARCHAR2", "NVARCHAR2", "CHAR", "NCHAR":
+		if len(mods) > 0 && mods[0] > 0 {
+			return ddl.Type{Name: ddl.String, Len: mods[0]}, nil
+		}
+		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+	case "CLOB", "NCLOB", "LONG", "JSON":
+		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+	case "RAW":
+		if len(mods) > 0 && mods[0] > 0 {
+			return ddl.Type{Name: ddl.Bytes, Len: mods[0]}, nil
+		}
+		return ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil
+	case "BLOB", "LONG RAW":
+		return ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil
+	case "DATE":
+		// Oracle's DATE type includes a time of day (to the second).
+		return ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.OracleDate}
+	case "TIMESTAMP":
+		return ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.DatetimeNoOffset}
+	case "TIMESTAMP WITH TIME ZONE", "TIMESTAMP WITH LOCAL TIME ZONE":
+		return ddl.Type{Name: ddl.Timestamp}, nil
+	}
+	return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}
+}
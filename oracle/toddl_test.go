@@ -0,0 +1,80 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func TestToSpannerType(t *testing.T) {
+	tc := []struct {
+		srcType string
+		mods    []int64
+		ty      ddl.Type
+		issues  []internal.SchemaIssue
+	}{
+		{"NUMBER", []int64{10, 0}, ddl.Type{Name: ddl.Int64}, nil},
+		{"NUMBER", []int64{18, 0}, ddl.Type{Name: ddl.Int64}, nil},
+		{"NUMBER", []int64{19, 0}, ddl.Type{Name: ddl.Numeric}, nil},
+		{"NUMBER", []int64{10, 2}, ddl.Type{Name: ddl.Numeric}, nil},
+		{"NUMBER", []int64{29, 0}, ddl.Type{Name: ddl.Numeric}, nil},
+		{"NUMBER", []int64{38, 0}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NumberToString}},
+		{"NUMBER", []int64{30, -2}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NumberToString}},
+		{"NUMBER", []int64{20, 10}, ddl.Type{Name: ddl.Float64}, []internal.SchemaIssue{internal.NumberToFloat}},
+		{"NUMBER", nil, ddl.Type{Name: ddl.Numeric}, []internal.SchemaIssue{internal.NumberNoPrecision}},
+		{"FLOAT", []int64{126}, ddl.Type{Name: ddl.Float64}, []internal.SchemaIssue{internal.Widened}},
+		{"BINARY_DOUBLE", nil, ddl.Type{Name: ddl.Float64}, nil},
+		{"VARCHAR2", []int64{20}, ddl.Type{Name: ddl.String, Len: 20}, nil},
+		{"NCLOB", nil, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil},
+		{"RAW", []int64{16}, ddl.Type{Name: ddl.Bytes, Len: 16}, nil},
+		{"LONG RAW", nil, ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil},
+		{"DATE", nil, ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.OracleDate}},
+		{"TIMESTAMP", nil, ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.DatetimeNoOffset}},
+		{"TIMESTAMP WITH TIME ZONE", nil, ddl.Type{Name: ddl.Timestamp}, nil},
+		{"INTERVAL YEAR TO MONTH", nil, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}},
+		{"SDO_GEOMETRY", nil, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}},
+	}
+	for _, tc := range tc {
+		ty, issues := toSpannerType(nil, tc.srcType, tc.mods)
+		assert.Equal(t, tc.ty, ty, tc.srcType)
+		assert.Equal(t, tc.issues, issues, tc.srcType)
+	}
+}
+
+func TestRemapType(t *testing.T) {
+	tc := []struct {
+		srcType string
+		spType  string
+		ty      ddl.Type
+		issues  []internal.SchemaIssue
+	}{
+		{"NUMBER", ddl.Float64, ddl.Type{Name: ddl.Float64}, []internal.SchemaIssue{internal.NumberToFloat}},
+		{"NUMBER", ddl.Numeric, ddl.Type{Name: ddl.Numeric}, []internal.SchemaIssue{internal.NumberNoPrecision}},
+		{"NUMBER", ddl.String, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.Widened}},
+		{"VARCHAR2", ddl.Bytes, ddl.Type{Name: ddl.Bytes, Len: 20}, nil},
+		{"RAW", ddl.String, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil},
+		{"DATE", ddl.Date, ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.OracleDate}},
+	}
+	for _, tc := range tc {
+		ty, issues := remapType(tc.srcType, tc.spType, []int64{20})
+		assert.Equal(t, tc.ty, ty, tc.srcType+" to "+tc.spType)
+		assert.Equal(t, tc.issues, issues, tc.srcType+" to "+tc.spType)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oracle
+
+import (
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// remapType maps source type srcType (with modifiers mods) to Spanner
+// type spType, if spType is a potential mapping for srcType. If not,
+// the default Spanner type for srcType (as computed by toSpannerType)
+// is used. remapType is used to implement source.Driver's
+// ToSpannerType (which the web UI uses to change types after schema
+// conversion).
+//
+// As with the sqlserver version, every type can also be mapped to
+// STRING and character types can be mapped to BYTES. In addition,
+// NUMBER can be mapped to FLOAT64 or NUMERIC.
+func remapType(srcType string, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	ty, issues := toSpannerType(nil, srcType, mods)
+	switch spType {
+	case ddl.String:
+		switch ty.Name {
+		case ddl.String:
+			return ty, issues
+		case ddl.Bytes:
+			return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+		default:
+			return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.Widened}
+		}
+	case ddl.Bytes:
+		switch srcType {
+		case "VARCHAR2", "NVARCHAR2", "CHAR", "NCHAR", "CLOB", "NCLOB", "LONG", "JSON":
+			return ddl.Type{Name: ddl.Bytes, Len: ty.Len}, nil
+		}
+	case ddl.Float64:
+		if srcType == "NUMBER" && ty.Name != ddl.Float64 {
+			return ddl.Type{Name: ddl.Float64}, []internal.SchemaIssue{internal.NumberToFloat}
+		}
+	case ddl.Numeric:
+		if srcType == "NUMBER" && ty.Name != ddl.Numeric {
+			return ddl.Type{Name: ddl.Numeric}, []internal.SchemaIssue{internal.NumberNoPrecision}
+		}
+	}
+	return ty, issues
+}
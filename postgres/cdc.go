@@ -0,0 +1,352 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// Changes are read from a logical replication slot using the pgoutput
+// plugin (the plugin used by PostgreSQL's built-in logical replication),
+// through the SQL interface to logical decoding. pgoutput sends values
+// in their text form, as in pg_dump's COPY blocks, so they can be
+// converted with ConvertData.
+const (
+	peekChanges = "SELECT data FROM pg_logical_slot_peek_binary_changes($1, NULL, $2, 'proto_version', '1', 'publication_names', $3);"
+	// peekLimit is the number of changes to read per query (rounded up
+	// to a transaction boundary).
+	peekLimit = 10000
+)
+
+// pollInterval is the time to wait for new changes when following the
+// replication slot.
+var pollInterval = time.Second
+
+// replicationSlot is a logical replication slot that was just created,
+// along with the snapshot exported when it was created.
+type replicationSlot struct {
+	conn     *sql.Conn // Replication connection that created the slot.
+	lsn      string    // LSN from which the slot streams changes.
+	snapshot string    // Id of the exported snapshot.
+}
+
+// createSlot creates logical replication slot name for publication
+// name (checked using db), using a connection from repl, which must be
+// opened with replication=database. Creating the slot exports a
+// snapshot that sees exactly the changes before the LSN from which the
+// slot streams changes. The snapshot can be imported (with SET
+// TRANSACTION SNAPSHOT) until the slot's connection is closed, so the
+// caller must close the slot once it has imported it.
+func createSlot(db, repl *sql.DB, name string) (*replicationSlot, error) {
+	var ok bool
+	if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1);", name).Scan(&ok); err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("publication %s does not exist (create it with CREATE PUBLICATION %s FOR ALL TABLES)", name, name)
+	}
+	if repl == nil {
+		return nil, fmt.Errorf("can't create replication slot %s: no replication connection", name)
+	}
+	c, err := repl.Conn(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("can't open replication connection: %w", err)
+	}
+	// Replication commands don't take parameters. Like table names,
+	// the slot name is quoted instead.
+	s := &replicationSlot{conn: c}
+	var slotName, plugin string
+	q := fmt.Sprintf(`CREATE_REPLICATION_SLOT "%s" LOGICAL pgoutput EXPORT_SNAPSHOT;`, name)
+	if err := c.QueryRowContext(context.Background(), q).Scan(&slotName, &s.lsn, &s.snapshot, &plugin); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("can't create replication slot %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// close closes the slot's replication connection, which ends its
+// exported snapshot. The slot itself is kept.
+func (s *replicationSlot) close() {
+	s.conn.Close()
+}
+
+// StreamChanges reads row changes from the logical replication slot
+// and publication called name (see createSlot), skipping transactions
+// that ended at or before LSN pos (as recorded in conv.ChangePosition),
+// and converts them to Spanner mutations. It calls apply with the
+// mutations of each committed transaction, the LSN of the end of the
+// transaction and its commit time. Once the transactions read by a
+// query are applied, the slot is advanced past them, so that PostgreSQL
+// can recycle their WAL. If follow is set, StreamChanges polls for new
+// changes, and only returns on error (including errors from apply).
+//
+// Data conversion reads the source using the snapshot exported when the
+// slot was created, so streaming starts exactly where the data read
+// ends. Inserts and updates are written with InsertOrUpdate mutations,
+// so a transaction that is applied again after a restart is harmless.
+// TRUNCATE and changes to tables with synthetic primary keys aren't
+// replicated: they are reported as unexpected conditions.
+func StreamChanges(conv *internal.Conv, db *sql.DB, name, pos string, follow bool, apply func(ms []*sp.Mutation, pos string, commitTime time.Time) error) error {
+	start, err := parseLSN(pos)
+	if err != nil {
+		return err
+	}
+	s := &changeStream{conv: conv, start: start, rels: make(map[uint32]*relationMsg), apply: apply, counts: make(internal.ChangeCounts)}
+	for {
+		n, err := s.peek(db, name)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if !follow {
+				return nil
+			}
+			time.Sleep(pollInterval)
+			continue
+		}
+		if s.end > 0 {
+			if _, err := db.Exec("SELECT pg_replication_slot_advance($1, $2::pg_lsn);", name, formatLSN(s.end)); err != nil {
+				return fmt.Errorf("can't advance replication slot %s: %w", name, err)
+			}
+		}
+	}
+}
+
+// changeStream converts the pgoutput messages read from a replication
+// slot to Spanner mutations.
+type changeStream struct {
+	conv   *internal.Conv
+	start  uint64                  // Transactions ending at or before start were already applied.
+	rels   map[uint32]*relationMsg // Relations, by id.
+	apply  func(ms []*sp.Mutation, pos string, commitTime time.Time) error
+	skip   bool                  // Whether the current transaction was already applied.
+	ms     []*sp.Mutation        // Mutations of the current transaction.
+	counts internal.ChangeCounts // Changes of the current transaction.
+	end    uint64                // End LSN of the last complete transaction.
+}
+
+// peek reads the next batch of changes from slot name, and returns the
+// number of messages read.
+func (s *changeStream) peek(db *sql.DB, name string) (int, error) {
+	rows, err := db.Query(peekChanges, name, peekLimit, name)
+	if err != nil {
+		return 0, fmt.Errorf("can't read replication slot %s: %w", name, err)
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return n, fmt.Errorf("can't read replication slot %s: %w", name, err)
+		}
+		n++
+		m, err := parseMessage(data)
+		if err != nil {
+			return n, fmt.Errorf("can't decode change from replication slot %s: %w", name, err)
+		}
+		if err := s.handle(m); err != nil {
+			return n, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, fmt.Errorf("can't read replication slot %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// handle processes pgoutput message m.
+func (s *changeStream) handle(m interface{}) error {
+	switch m := m.(type) {
+	case *beginMsg:
+		// Transactions that ended at or before start were committed
+		// before it.
+		s.skip = m.finalLSN < s.start
+		s.ms, s.counts = nil, make(internal.ChangeCounts)
+	case *commitMsg:
+		s.end = m.endLSN
+		if s.skip || len(s.ms) == 0 {
+			return nil
+		}
+		if err := s.apply(s.ms, formatLSN(m.endLSN), m.commitTime); err != nil {
+			return err
+		}
+		s.conv.StatsAddChanges(s.counts)
+	case *relationMsg:
+		s.rels[m.id] = m
+	case *rowMsg:
+		rel, ok := s.rels[m.rel]
+		if !ok {
+			return fmt.Errorf("change to unknown relation %d", m.rel)
+		}
+		if !s.skip {
+			s.ms = append(s.ms, rowMutations(s.conv, rel, m, s.counts)...)
+		}
+	case *truncateMsg:
+		if s.skip {
+			return nil
+		}
+		for _, id := range m.rels {
+			if rel, ok := s.rels[id]; ok {
+				s.conv.Unexpected(fmt.Sprintf("TRUNCATE of table %s not replicated", buildTableName(rel.schema, rel.name)))
+			}
+		}
+	}
+	return nil
+}
+
+// rowMutations converts row change m to relation rel to Spanner
+// mutations, and counts it in counts. Changes that can't be converted
+// are reported as unexpected conditions, and counted as change errors
+// in conv.
+func rowMutations(conv *internal.Conv, rel *relationMsg, m *rowMsg, counts internal.ChangeCounts) []*sp.Mutation {
+	srcTable := buildTableName(rel.schema, rel.name)
+	if _, ok := conv.SrcSchema[srcTable]; !ok {
+		conv.Unexpected(fmt.Sprintf("Changes to table %s not replicated: table not found in source schema", srcTable))
+		return nil
+	}
+	spTable, err := internal.GetSpannerTable(conv, srcTable)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get spanner table : %s", err))
+		return nil
+	}
+	if _, ok := conv.SyntheticPKeys[spTable]; ok {
+		// Rows of tables with synthetic primary keys can't be matched
+		// with rows in Spanner.
+		conv.Unexpected(fmt.Sprintf("Changes to table %s not replicated: table has no primary key", srcTable))
+		return nil
+	}
+	spSchema, ok := conv.SpSchema[spTable]
+	if !ok {
+		conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
+		return nil
+	}
+	var before, after *changeRow
+	if m.old != nil {
+		before, err = convertChangeRow(conv, srcTable, rel.cols, spSchema, m.old)
+	}
+	if err == nil && m.new != nil {
+		after, err = convertChangeRow(conv, srcTable, rel.cols, spSchema, m.new)
+	}
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Error while converting data: %s\n", err))
+		conv.StatsAddChange(srcTable, internal.ChangeError)
+		return nil
+	}
+	var ms []*sp.Mutation
+	// A delete, or an update that changes the primary key, deletes the
+	// old row. Updates only have an old row if the key changed (or the
+	// table has REPLICA IDENTITY FULL).
+	if before != nil && (after == nil || !reflect.DeepEqual(before.key, after.key)) {
+		ms = append(ms, sp.Delete(spTable, before.key))
+	}
+	if after != nil {
+		ms = append(ms, sp.InsertOrUpdate(spTable, after.cols, after.vals))
+	}
+	switch m.typ {
+	case 'I':
+		counts.Add(srcTable, internal.ChangeInsert)
+	case 'U':
+		counts.Add(srcTable, internal.ChangeUpdate)
+	case 'D':
+		counts.Add(srcTable, internal.ChangeDelete)
+	}
+	return ms
+}
+
+// changeRow is a tuple of a row change converted to Spanner values.
+type changeRow struct {
+	key  sp.Key
+	cols []string
+	vals []interface{}
+}
+
+// convertChangeRow converts tuple vals of a row of srcTable (with
+// columns srcCols) using ConvertData. NULL values are kept (as nil), so
+// that updates can set columns to NULL. Unchanged TOASTed values aren't
+// sent by pgoutput, so their columns are left out.
+func convertChangeRow(conv *internal.Conv, srcTable string, srcCols []string, spSchema ddl.CreateTable, vals []tupleValue) (*changeRow, error) {
+	if len(vals) != len(srcCols) {
+		return nil, fmt.Errorf("change has %d columns, relation %s has %d", len(vals), srcTable, len(srcCols))
+	}
+	var cols, strs, nulls []string
+	for i, v := range vals {
+		switch v.kind {
+		case tupleUnchanged:
+			continue
+		case tupleNull:
+			nulls = append(nulls, srcCols[i])
+			continue
+		}
+		cols = append(cols, srcCols[i])
+		strs = append(strs, v.val)
+	}
+	r := &changeRow{}
+	if len(cols) > 0 {
+		var err error
+		_, r.cols, r.vals, err = ConvertData(conv, srcTable, cols, strs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	spNulls, err := internal.GetSpannerCols(conv, srcTable, nulls)
+	if err != nil {
+		return nil, fmt.Errorf("can't map source columns %v", nulls)
+	}
+	m := make(map[string]interface{})
+	for i, c := range r.cols {
+		m[c] = r.vals[i]
+	}
+	for _, c := range spNulls {
+		r.cols = append(r.cols, c)
+		r.vals = append(r.vals, nil)
+	}
+	for _, k := range spSchema.Pks {
+		v, ok := m[k.Col]
+		if !ok {
+			return nil, fmt.Errorf("primary key column %s is missing from change", k.Col)
+		}
+		r.key = append(r.key, v)
+	}
+	return r, nil
+}
+
+// parseLSN parses an LSN in PostgreSQL's text form (e.g. "16/B374D848").
+func parseLSN(s string) (uint64, error) {
+	i := strings.Index(s, "/")
+	if i < 0 {
+		return 0, fmt.Errorf("bad LSN %q", s)
+	}
+	hi, err1 := strconv.ParseUint(s[:i], 16, 32)
+	lo, err2 := strconv.ParseUint(s[i+1:], 16, 32)
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("bad LSN %q", s)
+	}
+	return hi<<32 | lo, nil
+}
+
+func formatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", lsn>>32, uint32(lsn))
+}
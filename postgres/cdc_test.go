@@ -0,0 +1,228 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"encoding/hex"
+	"regexp"
+	"testing"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// pgoutputMessages are pgoutput messages for three transactions on
+// table public.t (id int8 primary key, name text, n numeric), as
+// returned by pg_logical_slot_peek_binary_changes:
+//
+//	INSERT INTO t VALUES (1, 'a', 123.45), (2, NULL, -1.5);
+//	UPDATE t SET name = NULL WHERE id = 1; -- n is TOASTed, so it is sent as unchanged.
+//	UPDATE t SET id = 3, name = 'c', n = NULL WHERE id = 2;
+//	DELETE FROM t WHERE id = 3; TRUNCATE t;
+var pgoutputMessages = []string{
+	"420000000001634f88000266b1d9a2f000000001f4",
+	"52000040017075626c69630074006400030169640000000014ffffffff006e616d650000000019ffffffff006e00000006a4ffffffff",
+	"49000040014e000374000000013174000000016174000000063132332e3435",
+	"49000040014e00037400000001326e74000000042d312e35",
+	"43000000000001634f880000000001634fb8000266b1d9a2f000",
+	"4200000000016350d0000266b1d9a2f000000001f5",
+	"52000040017075626c69630074006400030169640000000014ffffffff006e616d650000000019ffffffff006e00000006a4ffffffff",
+	"55000040014e00037400000001316e75",
+	"55000040014b00037400000001326e6e4e00037400000001337400000001636e",
+	"430000000000016350d00000000001635100000266b1d9a2f000",
+	"4200000000016351d0000266b1d9a2f000000001f6",
+	"52000040017075626c69630074006400030169640000000014ffffffff006e616d650000000019ffffffff006e00000006a4ffffffff",
+	"44000040014b00037400000001336e6e",
+	"54000000010000004001",
+	"430000000000016351d00000000001635200000266b1d9a2f000",
+}
+
+// pgoutputCommit is the commit time of the transactions of
+// pgoutputMessages.
+var pgoutputCommit = time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func message(t *testing.T, i int) []byte {
+	b, err := hex.DecodeString(pgoutputMessages[i])
+	assert.Nil(t, err)
+	return b
+}
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		i    int
+		want interface{}
+	}{
+		{0, &beginMsg{finalLSN: 0x1634F88, commitTime: pgoutputCommit, xid: 500}},
+		{1, &relationMsg{id: 16385, schema: "public", name: "t", cols: []string{"id", "name", "n"}}},
+		{3, &rowMsg{typ: 'I', rel: 16385, new: []tupleValue{{tupleText, "2"}, {tupleNull, ""}, {tupleText, "-1.5"}}}},
+		{4, &commitMsg{commitLSN: 0x1634F88, endLSN: 0x1634FB8, commitTime: pgoutputCommit}},
+		{7, &rowMsg{typ: 'U', rel: 16385, new: []tupleValue{{tupleText, "1"}, {tupleNull, ""}, {tupleUnchanged, ""}}}},
+		{8, &rowMsg{typ: 'U', rel: 16385,
+			old: []tupleValue{{tupleText, "2"}, {tupleNull, ""}, {tupleNull, ""}},
+			new: []tupleValue{{tupleText, "3"}, {tupleText, "c"}, {tupleNull, ""}}}},
+		{12, &rowMsg{typ: 'D', rel: 16385, old: []tupleValue{{tupleText, "3"}, {tupleNull, ""}, {tupleNull, ""}}}},
+		{13, &truncateMsg{rels: []uint32{16385}}},
+	}
+	for _, tc := range tests {
+		m, err := parseMessage(message(t, tc.i))
+		assert.Nil(t, err)
+		assert.Equal(t, tc.want, m)
+	}
+	// Truncated messages are errors.
+	for i := range pgoutputMessages {
+		b := message(t, i)
+		_, err := parseMessage(b[:len(b)-1])
+		assert.NotNil(t, err)
+	}
+	_, err := parseMessage([]byte("Z"))
+	assert.NotNil(t, err)
+}
+
+func cdcConv() *internal.Conv {
+	return buildConv(
+		ddl.CreateTable{
+			Name:     "t",
+			ColNames: []string{"id", "name", "n"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"id":   {Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"name": {Name: "name", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"n":    {Name: "n", T: ddl.Type{Name: ddl.Numeric}},
+			},
+			Pks: []ddl.IndexKey{{Col: "id"}},
+		},
+		schema.Table{
+			Name:     "t",
+			ColNames: []string{"id", "name", "n"},
+			ColDefs: map[string]schema.Column{
+				"id":   {Name: "id", Type: schema.Type{Name: "bigint"}},
+				"name": {Name: "name", Type: schema.Type{Name: "text"}},
+				"n":    {Name: "n", Type: schema.Type{Name: "numeric"}},
+			},
+		})
+}
+
+// expectPeek sets up mock to return messages from the replication slot.
+func expectPeek(t *testing.T, mock sqlmock.Sqlmock, messages ...int) {
+	rows := sqlmock.NewRows([]string{"data"})
+	for _, i := range messages {
+		rows.AddRow(message(t, i))
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(peekChanges)).WithArgs("hb", peekLimit, "hb").WillReturnRows(rows)
+}
+
+type appliedTxn struct {
+	ms  []*sp.Mutation
+	pos string
+}
+
+func TestStreamChanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	all := make([]int, len(pgoutputMessages))
+	for i := range all {
+		all[i] = i
+	}
+	expectPeek(t, mock, all...)
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_replication_slot_advance($1, $2::pg_lsn)")).
+		WithArgs("hb", "0/1635200").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectPeek(t, mock)
+
+	conv := cdcConv()
+	var got []appliedTxn
+	apply := func(ms []*sp.Mutation, pos string, commitTime time.Time) error {
+		assert.Equal(t, pgoutputCommit, commitTime)
+		got = append(got, appliedTxn{ms, pos})
+		return nil
+	}
+	err = StreamChanges(conv, db, "hb", "0/1634F50", false, apply)
+	assert.Nil(t, err)
+	cols := []string{"id", "name", "n"}
+	assert.Equal(t, []appliedTxn{
+		{[]*sp.Mutation{
+			sp.InsertOrUpdate("t", cols, []interface{}{int64(1), "a", "123.450000000"}),
+			sp.InsertOrUpdate("t", []string{"id", "n", "name"}, []interface{}{int64(2), "-1.500000000", nil}),
+		}, "0/1634FB8"},
+		{[]*sp.Mutation{
+			// Unchanged values are left out.
+			sp.InsertOrUpdate("t", []string{"id", "name"}, []interface{}{int64(1), nil}),
+			// Changing the primary key deletes the old row.
+			sp.Delete("t", sp.Key{int64(2)}),
+			sp.InsertOrUpdate("t", []string{"id", "name", "n"}, []interface{}{int64(3), "c", nil}),
+		}, "0/1635100"},
+		{[]*sp.Mutation{
+			sp.Delete("t", sp.Key{int64(3)}),
+		}, "0/1635200"},
+	}, got)
+	assert.Equal(t, int64(1), conv.Unexpecteds()) // The TRUNCATE.
+	c := conv.Stats.Changes["t"]
+	assert.Equal(t, []int64{2, 2, 1, 0}, []int64{c.Insert, c.Update, c.Delete, c.Error})
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestStreamChanges_Restart(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	// The slot wasn't advanced after the first transaction was applied,
+	// so it is read again, but skipped.
+	expectPeek(t, mock, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9)
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_replication_slot_advance($1, $2::pg_lsn)")).
+		WithArgs("hb", "0/1635100").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectPeek(t, mock)
+	var got []string
+	apply := func(ms []*sp.Mutation, pos string, commitTime time.Time) error {
+		got = append(got, pos)
+		return nil
+	}
+	conv := cdcConv()
+	err = StreamChanges(conv, db, "hb", "0/1634FB8", false, apply)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"0/1635100"}, got)
+	assert.Equal(t, int64(0), conv.Stats.Changes["t"].Insert)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestStreamChanges_BadValue(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	b, err := hex.DecodeString("49000040014e00037400000001787400000001616e") // (x, 'a', NULL)
+	assert.Nil(t, err)
+	mock.ExpectQuery(regexp.QuoteMeta(peekChanges)).WillReturnRows(sqlmock.NewRows([]string{"data"}).
+		AddRow(message(t, 0)).AddRow(message(t, 1)).AddRow(b).AddRow(message(t, 4)))
+	mock.ExpectExec("pg_replication_slot_advance").WillReturnResult(sqlmock.NewResult(0, 0))
+	expectPeek(t, mock)
+	conv := cdcConv()
+	err = StreamChanges(conv, db, "hb", "0/1634F50", false, func([]*sp.Mutation, string, time.Time) error {
+		t.Errorf("no changes should be applied")
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), conv.ChangeErrors())
+	assert.Equal(t, int64(1), conv.Unexpecteds())
+}
+
+func TestLSN(t *testing.T) {
+	lsn, err := parseLSN("16/B374D848")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x16B374D848), lsn)
+	assert.Equal(t, "16/B374D848", formatLSN(lsn))
+	_, err = parseLSN("B374D848")
+	assert.NotNil(t, err)
+}
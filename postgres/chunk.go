@@ -0,0 +1,283 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+)
+
+const (
+	chunkRetries = 5  // Retries of a failed query when reading a chunk.
+	chunkSamples = 20 // Number of keys sampled per chunk when choosing split points.
+)
+
+// Variables so that tests can use smaller pages and shorter delays.
+var (
+	chunkPageRows   = 10000       // Rows read by each query when reading a chunk.
+	chunkRetryDelay = time.Second // Delay before the first retry of a failed query (see internal.RetryDelay).
+)
+
+// processChunkedData performs data conversion for tables, splitting
+// tables with more than chunkRows rows into primary key ranges
+// (chunks) that are read independently. All chunks of all tables are
+// read by a single pool of workers, so several workers can read the
+// same large table.
+func processChunkedData(conv *internal.Conv, reader func(w int) querier, tables []schemaAndName, workers int, chunkRows int64) {
+	// Row counts are set by SetRowStats before data conversion starts.
+	counts := make([]int64, len(tables))
+	for i, t := range tables {
+		counts[i] = conv.Stats.Rows[buildTableName(t.schema, t.name)]
+	}
+	ranges := make([][]internal.KeyRange, len(tables))
+	internal.ForEachWorker(len(tables), workers, func(w, i int) {
+		ranges[i] = splitTable(conv, reader(w), tables[i], counts[i], chunkRows)
+	})
+	type item struct {
+		table int
+		chunk int // Index into ranges[table], or -1 to read the whole table.
+	}
+	var items []item
+	for i := range tables {
+		if ranges[i] == nil {
+			items = append(items, item{table: i, chunk: -1})
+			continue
+		}
+		for j := range ranges[i] {
+			items = append(items, item{table: i, chunk: j})
+		}
+	}
+	internal.ForEachWorker(len(items), workers, func(w, i int) {
+		it := items[i]
+		if it.chunk < 0 {
+			processTableData(conv, reader(w), tables[it.table])
+			return
+		}
+		processChunkData(conv, reader(w), tables[it.table], it.chunk, ranges[it.table][it.chunk])
+	})
+}
+
+// splitTable returns the chunks to read table t in, or nil if t should
+// be read in one piece (because it has no primary key or at most
+// chunkRows rows). Tables with a single integer primary key are split
+// into equal ranges of keys between the minimum and maximum key. Other
+// tables are split using a sample of keys. The split is deterministic
+// (the sample is seeded), so a resumed migration reads the same chunks
+// as the run it resumes, provided the table hasn't changed.
+func splitTable(conv *internal.Conv, db querier, t schemaAndName, rows, chunkRows int64) []internal.KeyRange {
+	srcTable := buildTableName(t.schema, t.name)
+	srcSchema, ok := conv.SrcSchema[srcTable]
+	n := internal.ChunkCount(rows, chunkRows)
+	if !ok || n < 2 || len(srcSchema.PrimaryKeys) == 0 {
+		return nil
+	}
+	keys := keyCols(srcSchema)
+	if len(keys) == 1 && isIntType(srcSchema.ColDefs[srcSchema.PrimaryKeys[0].Column].Type.Name) {
+		var min, max sql.NullInt64
+		q := fmt.Sprintf(`SELECT MIN(%s), MAX(%s) FROM "%s"."%s";`, keys[0], keys[0], t.schema, t.name)
+		err := db.QueryRow(q).Scan(&min, &max)
+		if err == nil && min.Valid && max.Valid {
+			return internal.IntKeyRanges(min.Int64, max.Int64, n)
+		}
+	}
+	percent := 100 * float64(n*chunkSamples) / float64(rows)
+	if percent > 100 {
+		percent = 100
+	}
+	q := fmt.Sprintf(`SELECT %s FROM "%s"."%s" TABLESAMPLE BERNOULLI (%f) REPEATABLE (0)%s;`,
+		strings.Join(keys, ", "), t.schema, t.name, percent, orderBy(srcSchema))
+	r, err := db.Query(q)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't sample keys of table %s, reading it in one chunk: %s", srcTable, err))
+		return nil
+	}
+	defer r.Close()
+	var samples [][]interface{}
+	for r.Next() {
+		v, iv := buildVals(len(keys))
+		if err := r.Scan(iv...); err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't sample keys of table %s, reading it in one chunk: %s", srcTable, err))
+			return nil
+		}
+		samples = append(samples, keyVals(srcSchema, srcSchema.PrimaryKeys, v))
+	}
+	if err := r.Err(); err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't sample keys of table %s, reading it in one chunk: %s", srcTable, err))
+		return nil
+	}
+	return internal.SampleKeyRanges(samples, n)
+}
+
+// processChunkData performs data conversion for chunk r of table t.
+// The chunk is read in pages of chunkPageRows rows, using the key of
+// the last row read to start the next page (keyset pagination). If a
+// query fails, it is retried from the last row read, so a failure
+// doesn't restart the chunk or convert rows twice. Retries back off
+// exponentially, to ride out short outages of the source database.
+// When resuming an interrupted migration, the chunk is read from the
+// last row written by the earlier run (see internal.Conv.ResumeKey).
+func processChunkData(conv *internal.Conv, db querier, t schemaAndName, chunk int, r internal.KeyRange) {
+	srcTable := buildTableName(t.schema, t.name)
+	srcSchema := conv.SrcSchema[srcTable]
+	srcCols := conv.DataCols(srcTable)
+	spTable, err1 := internal.GetSpannerTable(conv, srcTable)
+	spCols, err2 := internal.GetSpannerCols(conv, srcTable, srcCols)
+	spSchema, ok := conv.SpSchema[spTable]
+	if err1 != nil || err2 != nil || !ok {
+		conv.StatsAddBadTable(srcTable)
+		conv.Unexpected(fmt.Sprintf("Can't get cols and schemas for table %s: err1=%s, err2=%s, ok=%t",
+			srcTable, err1, err2, ok))
+		return
+	}
+	var quoted []string
+	for _, c := range srcCols {
+		quoted = append(quoted, fmt.Sprintf(`"%s"`, c))
+	}
+	colIdx := make(map[string]int)
+	for i, c := range srcCols {
+		colIdx[c] = i
+	}
+	after, inclusive := r.Lower, true
+	if k := conv.ResumeKey(srcTable, chunk); k != nil {
+		// Resume after the last row written by an earlier run.
+		after, inclusive = k, false
+	}
+	failures := 0
+	for {
+		where, args := chunkWhere(keyCols(srcSchema), after, inclusive, r.Upper)
+		q := fmt.Sprintf(`SELECT %s FROM "%s"."%s"%s%s LIMIT %d;`, strings.Join(quoted, ", "), t.schema, t.name, where, orderBy(srcSchema), chunkPageRows)
+		rows, err := db.Query(q, args...)
+		if err != nil {
+			failures++
+			if failures > chunkRetries {
+				conv.Unexpected(fmt.Sprintf("Couldn't get data for chunk %d of table %s: %s", chunk, srcTable, err))
+				return
+			}
+			time.Sleep(internal.RetryDelay(chunkRetryDelay, failures))
+			continue
+		}
+		n := 0
+		v, iv := buildVals(len(srcCols))
+		for rows.Next() {
+			n++
+			if err := rows.Scan(iv...); err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+				// Scan failed, so we don't have any data to add to bad rows.
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				continue
+			}
+			var key []interface{}
+			for _, k := range srcSchema.PrimaryKeys {
+				key = append(key, v[colIdx[k.Column]])
+			}
+			after, inclusive = keyVals(srcSchema, srcSchema.PrimaryKeys, key), false
+			cvtCols, cvtVals, err := ConvertSQLRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, v)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				conv.CollectBadRow(srcTable, srcCols, valsToStrings(v))
+				continue
+			}
+			conv.WriteChunkRow(srcTable, spTable, chunk, cvtCols, cvtVals)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			if n > 0 {
+				failures = 0 // The query made progress.
+			}
+			failures++
+			if failures > chunkRetries {
+				conv.Unexpected(fmt.Sprintf("Couldn't get data for chunk %d of table %s: %s", chunk, srcTable, err))
+				return
+			}
+			time.Sleep(internal.RetryDelay(chunkRetryDelay, failures))
+			continue
+		}
+		if n < chunkPageRows {
+			return
+		}
+		failures = 0
+	}
+}
+
+// chunkWhere returns a WHERE clause (and its arguments) that selects
+// rows whose primary key (the quoted columns keys) is greater than
+// after (or at least after, if inclusive) and less than upper. A nil
+// bound is ignored.
+func chunkWhere(keys []string, after []interface{}, inclusive bool, upper []interface{}) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	bound := func(op string, vals []interface{}) {
+		var params []string
+		for _, v := range vals {
+			args = append(args, v)
+			params = append(params, fmt.Sprintf("$%d", len(args)))
+		}
+		conds = append(conds, fmt.Sprintf("(%s) %s (%s)", strings.Join(keys, ", "), op, strings.Join(params, ", ")))
+	}
+	if after != nil {
+		if inclusive {
+			bound(">=", after)
+		} else {
+			bound(">", after)
+		}
+	}
+	if upper != nil {
+		bound("<", upper)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// keyCols returns the quoted primary key columns of table t.
+func keyCols(t schema.Table) []string {
+	var keys []string
+	for _, k := range t.PrimaryKeys {
+		keys = append(keys, fmt.Sprintf(`"%s"`, k.Column))
+	}
+	return keys
+}
+
+// keyVals returns the values of key columns keys, as returned by
+// rows.Scan, in a form that can be passed back as query arguments.
+// lib/pq returns some types (such as numeric) as []byte, which it
+// would send back as bytea, so we convert them to strings.
+func keyVals(t schema.Table, keys []schema.Key, vals []interface{}) []interface{} {
+	var l []interface{}
+	for i, k := range keys {
+		v := vals[i]
+		if b, ok := v.([]byte); ok && t.ColDefs[k.Column].Type.Name != "bytea" {
+			v = string(b)
+		}
+		l = append(l, v)
+	}
+	return l
+}
+
+func isIntType(name string) bool {
+	switch name {
+	case "int2", "int4", "int8", "smallint", "integer", "bigint", "smallserial", "serial", "bigserial":
+		return true
+	}
+	return false
+}
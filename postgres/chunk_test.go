@@ -0,0 +1,254 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/bits"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkWhere(t *testing.T) {
+	keys := []string{`"a"`, `"b"`}
+	lower := []interface{}{int64(1), "x"}
+	upper := []interface{}{int64(9), "y"}
+	where, args := chunkWhere(keys, nil, true, nil)
+	assert.Equal(t, "", where)
+	assert.Nil(t, args)
+	where, args = chunkWhere(keys, lower, true, upper)
+	assert.Equal(t, ` WHERE ("a", "b") >= ($1, $2) AND ("a", "b") < ($3, $4)`, where)
+	assert.Equal(t, []interface{}{int64(1), "x", int64(9), "y"}, args)
+	where, args = chunkWhere(keys, lower, false, nil)
+	assert.Equal(t, ` WHERE ("a", "b") > ($1, $2)`, where)
+	assert.Equal(t, lower, args)
+}
+
+// chunkConv returns a Conv in data mode with source table public.t,
+// with primary key a (of type keyType) and column b, and the rows
+// written to it.
+func chunkConv(t *testing.T, keyType string) (*internal.Conv, *[]spannerData) {
+	conv := internal.MakeConv()
+	conv.SetSchemaMode()
+	conv.SrcSchema["t"] = schema.Table{
+		Name:     "t",
+		ColNames: []string{"a", "b"},
+		ColDefs: map[string]schema.Column{
+			"a": schema.Column{Name: "a", Type: schema.Type{Name: keyType}, NotNull: true},
+			"b": schema.Column{Name: "b", Type: schema.Type{Name: "text"}},
+		},
+		PrimaryKeys: []schema.Key{schema.Key{Column: "a"}},
+	}
+	assert.Nil(t, schemaToDDL(conv))
+	conv.SetDataMode()
+	var rows []spannerData
+	conv.SetDataSink(func(table string, cols []string, vals []interface{}) {
+		rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
+	})
+	return conv, &rows
+}
+
+func TestSplitTable(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	table := schemaAndName{schema: "public", name: "t"}
+
+	// Integer keys are split into ranges between MIN and MAX.
+	conv, _ := chunkConv(t, "bigint")
+	mock.ExpectQuery(`SELECT MIN("a"), MAX("a") FROM "public"."t";`).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(int64(1), int64(100)))
+	assert.Equal(t, internal.IntKeyRanges(1, 100, 4), splitTable(conv, db, table, 100, 30))
+
+	// Other keys are split using a sample of keys.
+	conv, _ = chunkConv(t, "text")
+	samples := sqlmock.NewRows([]string{"a"})
+	var keys [][]interface{}
+	for _, k := range []string{"b", "d", "f", "h", "j", "l", "n", "p"} {
+		samples.AddRow(k)
+		keys = append(keys, []interface{}{k})
+	}
+	mock.ExpectQuery(`SELECT "a" FROM "public"."t" TABLESAMPLE BERNOULLI (80.000000) REPEATABLE (0) ORDER BY "a";`).
+		WillReturnRows(samples)
+	r := splitTable(conv, db, table, 100, 30)
+	assert.Equal(t, internal.SampleKeyRanges(keys, 4), r)
+	assert.Equal(t, 4, len(r))
+
+	// Small tables are read in one piece.
+	assert.Nil(t, splitTable(conv, db, table, 20, 30))
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestProcessChunkData(t *testing.T) {
+	defer func(rows int, delay time.Duration) { chunkPageRows, chunkRetryDelay = rows, delay }(chunkPageRows, chunkRetryDelay)
+	chunkPageRows, chunkRetryDelay = 2, time.Millisecond
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	conv, written := chunkConv(t, "bigint")
+	rows := func(keys ...int64) *sqlmock.Rows {
+		r := sqlmock.NewRows([]string{"a", "b"})
+		for _, k := range keys {
+			r.AddRow(k, fmt.Sprintf("row %d", k))
+		}
+		return r
+	}
+	first := `SELECT "a", "b" FROM "public"."t" WHERE ("a") >= ($1) AND ("a") < ($2) ORDER BY "a" LIMIT 2;`
+	next := `SELECT "a", "b" FROM "public"."t" WHERE ("a") > ($1) AND ("a") < ($2) ORDER BY "a" LIMIT 2;`
+	// A full page, so another page is read after its last key.
+	mock.ExpectQuery(first).WithArgs(int64(1), int64(10)).WillReturnRows(rows(1, 2))
+	// The query fails, and is retried.
+	mock.ExpectQuery(next).WithArgs(int64(2), int64(10)).WillReturnError(fmt.Errorf("connection reset"))
+	// The query fails after reading one row, and is retried after it.
+	mock.ExpectQuery(next).WithArgs(int64(2), int64(10)).WillReturnRows(rows(3, 4).RowError(1, fmt.Errorf("connection reset")))
+	// A partial page ends the chunk.
+	mock.ExpectQuery(next).WithArgs(int64(3), int64(10)).WillReturnRows(rows(4))
+	processChunkData(conv, db, schemaAndName{schema: "public", name: "t"}, 0, internal.KeyRange{Lower: []interface{}{int64(1)}, Upper: []interface{}{int64(10)}})
+	assert.Nil(t, mock.ExpectationsWereMet())
+	var keys []interface{}
+	for _, r := range *written {
+		keys = append(keys, r.vals[0])
+	}
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), int64(4)}, keys)
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+	assert.Equal(t, int64(0), conv.BadRows())
+}
+
+// TestProcessChunkedDataParallel converts several chunked tables, and
+// tables with synthetic primary keys, with several workers. Run with
+// -race to check that updates of Conv are threadsafe.
+func TestProcessChunkedDataParallel(t *testing.T) {
+	// Run workers in parallel even on a single CPU.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	mock.MatchExpectationsInOrder(false)
+	conv := internal.MakeConv()
+	conv.SetSchemaMode()
+	var tables []schemaAndName
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("t%d", i)
+		st := schema.Table{
+			Name:     name,
+			ColNames: []string{"a", "b"},
+			ColDefs: map[string]schema.Column{
+				"a": schema.Column{Name: "a", Type: schema.Type{Name: "bigint"}, NotNull: true},
+				"b": schema.Column{Name: "b", Type: schema.Type{Name: "text"}},
+			},
+		}
+		if i%2 == 0 {
+			// Read in chunks.
+			st.PrimaryKeys = []schema.Key{schema.Key{Column: "a"}}
+		}
+		conv.SrcSchema[name] = st
+		tables = append(tables, schemaAndName{schema: "public", name: name})
+	}
+	assert.Nil(t, schemaToDDL(conv))
+	conv.AddPrimaryKeys()
+	conv.SetDataMode()
+	// Record the synthetic key of tables without a primary key, and
+	// column b of others.
+	key := make(map[string]string)
+	for _, tn := range tables {
+		key[tn.name] = "b"
+		if sk, ok := conv.SyntheticPKeys[tn.name]; ok {
+			key[tn.name] = sk.Col
+		}
+	}
+	// Rows are written without locking (slots are set up beforehand, and
+	// each is written by one go routine), so that locking in the sink
+	// can't hide races in Conv.
+	written := make(map[string][][]interface{})
+	for _, tn := range tables {
+		written[tn.name] = make([][]interface{}, 4)
+	}
+	record := func(table string, chunk int, cols []string, vals []interface{}) {
+		for i, c := range cols {
+			if c == key[table] {
+				written[table][chunk] = append(written[table][chunk], vals[i])
+			}
+		}
+	}
+	conv.SetDataSink(func(table string, cols []string, vals []interface{}) { record(table, 0, cols, vals) })
+	conv.SetChunkDataSink(record)
+	want := make(map[string][]interface{})
+	for _, tn := range tables {
+		st := conv.SrcSchema[tn.name]
+		conv.Stats.Rows[tn.name] = 100
+		if len(st.PrimaryKeys) == 0 {
+			rows := sqlmock.NewRows([]string{"a", "b"})
+			for j := 0; j < 200; j++ {
+				rows.AddRow(int64(j), "x")
+				want[tn.name] = append(want[tn.name], int64(bits.Reverse64(uint64(j))))
+			}
+			mock.ExpectQuery(fmt.Sprintf(`SELECT * FROM "public"."%s";`, tn.name)).WillReturnRows(rows)
+			continue
+		}
+		mock.ExpectQuery(fmt.Sprintf(`SELECT MIN("a"), MAX("a") FROM "public"."%s";`, tn.name)).
+			WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(int64(1), int64(100)))
+		for j, r := range internal.IntKeyRanges(1, 100, 4) {
+			where, args := chunkWhere(keyCols(st), r.Lower, true, r.Upper)
+			var vals []driver.Value
+			for _, a := range args {
+				vals = append(vals, a)
+			}
+			k := fmt.Sprintf("chunk %d of %s", j, tn.name)
+			mock.ExpectQuery(fmt.Sprintf(`SELECT "a", "b" FROM "public"."%s"%s ORDER BY "a" LIMIT %d;`, tn.name, where, chunkPageRows)).
+				WithArgs(vals...).WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow(int64(j), k))
+			want[tn.name] = append(want[tn.name], k)
+		}
+	}
+	processChunkedData(conv, func(int) querier { return db }, tables, 4, 30)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+	for _, tn := range tables {
+		var got []interface{}
+		for _, w := range written[tn.name] {
+			got = append(got, w...)
+		}
+		assert.Equal(t, want[tn.name], got, tn.name)
+		assert.Equal(t, int64(len(want[tn.name])), conv.Stats.GoodRows[tn.name], tn.name)
+	}
+}
+
+func TestResumeRead(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.Nil(t, err)
+	conv, written := chunkConv(t, "bigint")
+	var seeks []int
+	conv.SetSeek(func(table string, chunk int) ([]string, int64) {
+		seeks = append(seeks, chunk)
+		return []string{"5"}, 4
+	})
+	table := schemaAndName{schema: "public", name: "t"}
+	// Chunks are read after the last row written.
+	mock.ExpectQuery(`SELECT "a", "b" FROM "public"."t" WHERE ("a") > ($1) AND ("a") < ($2) ORDER BY "a" LIMIT 10000;`).WithArgs("5", int64(10)).
+		WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow(int64(6), "x"))
+	processChunkData(conv, db, table, 1, internal.KeyRange{Lower: []interface{}{int64(1)}, Upper: []interface{}{int64(10)}})
+	// So are tables read in one piece.
+	mock.ExpectQuery(`SELECT * FROM "public"."t" WHERE ("a") > ($1) ORDER BY "a";`).WithArgs("5").
+		WillReturnRows(sqlmock.NewRows([]string{"a", "b"}).AddRow(int64(6), "x"))
+	processTableData(conv, db, table)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []int{1, -1}, seeks)
+	assert.Equal(t, 2, len(*written))
+	// Rows that weren't read are counted as good rows.
+	assert.Equal(t, int64(10), conv.Stats.GoodRows["t"])
+}
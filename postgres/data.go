@@ -75,6 +75,11 @@ func ConvertData(conv *internal.Conv, srcTable string, srcCols []string, vals []
 	}
 	for i, spCol := range spCols {
 		srcCol := srcCols[i]
+		if spSchema.ColDefs[spCol].Generated != nil {
+			// Spanner computes the values of generated columns, and
+			// rejects writes to them.
+			continue
+		}
 		if vals[i] == "\\N" { // PostgreSQL representation of empty column in COPY-FROM blocks.
 			continue
 		}
@@ -96,11 +101,9 @@ func ConvertData(conv *internal.Conv, srcTable string, srcCols []string, vals []
 		v = append(v, x)
 		c = append(c, spCol)
 	}
-	if aux, ok := conv.SyntheticPKeys[spTable]; ok {
-		c = append(c, aux.Col)
-		v = append(v, int64(bits.Reverse64(uint64(aux.Sequence))))
-		aux.Sequence++
-		conv.SyntheticPKeys[spTable] = aux
+	if col, seq, ok := conv.NextSyntheticPKey(spTable); ok {
+		c = append(c, col)
+		v = append(v, int64(bits.Reverse64(uint64(seq))))
 	}
 	return spTable, c, v, nil
 }
@@ -128,6 +131,8 @@ func convScalar(spannerType ddl.Type, srcTypeName string, location *time.Locatio
 		return convInt64(val)
 	case ddl.Numeric:
 		return convNumeric(val)
+	case ddl.JSON:
+		return convJSON(val)
 	case ddl.String:
 		return val, nil
 	case ddl.Timestamp:
@@ -193,6 +198,16 @@ func convNumeric(val string) (string, error) {
 	return spanner.NumericString(r), nil
 }
 
+// convJSON validates JSON text val, and normalizes it (see
+// internal.NormalizeJSON). We write JSON values to Spanner as text.
+func convJSON(val string) (string, error) {
+	s, err := internal.NormalizeJSON(val)
+	if err != nil {
+		return "", fmt.Errorf("can't convert to json: %w", err)
+	}
+	return s, nil
+}
+
 // convTimestamp maps a source DB timestamp into a go Time (which
 // is translated to a Spanner timestamp by the go Spanner client library).
 // It handles both timestamptz and timestamp conversions.
@@ -360,6 +375,24 @@ func convArray(spannerType ddl.Type, srcTypeName string, location *time.Location
 			r = append(r, spanner.NullString{StringVal: s, Valid: true})
 		}
 		return r, nil
+	case ddl.JSON:
+		var r []spanner.NullString
+		for _, s := range a {
+			if s == "NULL" {
+				r = append(r, spanner.NullString{Valid: false})
+				continue
+			}
+			s, err := processQuote(s)
+			if err != nil {
+				return []spanner.NullString{}, err
+			}
+			j, err := convJSON(s)
+			if err != nil {
+				return []spanner.NullString{}, err
+			}
+			r = append(r, spanner.NullString{StringVal: j, Valid: true})
+		}
+		return r, nil
 	case ddl.Timestamp:
 		var r []spanner.NullTime
 		for _, s := range a {
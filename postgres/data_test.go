@@ -73,6 +73,7 @@ func TestConvertData(t *testing.T) {
 		{"date", ddl.Type{Name: ddl.Date}, "", "2019-10-29", getDate("2019-10-29")},
 		{"float64", ddl.Type{Name: ddl.Float64}, "", "42.6", float64(42.6)},
 		{"int64", ddl.Type{Name: ddl.Int64}, "", "42", int64(42)},
+		{"json", ddl.Type{Name: ddl.JSON}, "", `{"b": 1.50, "a": [true, null]}`, `{"a":[true,null],"b":1.50}`},
 		{"string", ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, "", "eh", "eh"},
 		{"timestamptz", ddl.Type{Name: ddl.Timestamp}, "timestamptz", "2019-10-29 05:30:00+10", getTime(t, "2019-10-29T05:30:00+10:00")},
 		{"timestamp", ddl.Type{Name: ddl.Timestamp}, "timestamp", "2019-10-29 05:30:00", getTime(t, "2019-10-29T05:30:00Z")},
@@ -98,6 +99,10 @@ func TestConvertData(t *testing.T) {
 			spanner.NullInt64{Int64: 1, Valid: true},
 			spanner.NullInt64{Int64: 2, Valid: true},
 			spanner.NullInt64{Int64: 3, Valid: true}}},
+		{"json array", ddl.Type{Name: ddl.JSON, IsArray: true}, "", `{"{\"a\": 1}",NULL,3}`, []spanner.NullString{
+			spanner.NullString{StringVal: `{"a":1}`, Valid: true},
+			spanner.NullString{Valid: false},
+			spanner.NullString{StringVal: "3", Valid: true}}},
 		{"string array", ddl.Type{Name: ddl.String, Len: ddl.MaxLength, IsArray: true}, "", `{1,NULL,3,"NULL"}`, []spanner.NullString{
 			spanner.NullString{StringVal: "1", Valid: true},
 			spanner.NullString{Valid: false},
@@ -0,0 +1,122 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func init() {
+	source.Register("pg_dump", dumpDriver{})
+	source.Register("postgres", infoSchemaDriver{})
+}
+
+// dumpDriver implements source.Driver for pg_dump output: plain-text
+// SQL and custom format archives (read from src.Reader), or directory
+// format archives (read from src.Dir).
+type dumpDriver struct{}
+
+func (dumpDriver) Kind() source.Kind { return source.Dump }
+
+func (dumpDriver) ProcessSchema(conv *internal.Conv, src source.Source) error {
+	if src.Dir != "" {
+		return ProcessPgDumpDir(conv, src.Dir)
+	}
+	return ProcessPgDump(conv, src.Reader)
+}
+
+// SetRowStats is a no-op: rows are counted during the schema pass.
+func (dumpDriver) SetRowStats(conv *internal.Conv, src source.Source) error { return nil }
+
+func (dumpDriver) ProcessData(conv *internal.Conv, src source.Source) error {
+	if src.Dir != "" {
+		return ProcessPgDumpDir(conv, src.Dir)
+	}
+	return ProcessPgDump(conv, src.Reader)
+}
+
+func (dumpDriver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	return remapType(srcType, spType, mods)
+}
+
+// infoSchemaDriver implements source.Driver (along with
+// source.Connector and source.ChangeStreamer) for direct connections to
+// a PostgreSQL database.
+type infoSchemaDriver struct{}
+
+func (infoSchemaDriver) Kind() source.Kind { return source.SQL }
+
+func (infoSchemaDriver) ProcessSchema(conv *internal.Conv, src source.Source) error {
+	return ProcessInfoSchema(conv, src.DB)
+}
+
+func (infoSchemaDriver) SetRowStats(conv *internal.Conv, src source.Source) error {
+	SetRowStats(conv, src.DB)
+	return nil
+}
+
+func (infoSchemaDriver) ProcessData(conv *internal.Conv, src source.Source) error {
+	var repl *sql.DB
+	if conv.CaptureChanges != "" {
+		// Replication slots that export a snapshot are created over a
+		// replication connection (see createSlot).
+		var err error
+		repl, err = sql.Open("postgres", src.DSN+" replication=database")
+		if err != nil {
+			return err
+		}
+		defer repl.Close()
+	}
+	ProcessSQLData(conv, src.DB, repl, src.Workers, src.ChunkRows)
+	return nil
+}
+
+func (infoSchemaDriver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	return remapType(srcType, spType, mods)
+}
+
+// ConfigFromEnv builds a connection config using the standard
+// PostgreSQL environment variables.
+func (infoSchemaDriver) ConfigFromEnv() (source.Config, error) {
+	c := source.Config{
+		Host:     os.Getenv("PGHOST"),
+		Port:     os.Getenv("PGPORT"),
+		User:     os.Getenv("PGUSER"),
+		Database: os.Getenv("PGDATABASE"),
+		Password: os.Getenv("PGPASSWORD"),
+	}
+	if c.Host == "" || c.Port == "" || c.User == "" || c.Database == "" {
+		fmt.Printf("Please specify host, port, user and database using PGHOST, PGPORT, PGUSER and PGDATABASE environment variables\n")
+		return c, fmt.Errorf("Could not connect to source database")
+	}
+	return c, nil
+}
+
+func (infoSchemaDriver) DataSourceName(c source.Config) (string, string) {
+	return "postgres", fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", c.Host, c.Port, c.User, c.Password, c.Database)
+}
+
+func (infoSchemaDriver) StreamChanges(conv *internal.Conv, src source.Source, pos string, apply func(ms []*sp.Mutation, pos string, commitTime time.Time) error) error {
+	return StreamChanges(conv, src.DB, src.Changes, pos, src.Follow, apply)
+}
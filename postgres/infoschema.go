@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/civil"
@@ -31,10 +32,9 @@ import (
 	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
 )
 
-// TODO: All of the queries to get tables and table data should be in
-// a single transaction to ensure we obtain a consistent snapshot of
-// schema information and table data (pg_dump does something
-// similar).
+// TODO: Schema information is read separately from table data, so
+// schema changes made during a migration aren't detected. Table data
+// is read from a single consistent snapshot (see snapshot).
 
 // ProcessInfoSchema performs schema conversion for source database
 // 'db'. Information schema tables are a broadly supported ANSI standard,
@@ -73,7 +73,17 @@ func ProcessInfoSchema(conv *internal.Conv, db *sql.DB) error {
 // We choose to do all type conversions explicitly ourselves so that
 // we can generate more targeted error messages: hence we pass
 // *interface{} parameters to row.Scan.
-func ProcessSQLData(conv *internal.Conv, db *sql.DB) {
+//
+// If workers is greater than 1, up to workers tables are read
+// concurrently, each using its own connection from db's pool. If
+// chunkRows is positive, tables with more than chunkRows rows are
+// split into primary key ranges that are read concurrently (see
+// processChunkedData). All connections read the same snapshot of db,
+// so data from different tables is consistent. If conv.CaptureChanges
+// is set, repl must be a connection to db opened with
+// replication=database, which is used to create the replication slot
+// (see readers).
+func ProcessSQLData(conv *internal.Conv, db, repl *sql.DB, workers int, chunkRows int64) {
 	// TODO: refactor to use the set of tables computed by
 	// ProcessInfoSchema instead of computing them again.
 	tables, err := getTables(db)
@@ -81,50 +91,85 @@ func ProcessSQLData(conv *internal.Conv, db *sql.DB) {
 		conv.Unexpected(fmt.Sprintf("Couldn't get list of table: %s", err))
 		return
 	}
-	for _, t := range tables {
-		// PostgreSQL schema and name can be arbitrary strings.
-		// Ideally we would pass schema/name as a query parameter,
-		// but PostgreSQL doesn't support this. So we quote it instead.
-		q := fmt.Sprintf(`SELECT * FROM "%s"."%s";`, t.schema, t.name)
-		rows, err := db.Query(q)
+	reader, done := readers(conv, db, repl, workers)
+	defer done()
+	if chunkRows > 0 {
+		processChunkedData(conv, reader, tables, workers, chunkRows)
+		return
+	}
+	internal.ForEachWorker(len(tables), workers, func(w, i int) {
+		processTableData(conv, reader(w), tables[i])
+	})
+}
+
+// processTableData performs data conversion for table t.
+func processTableData(conv *internal.Conv, db querier, t schemaAndName) {
+	srcTable := buildTableName(t.schema, t.name)
+	// PostgreSQL schema and name can be arbitrary strings.
+	// Ideally we would pass schema/name as a query parameter,
+	// but PostgreSQL doesn't support this. So we quote it instead.
+	// Rows are read in primary key order so that an interrupted
+	// data migration can be resumed (see spanner.Checkpoint), from
+	// the last row written if the table has a suitable key.
+	var where string
+	var args []interface{}
+	if k := conv.ResumeKey(srcTable, -1); k != nil {
+		where, args = chunkWhere(keyCols(conv.SrcSchema[srcTable]), k, false, nil)
+	}
+	q := fmt.Sprintf(`SELECT %s FROM "%s"."%s"%s%s;`, selectList(conv, srcTable), t.schema, t.name, where, orderBy(conv.SrcSchema[srcTable]))
+	rows, err := db.Query(q, args...)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get data for table: %s", err))
+		return
+	}
+	defer rows.Close()
+	srcCols, err1 := rows.Columns()
+	spTable, err2 := internal.GetSpannerTable(conv, srcTable)
+	spCols, err3 := internal.GetSpannerCols(conv, srcTable, srcCols)
+	spSchema, ok1 := conv.SpSchema[spTable]
+	srcSchema, ok2 := conv.SrcSchema[srcTable]
+	if err1 != nil || err2 != nil || err3 != nil || !ok1 || !ok2 {
+		conv.StatsAddBadTable(srcTable)
+		conv.Unexpected(fmt.Sprintf("Can't get cols and schemas for table %s: err1=%s, err2=%s, err3=%s, ok1=%t, ok2=%t",
+			srcTable, err1, err2, err3, ok1, ok2))
+		return
+	}
+	v, iv := buildVals(len(srcCols))
+	for rows.Next() {
+		err := rows.Scan(iv...)
 		if err != nil {
-			conv.Unexpected(fmt.Sprintf("Couldn't get data for table: %s", err))
+			conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+			// Scan failed, so we don't have any data to add to bad rows.
+			conv.StatsAddBadRow(srcTable, conv.DataMode())
 			continue
 		}
-		defer rows.Close()
-		srcTable := buildTableName(t.schema, t.name)
-		srcCols, err1 := rows.Columns()
-		spTable, err2 := internal.GetSpannerTable(conv, srcTable)
-		spCols, err3 := internal.GetSpannerCols(conv, srcTable, srcCols)
-		spSchema, ok1 := conv.SpSchema[spTable]
-		srcSchema, ok2 := conv.SrcSchema[srcTable]
-		if err1 != nil || err2 != nil || err3 != nil || !ok1 || !ok2 {
-			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
-			conv.Unexpected(fmt.Sprintf("Can't get cols and schemas for table %s: err1=%s, err2=%s, err3=%s, ok1=%t, ok2=%t",
-				srcTable, err1, err2, err3, ok1, ok2))
+		cvtCols, cvtVals, err := ConvertSQLRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, v)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+			conv.StatsAddBadRow(srcTable, conv.DataMode())
+			conv.CollectBadRow(srcTable, srcCols, valsToStrings(v))
 			continue
 		}
-		v, iv := buildVals(len(srcCols))
-		for rows.Next() {
-			err := rows.Scan(iv...)
-			if err != nil {
-				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
-				// Scan failed, so we don't have any data to add to bad rows.
-				conv.StatsAddBadRow(srcTable, conv.DataMode())
-				continue
-			}
-			cvtCols, cvtVals, err := ConvertSQLRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, v)
-			if err != nil {
-				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
-				conv.StatsAddBadRow(srcTable, conv.DataMode())
-				conv.CollectBadRow(srcTable, srcCols, valsToStrings(v))
-				continue
-			}
-			conv.WriteRow(srcTable, spTable, cvtCols, cvtVals)
-		}
+		conv.WriteRow(srcTable, spTable, cvtCols, cvtVals)
 	}
 }
 
+// selectList returns the select list of the query that reads the data
+// of table srcTable: "*", unless some of its columns are converted to
+// Spanner generated columns, which aren't read (see
+// internal.Conv.DataCols).
+func selectList(conv *internal.Conv, srcTable string) string {
+	cols := conv.DataCols(srcTable)
+	if len(cols) == len(conv.SrcSchema[srcTable].ColNames) {
+		return "*"
+	}
+	var quoted []string
+	for _, c := range cols {
+		quoted = append(quoted, fmt.Sprintf(`"%s"`, c))
+	}
+	return strings.Join(quoted, ", ")
+}
+
 // ConvertSQLRow performs data conversion for a single row of data
 // returned from a 'SELECT *' query. ConvertSQLRow assumes that
 // srcCols, spCols and srcVals all have the same length. Note that
@@ -143,6 +188,11 @@ func ConvertSQLRow(conv *internal.Conv, srcTable string, srcCols []string, srcSc
 		if srcVals[i] == nil {
 			continue // Skip NULL values (nil is used by database/sql to represent NULL values).
 		}
+		if spCd.Generated != nil {
+			// Spanner computes the values of generated columns, and
+			// rejects writes to them.
+			continue
+		}
 		var spVal interface{}
 		var err error
 		if spCd.T.IsArray {
@@ -156,11 +206,9 @@ func ConvertSQLRow(conv *internal.Conv, srcTable string, srcCols []string, srcSc
 		vs = append(vs, spVal)
 		cs = append(cs, srcCols[i])
 	}
-	if aux, ok := conv.SyntheticPKeys[spTable]; ok {
-		cs = append(cs, aux.Col)
-		vs = append(vs, int64(bits.Reverse64(uint64(aux.Sequence))))
-		aux.Sequence++
-		conv.SyntheticPKeys[spTable] = aux
+	if col, seq, ok := conv.NextSyntheticPKey(spTable); ok {
+		cs = append(cs, col)
+		vs = append(vs, int64(bits.Reverse64(uint64(seq))))
 	}
 	return cs, vs, nil
 }
@@ -261,7 +309,7 @@ func processTable(conv *internal.Conv, db *sql.DB, table schemaAndName) error {
 }
 
 func getColumns(table schemaAndName, db *sql.DB) (*sql.Rows, error) {
-	q := `SELECT c.column_name, c.data_type, e.data_type, c.is_nullable, c.column_default, c.character_maximum_length, c.numeric_precision, c.numeric_scale
+	q := `SELECT c.column_name, c.data_type, e.data_type, c.is_nullable, c.column_default, c.character_maximum_length, c.numeric_precision, c.numeric_scale, c.is_generated, c.generation_expression
               FROM information_schema.COLUMNS c LEFT JOIN information_schema.element_types e
                  ON ((c.table_catalog, c.table_schema, c.table_name, 'TABLE', c.dtd_identifier)
                      = (e.object_catalog, e.object_schema, e.object_name, e.object_type, e.collection_type_identifier))
@@ -273,10 +321,10 @@ func processColumns(conv *internal.Conv, cols *sql.Rows, constraints map[string]
 	colDefs := make(map[string]schema.Column)
 	var colNames []string
 	var colName, dataType, isNullable string
-	var colDefault, elementDataType sql.NullString
+	var colDefault, elementDataType, isGenerated, generationExpr sql.NullString
 	var charMaxLen, numericPrecision, numericScale sql.NullInt64
 	for cols.Next() {
-		err := cols.Scan(&colName, &dataType, &elementDataType, &isNullable, &colDefault, &charMaxLen, &numericPrecision, &numericScale)
+		err := cols.Scan(&colName, &dataType, &elementDataType, &isNullable, &colDefault, &charMaxLen, &numericPrecision, &numericScale, &isGenerated, &generationExpr)
 		if err != nil {
 			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
 			continue
@@ -297,12 +345,17 @@ func processColumns(conv *internal.Conv, cols *sql.Rows, constraints map[string]
 			}
 		}
 		ignored.Default = colDefault.Valid
+		// is_generated is ALWAYS for (stored) generated columns, which
+		// PostgreSQL supports from version 12.
+		ignored.Generated = isGenerated.String == "ALWAYS"
 		c := schema.Column{
-			Name:    colName,
-			Type:    toType(dataType, elementDataType, charMaxLen, numericPrecision, numericScale),
-			NotNull: toNotNull(conv, isNullable),
-			Unique:  unique,
-			Ignored: ignored,
+			Name:      colName,
+			Type:      toType(dataType, elementDataType, charMaxLen, numericPrecision, numericScale),
+			NotNull:   toNotNull(conv, isNullable),
+			Unique:    unique,
+			Default:   colDefault.String,
+			Generated: generationExpr.String,
+			Ignored:   ignored,
 		}
 		colDefs[colName] = c
 		colNames = append(colNames, colName)
@@ -586,6 +639,13 @@ func cvtSQLScalar(conv *internal.Conv, srcCd schema.Column, spCd ddl.ColumnDef,
 		case []byte: // Note: PostgreSQL uses []byte for numeric.
 			return convNumeric(string(v))
 		}
+	case ddl.JSON:
+		switch v := val.(type) {
+		case []byte:
+			return convJSON(string(v))
+		case string:
+			return convJSON(v)
+		}
 	case ddl.String:
 		switch v := val.(type) {
 		case bool:
@@ -648,3 +708,16 @@ func buildTableName(schema, name string) string {
 	}
 	return fmt.Sprintf("%s.%s", schema, name)
 }
+
+// orderBy returns an ORDER BY clause that sorts rows of table t by its
+// primary key, or "" if t has no primary key.
+func orderBy(t schema.Table) string {
+	var keys []string
+	for _, k := range t.PrimaryKeys {
+		keys = append(keys, fmt.Sprintf(`"%s"`, k.Column))
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
@@ -33,6 +33,7 @@ type mockSpec struct {
 	args  []driver.Value   // Query args.
 	cols  []string         // Columns names for returned rows.
 	rows  [][]driver.Value // Set of rows returned.
+	exec  bool             // Statement is run using Exec, and returns no rows.
 }
 
 func TestProcessInfoSchema(t *testing.T) {
@@ -50,11 +51,11 @@ func TestProcessInfoSchema(t *testing.T) {
 		{
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"public", "user"},
-			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale"},
+			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "is_generated", "generation_expression"},
 			rows: [][]driver.Value{
-				{"user_id", "text", nil, "NO", nil, nil, nil, nil},
-				{"name", "text", nil, "NO", nil, nil, nil, nil},
-				{"ref", "bigint", nil, "YES", nil, nil, nil, nil}},
+				{"user_id", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil},
+				{"name", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil},
+				{"ref", "bigint", nil, "YES", nil, nil, nil, nil, "NEVER", nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"public", "user"},
@@ -76,11 +77,11 @@ func TestProcessInfoSchema(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"public", "cart"},
-			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale"},
+			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "is_generated", "generation_expression"},
 			rows: [][]driver.Value{
-				{"productid", "text", nil, "NO", nil, nil, nil, nil},
-				{"userid", "text", nil, "NO", nil, nil, nil, nil},
-				{"quantity", "bigint", nil, "YES", nil, nil, 64, 0}},
+				{"productid", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil},
+				{"userid", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil},
+				{"quantity", "bigint", nil, "YES", nil, nil, 64, 0, "NEVER", nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"public", "cart"},
@@ -108,10 +109,10 @@ func TestProcessInfoSchema(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"public", "product"},
-			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale"},
+			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "is_generated", "generation_expression"},
 			rows: [][]driver.Value{
-				{"product_id", "text", nil, "NO", nil, nil, nil, nil},
-				{"product_name", "text", nil, "NO", nil, nil, nil, nil}},
+				{"product_id", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil},
+				{"product_name", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"public", "product"},
@@ -129,29 +130,29 @@ func TestProcessInfoSchema(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"public", "test"},
-			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale"},
+			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "is_generated", "generation_expression"},
 			rows: [][]driver.Value{
-				{"id", "bigint", nil, "NO", nil, nil, 64, 0},
-				{"aint", "ARRAY", "integer", "YES", nil, nil, nil, nil},
-				{"atext", "ARRAY", "text", "YES", nil, nil, nil, nil},
-				{"b", "boolean", nil, "YES", nil, nil, nil, nil},
-				{"bs", "bigint", nil, "NO", "nextval('test11_bs_seq'::regclass)", nil, 64, 0},
-				{"by", "bytea", nil, "YES", nil, nil, nil, nil},
-				{"c", "character", nil, "YES", nil, 1, nil, nil},
-				{"c8", "character", nil, "YES", nil, 8, nil, nil},
-				{"d", "date", nil, "YES", nil, nil, nil, nil},
-				{"f8", "double precision", nil, "YES", nil, nil, 53, nil},
-				{"f4", "real", nil, "YES", nil, nil, 24, nil},
-				{"i8", "bigint", nil, "YES", nil, nil, 64, 0},
-				{"i4", "integer", nil, "YES", nil, nil, 32, 0},
-				{"i2", "smallint", nil, "YES", nil, nil, 16, 0},
-				{"num", "numeric", nil, "YES", nil, nil, nil, nil},
-				{"s", "integer", nil, "NO", "nextval('test11_s_seq'::regclass)", nil, 32, 0},
-				{"ts", "timestamp without time zone", nil, "YES", nil, nil, nil, nil},
-				{"tz", "timestamp with time zone", nil, "YES", nil, nil, nil, nil},
-				{"txt", "text", nil, "NO", nil, nil, nil, nil},
-				{"vc", "character varying", nil, "YES", nil, nil, nil, nil},
-				{"vc6", "character varying", nil, "YES", nil, 6, nil, nil}},
+				{"id", "bigint", nil, "NO", nil, nil, 64, 0, "NEVER", nil},
+				{"aint", "ARRAY", "integer", "YES", nil, nil, nil, nil, "NEVER", nil},
+				{"atext", "ARRAY", "text", "YES", nil, nil, nil, nil, "NEVER", nil},
+				{"b", "boolean", nil, "YES", "true", nil, nil, nil, "NEVER", nil},
+				{"bs", "bigint", nil, "NO", "nextval('test11_bs_seq'::regclass)", nil, 64, 0, "NEVER", nil},
+				{"by", "bytea", nil, "YES", nil, nil, nil, nil, "NEVER", nil},
+				{"c", "character", nil, "YES", nil, 1, nil, nil, "NEVER", nil},
+				{"c8", "character", nil, "YES", nil, 8, nil, nil, "NEVER", nil},
+				{"d", "date", nil, "YES", nil, nil, nil, nil, "NEVER", nil},
+				{"f8", "double precision", nil, "YES", nil, nil, 53, nil, "NEVER", nil},
+				{"f4", "real", nil, "YES", nil, nil, 24, nil, "NEVER", nil},
+				{"i8", "bigint", nil, "YES", "42", nil, 64, 0, "NEVER", nil},
+				{"i4", "integer", nil, "YES", nil, nil, 32, 0, "NEVER", nil},
+				{"i2", "smallint", nil, "YES", nil, nil, 16, 0, "NEVER", nil},
+				{"num", "numeric", nil, "YES", nil, nil, nil, nil, "NEVER", nil},
+				{"s", "integer", nil, "NO", "nextval('test11_s_seq'::regclass)", nil, 32, 0, "NEVER", nil},
+				{"ts", "timestamp without time zone", nil, "YES", nil, nil, nil, nil, "NEVER", nil},
+				{"tz", "timestamp with time zone", nil, "YES", "now()", nil, nil, nil, "NEVER", nil},
+				{"txt", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil},
+				{"vc", "character varying", nil, "YES", "'abc'::character varying", nil, nil, nil, "NEVER", nil},
+				{"vc6", "character varying", nil, "YES", nil, 6, nil, nil, "NEVER", nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"public", "test"},
@@ -170,11 +171,11 @@ func TestProcessInfoSchema(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"public", "test_ref"},
-			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale"},
+			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "is_generated", "generation_expression"},
 			rows: [][]driver.Value{
-				{"ref_id", "bigint", nil, "NO", nil, nil, 64, 0},
-				{"ref_txt", "text", nil, "NO", nil, nil, nil, nil},
-				{"abc", "text", nil, "NO", nil, nil, nil, nil}},
+				{"ref_id", "bigint", nil, "NO", nil, nil, 64, 0, "NEVER", nil},
+				{"ref_txt", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil},
+				{"abc", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil}},
 		}, {
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
 			args:  []driver.Value{"public", "test_ref"},
@@ -236,7 +237,7 @@ func TestProcessInfoSchema(t *testing.T) {
 				"id":    ddl.ColumnDef{Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
 				"aint":  ddl.ColumnDef{Name: "aint", T: ddl.Type{Name: ddl.Int64, IsArray: true}},
 				"atext": ddl.ColumnDef{Name: "atext", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength, IsArray: true}},
-				"b":     ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.Bool}},
+				"b":     ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.Bool}, Default: &ddl.Default{Value: "true"}},
 				"bs":    ddl.ColumnDef{Name: "bs", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
 				"by":    ddl.ColumnDef{Name: "by", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
 				"c":     ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.String, Len: int64(1)}},
@@ -244,15 +245,15 @@ func TestProcessInfoSchema(t *testing.T) {
 				"d":     ddl.ColumnDef{Name: "d", T: ddl.Type{Name: ddl.Date}},
 				"f8":    ddl.ColumnDef{Name: "f8", T: ddl.Type{Name: ddl.Float64}},
 				"f4":    ddl.ColumnDef{Name: "f4", T: ddl.Type{Name: ddl.Float64}},
-				"i8":    ddl.ColumnDef{Name: "i8", T: ddl.Type{Name: ddl.Int64}},
+				"i8":    ddl.ColumnDef{Name: "i8", T: ddl.Type{Name: ddl.Int64}, Default: &ddl.Default{Value: "42"}},
 				"i4":    ddl.ColumnDef{Name: "i4", T: ddl.Type{Name: ddl.Int64}},
 				"i2":    ddl.ColumnDef{Name: "i2", T: ddl.Type{Name: ddl.Int64}},
 				"num":   ddl.ColumnDef{Name: "num", T: ddl.Type{Name: ddl.Numeric}},
 				"s":     ddl.ColumnDef{Name: "s", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
 				"ts":    ddl.ColumnDef{Name: "ts", T: ddl.Type{Name: ddl.Timestamp}},
-				"tz":    ddl.ColumnDef{Name: "tz", T: ddl.Type{Name: ddl.Timestamp}},
+				"tz":    ddl.ColumnDef{Name: "tz", T: ddl.Type{Name: ddl.Timestamp}, Default: &ddl.Default{Now: true}},
 				"txt":   ddl.ColumnDef{Name: "txt", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, NotNull: true},
-				"vc":    ddl.ColumnDef{Name: "vc", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"vc":    ddl.ColumnDef{Name: "vc", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, Default: &ddl.Default{Value: "abc"}},
 				"vc6":   ddl.ColumnDef{Name: "vc6", T: ddl.Type{Name: ddl.String, Len: int64(6)}},
 			},
 			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "id"}},
@@ -292,6 +293,9 @@ func TestProcessSqlData(t *testing.T) {
 			query: "SELECT table_schema, table_name FROM information_schema.tables where table_type = 'BASE TABLE'",
 			cols:  []string{"table_schema", "table_name"},
 			rows:  [][]driver.Value{{"public", "te st"}},
+		}, {
+			query: "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY",
+			exec:  true,
 		}, {
 			query: `SELECT [*] FROM "public"."te st"`, // query is a regexp!
 			cols:  []string{"a a", " b", " c "},
@@ -299,6 +303,9 @@ func TestProcessSqlData(t *testing.T) {
 				{42.3, 3, "cat"},
 				{6.6, 22, "dog"},
 				{6.6, "2006-01-02", "dog"}}, // Test bad row logic.
+		}, {
+			query: "COMMIT",
+			exec:  true,
 		},
 	}
 	db := mkMockDB(t, ms)
@@ -325,7 +332,7 @@ func TestProcessSqlData(t *testing.T) {
 		func(table string, cols []string, vals []interface{}) {
 			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
 		})
-	ProcessSQLData(conv, db)
+	ProcessSQLData(conv, db, nil, 1, 0)
 
 	assert.Equal(t,
 		[]spannerData{
@@ -361,6 +368,7 @@ func TestConvertSqlRow_SingleCol(t *testing.T) {
 		{name: "float64 int", srcType: schema.Type{Name: "bigint"}, spType: ddl.Type{Name: ddl.Float64}, in: int64(42), e: float64(42)},
 		{name: "float64 byte", srcType: schema.Type{Name: "numeric"}, spType: ddl.Type{Name: ddl.Float64}, in: []byte("42.6"), e: float64(42.6)},
 		{name: "numeric", srcType: schema.Type{Name: "numeric"}, spType: ddl.Type{Name: ddl.Numeric}, in: []byte("999.99999"), e: "999.999990000"},
+		{name: "json", srcType: schema.Type{Name: "jsonb"}, spType: ddl.Type{Name: ddl.JSON}, in: []byte(`{"b": 1, "a": "x"}`), e: `{"a":"x","b":1}`},
 		{name: "string", srcType: schema.Type{Name: "text"}, spType: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, in: "eh", e: "eh"},
 		{name: "string bool", srcType: schema.Type{Name: "bool"}, spType: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, in: true, e: "true"},
 		{name: "string byte", srcType: schema.Type{Name: "bytea"}, spType: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, in: []byte("abc"), e: "abc"},
@@ -423,11 +431,11 @@ func TestConvertSqlRow_MultiCol(t *testing.T) {
 		}, {
 			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
 			args:  []driver.Value{"public", "test"},
-			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale"},
+			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "is_generated", "generation_expression"},
 			rows: [][]driver.Value{
-				{"a", "text", nil, "NO", nil, nil, nil, nil},
-				{"b", "double precision", nil, "YES", nil, nil, 53, nil},
-				{"c", "bigint", nil, "YES", nil, nil, 64, 0}},
+				{"a", "text", nil, "NO", nil, nil, nil, nil, "NEVER", nil},
+				{"b", "double precision", nil, "YES", nil, nil, 53, nil, "NEVER", nil},
+				{"c", "bigint", nil, "YES", nil, nil, 64, 0, "NEVER", nil}},
 		},
 		{
 			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
@@ -453,12 +461,18 @@ func TestConvertSqlRow_MultiCol(t *testing.T) {
 			query: "SELECT table_schema, table_name FROM information_schema.tables where table_type = 'BASE TABLE'",
 			cols:  []string{"table_schema", "table_name"},
 			rows:  [][]driver.Value{{"public", "test"}},
+		}, {
+			query: "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY",
+			exec:  true,
 		}, {
 			query: `SELECT [*] FROM "public"."test"`, // query is a regexp!
 			cols:  []string{"a", "b", "c"},
 			rows: [][]driver.Value{
 				{"cat", 42.3, nil},
 				{"dog", nil, 22}},
+		}, {
+			query: "COMMIT",
+			exec:  true,
 		},
 	}
 	db := mkMockDB(t, ms)
@@ -471,7 +485,7 @@ func TestConvertSqlRow_MultiCol(t *testing.T) {
 		func(table string, cols []string, vals []interface{}) {
 			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
 		})
-	ProcessSQLData(conv, db)
+	ProcessSQLData(conv, db, nil, 1, 0)
 	assert.Equal(t, []spannerData{
 		{table: "test", cols: []string{"a", "b", "synth_id"}, vals: []interface{}{"cat", float64(42.3), int64(0)}},
 		{table: "test", cols: []string{"a", "c", "synth_id"}, vals: []interface{}{"dog", int64(22), int64(-9223372036854775808)}}},
@@ -479,6 +493,76 @@ func TestConvertSqlRow_MultiCol(t *testing.T) {
 	assert.Equal(t, int64(0), conv.Unexpecteds())
 }
 
+func TestProcessSQLData_Generated(t *testing.T) {
+	// Generated columns are converted to Spanner generated columns,
+	// which aren't read or written, unless their expression can't be
+	// translated.
+	ms := []mockSpec{
+		{
+			query: "SELECT table_schema, table_name FROM information_schema.tables where table_type = 'BASE TABLE'",
+			cols:  []string{"table_schema", "table_name"},
+			rows:  [][]driver.Value{{"public", "test"}},
+		}, {
+			query: "SELECT (.+) FROM information_schema.COLUMNS (.+)",
+			args:  []driver.Value{"public", "test"},
+			cols:  []string{"column_name", "data_type", "data_type", "is_nullable", "column_default", "character_maximum_length", "numeric_precision", "numeric_scale", "is_generated", "generation_expression"},
+			rows: [][]driver.Value{
+				{"a", "bigint", nil, "NO", nil, nil, 64, 0, "NEVER", nil},
+				{"b", "bigint", nil, "YES", nil, nil, 64, 0, "NEVER", nil},
+				{"c", "bigint", nil, "YES", nil, nil, 64, 0, "ALWAYS", "(b * 2)"},
+				{"d", "text", nil, "YES", nil, nil, nil, nil, "ALWAYS", "md5((b)::text)"}},
+		}, {
+			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
+			args:  []driver.Value{"public", "test"},
+			cols:  []string{"column_name", "constraint_type"},
+			rows:  [][]driver.Value{{"a", "PRIMARY KEY"}},
+		}, {
+			query: "SELECT (.+) FROM PG_CLASS (.+) JOIN PG_NAMESPACE (.+) JOIN PG_CONSTRAINT (.+)",
+			args:  []driver.Value{"public", "test"},
+			cols:  []string{"TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME", "REF_COLUMN_NAME", "CONSTRAINT_NAME"},
+		}, {
+			query: "SELECT (.+) FROM pg_index (.+)",
+			args:  []driver.Value{"public", "test"},
+			cols:  []string{"index_name", "column_name", "column_position", "is_unique", "order"},
+		}, {
+			query: "SELECT table_schema, table_name FROM information_schema.tables where table_type = 'BASE TABLE'",
+			cols:  []string{"table_schema", "table_name"},
+			rows:  [][]driver.Value{{"public", "test"}},
+		}, {
+			query: "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY",
+			exec:  true,
+		}, {
+			query: `SELECT "a", "b", "d" FROM "public"."test" ORDER BY "a"`,
+			cols:  []string{"a", "b", "d"},
+			rows:  [][]driver.Value{{1, 2, "c81e728d9d4c2f636f067f89cc14862c"}},
+		}, {
+			query: "COMMIT",
+			exec:  true,
+		},
+	}
+	db := mkMockDB(t, ms)
+	conv := internal.MakeConv()
+	err := ProcessInfoSchema(conv, db)
+	assert.Nil(t, err)
+	c := conv.SrcSchema["test"].ColDefs["c"]
+	assert.True(t, c.Ignored.Generated)
+	assert.Equal(t, "(b * 2)", c.Generated)
+	assert.NotNil(t, conv.SpSchema["test"].ColDefs["c"].Generated)
+	assert.Nil(t, conv.SpSchema["test"].ColDefs["d"].Generated)
+	assert.Contains(t, conv.Issues["test"]["d"], internal.GeneratedColumn)
+	conv.SetDataMode()
+	var rows []spannerData
+	conv.SetDataSink(
+		func(table string, cols []string, vals []interface{}) {
+			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
+		})
+	ProcessSQLData(conv, db, nil, 1, 0)
+	assert.Equal(t, []spannerData{
+		{table: "test", cols: []string{"a", "b", "d"}, vals: []interface{}{int64(1), int64(2), "c81e728d9d4c2f636f067f89cc14862c"}}},
+		rows)
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+}
+
 func TestSetRowStats(t *testing.T) {
 	ms := []mockSpec{
 		{
@@ -512,7 +596,9 @@ func mkMockDB(t *testing.T, ms []mockSpec) *sql.DB {
 		for _, r := range m.rows {
 			rows.AddRow(r...)
 		}
-		if len(m.args) > 0 {
+		if m.exec {
+			mock.ExpectExec(m.query).WillReturnResult(sqlmock.NewResult(0, 0))
+		} else if len(m.args) > 0 {
 			mock.ExpectQuery(m.query).WithArgs(m.args...).WillReturnRows(rows)
 		} else {
 			mock.ExpectQuery(m.query).WillReturnRows(rows)
@@ -0,0 +1,473 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+)
+
+// This file implements reading of pg_dump's custom (pg_dump -Fc) and
+// directory (pg_dump -Fd) archive formats. Rather than processing
+// archives directly, we convert them into the equivalent plain-text
+// SQL (the same text that 'pg_restore -f -' would produce, less
+// comments) and feed that to the regular pg_dump processing.
+//
+// The archive format is defined by pg_backup_archiver.c and
+// pg_backup_custom.c/pg_backup_directory.c in the PostgreSQL sources.
+// An archive starts with a header and a table of contents (TOC) with
+// an entry for each dumped object. For the custom format, table data
+// follows the TOC as a sequence of data blocks. For the directory
+// format, the header and TOC are stored in the file toc.dat and table
+// data is stored in a separate file for each table.
+
+const (
+	archiveMagic  = "PGDMP"
+	archCustom    = 1 // archCustom in pg_backup.h.
+	archDirectory = 5 // archDirectory in pg_backup.h.
+
+	// Values of the offset flag in custom-format TOC entries.
+	offsetNoData = 3 // K_OFFSET_NO_DATA in pg_backup_archiver.h.
+
+	// Custom-format data block types.
+	blkData  = 1 // BLK_DATA in pg_backup_custom.c.
+	blkBlobs = 3 // BLK_BLOBS in pg_backup_custom.c.
+
+	// Compression algorithms.
+	compressionNone = 0
+	compressionGzip = 1
+)
+
+// Archive format versions (see K_VERS_* in pg_backup_archiver.h).
+// We support archives written by pg_dump from PostgreSQL 9.0 onwards.
+var (
+	vers1_12 = archiveVersion(1, 12, 0) // Minimum supported version.
+	vers1_14 = archiveVersion(1, 14, 0) // Adds table access method.
+	vers1_15 = archiveVersion(1, 15, 0) // Adds compression algorithm.
+	vers1_16 = archiveVersion(1, 16, 0) // Adds relkind.
+	versMax  = archiveVersion(1, 16, 255)
+)
+
+func archiveVersion(major, minor, rev byte) int {
+	return (int(major)*256+int(minor))*256 + int(rev)
+}
+
+// archive is a pg_dump archive: its header fields and TOC.
+type archive struct {
+	format      byte
+	compression byte
+	toc         []tocEntry
+	r           *archiveReader // Remaining input (custom format).
+	dir         string         // Archive directory (directory format).
+}
+
+// tocEntry is an entry from an archive's TOC. We only keep the fields
+// we need.
+type tocEntry struct {
+	dumpID    int
+	hadDumper bool   // Whether entry has data.
+	defn      string // SQL statements to create the object.
+	copyStmt  string // COPY-FROM statement for table data.
+	noData    bool   // Custom format: data wasn't dumped.
+	filename  string // Directory format: data file name.
+}
+
+// isArchive reports whether r contains a pg_dump archive (rather than
+// plain-text SQL).
+func isArchive(r *internal.Reader) bool {
+	b, err := r.Peek(len(archiveMagic))
+	return err == nil && string(b) == archiveMagic
+}
+
+// readArchive reads the header and TOC of the archive in r. For the
+// custom format, the table data remains to be read from r.
+func readArchive(r *bufio.Reader) (*archive, error) {
+	ar := &archiveReader{r: r}
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != archiveMagic {
+		return nil, fmt.Errorf("not a pg_dump archive")
+	}
+	major, minor, rev := ar.readByte(), ar.readByte(), ar.readByte()
+	version := archiveVersion(major, minor, rev)
+	if ar.err == nil && (version < vers1_12 || version > versMax) {
+		return nil, fmt.Errorf("unsupported archive version %d.%d-%d", major, minor, rev)
+	}
+	ar.intSize = int(ar.readByte())
+	ar.offSize = int(ar.readByte())
+	if ar.err == nil && (ar.intSize > 8 || ar.offSize > 8) {
+		return nil, fmt.Errorf("unsupported integer size %d or offset size %d", ar.intSize, ar.offSize)
+	}
+	a := &archive{r: ar, format: ar.readByte()}
+	if ar.err == nil && a.format != archCustom && a.format != archDirectory {
+		return nil, fmt.Errorf("unsupported archive format %d: only custom (-Fc) and directory (-Fd) archives are supported", a.format)
+	}
+	if version >= vers1_15 {
+		a.compression = ar.readByte()
+	} else if level := ar.readInt(); level != 0 {
+		a.compression = compressionGzip
+	}
+	if ar.err == nil && a.compression != compressionNone && a.compression != compressionGzip {
+		return nil, fmt.Errorf("unsupported compression algorithm %d: only gzip compression is supported", a.compression)
+	}
+	for i := 0; i < 7; i++ {
+		ar.readInt() // Creation date.
+	}
+	ar.readStr() // Database name.
+	ar.readStr() // Server version.
+	ar.readStr() // pg_dump version.
+	n := ar.readInt()
+	for i := 0; i < n && ar.err == nil; i++ {
+		a.toc = append(a.toc, a.readTocEntry(version))
+	}
+	if ar.err != nil {
+		return nil, fmt.Errorf("can't read archive header: %w", ar.err)
+	}
+	return a, nil
+}
+
+func (a *archive) readTocEntry(version int) tocEntry {
+	ar := a.r
+	var e tocEntry
+	e.dumpID = ar.readInt()
+	e.hadDumper = ar.readInt() != 0
+	ar.readStr() // Table OID.
+	ar.readStr() // OID.
+	ar.readStr() // Tag.
+	ar.readStr() // Description (object type).
+	ar.readInt() // Section.
+	e.defn, _ = ar.readStr()
+	ar.readStr() // DROP statement.
+	e.copyStmt, _ = ar.readStr()
+	ar.readStr() // Namespace.
+	ar.readStr() // Tablespace.
+	if version >= vers1_14 {
+		ar.readStr() // Table access method.
+	}
+	if version >= vers1_16 {
+		ar.readInt() // Relkind.
+	}
+	ar.readStr() // Owner.
+	ar.readStr() // WITH OIDS.
+	// Dependencies, terminated by a NULL string.
+	for {
+		if _, ok := ar.readStr(); !ok {
+			break
+		}
+	}
+	switch a.format {
+	case archCustom:
+		e.noData = ar.readOffset() == offsetNoData
+	case archDirectory:
+		e.filename, _ = ar.readStr()
+	}
+	return e
+}
+
+// hasData reports whether table data was dumped for e.
+func (a *archive) hasData(e tocEntry) bool {
+	if !e.hadDumper {
+		return false
+	}
+	if a.format == archDirectory {
+		return e.filename != ""
+	}
+	return !e.noData
+}
+
+// sqlReader returns an io.Reader for the archive's contents as plain-text
+// SQL. For the custom format, blocks of table data are read
+// sequentially, and so must appear in TOC order (which is the order
+// pg_dump writes them in).
+func (a *archive) sqlReader() *sqlReader {
+	return &sqlReader{a: a}
+}
+
+type sqlReader struct {
+	a      *archive
+	next   int       // Index of next TOC entry.
+	cur    io.Reader // Text for current TOC entry.
+	closer io.Closer // Closer for current data file (directory format).
+	err    error
+}
+
+func (s *sqlReader) Read(p []byte) (int, error) {
+	for s.err == nil {
+		if s.cur != nil {
+			n, err := s.cur.Read(p)
+			if err == io.EOF {
+				err = s.endEntry()
+				if n == 0 && err == nil {
+					continue
+				}
+			}
+			s.err = err
+			return n, err
+		}
+		if s.next == len(s.a.toc) {
+			s.err = io.EOF
+			break
+		}
+		e := s.a.toc[s.next]
+		s.next++
+		s.err = s.startEntry(e)
+	}
+	return 0, s.err
+}
+
+// startEntry sets up s.cur to read the SQL for TOC entry e: its
+// definition or, for table data, a COPY-FROM block.
+func (s *sqlReader) startEntry(e tocEntry) error {
+	var l []io.Reader
+	if e.defn != "" {
+		l = append(l, strings.NewReader(e.defn+"\n"))
+	}
+	if s.a.hasData(e) {
+		if e.copyStmt == "" {
+			// Large objects (or other data we don't handle).
+			if s.a.format == archCustom {
+				if err := s.a.skipBlock(e); err != nil {
+					return err
+				}
+			}
+		} else {
+			d, err := s.a.dataReader(e)
+			if err != nil {
+				return err
+			}
+			if c, ok := d.(io.Closer); ok {
+				s.closer = c
+			}
+			l = append(l, strings.NewReader(e.copyStmt), d, strings.NewReader("\\.\n\n"))
+		}
+	}
+	s.cur = io.MultiReader(l...)
+	return nil
+}
+
+func (s *sqlReader) endEntry() error {
+	s.cur = nil
+	if s.closer != nil {
+		err := s.closer.Close()
+		s.closer = nil
+		return err
+	}
+	return nil
+}
+
+// dataReader returns a reader for the table data (in COPY-FROM
+// format) of TOC entry e.
+func (a *archive) dataReader(e tocEntry) (io.Reader, error) {
+	if a.format == archDirectory {
+		return a.openDataFile(e.filename)
+	}
+	blkType, id := a.r.readByte(), a.r.readInt()
+	if a.r.err != nil {
+		return nil, fmt.Errorf("can't read data block: %w", a.r.err)
+	}
+	if blkType != blkData || id != e.dumpID {
+		return nil, fmt.Errorf("found data block for entry %d, expected entry %d (data blocks must be in TOC order)", id, e.dumpID)
+	}
+	chunks := &chunkReader{ar: a.r}
+	var r io.Reader = chunks
+	if a.compression == compressionGzip {
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("can't read compressed data for entry %d: %w", e.dumpID, err)
+		}
+		r = zr
+	}
+	return &blockReader{r: r, chunks: chunks}, nil
+}
+
+// skipBlock skips the next custom-format data block, which must be
+// the data for TOC entry e.
+func (a *archive) skipBlock(e tocEntry) error {
+	blkType, id := a.r.readByte(), a.r.readInt()
+	if a.r.err == nil && id != e.dumpID {
+		return fmt.Errorf("found data block for entry %d, expected entry %d (data blocks must be in TOC order)", id, e.dumpID)
+	}
+	if blkType == blkBlobs {
+		// A sequence of large objects (OID and data), terminated by
+		// OID 0.
+		for oid := a.r.readInt(); oid != 0 && a.r.err == nil; oid = a.r.readInt() {
+			io.Copy(ioutil.Discard, &chunkReader{ar: a.r})
+		}
+	} else {
+		io.Copy(ioutil.Discard, &chunkReader{ar: a.r})
+	}
+	if a.r.err != nil {
+		return fmt.Errorf("can't read data block: %w", a.r.err)
+	}
+	return nil
+}
+
+// openDataFile opens a directory-format data file, which may have
+// been compressed (in which case pg_dump adds a .gz suffix).
+func (a *archive) openDataFile(name string) (io.Reader, error) {
+	path := filepath.Join(a.dir, name)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		f, err = os.Open(path + ".gz")
+		if err != nil {
+			return nil, fmt.Errorf("can't open data file: %w", err)
+		}
+		zr, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("can't read data file %s.gz: %w", path, err)
+		}
+		return &fileReader{Reader: zr, f: f}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't open data file: %w", err)
+	}
+	return &fileReader{Reader: bufio.NewReader(f), f: f}, nil
+}
+
+// fileReader reads a directory-format data file, closing the file
+// when done.
+type fileReader struct {
+	io.Reader
+	f *os.File
+}
+
+func (r *fileReader) Close() error {
+	return r.f.Close()
+}
+
+// blockReader reads the (possibly decompressed) contents of a
+// custom-format data block. At EOF, blockReader makes sure that all
+// chunks of the block have been consumed, so that the next block can
+// be read.
+type blockReader struct {
+	r      io.Reader // Contents of block.
+	chunks io.Reader // Underlying chunks.
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		if _, err := io.Copy(ioutil.Discard, b.chunks); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+// chunkReader reads the data of a custom-format data block: a sequence
+// of chunks (a length followed by data) terminated by a zero length.
+type chunkReader struct {
+	ar        *archiveReader
+	remaining int
+	done      bool
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 && !c.done {
+		n := c.ar.readInt()
+		if c.ar.err != nil {
+			return 0, c.ar.err
+		}
+		if n < 0 {
+			return 0, fmt.Errorf("bad chunk length %d", n)
+		}
+		c.remaining = n
+		c.done = n == 0
+	}
+	if c.done {
+		return 0, io.EOF
+	}
+	if len(p) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.ar.r.Read(p)
+	c.remaining -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// archiveReader reads the primitive types used in pg_dump archives.
+// Errors are sticky: after an error, reads return zero values and the
+// error is available in err.
+type archiveReader struct {
+	r       *bufio.Reader
+	intSize int
+	offSize int
+	err     error
+}
+
+func (ar *archiveReader) readByte() byte {
+	if ar.err != nil {
+		return 0
+	}
+	b, err := ar.r.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	ar.err = err
+	return b
+}
+
+// readInt reads an integer: a sign byte followed by intSize bytes of
+// magnitude (least significant byte first).
+func (ar *archiveReader) readInt() int {
+	sign := ar.readByte()
+	var v uint64
+	for i := 0; i < ar.intSize; i++ {
+		v |= uint64(ar.readByte()) << (8 * uint(i))
+	}
+	if sign != 0 {
+		return -int(v)
+	}
+	return int(v)
+}
+
+// readStr reads a string: a length followed by the string's bytes. A
+// negative length represents a NULL string, for which readStr returns
+// false.
+func (ar *archiveReader) readStr() (string, bool) {
+	n := ar.readInt()
+	if n < 0 || ar.err != nil {
+		return "", false
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(ar.r, b); err != nil {
+		ar.err = err
+		return "", false
+	}
+	return string(b), true
+}
+
+// readOffset reads a file offset: a flag byte followed by offSize
+// bytes of offset (least significant byte first). We only need the
+// flag.
+func (ar *archiveReader) readOffset() byte {
+	flag := ar.readByte()
+	for i := 0; i < ar.offSize; i++ {
+		ar.readByte()
+	}
+	return flag
+}
@@ -0,0 +1,287 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+)
+
+// testEntry describes a TOC entry for building test archives.
+type testEntry struct {
+	desc     string
+	defn     string
+	copyStmt string
+	data     string // Table data (for TABLE DATA and BLOBS entries).
+}
+
+var testEntries = []testEntry{
+	{desc: "ENCODING", defn: "SET client_encoding = 'UTF8';\n"},
+	{desc: "TABLE", defn: "CREATE TABLE public.t (\n    a bigint NOT NULL,\n    b text\n);\n"},
+	{desc: "TABLE DATA", copyStmt: "COPY public.t (a, b) FROM stdin;\n", data: "1\tone\n2\t\\N\n"},
+	{desc: "BLOBS", data: "large object"},
+	{desc: "CONSTRAINT", defn: "ALTER TABLE ONLY public.t\n    ADD CONSTRAINT t_pkey PRIMARY KEY (a);\n"},
+}
+
+// expectedSQL is the plain-text SQL for testEntries.
+const expectedSQL = "SET client_encoding = 'UTF8';\n\n" +
+	"CREATE TABLE public.t (\n    a bigint NOT NULL,\n    b text\n);\n\n" +
+	"COPY public.t (a, b) FROM stdin;\n1\tone\n2\t\\N\n\\.\n\n" +
+	"ALTER TABLE ONLY public.t\n    ADD CONSTRAINT t_pkey PRIMARY KEY (a);\n\n"
+
+func TestReadArchive_Custom(t *testing.T) {
+	for _, version := range []int{archiveVersion(1, 12, 0), archiveVersion(1, 14, 0), archiveVersion(1, 15, 0), archiveVersion(1, 16, 0)} {
+		for _, compression := range []byte{compressionNone, compressionGzip} {
+			b := writeTestArchive(version, archCustom, compression, testEntries)
+			a, err := readArchive(bufio.NewReader(bytes.NewReader(b)))
+			assert.Nil(t, err, version)
+			assert.Equal(t, len(testEntries), len(a.toc))
+			s, err := ioutil.ReadAll(a.sqlReader())
+			assert.Nil(t, err, version)
+			assert.Equal(t, expectedSQL, string(s), version)
+		}
+	}
+}
+
+func TestReadArchive_Directory(t *testing.T) {
+	for _, compression := range []byte{compressionNone, compressionGzip} {
+		dir, err := ioutil.TempDir("", "pgarchive_test")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		writeTestArchiveDir(t, dir, compression, testEntries)
+		f, err := os.Open(filepath.Join(dir, "toc.dat"))
+		assert.Nil(t, err)
+		defer f.Close()
+		a, err := readArchive(bufio.NewReader(f))
+		assert.Nil(t, err)
+		a.dir = dir
+		s, err := ioutil.ReadAll(a.sqlReader())
+		assert.Nil(t, err)
+		assert.Equal(t, expectedSQL, string(s))
+	}
+}
+
+func TestReadArchive_Errors(t *testing.T) {
+	b := writeTestArchive(archiveVersion(1, 14, 0), archCustom, compressionNone, testEntries)
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{"bad magic", []byte("PGDMQ")},
+		{"old version", append([]byte("PGDMP\x01\x0b\x00"), b[8:]...)},
+		{"tar format", append(append([]byte{}, b[:10]...), append([]byte{3}, b[11:]...)...)},
+		{"truncated", b[:100]},
+	}
+	for _, tc := range tests {
+		_, err := readArchive(bufio.NewReader(bytes.NewReader(tc.b)))
+		assert.NotNil(t, err, tc.name)
+	}
+	// Truncated data.
+	a, err := readArchive(bufio.NewReader(bytes.NewReader(b[:len(b)-10])))
+	assert.Nil(t, err)
+	_, err = ioutil.ReadAll(a.sqlReader())
+	assert.NotNil(t, err)
+}
+
+func TestProcessPgDump_Archive(t *testing.T) {
+	convPlain, rowsPlain := runProcessPgDump(expectedSQL)
+	b := writeTestArchive(archiveVersion(1, 14, 0), archCustom, compressionGzip, testEntries)
+	conv, rows := runProcessPgDump(string(b))
+	noIssues(conv, t, "Archive")
+	assert.Equal(t, convPlain.SpSchema, conv.SpSchema)
+	assert.Equal(t, rowsPlain, rows)
+	assert.Equal(t, 2, len(rows))
+
+	dir, err := ioutil.TempDir("", "pgarchive_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	writeTestArchiveDir(t, dir, compressionNone, testEntries)
+	conv = internal.MakeConv()
+	conv.SetLocation(time.UTC)
+	conv.SetSchemaMode()
+	assert.Nil(t, ProcessPgDumpDir(conv, dir))
+	assert.Equal(t, convPlain.SpSchema, conv.SpSchema)
+}
+
+// writeTestArchive returns a pg_dump archive containing entries. For
+// the directory format, it returns the contents of toc.dat.
+func writeTestArchive(version int, format, compression byte, entries []testEntry) []byte {
+	w := &testArchiveWriter{}
+	w.WriteString(archiveMagic)
+	w.WriteByte(byte(version >> 16))
+	w.WriteByte(byte(version >> 8))
+	w.WriteByte(byte(version))
+	w.WriteByte(4) // Integer size.
+	w.WriteByte(8) // Offset size.
+	w.WriteByte(format)
+	if version >= vers1_15 {
+		w.WriteByte(compression)
+	} else if compression == compressionGzip {
+		w.writeInt(-1) // Default compression level.
+	} else {
+		w.writeInt(0)
+	}
+	for _, v := range []int{0, 0, 12, 1, 0, 121, 0} {
+		w.writeInt(v) // Creation date.
+	}
+	w.writeStr("mydb")
+	w.writeStr("13.2")
+	w.writeStr("13.2")
+	w.writeInt(len(entries))
+	for i, e := range entries {
+		w.writeInt(i + 1) // Dump ID.
+		w.writeBool(e.data != "")
+		w.writeStr("0")
+		w.writeStr("0")
+		w.writeStr("t")
+		w.writeStr(e.desc)
+		w.writeInt(0) // Section.
+		w.writeStr(e.defn)
+		w.writeStr("") // DROP statement.
+		w.writeStr(e.copyStmt)
+		w.writeStr("public")
+		w.writeStr("")
+		if version >= vers1_14 {
+			w.writeStr("heap")
+		}
+		if version >= vers1_16 {
+			w.writeInt('r')
+		}
+		w.writeStr("postgres")
+		w.writeStr("false")
+		w.writeStr("1") // Dependencies.
+		w.writeInt(-1)
+		switch format {
+		case archCustom:
+			if e.data == "" {
+				w.WriteByte(offsetNoData)
+			} else {
+				w.WriteByte(1) // Offset not set.
+			}
+			w.Write(make([]byte, 8))
+		case archDirectory:
+			if e.data == "" {
+				w.writeInt(-1)
+			} else {
+				w.writeStr(dataFileName(i + 1))
+			}
+		}
+	}
+	if format != archCustom {
+		return w.Bytes()
+	}
+	for i, e := range entries {
+		if e.data == "" {
+			continue
+		}
+		data := []byte(e.data)
+		if compression == compressionGzip {
+			var b bytes.Buffer
+			zw := zlib.NewWriter(&b)
+			zw.Write(data)
+			zw.Close()
+			data = b.Bytes()
+		}
+		if e.desc == "BLOBS" {
+			w.WriteByte(blkBlobs)
+			w.writeInt(i + 1)
+			w.writeInt(16384) // OID.
+			w.writeChunks(data)
+			w.writeInt(0)
+		} else {
+			w.WriteByte(blkData)
+			w.writeInt(i + 1)
+			w.writeChunks(data)
+		}
+	}
+	return w.Bytes()
+}
+
+// writeTestArchiveDir writes a directory format archive containing
+// entries to dir.
+func writeTestArchiveDir(t *testing.T, dir string, compression byte, entries []testEntry) {
+	b := writeTestArchive(archiveVersion(1, 14, 0), archDirectory, compression, entries)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "toc.dat"), b, 0644))
+	for i, e := range entries {
+		if e.copyStmt == "" {
+			continue
+		}
+		name := filepath.Join(dir, dataFileName(i+1))
+		data := []byte(e.data)
+		if compression == compressionGzip {
+			var b bytes.Buffer
+			zw := gzip.NewWriter(&b)
+			zw.Write(data)
+			zw.Close()
+			name, data = name+".gz", b.Bytes()
+		}
+		assert.Nil(t, ioutil.WriteFile(name, data, 0644))
+	}
+}
+
+func dataFileName(id int) string {
+	return string(rune('0'+id)) + ".dat"
+}
+
+type testArchiveWriter struct {
+	bytes.Buffer
+}
+
+func (w *testArchiveWriter) writeInt(i int) {
+	if i < 0 {
+		w.WriteByte(1)
+		i = -i
+	} else {
+		w.WriteByte(0)
+	}
+	for j := 0; j < 4; j++ {
+		w.WriteByte(byte(i >> (8 * uint(j))))
+	}
+}
+
+func (w *testArchiveWriter) writeBool(b bool) {
+	if b {
+		w.writeInt(1)
+	} else {
+		w.writeInt(0)
+	}
+}
+
+func (w *testArchiveWriter) writeStr(s string) {
+	w.writeInt(len(s))
+	w.WriteString(s)
+}
+
+// writeChunks writes data as two chunks (to exercise handling of
+// multiple chunks) followed by the end-of-data marker.
+func (w *testArchiveWriter) writeChunks(data []byte) {
+	n := len(data) / 2
+	for _, c := range [][]byte{data[:n], data[n:]} {
+		w.writeInt(len(c))
+		w.Write(c)
+	}
+	w.writeInt(0)
+}
@@ -15,8 +15,13 @@
 package postgres
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -47,15 +52,62 @@ const (
 // In schema mode, ProcessPgDump incrementally builds a schema (updating conv).
 // In data mode, ProcessPgDump uses this schema to convert PostgreSQL data
 // and writes it to Spanner, using the data sink specified in conv.
+//
+// ProcessPgDump handles pg_dump's plain-text output as well as custom
+// format archives (pg_dump -Fc). For directory format archives (pg_dump
+// -Fd), use ProcessPgDumpDir.
 func ProcessPgDump(conv *internal.Conv, r *internal.Reader) error {
+	if isArchive(r) {
+		a, err := readArchive(bufio.NewReader(r))
+		if err != nil {
+			return fmt.Errorf("can't read pg_dump archive: %w", err)
+		}
+		return processArchive(conv, a)
+	}
+	return processPlainDump(conv, r)
+}
+
+// ProcessPgDumpDir is like ProcessPgDump, but reads a directory format
+// archive (pg_dump -Fd) from directory dir.
+func ProcessPgDumpDir(conv *internal.Conv, dir string) error {
+	f, err := os.Open(filepath.Join(dir, "toc.dat"))
+	if err != nil {
+		return fmt.Errorf("can't open pg_dump directory archive: %w", err)
+	}
+	defer f.Close()
+	a, err := readArchive(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("can't read pg_dump archive: %w", err)
+	}
+	if a.format != archDirectory {
+		return fmt.Errorf("%s is not a directory format archive", filepath.Join(dir, "toc.dat"))
+	}
+	a.dir = dir
+	return processArchive(conv, a)
+}
+
+// processArchive processes a pg_dump archive by converting it to
+// plain-text SQL.
+func processArchive(conv *internal.Conv, a *archive) error {
+	s := a.sqlReader()
+	if err := processPlainDump(conv, internal.NewReader(bufio.NewReader(s), nil)); err != nil {
+		return err
+	}
+	if s.err != io.EOF {
+		return fmt.Errorf("can't read pg_dump archive: %w", s.err)
+	}
+	return nil
+}
+
+func processPlainDump(conv *internal.Conv, r *internal.Reader) error {
 	for {
 		startLine := r.LineNumber
 		startOffset := r.Offset
-		b, stmts, err := readAndParseChunk(conv, r)
+		b, stmts, c, err := readAndParseChunk(conv, r)
 		if err != nil {
 			return err
 		}
-		ci := processStatements(conv, stmts)
+		ci := processStatements(conv, stmts, c)
 		internal.VerbosePrintf("Parsed SQL command at line=%d/fpos=%d: %d stmts (%d lines, %d bytes) ci=%v\n", startLine, startOffset, len(stmts), r.LineNumber-startLine, len(b), ci != nil)
 		if ci != nil {
 			switch ci.stmt {
@@ -83,9 +135,19 @@ func ProcessPgDump(conv *internal.Conv, r *internal.Reader) error {
 	return nil
 }
 
+// chunk is a chunk of pg_dump data, as parsed: its SQL text (without
+// the clauses removed by stripGenerated), which locations in the AST
+// refer to, and the expressions of its generated columns, keyed by the
+// location of their column definitions.
+type chunk struct {
+	text      string
+	generated map[int]string
+}
+
 // readAndParseChunk parses a chunk of pg_dump data, returning the bytes read,
-// the parsed AST (nil if nothing read), and whether we've hit end-of-file.
-func readAndParseChunk(conv *internal.Conv, r *internal.Reader) ([]byte, []nodes.Node, error) {
+// the parsed AST (nil if nothing read), the parsed chunk, and whether
+// we've hit end-of-file.
+func readAndParseChunk(conv *internal.Conv, r *internal.Reader) ([]byte, []nodes.Node, chunk, error) {
 	var l [][]byte
 	for {
 		b := r.ReadLine()
@@ -102,9 +164,10 @@ func readAndParseChunk(conv *internal.Conv, r *internal.Reader) ([]byte, []nodes
 			for i := range l {
 				n += copy(s[n:], l[i])
 			}
-			tree, err := pg_query.Parse(string(s))
+			text, generated := stripGenerated(string(s))
+			tree, err := pg_query.Parse(text)
 			if err == nil {
-				return s, tree.Statements, nil
+				return s, tree.Statements, chunk{text: text, generated: generated}, nil
 			}
 			// Likely causes of failing to parse:
 			// a) complex statements with embedded semicolons e.g. 'CREATE FUNCTION'
@@ -114,11 +177,129 @@ func readAndParseChunk(conv *internal.Conv, r *internal.Reader) ([]byte, []nodes
 			conv.Stats.Reparsed++
 		}
 		if r.EOF {
-			return nil, nil, fmt.Errorf("Error parsing last %d line(s) of input", len(l))
+			return nil, nil, chunk{}, fmt.Errorf("Error parsing last %d line(s) of input", len(l))
 		}
 	}
 }
 
+// generatedRe matches the start of the GENERATED ALWAYS AS ( expr )
+// STORED clause of a generated column, and storedRe its end.
+var (
+	generatedRe = regexp.MustCompile(`^(?i)GENERATED\s+ALWAYS\s+AS\s*\(`)
+	storedRe    = regexp.MustCompile(`^(?i)\s*STORED\b`)
+	dollarRe    = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z_0-9]*)?\$`)
+)
+
+// stripGenerated removes the GENERATED ALWAYS AS ( expr ) STORED
+// clauses of generated columns from SQL text s, because our parser
+// follows the PostgreSQL 10 grammar, which predates generated columns.
+// It returns the remaining text, and the expressions of the generated
+// columns, keyed by the offset of their column definitions in the
+// remaining text (which the parser reports as ColumnDef.Location).
+func stripGenerated(s string) (string, map[int]string) {
+	if !strings.Contains(strings.ToUpper(s), "GENERATED") {
+		return s, nil
+	}
+	var b strings.Builder
+	generated := make(map[int]string)
+	depth := 0
+	colStart, newCol := 0, false // Offset in b of the current column definition.
+	for i := 0; i < len(s); {
+		j := i + 1
+		comment := false
+		switch c := s[i]; {
+		case c == '\'' || c == '"':
+			j = skipQuoted(s, i)
+		case strings.HasPrefix(s[i:], "--"):
+			comment = true
+			if j = strings.IndexByte(s[i:], '\n'); j < 0 {
+				j = len(s)
+			} else {
+				j += i
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			comment = true
+			if j = strings.Index(s[i+2:], "*/"); j < 0 {
+				j = len(s)
+			} else {
+				j += i + 4
+			}
+		case c == '$' && dollarRe.MatchString(s[i:]):
+			tag := dollarRe.FindString(s[i:])
+			if j = strings.Index(s[i+len(tag):], tag); j < 0 {
+				j = len(s)
+			} else {
+				j += i + 2*len(tag)
+			}
+		case c == '(':
+			depth++
+			newCol = depth == 1
+		case c == ')':
+			depth--
+		case c == ',' && depth == 1:
+			newCol = true
+		case depth == 1 && i > 0 && isSpace(s[i-1]) && generatedRe.MatchString(s[i:]):
+			start := i + len(generatedRe.FindString(s[i:])) - 1
+			end := skipParenthesized(s, start)
+			if m := storedRe.FindString(s[end:]); end > start && m != "" {
+				generated[colStart] = strings.TrimSpace(s[start+1 : end-1])
+				i = end + len(m)
+				continue
+			}
+		}
+		if newCol && !comment && !isSpace(s[i]) && s[i] != '(' && s[i] != ',' {
+			colStart, newCol = b.Len(), false
+		}
+		b.WriteString(s[i:j])
+		i = j
+	}
+	if len(generated) == 0 {
+		return s, nil
+	}
+	return b.String(), generated
+}
+
+// skipQuoted returns the offset in s after the string or identifier
+// that starts (with a quote) at offset i.
+func skipQuoted(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == s[i] {
+			if j+1 < len(s) && s[j+1] == s[i] {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(s)
+}
+
+// skipParenthesized returns the offset in s after the parenthesized
+// text that starts at offset i, or i if it's unterminated.
+func skipParenthesized(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); {
+		switch s[j] {
+		case '\'', '"':
+			j = skipQuoted(s, j)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return j + 1
+			}
+		}
+		j++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
 func processCopyBlock(conv *internal.Conv, srcTable string, srcCols []string, r *internal.Reader) {
 	internal.VerbosePrintf("Parsing COPY-FROM stdin block starting at line=%d/fpos=%d\n", r.LineNumber, r.Offset)
 	for {
@@ -155,14 +336,20 @@ func processCopyBlock(conv *internal.Conv, srcTable string, srcCols []string, r
 // statements, updating Conv with new schema information, and returning
 // copyOrInsert if a COPY-FROM or INSERT statement is encountered.
 // Note that the actual parsing/processing of COPY-FROM data blocks is
-// handled elsewhere (see process.go).
-func processStatements(conv *internal.Conv, statements []nodes.Node) *copyOrInsert {
+// handled elsewhere (see process.go). c is the chunk of pg_dump data
+// that statements were parsed from.
+func processStatements(conv *internal.Conv, statements []nodes.Node, c chunk) *copyOrInsert {
 	// Typically we'll have only one statement, but we handle the general case.
 	for i, node := range statements {
+		// Text of c up to the end of the statement.
+		text := c.text
 		switch n := node.(type) {
 		// Unwrap RawStatement.
 		case nodes.RawStmt:
 			node = n.Stmt
+			if end := n.StmtLocation + n.StmtLen; n.StmtLen > 0 && end <= len(text) {
+				text = text[:end]
+			}
 		}
 		switch n := node.(type) {
 		case nodes.AlterTableStmt:
@@ -177,7 +364,7 @@ func processStatements(conv *internal.Conv, statements []nodes.Node) *copyOrInse
 			return processCopyStmt(conv, n)
 		case nodes.CreateStmt:
 			if conv.SchemaMode() {
-				processCreateStmt(conv, n)
+				processCreateStmt(conv, n, c.generated)
 			}
 		case nodes.InsertStmt:
 			return processInsertStmt(conv, n)
@@ -189,6 +376,10 @@ func processStatements(conv *internal.Conv, statements []nodes.Node) *copyOrInse
 			if conv.SchemaMode() {
 				processIndexStmt(conv, n)
 			}
+		case nodes.ViewStmt:
+			if conv.SchemaMode() {
+				processViewStmt(conv, n, text)
+			}
 		default:
 			conv.SkipStatement(prNodes([]nodes.Node{node}))
 		}
@@ -238,6 +429,12 @@ func processAlterTableStmt(conv *internal.Conv, n nodes.AlterTableStmt) {
 					c := constraint{ct: nodes.CONSTR_NOTNULL, cols: []string{*a.Name}}
 					updateSchema(conv, table, []constraint{c}, "ALTER TABLE")
 					conv.SchemaStatement(prNodes([]nodes.Node{n, a}))
+				case a.Subtype == nodes.AT_ColumnDefault && a.Name != nil && a.Def != nil:
+					// pg_dump sets the defaults of serial columns with
+					// ALTER TABLE ... ALTER COLUMN ... SET DEFAULT.
+					c := constraint{ct: nodes.CONSTR_DEFAULT, cols: []string{*a.Name}, expr: printExpr(a.Def)}
+					updateSchema(conv, table, []constraint{c}, "ALTER TABLE")
+					conv.SchemaStatement(prNodes([]nodes.Node{n, a}))
 				case a.Subtype == nodes.AT_AddConstraint && a.Def != nil:
 					switch d := a.Def.(type) {
 					case nodes.Constraint:
@@ -264,7 +461,51 @@ func processAlterTableStmt(conv *internal.Conv, n nodes.AlterTableStmt) {
 	}
 }
 
-func processCreateStmt(conv *internal.Conv, n nodes.CreateStmt) {
+// viewQueryRe matches the start of a CREATE VIEW statement, from the
+// view name to the AS that starts the query, and viewCheckRe matches
+// the WITH CHECK OPTION clause at its end.
+var (
+	viewQueryRe = regexp.MustCompile(`^(?i)(?:"(?:[^"]|"")*"|[^\s.("]+)(?:\s*\.\s*(?:"(?:[^"]|"")*"|[^\s.("]+))*\s*(?:\([^)]*\)\s*)?(?:WITH\s*\([^)]*\)\s*)?AS\s`)
+	viewCheckRe = regexp.MustCompile(`(?i)\s+WITH\s+(?:CASCADED\s+|LOCAL\s+)?CHECK\s+OPTION$`)
+)
+
+// processViewStmt records the view defined by n. text is the SQL
+// text of the statement (and of the statements before it in its chunk):
+// we record the text of the view's query, which is easier to translate
+// to Spanner than its AST.
+func processViewStmt(conv *internal.Conv, n nodes.ViewStmt, text string) {
+	if n.View == nil {
+		logStmtError(conv, n, fmt.Errorf("view is nil"))
+		return
+	}
+	view, err := getTableName(conv, *n.View)
+	if err != nil {
+		logStmtError(conv, n, fmt.Errorf("can't get view name: %w", err))
+		return
+	}
+	if len(n.Aliases.Items) > 0 {
+		// pg_dump folds column names into the view's query, so this
+		// only happens for hand-written dumps.
+		conv.SkipStatement(prNodes([]nodes.Node{n}))
+		conv.Unexpected(fmt.Sprintf("Found view %s with a column list -- we do not currently handle these", view))
+		return
+	}
+	var query string
+	if loc := n.View.Location; loc >= 0 && loc < len(text) {
+		if m := viewQueryRe.FindString(text[loc:]); m != "" {
+			query = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(text[loc+len(m):]), ";"))
+			query = viewCheckRe.ReplaceAllString(query, "")
+		}
+	}
+	if query == "" {
+		logStmtError(conv, n, fmt.Errorf("can't find the query of view %s", view))
+		return
+	}
+	conv.SchemaStatement(prNodes([]nodes.Node{n}))
+	conv.SrcViews[view] = schema.View{Name: view, Query: query}
+}
+
+func processCreateStmt(conv *internal.Conv, n nodes.CreateStmt, generated map[int]string) {
 	var colNames []string
 	colDef := make(map[string]schema.Column)
 	if n.Relation == nil {
@@ -292,6 +533,10 @@ func processCreateStmt(conv *internal.Conv, n nodes.CreateStmt) {
 				logStmtError(conv, n, err)
 				return
 			}
+			if expr, ok := generated[i.Location]; ok {
+				col.Ignored.Generated = true
+				col.Generated = expr
+			}
 			colNames = append(colNames, name)
 			colDef[name] = col
 			constraints = append(constraints, cdConstraints...)
@@ -516,6 +761,7 @@ type constraint struct {
 	/* Fields used for FOREIGN KEY constraints: */
 	referCols  []string
 	referTable string
+	expr       string // Expression, for DEFAULT and CHECK constraints.
 }
 
 // extractConstraints traverses a list of nodes (expecting them to be
@@ -526,8 +772,15 @@ func extractConstraints(conv *internal.Conv, n nodes.Node, table string, l []nod
 		case nodes.Constraint:
 			var cols, referCols []string
 			var referTable string
-			var conName string
+			var conName, expr string
 			switch d.Contype {
+			case nodes.CONSTR_DEFAULT:
+				expr = printExpr(d.RawExpr)
+			case nodes.CONSTR_CHECK:
+				if d.Conname != nil {
+					conName = *d.Conname
+				}
+				expr = printExpr(d.RawExpr)
 			case nodes.CONSTR_FOREIGN:
 				t, err := getTableName(conv, *d.Pktable)
 				if err != nil {
@@ -571,7 +824,7 @@ func extractConstraints(conv *internal.Conv, n nodes.Node, table string, l []nod
 					cols = append(cols, k)
 				}
 			}
-			cs = append(cs, constraint{ct: d.Contype, cols: cols, name: conName, referCols: referCols, referTable: referTable})
+			cs = append(cs, constraint{ct: d.Contype, cols: cols, name: conName, referCols: referCols, referTable: referTable, expr: expr})
 		default:
 			conv.Unexpected(fmt.Sprintf("Processing %v statement: found %s node while processing constraints\n", reflect.TypeOf(n), reflect.TypeOf(d)))
 		}
@@ -615,6 +868,22 @@ func updateSchema(conv *internal.Conv, table string, cs []constraint, stmtType s
 			ct := conv.SrcSchema[table]
 			ct.ForeignKeys = append(ct.ForeignKeys, toForeignKeys(c)) // Append to previous foreign keys.
 			conv.SrcSchema[table] = ct
+		case nodes.CONSTR_DEFAULT:
+			ct := conv.SrcSchema[table]
+			for _, col := range c.cols {
+				cd := ct.ColDefs[col]
+				cd.Ignored.Default = true
+				cd.Default = c.expr
+				ct.ColDefs[col] = cd
+			}
+			conv.SrcSchema[table] = ct
+		case nodes.CONSTR_CHECK:
+			// Column and table constraints are both recorded as
+			// table constraints: their expressions refer to columns
+			// by name.
+			ct := conv.SrcSchema[table]
+			ct.CheckConstraints = append(ct.CheckConstraints, schema.CheckConstraint{Name: c.name, Expr: c.expr})
+			conv.SrcSchema[table] = ct
 		case nodes.CONSTR_UNIQUE:
 			// Convert unique column constraint in postgres to a corresponding unique index in Spanner since
 			// Spanner doesn't support unique constraints on columns.
@@ -641,13 +910,200 @@ func updateCols(ct nodes.ConstrType, colNames []string, colDef map[string]schema
 		switch ct {
 		case nodes.CONSTR_NOTNULL:
 			cd.NotNull = true
-		case nodes.CONSTR_DEFAULT:
-			cd.Ignored.Default = true
 		}
 		colDef[c] = cd
 	}
 }
 
+// notExpr is the BoolExprType of NOT expressions. pg_query_go's nodes
+// package only defines AND_EXPR and OR_EXPR, but the parser uses
+// PostgreSQL's value (NOT_EXPR, after them) for NOT.
+const notExpr = nodes.OR_EXPR + 1
+
+// printExpr returns the SQL text of expression n, for the expressions
+// that internal.ToSpannerDefault and internal.ToSpannerCheck can
+// translate: constants, casts, function calls such as now(), column
+// references, operators, AND, OR, NOT, IS [NOT] NULL and arrays.
+// Compound expressions are printed in parentheses, and column names
+// are always quoted. It returns "" for other expressions.
+func printExpr(n nodes.Node) string {
+	switch e := n.(type) {
+	case nodes.ColumnRef:
+		if len(e.Fields.Items) != 1 {
+			return ""
+		}
+		s, err := getString(e.Fields.Items[0])
+		if err != nil {
+			return ""
+		}
+		return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+	case nodes.A_Const:
+		switch v := e.Val.(type) {
+		case nodes.Integer:
+			return strconv.FormatInt(v.Ival, 10)
+		case nodes.Float:
+			return v.Str
+		case nodes.String:
+			return "'" + strings.Replace(v.Str, "'", "''", -1) + "'"
+		case nodes.Null:
+			return "NULL"
+		}
+	case nodes.TypeCast:
+		arg := printExpr(e.Arg)
+		if arg == "" || e.TypeName == nil {
+			return ""
+		}
+		var names []string
+		for _, x := range e.TypeName.Names.Items {
+			s, err := getString(x)
+			if err != nil {
+				return ""
+			}
+			names = append(names, s)
+		}
+		if names[len(names)-1] == "bool" && (arg == "'t'" || arg == "'f'") {
+			// The parser represents TRUE and FALSE as 't'::bool and
+			// 'f'::bool.
+			return map[string]string{"'t'": "TRUE", "'f'": "FALSE"}[arg]
+		}
+		return arg + "::" + strings.Join(names, ".") + strings.Repeat("[]", len(e.TypeName.ArrayBounds.Items))
+	case nodes.FuncCall:
+		var names, args []string
+		for _, x := range e.Funcname.Items {
+			s, err := getString(x)
+			if err != nil {
+				return ""
+			}
+			names = append(names, s)
+		}
+		for _, x := range e.Args.Items {
+			s := printExpr(x)
+			if s == "" {
+				return ""
+			}
+			args = append(args, s)
+		}
+		return strings.Join(names, ".") + "(" + strings.Join(args, ", ") + ")"
+	case nodes.A_Expr:
+		return printAExpr(e)
+	case nodes.BoolExpr:
+		args := printExprs(e.Args)
+		switch {
+		case args == nil:
+			return ""
+		case e.Boolop == nodes.AND_EXPR:
+			return "(" + strings.Join(args, " AND ") + ")"
+		case e.Boolop == nodes.OR_EXPR:
+			return "(" + strings.Join(args, " OR ") + ")"
+		case e.Boolop == notExpr && len(args) == 1:
+			return "(NOT " + args[0] + ")"
+		}
+	case nodes.NullTest:
+		arg := printExpr(e.Arg)
+		switch {
+		case arg == "":
+			return ""
+		case e.Nulltesttype == nodes.IS_NOT_NULL:
+			return "(" + arg + " IS NOT NULL)"
+		default:
+			return "(" + arg + " IS NULL)"
+		}
+	case nodes.A_ArrayExpr:
+		if elems := printExprs(e.Elements); elems != nil {
+			return "ARRAY[" + strings.Join(elems, ", ") + "]"
+		}
+	case nodes.SQLValueFunction:
+		switch e.Op {
+		case nodes.SVFOP_CURRENT_DATE:
+			return "CURRENT_DATE"
+		case nodes.SVFOP_CURRENT_TIMESTAMP, nodes.SVFOP_CURRENT_TIMESTAMP_N:
+			return "CURRENT_TIMESTAMP"
+		case nodes.SVFOP_LOCALTIMESTAMP, nodes.SVFOP_LOCALTIMESTAMP_N:
+			return "LOCALTIMESTAMP"
+		}
+	}
+	return ""
+}
+
+// printAExpr returns the SQL text of operator expression e (see
+// printExpr).
+func printAExpr(e nodes.A_Expr) string {
+	var op string
+	if len(e.Name.Items) > 0 {
+		// Operators can be qualified, as in OPERATOR(pg_catalog.=).
+		op, _ = getString(e.Name.Items[len(e.Name.Items)-1])
+	}
+	l := printExpr(e.Lexpr)
+	if op == "" || (l == "" && e.Lexpr != nil) {
+		return ""
+	}
+	switch e.Kind {
+	case nodes.AEXPR_OP:
+		r := printExpr(e.Rexpr)
+		switch {
+		case r == "":
+			return ""
+		case l == "":
+			// Prefix operators, such as unary minus.
+			return "(" + op + " " + r + ")"
+		default:
+			return "(" + l + " " + op + " " + r + ")"
+		}
+	case nodes.AEXPR_OP_ANY, nodes.AEXPR_OP_ALL:
+		r := printExpr(e.Rexpr)
+		if l == "" || r == "" {
+			return ""
+		}
+		q := "ANY"
+		if e.Kind == nodes.AEXPR_OP_ALL {
+			q = "ALL"
+		}
+		return "(" + l + " " + op + " " + q + " (" + r + "))"
+	case nodes.AEXPR_IN, nodes.AEXPR_BETWEEN, nodes.AEXPR_NOT_BETWEEN:
+		list, ok := e.Rexpr.(nodes.List)
+		if !ok || l == "" {
+			return ""
+		}
+		r := printExprs(list)
+		switch {
+		case r == nil:
+			return ""
+		case e.Kind == nodes.AEXPR_IN && op == "<>":
+			return "(" + l + " NOT IN (" + strings.Join(r, ", ") + "))"
+		case e.Kind == nodes.AEXPR_IN:
+			return "(" + l + " IN (" + strings.Join(r, ", ") + "))"
+		case len(r) != 2:
+			return ""
+		case e.Kind == nodes.AEXPR_NOT_BETWEEN:
+			return "(" + l + " NOT BETWEEN " + r[0] + " AND " + r[1] + ")"
+		default:
+			return "(" + l + " BETWEEN " + r[0] + " AND " + r[1] + ")"
+		}
+	case nodes.AEXPR_LIKE:
+		// The operator is ~~ for LIKE and !~~ for NOT LIKE.
+		r := printExpr(e.Rexpr)
+		if l == "" || r == "" {
+			return ""
+		}
+		return "(" + l + " " + op + " " + r + ")"
+	}
+	return ""
+}
+
+// printExprs returns the SQL text of the expressions in l (see
+// printExpr), or nil if any of them can't be printed.
+func printExprs(l nodes.List) []string {
+	var s []string
+	for _, x := range l.Items {
+		p := printExpr(x)
+		if p == "" {
+			return nil
+		}
+		s = append(s, p)
+	}
+	return s
+}
+
 // toSchemaKeys converts a string list of PostgreSQL primary keys to
 // schema primary keys.
 func toSchemaKeys(conv *internal.Conv, table string, s []string) (l []schema.Key) {
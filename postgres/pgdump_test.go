@@ -53,6 +53,8 @@ func TestProcessPgDump(t *testing.T) {
 		{"float8", ddl.Type{Name: ddl.Float64}},
 		{"float4", ddl.Type{Name: ddl.Float64}},
 		{"integer", ddl.Type{Name: ddl.Int64}},
+		{"json", ddl.Type{Name: ddl.JSON}},
+		{"jsonb", ddl.Type{Name: ddl.JSON}},
 		{"numeric", ddl.Type{Name: ddl.Numeric}},
 		{"numeric(4)", ddl.Type{Name: ddl.Numeric}},
 		{"numeric(6, 4)", ddl.Type{Name: ddl.Numeric}},
@@ -404,6 +406,70 @@ func TestProcessPgDump(t *testing.T) {
 					},
 					Pks: []ddl.IndexKey{ddl.IndexKey{Col: "a"}}}},
 		},
+		{
+			name: "Default values",
+			input: "CREATE TABLE test (a bigint PRIMARY KEY, b text DEFAULT 'x'::text, c timestamp with time zone DEFAULT now());\n" +
+				"ALTER TABLE ONLY test ALTER COLUMN a SET DEFAULT nextval('test_a_seq'::regclass);\n",
+			expectedSchema: map[string]ddl.CreateTable{
+				"test": ddl.CreateTable{
+					Name:     "test",
+					ColNames: []string{"a", "b", "c"},
+					ColDefs: map[string]ddl.ColumnDef{
+						"a": ddl.ColumnDef{Name: "a", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+						"b": ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, Default: &ddl.Default{Value: "x"}},
+						"c": ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.Timestamp}, Default: &ddl.Default{Now: true}},
+					},
+					Pks: []ddl.IndexKey{ddl.IndexKey{Col: "a"}}}},
+			expectIssues: true, // Sequences aren't supported.
+		},
+		{
+			name: "Check constraints",
+			input: "CREATE TABLE test (a bigint PRIMARY KEY, b text CHECK (b <> ''), c bigint, " +
+				"CONSTRAINT c_check CHECK (NOT (c <= 0)), CONSTRAINT b_check CHECK (b ~ '^x'));\n",
+			expectedSchema: map[string]ddl.CreateTable{
+				"test": ddl.CreateTable{
+					Name:     "test",
+					ColNames: []string{"a", "b", "c"},
+					ColDefs: map[string]ddl.ColumnDef{
+						"a": ddl.ColumnDef{Name: "a", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+						"b": ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+						"c": ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.Int64}},
+					},
+					Pks: []ddl.IndexKey{ddl.IndexKey{Col: "a"}},
+					Checks: []ddl.CheckConstraint{
+						ddl.CheckConstraint{Expr: []ddl.ExprToken{{Kind: ddl.ExprColumn, Text: "b"}, {Kind: ddl.ExprSymbol, Text: "<>"}, {Kind: ddl.ExprString, Text: ""}}},
+						ddl.CheckConstraint{Name: "c_check", Expr: []ddl.ExprToken{{Kind: ddl.ExprSymbol, Text: "NOT"}, {Kind: ddl.ExprSymbol, Text: "("}, {Kind: ddl.ExprColumn, Text: "c"}, {Kind: ddl.ExprSymbol, Text: "<="}, {Kind: ddl.ExprSymbol, Text: "0"}, {Kind: ddl.ExprSymbol, Text: ")"}}},
+					}}},
+			expectIssues: true, // Regular expression matches aren't supported.
+		},
+		{
+			name: "Generated columns",
+			input: "CREATE TABLE test (\n" +
+				"    a bigint PRIMARY KEY,\n" +
+				"    b bigint GENERATED ALWAYS AS ((a * 2)) STORED,\n" +
+				"    c text GENERATED ALWAYS AS (lower(d)) STORED,\n" +
+				"    d text,\n" +
+				"    e bigint GENERATED ALWAYS AS (length(d)) STORED\n" +
+				");\n" +
+				"INSERT INTO test VALUES (1, 2, 'x', 'X', 1);\n",
+			expectedSchema: map[string]ddl.CreateTable{
+				"test": ddl.CreateTable{
+					Name:     "test",
+					ColNames: []string{"a", "b", "c", "d", "e"},
+					ColDefs: map[string]ddl.ColumnDef{
+						"a": ddl.ColumnDef{Name: "a", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+						"b": ddl.ColumnDef{Name: "b", T: ddl.Type{Name: ddl.Int64}, Generated: []ddl.ExprToken{{Kind: ddl.ExprColumn, Text: "a"}, {Kind: ddl.ExprSymbol, Text: "*"}, {Kind: ddl.ExprSymbol, Text: "2"}}},
+						"c": ddl.ColumnDef{Name: "c", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, Generated: []ddl.ExprToken{{Kind: ddl.ExprSymbol, Text: "LOWER("}, {Kind: ddl.ExprColumn, Text: "d"}, {Kind: ddl.ExprSymbol, Text: ")"}}},
+						"d": ddl.ColumnDef{Name: "d", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+						"e": ddl.ColumnDef{Name: "e", T: ddl.Type{Name: ddl.Int64}},
+					},
+					Pks: []ddl.IndexKey{ddl.IndexKey{Col: "a"}}}},
+			// Values of generated columns aren't written, except for
+			// e, which we can't translate.
+			expectedData: []spannerData{
+				spannerData{table: "test", cols: []string{"a", "d", "e"}, vals: []interface{}{int64(1), "X", int64(1)}}},
+			expectIssues: true,
+		},
 		{
 			name: "Multiple statements on one line",
 			input: "CREATE TABLE t1 (a text, b text); CREATE TABLE t2 (c text);" +
@@ -774,6 +840,29 @@ func TestProcessPgDump_AddPrimaryKeys(t *testing.T) {
 	}
 }
 
+func TestProcessPgDump_Views(t *testing.T) {
+	conv, _ := runProcessPgDump(
+		"CREATE TABLE public.t (a bigint PRIMARY KEY, \"b-c\" text);\n" +
+			"--\n-- Name: v; Type: VIEW; Schema: public; Owner: postgres\n--\n\n" +
+			"CREATE VIEW public.v AS\n" +
+			" SELECT t.a,\n" +
+			"    t.\"b-c\" AS b\n" +
+			"   FROM public.t\n" +
+			"  WHERE (t.a > 0);\n" +
+			"CREATE VIEW public.\"v-2\" AS\n" +
+			" SELECT v.b\n" +
+			"   FROM public.v\n" +
+			"  WHERE ((v.b)::text ~~ 'x%'::text)\n" +
+			"  WITH CASCADED CHECK OPTION;\n" +
+			"CREATE VIEW public.w AS\n" +
+			" SELECT now() AS ts;\n")
+	assert.Equal(t, []string{
+		"CREATE VIEW v SQL SECURITY INVOKER AS SELECT t.a, t.b_c AS b FROM t WHERE (t.a > 0)",
+		"CREATE VIEW v_2 SQL SECURITY INVOKER AS SELECT v.b FROM v WHERE ((v.b) LIKE \"x%\")",
+	}, conv.SpViews.GetDDL(ddl.Config{}))
+	assert.Equal(t, map[string]string{"w": "unsupported function now"}, conv.ViewIssues)
+}
+
 func TestProcessPgDump_WithUnparsableContent(t *testing.T) {
 	s := "This is unparsable content"
 	conv := internal.MakeConv()
@@ -0,0 +1,254 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// This file implements a decoder for the messages of the pgoutput
+// logical decoding plugin (protocol version 1), as needed for change
+// data capture. See
+// https://www.postgresql.org/docs/current/protocol-logicalrep-message-formats.html
+// for the format.
+
+// beginMsg starts a transaction.
+type beginMsg struct {
+	finalLSN   uint64 // LSN of the commit record.
+	commitTime time.Time
+	xid        uint32
+}
+
+// commitMsg ends a transaction.
+type commitMsg struct {
+	commitLSN  uint64
+	endLSN     uint64 // LSN of the end of the transaction.
+	commitTime time.Time
+}
+
+// relationMsg describes a table. It is sent before the first change to
+// the table in a decoding session (and after the table changes).
+type relationMsg struct {
+	id     uint32
+	schema string
+	name   string
+	cols   []string
+}
+
+// rowMsg is an insert ('I'), update ('U') or delete ('D') of a row of
+// relation rel. old is the old row of updates and deletes: it only has
+// values for the replica identity columns, unless the table has
+// REPLICA IDENTITY FULL. Updates only have an old row if the replica
+// identity changed (or the table has REPLICA IDENTITY FULL). new is the
+// new row of inserts and updates.
+type rowMsg struct {
+	typ byte
+	rel uint32
+	old []tupleValue
+	new []tupleValue
+}
+
+// truncateMsg truncates relations rels.
+type truncateMsg struct {
+	rels []uint32
+}
+
+// Kinds of tuple values.
+const (
+	tupleNull      = 'n'
+	tupleUnchanged = 'u' // Unchanged TOASTed value, which isn't sent.
+	tupleText      = 't'
+)
+
+// tupleValue is the value of a column in a row change.
+type tupleValue struct {
+	kind byte
+	val  string // Value in text form, if kind is tupleText.
+}
+
+// pgEpoch is the epoch of PostgreSQL timestamps.
+var pgEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// parseMessage decodes pgoutput message b. It returns one of the *Msg
+// types, or nil for messages that aren't needed to stream changes
+// (origin and type messages).
+func parseMessage(b []byte) (interface{}, error) {
+	if len(b) == 0 {
+		return nil, fmt.Errorf("empty message")
+	}
+	d := &decoder{b: b[1:]}
+	var m interface{}
+	switch b[0] {
+	case 'B':
+		m = &beginMsg{finalLSN: d.u64(), commitTime: d.timestamp(), xid: d.u32()}
+	case 'C':
+		d.u8() // Flags (unused).
+		m = &commitMsg{commitLSN: d.u64(), endLSN: d.u64(), commitTime: d.timestamp()}
+	case 'R':
+		r := &relationMsg{id: d.u32(), schema: d.str(), name: d.str()}
+		d.u8() // Replica identity setting.
+		n := int(d.u16())
+		for i := 0; i < n && d.err == nil; i++ {
+			d.u8() // Flags (whether the column is part of the replica identity).
+			r.cols = append(r.cols, d.str())
+			d.u32() // Type OID.
+			d.u32() // Type modifier.
+		}
+		m = r
+	case 'I':
+		r := &rowMsg{typ: 'I', rel: d.u32()}
+		d.expect('N')
+		r.new = d.tuple()
+		m = r
+	case 'U':
+		r := &rowMsg{typ: 'U', rel: d.u32()}
+		switch t := d.u8(); t {
+		case 'K', 'O':
+			r.old = d.tuple()
+			d.expect('N')
+		case 'N':
+		default:
+			d.fail(fmt.Errorf("unexpected tuple type %q", t))
+		}
+		r.new = d.tuple()
+		m = r
+	case 'D':
+		r := &rowMsg{typ: 'D', rel: d.u32()}
+		switch t := d.u8(); t {
+		case 'K', 'O':
+		default:
+			d.fail(fmt.Errorf("unexpected tuple type %q", t))
+		}
+		r.old = d.tuple()
+		m = r
+	case 'T':
+		t := &truncateMsg{}
+		n := int(d.u32())
+		d.u8() // Options (CASCADE, RESTART IDENTITY).
+		for i := 0; i < n && d.err == nil; i++ {
+			t.rels = append(t.rels, d.u32())
+		}
+		m = t
+	case 'O', 'Y':
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown message type %q", b[0])
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("bad %q message: %w", b[0], d.err)
+	}
+	return m, nil
+}
+
+// decoder reads the big-endian fields of a pgoutput message. After the
+// first error (e.g. a truncated message), reads return zero values and
+// the error is kept in err.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	d.b = nil
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.fail(fmt.Errorf("message too short"))
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) u8() byte {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) u16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) u32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) u64() uint64 {
+	if b := d.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// timestamp reads a timestamp (microseconds since pgEpoch).
+func (d *decoder) timestamp() time.Time {
+	return pgEpoch.Add(time.Duration(int64(d.u64())) * time.Microsecond)
+}
+
+// str reads a null-terminated string.
+func (d *decoder) str() string {
+	i := bytes.IndexByte(d.b, 0)
+	if i < 0 {
+		d.fail(fmt.Errorf("unterminated string"))
+		return ""
+	}
+	s := string(d.bytes(i))
+	d.bytes(1)
+	return s
+}
+
+// expect reads byte c.
+func (d *decoder) expect(c byte) {
+	if t := d.u8(); t != c && d.err == nil {
+		d.fail(fmt.Errorf("expected %q, got %q", c, t))
+	}
+}
+
+// tuple reads the values of a row.
+func (d *decoder) tuple() []tupleValue {
+	n := int(d.u16())
+	vals := make([]tupleValue, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		v := tupleValue{kind: d.u8()}
+		switch v.kind {
+		case tupleNull, tupleUnchanged:
+		case tupleText:
+			v.val = string(d.bytes(int(d.u32())))
+		default:
+			d.fail(fmt.Errorf("unknown tuple value kind %q", v.kind))
+		}
+		vals = append(vals, v)
+	}
+	return vals
+}
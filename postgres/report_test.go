@@ -34,7 +34,7 @@ func TestReport(t *testing.T) {
             d circle);
         CREATE TABLE default_value (
             a text primary key,
-            b bigint DEFAULT 42);
+            b bigint DEFAULT nextval('default_value_b_seq'::regclass));
         CREATE TABLE excellent_schema (
             a text primary key,
             b bigint);
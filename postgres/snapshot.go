@@ -0,0 +1,136 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+)
+
+// querier runs queries against the source database. It is implemented
+// by *sql.DB and by the connections of a snapshot.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// snapshot is a set of connections, one for each worker reading table
+// data, whose transactions all read the same snapshot of the database.
+// This ensures rows read from different tables are consistent with
+// each other (e.g. every foreign key refers to a row that was read),
+// even though they are read by different queries on different
+// connections.
+type snapshot struct {
+	conns []*sql.Conn
+}
+
+// newSnapshot starts a REPEATABLE READ transaction on each of n
+// connections to db. If id is set, every transaction imports the
+// snapshot it names. Otherwise, the first transaction exports its
+// snapshot (using pg_export_snapshot) and the others import it. The
+// exporting transaction must stay open while the snapshot is imported,
+// so it is also used as the first reader.
+func newSnapshot(db *sql.DB, n int, id string) (*snapshot, error) {
+	ctx := context.Background()
+	s := &snapshot{}
+	for i := 0; i < n; i++ {
+		c, err := db.Conn(ctx)
+		if err != nil {
+			s.close()
+			return nil, err
+		}
+		s.conns = append(s.conns, c)
+		if _, err := c.ExecContext(ctx, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY;"); err != nil {
+			s.close()
+			return nil, err
+		}
+		switch {
+		case id == "" && n == 1:
+			// A single transaction doesn't need to share its snapshot.
+		case id == "":
+			err = c.QueryRowContext(ctx, "SELECT pg_export_snapshot();").Scan(&id)
+		default:
+			// Snapshot ids are generated by PostgreSQL and contain only
+			// hex digits and dashes, so they are safe to quote.
+			_, err = c.ExecContext(ctx, fmt.Sprintf("SET TRANSACTION SNAPSHOT '%s';", id))
+		}
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("can't share snapshot between readers: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// reader returns the querier for worker w.
+func (s *snapshot) reader(w int) querier {
+	return conn{s.conns[w]}
+}
+
+// close ends the snapshot's transactions and releases its connections.
+func (s *snapshot) close() {
+	for _, c := range s.conns {
+		// The transactions are read-only, so there's nothing to commit,
+		// and a failure doesn't affect data already read.
+		c.ExecContext(context.Background(), "COMMIT;")
+		c.Close()
+	}
+}
+
+// conn adapts a *sql.Conn to querier.
+type conn struct {
+	c *sql.Conn
+}
+
+func (c conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.c.QueryContext(context.Background(), query, args...)
+}
+
+func (c conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.c.QueryRowContext(context.Background(), query, args...)
+}
+
+// readers returns a function that gives the querier for each of
+// workers go routines reading data (see internal.ForEachWorker), and a
+// function to call when reading is done. Readers share a consistent
+// snapshot of db. If we can't start the snapshot, readers query db
+// directly, and we report the problem as unexpected. If
+// conv.CaptureChanges is set, we first create the replication slot it
+// names using repl (see createSlot and StreamChanges), save the LSN
+// from which it streams changes in conv.ChangePosition, and readers
+// use the snapshot exported with the slot, so that the data read
+// includes exactly the changes before this LSN.
+func readers(conv *internal.Conv, db, repl *sql.DB, workers int) (func(w int) querier, func()) {
+	var id string
+	if conv.CaptureChanges != "" {
+		slot, err := createSlot(db, repl, conv.CaptureChanges)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't start capturing changes: %s", err))
+		} else {
+			// Readers import the snapshot before we return.
+			defer slot.close()
+			conv.ChangePosition, id = slot.lsn, slot.snapshot
+		}
+	}
+	s, err := newSnapshot(db, internal.Workers(workers), id)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't start a consistent snapshot, so tables are read at different times: %s", err))
+		return func(int) querier { return db }, func() {}
+	}
+	return s.reader, s.close
+}
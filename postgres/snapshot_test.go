@@ -0,0 +1,109 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+)
+
+func TestNewSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	ok := sqlmock.NewResult(0, 0)
+	// The first transaction exports its snapshot and the others import it.
+	mock.ExpectExec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").WillReturnResult(ok)
+	mock.ExpectQuery("SELECT pg_export_snapshot[(][)]").WillReturnRows(sqlmock.NewRows([]string{"pg_export_snapshot"}).AddRow("00000003-0000001B-1"))
+	mock.ExpectExec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").WillReturnResult(ok)
+	mock.ExpectExec("SET TRANSACTION SNAPSHOT '00000003-0000001B-1'").WillReturnResult(ok)
+	mock.ExpectExec("COMMIT").WillReturnResult(ok)
+	mock.ExpectExec("COMMIT").WillReturnResult(ok)
+	s, err := newSnapshot(db, 2, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(s.conns))
+	s.close()
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestNewSnapshot_Import(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	ok := sqlmock.NewResult(0, 0)
+	// Every transaction imports the given snapshot.
+	for i := 0; i < 2; i++ {
+		mock.ExpectExec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").WillReturnResult(ok)
+		mock.ExpectExec("SET TRANSACTION SNAPSHOT '00000003-0000001B-1'").WillReturnResult(ok)
+	}
+	mock.ExpectExec("COMMIT").WillReturnResult(ok)
+	mock.ExpectExec("COMMIT").WillReturnResult(ok)
+	s, err := newSnapshot(db, 2, "00000003-0000001B-1")
+	assert.Nil(t, err)
+	s.close()
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestReaders_NoSnapshot(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	mock.ExpectExec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").WillReturnError(errors.New("no transactions"))
+	conv := internal.MakeConv()
+	reader, done := readers(conv, db, nil, 1)
+	defer done()
+	// Tables are read without a snapshot, and the problem is reported.
+	assert.Equal(t, db, reader(0))
+	assert.Equal(t, int64(1), conv.Unexpecteds())
+}
+
+func TestReaders_CaptureChanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	repl, replMock, err := sqlmock.New()
+	assert.Nil(t, err)
+	ok := sqlmock.NewResult(0, 0)
+	// The replication slot is created (over the replication
+	// connection) before the snapshot starts, and readers import the
+	// snapshot it exports.
+	mock.ExpectQuery("SELECT EXISTS .* pg_publication").WithArgs("hb").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	replMock.ExpectQuery(`CREATE_REPLICATION_SLOT "hb" LOGICAL pgoutput EXPORT_SNAPSHOT`).WillReturnRows(
+		sqlmock.NewRows([]string{"slot_name", "consistent_point", "snapshot_name", "output_plugin"}).AddRow("hb", "0/1634F50", "00000003-00000002-1", "pgoutput"))
+	mock.ExpectExec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").WillReturnResult(ok)
+	mock.ExpectExec("SET TRANSACTION SNAPSHOT '00000003-00000002-1'").WillReturnResult(ok)
+	mock.ExpectExec("COMMIT").WillReturnResult(ok)
+	conv := internal.MakeConv()
+	conv.CaptureChanges = "hb"
+	_, done := readers(conv, db, repl, 1)
+	done()
+	assert.Equal(t, "0/1634F50", conv.ChangePosition)
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, replMock.ExpectationsWereMet())
+}
+
+func TestReaders_NoPublication(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	mock.ExpectQuery("SELECT EXISTS .* pg_publication").WithArgs("hb").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec("BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY").WillReturnResult(sqlmock.NewResult(0, 0))
+	conv := internal.MakeConv()
+	conv.CaptureChanges = "hb"
+	readers(conv, db, nil, 1)
+	assert.Equal(t, "", conv.ChangePosition)
+	assert.Equal(t, int64(1), conv.Unexpecteds())
+}
@@ -16,11 +16,8 @@ package postgres
 
 import (
 	"fmt"
-	"strconv"
-	"unicode"
 
 	"github.com/cloudspannerecosystem/harbourbridge/internal"
-	"github.com/cloudspannerecosystem/harbourbridge/schema"
 	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
 )
 
@@ -45,6 +42,7 @@ func schemaToDDL(conv *internal.Conv) error {
 		}
 		usedNames[spTableName] = true
 	}
+	internal.ReserveViewNames(conv, usedNames)
 	for _, srcTable := range conv.SrcSchema {
 		spTableName, err := internal.GetSpannerTable(conv, srcTable.Name)
 		if err != nil {
@@ -72,31 +70,41 @@ func schemaToDDL(conv *internal.Conv) error {
 			if srcCol.Ignored.ForeignKey {
 				issues = append(issues, internal.ForeignKey)
 			}
+			ty.IsArray = len(srcCol.Type.ArrayBounds) == 1
+			var def *ddl.Default
 			if srcCol.Ignored.Default {
-				issues = append(issues, internal.DefaultValue)
+				// Only report defaults that we can't translate.
+				if d, ok := internal.ToSpannerDefault(srcCol.Default, ty); ok {
+					def = d
+				} else {
+					issues = append(issues, internal.DefaultValue)
+				}
 			}
 			if len(issues) > 0 {
 				conv.Issues[srcTable.Name][srcCol.Name] = issues
 			}
-			ty.IsArray = len(srcCol.Type.ArrayBounds) == 1
 			spColDef[colName] = ddl.ColumnDef{
 				Name:    colName,
 				T:       ty,
 				NotNull: srcCol.NotNull,
-				Comment: "From: " + quoteIfNeeded(srcCol.Name) + " " + srcCol.Type.Print(),
+				Default: def,
+				Comment: "From: " + internal.QuoteIfNeeded(srcCol.Name) + " " + srcCol.Type.Print(),
 			}
 		}
-		comment := "Spanner schema for source table " + quoteIfNeeded(srcTable.Name)
+		internal.CvtGeneratedColumns(conv, srcTable, spColDef)
+		comment := "Spanner schema for source table " + internal.QuoteIfNeeded(srcTable.Name)
 		conv.SpSchema[spTableName] = ddl.CreateTable{
 			Name:     spTableName,
 			ColNames: spColNames,
 			ColDefs:  spColDef,
-			Pks:      cvtPrimaryKeys(conv, srcTable.Name, srcTable.PrimaryKeys),
-			Fks:      cvtForeignKeys(conv, srcTable.Name, srcTable.ForeignKeys, usedNames),
-			Indexes:  cvtIndexes(conv, spTableName, srcTable.Name, srcTable.Indexes, usedNames),
+			Pks:      internal.CvtPrimaryKeys(conv, srcTable.Name, srcTable.PrimaryKeys),
+			Fks:      internal.CvtForeignKeys(conv, srcTable.Name, srcTable.ForeignKeys, usedNames),
+			Indexes:  internal.CvtIndexes(conv, spTableName, srcTable.Name, srcTable.Indexes, usedNames),
+			Checks:   internal.CvtCheckConstraints(conv, srcTable, usedNames),
 			Comment:  comment}
 	}
 	internal.ResolveRefs(conv)
+	internal.ViewsToDDL(conv)
 	return nil
 }
 
@@ -130,6 +138,8 @@ func toSpannerType(conv *internal.Conv, id string, mods []int64) (ddl.Type, []in
 		return ddl.Type{Name: ddl.Int64}, []internal.SchemaIssue{internal.Widened}
 	case "int2", "smallint":
 		return ddl.Type{Name: ddl.Int64}, []internal.SchemaIssue{internal.Widened}
+	case "json", "jsonb":
+		return ddl.Type{Name: ddl.JSON}, nil
 	case "numeric":
 		// PostgreSQL's NUMERIC type can have a specified precision of up to 1000
 		// digits (and scale can be anything from 0 up to the value of 'precision').
@@ -161,89 +171,3 @@ func toSpannerType(conv *internal.Conv, id string, mods []int64) (ddl.Type, []in
 	}
 	return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}
 }
-
-func quoteIfNeeded(s string) string {
-	for _, r := range s {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsPunct(r) {
-			continue
-		}
-		return strconv.Quote(s)
-	}
-	return s
-}
-
-func cvtPrimaryKeys(conv *internal.Conv, srcTable string, srcKeys []schema.Key) []ddl.IndexKey {
-	var spKeys []ddl.IndexKey
-	for _, k := range srcKeys {
-		spCol, err := internal.GetSpannerCol(conv, srcTable, k.Column, true)
-		if err != nil {
-			conv.Unexpected(fmt.Sprintf("Can't map key for table %s", srcTable))
-			continue
-		}
-		spKeys = append(spKeys, ddl.IndexKey{Col: spCol, Desc: k.Desc})
-	}
-	return spKeys
-}
-
-func cvtForeignKeys(conv *internal.Conv, srcTable string, srcKeys []schema.ForeignKey, usedNames map[string]bool) []ddl.Foreignkey {
-	var spKeys []ddl.Foreignkey
-	for _, key := range srcKeys {
-		if len(key.Columns) != len(key.ReferColumns) {
-			conv.Unexpected(fmt.Sprintf("ConvertForeignKeys: columns and referColumns don't have the same lengths: len(columns)=%d, len(referColumns)=%d for source table: %s, referenced table: %s", len(key.Columns), len(key.ReferColumns), srcTable, key.ReferTable))
-			continue
-		}
-		spReferTable, err := internal.GetSpannerTable(conv, key.ReferTable)
-		if err != nil {
-			conv.Unexpected(fmt.Sprintf("Can't map foreign key for source table: %s, referenced table: %s", srcTable, key.ReferTable))
-			continue
-		}
-		var spCols, spReferCols []string
-		for i, col := range key.Columns {
-			spCol, err1 := internal.GetSpannerCol(conv, srcTable, col, false)
-			spReferCol, err2 := internal.GetSpannerCol(conv, key.ReferTable, key.ReferColumns[i], false)
-			if err1 != nil || err2 != nil {
-				conv.Unexpected(fmt.Sprintf("Can't map foreign key for table: %s, referenced table: %s, column: %s", srcTable, key.ReferTable, col))
-				continue
-			}
-			spCols = append(spCols, spCol)
-			spReferCols = append(spReferCols, spReferCol)
-		}
-		spKeyName := internal.ToSpannerForeignKey(key.Name, usedNames)
-		spKey := ddl.Foreignkey{
-			Name:         spKeyName,
-			Columns:      spCols,
-			ReferTable:   spReferTable,
-			ReferColumns: spReferCols}
-		spKeys = append(spKeys, spKey)
-	}
-	return spKeys
-}
-
-func cvtIndexes(conv *internal.Conv, spTableName string, srcTable string, srcIndexes []schema.Index, usedNames map[string]bool) []ddl.CreateIndex {
-	var spIndexes []ddl.CreateIndex
-	for _, srcIndex := range srcIndexes {
-		var spKeys []ddl.IndexKey
-		for _, k := range srcIndex.Keys {
-			spCol, err := internal.GetSpannerCol(conv, srcTable, k.Column, true)
-			if err != nil {
-				conv.Unexpected(fmt.Sprintf("Can't map index key column name for table %s", srcTable))
-				continue
-			}
-			spKeys = append(spKeys, ddl.IndexKey{Col: spCol, Desc: k.Desc})
-		}
-		if srcIndex.Name == "" {
-			// Generate a name if index name is empty in Postgres.
-			// Collision of index name will be handled by ToSpannerIndexName.
-			srcIndex.Name = fmt.Sprintf("Index_%s", srcTable)
-		}
-		spIndexName := internal.ToSpannerIndexName(srcIndex.Name, usedNames)
-		spIndex := ddl.CreateIndex{
-			Name:   spIndexName,
-			Table:  spTableName,
-			Unique: srcIndex.Unique,
-			Keys:   spKeys,
-		}
-		spIndexes = append(spIndexes, spIndex)
-	}
-	return spIndexes
-}
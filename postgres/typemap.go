@@ -12,28 +12,29 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package web
+package postgres
 
 import (
 	"github.com/cloudspannerecosystem/harbourbridge/internal"
 	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
 )
 
-// toSpannerTypePostgres defines the mapping of source types into Spanner
+// remapType defines the mapping of source types into Spanner
 // types. Each source type has a default Spanner type, as well as other potential
-// Spanner types it could map to. When calling toSpannerTypePostgres, you specify
+// Spanner types it could map to. When calling remapType, you specify
 // the source type name (along with any modifiers), and optionally you specify
 // a target Spanner type name (empty string if you don't have one). If the target
 // Spanner type name is specified and is a potential mapping for this source type,
 // then it will be used to build the returned ddl.Type. If not, the default
 // Spanner type for this source type will be used.
-// Note that toSpannerTypePostgres is extensively tested via tests in web_test.go.
+// remapType is used to implement source.Driver's ToSpannerType (which
+// the web UI uses to change types after schema conversion), and is
+// extensively tested via tests in web/web_test.go.
 //
-// TODO: Move the type remapping function to toddl.go (once we've merged
-// dynamodb/toddl.go, mysql/toddl.go and postgres/toddl.go).
-// Consider some refactoring to reduce code duplication (although note
-// that this type remapping has to preserve all previous changes done via the UI!)
-func toSpannerTypePostgres(srcType string, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+// TODO: Consider some refactoring to reduce code duplication with
+// toSpannerType (although note that this type remapping has to preserve
+// all previous changes done via the UI!)
+func remapType(srcType string, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
 	switch srcType {
 	case "bool", "boolean":
 		switch spType {
@@ -114,6 +115,13 @@ func toSpannerTypePostgres(srcType string, spType string, mods []int64) (ddl.Typ
 		default:
 			return ddl.Type{Name: ddl.Int64}, []internal.SchemaIssue{internal.Widened}
 		}
+	case "json", "jsonb":
+		switch spType {
+		case ddl.String:
+			return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+		default:
+			return ddl.Type{Name: ddl.JSON}, nil
+		}
 	case "numeric":
 		switch spType {
 		case ddl.String:
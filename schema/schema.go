@@ -33,22 +33,31 @@ import (
 
 // Table represents a database table.
 type Table struct {
-	Name        string
-	ColNames    []string          // List of column names (for predictable iteration order e.g. printing).
-	ColDefs     map[string]Column // Details of columns.
-	PrimaryKeys []Key
-	ForeignKeys []ForeignKey
-	Indexes     []Index
+	Name             string
+	ColNames         []string          // List of column names (for predictable iteration order e.g. printing).
+	ColDefs          map[string]Column // Details of columns.
+	PrimaryKeys      []Key
+	ForeignKeys      []ForeignKey
+	CheckConstraints []CheckConstraint
+	Indexes          []Index
+}
+
+// View represents a database view.
+type View struct {
+	Name  string
+	Query string // The view's query (source DB SQL text).
 }
 
 // Column represents a database column.
 // TODO: add support for foreign keys.
 type Column struct {
-	Name    string
-	Type    Type
-	NotNull bool
-	Unique  bool
-	Ignored Ignored
+	Name      string
+	Type      Type
+	NotNull   bool
+	Unique    bool
+	Default   string // Default value expression (source DB SQL text), if known.
+	Generated string // Expression of a generated column (source DB SQL text), if known.
+	Ignored   Ignored
 }
 
 // ForeignKey represents a foreign key.
@@ -66,6 +75,13 @@ type ForeignKey struct {
 	OnUpdate     string
 }
 
+// CheckConstraint represents a CHECK constraint. Both table and
+// column constraints are recorded here.
+type CheckConstraint struct {
+	Name string // Empty if the constraint is unnamed.
+	Expr string // Expression (source DB SQL text).
+}
+
 // Key respresents a primary key or index key.
 type Key struct {
 	Column string
@@ -88,11 +104,16 @@ type Type struct {
 
 // Ignored represents column properties/constraints that are not
 // represented. We drop the details, but retain presence/absence for
-// reporting purposes.
+// reporting purposes. Default values, generated columns and check
+// constraints are the exception: default value expressions are kept in
+// Column.Default, generated column expressions in Column.Generated, and
+// check constraints in Table.CheckConstraints (when the source DB
+// driver can extract them), so that simple ones can be translated.
 type Ignored struct {
 	Check         bool
 	Identity      bool
 	Default       bool
+	Generated     bool
 	Exclusion     bool
 	ForeignKey    bool
 	AutoIncrement bool
@@ -0,0 +1,187 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package source defines the interface implemented by source database
+// drivers, along with a registry of drivers. Drivers register
+// themselves (typically from an init function) under the name used
+// for HarbourBridge's -driver flag, in much the same way that
+// database/sql drivers register themselves with database/sql.
+//
+// The postgres, mysql and dynamodb packages register the built-in
+// drivers. To add a new source, implement Driver in a separate package,
+// call Register from that package's init function, and import the
+// package (for side effects) from the main package.
+package source
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// Conv, Reader and SchemaIssue are aliases for the internal types used
+// in the Driver interface. They allow drivers that live outside of this
+// module to implement Driver.
+type (
+	Conv        = internal.Conv
+	Reader      = internal.Reader
+	SchemaIssue = internal.SchemaIssue
+)
+
+// Kind describes how a driver obtains its source data.
+type Kind int
+
+const (
+	// Dump drivers read a dump file (from stdin or -dump-file). The
+	// dump is processed twice: once in schema mode and once in data mode.
+	Dump Kind = iota
+	// SQL drivers read from a live database via database/sql. Drivers
+	// of this kind must also implement Connector.
+	SQL
+	// Client drivers manage their own connection to the source database
+	// e.g. using a vendor-specific client library.
+	Client
+)
+
+// Source describes the input a Driver reads from. Which fields are
+// set depends on the driver's Kind.
+type Source struct {
+	DB         *sql.DB          // Connection to source database (Kind SQL).
+	DBName     string           // Name of source database (Kind SQL).
+	DSN        string           // Data source name DB was opened with (Kind SQL, data conversion only), for drivers that open other kinds of connection.
+	Reader     *internal.Reader // Dump file input (Kind Dump).
+	Dir        string           // Dump directory, when input is a directory rather than a file (Kind Dump).
+	SampleSize int64            // Number of rows to sample when inferring schema (Kind Client, sqlite).
+	Workers    int              // Number of tables to read concurrently during data conversion (Kind SQL, postgres and mysql only); values less than 2 read tables sequentially.
+	ChunkRows  int64            // Tables with more rows than this are read in primary key range chunks (Kind SQL, postgres and mysql only); 0 disables chunking.
+	Changes    string           // Location of the source's change log, in a driver-specific form (ChangeStreamer drivers only).
+	Follow     bool             // Whether to wait for new changes at the end of the change log (ChangeStreamer drivers only).
+}
+
+// Driver is the interface implemented by source database drivers.
+type Driver interface {
+	// Kind returns the kind of input the driver reads.
+	Kind() Kind
+
+	// ProcessSchema performs schema conversion: it populates
+	// conv.SrcSchema with the source schema and conv.SpSchema with the
+	// corresponding Spanner schema.
+	ProcessSchema(conv *internal.Conv, src Source) error
+
+	// SetRowStats populates conv.Stats.Rows with the number of rows in
+	// each source table (used to show progress during data conversion).
+	// Dump drivers count rows as part of the schema pass, and can
+	// implement SetRowStats as a no-op.
+	SetRowStats(conv *internal.Conv, src Source) error
+
+	// ProcessData performs data conversion: it reads data from the
+	// source, converts it based on conv.SrcSchema and conv.SpSchema, and
+	// writes it out using conv.WriteRow.
+	ProcessData(conv *internal.Conv, src Source) error
+
+	// ToSpannerType maps source type srcType (with modifiers mods) to
+	// Spanner type spType, if spType is a supported mapping for srcType.
+	// Otherwise it returns the default Spanner type for srcType. It is
+	// used to change Spanner types after schema conversion (for example,
+	// from the web UI).
+	ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue)
+}
+
+// ChangeStreamer is implemented by drivers that support change data
+// capture: after data conversion, they can stream the changes made to
+// the source database since the data was read.
+type ChangeStreamer interface {
+	// StreamChanges reads changes from src.Changes, starting at pos (a
+	// position recorded in conv.ChangePosition during data conversion,
+	// when conv.CaptureChanges is set), converts them to Spanner
+	// mutations based on conv.SrcSchema and conv.SpSchema, and calls
+	// apply with the mutations of each source transaction, the position
+	// after it and its commit time in the source. Changes are counted
+	// with conv.StatsAddChanges once they are applied. If src.Follow is
+	// set, StreamChanges waits for new changes until apply returns an
+	// error; otherwise it returns nil at the end of the change log.
+	StreamChanges(conv *internal.Conv, src Source, pos string, apply func(ms []*spanner.Mutation, pos string, commitTime time.Time) error) error
+}
+
+// Config contains the parameters needed to connect to a live database.
+type Config struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Database string
+}
+
+// Connector is implemented by drivers of Kind SQL.
+type Connector interface {
+	// ConfigFromEnv builds a Config using driver-specific environment
+	// variables. Password is left empty if it is not set in the
+	// environment (callers may prompt for it).
+	ConfigFromEnv() (Config, error)
+
+	// DataSourceName returns the database/sql driver name and data
+	// source name to pass to sql.Open to connect to the database
+	// described by c.
+	DataSourceName(c Config) (string, string)
+}
+
+var (
+	mu      sync.RWMutex
+	drivers = make(map[string]Driver)
+)
+
+// Register makes a source driver available under the provided name.
+// If Register is called twice with the same name or if d is nil,
+// it panics.
+func Register(name string, d Driver) {
+	mu.Lock()
+	defer mu.Unlock()
+	if d == nil {
+		panic("source: Register driver is nil")
+	}
+	if _, dup := drivers[name]; dup {
+		panic("source: Register called twice for driver " + name)
+	}
+	drivers[name] = d
+}
+
+// Get returns the driver registered under name.
+func Get(name string) (Driver, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("driver %s not supported", name)
+	}
+	return d, nil
+}
+
+// Drivers returns a sorted list of the names of the registered drivers.
+func Drivers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var l []string
+	for name := range drivers {
+		l = append(l, name)
+	}
+	sort.Strings(l)
+	return l
+}
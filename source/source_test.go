@@ -0,0 +1,47 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+type fakeDriver struct{}
+
+func (fakeDriver) Kind() Kind                                          { return Client }
+func (fakeDriver) ProcessSchema(conv *internal.Conv, src Source) error { return nil }
+func (fakeDriver) SetRowStats(conv *internal.Conv, src Source) error   { return nil }
+func (fakeDriver) ProcessData(conv *internal.Conv, src Source) error   { return nil }
+func (fakeDriver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+}
+
+func TestRegister(t *testing.T) {
+	Register("fake-a", fakeDriver{})
+	Register("fake-b", fakeDriver{})
+	d, err := Get("fake-a")
+	assert.Nil(t, err)
+	assert.Equal(t, Client, d.Kind())
+	_, err = Get("fake-c")
+	assert.NotNil(t, err)
+	assert.Subset(t, Drivers(), []string{"fake-a", "fake-b"})
+	assert.Panics(t, func() { Register("fake-a", fakeDriver{}) })
+	assert.Panics(t, func() { Register("fake-d", nil) })
+}
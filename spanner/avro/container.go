@@ -0,0 +1,154 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"hash"
+	"io"
+	"math"
+	"os"
+)
+
+const (
+	// blockBytes is the size of uncompressed data at which we write out
+	// a block of rows.
+	blockBytes = 1 << 20
+	// codec is the compression codec used for blocks.
+	codec = "deflate"
+)
+
+// containerFile writes an Avro object container file (see
+// https://avro.apache.org/docs/current/spec.html#Object+Container+Files)
+// and computes its MD5 checksum as it goes.
+type containerFile struct {
+	f     *os.File
+	w     io.Writer // Writes to f and md5.
+	md5   hash.Hash
+	sync  [16]byte     // Sync marker written after each block.
+	block bytes.Buffer // Encoded rows of the current block.
+	count int64        // Number of rows in block.
+}
+
+// newContainerFile creates the file name and writes the container file
+// header, using schema as the Avro schema.
+func newContainerFile(name string, schema []byte) (*containerFile, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	cf := &containerFile{f: f, md5: md5.New()}
+	cf.w = io.MultiWriter(f, cf.md5)
+	if _, err := rand.Read(cf.sync[:]); err != nil {
+		f.Close()
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("Obj\x01")
+	// File metadata is a map with a single block of entries.
+	writeLong(&b, 2)
+	writeString(&b, "avro.schema")
+	writeBytes(&b, schema)
+	writeString(&b, "avro.codec")
+	writeBytes(&b, []byte(codec))
+	writeLong(&b, 0)
+	b.Write(cf.sync[:])
+	if _, err := cf.w.Write(b.Bytes()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return cf, nil
+}
+
+// append adds an encoded row to the current block, writing out the
+// block if it is full.
+func (cf *containerFile) append(row []byte) error {
+	cf.block.Write(row)
+	cf.count++
+	if cf.block.Len() >= blockBytes {
+		return cf.flush()
+	}
+	return nil
+}
+
+// flush writes out the current block (if any).
+func (cf *containerFile) flush() error {
+	if cf.count == 0 {
+		return nil
+	}
+	var data bytes.Buffer
+	zw, err := flate.NewWriter(&data, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	zw.Write(cf.block.Bytes())
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	writeLong(&b, cf.count)
+	writeLong(&b, int64(data.Len()))
+	b.Write(data.Bytes())
+	b.Write(cf.sync[:])
+	cf.block.Reset()
+	cf.count = 0
+	_, err = cf.w.Write(b.Bytes())
+	return err
+}
+
+// close writes out the current block and closes the file.
+func (cf *containerFile) close() error {
+	err := cf.flush()
+	if cerr := cf.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// The following functions implement Avro's binary encoding of
+// primitive types.
+
+func writeLong(b *bytes.Buffer, n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutVarint(buf[:], n)]) // PutVarint uses zig-zag encoding.
+}
+
+func writeBool(b *bytes.Buffer, v bool) {
+	if v {
+		b.WriteByte(1)
+	} else {
+		b.WriteByte(0)
+	}
+}
+
+func writeDouble(b *bytes.Buffer, f float64) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+	b.Write(buf[:])
+}
+
+func writeBytes(b *bytes.Buffer, v []byte) {
+	writeLong(b, int64(len(v)))
+	b.Write(v)
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	writeLong(b, int64(len(s)))
+	b.WriteString(s)
+}
@@ -0,0 +1,212 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	sp "cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// encodeRow returns the Avro binary encoding of a row of table t, using
+// the schema built by tableSchema. cols and vals are as passed to
+// conv's data sink: vals are values of the Go types used for Spanner
+// mutations. Columns of t that are missing from cols are NULL.
+func encodeRow(t ddl.CreateTable, cols []string, vals []interface{}) ([]byte, error) {
+	if len(cols) != len(vals) {
+		return nil, fmt.Errorf("have %d columns but %d values", len(cols), len(vals))
+	}
+	m := make(map[string]interface{})
+	for i, c := range cols {
+		if _, ok := t.ColDefs[c]; !ok {
+			return nil, fmt.Errorf("table %s has no column %s", t.Name, c)
+		}
+		m[c] = vals[i]
+	}
+	var b bytes.Buffer
+	for _, cn := range t.ColNames {
+		cd := t.ColDefs[cn]
+		v, valid := unwrap(m[cn])
+		if !cd.NotNull {
+			// Nullable columns are encoded as a union of null and
+			// the column type.
+			if !valid {
+				writeLong(&b, 0)
+				continue
+			}
+			writeLong(&b, 1)
+		} else if !valid {
+			return nil, fmt.Errorf("column %s can't be NULL", cn)
+		}
+		var err error
+		if cd.T.IsArray {
+			err = encodeArray(&b, cd.T.Name, v)
+		} else {
+			err = encodeValue(&b, cd.T.Name, v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", cn, err)
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// unwrap returns the value held by v if v is one of the spanner.Null*
+// types, and whether v is non-NULL. Nil values and nil slices are NULL.
+func unwrap(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case nil:
+		return nil, false
+	case sp.NullString:
+		return x.StringVal, x.Valid
+	case sp.NullInt64:
+		return x.Int64, x.Valid
+	case sp.NullFloat64:
+		return x.Float64, x.Valid
+	case sp.NullBool:
+		return x.Bool, x.Valid
+	case sp.NullDate:
+		return x.Date, x.Valid
+	case sp.NullTime:
+		return x.Time, x.Valid
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.IsNil() {
+		return nil, false
+	}
+	return v, true
+}
+
+// encodeArray encodes v, which must be a slice, as an Avro array of
+// nullable elements of Spanner type ty.
+func encodeArray(b *bytes.Buffer, ty string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("can't encode %T as ARRAY<%s>", v, ty)
+	}
+	if n := rv.Len(); n > 0 {
+		// Arrays are written as a single block of n items.
+		writeLong(b, int64(n))
+		for i := 0; i < n; i++ {
+			e, valid := unwrap(rv.Index(i).Interface())
+			if !valid {
+				writeLong(b, 0)
+				continue
+			}
+			writeLong(b, 1)
+			if err := encodeValue(b, ty, e); err != nil {
+				return err
+			}
+		}
+	}
+	writeLong(b, 0)
+	return nil
+}
+
+// encodeValue encodes a non-NULL value v of Spanner type ty.
+func encodeValue(b *bytes.Buffer, ty string, v interface{}) error {
+	switch ty {
+	case ddl.Bool:
+		if x, ok := v.(bool); ok {
+			writeBool(b, x)
+			return nil
+		}
+	case ddl.Int64:
+		switch x := v.(type) {
+		case int64:
+			writeLong(b, x)
+			return nil
+		case int:
+			writeLong(b, int64(x))
+			return nil
+		}
+	case ddl.Float64:
+		if x, ok := v.(float64); ok {
+			writeDouble(b, x)
+			return nil
+		}
+	case ddl.String, ddl.JSON:
+		if x, ok := v.(string); ok {
+			writeString(b, x)
+			return nil
+		}
+	case ddl.Bytes:
+		if x, ok := v.([]byte); ok {
+			writeBytes(b, x)
+			return nil
+		}
+	case ddl.Date:
+		switch x := v.(type) {
+		case civil.Date:
+			writeString(b, x.String())
+			return nil
+		case string:
+			writeString(b, x)
+			return nil
+		}
+	case ddl.Timestamp:
+		switch x := v.(type) {
+		case time.Time:
+			writeString(b, x.UTC().Format(time.RFC3339Nano))
+			return nil
+		case string:
+			writeString(b, x)
+			return nil
+		}
+	case ddl.Numeric:
+		var r *big.Rat
+		switch x := v.(type) {
+		case string:
+			var ok bool
+			if r, ok = new(big.Rat).SetString(x); !ok {
+				return fmt.Errorf("can't parse %q as NUMERIC", x)
+			}
+		case big.Rat:
+			r = &x
+		case *big.Rat:
+			r = x
+		}
+		if r != nil {
+			writeBytes(b, decimalBytes(r))
+			return nil
+		}
+	}
+	return fmt.Errorf("can't encode %T as %s", v, ty)
+}
+
+// decimalBytes returns the Avro decimal encoding of r: the big-endian
+// two's-complement representation of r's unscaled value at scale
+// numericScale. r is rounded to numericScale decimal digits.
+func decimalBytes(r *big.Rat) []byte {
+	n, _ := new(big.Int).SetString(strings.Replace(r.FloatString(numericScale), ".", "", 1), 10)
+	if n.Sign() >= 0 {
+		b := n.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	}
+	// For negative n, use 2^(8k) + n, where k is large enough that
+	// the top bit of the result is set.
+	k := uint(n.BitLen()/8 + 1)
+	return new(big.Int).Add(new(big.Int).Lsh(big.NewInt(1), 8*k), n).Bytes()
+}
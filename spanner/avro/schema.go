@@ -0,0 +1,114 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+const (
+	// namespace is the Avro namespace used for table records. It
+	// matches the namespace used by Spanner exports.
+	namespace = "spannerexport"
+	// numericPrecision and numericScale describe the Avro decimal
+	// used to represent Spanner's NUMERIC type.
+	numericPrecision = 38
+	numericScale     = 9
+)
+
+// tableSchema returns the Avro schema for table t. This follows the
+// layout used by Spanner exports: each column is a field of a record
+// named after the table, and the Spanner schema (column types, primary
+// key, parent table, indexes and foreign keys) is recorded in
+// properties of the record and its fields.
+func tableSchema(t ddl.CreateTable) ([]byte, error) {
+	c := ddl.Config{ProtectIds: true}
+	var fields []map[string]interface{}
+	for _, cn := range t.ColNames {
+		cd := t.ColDefs[cn]
+		ty := avroType(cd.T)
+		if !cd.NotNull {
+			ty = []interface{}{"null", ty}
+		}
+		fields = append(fields, map[string]interface{}{
+			"name":    cn,
+			"type":    ty,
+			"sqlType": cd.T.PrintColumnDefType(),
+		})
+	}
+	s := map[string]interface{}{
+		"type":                "record",
+		"name":                t.Name,
+		"namespace":           namespace,
+		"fields":              fields,
+		"googleStorage":       "CloudSpanner",
+		"googleFormatVersion": "1.0.0",
+		"spannerName":         t.Name,
+	}
+	for i, k := range t.Pks {
+		order := "ASC"
+		if k.Desc {
+			order = "DESC"
+		}
+		s[fmt.Sprintf("spannerPrimaryKey_%d", i)] = fmt.Sprintf("`%s` %s", k.Col, order)
+	}
+	if t.Parent != "" {
+		s["spannerParent"] = t.Parent
+		s["spannerOnDeleteAction"] = "no action"
+	}
+	for i, index := range t.Indexes {
+		s[fmt.Sprintf("spannerIndex_%d", i)] = index.PrintCreateIndex(c)
+	}
+	for i, fk := range t.Fks {
+		s[fmt.Sprintf("spannerForeignKey_%d", i)] = fk.PrintForeignKeyAlterTable(c, t.Name)
+	}
+	return json.Marshal(s)
+}
+
+// avroType returns the Avro type used for Spanner type ty. DATE and
+// TIMESTAMP values are stored as strings, as in Spanner exports.
+func avroType(ty ddl.Type) interface{} {
+	var t interface{}
+	switch ty.Name {
+	case ddl.Bool:
+		t = "boolean"
+	case ddl.Int64:
+		t = "long"
+	case ddl.Float64:
+		t = "double"
+	case ddl.Bytes:
+		t = "bytes"
+	case ddl.Numeric:
+		t = map[string]interface{}{
+			"type":        "bytes",
+			"logicalType": "decimal",
+			"precision":   numericPrecision,
+			"scale":       numericScale,
+		}
+	default:
+		// STRING, JSON, DATE and TIMESTAMP.
+		t = "string"
+	}
+	if ty.IsArray {
+		return map[string]interface{}{
+			"type":  "array",
+			"items": []interface{}{"null", t},
+		}
+	}
+	return t
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package avro writes converted data to Avro files, using the layout
+// of a Spanner export. The files can be loaded into Spanner using
+// Spanner's import pipeline (see
+// https://cloud.google.com/spanner/docs/import).
+package avro
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// ExportManifest is the name of the top-level manifest file, which
+// lists the tables of the export.
+const ExportManifest = "spanner-export.json"
+
+// Writer writes rows of data (via AddRow) to Avro files in a directory.
+// For each table T, it writes data file T.avro-00000-of-00001 and a
+// manifest T-manifest.json listing the data file and its MD5 checksum.
+// Close writes the top-level manifest spanner-export.json. Rows that
+// can't be encoded (e.g. because a value doesn't match its column's
+// type) are dropped. Writer is threadsafe.
+type Writer struct {
+	dir      string
+	schema   ddl.Schema
+	progress *internal.Progress // Progress of rows written; can be nil.
+
+	lock          sync.Mutex                // Protects fields below.
+	files         map[string]*containerFile // Data file for each table.
+	rows          int64                     // Number of rows written.
+	droppedRows   map[string]int64          // Count of dropped rows, broken down by table.
+	sampleBadRows []string                  // A sample of dropped rows.
+	err           error                     // First error writing files.
+}
+
+// maxSampleBadRows is the maximum number of dropped rows that Writer
+// keeps a copy of.
+const maxSampleBadRows = 100
+
+// NewWriter returns a Writer for tables in schema that writes files to
+// dir, creating dir if necessary. If progress is not nil, it is updated
+// with the number of rows written.
+func NewWriter(dir string, schema ddl.Schema, progress *internal.Progress) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		dir:         dir,
+		schema:      schema,
+		progress:    progress,
+		files:       make(map[string]*containerFile),
+		droppedRows: make(map[string]int64),
+	}
+	for _, t := range w.tableNames() {
+		s, err := tableSchema(schema[t])
+		if err != nil {
+			w.closeFiles()
+			return nil, fmt.Errorf("can't build Avro schema for table %s: %w", t, err)
+		}
+		f, err := newContainerFile(filepath.Join(dir, dataFile(t)), s)
+		if err != nil {
+			w.closeFiles()
+			return nil, err
+		}
+		w.files[t] = f
+	}
+	return w, nil
+}
+
+// AddRow writes a row of data for table to the table's data file.
+func (w *Writer) AddRow(table string, cols []string, vals []interface{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	f, ok := w.files[table]
+	var b []byte
+	var err error
+	if ok {
+		b, err = encodeRow(w.schema[table], cols, vals)
+	} else {
+		err = fmt.Errorf("unknown table %s", table)
+	}
+	if err != nil {
+		w.droppedRows[table]++
+		if len(w.sampleBadRows) < maxSampleBadRows {
+			w.sampleBadRows = append(w.sampleBadRows, fmt.Sprintf("table=%s cols=%v data=%v error=%v", table, cols, vals, err))
+		}
+		return
+	}
+	if err := f.append(b); err != nil && w.err == nil {
+		w.err = err
+	}
+	w.rows++
+	if w.progress != nil {
+		w.progress.MaybeReport(w.rows)
+	}
+}
+
+// Flush writes out all buffered rows of data.
+func (w *Writer) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, f := range w.files {
+		if err := f.flush(); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+}
+
+// Close writes out all buffered rows of data, closes the data files and
+// writes the manifests. It returns the first error encountered writing
+// files.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.closeFiles(); err != nil && w.err == nil {
+		w.err = err
+	}
+	if w.err != nil {
+		return w.err
+	}
+	type tableManifest struct {
+		Name         string `json:"name"`
+		ManifestFile string `json:"manifestFile"`
+	}
+	var tables []tableManifest
+	for _, t := range w.tableNames() {
+		if err := w.writeTableManifest(t); err != nil {
+			return err
+		}
+		tables = append(tables, tableManifest{Name: t, ManifestFile: manifestFile(t)})
+	}
+	return writeJSON(filepath.Join(w.dir, ExportManifest), struct {
+		Tables []tableManifest `json:"tables"`
+	}{tables})
+}
+
+// DroppedRowsByTable returns a map of tables to counts of dropped rows.
+func (w *Writer) DroppedRowsByTable() map[string]int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	m := make(map[string]int64)
+	for t, n := range w.droppedRows {
+		m[t] = n
+	}
+	return m
+}
+
+// SampleBadRows returns a string-formatted list of sample rows that
+// were dropped. Returns at most n rows.
+func (w *Writer) SampleBadRows(n int) []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if n > len(w.sampleBadRows) {
+		n = len(w.sampleBadRows)
+	}
+	return append([]string(nil), w.sampleBadRows[:n]...)
+}
+
+// writeTableManifest writes the manifest for table t, which lists its
+// data file and the file's MD5 checksum.
+func (w *Writer) writeTableManifest(t string) error {
+	type file struct {
+		Name string `json:"name"`
+		MD5  string `json:"md5"`
+	}
+	f := file{Name: dataFile(t), MD5: base64.StdEncoding.EncodeToString(w.files[t].md5.Sum(nil))}
+	return writeJSON(filepath.Join(w.dir, manifestFile(t)), struct {
+		Files []file `json:"files"`
+	}{[]file{f}})
+}
+
+// closeFiles closes all data files and returns the first error.
+func (w *Writer) closeFiles() error {
+	var err error
+	for _, f := range w.files {
+		if cerr := f.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// tableNames returns the tables of w's schema, with parent tables before
+// the tables interleaved in them.
+func (w *Writer) tableNames() []string {
+	var names []string
+	for t := range w.schema {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+	var l []string
+	done := make(map[string]bool)
+	var add func(t string)
+	add = func(t string) {
+		if done[t] {
+			return
+		}
+		done[t] = true
+		if p := w.schema[t].Parent; p != "" {
+			if _, ok := w.schema[p]; ok {
+				add(p)
+			}
+		}
+		l = append(l, t)
+	}
+	for _, t := range names {
+		add(t)
+	}
+	return l
+}
+
+func dataFile(table string) string {
+	return table + ".avro-00000-of-00001"
+}
+
+func manifestFile(table string) string {
+	return table + "-manifest.json"
+}
+
+func writeJSON(name string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, append(b, '\n'), 0644)
+}
@@ -0,0 +1,252 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package avro
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	sp "cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func testSchema() ddl.Schema {
+	return ddl.Schema{
+		"singers": ddl.CreateTable{
+			Name:     "singers",
+			ColNames: []string{"id", "name", "active", "score", "born", "updated", "photo", "rating", "tags"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"id":      {Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"name":    {Name: "name", T: ddl.Type{Name: ddl.String, Len: 100}},
+				"active":  {Name: "active", T: ddl.Type{Name: ddl.Bool}},
+				"score":   {Name: "score", T: ddl.Type{Name: ddl.Float64}},
+				"born":    {Name: "born", T: ddl.Type{Name: ddl.Date}},
+				"updated": {Name: "updated", T: ddl.Type{Name: ddl.Timestamp}},
+				"photo":   {Name: "photo", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
+				"rating":  {Name: "rating", T: ddl.Type{Name: ddl.Numeric}},
+				"tags":    {Name: "tags", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength, IsArray: true}},
+			},
+			Pks:     []ddl.IndexKey{{Col: "id"}},
+			Indexes: []ddl.CreateIndex{{Name: "name_idx", Table: "singers", Keys: []ddl.IndexKey{{Col: "name"}}}},
+		},
+		"albums": ddl.CreateTable{
+			Name:     "albums",
+			ColNames: []string{"id", "album_id"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"id":       {Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"album_id": {Name: "album_id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+			},
+			Pks:    []ddl.IndexKey{{Col: "id"}, {Col: "album_id", Desc: true}},
+			Parent: "singers",
+		},
+	}
+}
+
+func TestWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "avro_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	w, err := NewWriter(dir, testSchema(), nil)
+	assert.Nil(t, err)
+
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 890000000, time.FixedZone("", 3600))
+	w.AddRow("singers",
+		[]string{"id", "name", "active", "score", "born", "updated", "photo", "rating", "tags"},
+		[]interface{}{int64(1), "Marc", true, 1.5, civil.Date{Year: 1970, Month: 1, Day: 2}, ts, []byte{1, 2}, "-12.5",
+			[]sp.NullString{{StringVal: "a", Valid: true}, {}}})
+	w.AddRow("singers", []string{"id"}, []interface{}{int64(2)})
+	w.AddRow("singers", []string{"id", "name"}, []interface{}{"three", "bad"})
+	w.AddRow("singers", []string{"name"}, []interface{}{"no key"})
+	w.AddRow("nosuchtable", []string{"id"}, []interface{}{int64(1)})
+	w.Flush()
+	w.AddRow("albums", []string{"id", "album_id"}, []interface{}{int64(1), int64(10)})
+	assert.Nil(t, w.Close())
+
+	assert.Equal(t, map[string]int64{"singers": 2, "nosuchtable": 1}, w.DroppedRowsByTable())
+	assert.Equal(t, 2, len(w.SampleBadRows(2)))
+	assert.Equal(t, 3, len(w.SampleBadRows(100)))
+
+	var export struct {
+		Tables []struct {
+			Name         string
+			ManifestFile string
+		}
+	}
+	readJSON(t, filepath.Join(dir, ExportManifest), &export)
+	assert.Equal(t, 2, len(export.Tables))
+	assert.Equal(t, "singers", export.Tables[0].Name) // Parent before child.
+	assert.Equal(t, "albums", export.Tables[1].Name)
+	assert.Equal(t, "albums-manifest.json", export.Tables[1].ManifestFile)
+
+	schema, rows := readTable(t, dir, "singers")
+	assert.Equal(t, "CloudSpanner", schema["googleStorage"])
+	assert.Equal(t, "`id` ASC", schema["spannerPrimaryKey_0"])
+	assert.Equal(t, "CREATE INDEX `name_idx` ON `singers` (`name`)", schema["spannerIndex_0"])
+	fields := schema["fields"].([]interface{})
+	assert.Equal(t, "STRING(100)", fields[1].(map[string]interface{})["sqlType"])
+	assert.Equal(t, "ARRAY<STRING(MAX)>", fields[8].(map[string]interface{})["sqlType"])
+	assert.Equal(t, [][]interface{}{
+		{int64(1), "Marc", true, 1.5, "1970-01-02", "2021-03-04T04:06:07.89Z", []byte{1, 2}, "-12.500000000", []interface{}{"a", nil}},
+		{int64(2), nil, nil, nil, nil, nil, nil, nil, nil},
+	}, rows)
+
+	schema, rows = readTable(t, dir, "albums")
+	assert.Equal(t, "singers", schema["spannerParent"])
+	assert.Equal(t, "`album_id` DESC", schema["spannerPrimaryKey_1"])
+	assert.Equal(t, [][]interface{}{{int64(1), int64(10)}}, rows)
+}
+
+func TestDecimalBytes(t *testing.T) {
+	for _, s := range []string{"0", "1", "-1", "0.000000001", "-0.000000128", "-0.000000129", "99999999999999999999999999999.999999999", "-3.14"} {
+		r, _ := new(big.Rat).SetString(s)
+		assert.Equal(t, r.FloatString(numericScale), decodeDecimal(decimalBytes(r)), s)
+	}
+}
+
+func readJSON(t *testing.T, name string, v interface{}) {
+	b, err := ioutil.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(b, v))
+}
+
+// readTable checks the manifest for table and decodes its data file,
+// returning the file's schema and rows.
+func readTable(t *testing.T, dir, table string) (map[string]interface{}, [][]interface{}) {
+	var manifest struct {
+		Files []struct {
+			Name string
+			MD5  string
+		}
+	}
+	readJSON(t, filepath.Join(dir, manifestFile(table)), &manifest)
+	assert.Equal(t, 1, len(manifest.Files))
+	b, err := ioutil.ReadFile(filepath.Join(dir, manifest.Files[0].Name))
+	assert.Nil(t, err)
+	sum := md5.Sum(b)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sum[:]), manifest.Files[0].MD5)
+
+	r := bytes.NewReader(b)
+	magic := make([]byte, 4)
+	io.ReadFull(r, magic)
+	assert.Equal(t, "Obj\x01", string(magic))
+	meta := make(map[string]string)
+	for n := readLong(r); n != 0; n = readLong(r) {
+		for ; n > 0; n-- {
+			k := string(readBytes(r))
+			meta[k] = string(readBytes(r))
+		}
+	}
+	assert.Equal(t, codec, meta["avro.codec"])
+	var schema map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(meta["avro.schema"]), &schema))
+	sync := make([]byte, 16)
+	io.ReadFull(r, sync)
+
+	var rows [][]interface{}
+	for r.Len() > 0 {
+		count := readLong(r)
+		data := make([]byte, readLong(r))
+		io.ReadFull(r, data)
+		marker := make([]byte, 16)
+		io.ReadFull(r, marker)
+		assert.Equal(t, sync, marker)
+		block, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+		assert.Nil(t, err)
+		br := bytes.NewReader(block)
+		for ; count > 0; count-- {
+			var row []interface{}
+			for _, f := range schema["fields"].([]interface{}) {
+				row = append(row, decode(br, f.(map[string]interface{})["type"]))
+			}
+			rows = append(rows, row)
+		}
+		assert.Equal(t, 0, br.Len())
+	}
+	return schema, rows
+}
+
+// decode decodes a value of Avro type ty (as decoded from JSON).
+func decode(r *bytes.Reader, ty interface{}) interface{} {
+	switch ty := ty.(type) {
+	case []interface{}: // Union.
+		return decode(r, ty[readLong(r)])
+	case map[string]interface{}:
+		switch ty["type"] {
+		case "array":
+			l := []interface{}{}
+			for n := readLong(r); n != 0; n = readLong(r) {
+				for ; n > 0; n-- {
+					l = append(l, decode(r, ty["items"]))
+				}
+			}
+			return l
+		case "bytes":
+			return decodeDecimal(readBytes(r))
+		}
+	case string:
+		switch ty {
+		case "null":
+			return nil
+		case "boolean":
+			b, _ := r.ReadByte()
+			return b == 1
+		case "long":
+			return readLong(r)
+		case "double":
+			b := make([]byte, 8)
+			io.ReadFull(r, b)
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		case "string":
+			return string(readBytes(r))
+		case "bytes":
+			return readBytes(r)
+		}
+	}
+	panic("unexpected type")
+}
+
+func decodeDecimal(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+	}
+	return new(big.Rat).SetFrac(n, big.NewInt(1000000000)).FloatString(numericScale)
+}
+
+func readLong(r *bytes.Reader) int64 {
+	n, _ := binary.ReadVarint(r)
+	return n
+}
+
+func readBytes(r *bytes.Reader) []byte {
+	b := make([]byte, readLong(r))
+	io.ReadFull(r, b)
+	return b
+}
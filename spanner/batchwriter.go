@@ -37,19 +37,38 @@ const (
 	byteThreshold  = 20 * 1 << 20 // Spanner per-operation limit is 100MB.
 )
 
+// WriteMode specifies the kind of mutation BatchWriter uses to write
+// rows to Spanner.
+type WriteMode string
+
+const (
+	// Insert writes new rows: if a row already exists in the database,
+	// the row fails with error 'AlreadyExists'. This is the default.
+	Insert WriteMode = "insert"
+	// InsertOrUpdate writes new rows, and updates the columns written
+	// of rows that already exist (other columns are unchanged).
+	InsertOrUpdate WriteMode = "insert-or-update"
+	// Replace writes new rows, and replaces rows that already exist
+	// (columns not written are set to NULL).
+	Replace WriteMode = "replace"
+)
+
 // BatchWriter accumulates rows of data (via AddRow) and assembles them
-// into batches that it asynchronously writes to Spanner.  Rows are
-// written to Spanner using insert semantics i.e. if a row already exists
-// in the database, the row will fail with error 'AlreadyExists'.  If
+// into batches that it asynchronously writes to Spanner.  By default,
+// rows are written to Spanner using insert semantics i.e. if a row
+// already exists in the database, the row will fail with error
+// 'AlreadyExists' (see WriteMode for alternatives).  If
 // Spanner returns an error for a batch, BatchWriter splits the batch
 // into smaller chunks to retry, as it attempts to isolate which row(s)
 // in a batch is bad.  BatchWriter respects Spanner's limits on byte size
 // and mutation count and has configurable limits on the number of
 // in-progress writes, amount of data buffered and retry behavior.
-// BatchWriter is not threadsafe: only one call to AddRow or Flush should
-// be active at any time.  See ExampleBatchWriter (batchwriter_test.go)
+// BatchWriter is threadsafe: AddRow can be called concurrently (e.g. by
+// go routines reading different source tables), and calls to AddRow
+// block while Flush is active.  See ExampleBatchWriter (batchwriter_test.go)
 // for sample usage code.
 type BatchWriter struct {
+	lock       sync.Mutex                 // Serializes calls to AddRow and Flush.
 	rows       []*row                     // Buffered rows.
 	rBytes     int64                      // Estimate of bytes for buffered rows.
 	rCount     int64                      // Mutation count for buffered rows.
@@ -59,13 +78,18 @@ type BatchWriter struct {
 	bytesLimit int64                      // Limit on bytes buffered. AddRow blocks if rBytes exceeded this value.
 	retryLimit int64                      // Limit on retries.
 	verbose    bool                       // If true, print out messages about each write batch.
+	writeMode  WriteMode                  // Kind of mutation used to write rows.
+	checkpoint *Checkpoint                // Records rows written; can be nil.
 	async      asyncState
 }
 
 type row struct {
-	table string
-	cols  []string
-	vals  []interface{}
+	table  string
+	cols   []string
+	vals   []interface{}
+	stream string   // Table, or chunk of table, that the row belongs to (see Checkpoint).
+	pos    int64    // Position of row in stream (only set if checkpointing).
+	key    []string // Primary key of row (only set if checkpointing).
 }
 
 // Fields in this struct are modified asynchronously e.g. by go routines writing
@@ -92,6 +116,8 @@ type BatchWriterConfig struct {
 	RetryLimit int64                      // Limit on retries.
 	Write      func([]*sp.Mutation) error // Function to call to write to Spanner (typically a closure that calls client.Apply).
 	Verbose    bool                       // If true, print out messages about each write batch.
+	WriteMode  WriteMode                  // Kind of mutation used to write rows (defaults to Insert).
+	Checkpoint *Checkpoint                // If not nil, records rows processed and skips rows it has already recorded.
 }
 
 // NewBatchWriter returns a new BatchWriter with parameters defined by config.
@@ -102,6 +128,8 @@ func NewBatchWriter(config BatchWriterConfig) *BatchWriter {
 		bytesLimit: config.BytesLimit,
 		retryLimit: config.RetryLimit,
 		verbose:    config.Verbose,
+		writeMode:  config.WriteMode,
+		checkpoint: config.Checkpoint,
 		async: asyncState{
 			errors:      make(map[string]int64),
 			droppedRows: make(map[string]int64),
@@ -112,9 +140,31 @@ func NewBatchWriter(config BatchWriterConfig) *BatchWriter {
 // AddRow appends a new row of data to bw's buffer of rows. Depending on the
 // state of BatchWriter, AddRow may immediately return, or it may initiate writes,
 // or it may block (waiting for some of the writes already in progress to
-// complete) and then initiate writes.
+// complete) and then initiate writes. If bw has a checkpoint that
+// records the row as already written, AddRow does nothing.
 func (bw *BatchWriter) AddRow(table string, cols []string, vals []interface{}) {
-	r := &row{table, cols, vals}
+	bw.addRow(table, table, cols, vals)
+}
+
+// AddChunkRow is like AddRow, for a row from a chunk of a table that is
+// added in several chunks, possibly concurrently. Rows of each chunk
+// must be added in a consistent order, and bw's checkpoint tracks the
+// rows of each chunk separately.
+func (bw *BatchWriter) AddChunkRow(table string, chunk int, cols []string, vals []interface{}) {
+	bw.addRow(chunkStream(table, chunk), table, cols, vals)
+}
+
+func (bw *BatchWriter) addRow(stream, table string, cols []string, vals []interface{}) {
+	bw.lock.Lock()
+	defer bw.lock.Unlock()
+	r := &row{table: table, cols: cols, vals: vals, stream: stream}
+	if bw.checkpoint != nil {
+		var skip bool
+		r.pos, r.key, skip = bw.checkpoint.add(stream, table, cols, vals)
+		if skip {
+			return
+		}
+	}
 	bw.rows = append(bw.rows, r)
 	bw.rBytes += byteSize(r)
 	bw.rCount += int64(len(r.cols))
@@ -122,8 +172,10 @@ func (bw *BatchWriter) AddRow(table string, cols []string, vals []interface{}) {
 }
 
 // Flush initiates writes to Spanner of all buffered rows of data, and waits
-// for them to complete.
+// for them to complete. If bw has a checkpoint, Flush then saves it.
 func (bw *BatchWriter) Flush() {
+	bw.lock.Lock()
+	defer bw.lock.Unlock()
 	for len(bw.rows) > 0 {
 		if atomic.LoadInt64(&bw.async.writes) < bw.writeLimit {
 			m, count, bytes := bw.getBatch()
@@ -137,6 +189,10 @@ func (bw *BatchWriter) Flush() {
 		}
 	}
 	bw.wg.Wait()
+	if bw.checkpoint != nil {
+		// Errors are reported by the final call of Checkpoint.Save.
+		bw.checkpoint.Save()
+	}
 }
 
 // DroppedRowsByTable returns a map of tables to counts of dropped rows.
@@ -248,7 +304,7 @@ func (bw *BatchWriter) errorStats(rows []*row, err error, retry bool) {
 func (bw *BatchWriter) doWriteAndHandleErrors(rows []*row) {
 	var m []*sp.Mutation
 	for _, x := range rows {
-		m = append(m, sp.Insert(x.table, x.cols, x.vals))
+		m = append(m, bw.mutation(x))
 	}
 	if err := bw.write(m); err != nil {
 		hitRetryLimit := atomic.LoadInt64(&bw.async.retries) >= bw.retryLimit
@@ -258,6 +314,9 @@ func (bw *BatchWriter) doWriteAndHandleErrors(rows []*row) {
 			if hitRetryLimit && bw.verbose {
 				fmt.Printf("Have hit %d retries: will not do any more\n", atomic.LoadInt64(&bw.async.retries))
 			}
+			if bw.checkpoint != nil {
+				bw.checkpoint.processed(rows, true)
+			}
 			return
 		}
 		// Split into 10 pieces and retry. This is useful
@@ -276,6 +335,22 @@ func (bw *BatchWriter) doWriteAndHandleErrors(rows []*row) {
 			atomic.AddInt64(&bw.async.retries, 1)
 			bw.doWriteAndHandleErrors(rows[i:min(i+k, len(rows))])
 		}
+		return
+	}
+	if bw.checkpoint != nil {
+		bw.checkpoint.processed(rows, false)
+	}
+}
+
+// mutation returns a mutation that writes r, using bw's write mode.
+func (bw *BatchWriter) mutation(r *row) *sp.Mutation {
+	switch bw.writeMode {
+	case InsertOrUpdate:
+		return sp.InsertOrUpdate(r.table, r.cols, r.vals)
+	case Replace:
+		return sp.Replace(r.table, r.cols, r.vals)
+	default:
+		return sp.Insert(r.table, r.cols, r.vals)
 	}
 }
 
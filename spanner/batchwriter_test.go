@@ -109,8 +109,8 @@ func TestSampleBadRows(t *testing.T) {
 	bw := NewBatchWriter(BatchWriterConfig{})
 	bw.async.lock.Lock()
 	bw.async.sampleBadRows = []*row{
-		&row{"test", []string{"col1", "col2"}, []interface{}{"a", int64(42)}},
-		&row{"test", []string{"col1", "col2"}, []interface{}{"b", int64(6)}},
+		&row{table: "test", cols: []string{"col1", "col2"}, vals: []interface{}{"a", int64(42)}},
+		&row{table: "test", cols: []string{"col1", "col2"}, vals: []interface{}{"b", int64(6)}},
 	}
 	bw.async.lock.Unlock()
 	l := bw.SampleBadRows(1)
@@ -129,6 +129,65 @@ func TestErrors(t *testing.T) {
 	assert.Equal(t, int64(42), m["error string 2"])
 }
 
+func TestAddRow_Concurrent(t *testing.T) {
+	data, _ := generateRows(8000, 5)
+	mutex := &sync.Mutex{}
+	var rowsWritten []*sp.Mutation
+	bw := NewBatchWriter(BatchWriterConfig{
+		WriteLimit: 5,
+		BytesLimit: 100 << 20,
+		RetryLimit: 1000,
+		Write: func(m []*sp.Mutation) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			rowsWritten = append(rowsWritten, m...)
+			return nil
+		},
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(rows []*row) {
+			defer wg.Done()
+			for _, x := range rows {
+				bw.AddRow(x.table, x.cols, x.vals)
+			}
+		}(data[i*1000 : (i+1)*1000])
+	}
+	wg.Wait()
+	bw.Flush()
+	equalMutations(t, toMutations(data), rowsWritten, "Concurrent AddRow")
+}
+
+func TestWriteMode(t *testing.T) {
+	cols := []string{"id"}
+	vals := []interface{}{int64(1)}
+	tests := []struct {
+		mode     WriteMode
+		expected *sp.Mutation
+	}{
+		{"", sp.Insert("t", cols, vals)},
+		{Insert, sp.Insert("t", cols, vals)},
+		{InsertOrUpdate, sp.InsertOrUpdate("t", cols, vals)},
+		{Replace, sp.Replace("t", cols, vals)},
+	}
+	for _, tc := range tests {
+		var written []*sp.Mutation
+		bw := NewBatchWriter(BatchWriterConfig{
+			WriteLimit: 1,
+			BytesLimit: 100 << 20,
+			WriteMode:  tc.mode,
+			Write: func(m []*sp.Mutation) error {
+				written = append(written, m...)
+				return nil
+			},
+		})
+		bw.AddRow("t", cols, vals)
+		bw.Flush()
+		equalMutations(t, []*sp.Mutation{tc.expected}, written, string(tc.mode))
+	}
+}
+
 func ExampleBatchWriter() {
 	write := func(m []*sp.Mutation) error {
 		var err error
@@ -164,7 +223,7 @@ func generateRows(count int, size int) ([]*row, int) {
 	for i := 0; i < count; i++ {
 		// vals[0] serves as a unique id for each row.
 		vals := []interface{}{i, val}
-		r = append(r, &row{"table", cols, vals})
+		r = append(r, &row{table: "table", cols: cols, vals: vals})
 	}
 	// Find the max number of rows in a write for the (fixed sized)
 	// rows generated in this test data.
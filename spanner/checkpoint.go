@@ -0,0 +1,378 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// Checkpoint records which rows of each table have been processed
+// (written to Spanner, or dropped because they couldn't be written), so
+// that an interrupted data migration can be resumed.
+// Drivers read tables in primary key order, and rows are tracked as
+// streams: the rows passed to BatchWriter.AddRow for a table, or the
+// rows of one chunk of a table passed to BatchWriter.AddChunkRow
+// (named "table#chunk"). For each stream, Checkpoint records how many
+// rows from its start have been processed, how many of these were
+// dropped, and the primary key of the last of them. When resuming,
+// drivers that can seek to a key read the rows after this key (see
+// Seek). For other sources, Checkpoint skips the rows recorded as
+// processed, which relies on the source returning rows in the same
+// order each time. Dropped rows aren't retried (they have already been
+// reported), but are counted by EarlierDroppedRows. Checkpoint is
+// threadsafe.
+//
+// Rows are written in batches that complete out of order, so rows
+// after the first unprocessed row of a stream may have been written
+// too. These rows are written again when resuming, so resumed
+// migrations must use InsertOrUpdate (or Replace) mutations.
+//
+// Progress is saved to a JSON file as rows are processed, at most once
+// every saveInterval, and by Save (which BatchWriter.Flush calls).
+// An interrupted migration loses at most the progress of the last
+// saveInterval.
+type Checkpoint struct {
+	file   string
+	schema ddl.Schema
+
+	lock           sync.Mutex                  // Protects fields below.
+	tables         map[string]*tableCheckpoint // Progress for each stream.
+	pending        map[string][]writtenRange   // Rows processed after the first unprocessed row of each stream.
+	next           map[string]int64            // Position of next row added for each stream.
+	skipped        int64                       // Number of rows skipped because they were already processed.
+	earlierDropped int64                       // Number of rows dropped by earlier runs.
+	mismatched     map[string]bool             // Streams whose row order differs from the checkpoint.
+	changed        bool                        // Whether progress has changed since it was last copied for saving.
+	saved          time.Time                   // When progress was last copied for saving.
+	gen            int64                       // Number of times progress was copied for saving.
+
+	saveLock sync.Mutex // Serializes writes of file, and protects fields below.
+	savedGen int64      // Generation of the progress in file.
+	err      error      // First error saving progress.
+}
+
+// saveInterval is the minimum time between saves of progress as rows
+// are processed.
+var saveInterval = 10 * time.Second
+
+type tableCheckpoint struct {
+	Rows    int64    `json:"rows"`              // Number of rows processed, from the start of the stream.
+	Dropped int64    `json:"dropped,omitempty"` // Number of these rows that were dropped.
+	LastKey []string `json:"last_key"`          // Primary key of the last of these rows (nil if unknown).
+}
+
+// writtenRange describes rows [Start, End) of a stream, which have been
+// processed: written to Spanner, or dropped.
+type writtenRange struct {
+	Start   int64
+	End     int64
+	Dropped int64    // Number of the rows that were dropped.
+	LastKey []string // Primary key of row End-1.
+}
+
+// NewCheckpoint returns a Checkpoint for tables in schema that saves
+// progress to file. Any existing progress in file is discarded.
+func NewCheckpoint(file string, schema ddl.Schema) *Checkpoint {
+	return &Checkpoint{
+		file:       file,
+		schema:     schema,
+		tables:     make(map[string]*tableCheckpoint),
+		pending:    make(map[string][]writtenRange),
+		next:       make(map[string]int64),
+		mismatched: make(map[string]bool),
+		changed:    true, // So that the first save creates file.
+	}
+}
+
+// LoadCheckpoint returns a Checkpoint for tables in schema that
+// resumes from the progress saved in file. Rows recorded as processed
+// in file are skipped by BatchWriter, or not read at all by drivers
+// that use Seek.
+func LoadCheckpoint(file string, schema ddl.Schema) (*Checkpoint, error) {
+	c := NewCheckpoint(file, schema)
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("can't read checkpoint file: %w", err)
+	}
+	var saved struct {
+		Tables map[string]*tableCheckpoint `json:"tables"`
+	}
+	if err := json.Unmarshal(b, &saved); err != nil {
+		return nil, fmt.Errorf("can't parse checkpoint file %s: %w", file, err)
+	}
+	for s, tc := range saved.Tables {
+		if _, ok := schema[streamTable(s)]; !ok {
+			return nil, fmt.Errorf("checkpoint file %s has table %s, which isn't in the schema", file, streamTable(s))
+		}
+		c.tables[s] = tc
+		c.earlierDropped += tc.Dropped
+	}
+	return c, nil
+}
+
+// Seek returns the primary key of the last row of table (or of chunk
+// of table, if chunk isn't negative) recorded as processed, and the
+// number of rows before it recorded as written (not dropped), so that
+// a driver can resume reading the table (or chunk) after this key. The key is returned
+// as strings (see key). It returns nil if there is no such row. Seek
+// must be called before rows of the table (or chunk) are added, and
+// the driver must then only add rows after the key.
+func (c *Checkpoint) Seek(table string, chunk int) ([]string, int64) {
+	stream := table
+	if chunk >= 0 {
+		stream = chunkStream(table, chunk)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	tc, ok := c.tables[stream]
+	if !ok || len(tc.LastKey) == 0 || c.next[stream] > 0 {
+		return nil, 0
+	}
+	c.next[stream] = tc.Rows
+	c.skipped += tc.Rows
+	return tc.LastKey, tc.Rows - tc.Dropped
+}
+
+// SkippedRows returns the number of rows that were skipped because
+// the checkpoint recorded them as already processed.
+func (c *Checkpoint) SkippedRows() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.skipped
+}
+
+// EarlierDroppedRows returns the number of rows that earlier runs
+// dropped because they couldn't be written. These rows are skipped,
+// not retried.
+func (c *Checkpoint) EarlierDroppedRows() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.earlierDropped
+}
+
+// Mismatched returns the tables whose rows weren't in the order
+// recorded by the checkpoint. For these tables, rows after the first
+// mismatch are written regardless of the checkpoint.
+func (c *Checkpoint) Mismatched() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m := make(map[string]bool)
+	for s := range c.mismatched {
+		m[streamTable(s)] = true
+	}
+	var l []string
+	for t := range m {
+		l = append(l, t)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Save saves progress to c's file. It returns an error if this or
+// any earlier save failed.
+func (c *Checkpoint) Save() error {
+	c.lock.Lock()
+	tables, gen := c.progress()
+	c.lock.Unlock()
+	return c.save(tables, gen)
+}
+
+// add assigns a position in stream to a new row of table with the
+// given cols and vals. It returns the position, the row's primary key,
+// and whether the row has already been written (and so should be
+// skipped).
+func (c *Checkpoint) add(stream, table string, cols []string, vals []interface{}) (int64, []string, bool) {
+	key := c.key(table, cols, vals)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	pos := c.next[stream]
+	c.next[stream]++
+	tc, ok := c.tables[stream]
+	if !ok || pos >= tc.Rows {
+		return pos, key, false
+	}
+	if pos == tc.Rows-1 && !equal(key, tc.LastKey) {
+		// The source returned rows in a different order from the
+		// run that wrote the checkpoint, so we can't tell which rows
+		// have been processed. Write this and all later rows of the
+		// stream (rows that already exist are overwritten).
+		c.mismatched[stream] = true
+		c.changed = true
+		tc.Rows, tc.LastKey = pos, nil
+		if tc.Dropped > pos {
+			tc.Dropped = pos
+		}
+		return pos, key, false
+	}
+	c.skipped++
+	return pos, key, true
+}
+
+// processed records that rows have been written to Spanner, or
+// dropped if dropped is set. It saves progress if saveInterval has
+// passed since progress was last saved.
+func (c *Checkpoint) processed(rows []*row, dropped bool) {
+	c.lock.Lock()
+	for i := 0; i < len(rows); {
+		// Rows of a batch are in the order they were added, so we
+		// can record runs of consecutive rows of a stream at once.
+		r := rows[i]
+		j := i + 1
+		for j < len(rows) && rows[j].stream == r.stream && rows[j].pos == rows[j-1].pos+1 {
+			j++
+		}
+		wr := writtenRange{Start: r.pos, End: rows[j-1].pos + 1, LastKey: rows[j-1].key}
+		if dropped {
+			wr.Dropped = wr.End - wr.Start
+		}
+		c.insert(r.stream, wr)
+		i = j
+	}
+	if time.Since(c.saved) < saveInterval {
+		c.lock.Unlock()
+		return
+	}
+	tables, gen := c.progress()
+	c.lock.Unlock()
+	c.save(tables, gen)
+}
+
+// insert adds range r to the rows of stream that have been processed.
+// If this extends the rows processed from the start of stream, they
+// are recorded in c.tables; other ranges are kept (merged with
+// adjacent ranges) in c.pending until the rows before them are
+// processed.
+func (c *Checkpoint) insert(stream string, r writtenRange) {
+	c.changed = true
+	tc, ok := c.tables[stream]
+	if !ok {
+		tc = &tableCheckpoint{}
+		c.tables[stream] = tc
+	}
+	l := c.pending[stream]
+	i := sort.Search(len(l), func(i int) bool { return l[i].Start >= r.Start })
+	l = append(l, writtenRange{})
+	copy(l[i+1:], l[i:])
+	l[i] = r
+	// Merge with the following range, then the preceding range.
+	if i+1 < len(l) && l[i].End >= l[i+1].Start {
+		l[i].End, l[i].LastKey = l[i+1].End, l[i+1].LastKey
+		l[i].Dropped += l[i+1].Dropped
+		l = append(l[:i+1], l[i+2:]...)
+	}
+	if i > 0 && l[i-1].End >= l[i].Start {
+		l[i-1].End, l[i-1].LastKey = l[i].End, l[i].LastKey
+		l[i-1].Dropped += l[i].Dropped
+		l = append(l[:i], l[i+1:]...)
+	}
+	if l[0].Start <= tc.Rows && l[0].End > tc.Rows {
+		tc.Rows, tc.LastKey = l[0].End, l[0].LastKey
+		tc.Dropped += l[0].Dropped
+		l = l[1:]
+	}
+	c.pending[stream] = l
+}
+
+// progress returns a copy of the progress for each stream, and its
+// generation, for save. The generation only increases if progress has
+// changed. c.lock must be held.
+func (c *Checkpoint) progress() (map[string]tableCheckpoint, int64) {
+	c.saved = time.Now()
+	if c.changed {
+		c.gen++
+		c.changed = false
+	}
+	tables := make(map[string]tableCheckpoint, len(c.tables))
+	for s, tc := range c.tables {
+		tables[s] = *tc
+	}
+	return tables, c.gen
+}
+
+// save writes progress tables of generation gen to c's file, unless a
+// later generation has already been written. It's called without
+// c.lock held, so that adding rows isn't blocked by file writes. To
+// avoid leaving a partially written file, it writes a temporary file
+// and renames it. It returns an error if this or any earlier save
+// failed.
+func (c *Checkpoint) save(tables map[string]tableCheckpoint, gen int64) error {
+	c.saveLock.Lock()
+	defer c.saveLock.Unlock()
+	if gen <= c.savedGen {
+		return c.err
+	}
+	c.savedGen = gen
+	b, err := json.MarshalIndent(struct {
+		Tables map[string]tableCheckpoint `json:"tables"`
+	}{tables}, "", "  ")
+	if err == nil {
+		tmp := c.file + ".tmp"
+		if err = ioutil.WriteFile(tmp, b, 0644); err == nil {
+			err = os.Rename(tmp, c.file)
+		}
+	}
+	if err != nil && c.err == nil {
+		c.err = fmt.Errorf("can't save checkpoint: %w", err)
+	}
+	return c.err
+}
+
+// key returns the primary key of a row of table, formatted as strings.
+func (c *Checkpoint) key(table string, cols []string, vals []interface{}) []string {
+	var key []string
+	for _, k := range c.schema[table].Pks {
+		for i, col := range cols {
+			if col == k.Col && i < len(vals) {
+				key = append(key, fmt.Sprint(vals[i]))
+				break
+			}
+		}
+	}
+	return key
+}
+
+// chunkStream returns the name of the stream for a chunk of table.
+func chunkStream(table string, chunk int) string {
+	return fmt.Sprintf("%s#%d", table, chunk)
+}
+
+// streamTable returns the table of stream.
+func streamTable(stream string) string {
+	if i := strings.LastIndex(stream, "#"); i >= 0 {
+		return stream[:i]
+	}
+	return stream
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,290 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spanner
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func checkpointSchema() ddl.Schema {
+	return ddl.Schema{
+		"t": ddl.CreateTable{
+			Name:     "t",
+			ColNames: []string{"id", "s"},
+			Pks:      []ddl.IndexKey{{Col: "id"}},
+		},
+	}
+}
+
+// migrate writes rows with the given ids to table t via a BatchWriter
+// that uses c, failing writes of row bad. It returns the ids written.
+func migrate(c *Checkpoint, ids []int64, bad int64) []int64 {
+	var mutex sync.Mutex
+	var written []int64
+	bw := NewBatchWriter(BatchWriterConfig{
+		WriteLimit: 1,
+		BytesLimit: 100 << 20,
+		RetryLimit: 1000,
+		Checkpoint: c,
+		Write: func(m []*sp.Mutation) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			var l []int64
+			for _, x := range m {
+				id := mutationID(x)
+				if id == bad {
+					return errors.New("bad data")
+				}
+				l = append(l, id)
+			}
+			written = append(written, l...)
+			return nil
+		},
+	})
+	for _, id := range ids {
+		bw.AddRow("t", []string{"id", "s"}, []interface{}{id, "x"})
+	}
+	bw.Flush()
+	return written
+}
+
+// mutationID returns the id of a row written by migrate. Mutations are
+// opaque, so we compare their string forms (as equalMutations does).
+func mutationID(m *sp.Mutation) int64 {
+	for id := int64(0); id < 10; id++ {
+		if fmt.Sprintf("%+v", m) == fmt.Sprintf("%+v", sp.Insert("t", []string{"id", "s"}, []interface{}{id, "x"})) {
+			return id
+		}
+	}
+	return -1
+}
+
+func TestCheckpoint_Resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "checkpoint.json")
+	ids := []int64{1, 2, 3, 4, 5, 6}
+
+	c := NewCheckpoint(file, checkpointSchema())
+	assert.ElementsMatch(t, []int64{1, 2, 3, 4}, migrate(c, ids[:4], -1))
+	assert.Equal(t, &tableCheckpoint{Rows: 4, LastKey: []string{"4"}}, c.tables["t"])
+
+	// Progress is saved by Flush. Resuming writes the rows after it.
+	c, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{5, 6}, migrate(c, ids, -1))
+	assert.Equal(t, int64(4), c.SkippedRows())
+	assert.Equal(t, int64(0), c.EarlierDroppedRows())
+	assert.Nil(t, c.Mismatched())
+	assert.Nil(t, c.Save())
+
+	// Everything is written, so resuming again writes nothing.
+	c, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	assert.Nil(t, migrate(c, ids, -1))
+	assert.Equal(t, int64(6), c.SkippedRows())
+}
+
+func TestCheckpoint_Dropped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "checkpoint.json")
+	ids := []int64{1, 2, 3, 4, 5, 6}
+
+	// Row 3 is dropped, but recorded as processed, so progress isn't
+	// held up by it.
+	c := NewCheckpoint(file, checkpointSchema())
+	assert.ElementsMatch(t, []int64{1, 2, 4, 5, 6}, migrate(c, ids, 3))
+	assert.Equal(t, &tableCheckpoint{Rows: 6, Dropped: 1, LastKey: []string{"6"}}, c.tables["t"])
+	assert.Empty(t, c.pending["t"])
+
+	// Resuming doesn't retry the dropped row, but reports it.
+	c, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	assert.Nil(t, migrate(c, ids, -1))
+	assert.Equal(t, int64(6), c.SkippedRows())
+	assert.Equal(t, int64(1), c.EarlierDroppedRows())
+
+	// Seek counts only the rows written before the key.
+	c, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	key, rows := c.Seek("t", -1)
+	assert.Equal(t, []string{"6"}, key)
+	assert.Equal(t, int64(5), rows)
+}
+
+func TestCheckpoint_SaveInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "checkpoint.json")
+	defer func(d time.Duration) { saveInterval = d }(saveInterval)
+	saveInterval = time.Hour
+
+	// Progress is saved when the first rows are processed, and then
+	// not until saveInterval has passed (or Save is called).
+	c := NewCheckpoint(file, checkpointSchema())
+	c.processed([]*row{{stream: "t", pos: 0, key: []string{"1"}}}, false)
+	c.processed([]*row{{stream: "t", pos: 1, key: []string{"2"}}}, false)
+	saved, err := LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	assert.Equal(t, &tableCheckpoint{Rows: 1, LastKey: []string{"1"}}, saved.tables["t"])
+	assert.Nil(t, c.Save())
+	saved, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	assert.Equal(t, &tableCheckpoint{Rows: 2, LastKey: []string{"2"}}, saved.tables["t"])
+
+	// Saves of older progress don't overwrite newer progress.
+	c.processed([]*row{{stream: "t", pos: 2, key: []string{"3"}}}, false)
+	c.lock.Lock()
+	tables, gen := c.progress()
+	c.lock.Unlock()
+	c.processed([]*row{{stream: "t", pos: 3, key: []string{"4"}}}, false)
+	assert.Nil(t, c.Save())
+	assert.Nil(t, c.save(tables, gen))
+	saved, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	assert.Equal(t, &tableCheckpoint{Rows: 4, LastKey: []string{"4"}}, saved.tables["t"])
+}
+
+func TestCheckpoint_Seek(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "checkpoint.json")
+
+	c := NewCheckpoint(file, checkpointSchema())
+	migrate(c, []int64{1, 2}, -1)
+	c, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	key, rows := c.Seek("t", -1)
+	assert.Equal(t, []string{"2"}, key)
+	assert.Equal(t, int64(2), rows)
+	key, _ = c.Seek("t", -1) // Only the first Seek of a table seeks.
+	assert.Nil(t, key)
+	key, _ = c.Seek("t", 0) // No rows of this chunk were written.
+	assert.Nil(t, key)
+
+	// The driver reads rows after the key.
+	assert.Equal(t, []int64{3, 4}, migrate(c, []int64{3, 4}, -1))
+	assert.Equal(t, &tableCheckpoint{Rows: 4, LastKey: []string{"4"}}, c.tables["t"])
+	assert.Equal(t, int64(2), c.SkippedRows())
+
+	// Tables can't be seeked once rows have been added.
+	c, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	migrate(c, []int64{1}, -1)
+	key, _ = c.Seek("t", -1)
+	assert.Nil(t, key)
+}
+
+func TestCheckpoint_Mismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "checkpoint.json")
+
+	c := NewCheckpoint(file, checkpointSchema())
+	migrate(c, []int64{1, 2, 3}, -1)
+	assert.Nil(t, c.Save())
+
+	// Rows come back in a different order: the last key of the
+	// written rows doesn't match, so that row and all later rows
+	// are written.
+	c, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2, 4}, migrate(c, []int64{1, 3, 2, 4}, -1))
+	assert.Equal(t, []string{"t"}, c.Mismatched())
+	assert.Equal(t, &tableCheckpoint{Rows: 4, LastKey: []string{"4"}}, c.tables["t"])
+}
+
+func TestLoadCheckpoint_Errors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "checkpoint.json")
+
+	_, err = LoadCheckpoint(file, checkpointSchema())
+	assert.NotNil(t, err) // No such file.
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"tables": {"u": {"rows": 1, "last_key": ["1"]}}}`), 0644))
+	_, err = LoadCheckpoint(file, checkpointSchema())
+	assert.NotNil(t, err) // Unknown table.
+}
+
+func TestCheckpoint_Insert(t *testing.T) {
+	c := NewCheckpoint("unused", checkpointSchema())
+	c.insert("t", writtenRange{Start: 5, End: 7, LastKey: []string{"7"}})
+	c.insert("t", writtenRange{Start: 9, End: 10, LastKey: []string{"10"}})
+	assert.Equal(t, int64(0), c.tables["t"].Rows)
+	assert.Equal(t, 2, len(c.pending["t"]))
+	c.insert("t", writtenRange{Start: 0, End: 2, LastKey: []string{"2"}})
+	assert.Equal(t, &tableCheckpoint{Rows: 2, LastKey: []string{"2"}}, c.tables["t"])
+	assert.Equal(t, 2, len(c.pending["t"]))
+	c.insert("t", writtenRange{Start: 2, End: 5, LastKey: []string{"5"}})
+	assert.Equal(t, &tableCheckpoint{Rows: 7, LastKey: []string{"7"}}, c.tables["t"])
+	assert.Equal(t, []writtenRange{{Start: 9, End: 10, LastKey: []string{"10"}}}, c.pending["t"])
+}
+
+func TestCheckpoint_Chunks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "checkpoint.json")
+	cols := []string{"id", "s"}
+
+	// Rows of each chunk are tracked separately, so chunks can be added
+	// concurrently (here, interleaved).
+	c := NewCheckpoint(file, checkpointSchema())
+	bw := NewBatchWriter(BatchWriterConfig{
+		WriteLimit: 1,
+		BytesLimit: 100 << 20,
+		Checkpoint: c,
+		Write:      func(m []*sp.Mutation) error { return nil },
+	})
+	bw.AddChunkRow("t", 0, cols, []interface{}{int64(1), "x"})
+	bw.AddChunkRow("t", 1, cols, []interface{}{int64(5), "x"})
+	bw.AddChunkRow("t", 0, cols, []interface{}{int64(2), "x"})
+	bw.Flush()
+	assert.Equal(t, &tableCheckpoint{Rows: 2, LastKey: []string{"2"}}, c.tables["t#0"])
+	assert.Equal(t, &tableCheckpoint{Rows: 1, LastKey: []string{"5"}}, c.tables["t#1"])
+
+	c, err = LoadCheckpoint(file, checkpointSchema())
+	assert.Nil(t, err)
+	_, _, skip := c.add(chunkStream("t", 1), "t", cols, []interface{}{int64(5), "x"})
+	assert.True(t, skip)
+	_, _, skip = c.add(chunkStream("t", 1), "t", cols, []interface{}{int64(6), "x"})
+	assert.False(t, skip)
+	key, _ := c.Seek("t", 0)
+	assert.Equal(t, []string{"2"}, key)
+
+	// Chunks of unknown tables are rejected.
+	assert.Nil(t, ioutil.WriteFile(file, []byte(`{"tables": {"u#0": {"rows": 1, "last_key": ["1"]}}}`), 0644))
+	_, err = LoadCheckpoint(file, checkpointSchema())
+	assert.NotNil(t, err)
+}
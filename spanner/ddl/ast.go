@@ -45,13 +45,15 @@ const (
 	Timestamp string = "TIMESTAMP"
 	// Numeric represent NUMERIC type.
 	Numeric string = "NUMERIC"
+	// JSON represent JSON type.
+	JSON string = "JSON"
 	// MaxLength is a sentinel for Type's Len field, representing the MAX value.
 	MaxLength = math.MaxInt64
 )
 
 // Type represents the type of a column.
 //     type:
-//        { BOOL | INT64 | FLOAT64 | STRING( length ) | BYTES( length ) | DATE | TIMESTAMP | NUMERIC }
+//        { BOOL | INT64 | FLOAT64 | STRING( length ) | BYTES( length ) | DATE | TIMESTAMP | NUMERIC | JSON }
 type Type struct {
 	Name string
 	// Len encodes the following Spanner DDL definition:
@@ -63,6 +65,42 @@ type Type struct {
 	IsArray bool
 }
 
+// PGPrintColumnDefType unparses the type encoded in a ColumnDef using
+// the PostgreSQL dialect. Lengths of BYTES types are dropped since
+// bytea has no length.
+func (ty Type) PGPrintColumnDefType() string {
+	var str string
+	switch ty.Name {
+	case Bool:
+		str = "boolean"
+	case Bytes:
+		str = "bytea"
+	case Date:
+		str = "date"
+	case Float64:
+		str = "double precision"
+	case Int64:
+		str = "bigint"
+	case Numeric:
+		str = "numeric"
+	case JSON:
+		str = "jsonb"
+	case String:
+		str = "varchar"
+		if ty.Len != MaxLength {
+			str += "(" + strconv.FormatInt(ty.Len, 10) + ")"
+		}
+	case Timestamp:
+		str = "timestamptz"
+	default:
+		str = ty.Name
+	}
+	if ty.IsArray {
+		str += "[]"
+	}
+	return str
+}
+
 // PrintColumnDefType unparses the type encoded in a ColumnDef.
 func (ty Type) PrintColumnDefType() string {
 	str := ty.Name
@@ -83,37 +121,137 @@ func (ty Type) PrintColumnDefType() string {
 
 // ColumnDef encodes the following DDL definition:
 //     column_def:
-//       column_name type [NOT NULL] [options_def]
+//       column_name type [NOT NULL] [{ DEFAULT ( expression ) | AS ( expression ) STORED }] [options_def]
 type ColumnDef struct {
-	Name    string
-	T       Type
-	NotNull bool
-	Comment string
+	Name      string
+	T         Type
+	NotNull   bool
+	Default   *Default    // Nil if the column has no default value.
+	Generated []ExprToken // Expression of a (stored) generated column; nil for other columns.
+	Comment   string
 }
 
+// Default encodes the default value of a column. We only support
+// constants and the current time, which are printed as expressions of
+// the column's type.
+type Default struct {
+	// Value is a constant, in the form used for literals of the
+	// column's type: true or false for BOOL, a decimal number for
+	// INT64, FLOAT64 and NUMERIC, the string value for STRING, and
+	// RFC 3339 text for DATE and TIMESTAMP (e.g. 2006-01-02 and
+	// 2006-01-02T15:04:05Z).
+	Value string
+	// Now is true if the default is the current timestamp (or the
+	// current date, for DATE columns).
+	Now bool
+}
+
+// PrintDefault unparses the default value expression d of a column of
+// type ty.
+func (d Default) PrintDefault(c Config, ty Type) string {
+	pg := c.Dialect == PostgreSQL
+	if d.Now {
+		switch {
+		case ty.Name == Date && pg:
+			return "CURRENT_DATE"
+		case ty.Name == Date:
+			return "CURRENT_DATE()"
+		case pg:
+			return "CURRENT_TIMESTAMP"
+		default:
+			return "CURRENT_TIMESTAMP()"
+		}
+	}
+	switch ty.Name {
+	case Bool:
+		return strings.ToUpper(d.Value)
+	case Numeric:
+		if pg {
+			return d.Value
+		}
+		// Unquoted decimals are FLOAT64 literals, which don't coerce to
+		// NUMERIC.
+		return "NUMERIC " + c.quoteString(d.Value)
+	case String:
+		return c.quoteString(d.Value)
+	case Date:
+		if pg {
+			return c.quoteString(d.Value) + "::date"
+		}
+		return "DATE " + c.quoteString(d.Value)
+	case Timestamp:
+		if pg {
+			return c.quoteString(d.Value) + "::timestamptz"
+		}
+		return "TIMESTAMP " + c.quoteString(d.Value)
+	default:
+		return d.Value
+	}
+}
+
+// Dialect is the SQL dialect of a Spanner database.
+type Dialect string
+
+const (
+	// GoogleSQL is the default dialect. The zero value of Dialect is
+	// also treated as GoogleSQL.
+	GoogleSQL Dialect = "google_standard_sql"
+	// PostgreSQL is the dialect of Spanner's PostgreSQL interface.
+	PostgreSQL Dialect = "postgresql"
+)
+
 // Config controls how AST nodes are printed (aka unparsed).
 type Config struct {
-	Comments    bool // If true, print comments.
-	ProtectIds  bool // If true, table and col names are quoted using backticks (avoids reserved-word issue).
-	Tables      bool // If true, print tables
-	ForeignKeys bool // If true, print foreign key constraints.
+	Comments    bool    // If true, print comments.
+	ProtectIds  bool    // If true, table and col names are quoted using backticks (double quotes for PostgreSQL) (avoids reserved-word issue).
+	Tables      bool    // If true, print tables
+	ForeignKeys bool    // If true, print foreign key constraints.
+	Dialect     Dialect // Dialect to print DDL in (defaults to GoogleSQL).
 }
 
 func (c Config) quote(s string) string {
 	if c.ProtectIds {
+		if c.Dialect == PostgreSQL {
+			return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+		}
 		return "`" + s + "`"
 	}
 	return s
 }
 
+// quoteString returns s as a string literal.
+func (c Config) quoteString(s string) string {
+	if c.Dialect == PostgreSQL {
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	// GoogleSQL supports the escape sequences generated by strconv.Quote.
+	return strconv.Quote(s)
+}
+
+func (c Config) printType(ty Type) string {
+	if c.Dialect == PostgreSQL {
+		return ty.PGPrintColumnDefType()
+	}
+	return ty.PrintColumnDefType()
+}
+
 // PrintColumnDef unparses ColumnDef and returns it as well as any ColumnDef
 // comment. These are returned as separate strings to support formatting
 // needs of PrintCreateTable.
 func (cd ColumnDef) PrintColumnDef(c Config) (string, string) {
-	s := fmt.Sprintf("%s %s", c.quote(cd.Name), cd.T.PrintColumnDefType())
+	s := fmt.Sprintf("%s %s", c.quote(cd.Name), c.printType(cd.T))
 	if cd.NotNull {
 		s += " NOT NULL"
 	}
+	if cd.Default != nil {
+		s += fmt.Sprintf(" DEFAULT (%s)", cd.Default.PrintDefault(c, cd.T))
+	}
+	if cd.Generated != nil {
+		if c.Dialect == PostgreSQL {
+			s += " GENERATED ALWAYS"
+		}
+		s += fmt.Sprintf(" AS (%s) STORED", PrintExpr(c, cd.Generated))
+	}
 	return s, cd.Comment
 }
 
@@ -161,28 +299,222 @@ func (k Foreignkey) PrintForeignKey(c Config) string {
 	return s + fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s (%s)", strings.Join(cols, ", "), c.quote(k.ReferTable), strings.Join(referCols, ", "))
 }
 
+// CheckConstraint encodes the following DDL definition:
+//     [ CONSTRAINT constraint_name ] CHECK ( expression )
+type CheckConstraint struct {
+	Name string
+	Expr []ExprToken
+}
+
+// PrintCheckConstraint unparses a check constraint.
+func (ck CheckConstraint) PrintCheckConstraint(c Config) string {
+	var s string
+	if ck.Name != "" {
+		s = fmt.Sprintf("CONSTRAINT %s ", c.quote(ck.Name))
+	}
+	return s + fmt.Sprintf("CHECK (%s)", PrintExpr(c, ck.Expr))
+}
+
+// ExprToken is a token of an expression. Column names and string
+// literals are stored unquoted, and are quoted for the dialect when
+// the expression is printed. This keeps expressions independent of
+// the dialect, and makes it easy to rename columns.
+type ExprToken struct {
+	Kind ExprTokenKind
+	Text string
+}
+
+// ExprTokenKind is the kind of an ExprToken.
+type ExprTokenKind int
+
+const (
+	// ExprSymbol is a keyword, operator, punctuation, number or
+	// function name, which is printed as is.
+	ExprSymbol ExprTokenKind = iota
+	// ExprColumn is a column name.
+	ExprColumn
+	// ExprString is the value of a string literal.
+	ExprString
+	// ExprTable is a table or view name (in view queries).
+	ExprTable
+)
+
+// PrintExpr unparses the expression made of tokens e. Expressions are
+// stored in the GoogleSQL dialect, and are translated when printed in
+// the PostgreSQL dialect (see PrintableExpr).
+func PrintExpr(c Config, e []ExprToken) string {
+	if c.Dialect == PostgreSQL {
+		e = pgExpr(e)
+	}
+	var s string
+	for i, t := range e {
+		text := t.Text
+		switch t.Kind {
+		case ExprColumn, ExprTable:
+			text = c.quote(text)
+		case ExprString:
+			text = c.quoteString(text)
+		}
+		// Separate tokens with spaces, except inside parentheses,
+		// before commas and around the dots of qualified names.
+		afterParen := i > 0 && e[i-1].Kind == ExprSymbol && (strings.HasSuffix(e[i-1].Text, "(") || e[i-1].Text == ".")
+		if i > 0 && !afterParen && !(t.Kind == ExprSymbol && (text == ")" || text == "," || text == ".")) {
+			s += " "
+		}
+		s += text
+	}
+	return s
+}
+
+// pgFuncs maps the functions of expressions to their names in the
+// PostgreSQL dialect. CONCAT is translated to the || operator instead,
+// since PostgreSQL's concat ignores NULL arguments.
+var pgFuncs = map[string]string{
+	"ABS":         "ABS",
+	"AVG":         "AVG",
+	"CHAR_LENGTH": "LENGTH",
+	"COALESCE":    "COALESCE",
+	"COUNT":       "COUNT",
+	"GREATEST":    "GREATEST",
+	"IFNULL":      "COALESCE",
+	"LEAST":       "LEAST",
+	"LOWER":       "LOWER",
+	"LTRIM":       "LTRIM",
+	"MAX":         "MAX",
+	"MIN":         "MIN",
+	"NULLIF":      "NULLIF",
+	"RTRIM":       "RTRIM",
+	"SUM":         "SUM",
+	"TRIM":        "BTRIM",
+	"UPPER":       "UPPER",
+}
+
+// PrintableExpr returns whether the expression made of tokens e can be
+// printed in dialect d. Every expression can be printed in the GoogleSQL
+// dialect. In the PostgreSQL dialect, functions without an equivalent
+// (see pgFuncs) can't be printed, and nor can division, which
+// truncates integers in PostgreSQL but not in GoogleSQL.
+func PrintableExpr(d Dialect, e []ExprToken) bool {
+	if d != PostgreSQL {
+		return true
+	}
+	for _, t := range e {
+		if t.Kind != ExprSymbol {
+			continue
+		}
+		if f := strings.TrimSuffix(t.Text, "("); f != t.Text && f != "" && f != "CONCAT" && pgFuncs[f] == "" {
+			return false
+		}
+		if t.Text == "/" {
+			return false
+		}
+	}
+	return true
+}
+
+// pgExpr translates expression e to the PostgreSQL dialect.
+func pgExpr(e []ExprToken) []ExprToken {
+	var out []ExprToken
+	for i := 0; i < len(e); i++ {
+		t := e[i]
+		f := strings.TrimSuffix(t.Text, "(")
+		switch {
+		case t.Kind != ExprSymbol || f == t.Text || f == "":
+			out = append(out, t)
+		case f == "CONCAT":
+			args, end := exprArgs(e, i)
+			out = append(out, ExprToken{Kind: ExprSymbol, Text: "("})
+			for j, a := range args {
+				if j > 0 {
+					out = append(out, ExprToken{Kind: ExprSymbol, Text: "||"})
+				}
+				a = pgExpr(a)
+				if exprSimple(a) {
+					out = append(out, a...)
+					continue
+				}
+				out = append(out, ExprToken{Kind: ExprSymbol, Text: "("})
+				out = append(out, a...)
+				out = append(out, ExprToken{Kind: ExprSymbol, Text: ")"})
+			}
+			out = append(out, ExprToken{Kind: ExprSymbol, Text: ")"})
+			i = end
+		default:
+			if pg, ok := pgFuncs[f]; ok {
+				t.Text = pg + "("
+			}
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// exprArgs returns the arguments of the function call that starts at
+// e[i], and the position of the closing parenthesis of the call.
+func exprArgs(e []ExprToken, i int) ([][]ExprToken, int) {
+	var args [][]ExprToken
+	depth, start := 0, i+1
+	for j := i + 1; j < len(e); j++ {
+		t := e[j]
+		switch {
+		case t.Kind != ExprSymbol:
+		case strings.HasSuffix(t.Text, "("):
+			depth++
+		case t.Text == ")" && depth > 0:
+			depth--
+		case t.Text == ")":
+			return append(args, e[start:j]), j
+		case t.Text == "," && depth == 0:
+			args = append(args, e[start:j])
+			start = j + 1
+		}
+	}
+	return append(args, e[start:]), len(e) - 1
+}
+
+// exprSimple returns whether expression e is a single token, a function
+// call or a parenthesized expression, and so needs no parentheses when
+// used as an operand.
+func exprSimple(e []ExprToken) bool {
+	if len(e) <= 1 {
+		return true
+	}
+	if e[0].Kind != ExprSymbol || !strings.HasSuffix(e[0].Text, "(") {
+		return false
+	}
+	_, end := exprArgs(e, 0)
+	return end == len(e)-1
+}
+
 // CreateTable encodes the following DDL definition:
-//     create_table: CREATE TABLE table_name ([column_def, ...] ) primary_key [, cluster]
+//     create_table: CREATE TABLE table_name ([column_def, ...] [check_constraint, ...] ) primary_key [, cluster]
 type CreateTable struct {
 	Name     string
 	ColNames []string             // Provides names and order of columns
 	ColDefs  map[string]ColumnDef // Provides definition of columns (a map for simpler/faster lookup during type processing)
 	Pks      []IndexKey
 	Fks      []Foreignkey
+	Checks   []CheckConstraint
 	Indexes  []CreateIndex
 	Parent   string //if not empty, this table will be interleaved
 	Comment  string
 }
 
-// PrintCreateTable unparses a CREATE TABLE statement.
+// PrintCreateTable unparses a CREATE TABLE statement. For the
+// PostgreSQL dialect, the primary key is printed as part of the table
+// definition and key order is dropped (PostgreSQL-dialect primary keys
+// are always ascending).
 func (ct CreateTable) PrintCreateTable(config Config) string {
+	if config.Dialect == PostgreSQL {
+		return ct.pgPrintCreateTable(config)
+	}
 	var col []string
 	var colComment []string
 	var keys []string
 	for i, cn := range ct.ColNames {
 		s, c := ct.ColDefs[cn].PrintColumnDef(config)
 		s = "\n    " + s
-		if i < len(ct.ColNames)-1 {
+		if i < len(ct.ColNames)-1 || len(ct.Checks) > 0 {
 			s += ","
 		} else {
 			s += " "
@@ -198,6 +530,12 @@ func (ct CreateTable) PrintCreateTable(config Config) string {
 			cols += strings.Repeat(" ", n-len(c)) + " -- " + colComment[i]
 		}
 	}
+	for i, ck := range ct.Checks {
+		cols += "\n    " + ck.PrintCheckConstraint(config)
+		if i < len(ct.Checks)-1 {
+			cols += ","
+		}
+	}
 	for _, p := range ct.Pks {
 		keys = append(keys, p.PrintIndexKey(config))
 	}
@@ -212,6 +550,40 @@ func (ct CreateTable) PrintCreateTable(config Config) string {
 	return fmt.Sprintf("%sCREATE TABLE %s (%s\n) PRIMARY KEY (%s)%s", tableComment, config.quote(ct.Name), cols, strings.Join(keys, ", "), interleave)
 }
 
+func (ct CreateTable) pgPrintCreateTable(config Config) string {
+	var col []string
+	var colComment []string
+	for _, cn := range ct.ColNames {
+		s, c := ct.ColDefs[cn].PrintColumnDef(config)
+		col = append(col, "\n    "+s+",")
+		colComment = append(colComment, c)
+	}
+	n := maxStringLength(col)
+	var cols string
+	for i, c := range col {
+		cols += c
+		if config.Comments && len(colComment[i]) > 0 {
+			cols += strings.Repeat(" ", n-len(c)) + " -- " + colComment[i]
+		}
+	}
+	for _, ck := range ct.Checks {
+		cols += "\n    " + ck.PrintCheckConstraint(config) + ","
+	}
+	var keys []string
+	for _, p := range ct.Pks {
+		keys = append(keys, config.quote(p.Col))
+	}
+	var tableComment string
+	if config.Comments && len(ct.Comment) > 0 {
+		tableComment = "--\n-- " + ct.Comment + "\n--\n"
+	}
+	var interleave string
+	if ct.Parent != "" {
+		interleave = " INTERLEAVE IN PARENT " + config.quote(ct.Parent)
+	}
+	return fmt.Sprintf("%sCREATE TABLE %s (%s\n    PRIMARY KEY (%s)\n)%s", tableComment, config.quote(ct.Name), cols, strings.Join(keys, ", "), interleave)
+}
+
 // CreateIndex encodes the following DDL definition:
 //     create index: CREATE [UNIQUE] [NULL_FILTERED] INDEX index_name ON table_name ( key_part [, ...] ) [ storing_clause ] [ , interleave_clause ]
 type CreateIndex struct {
@@ -250,6 +622,69 @@ func (k Foreignkey) PrintForeignKeyAlterTable(c Config, tableName string) string
 	return fmt.Sprintf("ALTER TABLE %s ADD %sFOREIGN KEY (%s) REFERENCES %s (%s)", c.quote(tableName), s, strings.Join(cols, ", "), c.quote(k.ReferTable), strings.Join(referCols, ", "))
 }
 
+// CreateView encodes the following DDL definition:
+//     create view: CREATE VIEW view_name SQL SECURITY INVOKER AS query
+type CreateView struct {
+	Name    string
+	Query   []ExprToken
+	Comment string
+}
+
+// PrintCreateView unparses a CREATE VIEW statement. Spanner requires
+// views to use invoker's rights, so we always print SQL SECURITY INVOKER.
+func (cv CreateView) PrintCreateView(c Config) string {
+	var comment string
+	if c.Comments && len(cv.Comment) > 0 {
+		comment = "--\n-- " + cv.Comment + "\n--\n"
+	}
+	return fmt.Sprintf("%sCREATE VIEW %s SQL SECURITY INVOKER AS %s", comment, c.quote(cv.Name), PrintExpr(c, cv.Query))
+}
+
+// Views maps Spanner view name to view definition.
+type Views map[string]CreateView
+
+// GetDDL returns the CREATE VIEW statements for the views in v. Views
+// are printed in alphabetical order, except that views that use other
+// views must appear after them. Views are printed separately from
+// tables (see Schema.GetDDL) because they have to be created after the
+// tables they use.
+func (v Views) GetDDL(c Config) []string {
+	var names []string
+	for n := range v {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var ddl []string
+	printed := make(map[string]bool)
+	for len(names) > 0 {
+		var rest []string
+		for _, n := range names {
+			ready := true
+			for _, t := range v[n].Query {
+				if _, isView := v[t.Text]; t.Kind == ExprTable && isView && t.Text != n && !printed[t.Text] {
+					ready = false
+				}
+			}
+			if ready {
+				ddl = append(ddl, v[n].PrintCreateView(c))
+				printed[n] = true
+			} else {
+				rest = append(rest, n)
+			}
+		}
+		if len(rest) == len(names) {
+			// Views can't have cycles, but don't loop forever if
+			// they somehow do.
+			for _, n := range rest {
+				ddl = append(ddl, v[n].PrintCreateView(c))
+			}
+			break
+		}
+		names = rest
+	}
+	return ddl
+}
+
 type Schema map[string]CreateTable
 
 func NewSchema() Schema {
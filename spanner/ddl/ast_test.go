@@ -35,12 +35,36 @@ func TestPrintScalarType(t *testing.T) {
 		{Type{Name: Bytes, Len: int64(42)}, "BYTES(42)"},
 		{Type{Name: Date}, "DATE"},
 		{Type{Name: Timestamp}, "TIMESTAMP"},
+		{Type{Name: JSON}, "JSON"},
 	}
 	for _, tc := range tests {
 		assert.Equal(t, normalizeSpace(tc.expected), normalizeSpace(tc.in.PrintColumnDefType()))
 	}
 }
 
+func TestPGPrintScalarType(t *testing.T) {
+	tests := []struct {
+		in       Type
+		expected string
+	}{
+		{Type{Name: Bool}, "boolean"},
+		{Type{Name: Int64}, "bigint"},
+		{Type{Name: Float64}, "double precision"},
+		{Type{Name: String, Len: MaxLength}, "varchar"},
+		{Type{Name: String, Len: int64(42)}, "varchar(42)"},
+		{Type{Name: Bytes, Len: MaxLength}, "bytea"},
+		{Type{Name: Bytes, Len: int64(42)}, "bytea"},
+		{Type{Name: Date}, "date"},
+		{Type{Name: Timestamp}, "timestamptz"},
+		{Type{Name: Numeric}, "numeric"},
+		{Type{Name: JSON}, "jsonb"},
+		{Type{Name: Int64, IsArray: true}, "bigint[]"},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, normalizeSpace(tc.expected), normalizeSpace(tc.in.PGPrintColumnDefType()))
+	}
+}
+
 func TestPrintColumnDef(t *testing.T) {
 	tests := []struct {
 		in         ColumnDef
@@ -57,6 +81,43 @@ func TestPrintColumnDef(t *testing.T) {
 		s, _ := tc.in.PrintColumnDef(Config{ProtectIds: tc.protectIds})
 		assert.Equal(t, normalizeSpace(tc.expected), normalizeSpace(s))
 	}
+	s, _ := ColumnDef{Name: "my\"col", T: Type{Name: String, Len: 10}, NotNull: true}.PrintColumnDef(Config{ProtectIds: true, Dialect: PostgreSQL})
+	assert.Equal(t, `"my""col" varchar(10) NOT NULL`, s)
+}
+
+func TestPrintColumnDef_Default(t *testing.T) {
+	now := &Default{Now: true}
+	tests := []struct {
+		ty         Type
+		d          *Default
+		googleSQL  string
+		postgreSQL string
+	}{
+		{Type{Name: Bool}, &Default{Value: "true"}, "TRUE", "TRUE"},
+		{Type{Name: Int64}, &Default{Value: "-42"}, "-42", "-42"},
+		{Type{Name: Float64}, &Default{Value: "1.5"}, "1.5", "1.5"},
+		{Type{Name: Numeric}, &Default{Value: "1.5"}, `NUMERIC "1.5"`, "1.5"},
+		{Type{Name: String, Len: MaxLength}, &Default{Value: "it's\n"}, `"it's\n"`, "'it''s\n'"},
+		{Type{Name: Date}, &Default{Value: "2021-06-01"}, `DATE "2021-06-01"`, "'2021-06-01'::date"},
+		{Type{Name: Date}, now, "CURRENT_DATE()", "CURRENT_DATE"},
+		{Type{Name: Timestamp}, &Default{Value: "2021-06-01T10:00:00Z"}, `TIMESTAMP "2021-06-01T10:00:00Z"`, "'2021-06-01T10:00:00Z'::timestamptz"},
+		{Type{Name: Timestamp}, now, "CURRENT_TIMESTAMP()", "CURRENT_TIMESTAMP"},
+	}
+	for _, tc := range tests {
+		cd := ColumnDef{Name: "c", T: tc.ty, NotNull: true, Default: tc.d}
+		s, _ := cd.PrintColumnDef(Config{})
+		assert.Equal(t, "c "+tc.ty.PrintColumnDefType()+" NOT NULL DEFAULT ("+tc.googleSQL+")", s)
+		s, _ = cd.PrintColumnDef(Config{Dialect: PostgreSQL})
+		assert.Equal(t, "c "+tc.ty.PGPrintColumnDefType()+" NOT NULL DEFAULT ("+tc.postgreSQL+")", s)
+	}
+}
+
+func TestPrintColumnDef_Generated(t *testing.T) {
+	cd := ColumnDef{Name: "total", T: Type{Name: Int64}, Generated: []ExprToken{{ExprColumn, "price"}, {ExprSymbol, "*"}, {ExprColumn, "qty"}}}
+	s, _ := cd.PrintColumnDef(Config{})
+	assert.Equal(t, "total INT64 AS (price * qty) STORED", s)
+	s, _ = cd.PrintColumnDef(Config{ProtectIds: true, Dialect: PostgreSQL})
+	assert.Equal(t, `"total" bigint GENERATED ALWAYS AS ("price" * "qty") STORED`, s)
 }
 
 func TestPrintIndexKey(t *testing.T) {
@@ -86,6 +147,7 @@ func TestPrintCreateTable(t *testing.T) {
 		[]IndexKey{{Col: "col1", Desc: true}},
 		nil,
 		nil,
+		nil,
 		"",
 		"",
 	}
@@ -96,6 +158,7 @@ func TestPrintCreateTable(t *testing.T) {
 		[]IndexKey{{Col: "col1", Desc: true}},
 		nil,
 		nil,
+		nil,
 		"parent",
 		"",
 	}
@@ -112,6 +175,69 @@ func TestPrintCreateTable(t *testing.T) {
 	for _, tc := range tests {
 		assert.Equal(t, normalizeSpace(tc.expected), normalizeSpace(tc.ct.PrintCreateTable(Config{ProtectIds: tc.protectIds})))
 	}
+	t1.Checks = []CheckConstraint{
+		{Name: "ck1", Expr: []ExprToken{{ExprColumn, "col1"}, {ExprSymbol, ">"}, {ExprSymbol, "0"}}},
+		{Expr: []ExprToken{{ExprColumn, "col2"}, {ExprSymbol, "IS NOT NULL"}}},
+	}
+	assert.Equal(t, "CREATE TABLE mytable (\n    col1 INT64 NOT NULL,\n    col2 STRING(MAX),\n    col3 BYTES(42),\n"+
+		"    CONSTRAINT ck1 CHECK (col1 > 0),\n    CHECK (col2 IS NOT NULL)\n) PRIMARY KEY (col1 DESC)", t1.PrintCreateTable(Config{}))
+	assert.Equal(t, "CREATE TABLE \"mytable\" (\n    \"col1\" bigint NOT NULL,\n    \"col2\" varchar,\n    \"col3\" bytea,\n"+
+		"    CONSTRAINT \"ck1\" CHECK (\"col1\" > 0),\n    CHECK (\"col2\" IS NOT NULL),\n    PRIMARY KEY (\"col1\")\n)", t1.PrintCreateTable(Config{ProtectIds: true, Dialect: PostgreSQL}))
+}
+
+func TestPrintExpr(t *testing.T) {
+	e := []ExprToken{
+		{ExprSymbol, "("}, {ExprSymbol, "CHAR_LENGTH("}, {ExprColumn, "name"}, {ExprSymbol, ")"}, {ExprSymbol, ">"}, {ExprSymbol, "0"}, {ExprSymbol, ")"},
+		{ExprSymbol, "OR"},
+		{ExprSymbol, "("}, {ExprColumn, "status"}, {ExprSymbol, "IN"}, {ExprSymbol, "("}, {ExprString, "it's"}, {ExprSymbol, ","}, {ExprString, ")"}, {ExprSymbol, ")"}, {ExprSymbol, ")"},
+	}
+	assert.Equal(t, "(CHAR_LENGTH(name) > 0) OR (status IN (\"it's\", \")\"))", PrintExpr(Config{}, e))
+	assert.Equal(t, "(CHAR_LENGTH(`name`) > 0) OR (`status` IN (\"it's\", \")\"))", PrintExpr(Config{ProtectIds: true}, e))
+	assert.Equal(t, `(LENGTH("name") > 0) OR ("status" IN ('it''s', ')'))`, PrintExpr(Config{ProtectIds: true, Dialect: PostgreSQL}, e))
+}
+
+func TestPrintExpr_PostgreSQL(t *testing.T) {
+	c := Config{ProtectIds: true, Dialect: PostgreSQL}
+	// Functions are renamed, and CONCAT becomes || (with parentheses
+	// around operands that need them).
+	e := []ExprToken{
+		{ExprSymbol, "CONCAT("}, {ExprSymbol, "IFNULL("}, {ExprColumn, "a"}, {ExprSymbol, ","}, {ExprString, "x"}, {ExprSymbol, ")"},
+		{ExprSymbol, ","}, {ExprColumn, "b"}, {ExprSymbol, "||"}, {ExprColumn, "c"},
+		{ExprSymbol, ","}, {ExprSymbol, "CONCAT("}, {ExprSymbol, "TRIM("}, {ExprColumn, "d"}, {ExprSymbol, ")"}, {ExprSymbol, ")"},
+		{ExprSymbol, ")"}, {ExprSymbol, "="}, {ExprString, "abc"},
+	}
+	assert.True(t, PrintableExpr(PostgreSQL, e))
+	assert.Equal(t, `(COALESCE("a", 'x') || ("b" || "c") || (BTRIM("d"))) = 'abc'`, PrintExpr(c, e))
+	assert.Equal(t, "CONCAT(IFNULL(a, \"x\"), b || c, CONCAT(TRIM(d))) = \"abc\"", PrintExpr(Config{}, e))
+}
+
+func TestPrintableExpr(t *testing.T) {
+	div := []ExprToken{{ExprColumn, "a"}, {ExprSymbol, "/"}, {ExprSymbol, "2"}}
+	assert.True(t, PrintableExpr(GoogleSQL, div))
+	assert.False(t, PrintableExpr(PostgreSQL, div))
+	f := []ExprToken{{ExprSymbol, "FOO("}, {ExprColumn, "a"}, {ExprSymbol, ")"}}
+	assert.True(t, PrintableExpr(GoogleSQL, f))
+	assert.False(t, PrintableExpr(PostgreSQL, f))
+	assert.True(t, PrintableExpr(PostgreSQL, []ExprToken{{ExprSymbol, "("}, {ExprString, "/"}, {ExprSymbol, ")"}}))
+}
+
+func TestPrintCreateTable_PostgreSQL(t *testing.T) {
+	cds := make(map[string]ColumnDef)
+	cds["col1"] = ColumnDef{Name: "col1", T: Type{Name: Int64}, NotNull: true}
+	cds["col2"] = ColumnDef{Name: "col2", T: Type{Name: String, Len: MaxLength}, NotNull: false, Comment: "From: text"}
+	ct := CreateTable{
+		Name:     "mytable",
+		ColNames: []string{"col1", "col2"},
+		ColDefs:  cds,
+		Pks:      []IndexKey{{Col: "col1", Desc: true}},
+		Parent:   "parent",
+	}
+	assert.Equal(t, "CREATE TABLE \"mytable\" (\n    \"col1\" bigint NOT NULL,\n    \"col2\" varchar,\n    PRIMARY KEY (\"col1\")\n) INTERLEAVE IN PARENT \"parent\"",
+		ct.PrintCreateTable(Config{ProtectIds: true, Dialect: PostgreSQL}))
+	assert.Equal(t, "CREATE TABLE mytable (\n    col1 bigint NOT NULL,\n    col2 varchar,         -- From: text\n    PRIMARY KEY (col1)\n) INTERLEAVE IN PARENT parent",
+		ct.PrintCreateTable(Config{Comments: true, Dialect: PostgreSQL}))
+	ci := CreateIndex{Name: "myindex", Table: "mytable", Keys: []IndexKey{{Col: "col2", Desc: true}}}
+	assert.Equal(t, `CREATE INDEX "myindex" ON "mytable" ("col2" DESC)`, ci.PrintCreateIndex(Config{ProtectIds: true, Dialect: PostgreSQL}))
 }
 
 func TestPrintCreateIndex(t *testing.T) {
@@ -272,6 +398,40 @@ func TestGetDDL(t *testing.T) {
 	assert.ElementsMatch(t, e3, tablesAndFks)
 }
 
+func TestPrintCreateView(t *testing.T) {
+	cv := CreateView{
+		Name: "v1",
+		Query: []ExprToken{
+			{ExprSymbol, "SELECT"}, {ExprColumn, "t"}, {ExprSymbol, "."}, {ExprColumn, "a"}, {ExprSymbol, "AS"}, {ExprColumn, "total"},
+			{ExprSymbol, "FROM"}, {ExprTable, "table1"}, {ExprColumn, "t"},
+			{ExprSymbol, "WHERE"}, {ExprColumn, "b"}, {ExprSymbol, "="}, {ExprString, "x"},
+		},
+		Comment: "view comment",
+	}
+	assert.Equal(t, `SELECT t.a AS total FROM table1 t WHERE b = "x"`, PrintExpr(Config{}, cv.Query))
+	assert.Equal(t, "--\n-- view comment\n--\nCREATE VIEW v1 SQL SECURITY INVOKER AS SELECT t.a AS total FROM table1 t WHERE b = \"x\"", cv.PrintCreateView(Config{Comments: true}))
+	assert.Equal(t, "CREATE VIEW `v1` SQL SECURITY INVOKER AS SELECT `t`.`a` AS `total` FROM `table1` `t` WHERE `b` = \"x\"", cv.PrintCreateView(Config{ProtectIds: true}))
+	assert.Equal(t, `CREATE VIEW "v1" SQL SECURITY INVOKER AS SELECT "t"."a" AS "total" FROM "table1" "t" WHERE "b" = 'x'`, cv.PrintCreateView(Config{ProtectIds: true, Dialect: PostgreSQL}))
+}
+
+func TestViewsGetDDL(t *testing.T) {
+	query := func(from string) []ExprToken {
+		return []ExprToken{{ExprSymbol, "SELECT"}, {ExprColumn, "a"}, {ExprSymbol, "FROM"}, {ExprTable, from}}
+	}
+	v := Views{
+		"a_view": {Name: "a_view", Query: query("c_view")},
+		"b_view": {Name: "b_view", Query: query("table1")},
+		"c_view": {Name: "c_view", Query: query("d_view")},
+		"d_view": {Name: "d_view", Query: query("table1")},
+	}
+	assert.Equal(t, []string{
+		"CREATE VIEW b_view SQL SECURITY INVOKER AS SELECT a FROM table1",
+		"CREATE VIEW d_view SQL SECURITY INVOKER AS SELECT a FROM table1",
+		"CREATE VIEW c_view SQL SECURITY INVOKER AS SELECT a FROM d_view",
+		"CREATE VIEW a_view SQL SECURITY INVOKER AS SELECT a FROM c_view",
+	}, v.GetDDL(Config{}))
+}
+
 func normalizeSpace(s string) string {
 	// Insert whitespace around parenthesis and commas.
 	s = strings.ReplaceAll(s, ")", " ) ")
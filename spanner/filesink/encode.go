@@ -0,0 +1,175 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesink
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/civil"
+	sp "cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// JSONValue converts v, a value of Spanner type ty, to a value that
+// encodes to JSON as described in the Writer comment. It returns nil
+// for NULL values.
+func JSONValue(ty ddl.Type, v interface{}) (interface{}, error) {
+	v, valid := unwrap(v)
+	if !valid {
+		return nil, nil
+	}
+	if !ty.IsArray {
+		return scalarValue(ty.Name, v)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("can't encode %T as ARRAY<%s>", v, ty.Name)
+	}
+	l := []interface{}{}
+	for i := 0; i < rv.Len(); i++ {
+		e, valid := unwrap(rv.Index(i).Interface())
+		if !valid {
+			l = append(l, nil)
+			continue
+		}
+		x, err := scalarValue(ty.Name, e)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, x)
+	}
+	return l, nil
+}
+
+// unwrap returns the value held by v if v is one of the spanner.Null*
+// types, and whether v is non-NULL. Nil values and nil slices are NULL.
+func unwrap(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case nil:
+		return nil, false
+	case sp.NullString:
+		return x.StringVal, x.Valid
+	case sp.NullInt64:
+		return x.Int64, x.Valid
+	case sp.NullFloat64:
+		return x.Float64, x.Valid
+	case sp.NullBool:
+		return x.Bool, x.Valid
+	case sp.NullDate:
+		return x.Date, x.Valid
+	case sp.NullTime:
+		return x.Time, x.Valid
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && rv.IsNil() {
+		return nil, false
+	}
+	return v, true
+}
+
+// scalarValue converts a non-NULL value v of Spanner type ty.
+func scalarValue(ty string, v interface{}) (interface{}, error) {
+	switch ty {
+	case ddl.Bool:
+		if x, ok := v.(bool); ok {
+			return x, nil
+		}
+	case ddl.Int64:
+		switch x := v.(type) {
+		case int64:
+			return x, nil
+		case int:
+			return int64(x), nil
+		}
+	case ddl.Float64:
+		if x, ok := v.(float64); ok {
+			// JSON has no representation of NaN and infinities,
+			// so we use strings (as Spanner does).
+			switch {
+			case math.IsNaN(x):
+				return "NaN", nil
+			case math.IsInf(x, 1):
+				return "Infinity", nil
+			case math.IsInf(x, -1):
+				return "-Infinity", nil
+			}
+			return x, nil
+		}
+	case ddl.String, ddl.JSON:
+		if x, ok := v.(string); ok {
+			return x, nil
+		}
+	case ddl.Bytes:
+		if x, ok := v.([]byte); ok {
+			return base64.StdEncoding.EncodeToString(x), nil
+		}
+	case ddl.Date:
+		switch x := v.(type) {
+		case civil.Date:
+			return x.String(), nil
+		case string:
+			return x, nil
+		}
+	case ddl.Timestamp:
+		switch x := v.(type) {
+		case time.Time:
+			return x.UTC().Format(time.RFC3339Nano), nil
+		case string:
+			return x, nil
+		}
+	case ddl.Numeric:
+		switch x := v.(type) {
+		case string:
+			r, ok := new(big.Rat).SetString(x)
+			if !ok {
+				return nil, fmt.Errorf("can't parse %q as NUMERIC", x)
+			}
+			return sp.NumericString(r), nil
+		case big.Rat:
+			return sp.NumericString(&x), nil
+		case *big.Rat:
+			return sp.NumericString(x), nil
+		}
+	}
+	return nil, fmt.Errorf("can't encode %T as %s", v, ty)
+}
+
+// csvField returns the CSV field for v, a value returned by JSONValue.
+func csvField(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return x, nil
+	case bool:
+		return strconv.FormatBool(x), nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	}
+	var b bytes.Buffer
+	if err := writeJSON(&b, v); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
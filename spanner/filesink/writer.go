@@ -0,0 +1,280 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filesink writes converted data to CSV or JSON-lines files,
+// with one file per Spanner table. This is useful for inspecting and
+// comparing the output of data conversion, and for feeding converted
+// data to other loaders.
+package filesink
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// Format is the format of the files written by Writer.
+type Format string
+
+const (
+	// CSV files have a header row of column names, followed by one
+	// record per row. NULL values are written as empty fields.
+	CSV Format = "csv"
+	// JSONL files have one JSON object per line, mapping column names
+	// to values. NULL values are written as null.
+	JSONL Format = "jsonl"
+)
+
+// maxSampleBadRows is the maximum number of dropped rows that Writer
+// keeps a copy of.
+const maxSampleBadRows = 100
+
+// Writer writes rows of data (via AddRow) to files in a directory, one
+// file per table. The file for table T is T.csv or T.jsonl, depending
+// on the format. Values are encoded as follows:
+//   - INT64, FLOAT64 and BOOL values use their usual text form (in JSONL
+//     files, they are JSON numbers and booleans).
+//   - NUMERIC values are decimal strings with 9 digits after the point.
+//   - BYTES values are base64-encoded.
+//   - DATE values use the form YYYY-MM-DD, and TIMESTAMP values use RFC
+//     3339 format in UTC.
+//   - Arrays are JSON arrays (in CSV files, the field holds the JSON
+//     text of the array).
+//
+// Rows that can't be encoded (e.g. because a value doesn't match its
+// column's type) are dropped. Writer is threadsafe.
+type Writer struct {
+	dir      string
+	format   Format
+	schema   ddl.Schema
+	progress *internal.Progress // Progress of rows written; can be nil.
+
+	lock          sync.Mutex       // Protects fields below.
+	files         map[string]*file // File for each table.
+	rows          int64            // Number of rows written.
+	droppedRows   map[string]int64 // Count of dropped rows, broken down by table.
+	sampleBadRows []string         // A sample of dropped rows.
+	err           error            // First error writing files.
+}
+
+// file is the output file for a table.
+type file struct {
+	f   *os.File
+	buf *bufio.Writer
+	csv *csv.Writer // Only used for CSV format.
+}
+
+// NewWriter returns a Writer for tables in schema that writes files in
+// format to dir, creating dir if necessary. If progress is not nil, it
+// is updated with the number of rows written.
+func NewWriter(dir string, format Format, schema ddl.Schema, progress *internal.Progress) (*Writer, error) {
+	if format != CSV && format != JSONL {
+		return nil, fmt.Errorf("unsupported file format %q", format)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		dir:         dir,
+		format:      format,
+		schema:      schema,
+		progress:    progress,
+		files:       make(map[string]*file),
+		droppedRows: make(map[string]int64),
+	}
+	var tables []string
+	for t := range schema {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	for _, t := range tables {
+		f, err := os.Create(filepath.Join(dir, t+"."+string(format)))
+		if err != nil {
+			w.Close()
+			return nil, err
+		}
+		tf := &file{f: f, buf: bufio.NewWriter(f)}
+		w.files[t] = tf
+		if format == CSV {
+			tf.csv = csv.NewWriter(tf.buf)
+			if err := tf.csv.Write(schema[t].ColNames); err != nil {
+				w.Close()
+				return nil, err
+			}
+		}
+	}
+	return w, nil
+}
+
+// AddRow writes a row of data for table to the table's file.
+func (w *Writer) AddRow(table string, cols []string, vals []interface{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	f, ok := w.files[table]
+	var err error
+	if ok {
+		err = w.writeRow(f, w.schema[table], cols, vals)
+	} else {
+		err = fmt.Errorf("unknown table %s", table)
+	}
+	if err != nil {
+		w.droppedRows[table]++
+		if len(w.sampleBadRows) < maxSampleBadRows {
+			w.sampleBadRows = append(w.sampleBadRows, fmt.Sprintf("table=%s cols=%v data=%v error=%v", table, cols, vals, err))
+		}
+		return
+	}
+	w.rows++
+	if w.progress != nil {
+		w.progress.MaybeReport(w.rows)
+	}
+}
+
+// Flush writes out all buffered rows of data.
+func (w *Writer) Flush() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, f := range w.files {
+		w.setErr(f.flush())
+	}
+}
+
+// Close writes out all buffered rows of data and closes the files. It
+// returns the first error encountered writing files.
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, f := range w.files {
+		w.setErr(f.flush())
+		w.setErr(f.f.Close())
+	}
+	return w.err
+}
+
+// DroppedRowsByTable returns a map of tables to counts of dropped rows.
+func (w *Writer) DroppedRowsByTable() map[string]int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	m := make(map[string]int64)
+	for t, n := range w.droppedRows {
+		m[t] = n
+	}
+	return m
+}
+
+// SampleBadRows returns a string-formatted list of sample rows that
+// were dropped. Returns at most n rows.
+func (w *Writer) SampleBadRows(n int) []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if n > len(w.sampleBadRows) {
+		n = len(w.sampleBadRows)
+	}
+	return append([]string(nil), w.sampleBadRows[:n]...)
+}
+
+// writeRow encodes a row of table t and writes it to f. Columns of t
+// that are missing from cols are NULL. If the row can't be encoded,
+// nothing is written.
+func (w *Writer) writeRow(f *file, t ddl.CreateTable, cols []string, vals []interface{}) error {
+	if len(cols) != len(vals) {
+		return fmt.Errorf("have %d columns but %d values", len(cols), len(vals))
+	}
+	m := make(map[string]interface{})
+	for i, c := range cols {
+		if _, ok := t.ColDefs[c]; !ok {
+			return fmt.Errorf("table %s has no column %s", t.Name, c)
+		}
+		m[c] = vals[i]
+	}
+	var record []string
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, cn := range t.ColNames {
+		cd := t.ColDefs[cn]
+		v, err := JSONValue(cd.T, m[cn])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", cn, err)
+		}
+		if v == nil && cd.NotNull {
+			return fmt.Errorf("column %s can't be NULL", cn)
+		}
+		switch w.format {
+		case CSV:
+			s, err := csvField(v)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", cn, err)
+			}
+			record = append(record, s)
+		case JSONL:
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeJSON(&b, cn); err != nil {
+				return err
+			}
+			b.WriteByte(':')
+			if err := writeJSON(&b, v); err != nil {
+				return fmt.Errorf("column %s: %w", cn, err)
+			}
+		}
+	}
+	switch w.format {
+	case CSV:
+		w.setErr(f.csv.Write(record))
+	case JSONL:
+		b.WriteString("}\n")
+		_, err := f.buf.Write(b.Bytes())
+		w.setErr(err)
+	}
+	return nil
+}
+
+// setErr records err if it is the first error writing files.
+func (w *Writer) setErr(err error) {
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+func (f *file) flush() error {
+	if f.csv != nil {
+		f.csv.Flush()
+		if err := f.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return f.buf.Flush()
+}
+
+// writeJSON writes the JSON encoding of v to b, without the trailing
+// newline added by json.Encoder and without escaping HTML characters.
+func writeJSON(b *bytes.Buffer, v interface{}) error {
+	e := json.NewEncoder(b)
+	e.SetEscapeHTML(false)
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	b.Truncate(b.Len() - 1)
+	return nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filesink
+
+import (
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	sp "cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func testSchema() ddl.Schema {
+	return ddl.Schema{
+		"t": ddl.CreateTable{
+			Name:     "t",
+			ColNames: []string{"id", "s", "b", "f", "d", "ts", "by", "n", "a"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"id": {Name: "id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"s":  {Name: "s", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"b":  {Name: "b", T: ddl.Type{Name: ddl.Bool}},
+				"f":  {Name: "f", T: ddl.Type{Name: ddl.Float64}},
+				"d":  {Name: "d", T: ddl.Type{Name: ddl.Date}},
+				"ts": {Name: "ts", T: ddl.Type{Name: ddl.Timestamp}},
+				"by": {Name: "by", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
+				"n":  {Name: "n", T: ddl.Type{Name: ddl.Numeric}},
+				"a":  {Name: "a", T: ddl.Type{Name: ddl.Int64, IsArray: true}},
+			},
+			Pks: []ddl.IndexKey{{Col: "id"}},
+		},
+		"empty": ddl.CreateTable{
+			Name:     "empty",
+			ColNames: []string{"id"},
+			ColDefs:  map[string]ddl.ColumnDef{"id": {Name: "id", T: ddl.Type{Name: ddl.Int64}}},
+		},
+	}
+}
+
+// addTestRows adds rows to w: two good rows, and three that are
+// dropped.
+func addTestRows(w *Writer) {
+	ts := time.Date(2021, 3, 4, 5, 6, 7, 0, time.FixedZone("", 3600))
+	r, _ := new(big.Rat).SetString("1/8")
+	w.AddRow("t",
+		[]string{"id", "s", "b", "f", "d", "ts", "by", "n", "a"},
+		[]interface{}{int64(1), "a,\"b\"<", true, 1.5, civil.Date{Year: 2021, Month: 1, Day: 2}, ts, []byte("hi"), *r,
+			[]sp.NullInt64{{Int64: 7, Valid: true}, {}}})
+	w.AddRow("t", []string{"f", "id"}, []interface{}{math.Inf(-1), int64(2)})
+	w.AddRow("t", []string{"id", "s"}, []interface{}{int64(3), int64(3)})
+	w.AddRow("t", []string{"s"}, []interface{}{"no key"})
+	w.AddRow("u", []string{"id"}, []interface{}{int64(1)})
+}
+
+func TestWriter_CSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	w, err := NewWriter(dir, CSV, testSchema(), nil)
+	assert.Nil(t, err)
+	addTestRows(w)
+	w.Flush()
+	assert.Nil(t, w.Close())
+	assert.Equal(t, map[string]int64{"t": 2, "u": 1}, w.DroppedRowsByTable())
+	assert.Equal(t, 3, len(w.SampleBadRows(10)))
+	assert.Equal(t,
+		"id,s,b,f,d,ts,by,n,a\n"+
+			"1,\"a,\"\"b\"\"<\",true,1.5,2021-01-02,2021-03-04T04:06:07Z,aGk=,0.125000000,\"[7,null]\"\n"+
+			"2,,,-Infinity,,,,,\n",
+		readFile(t, dir, "t.csv"))
+	assert.Equal(t, "id\n", readFile(t, dir, "empty.csv"))
+}
+
+func TestWriter_JSONL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesink_test")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	w, err := NewWriter(dir, JSONL, testSchema(), nil)
+	assert.Nil(t, err)
+	addTestRows(w)
+	assert.Nil(t, w.Close())
+	assert.Equal(t, map[string]int64{"t": 2, "u": 1}, w.DroppedRowsByTable())
+	assert.Equal(t,
+		`{"id":1,"s":"a,\"b\"<","b":true,"f":1.5,"d":"2021-01-02","ts":"2021-03-04T04:06:07Z","by":"aGk=","n":"0.125000000","a":[7,null]}`+"\n"+
+			`{"id":2,"s":null,"b":null,"f":"-Infinity","d":null,"ts":null,"by":null,"n":null,"a":null}`+"\n",
+		readFile(t, dir, "t.jsonl"))
+	assert.Equal(t, "", readFile(t, dir, "empty.jsonl"))
+}
+
+func TestNewWriter_BadFormat(t *testing.T) {
+	_, err := NewWriter("unused", Format("xml"), testSchema(), nil)
+	assert.NotNil(t, err)
+}
+
+func readFile(t *testing.T, dir, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	assert.Nil(t, err)
+	return string(b)
+}
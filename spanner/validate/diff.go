@@ -0,0 +1,379 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	sp "cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// maxSampleBadRows is the maximum number of dropped rows that
+// DiffWriter keeps a copy of.
+const maxSampleBadRows = 100
+
+// DiffWriter collects converted rows of data (via AddRow), so that they
+// can be compared row by row with the tables in Spanner using Diff.
+// Rows are kept in memory in their canonical form (see package
+// comment). Rows that can't be encoded are dropped. DiffWriter is
+// threadsafe.
+type DiffWriter struct {
+	schema   ddl.Schema
+	progress *internal.Progress // Progress of rows collected; can be nil.
+
+	lock          sync.Mutex           // Protects fields below.
+	tables        map[string][]diffRow // Rows of each table.
+	rows          int64                // Number of rows collected.
+	droppedRows   map[string]int64     // Count of dropped rows, broken down by table.
+	sampleBadRows []string             // A sample of dropped rows.
+}
+
+// diffRow is a row collected by DiffWriter.
+type diffRow struct {
+	key  []interface{}          // Primary key values.
+	vals map[string]interface{} // Canonical form of the row.
+}
+
+// NewDiffWriter returns a DiffWriter for tables in schema. If progress
+// is not nil, it is updated with the number of rows collected.
+func NewDiffWriter(schema ddl.Schema, progress *internal.Progress) *DiffWriter {
+	return &DiffWriter{
+		schema:      schema,
+		progress:    progress,
+		tables:      make(map[string][]diffRow),
+		droppedRows: make(map[string]int64),
+	}
+}
+
+// AddRow collects a row of data for table.
+func (w *DiffWriter) AddRow(table string, cols []string, vals []interface{}) {
+	ct, ok := w.schema[table]
+	var m map[string]interface{}
+	var err error
+	if ok {
+		m, err = canonicalRow(ct, cols, vals)
+	} else {
+		err = fmt.Errorf("unknown table %s", table)
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err != nil {
+		w.droppedRows[table]++
+		if len(w.sampleBadRows) < maxSampleBadRows {
+			w.sampleBadRows = append(w.sampleBadRows, fmt.Sprintf("table=%s cols=%v data=%v error=%v", table, cols, vals, err))
+		}
+		return
+	}
+	w.tables[table] = append(w.tables[table], diffRow{key: rowKey(ct, m), vals: m})
+	w.rows++
+	if w.progress != nil {
+		w.progress.MaybeReport(w.rows)
+	}
+}
+
+// Flush does nothing: rows are compared by Diff.
+func (w *DiffWriter) Flush() {}
+
+// DroppedRowsByTable returns a map of tables to counts of dropped rows.
+func (w *DiffWriter) DroppedRowsByTable() map[string]int64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	m := make(map[string]int64)
+	for t, n := range w.droppedRows {
+		m[t] = n
+	}
+	return m
+}
+
+// SampleBadRows returns a string-formatted list of sample rows that
+// were dropped. Returns at most n rows.
+func (w *DiffWriter) SampleBadRows(n int) []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if n > len(w.sampleBadRows) {
+		n = len(w.sampleBadRows)
+	}
+	return append([]string(nil), w.sampleBadRows[:n]...)
+}
+
+// RowDiff describes a row that differs between the converted source
+// data and Spanner. Values are encoded as in package filesink.
+type RowDiff struct {
+	Table       string        `json:"table"`        // Spanner table.
+	SourceTable string        `json:"source_table"` // Source table.
+	Kind        string        `json:"kind"`         // One of "missing", "extra" or "changed".
+	Key         []interface{} `json:"key"`          // Primary key values.
+	// Row holds the values of a missing row (as converted from the
+	// source) or an extra row (as read from Spanner), by Spanner column.
+	Row map[string]interface{} `json:"row,omitempty"`
+	// Columns lists the columns that differ, for changed rows.
+	Columns []ColumnDiff `json:"columns,omitempty"`
+}
+
+// ColumnDiff describes a column whose value differs between the
+// converted source row and the Spanner row. NULL values are nil.
+type ColumnDiff struct {
+	Column       string      `json:"column"`        // Spanner column.
+	SourceColumn string      `json:"source_column"` // Source column.
+	Source       interface{} `json:"source"`
+	Spanner      interface{} `json:"spanner"`
+}
+
+// DiffStats summarizes the differences found in a table.
+type DiffStats struct {
+	Table       string
+	SourceRows  int64
+	SpannerRows int64
+	Missing     int64 // Rows in the source but not in Spanner.
+	Extra       int64 // Rows in Spanner but not in the source.
+	Changed     int64 // Rows with different values.
+	Dropped     int64 // Source rows that couldn't be encoded for comparison.
+	Err         error // Error reading the table from Spanner.
+}
+
+// Diff compares the rows collected by w with the tables in the Spanner
+// database of client, and writes a RowDiff for each row that differs to
+// out, as JSON lines. dialect is the dialect of the database, and
+// toSource maps Spanner table names to source table and column names
+// (see internal.Conv), so that differences can be reported using source
+// names as well. Tables are compared by sorting the collected rows by
+// primary key and merging them with the rows read from Spanner in key
+// order. Diff returns the statistics for each table, and fails if it
+// can't write to out.
+func Diff(client *sp.Client, dialect ddl.Dialect, w *DiffWriter, toSource map[string]internal.NameAndCols, out io.Writer) ([]DiffStats, error) {
+	return diff(spannerReader(client, dialect), w, toSource, out)
+}
+
+func diff(read readFunc, w *DiffWriter, toSource map[string]internal.NameAndCols, out io.Writer) ([]DiffStats, error) {
+	var tables []string
+	for t := range w.schema {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	enc := json.NewEncoder(out)
+	var stats []DiffStats
+	for _, t := range tables {
+		s, err := diffTable(read, w.schema[t], w.tables[t], toSource[t], enc)
+		if err != nil {
+			return stats, err
+		}
+		s.Dropped = w.droppedRows[t]
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// diffTable compares rows src of table ct with the table in Spanner,
+// writing differences using enc. It sorts src.
+func diffTable(read readFunc, ct ddl.CreateTable, src []diffRow, names internal.NameAndCols, enc *json.Encoder) (DiffStats, error) {
+	stats := DiffStats{Table: ct.Name, SourceRows: int64(len(src))}
+	sort.SliceStable(src, func(i, j int) bool { return compareKeys(ct, src[i].key, src[j].key) < 0 })
+	var werr error
+	emit := func(d RowDiff) {
+		switch d.Kind {
+		case "missing":
+			stats.Missing++
+		case "extra":
+			stats.Extra++
+		case "changed":
+			stats.Changed++
+		}
+		d.Table, d.SourceTable = ct.Name, names.Name
+		if werr == nil {
+			werr = enc.Encode(d)
+		}
+	}
+	i := 0
+	err := read(ct, func(vals []interface{}) error {
+		m, err := canonicalRow(ct, ct.ColNames, vals)
+		if err != nil {
+			return err
+		}
+		stats.SpannerRows++
+		key := rowKey(ct, m)
+		for i < len(src) && compareKeys(ct, src[i].key, key) < 0 {
+			emit(RowDiff{Kind: "missing", Key: src[i].key, Row: src[i].vals})
+			i++
+		}
+		if i < len(src) && compareKeys(ct, src[i].key, key) == 0 {
+			if cols := columnDiffs(ct, src[i].vals, m, names); len(cols) > 0 {
+				emit(RowDiff{Kind: "changed", Key: key, Columns: cols})
+			}
+			i++
+			return werr
+		}
+		emit(RowDiff{Kind: "extra", Key: key, Row: m})
+		return werr
+	})
+	if werr != nil {
+		return stats, werr
+	}
+	if err != nil {
+		stats.Err = err
+		return stats, nil
+	}
+	for ; i < len(src); i++ {
+		emit(RowDiff{Kind: "missing", Key: src[i].key, Row: src[i].vals})
+	}
+	return stats, werr
+}
+
+// columnDiffs returns the columns of table ct whose values differ
+// between rows a (from the source) and b (from Spanner).
+func columnDiffs(ct ddl.CreateTable, a, b map[string]interface{}, names internal.NameAndCols) []ColumnDiff {
+	var l []ColumnDiff
+	for _, c := range ct.ColNames {
+		if reflect.DeepEqual(a[c], b[c]) {
+			continue
+		}
+		l = append(l, ColumnDiff{Column: c, SourceColumn: names.Cols[c], Source: a[c], Spanner: b[c]})
+	}
+	return l
+}
+
+// compareKeys compares primary keys a and b of table ct, using the
+// order in which Spanner sorts rows. It returns -1, 0 or 1.
+func compareKeys(ct ddl.CreateTable, a, b []interface{}) int {
+	for i, k := range ct.Pks {
+		c := compareValues(ct.ColDefs[k.Col].T.Name, a[i], b[i])
+		if k.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareValues compares a and b, values of Spanner type ty in the form
+// returned by filesink.JSONValue, using Spanner's sort order: NULLs come
+// first, and NaN is less than all other FLOAT64 values.
+func compareValues(ty string, a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch ty {
+	case ddl.Bool:
+		x, y := a.(bool), b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case ddl.Int64:
+		return compareInt64(a.(int64), b.(int64))
+	case ddl.Float64:
+		return compareFloat64(floatValue(a), floatValue(b))
+	case ddl.Bytes:
+		x, _ := base64.StdEncoding.DecodeString(a.(string))
+		y, _ := base64.StdEncoding.DecodeString(b.(string))
+		return bytes.Compare(x, y)
+	case ddl.Timestamp:
+		x, err1 := time.Parse(time.RFC3339Nano, a.(string))
+		y, err2 := time.Parse(time.RFC3339Nano, b.(string))
+		if err1 == nil && err2 == nil {
+			switch {
+			case x.Before(y):
+				return -1
+			case x.After(y):
+				return 1
+			}
+			return 0
+		}
+	case ddl.Numeric:
+		x, ok1 := new(big.Rat).SetString(a.(string))
+		y, ok2 := new(big.Rat).SetString(b.(string))
+		if ok1 && ok2 {
+			return x.Cmp(y)
+		}
+	}
+	// STRING values sort by their UTF-8 bytes, and DATE values have the
+	// form YYYY-MM-DD.
+	x, y := fmt.Sprint(a), fmt.Sprint(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareInt64(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func compareFloat64(x, y float64) int {
+	switch {
+	case math.IsNaN(x) && math.IsNaN(y):
+		return 0
+	case math.IsNaN(x):
+		return -1
+	case math.IsNaN(y):
+		return 1
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// floatValue returns the FLOAT64 value of v, which is either a float64
+// or one of the strings used by filesink.JSONValue for NaN and
+// infinities.
+func floatValue(v interface{}) float64 {
+	switch x := v.(type) {
+	case float64:
+		return x
+	case string:
+		switch x {
+		case "Infinity":
+			return math.Inf(1)
+		case "-Infinity":
+			return math.Inf(-1)
+		}
+	}
+	return math.NaN()
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	sp "cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func TestDiff(t *testing.T) {
+	w := NewDiffWriter(testSchema(), nil)
+	// Rows are added out of order, as they can be when tables are read
+	// in chunks.
+	w.AddRow("t", []string{"a", "b"}, []interface{}{int64(3), "z"})
+	w.AddRow("t", []string{"a", "b"}, []interface{}{int64(1), "x"})
+	w.AddRow("t", []string{"a", "b"}, []interface{}{int64(2), "y"})
+	w.AddRow("t", []string{"a", "b"}, []interface{}{int64(5), "v"})
+	w.AddRow("t", []string{"a", "b"}, []interface{}{"bad", "w"})
+	assert.Equal(t, map[string]int64{"t": 1}, w.DroppedRowsByTable())
+	assert.Len(t, w.SampleBadRows(10), 1)
+
+	toSource := map[string]internal.NameAndCols{"t": {Name: "src_t", Cols: map[string]string{"a": "src_a", "b": "src_b"}}}
+	var out bytes.Buffer
+	stats, err := diff(tableRows(
+		[]interface{}{sp.NullInt64{Int64: 1, Valid: true}, sp.NullString{StringVal: "x", Valid: true}},
+		[]interface{}{sp.NullInt64{Int64: 3, Valid: true}, sp.NullString{}},
+		[]interface{}{sp.NullInt64{Int64: 4, Valid: true}, sp.NullString{StringVal: "u", Valid: true}},
+	), w, toSource, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, []DiffStats{{Table: "t", SourceRows: 4, SpannerRows: 3, Missing: 2, Extra: 1, Changed: 1, Dropped: 1}}, stats)
+
+	var got []RowDiff
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var d RowDiff
+		assert.Nil(t, dec.Decode(&d))
+		got = append(got, d)
+	}
+	// JSON numbers decode as float64.
+	assert.Equal(t, []RowDiff{
+		{Table: "t", SourceTable: "src_t", Kind: "missing", Key: []interface{}{2.0}, Row: map[string]interface{}{"a": 2.0, "b": "y"}},
+		{Table: "t", SourceTable: "src_t", Kind: "changed", Key: []interface{}{3.0}, Columns: []ColumnDiff{
+			{Column: "b", SourceColumn: "src_b", Source: "z", Spanner: nil}}},
+		{Table: "t", SourceTable: "src_t", Kind: "extra", Key: []interface{}{4.0}, Row: map[string]interface{}{"a": 4.0, "b": "u"}},
+		{Table: "t", SourceTable: "src_t", Kind: "missing", Key: []interface{}{5.0}, Row: map[string]interface{}{"a": 5.0, "b": "v"}},
+	}, got)
+}
+
+func TestCompareKeys(t *testing.T) {
+	ct := ddl.CreateTable{
+		Name:     "t",
+		ColNames: []string{"s", "f", "ts"},
+		ColDefs: map[string]ddl.ColumnDef{
+			"s":  {Name: "s", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+			"f":  {Name: "f", T: ddl.Type{Name: ddl.Float64}},
+			"ts": {Name: "ts", T: ddl.Type{Name: ddl.Timestamp}},
+		},
+		Pks: []ddl.IndexKey{{Col: "s"}, {Col: "f", Desc: true}, {Col: "ts"}},
+	}
+	tests := []struct {
+		a, b []interface{}
+		want int
+	}{
+		{[]interface{}{"a", 1.0, nil}, []interface{}{"a", 1.0, nil}, 0},
+		{[]interface{}{nil, 1.0, nil}, []interface{}{"a", 1.0, nil}, -1},
+		{[]interface{}{"B", 1.0, nil}, []interface{}{"a", 1.0, nil}, -1}, // Strings sort by bytes.
+		{[]interface{}{"a", 2.0, nil}, []interface{}{"a", 1.0, nil}, -1}, // Descending.
+		{[]interface{}{"a", "NaN", nil}, []interface{}{"a", "-Infinity", nil}, 1},
+		{[]interface{}{"a", 1.0, "2021-01-01T00:00:00.5Z"}, []interface{}{"a", 1.0, "2021-01-01T00:00:00Z"}, 1},
+	}
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, compareKeys(ct, tc.a, tc.b), "a=%v b=%v", tc.a, tc.b)
+	}
+	assert.Equal(t, -1, compareFloat64(math.NaN(), math.Inf(-1)))
+}
@@ -0,0 +1,442 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validate checks that data written to Spanner matches the
+// converted source data. A Recorder computes a checksum of the rows of
+// each table as data conversion writes them, and Validate reads each
+// table back from Spanner and compares its row count and checksum with
+// the recorded ones.
+//
+// Checksums are independent of the order of rows: each row is encoded
+// in a canonical form (a JSON object mapping column names to values
+// encoded as in package filesink, with NULLs omitted), hashed, and the
+// hashes of a table's rows are added together. For tables of up to
+// keyLimit rows, the hash of each row is kept by primary key, so that
+// Validate can list the keys of rows that are missing, unexpected or
+// different in Spanner.
+//
+// For a full comparison, a DiffWriter collects the converted rows
+// themselves, and Diff compares them row by row with the tables in
+// Spanner, reporting the values of the columns that differ.
+package validate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	sp "cloud.google.com/go/spanner"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/filesink"
+)
+
+const (
+	// keyLimit is the maximum number of rows of a table whose hashes
+	// are kept by key. Larger tables are only checked by row count and
+	// checksum.
+	keyLimit = 1000000
+	// maxKeyDiffs is the maximum number of mismatched keys listed for
+	// each table.
+	maxKeyDiffs = 1000
+)
+
+// Recorder records the rows of each table written by data conversion
+// (via Add). Recorder is threadsafe.
+type Recorder struct {
+	schema   ddl.Schema
+	keyLimit int
+
+	lock   sync.Mutex           // Protects tables.
+	tables map[string]*tableSum // Checksums by Spanner table.
+}
+
+// tableSum is the record of the rows of a table.
+type tableSum struct {
+	rows   int64             // Number of rows.
+	sum    uint64            // Sum (mod 2^64) of the hashes of rows.
+	keys   map[string]uint64 // Hash of each row, by key; nil if there are too many rows.
+	errors int64             // Number of rows that couldn't be encoded.
+}
+
+// NewRecorder returns a Recorder for the tables in schema.
+func NewRecorder(schema ddl.Schema) *Recorder {
+	return newRecorder(schema, keyLimit)
+}
+
+func newRecorder(schema ddl.Schema, keyLimit int) *Recorder {
+	return &Recorder{schema: schema, keyLimit: keyLimit, tables: make(map[string]*tableSum)}
+}
+
+// Add records a row of Spanner table table, with values vals for
+// columns cols.
+func (r *Recorder) Add(table string, cols []string, vals []interface{}) {
+	key, h, err := encodeRow(r.schema[table], cols, vals)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.table(table)
+	s.rows++
+	if err != nil {
+		s.errors++
+		return
+	}
+	s.sum += h
+	if s.keys == nil {
+		return
+	}
+	if len(s.keys) >= r.keyLimit {
+		s.keys = nil
+		return
+	}
+	// If the source has several rows with the same key, at most one
+	// of them can be written, and we keep the first.
+	if _, ok := s.keys[key]; !ok {
+		s.keys[key] = h
+	}
+}
+
+// table returns the record for table t. Callers must hold r.lock.
+func (r *Recorder) table(t string) *tableSum {
+	s, ok := r.tables[t]
+	if !ok {
+		s = &tableSum{keys: make(map[string]uint64)}
+		r.tables[t] = s
+	}
+	return s
+}
+
+// encodeRow returns the key and hash of a row of table ct, with values
+// vals for columns cols. The key is the JSON encoding of the row's
+// primary key values.
+func encodeRow(ct ddl.CreateTable, cols []string, vals []interface{}) (string, uint64, error) {
+	m, err := canonicalRow(ct, cols, vals)
+	if err != nil {
+		return "", 0, err
+	}
+	kb, err := json.Marshal(rowKey(ct, m))
+	if err != nil {
+		return "", 0, err
+	}
+	// Marshal sorts map keys, so the encoding doesn't depend on the
+	// order of cols.
+	rb, err := json.Marshal(m)
+	if err != nil {
+		return "", 0, err
+	}
+	h := fnv.New64a()
+	h.Write(rb)
+	return string(kb), h.Sum64(), nil
+}
+
+// canonicalRow returns the canonical form of a row of table ct, with
+// values vals for columns cols: a map from column name to value (as
+// returned by filesink.JSONValue) for the row's non-NULL values.
+func canonicalRow(ct ddl.CreateTable, cols []string, vals []interface{}) (map[string]interface{}, error) {
+	if len(cols) != len(vals) {
+		return nil, fmt.Errorf("have %d columns but %d values", len(cols), len(vals))
+	}
+	m := make(map[string]interface{})
+	for i, c := range cols {
+		cd, ok := ct.ColDefs[c]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %s of table %s", c, ct.Name)
+		}
+		v, err := filesink.JSONValue(cd.T, vals[i])
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			m[c] = v
+		}
+	}
+	return m, nil
+}
+
+// rowKey returns the primary key values of row m of table ct (see
+// canonicalRow).
+func rowKey(ct ddl.CreateTable, m map[string]interface{}) []interface{} {
+	key := []interface{}{}
+	for _, k := range ct.Pks {
+		key = append(key, m[k.Col])
+	}
+	return key
+}
+
+// Result is the result of validating the tables of a database.
+type Result struct {
+	Tables []TableResult `json:"tables"`
+}
+
+// Failed returns the number of tables that failed validation.
+func (r *Result) Failed() int {
+	n := 0
+	for _, t := range r.Tables {
+		if !t.Pass {
+			n++
+		}
+	}
+	return n
+}
+
+// TableResult is the result of validating a table.
+type TableResult struct {
+	Table           string `json:"table"`
+	Pass            bool   `json:"pass"`
+	SourceRows      int64  `json:"source_rows"`
+	SpannerRows     int64  `json:"spanner_rows"`
+	SourceChecksum  string `json:"source_checksum"`
+	SpannerChecksum string `json:"spanner_checksum"`
+	// Counts of mismatched keys, if the table was checked by key.
+	Missing int64 `json:"missing"` // Keys of source rows not in Spanner.
+	Extra   int64 `json:"extra"`   // Keys of rows in Spanner but not in the source.
+	Changed int64 `json:"changed"` // Keys of rows with different values.
+	// Keys lists up to maxKeyDiffs mismatched keys.
+	Keys []KeyDiff `json:"keys,omitempty"`
+	// Note explains why the table couldn't be fully checked (or read).
+	Note string `json:"note,omitempty"`
+}
+
+// KeyDiff is the primary key of a row that differs between the source
+// and Spanner.
+type KeyDiff struct {
+	Kind string          `json:"kind"` // One of "missing", "extra" or "changed".
+	Key  json.RawMessage `json:"key"`  // Array of primary key values.
+}
+
+// readFunc calls f with the values of each row of table ct in Spanner,
+// in the order of ct.ColNames. Rows are read in primary key order.
+type readFunc func(ct ddl.CreateTable, f func(vals []interface{}) error) error
+
+// Validate reads each table recorded by rec from the Spanner database
+// of client, and compares it with the recorded rows. dialect is the
+// dialect of the database. Validate consumes the record of rows, so it
+// should only be called once for each Recorder.
+func Validate(client *sp.Client, dialect ddl.Dialect, rec *Recorder) *Result {
+	return validate(spannerReader(client, dialect), rec)
+}
+
+func validate(read readFunc, rec *Recorder) *Result {
+	var tables []string
+	for t := range rec.schema {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	r := &Result{}
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	for _, t := range tables {
+		r.Tables = append(r.Tables, compareTable(read, rec.schema[t], rec.table(t)))
+	}
+	return r
+}
+
+// compareTable reads table ct from Spanner and compares it with src.
+// It removes the keys of the rows it reads from src.keys.
+func compareTable(read readFunc, ct ddl.CreateTable, src *tableSum) TableResult {
+	tr := TableResult{Table: ct.Name, SourceRows: src.rows, SourceChecksum: fmt.Sprintf("%016x", src.sum)}
+	var sum uint64
+	diff := func(kind, key string) {
+		switch kind {
+		case "missing":
+			tr.Missing++
+		case "extra":
+			tr.Extra++
+		case "changed":
+			tr.Changed++
+		}
+		if len(tr.Keys) < maxKeyDiffs {
+			tr.Keys = append(tr.Keys, KeyDiff{Kind: kind, Key: json.RawMessage(key)})
+		}
+	}
+	err := read(ct, func(vals []interface{}) error {
+		key, h, err := encodeRow(ct, ct.ColNames, vals)
+		if err != nil {
+			return err
+		}
+		tr.SpannerRows++
+		sum += h
+		if src.keys == nil {
+			return nil
+		}
+		sh, ok := src.keys[key]
+		switch {
+		case !ok:
+			diff("extra", key)
+		case sh != h:
+			diff("changed", key)
+		}
+		delete(src.keys, key)
+		return nil
+	})
+	tr.SpannerChecksum = fmt.Sprintf("%016x", sum)
+	if err != nil {
+		tr.Note = fmt.Sprintf("can't read table from Spanner: %v", err)
+		return tr
+	}
+	if src.keys != nil {
+		var missing []string
+		for k := range src.keys {
+			missing = append(missing, k)
+		}
+		sort.Strings(missing)
+		for _, k := range missing {
+			diff("missing", k)
+		}
+	}
+	switch {
+	case src.errors > 0:
+		tr.Note = fmt.Sprintf("%d source rows couldn't be encoded for comparison", src.errors)
+	case src.keys == nil:
+		tr.Note = fmt.Sprintf("more than %d rows, so mismatched keys aren't listed", keyLimit)
+	}
+	tr.Pass = src.errors == 0 && tr.SourceRows == tr.SpannerRows && src.sum == sum && tr.Missing+tr.Extra+tr.Changed == 0
+	return tr
+}
+
+// spannerReader returns a readFunc that reads tables using client.
+func spannerReader(client *sp.Client, dialect ddl.Dialect) readFunc {
+	quote := func(s string) string {
+		if dialect == ddl.PostgreSQL {
+			return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+		}
+		return "`" + s + "`"
+	}
+	return func(ct ddl.CreateTable, f func(vals []interface{}) error) error {
+		var cols []string
+		for _, c := range ct.ColNames {
+			cols = append(cols, quote(c))
+		}
+		var keys []string
+		for _, k := range ct.Pks {
+			if k.Desc {
+				keys = append(keys, quote(k.Col)+" DESC")
+			} else {
+				keys = append(keys, quote(k.Col))
+			}
+		}
+		q := fmt.Sprintf("SELECT %s FROM %s", strings.Join(cols, ", "), quote(ct.Name))
+		if len(keys) > 0 {
+			q += " ORDER BY " + strings.Join(keys, ", ")
+		}
+		stmt := sp.Statement{SQL: q}
+		iter := client.Single().Query(context.Background(), stmt)
+		return iter.Do(func(row *sp.Row) error {
+			vals := make([]interface{}, len(ct.ColNames))
+			for i, c := range ct.ColNames {
+				v, err := column(row, i, ct.ColDefs[c].T)
+				if err != nil {
+					return fmt.Errorf("can't decode column %s: %w", c, err)
+				}
+				vals[i] = v
+			}
+			return f(vals)
+		})
+	}
+}
+
+// Go types used to decode columns of each Spanner type.
+var (
+	scalarTypes = map[string]reflect.Type{
+		ddl.Bool:      reflect.TypeOf(sp.NullBool{}),
+		ddl.Bytes:     reflect.TypeOf([]byte{}),
+		ddl.Date:      reflect.TypeOf(sp.NullDate{}),
+		ddl.Float64:   reflect.TypeOf(sp.NullFloat64{}),
+		ddl.Int64:     reflect.TypeOf(sp.NullInt64{}),
+		ddl.String:    reflect.TypeOf(sp.NullString{}),
+		ddl.Timestamp: reflect.TypeOf(sp.NullTime{}),
+	}
+	arrayTypes = map[string]reflect.Type{
+		ddl.Bool:      reflect.TypeOf([]sp.NullBool{}),
+		ddl.Bytes:     reflect.TypeOf([][]byte{}),
+		ddl.Date:      reflect.TypeOf([]sp.NullDate{}),
+		ddl.Float64:   reflect.TypeOf([]sp.NullFloat64{}),
+		ddl.Int64:     reflect.TypeOf([]sp.NullInt64{}),
+		ddl.String:    reflect.TypeOf([]sp.NullString{}),
+		ddl.Timestamp: reflect.TypeOf([]sp.NullTime{}),
+	}
+)
+
+// column returns the value of column i of row, which has type ty, in a
+// form accepted by filesink.JSONValue.
+func column(row *sp.Row, i int, ty ddl.Type) (interface{}, error) {
+	if ty.Name == ddl.Numeric || ty.Name == ddl.JSON {
+		// NUMERIC and JSON values are decoded from their string form,
+		// which works for both dialects (and for client libraries
+		// without JSON support).
+		var g sp.GenericColumnValue
+		if err := row.Column(i, &g); err != nil {
+			return nil, err
+		}
+		if !ty.IsArray {
+			return text(g.Value.GetStringValue()), nil
+		}
+		lv := g.Value.GetListValue()
+		if lv == nil {
+			return nil, nil
+		}
+		l := []interface{}{}
+		for _, v := range lv.GetValues() {
+			l = append(l, text(v.GetStringValue()))
+		}
+		return l, nil
+	}
+	t, ok := scalarTypes[ty.Name]
+	if ty.IsArray {
+		t, ok = arrayTypes[ty.Name]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %s", ty.PrintColumnDefType())
+	}
+	p := reflect.New(t)
+	if err := row.Column(i, p.Interface()); err != nil {
+		return nil, err
+	}
+	return p.Elem().Interface(), nil
+}
+
+// text returns the NUMERIC or JSON value with string form s, or nil
+// for NULL (whose string form is empty).
+func text(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// WriteReport writes a section of the conversion report describing r.
+func (r *Result) WriteReport(w *bufio.Writer) {
+	w.WriteString("----------------------------\n")
+	w.WriteString("Data Validation\n")
+	w.WriteString("----------------------------\n")
+	fmt.Fprintf(w, "Read %d tables back from Spanner and compared their row counts and checksums with the converted source data: %d passed, %d failed.\n",
+		len(r.Tables), len(r.Tables)-r.Failed(), r.Failed())
+	for _, t := range r.Tables {
+		if t.Pass {
+			fmt.Fprintf(w, "  %s: PASS (%d rows)\n", t.Table, t.SpannerRows)
+			continue
+		}
+		fmt.Fprintf(w, "  %s: FAIL (%d source rows, %d Spanner rows, checksums %s and %s; %d missing, %d extra and %d changed keys)\n",
+			t.Table, t.SourceRows, t.SpannerRows, t.SourceChecksum, t.SpannerChecksum, t.Missing, t.Extra, t.Changed)
+		if t.Note != "" {
+			fmt.Fprintf(w, "    Note: %s\n", t.Note)
+		}
+	}
+	w.WriteString("\n")
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	sp "cloud.google.com/go/spanner"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func testSchema() ddl.Schema {
+	return ddl.Schema{
+		"t": {
+			Name:     "t",
+			ColNames: []string{"a", "b"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"a": {Name: "a", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"b": {Name: "b", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+			},
+			Pks: []ddl.IndexKey{{Col: "a"}},
+		},
+	}
+}
+
+// tableRows returns a readFunc that returns rows as the content of
+// every table.
+func tableRows(rows ...[]interface{}) readFunc {
+	return func(ct ddl.CreateTable, f func(vals []interface{}) error) error {
+		for _, r := range rows {
+			if err := f(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestValidate(t *testing.T) {
+	rec := NewRecorder(testSchema())
+	rec.Add("t", []string{"a", "b"}, []interface{}{int64(1), "x"})
+	rec.Add("t", []string{"b", "a"}, []interface{}{"y", int64(2)})
+	// Missing columns and NULL values are equivalent.
+	rec.Add("t", []string{"a"}, []interface{}{int64(3)})
+	r := validate(tableRows(
+		[]interface{}{sp.NullInt64{Int64: 3, Valid: true}, sp.NullString{}},
+		[]interface{}{sp.NullInt64{Int64: 2, Valid: true}, sp.NullString{StringVal: "y", Valid: true}},
+		[]interface{}{sp.NullInt64{Int64: 1, Valid: true}, sp.NullString{StringVal: "x", Valid: true}},
+	), rec)
+	assert.Equal(t, 0, r.Failed())
+	tr := r.Tables[0]
+	assert.True(t, tr.Pass)
+	assert.Equal(t, int64(3), tr.SourceRows)
+	assert.Equal(t, int64(3), tr.SpannerRows)
+	assert.Equal(t, tr.SourceChecksum, tr.SpannerChecksum)
+	assert.Empty(t, tr.Keys)
+}
+
+func TestValidateMismatch(t *testing.T) {
+	rec := NewRecorder(testSchema())
+	rec.Add("t", []string{"a", "b"}, []interface{}{int64(1), "x"})
+	rec.Add("t", []string{"a", "b"}, []interface{}{int64(2), "y"})
+	rec.Add("t", []string{"a", "b"}, []interface{}{int64(3), "z"})
+	r := validate(tableRows(
+		[]interface{}{sp.NullInt64{Int64: 1, Valid: true}, sp.NullString{StringVal: "x", Valid: true}},
+		[]interface{}{sp.NullInt64{Int64: 2, Valid: true}, sp.NullString{StringVal: "Y", Valid: true}},
+		[]interface{}{sp.NullInt64{Int64: 4, Valid: true}, sp.NullString{}},
+	), rec)
+	assert.Equal(t, 1, r.Failed())
+	tr := r.Tables[0]
+	assert.False(t, tr.Pass)
+	assert.Equal(t, int64(3), tr.SourceRows)
+	assert.Equal(t, int64(3), tr.SpannerRows)
+	assert.NotEqual(t, tr.SourceChecksum, tr.SpannerChecksum)
+	assert.Equal(t, int64(1), tr.Missing)
+	assert.Equal(t, int64(1), tr.Extra)
+	assert.Equal(t, int64(1), tr.Changed)
+	assert.Equal(t, []KeyDiff{
+		{Kind: "changed", Key: json.RawMessage("[2]")},
+		{Kind: "extra", Key: json.RawMessage("[4]")},
+		{Kind: "missing", Key: json.RawMessage("[3]")},
+	}, tr.Keys)
+}
+
+func TestValidateKeyLimit(t *testing.T) {
+	rec := newRecorder(testSchema(), 2)
+	var rows [][]interface{}
+	for i := int64(0); i < 3; i++ {
+		rec.Add("t", []string{"a", "b"}, []interface{}{i, fmt.Sprint(i)})
+		rows = append(rows, []interface{}{sp.NullInt64{Int64: i, Valid: true}, sp.NullString{StringVal: fmt.Sprint(i), Valid: true}})
+	}
+	r := validate(tableRows(rows...), rec)
+	assert.True(t, r.Tables[0].Pass)
+	assert.NotEmpty(t, r.Tables[0].Note)
+
+	// Tables with too many rows to compare by key are still checked by
+	// checksum.
+	rows[1] = []interface{}{sp.NullInt64{Int64: 1, Valid: true}, sp.NullString{}}
+	rec = newRecorder(testSchema(), 2)
+	for i := int64(0); i < 3; i++ {
+		rec.Add("t", []string{"a", "b"}, []interface{}{i, fmt.Sprint(i)})
+	}
+	r = validate(tableRows(rows...), rec)
+	assert.False(t, r.Tables[0].Pass)
+	assert.Empty(t, r.Tables[0].Keys)
+}
+
+func TestValidateBadRow(t *testing.T) {
+	rec := NewRecorder(testSchema())
+	rec.Add("t", []string{"a", "b"}, []interface{}{"not an int", "x"})
+	r := validate(tableRows(), rec)
+	assert.False(t, r.Tables[0].Pass)
+	assert.Equal(t, int64(1), r.Tables[0].SourceRows)
+	assert.Contains(t, r.Tables[0].Note, "couldn't be encoded")
+}
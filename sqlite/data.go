@@ -0,0 +1,74 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// ConvertSQLRow performs data conversion for a single row of data
+// returned from a SELECT query (see internal.ConvertSQLRow).
+func ConvertSQLRow(conv *internal.Conv, srcTable string, srcCols []string, srcSchema schema.Table, spTable string, spCols []string, spSchema ddl.CreateTable, srcVals []interface{}) ([]string, []interface{}, error) {
+	return internal.ConvertSQLRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, srcVals, cvtSQLScalar)
+}
+
+// cvtSQLScalar converts a value returned from a SQL query to a
+// Spanner value. Note that the caller is responsible for handling nil
+// values (used to represent NULL). SQLite is dynamically typed, so any
+// column can return values of any of the following types:
+//
+//	[]byte (blob values)
+//	bool (integer values of BOOLEAN columns)
+//	float64 (real values)
+//	int64 (integer values)
+//	string (text values)
+//	time.Time (values of DATE, DATETIME and TIMESTAMP columns)
+//
+// Timestamps stored as text or as Unix times need SQLite-specific
+// handling; other values are converted by internal.CvtSQLScalar.
+func cvtSQLScalar(conv *internal.Conv, srcCd schema.Column, spCd ddl.ColumnDef, val interface{}) (interface{}, error) {
+	if spCd.T.Name == ddl.Timestamp {
+		switch v := val.(type) {
+		case string:
+			return convTimestamp(conv.Location, v)
+		case int64: // Unix time, in seconds.
+			return time.Unix(v, 0).UTC(), nil
+		}
+	}
+	return internal.CvtSQLScalar(spCd, val)
+}
+
+// convTimestamp maps a SQLite timestamp string (in one of the formats
+// understood by SQLite's date and time functions, with optional
+// fractional seconds and time zone offset) into a go Time. Values
+// without a time zone offset are interpreted using loc.
+func convTimestamp(loc *time.Location, val string) (time.Time, error) {
+	for _, f := range []string{"2006-01-02 15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999Z07:00"} {
+		if t, err := time.Parse(f, val); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", strings.Replace(val, "T", " ", 1), loc)
+	if err != nil {
+		return t, fmt.Errorf("can't convert to timestamp: %w", err)
+	}
+	return t, nil
+}
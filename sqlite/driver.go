@@ -0,0 +1,77 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlite implements a source driver for SQLite database files.
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func init() {
+	source.Register("sqlite", infoSchemaDriver{})
+}
+
+// infoSchemaDriver implements source.Driver (and source.Connector) for
+// SQLite database files. SQLite doesn't have an INFORMATION_SCHEMA,
+// but the driver plays the same role as the other infoSchemaDrivers,
+// using sqlite_master and SQLite's PRAGMAs.
+type infoSchemaDriver struct{}
+
+func (infoSchemaDriver) Kind() source.Kind { return source.SQL }
+
+func (infoSchemaDriver) ProcessSchema(conv *internal.Conv, src source.Source) error {
+	return ProcessInfoSchema(conv, src.DB, src.SampleSize)
+}
+
+func (infoSchemaDriver) SetRowStats(conv *internal.Conv, src source.Source) error {
+	SetRowStats(conv, src.DB)
+	return nil
+}
+
+func (infoSchemaDriver) ProcessData(conv *internal.Conv, src source.Source) error {
+	ProcessSQLData(conv, src.DB)
+	return nil
+}
+
+func (infoSchemaDriver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	return remapType(srcType, spType, mods)
+}
+
+// ConfigFromEnv builds a connection config using the SQLITEDB
+// environment variable, which specifies the path of the database file.
+func (infoSchemaDriver) ConfigFromEnv() (source.Config, error) {
+	c := source.Config{Database: os.Getenv("SQLITEDB")}
+	if c.Database == "" {
+		fmt.Printf("Please specify the database file using the SQLITEDB environment variable\n")
+		return c, fmt.Errorf("Could not connect to source database")
+	}
+	if _, err := os.Stat(c.Database); err != nil {
+		return c, fmt.Errorf("Could not open source database: %w", err)
+	}
+	return c, nil
+}
+
+// DataSourceName returns a URI filename for the database file. The
+// database is opened read-only.
+func (infoSchemaDriver) DataSourceName(c source.Config) (string, string) {
+	path := strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(c.Database)
+	return "sqlite3", "file:" + path + "?mode=ro"
+}
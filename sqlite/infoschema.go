@@ -0,0 +1,518 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3" // The driver should be used via the database/sql package.
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+)
+
+const (
+	// Storage classes reported by SQLite's typeof function. We use
+	// them (in upper case) as the source type of columns whose type is
+	// inferred from data.
+	storageNull    = "null"
+	storageInteger = "integer"
+	storageReal    = "real"
+	storageText    = "text"
+
+	// Thresholds used to infer types from data (see inferType). These
+	// match the thresholds used by the dynamodb driver.
+	errThreshold      = float64(0.001)
+	conflictThreshold = float64(0.05)
+)
+
+// ProcessInfoSchema performs schema conversion for source database
+// 'db'. SQLite doesn't support INFORMATION_SCHEMA, so we use the
+// sqlite_master table and SQLite's PRAGMA functions to obtain the
+// schema. Columns that don't have a declared type are typed using a
+// sample of up to sampleSize rows of data.
+func ProcessInfoSchema(conv *internal.Conv, db *sql.DB, sampleSize int64) error {
+	tables, err := getTables(db)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := processTable(conv, db, t, sampleSize); err != nil {
+			return err
+		}
+	}
+	resolveForeignKeys(conv)
+	if err := internal.SchemaToDDL(conv, toSpannerType); err != nil {
+		return err
+	}
+	conv.AddPrimaryKeys()
+	return nil
+}
+
+// ProcessSQLData performs data conversion for source database
+// 'db'. For each table, we extract data using a "SELECT (colNamesList)"
+// query, convert the data to Spanner data (based on the source and
+// Spanner schemas), and write it to Spanner. If we can't get/process
+// data for a table, we skip that table and process the remaining tables.
+func ProcessSQLData(conv *internal.Conv, db *sql.DB) {
+	// TODO: refactor to use the set of tables computed by
+	// ProcessInfoSchema instead of computing them again.
+	tables, err := getTables(db)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get list of table: %s", err))
+		return
+	}
+	for _, t := range tables {
+		srcTable := t.name
+		srcSchema, ok := conv.SrcSchema[srcTable]
+		if !ok {
+			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
+			conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
+			continue
+		}
+		if len(srcSchema.ColNames) == 0 {
+			conv.Unexpected(fmt.Sprintf("Couldn't get source columns for table %s ", srcTable))
+			continue
+		}
+		var colNames []string
+		for _, c := range srcSchema.ColNames {
+			colNames = append(colNames, quoteIdent(c))
+		}
+		// Primary key order keeps rows in the same order across runs,
+		// which resuming a migration relies on.
+		q := fmt.Sprintf("SELECT %s FROM %s%s", strings.Join(colNames, ", "), quoteIdent(srcTable), orderBy(srcSchema))
+		rows, err := db.Query(q)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't get data for table %s : err = %s", srcTable, err))
+			continue
+		}
+		defer rows.Close()
+		srcCols, err1 := rows.Columns()
+		spTable, err2 := internal.GetSpannerTable(conv, srcTable)
+		spCols, err3 := internal.GetSpannerCols(conv, srcTable, srcCols)
+		spSchema, ok := conv.SpSchema[spTable]
+		if err1 != nil || err2 != nil || err3 != nil || !ok {
+			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
+			conv.Unexpected(fmt.Sprintf("Can't get cols and schemas for table %s: err1=%s, err2=%s, err3=%s, ok=%t",
+				srcTable, err1, err2, err3, ok))
+			continue
+		}
+		v, iv := buildVals(len(srcCols))
+		for rows.Next() {
+			err := rows.Scan(iv...)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+				// Scan failed, so we don't have any data to add to bad rows.
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				continue
+			}
+			cvtCols, cvtVals, err := ConvertSQLRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, v)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				conv.CollectBadRow(srcTable, srcCols, valsToStrings(v))
+				continue
+			}
+			conv.WriteRow(srcTable, spTable, cvtCols, cvtVals)
+		}
+	}
+}
+
+// SetRowStats populates conv with the number of rows in each table.
+func SetRowStats(conv *internal.Conv, db *sql.DB) {
+	// TODO: refactor to use the set of tables computed by
+	// ProcessInfoSchema instead of computing them again.
+	tables, err := getTables(db)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get list of table: %s", err))
+		return
+	}
+	for _, t := range tables {
+		q := fmt.Sprintf("SELECT COUNT(*) FROM %s", quoteIdent(t.name))
+		rows, err := db.Query(q)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't get number of rows for table %s", t.name))
+			continue
+		}
+		defer rows.Close()
+		var count int64
+		if rows.Next() {
+			err := rows.Scan(&count)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Can't get row count: %s", err))
+				continue
+			}
+			conv.Stats.Rows[t.name] += count
+		}
+	}
+}
+
+type tableAndSQL struct {
+	name string
+	sql  string // The CREATE TABLE statement for the table.
+}
+
+// getTables returns the list of tables in the database. We skip
+// SQLite's internal tables (e.g. sqlite_sequence) and virtual tables.
+func getTables(db *sql.DB) ([]tableAndSQL, error) {
+	q := `SELECT name, sql FROM sqlite_master
+              WHERE type = 'table' AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+                AND sql NOT LIKE 'CREATE VIRTUAL TABLE%'
+              ORDER BY name`
+	rows, err := db.Query(q)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get tables: %w", err)
+	}
+	defer rows.Close()
+	var name string
+	var stmt sql.NullString
+	var tables []tableAndSQL
+	for rows.Next() {
+		rows.Scan(&name, &stmt)
+		tables = append(tables, tableAndSQL{name: name, sql: stmt.String})
+	}
+	return tables, nil
+}
+
+func processTable(conv *internal.Conv, db *sql.DB, table tableAndSQL, sampleSize int64) error {
+	colDefs, colNames, primaryKeys, err := getColumns(conv, db, table)
+	if err != nil {
+		return fmt.Errorf("couldn't get schema for table %s: %s", table.name, err)
+	}
+	for _, c := range colNames {
+		cd := colDefs[c]
+		if cd.Type.Name != "" && cd.Type.Name != "ANY" {
+			continue
+		}
+		ty, err := inferColumnType(db, table.name, c, sampleSize)
+		if err != nil {
+			return fmt.Errorf("couldn't infer type of column %s of table %s: %s", c, table.name, err)
+		}
+		cd.Type.Name = ty
+		colDefs[c] = cd
+	}
+	foreignKeys, err := getForeignKeys(conv, db, table.name)
+	if err != nil {
+		return fmt.Errorf("couldn't get foreign key constraints for table %s: %s", table.name, err)
+	}
+	indexes, err := getIndexes(conv, db, table.name)
+	if err != nil {
+		return fmt.Errorf("couldn't get indexes for table %s: %s", table.name, err)
+	}
+	conv.SrcSchema[table.name] = schema.Table{
+		Name:        table.name,
+		ColNames:    colNames,
+		ColDefs:     colDefs,
+		PrimaryKeys: primaryKeys,
+		Indexes:     indexes,
+		ForeignKeys: foreignKeys}
+	return nil
+}
+
+// autoIncrement matches SQLite's AUTOINCREMENT keyword, which can
+// only be used on an INTEGER PRIMARY KEY column.
+var autoIncrement = regexp.MustCompile(`(?i)\bAUTOINCREMENT\b`)
+
+// getColumns returns the columns and primary key of table, using
+// PRAGMA table_info. SQLite reports the position of each primary key
+// column in the pk column (and 0 for columns that aren't part of the
+// primary key).
+func getColumns(conv *internal.Conv, db *sql.DB, table tableAndSQL) (map[string]schema.Column, []string, []schema.Key, error) {
+	q := `SELECT name, type, "notnull", dflt_value, pk FROM pragma_table_info(?) ORDER BY cid`
+	rows, err := db.Query(q, table.name)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+	colDefs := make(map[string]schema.Column)
+	var colNames []string
+	pkPos := make(map[string]int64)
+	var colName, colType string
+	var notNull bool
+	var colDefault sql.NullString
+	var pk int64
+	for rows.Next() {
+		err := rows.Scan(&colName, &colType, &notNull, &colDefault, &pk)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		ignored := schema.Ignored{}
+		ignored.Default = colDefault.Valid
+		if pk > 0 {
+			pkPos[colName] = pk
+		}
+		colDefs[colName] = schema.Column{
+			Name:    colName,
+			Type:    toType(colType),
+			NotNull: notNull,
+			Ignored: ignored,
+		}
+		colNames = append(colNames, colName)
+	}
+	var pkCols []string
+	for c := range pkPos {
+		pkCols = append(pkCols, c)
+	}
+	sort.Slice(pkCols, func(i, j int) bool { return pkPos[pkCols[i]] < pkPos[pkCols[j]] })
+	var primaryKeys []schema.Key
+	for _, c := range pkCols {
+		primaryKeys = append(primaryKeys, schema.Key{Column: c})
+	}
+	if len(pkCols) == 1 && autoIncrement.MatchString(table.sql) {
+		cd := colDefs[pkCols[0]]
+		cd.Ignored.AutoIncrement = true
+		colDefs[pkCols[0]] = cd
+	}
+	return colDefs, colNames, primaryKeys, nil
+}
+
+// inferColumnType infers the type of a column without a declared type
+// from a sample of its data. The approach is the same as the dynamodb
+// driver's inferDataTypes: storage classes that appear in only a tiny
+// fraction of rows are treated as errors and ignored, and if more than
+// one storage class remains (with the exception of a mix of integer
+// and real values, which we type as real), we fall back to text.
+// Columns with no data are typed as text. If sampleSize isn't positive,
+// all rows are sampled.
+func inferColumnType(db *sql.DB, table, col string, sampleSize int64) (string, error) {
+	if sampleSize <= 0 {
+		sampleSize = -1 // SQLite treats a negative limit as no limit.
+	}
+	q := fmt.Sprintf("SELECT typeof(c), COUNT(*) FROM (SELECT %s AS c FROM %s LIMIT ?) GROUP BY typeof(c)", quoteIdent(col), quoteIdent(table))
+	rows, err := db.Query(q, sampleSize)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	counts := make(map[string]int64)
+	var storage string
+	var count int64
+	for rows.Next() {
+		if err := rows.Scan(&storage, &count); err != nil {
+			return "", err
+		}
+		counts[storage] = count
+	}
+	return strings.ToUpper(inferType(counts)), nil
+}
+
+// inferType picks a storage class for a column given the number of
+// sampled rows for each storage class.
+func inferType(counts map[string]int64) string {
+	var rows, presentRows int64
+	for k, v := range counts {
+		rows += v
+		if k != storageNull {
+			presentRows += v
+		}
+	}
+	var candidates []string
+	for k, v := range counts {
+		if k == storageNull || float64(v)/float64(rows) <= errThreshold {
+			// If the percentage is less than the error threshold, then
+			// this storage class has a high chance to be mistakenly
+			// inserted and we should discard it.
+			continue
+		}
+		if float64(v)/float64(presentRows) > conflictThreshold {
+			candidates = append(candidates, k)
+		}
+	}
+	sort.Strings(candidates)
+	switch {
+	case len(candidates) == 1:
+		return candidates[0]
+	case len(candidates) == 2 && candidates[0] == storageInteger && candidates[1] == storageReal:
+		return storageReal
+	}
+	return storageText
+}
+
+// getForeignKeys returns the foreign keys of table, using PRAGMA
+// foreign_key_list. A foreign key that references the primary key of
+// the referenced table can omit the referenced columns; these are
+// filled in by resolveForeignKeys once all tables have been processed.
+func getForeignKeys(conv *internal.Conv, db *sql.DB, table string) ([]schema.ForeignKey, error) {
+	q := `SELECT id, "table", "from", "to" FROM pragma_foreign_key_list(?) ORDER BY id, seq`
+	rows, err := db.Query(q, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var id int64
+	var refTable, col string
+	var refCol sql.NullString
+	var foreignKeys []schema.ForeignKey
+	fkIndex := make(map[int64]int)
+	for rows.Next() {
+		if err := rows.Scan(&id, &refTable, &col, &refCol); err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		i, found := fkIndex[id]
+		if !found {
+			// SQLite doesn't record the names of foreign key constraints.
+			foreignKeys = append(foreignKeys, schema.ForeignKey{ReferTable: refTable})
+			i = len(foreignKeys) - 1
+			fkIndex[id] = i
+		}
+		foreignKeys[i].Columns = append(foreignKeys[i].Columns, col)
+		if refCol.Valid {
+			foreignKeys[i].ReferColumns = append(foreignKeys[i].ReferColumns, refCol.String)
+		}
+	}
+	return foreignKeys, nil
+}
+
+// resolveForeignKeys fills in the referenced columns of foreign keys
+// that implicitly reference the primary key of the referenced table.
+func resolveForeignKeys(conv *internal.Conv) {
+	for _, t := range conv.SrcSchema {
+		for i, fk := range t.ForeignKeys {
+			if len(fk.ReferColumns) > 0 {
+				continue
+			}
+			for _, k := range conv.SrcSchema[fk.ReferTable].PrimaryKeys {
+				fk.ReferColumns = append(fk.ReferColumns, k.Column)
+			}
+			t.ForeignKeys[i] = fk
+		}
+	}
+}
+
+// getIndexes returns the indexes of table, using PRAGMA index_list and
+// PRAGMA index_xinfo. We include indexes created by CREATE INDEX and
+// by UNIQUE constraints, but skip the index used to implement the
+// primary key. We also skip partial indexes and indexes on
+// expressions, since Spanner doesn't support them.
+func getIndexes(conv *internal.Conv, db *sql.DB, table string) ([]schema.Index, error) {
+	q := `SELECT il.name, il."unique", ix.name, ix."desc"
+              FROM pragma_index_list(?) AS il, pragma_index_xinfo(il.name) AS ix
+              WHERE il.origin != 'pk' AND il.partial = 0 AND ix.key = 1
+              ORDER BY il.name, ix.seqno`
+	rows, err := db.Query(q, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var name string
+	var column sql.NullString
+	var unique, desc bool
+	indexMap := make(map[string]schema.Index)
+	skip := make(map[string]bool)
+	var indexNames []string
+	for rows.Next() {
+		if err := rows.Scan(&name, &unique, &column, &desc); err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		if !column.Valid {
+			// Index on an expression.
+			skip[name] = true
+			continue
+		}
+		if _, found := indexMap[name]; !found {
+			indexNames = append(indexNames, name)
+			indexMap[name] = schema.Index{Name: name, Unique: unique}
+		}
+		index := indexMap[name]
+		index.Keys = append(index.Keys, schema.Key{Column: column.String, Desc: desc})
+		indexMap[name] = index
+	}
+	var indexes []schema.Index
+	for _, k := range indexNames {
+		if !skip[k] {
+			indexes = append(indexes, indexMap[k])
+		}
+	}
+	return indexes, nil
+}
+
+// typeMods matches the modifiers of a declared type e.g. the "(10, 2)"
+// of "DECIMAL(10, 2)".
+var typeMods = regexp.MustCompile(`^([^(]*)\(\s*([+-]?[0-9]+)\s*(?:,\s*([+-]?[0-9]+)\s*)?\)$`)
+
+// toType builds a schema.Type from a column's declared type. SQLite
+// accepts almost anything as a type name, so we just normalize the
+// name to upper case and split off numeric modifiers.
+func toType(declType string) schema.Type {
+	declType = strings.ToUpper(strings.TrimSpace(declType))
+	m := typeMods.FindStringSubmatch(declType)
+	if m == nil {
+		return schema.Type{Name: declType}
+	}
+	var mods []int64
+	for _, s := range m[2:] {
+		if s == "" {
+			continue
+		}
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return schema.Type{Name: declType}
+		}
+		mods = append(mods, i)
+	}
+	return schema.Type{Name: strings.TrimSpace(m[1]), Mods: mods}
+}
+
+// buildVals contructs interface{} value containers to scan row
+// results into.  Returns both the underlying containers (as a slice)
+// as well as an interface{} of pointers to containers to pass to
+// rows.Scan.
+func buildVals(n int) (v []interface{}, iv []interface{}) {
+	v = make([]interface{}, n)
+	for i := range v {
+		iv = append(iv, &v[i])
+	}
+	return v, iv
+}
+
+func valsToStrings(vals []interface{}) []string {
+	toString := func(val interface{}) string {
+		if val == nil {
+			return "NULL"
+		}
+		return fmt.Sprintf("%v", val)
+	}
+	var s []string
+	for _, v := range vals {
+		s = append(s, toString(v))
+	}
+	return s
+}
+
+// quoteIdent quotes a SQLite identifier.
+func quoteIdent(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// orderBy returns an ORDER BY clause that sorts rows of table t by its
+// primary key, or "" if t has no primary key.
+func orderBy(t schema.Table) string {
+	var keys []string
+	for _, k := range t.PrimaryKeys {
+		keys = append(keys, quoteIdent(k.Column))
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
@@ -0,0 +1,248 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// Unlike the tests for the other SQL drivers, these tests use a real
+// (temporary) SQLite database rather than sqlmock.
+
+type spannerData struct {
+	table string
+	cols  []string
+	vals  []interface{}
+}
+
+func TestProcessInfoSchema(t *testing.T) {
+	db, cleanup := mkTestDB(t, []string{
+		`CREATE TABLE user (
+			user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name VARCHAR(100) NOT NULL UNIQUE,
+			active BOOLEAN DEFAULT 1,
+			balance DECIMAL(10, 2),
+			created DATETIME,
+			photo BLOB,
+			score REAL)`,
+		`CREATE INDEX ix_created ON user (created DESC, name)`,
+		`CREATE INDEX ix_expr ON user (lower(name))`,
+		`CREATE INDEX ix_partial ON user (score) WHERE score > 0`,
+		`CREATE TABLE cart (
+			user_id INTEGER NOT NULL REFERENCES user,
+			product TEXT NOT NULL,
+			qty,
+			note,
+			extra,
+			FOREIGN KEY (product) REFERENCES product (name))`,
+		`CREATE TABLE product (name TEXT PRIMARY KEY, weird MONEY)`,
+		`INSERT INTO cart (user_id, product, qty, note) VALUES (1, 'a', 1, 'x'), (1, 'b', 2.5, 3), (2, 'c', 3, x'00')`,
+	})
+	defer cleanup()
+	conv := internal.MakeConv()
+	err := ProcessInfoSchema(conv, db, 100)
+	assert.Nil(t, err)
+	expectedSchema := map[string]ddl.CreateTable{
+		"user": ddl.CreateTable{
+			Name:     "user",
+			ColNames: []string{"user_id", "name", "active", "balance", "created", "photo", "score"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"user_id": ddl.ColumnDef{Name: "user_id", T: ddl.Type{Name: ddl.Int64}},
+				"name":    ddl.ColumnDef{Name: "name", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, NotNull: true},
+				"active":  ddl.ColumnDef{Name: "active", T: ddl.Type{Name: ddl.Bool}},
+				"balance": ddl.ColumnDef{Name: "balance", T: ddl.Type{Name: ddl.Numeric}},
+				"created": ddl.ColumnDef{Name: "created", T: ddl.Type{Name: ddl.Timestamp}},
+				"photo":   ddl.ColumnDef{Name: "photo", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
+				"score":   ddl.ColumnDef{Name: "score", T: ddl.Type{Name: ddl.Float64}},
+			},
+			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "user_id"}},
+			Indexes: []ddl.CreateIndex{
+				ddl.CreateIndex{Name: "ix_created", Table: "user", Keys: []ddl.IndexKey{ddl.IndexKey{Col: "created", Desc: true}, ddl.IndexKey{Col: "name"}}},
+				ddl.CreateIndex{Name: "sqlite_autoindex_user_1", Table: "user", Unique: true, Keys: []ddl.IndexKey{ddl.IndexKey{Col: "name"}}}},
+		},
+		"cart": ddl.CreateTable{
+			Name:     "cart",
+			ColNames: []string{"user_id", "product", "qty", "note", "extra", "synth_id"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"user_id":  ddl.ColumnDef{Name: "user_id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"product":  ddl.ColumnDef{Name: "product", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, NotNull: true},
+				"qty":      ddl.ColumnDef{Name: "qty", T: ddl.Type{Name: ddl.Float64}},
+				"note":     ddl.ColumnDef{Name: "note", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"extra":    ddl.ColumnDef{Name: "extra", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"synth_id": ddl.ColumnDef{Name: "synth_id", T: ddl.Type{Name: ddl.Int64}},
+			},
+			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "synth_id"}},
+			Fks: []ddl.Foreignkey{
+				ddl.Foreignkey{Name: "", Columns: []string{"product"}, ReferTable: "product", ReferColumns: []string{"name"}},
+				ddl.Foreignkey{Name: "", Columns: []string{"user_id"}, ReferTable: "user", ReferColumns: []string{"user_id"}}},
+		},
+		"product": ddl.CreateTable{
+			Name:     "product",
+			ColNames: []string{"name", "weird"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"name":  ddl.ColumnDef{Name: "name", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"weird": ddl.ColumnDef{Name: "weird", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+			},
+			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "name"}},
+		},
+	}
+	assert.Equal(t, expectedSchema, stripSchemaComments(conv.SpSchema))
+	assert.Equal(t, schema.Type{Name: "REAL"}, conv.SrcSchema["cart"].ColDefs["qty"].Type)
+	assert.Equal(t, schema.Type{Name: "TEXT"}, conv.SrcSchema["cart"].ColDefs["note"].Type)
+	assert.Equal(t, schema.Type{Name: "DECIMAL", Mods: []int64{10, 2}}, conv.SrcSchema["user"].ColDefs["balance"].Type)
+	assert.Equal(t, 3, len(conv.Issues["user"]))
+	assert.Equal(t, []internal.SchemaIssue{internal.AutoIncrement}, conv.Issues["user"]["user_id"])
+	assert.Equal(t, []internal.SchemaIssue{internal.DefaultValue}, conv.Issues["user"]["active"])
+	assert.Equal(t, []internal.SchemaIssue{internal.DatetimeNoOffset}, conv.Issues["user"]["created"])
+	assert.Equal(t, []internal.SchemaIssue{internal.NoGoodType}, conv.Issues["product"]["weird"])
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+}
+
+func TestProcessSQLData(t *testing.T) {
+	db, cleanup := mkTestDB(t, []string{
+		`CREATE TABLE "te st" ("a a" INTEGER, " b" DATETIME, " c " BOOLEAN, d NUMERIC)`,
+		`INSERT INTO "te st" VALUES (42, '2021-03-04 05:06:07', 1, 1.5), (6, NULL, 0, 2), ('dog', NULL, NULL, NULL)`,
+	})
+	defer cleanup()
+	conv := internal.MakeConv()
+	assert.Nil(t, ProcessInfoSchema(conv, db, 100))
+	conv.SetDataMode()
+	var rows []spannerData
+	conv.SetDataSink(
+		func(table string, cols []string, vals []interface{}) {
+			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
+		})
+	ProcessSQLData(conv, db)
+	assert.Equal(t,
+		[]spannerData{
+			spannerData{table: "te_st", cols: []string{"a_a", "Ab", "Ac_", "d", "synth_id"}, vals: []interface{}{int64(42), time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC), true, "1.500000000", int64(0)}},
+			spannerData{table: "te_st", cols: []string{"a_a", "Ac_", "d", "synth_id"}, vals: []interface{}{int64(6), false, "2.000000000", int64(-9223372036854775808)}},
+		},
+		rows)
+	assert.Equal(t, conv.BadRows(), int64(1)) // 'dog' can't be converted to INT64.
+	assert.Equal(t, int64(1), conv.Unexpecteds())
+}
+
+func TestConvertSQLRow(t *testing.T) {
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 8900000, time.UTC)
+	tc := []struct {
+		name    string
+		srcType schema.Type
+		spType  ddl.Type
+		in      interface{} // Input value for conversion.
+		e       interface{} // Expected result.
+	}{
+		{"boolean", schema.Type{Name: "BOOLEAN"}, ddl.Type{Name: ddl.Bool}, true, true},
+		{"int to bool", schema.Type{Name: "BOOLEAN"}, ddl.Type{Name: ddl.Bool}, int64(0), false},
+		{"integer", schema.Type{Name: "INTEGER"}, ddl.Type{Name: ddl.Int64}, int64(42), int64(42)},
+		{"integer as text", schema.Type{Name: "INTEGER"}, ddl.Type{Name: ddl.Int64}, "42", int64(42)},
+		{"real", schema.Type{Name: "REAL"}, ddl.Type{Name: ddl.Float64}, float64(42.5), float64(42.5)},
+		{"int to real", schema.Type{Name: "REAL"}, ddl.Type{Name: ddl.Float64}, int64(42), float64(42)},
+		{"decimal", schema.Type{Name: "DECIMAL", Mods: []int64{10, 2}}, ddl.Type{Name: ddl.Numeric}, float64(1234.56), "1234.560000000"},
+		{"text", schema.Type{Name: "TEXT"}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, "héllo", "héllo"},
+		{"int to text", schema.Type{Name: "TEXT"}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, int64(3), "3"},
+		{"blob", schema.Type{Name: "BLOB"}, ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, []byte{0x1, 0xab}, []byte{0x1, 0xab}},
+		{"date", schema.Type{Name: "DATE"}, ddl.Type{Name: ddl.Date}, tm, civil.Date{Year: 2021, Month: 3, Day: 4}},
+		{"datetime", schema.Type{Name: "DATETIME"}, ddl.Type{Name: ddl.Timestamp}, tm, tm},
+		{"datetime string", schema.Type{Name: "DATETIME"}, ddl.Type{Name: ddl.Timestamp}, "2021-03-04T05:06:07.0089Z", tm},
+		{"datetime unix time", schema.Type{Name: "DATETIME"}, ddl.Type{Name: ddl.Timestamp}, int64(1614834367), time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)},
+	}
+	conv := internal.MakeConv()
+	conv.Location = time.UTC
+	for _, tc := range tc {
+		_, vals, err := ConvertSQLRow(conv, "t", []string{"a"}, schema.Table{ColDefs: map[string]schema.Column{"a": schema.Column{Name: "a", Type: tc.srcType}}},
+			"t", []string{"a"}, ddl.CreateTable{ColDefs: map[string]ddl.ColumnDef{"a": ddl.ColumnDef{Name: "a", T: tc.spType}}}, []interface{}{tc.in})
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, []interface{}{tc.e}, vals, tc.name)
+	}
+}
+
+func TestSetRowStats(t *testing.T) {
+	db, cleanup := mkTestDB(t, []string{
+		`CREATE TABLE test1 (a INTEGER)`,
+		`CREATE TABLE test2 (a INTEGER)`,
+		`INSERT INTO test1 VALUES (1), (2), (3)`,
+		`INSERT INTO test2 VALUES (1)`,
+	})
+	defer cleanup()
+	conv := internal.MakeConv()
+	conv.SetDataMode()
+	SetRowStats(conv, db)
+	assert.Equal(t, int64(3), conv.Stats.Rows["test1"])
+	assert.Equal(t, int64(1), conv.Stats.Rows["test2"])
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+}
+
+func TestInferType(t *testing.T) {
+	assert.Equal(t, "integer", inferType(map[string]int64{"integer": 100, "null": 20}))
+	assert.Equal(t, "real", inferType(map[string]int64{"integer": 50, "real": 50}))
+	assert.Equal(t, "text", inferType(map[string]int64{"integer": 50, "text": 50}))
+	assert.Equal(t, "integer", inferType(map[string]int64{"integer": 10000, "text": 1})) // Ignore rare errors.
+	assert.Equal(t, "text", inferType(map[string]int64{"null": 10}))
+	assert.Equal(t, "text", inferType(map[string]int64{}))
+}
+
+func TestToType(t *testing.T) {
+	assert.Equal(t, schema.Type{Name: "VARCHAR", Mods: []int64{10}}, toType("varchar(10)"))
+	assert.Equal(t, schema.Type{Name: "DECIMAL", Mods: []int64{10, 2}}, toType("DECIMAL( 10 , 2 )"))
+	assert.Equal(t, schema.Type{Name: "UNSIGNED BIG INT"}, toType("unsigned big int"))
+	assert.Equal(t, schema.Type{Name: ""}, toType(""))
+}
+
+func TestQuoteIdent(t *testing.T) {
+	assert.Equal(t, `"a b"`, quoteIdent("a b"))
+	assert.Equal(t, `"a""b"`, quoteIdent(`a"b`))
+}
+
+// mkTestDB creates a temporary SQLite database, initialized using
+// stmts. The caller should call cleanup when done with the database.
+func mkTestDB(t *testing.T, stmts []string) (db *sql.DB, cleanup func()) {
+	dir, err := ioutil.TempDir("", "sqlite_test")
+	assert.Nil(t, err)
+	db, err = sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	assert.Nil(t, err)
+	for _, s := range stmts {
+		_, err := db.Exec(s)
+		assert.Nil(t, err, s)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func stripSchemaComments(spSchema map[string]ddl.CreateTable) map[string]ddl.CreateTable {
+	for t, ct := range spSchema {
+		for c, cd := range ct.ColDefs {
+			cd.Comment = ""
+			ct.ColDefs[c] = cd
+		}
+		ct.Comment = ""
+		spSchema[t] = ct
+	}
+	return spSchema
+}
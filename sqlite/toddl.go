@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"strings"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// toSpannerType maps a scalar source schema type (defined by id and
+// mods) into a Spanner type. This is the core source-to-Spanner type
+// mapping.  toSpannerType returns the Spanner type and a list of type
+// conversion issues encountered.
+//
+// SQLite accepts (almost) any type name, and only uses it to pick the
+// column's type affinity. We follow SQLite's rules for determining
+// affinity (see https://www.sqlite.org/datatype3.html), and refine
+// the mapping for common type names with NUMERIC affinity. Note that
+// SQLite doesn't enforce lengths (e.g. VARCHAR(10) can store longer
+// strings), so character types always map to STRING(MAX).
+func toSpannerType(conv *internal.Conv, id string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	switch affinity(id) {
+	case integerAffinity:
+		return ddl.Type{Name: ddl.Int64}, nil
+	case textAffinity:
+		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+	case blobAffinity:
+		return ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil
+	case realAffinity:
+		return ddl.Type{Name: ddl.Float64}, nil
+	}
+	switch id {
+	case "BOOL", "BOOLEAN":
+		return ddl.Type{Name: ddl.Bool}, nil
+	case "DATE":
+		return ddl.Type{Name: ddl.Date}, nil
+	case "DATETIME", "TIMESTAMP":
+		return ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.DatetimeNoOffset}
+	case "NUMERIC", "DECIMAL":
+		return ddl.Type{Name: ddl.Numeric}, nil
+	}
+	return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}
+}
+
+type typeAffinity int
+
+const (
+	integerAffinity typeAffinity = iota
+	textAffinity
+	blobAffinity
+	realAffinity
+	numericAffinity
+)
+
+// affinity returns the type affinity of a column with declared type
+// name id, using the rules from section 3.1 of
+// https://www.sqlite.org/datatype3.html (in order).
+func affinity(id string) typeAffinity {
+	switch {
+	case strings.Contains(id, "INT"):
+		return integerAffinity
+	case strings.Contains(id, "CHAR") || strings.Contains(id, "CLOB") || strings.Contains(id, "TEXT"):
+		return textAffinity
+	case strings.Contains(id, "BLOB") || id == "":
+		return blobAffinity
+	case strings.Contains(id, "REAL") || strings.Contains(id, "FLOA") || strings.Contains(id, "DOUB"):
+		return realAffinity
+	}
+	return numericAffinity
+}
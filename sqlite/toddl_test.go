@@ -0,0 +1,74 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func TestToSpannerType(t *testing.T) {
+	tc := []struct {
+		srcType string
+		mods    []int64
+		ty      ddl.Type
+		issues  []internal.SchemaIssue
+	}{
+		{"INTEGER", nil, ddl.Type{Name: ddl.Int64}, nil},
+		{"UNSIGNED BIG INT", nil, ddl.Type{Name: ddl.Int64}, nil},
+		{"POINT", nil, ddl.Type{Name: ddl.Int64}, nil}, // Contains "INT", so it has integer affinity.
+		{"VARCHAR", []int64{20}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil},
+		{"CLOB", nil, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil},
+		{"BLOB", nil, ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil},
+		{"", nil, ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil},
+		{"DOUBLE PRECISION", nil, ddl.Type{Name: ddl.Float64}, nil},
+		{"FLOAT", nil, ddl.Type{Name: ddl.Float64}, nil},
+		{"BOOLEAN", nil, ddl.Type{Name: ddl.Bool}, nil},
+		{"DATE", nil, ddl.Type{Name: ddl.Date}, nil},
+		{"DATETIME", nil, ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.DatetimeNoOffset}},
+		{"DECIMAL", []int64{10, 5}, ddl.Type{Name: ddl.Numeric}, nil},
+		{"MONEY", nil, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}},
+	}
+	for _, tc := range tc {
+		ty, issues := toSpannerType(nil, tc.srcType, tc.mods)
+		assert.Equal(t, tc.ty, ty, tc.srcType)
+		assert.Equal(t, tc.issues, issues, tc.srcType)
+	}
+}
+
+func TestRemapType(t *testing.T) {
+	tc := []struct {
+		srcType string
+		spType  string
+		ty      ddl.Type
+		issues  []internal.SchemaIssue
+	}{
+		{"INTEGER", ddl.String, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.Widened}},
+		{"INTEGER", ddl.Numeric, ddl.Type{Name: ddl.Numeric}, nil},
+		{"BOOLEAN", ddl.Float64, ddl.Type{Name: ddl.Float64}, nil},
+		{"TEXT", ddl.Bytes, ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil},
+		{"BLOB", ddl.String, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil},
+		{"REAL", ddl.Int64, ddl.Type{Name: ddl.Float64}, nil},
+	}
+	for _, tc := range tc {
+		ty, issues := remapType(tc.srcType, tc.spType, []int64{20})
+		assert.Equal(t, tc.ty, ty, tc.srcType+" to "+tc.spType)
+		assert.Equal(t, tc.issues, issues, tc.srcType+" to "+tc.spType)
+	}
+}
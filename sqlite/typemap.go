@@ -0,0 +1,56 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite
+
+import (
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// remapType maps source type srcType (with modifiers mods) to Spanner
+// type spType, if spType is a potential mapping for srcType. If not,
+// the default Spanner type for srcType (as computed by toSpannerType)
+// is used. remapType is used to implement source.Driver's
+// ToSpannerType (which the web UI uses to change types after schema
+// conversion).
+//
+// As with the sqlserver version, every type can also be mapped to
+// STRING and text types can be mapped to BYTES. Since SQLite doesn't
+// enforce column types, types with integer and numeric affinity can
+// also be mapped to any of Spanner's numeric types.
+func remapType(srcType string, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	ty, issues := toSpannerType(nil, srcType, mods)
+	switch spType {
+	case ddl.String:
+		switch ty.Name {
+		case ddl.String:
+			return ty, issues
+		case ddl.Bytes:
+			return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+		default:
+			return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.Widened}
+		}
+	case ddl.Bytes:
+		if affinity(srcType) == textAffinity {
+			return ddl.Type{Name: ddl.Bytes, Len: ty.Len}, nil
+		}
+	case ddl.Float64, ddl.Numeric:
+		switch affinity(srcType) {
+		case integerAffinity, numericAffinity:
+			return ddl.Type{Name: spType}, nil
+		}
+	}
+	return ty, issues
+}
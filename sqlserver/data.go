@@ -0,0 +1,91 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlserver
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// ConvertSQLRow performs data conversion for a single row of data
+// returned from a SELECT query (see internal.ConvertSQLRow).
+func ConvertSQLRow(conv *internal.Conv, srcTable string, srcCols []string, srcSchema schema.Table, spTable string, spCols []string, spSchema ddl.CreateTable, srcVals []interface{}) ([]string, []interface{}, error) {
+	return internal.ConvertSQLRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, srcVals, cvtSQLScalar)
+}
+
+// cvtSQLScalar converts a value returned from a SQL query to a
+// Spanner value. Note that the caller is responsible for handling nil
+// values (used to represent NULL). The SQL Server driver returns
+// values of the following types:
+//
+//	bool (bit)
+//	[]byte (binary types, rowversion, decimal, numeric and money)
+//	int64 (integer types)
+//	float64 (real and float)
+//	string (character types)
+//	time.Time (date and time types)
+//
+// Binary values converted to strings, and time values, need SQL
+// Server-specific handling; other values are converted by
+// internal.CvtSQLScalar.
+func cvtSQLScalar(conv *internal.Conv, srcCd schema.Column, spCd ddl.ColumnDef, val interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case []byte:
+		if spCd.T.Name == ddl.String && isBinary(srcCd.Type.Name) {
+			return "0x" + strings.ToUpper(hex.EncodeToString(v)), nil
+		}
+	case string:
+		if spCd.T.Name == ddl.Timestamp {
+			return convTimestamp(conv.Location, v)
+		}
+	case time.Time:
+		// The driver uses time.Time for SQL Server's time type (with a
+		// date of 0001-01-01), so for time columns we just print the
+		// time of day.
+		if spCd.T.Name == ddl.String && srcCd.Type.Name == "time" {
+			return v.Format("15:04:05.9999999"), nil
+		}
+	}
+	return internal.CvtSQLScalar(spCd, val)
+}
+
+// convTimestamp maps a SQL Server datetime string (with optional
+// fractional seconds and time zone offset) into a go Time. Values
+// without a time zone offset are interpreted using loc.
+func convTimestamp(loc *time.Location, val string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02 15:04:05.9999999 -07:00", val)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.ParseInLocation("2006-01-02 15:04:05.9999999", val, loc)
+	if err != nil {
+		return t, fmt.Errorf("can't convert to timestamp: %w", err)
+	}
+	return t, nil
+}
+
+func isBinary(srcTypeName string) bool {
+	switch srcTypeName {
+	case "binary", "varbinary", "image", "timestamp", "rowversion":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqlserver implements a source driver for Microsoft SQL Server.
+package sqlserver
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func init() {
+	source.Register("sqlserver", infoSchemaDriver{})
+}
+
+// infoSchemaDriver implements source.Driver (and source.Connector) for
+// direct connections to a SQL Server database.
+type infoSchemaDriver struct{}
+
+func (infoSchemaDriver) Kind() source.Kind { return source.SQL }
+
+func (infoSchemaDriver) ProcessSchema(conv *internal.Conv, src source.Source) error {
+	return ProcessInfoSchema(conv, src.DB)
+}
+
+func (infoSchemaDriver) SetRowStats(conv *internal.Conv, src source.Source) error {
+	SetRowStats(conv, src.DB)
+	return nil
+}
+
+func (infoSchemaDriver) ProcessData(conv *internal.Conv, src source.Source) error {
+	ProcessSQLData(conv, src.DB)
+	return nil
+}
+
+func (infoSchemaDriver) ToSpannerType(srcType, spType string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	return remapType(srcType, spType, mods)
+}
+
+// ConfigFromEnv builds a connection config using the MSSQLHOST,
+// MSSQLPORT, MSSQLUSER, MSSQLDATABASE and MSSQLPWD environment variables.
+func (infoSchemaDriver) ConfigFromEnv() (source.Config, error) {
+	c := source.Config{
+		Host:     os.Getenv("MSSQLHOST"),
+		Port:     os.Getenv("MSSQLPORT"),
+		User:     os.Getenv("MSSQLUSER"),
+		Database: os.Getenv("MSSQLDATABASE"),
+		Password: os.Getenv("MSSQLPWD"),
+	}
+	if c.Host == "" || c.Port == "" || c.User == "" || c.Database == "" {
+		fmt.Printf("Please specify host, port, user and database using MSSQLHOST, MSSQLPORT, MSSQLUSER and MSSQLDATABASE environment variables\n")
+		return c, fmt.Errorf("Could not connect to source database")
+	}
+	return c, nil
+}
+
+func (infoSchemaDriver) DataSourceName(c source.Config) (string, string) {
+	u := url.URL{
+		Scheme:   "sqlserver",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, c.Port),
+		RawQuery: url.Values{"database": {c.Database}}.Encode(),
+	}
+	return "sqlserver", u.String()
+}
@@ -0,0 +1,499 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlserver
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	_ "github.com/denisenkom/go-mssqldb" // The driver should be used via the database/sql package.
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+)
+
+// ProcessInfoSchema performs schema conversion for source database
+// 'db'. We use SQL Server's INFORMATION_SCHEMA views for tables,
+// columns and constraints, and the sys catalog views for foreign keys
+// and indexes (which INFORMATION_SCHEMA doesn't fully describe).
+func ProcessInfoSchema(conv *internal.Conv, db *sql.DB) error {
+	tables, err := getTables(db)
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if err := processTable(conv, db, t); err != nil {
+			return err
+		}
+	}
+	if err := internal.SchemaToDDL(conv, toSpannerType); err != nil {
+		return err
+	}
+	conv.AddPrimaryKeys()
+	return nil
+}
+
+// ProcessSQLData performs data conversion for source database
+// 'db'. For each table, we extract data using a "SELECT (colNamesList)"
+// query, convert the data to Spanner data (based on the source and
+// Spanner schemas), and write it to Spanner. If we can't get/process
+// data for a table, we skip that table and process the remaining tables.
+//
+// As with the postgres driver, we pass *interface{} parameters to
+// rows.Scan and do all type conversions explicitly ourselves, so that
+// we can generate targeted error messages.
+func ProcessSQLData(conv *internal.Conv, db *sql.DB) {
+	// TODO: refactor to use the set of tables computed by
+	// ProcessInfoSchema instead of computing them again.
+	tables, err := getTables(db)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get list of table: %s", err))
+		return
+	}
+	for _, t := range tables {
+		srcTable := buildTableName(t.schema, t.name)
+		srcSchema, ok := conv.SrcSchema[srcTable]
+		if !ok {
+			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
+			conv.Unexpected(fmt.Sprintf("Can't get schemas for table %s", srcTable))
+			continue
+		}
+		if len(srcSchema.ColNames) == 0 {
+			conv.Unexpected(fmt.Sprintf("Couldn't get source columns for table %s ", srcTable))
+			continue
+		}
+		// Primary key order keeps rows in the same order across runs,
+		// which resuming a migration relies on.
+		q := fmt.Sprintf("SELECT %s FROM %s.%s%s;", buildColNameList(srcSchema), quoteIdent(t.schema), quoteIdent(t.name), orderBy(srcSchema))
+		rows, err := db.Query(q)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't get data for table %s : err = %s", srcTable, err))
+			continue
+		}
+		defer rows.Close()
+		srcCols, err1 := rows.Columns()
+		spTable, err2 := internal.GetSpannerTable(conv, srcTable)
+		spCols, err3 := internal.GetSpannerCols(conv, srcTable, srcCols)
+		spSchema, ok := conv.SpSchema[spTable]
+		if err1 != nil || err2 != nil || err3 != nil || !ok {
+			conv.Stats.BadRows[srcTable] += conv.Stats.Rows[srcTable]
+			conv.Unexpected(fmt.Sprintf("Can't get cols and schemas for table %s: err1=%s, err2=%s, err3=%s, ok=%t",
+				srcTable, err1, err2, err3, ok))
+			continue
+		}
+		v, iv := buildVals(len(srcCols))
+		for rows.Next() {
+			err := rows.Scan(iv...)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+				// Scan failed, so we don't have any data to add to bad rows.
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				continue
+			}
+			cvtCols, cvtVals, err := ConvertSQLRow(conv, srcTable, srcCols, srcSchema, spTable, spCols, spSchema, v)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Couldn't process sql data row: %s", err))
+				conv.StatsAddBadRow(srcTable, conv.DataMode())
+				conv.CollectBadRow(srcTable, srcCols, valsToStrings(v))
+				continue
+			}
+			conv.WriteRow(srcTable, spTable, cvtCols, cvtVals)
+		}
+	}
+}
+
+// buildColNameList builds the list of columns to select from a table.
+// Most columns are selected as-is, but a few SQL Server types are
+// converted to their string form on the server: the driver returns
+// uniqueidentifier as raw bytes (in SQL Server's mixed-endian byte
+// order), and there is no client-side representation of the CLR types
+// (hierarchyid, geometry, geography). Each column keeps its original
+// name so that results can be matched against the source schema.
+func buildColNameList(srcSchema schema.Table) string {
+	var l []string
+	for _, colName := range srcSchema.ColNames {
+		col := quoteIdent(colName)
+		switch srcSchema.ColDefs[colName].Type.Name {
+		case "uniqueidentifier":
+			col = fmt.Sprintf("CONVERT(VARCHAR(36), %s) AS %s", col, col)
+		case "hierarchyid", "geometry", "geography":
+			col = fmt.Sprintf("%s.ToString() AS %s", col, col)
+		}
+		l = append(l, col)
+	}
+	return strings.Join(l, ", ")
+}
+
+// SetRowStats populates conv with the number of rows in each table.
+func SetRowStats(conv *internal.Conv, db *sql.DB) {
+	// TODO: refactor to use the set of tables computed by
+	// ProcessInfoSchema instead of computing them again.
+	tables, err := getTables(db)
+	if err != nil {
+		conv.Unexpected(fmt.Sprintf("Couldn't get list of table: %s", err))
+		return
+	}
+	for _, t := range tables {
+		q := fmt.Sprintf("SELECT COUNT_BIG(*) FROM %s.%s;", quoteIdent(t.schema), quoteIdent(t.name))
+		tableName := buildTableName(t.schema, t.name)
+		rows, err := db.Query(q)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Couldn't get number of rows for table %s", tableName))
+			continue
+		}
+		defer rows.Close()
+		var count int64
+		if rows.Next() {
+			err := rows.Scan(&count)
+			if err != nil {
+				conv.Unexpected(fmt.Sprintf("Can't get row count: %s", err))
+				continue
+			}
+			conv.Stats.Rows[tableName] += count
+		}
+	}
+}
+
+type schemaAndName struct {
+	schema string // SQL Server schema (e.g. dbo).
+	name   string
+}
+
+func getTables(db *sql.DB) ([]schemaAndName, error) {
+	ignored := make(map[string]bool)
+	// Ignore all system schemas: we just want to convert user tables.
+	for _, s := range []string{"INFORMATION_SCHEMA", "sys", "guest"} {
+		ignored[s] = true
+	}
+	q := "SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE'"
+	rows, err := db.Query(q)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get tables: %w", err)
+	}
+	defer rows.Close()
+	var tableSchema, tableName string
+	var tables []schemaAndName
+	for rows.Next() {
+		rows.Scan(&tableSchema, &tableName)
+		if !ignored[tableSchema] {
+			tables = append(tables, schemaAndName{schema: tableSchema, name: tableName})
+		}
+	}
+	return tables, nil
+}
+
+func processTable(conv *internal.Conv, db *sql.DB, table schemaAndName) error {
+	cols, err := getColumns(table, db)
+	if err != nil {
+		return fmt.Errorf("couldn't get schema for table %s.%s: %s", table.schema, table.name, err)
+	}
+	defer cols.Close()
+	primaryKeys, constraints, err := getConstraints(conv, db, table)
+	if err != nil {
+		return fmt.Errorf("couldn't get constraints for table %s.%s: %s", table.schema, table.name, err)
+	}
+	foreignKeys, err := getForeignKeys(conv, db, table)
+	if err != nil {
+		return fmt.Errorf("couldn't get foreign key constraints for table %s.%s: %s", table.schema, table.name, err)
+	}
+	indexes, err := getIndexes(conv, db, table)
+	if err != nil {
+		return fmt.Errorf("couldn't get indexes for table %s.%s: %s", table.schema, table.name, err)
+	}
+	colDefs, colNames := processColumns(conv, cols, constraints)
+	name := buildTableName(table.schema, table.name)
+	var schemaPKeys []schema.Key
+	for _, k := range primaryKeys {
+		schemaPKeys = append(schemaPKeys, schema.Key{Column: k})
+	}
+	conv.SrcSchema[name] = schema.Table{
+		Name:        name,
+		ColNames:    colNames,
+		ColDefs:     colDefs,
+		PrimaryKeys: schemaPKeys,
+		Indexes:     indexes,
+		ForeignKeys: foreignKeys}
+	return nil
+}
+
+func getColumns(table schemaAndName, db *sql.DB) (*sql.Rows, error) {
+	q := `SELECT c.COLUMN_NAME, c.DATA_TYPE, c.IS_NULLABLE, c.COLUMN_DEFAULT, c.CHARACTER_MAXIMUM_LENGTH, c.NUMERIC_PRECISION, c.NUMERIC_SCALE,
+                COLUMNPROPERTY(OBJECT_ID(QUOTENAME(c.TABLE_SCHEMA) + '.' + QUOTENAME(c.TABLE_NAME)), c.COLUMN_NAME, 'IsIdentity')
+              FROM INFORMATION_SCHEMA.COLUMNS c
+              WHERE c.TABLE_SCHEMA = @p1 AND c.TABLE_NAME = @p2 ORDER BY c.ORDINAL_POSITION;`
+	return db.Query(q, table.schema, table.name)
+}
+
+func processColumns(conv *internal.Conv, cols *sql.Rows, constraints map[string][]string) (map[string]schema.Column, []string) {
+	colDefs := make(map[string]schema.Column)
+	var colNames []string
+	var colName, dataType, isNullable string
+	var colDefault sql.NullString
+	var charMaxLen, numericPrecision, numericScale, isIdentity sql.NullInt64
+	for cols.Next() {
+		err := cols.Scan(&colName, &dataType, &isNullable, &colDefault, &charMaxLen, &numericPrecision, &numericScale, &isIdentity)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		unique := false
+		ignored := schema.Ignored{}
+		for _, c := range constraints[colName] {
+			// c can be UNIQUE, PRIMARY KEY, FOREIGN KEY or CHECK
+			// We've already filtered out PRIMARY KEY.
+			switch c {
+			case "UNIQUE":
+				unique = true
+			case "CHECK":
+				ignored.Check = true
+			case "FOREIGN KEY", "PRIMARY KEY":
+				// Nothing to do here -- these are both handled elsewhere.
+			}
+		}
+		ignored.Default = colDefault.Valid
+		ignored.AutoIncrement = isIdentity.Valid && isIdentity.Int64 == 1
+		c := schema.Column{
+			Name:    colName,
+			Type:    toType(dataType, charMaxLen, numericPrecision, numericScale),
+			NotNull: toNotNull(conv, isNullable),
+			Unique:  unique,
+			Ignored: ignored,
+		}
+		colDefs[colName] = c
+		colNames = append(colNames, colName)
+	}
+	return colDefs, colNames
+}
+
+// getConstraints returns a list of primary keys and by-column map of
+// other constraints.  Note: we need to preserve ordinal order of
+// columns in primary key constraints.
+// Note that foreign key constraints are handled in getForeignKeys.
+func getConstraints(conv *internal.Conv, db *sql.DB, table schemaAndName) ([]string, map[string][]string, error) {
+	q := `SELECT k.COLUMN_NAME, t.CONSTRAINT_TYPE
+              FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS AS t
+                INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE AS k
+                  ON t.CONSTRAINT_NAME = k.CONSTRAINT_NAME AND t.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND t.TABLE_NAME = k.TABLE_NAME
+              WHERE k.TABLE_SCHEMA = @p1 AND k.TABLE_NAME = @p2 ORDER BY k.ORDINAL_POSITION;`
+	rows, err := db.Query(q, table.schema, table.name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var primaryKeys []string
+	var col, constraint string
+	m := make(map[string][]string)
+	for rows.Next() {
+		err := rows.Scan(&col, &constraint)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		if col == "" || constraint == "" {
+			conv.Unexpected(fmt.Sprintf("Got empty col or constraint"))
+			continue
+		}
+		switch constraint {
+		case "PRIMARY KEY":
+			primaryKeys = append(primaryKeys, col)
+		default:
+			m[col] = append(m[col], constraint)
+		}
+	}
+	return primaryKeys, m, nil
+}
+
+type fkConstraint struct {
+	name    string
+	table   string
+	refcols []string
+	cols    []string
+}
+
+// getForeignKeys returns a list of all the foreign key constraints.
+func getForeignKeys(conv *internal.Conv, db *sql.DB, table schemaAndName) (foreignKeys []schema.ForeignKey, err error) {
+	q := `SELECT
+		OBJECT_SCHEMA_NAME(fk.referenced_object_id),
+		OBJECT_NAME(fk.referenced_object_id),
+		COL_NAME(fkc.parent_object_id, fkc.parent_column_id),
+		COL_NAME(fkc.referenced_object_id, fkc.referenced_column_id),
+		fk.name
+		FROM sys.foreign_keys AS fk
+		INNER JOIN sys.foreign_key_columns AS fkc
+			ON fk.object_id = fkc.constraint_object_id
+		WHERE fk.parent_object_id = OBJECT_ID(QUOTENAME(@p1) + '.' + QUOTENAME(@p2))
+		ORDER BY fk.name, fkc.constraint_column_id;`
+	rows, err := db.Query(q, table.schema, table.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var refTable schemaAndName
+	var col, refCol, fKeyName string
+	fKeys := make(map[string]fkConstraint)
+	var keyNames []string
+	for rows.Next() {
+		err := rows.Scan(&refTable.schema, &refTable.name, &col, &refCol, &fKeyName)
+		if err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		if _, found := fKeys[fKeyName]; found {
+			fk := fKeys[fKeyName]
+			fk.cols = append(fk.cols, col)
+			fk.refcols = append(fk.refcols, refCol)
+			fKeys[fKeyName] = fk
+			continue
+		}
+		tableName := buildTableName(refTable.schema, refTable.name)
+		fKeys[fKeyName] = fkConstraint{name: fKeyName, table: tableName, refcols: []string{refCol}, cols: []string{col}}
+		keyNames = append(keyNames, fKeyName)
+	}
+	sort.Strings(keyNames)
+	for _, k := range keyNames {
+		foreignKeys = append(foreignKeys,
+			schema.ForeignKey{
+				Name:         fKeys[k].name,
+				Columns:      fKeys[k].cols,
+				ReferTable:   fKeys[k].table,
+				ReferColumns: fKeys[k].refcols})
+	}
+	return foreignKeys, nil
+}
+
+// getIndexes return a list of all indexes for the specified table.
+// We skip the primary key index, heaps (index type 0) and included
+// (non-key) columns.
+func getIndexes(conv *internal.Conv, db *sql.DB, table schemaAndName) ([]schema.Index, error) {
+	q := `SELECT i.name, COL_NAME(ic.object_id, ic.column_id), ic.key_ordinal, i.is_unique, ic.is_descending_key
+		FROM sys.indexes AS i
+		INNER JOIN sys.index_columns AS ic
+			ON i.object_id = ic.object_id AND i.index_id = ic.index_id
+		WHERE i.object_id = OBJECT_ID(QUOTENAME(@p1) + '.' + QUOTENAME(@p2))
+			AND i.is_primary_key = 0
+			AND i.type > 0
+			AND ic.is_included_column = 0
+		ORDER BY i.name, ic.key_ordinal;`
+	rows, err := db.Query(q, table.schema, table.name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var name, column string
+	var sequence int64
+	var isUnique, isDesc bool
+	indexMap := make(map[string]schema.Index)
+	var indexNames []string
+	var indexes []schema.Index
+	for rows.Next() {
+		if err := rows.Scan(&name, &column, &sequence, &isUnique, &isDesc); err != nil {
+			conv.Unexpected(fmt.Sprintf("Can't scan: %v", err))
+			continue
+		}
+		if _, found := indexMap[name]; !found {
+			indexNames = append(indexNames, name)
+			indexMap[name] = schema.Index{Name: name, Unique: isUnique}
+		}
+		index := indexMap[name]
+		index.Keys = append(index.Keys, schema.Key{Column: column, Desc: isDesc})
+		indexMap[name] = index
+	}
+	for _, k := range indexNames {
+		indexes = append(indexes, indexMap[k])
+	}
+	return indexes, nil
+}
+
+// toType builds a schema.Type from INFORMATION_SCHEMA.COLUMNS data.
+// Note that SQL Server reports a character_maximum_length of -1 for
+// the (max) variants of varchar, nvarchar and varbinary.
+func toType(dataType string, charLen sql.NullInt64, numericPrecision, numericScale sql.NullInt64) schema.Type {
+	switch {
+	case charLen.Valid:
+		return schema.Type{Name: dataType, Mods: []int64{charLen.Int64}}
+	case (dataType == "decimal" || dataType == "numeric") && numericPrecision.Valid && numericScale.Valid && numericScale.Int64 != 0:
+		return schema.Type{Name: dataType, Mods: []int64{numericPrecision.Int64, numericScale.Int64}}
+	case (dataType == "decimal" || dataType == "numeric") && numericPrecision.Valid:
+		return schema.Type{Name: dataType, Mods: []int64{numericPrecision.Int64}}
+	default:
+		return schema.Type{Name: dataType}
+	}
+}
+
+func toNotNull(conv *internal.Conv, isNullable string) bool {
+	switch isNullable {
+	case "YES":
+		return false
+	case "NO":
+		return true
+	}
+	conv.Unexpected(fmt.Sprintf("isNullable column has unknown value: %s", isNullable))
+	return false
+}
+
+// buildVals contructs interface{} value containers to scan row
+// results into.  Returns both the underlying containers (as a slice)
+// as well as an interface{} of pointers to containers to pass to
+// rows.Scan.
+func buildVals(n int) (v []interface{}, iv []interface{}) {
+	v = make([]interface{}, n)
+	for i := range v {
+		iv = append(iv, &v[i])
+	}
+	return v, iv
+}
+
+func valsToStrings(vals []interface{}) []string {
+	toString := func(val interface{}) string {
+		if val == nil {
+			return "NULL"
+		}
+		return fmt.Sprintf("%v", val)
+	}
+	var s []string
+	for _, v := range vals {
+		s = append(s, toString(v))
+	}
+	return s
+}
+
+// quoteIdent quotes a SQL Server identifier using square brackets.
+// SQL Server schema and table names can be arbitrary strings, and
+// can't be passed as query parameters, so we quote them instead.
+func quoteIdent(s string) string {
+	return "[" + strings.Replace(s, "]", "]]", -1) + "]"
+}
+
+// orderBy returns an ORDER BY clause that sorts rows of table t by its
+// primary key, or "" if t has no primary key.
+func orderBy(t schema.Table) string {
+	var keys []string
+	for _, k := range t.PrimaryKeys {
+		keys = append(keys, quoteIdent(k.Column))
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
+
+func buildTableName(schema, name string) string {
+	if schema == "dbo" { // Drop 'dbo' prefix (the default schema).
+		return name
+	}
+	return fmt.Sprintf("%s.%s", schema, name)
+}
@@ -0,0 +1,307 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlserver
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/schema"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+type mockSpec struct {
+	query string
+	args  []driver.Value   // Query args.
+	cols  []string         // Columns names for returned rows.
+	rows  [][]driver.Value // Set of rows returned.
+}
+
+type spannerData struct {
+	table string
+	cols  []string
+	vals  []interface{}
+}
+
+func TestProcessInfoSchema(t *testing.T) {
+	ms := []mockSpec{
+		{
+			query: "SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE'",
+			cols:  []string{"TABLE_SCHEMA", "TABLE_NAME"},
+			rows: [][]driver.Value{
+				{"dbo", "user"},
+				{"sales", "cart"},
+				{"sys", "trace_xe_action_map"}},
+		}, {
+			query: "SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS (.+)",
+			args:  []driver.Value{"dbo", "user"},
+			cols:  []string{"COLUMN_NAME", "DATA_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "CHARACTER_MAXIMUM_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE", "IsIdentity"},
+			rows: [][]driver.Value{
+				{"user_id", "int", "NO", nil, nil, 10, 0, 1},
+				{"guid", "uniqueidentifier", "NO", "(newid())", nil, nil, nil, 0},
+				{"name", "nvarchar", "NO", nil, 100, nil, nil, 0},
+				{"bio", "nvarchar", "YES", nil, -1, nil, nil, 0},
+				{"active", "bit", "YES", nil, nil, nil, nil, 0},
+				{"balance", "money", "YES", nil, nil, 19, 4, 0},
+				{"created", "datetime2", "YES", nil, nil, nil, nil, 0},
+				{"version", "timestamp", "NO", nil, nil, nil, nil, 0}},
+		}, {
+			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
+			args:  []driver.Value{"dbo", "user"},
+			cols:  []string{"COLUMN_NAME", "CONSTRAINT_TYPE"},
+			rows: [][]driver.Value{
+				{"user_id", "PRIMARY KEY"},
+				{"guid", "UNIQUE"}},
+		}, {
+			query: "SELECT (.+) FROM sys.foreign_keys (.+)",
+			args:  []driver.Value{"dbo", "user"},
+			cols:  []string{"REF_SCHEMA", "REF_TABLE", "COLUMN_NAME", "REF_COLUMN_NAME", "CONSTRAINT_NAME"},
+		}, {
+			query: "SELECT (.+) FROM sys.indexes (.+)",
+			args:  []driver.Value{"dbo", "user"},
+			cols:  []string{"name", "column_name", "key_ordinal", "is_unique", "is_descending_key"},
+			rows: [][]driver.Value{
+				{"ix_name", "name", 1, false, false},
+				{"ix_name", "created", 2, false, true}},
+		}, {
+			query: "SELECT (.+) FROM INFORMATION_SCHEMA.COLUMNS (.+)",
+			args:  []driver.Value{"sales", "cart"},
+			cols:  []string{"COLUMN_NAME", "DATA_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "CHARACTER_MAXIMUM_LENGTH", "NUMERIC_PRECISION", "NUMERIC_SCALE", "IsIdentity"},
+			rows: [][]driver.Value{
+				{"user_id", "int", "NO", nil, nil, 10, 0, 0},
+				{"qty", "decimal", "YES", nil, nil, 10, 2, 0},
+				{"note", "sql_variant", "YES", nil, nil, nil, nil, 0}},
+		}, {
+			query: "SELECT (.+) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS (.+)",
+			args:  []driver.Value{"sales", "cart"},
+			cols:  []string{"COLUMN_NAME", "CONSTRAINT_TYPE"},
+		}, {
+			query: "SELECT (.+) FROM sys.foreign_keys (.+)",
+			args:  []driver.Value{"sales", "cart"},
+			cols:  []string{"REF_SCHEMA", "REF_TABLE", "COLUMN_NAME", "REF_COLUMN_NAME", "CONSTRAINT_NAME"},
+			rows: [][]driver.Value{
+				{"dbo", "user", "user_id", "user_id", "fk_cart_user"}},
+		}, {
+			query: "SELECT (.+) FROM sys.indexes (.+)",
+			args:  []driver.Value{"sales", "cart"},
+			cols:  []string{"name", "column_name", "key_ordinal", "is_unique", "is_descending_key"},
+		},
+	}
+	db := mkMockDB(t, ms)
+	conv := internal.MakeConv()
+	err := ProcessInfoSchema(conv, db)
+	assert.Nil(t, err)
+	expectedSchema := map[string]ddl.CreateTable{
+		"user": ddl.CreateTable{
+			Name:     "user",
+			ColNames: []string{"user_id", "guid", "name", "bio", "active", "balance", "created", "version"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"user_id": ddl.ColumnDef{Name: "user_id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"guid":    ddl.ColumnDef{Name: "guid", T: ddl.Type{Name: ddl.String, Len: int64(36)}, NotNull: true},
+				"name":    ddl.ColumnDef{Name: "name", T: ddl.Type{Name: ddl.String, Len: int64(100)}, NotNull: true},
+				"bio":     ddl.ColumnDef{Name: "bio", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"active":  ddl.ColumnDef{Name: "active", T: ddl.Type{Name: ddl.Bool}},
+				"balance": ddl.ColumnDef{Name: "balance", T: ddl.Type{Name: ddl.Numeric}},
+				"created": ddl.ColumnDef{Name: "created", T: ddl.Type{Name: ddl.Timestamp}},
+				"version": ddl.ColumnDef{Name: "version", T: ddl.Type{Name: ddl.Bytes, Len: int64(8)}, NotNull: true},
+			},
+			Pks:     []ddl.IndexKey{ddl.IndexKey{Col: "user_id"}},
+			Indexes: []ddl.CreateIndex{ddl.CreateIndex{Name: "ix_name", Table: "user", Keys: []ddl.IndexKey{ddl.IndexKey{Col: "name"}, ddl.IndexKey{Col: "created", Desc: true}}}},
+		},
+		"sales_cart": ddl.CreateTable{
+			Name:     "sales_cart",
+			ColNames: []string{"user_id", "qty", "note", "synth_id"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"user_id":  ddl.ColumnDef{Name: "user_id", T: ddl.Type{Name: ddl.Int64}, NotNull: true},
+				"qty":      ddl.ColumnDef{Name: "qty", T: ddl.Type{Name: ddl.Numeric}},
+				"note":     ddl.ColumnDef{Name: "note", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"synth_id": ddl.ColumnDef{Name: "synth_id", T: ddl.Type{Name: ddl.Int64}},
+			},
+			Pks: []ddl.IndexKey{ddl.IndexKey{Col: "synth_id"}},
+			Fks: []ddl.Foreignkey{ddl.Foreignkey{Name: "fk_cart_user", Columns: []string{"user_id"}, ReferTable: "user", ReferColumns: []string{"user_id"}}},
+		},
+	}
+	assert.Equal(t, expectedSchema, stripSchemaComments(conv.SpSchema))
+	assert.Equal(t, 5, len(conv.Issues["user"]))
+	assert.Equal(t, []internal.SchemaIssue{internal.Widened, internal.AutoIncrement}, conv.Issues["user"]["user_id"])
+	assert.Equal(t, []internal.SchemaIssue{internal.DefaultValue}, conv.Issues["user"]["guid"])
+	assert.Equal(t, []internal.SchemaIssue{internal.Money}, conv.Issues["user"]["balance"])
+	assert.Equal(t, []internal.SchemaIssue{internal.DatetimeNoOffset}, conv.Issues["user"]["created"])
+	assert.Equal(t, []internal.SchemaIssue{internal.RowVersion}, conv.Issues["user"]["version"])
+	assert.Equal(t, []internal.SchemaIssue{internal.NoGoodType}, conv.Issues["sales.cart"]["note"])
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+}
+
+func TestProcessSQLData(t *testing.T) {
+	ms := []mockSpec{
+		{
+			query: "SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE'",
+			cols:  []string{"TABLE_SCHEMA", "TABLE_NAME"},
+			rows:  [][]driver.Value{{"dbo", "te st"}},
+		}, {
+			query: `SELECT \[a a\], CONVERT\(VARCHAR\(36\), \[ b\]\) AS \[ b\], \[ c \] FROM \[dbo\].\[te st\]`, // query is a regexp!
+			cols:  []string{"a a", " b", " c "},
+			rows: [][]driver.Value{
+				{42.3, "6F9619FF-8B86-D011-B42D-00C04FC964FF", true},
+				{6.6, "0E984725-C51C-4BF4-9960-E1C80E27ABA0", false},
+				{6.6, "0E984725-C51C-4BF4-9960-E1C80E27ABA0", "dog"}}, // Test bad row logic.
+		},
+	}
+	db := mkMockDB(t, ms)
+	conv := buildConv(
+		ddl.CreateTable{
+			Name:     "te_st",
+			ColNames: []string{"a_a", "Ab", "Ac_"},
+			ColDefs: map[string]ddl.ColumnDef{
+				"a_a": ddl.ColumnDef{Name: "a_a", T: ddl.Type{Name: ddl.Float64}},
+				"Ab":  ddl.ColumnDef{Name: "Ab", T: ddl.Type{Name: ddl.String, Len: 36}},
+				"Ac_": ddl.ColumnDef{Name: "Ac_", T: ddl.Type{Name: ddl.Bool}},
+			}},
+		schema.Table{
+			Name:     "te st",
+			ColNames: []string{"a a", " b", " c "},
+			ColDefs: map[string]schema.Column{
+				"a a": schema.Column{Name: "a a", Type: schema.Type{Name: "real"}},
+				" b":  schema.Column{Name: " b", Type: schema.Type{Name: "uniqueidentifier"}},
+				" c ": schema.Column{Name: " c ", Type: schema.Type{Name: "bit"}},
+			}})
+	conv.SetDataMode()
+	var rows []spannerData
+	conv.SetDataSink(
+		func(table string, cols []string, vals []interface{}) {
+			rows = append(rows, spannerData{table: table, cols: cols, vals: vals})
+		})
+	ProcessSQLData(conv, db)
+	assert.Equal(t,
+		[]spannerData{
+			spannerData{table: "te_st", cols: []string{"a_a", "Ab", "Ac_"}, vals: []interface{}{float64(42.3), "6F9619FF-8B86-D011-B42D-00C04FC964FF", true}},
+			spannerData{table: "te_st", cols: []string{"a_a", "Ab", "Ac_"}, vals: []interface{}{float64(6.6), "0E984725-C51C-4BF4-9960-E1C80E27ABA0", false}},
+		},
+		rows)
+	assert.Equal(t, conv.BadRows(), int64(1))
+	assert.Equal(t, int64(1), conv.Unexpecteds()) // Bad row generates an entry in unexpected.
+}
+
+func TestConvertSQLRow(t *testing.T) {
+	tm := time.Date(2021, 3, 4, 5, 6, 7, 8900000, time.UTC)
+	tc := []struct {
+		name    string
+		srcType schema.Type
+		spType  ddl.Type
+		in      interface{} // Input value for conversion.
+		e       interface{} // Expected result.
+	}{
+		{"bit", schema.Type{Name: "bit"}, ddl.Type{Name: ddl.Bool}, true, true},
+		{"bit to int64", schema.Type{Name: "bit"}, ddl.Type{Name: ddl.Int64}, true, int64(1)},
+		{"int", schema.Type{Name: "int"}, ddl.Type{Name: ddl.Int64}, int64(42), int64(42)},
+		{"float", schema.Type{Name: "float"}, ddl.Type{Name: ddl.Float64}, float64(42.5), float64(42.5)},
+		{"decimal", schema.Type{Name: "decimal"}, ddl.Type{Name: ddl.Numeric}, []byte("1234.56"), "1234.560000000"},
+		{"money", schema.Type{Name: "money"}, ddl.Type{Name: ddl.Numeric}, []byte("-12.3400"), "-12.340000000"},
+		{"nvarchar", schema.Type{Name: "nvarchar", Mods: []int64{10}}, ddl.Type{Name: ddl.String, Len: 10}, "héllo", "héllo"},
+		{"varbinary", schema.Type{Name: "varbinary"}, ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, []byte{0x1, 0xab}, []byte{0x1, 0xab}},
+		{"rowversion to string", schema.Type{Name: "timestamp"}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []byte{0, 0, 0, 0, 0, 0, 0x7, 0xd1}, "0x00000000000007D1"},
+		{"date", schema.Type{Name: "date"}, ddl.Type{Name: ddl.Date}, tm, civil.Date{Year: 2021, Month: 3, Day: 4}},
+		{"datetime2", schema.Type{Name: "datetime2"}, ddl.Type{Name: ddl.Timestamp}, tm, tm},
+		{"datetime2 string", schema.Type{Name: "datetime2"}, ddl.Type{Name: ddl.Timestamp}, "2021-03-04 05:06:07.0089", tm},
+		{"time", schema.Type{Name: "time"}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, tm, "05:06:07.0089"},
+	}
+	conv := internal.MakeConv()
+	conv.Location = time.UTC
+	for _, tc := range tc {
+		_, vals, err := ConvertSQLRow(conv, "t", []string{"a"}, schema.Table{ColDefs: map[string]schema.Column{"a": schema.Column{Name: "a", Type: tc.srcType}}},
+			"t", []string{"a"}, ddl.CreateTable{ColDefs: map[string]ddl.ColumnDef{"a": ddl.ColumnDef{Name: "a", T: tc.spType}}}, []interface{}{tc.in})
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, []interface{}{tc.e}, vals, tc.name)
+	}
+}
+
+func TestSetRowStats(t *testing.T) {
+	ms := []mockSpec{
+		{
+			query: "SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_TYPE = 'BASE TABLE'",
+			cols:  []string{"TABLE_SCHEMA", "TABLE_NAME"},
+			rows:  [][]driver.Value{{"dbo", "test1"}, {"sales", "test2"}},
+		}, {
+			query: `SELECT COUNT_BIG[(][*][)] FROM \[dbo\].\[test1\]`,
+			cols:  []string{"count"},
+			rows:  [][]driver.Value{{5}},
+		}, {
+			query: `SELECT COUNT_BIG[(][*][)] FROM \[sales\].\[test2\]`,
+			cols:  []string{"count"},
+			rows:  [][]driver.Value{{142}},
+		},
+	}
+	db := mkMockDB(t, ms)
+	conv := internal.MakeConv()
+	conv.SetDataMode()
+	SetRowStats(conv, db)
+	assert.Equal(t, int64(5), conv.Stats.Rows["test1"])
+	assert.Equal(t, int64(142), conv.Stats.Rows["sales.test2"])
+	assert.Equal(t, int64(0), conv.Unexpecteds())
+}
+
+func TestQuoteIdent(t *testing.T) {
+	assert.Equal(t, "[a b]", quoteIdent("a b"))
+	assert.Equal(t, "[a]]b]", quoteIdent("a]b"))
+}
+
+func buildConv(spTable ddl.CreateTable, srcTable schema.Table) *internal.Conv {
+	conv := internal.MakeConv()
+	conv.SpSchema[spTable.Name] = spTable
+	conv.SrcSchema[srcTable.Name] = srcTable
+	conv.ToSource[spTable.Name] = internal.NameAndCols{Name: srcTable.Name, Cols: make(map[string]string)}
+	conv.ToSpanner[srcTable.Name] = internal.NameAndCols{Name: spTable.Name, Cols: make(map[string]string)}
+	for i := range spTable.ColNames {
+		conv.ToSource[spTable.Name].Cols[spTable.ColNames[i]] = srcTable.ColNames[i]
+		conv.ToSpanner[srcTable.Name].Cols[srcTable.ColNames[i]] = spTable.ColNames[i]
+	}
+	return conv
+}
+
+func stripSchemaComments(spSchema map[string]ddl.CreateTable) map[string]ddl.CreateTable {
+	for t, ct := range spSchema {
+		for c, cd := range ct.ColDefs {
+			cd.Comment = ""
+			ct.ColDefs[c] = cd
+		}
+		ct.Comment = ""
+		spSchema[t] = ct
+	}
+	return spSchema
+}
+
+func mkMockDB(t *testing.T, ms []mockSpec) *sql.DB {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	for _, m := range ms {
+		rows := sqlmock.NewRows(m.cols)
+		for _, r := range m.rows {
+			rows.AddRow(r...)
+		}
+		if len(m.args) > 0 {
+			mock.ExpectQuery(m.query).WithArgs(m.args...).WillReturnRows(rows)
+		} else {
+			mock.ExpectQuery(m.query).WillReturnRows(rows)
+		}
+	}
+	return db
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlserver
+
+import (
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+// toSpannerType maps a scalar source schema type (defined by id and
+// mods) into a Spanner type. This is the core source-to-Spanner type
+// mapping.  toSpannerType returns the Spanner type and a list of type
+// conversion issues encountered.
+func toSpannerType(conv *internal.Conv, id string, mods []int64) (ddl.Type, []internal.SchemaIssue) {
+	switch id {
+	case "bit":
+		return ddl.Type{Name: ddl.Bool}, nil
+	case "tinyint", "smallint", "int":
+		return ddl.Type{Name: ddl.Int64}, []internal.SchemaIssue{internal.Widened}
+	case "bigint":
+		return ddl.Type{Name: ddl.Int64}, nil
+	case "real":
+		return ddl.Type{Name: ddl.Float64}, []internal.SchemaIssue{internal.Widened}
+	case "float":
+		return ddl.Type{Name: ddl.Float64}, nil
+	case "numeric", "decimal":
+		// SQL Server's NUMERIC type can store up to 38 digits, with any
+		// number of them after the decimal point. Spanner's NUMERIC type
+		// can store up to 29 digits before the decimal point and up to 9
+		// after the decimal point.
+		//
+		// TODO: Generate appropriate SchemaIssue to warn of different precision
+		// capabilities between SQL Server and Spanner NUMERIC.
+		return ddl.Type{Name: ddl.Numeric}, nil
+	case "money", "smallmoney":
+		// money and smallmoney are fixed point types with four digits
+		// after the decimal point, so they fit in Spanner's NUMERIC.
+		return ddl.Type{Name: ddl.Numeric}, []internal.SchemaIssue{internal.Money}
+	case "char", "varchar", "nchar", "nvarchar":
+		// Note that SQL Server uses a length of -1 for varchar(max)
+		// and nvarchar(max).
+		if len(mods) > 0 && mods[0] > 0 {
+			return ddl.Type{Name: ddl.String, Len: mods[0]}, nil
+		}
+		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+	case "text", "ntext", "xml":
+		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil
+	case "uniqueidentifier":
+		// Stored using the standard 36 character string form of a UUID.
+		return ddl.Type{Name: ddl.String, Len: 36}, nil
+	case "binary", "varbinary":
+		if len(mods) > 0 && mods[0] > 0 {
+			return ddl.Type{Name: ddl.Bytes, Len: mods[0]}, nil
+		}
+		return ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil
+	case "image":
+		return ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil
+	case "timestamp", "rowversion":
+		// SQL Server's timestamp type is a synonym for rowversion: an
+		// automatically generated 8 byte row version number (it is
+		// unrelated to dates and times). INFORMATION_SCHEMA reports it
+		// as timestamp.
+		return ddl.Type{Name: ddl.Bytes, Len: 8}, []internal.SchemaIssue{internal.RowVersion}
+	case "date":
+		return ddl.Type{Name: ddl.Date}, nil
+	case "datetime", "datetime2", "smalldatetime":
+		return ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.DatetimeNoOffset}
+	case "datetimeoffset":
+		return ddl.Type{Name: ddl.Timestamp}, nil
+	case "time":
+		return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.Time}
+	}
+	return ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}
+}
@@ -0,0 +1,76 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudspannerecosystem/harbourbridge/internal"
+	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
+)
+
+func TestToSpannerType(t *testing.T) {
+	tc := []struct {
+		srcType string
+		mods    []int64
+		ty      ddl.Type
+		issues  []internal.SchemaIssue
+	}{
+		{"bit", nil, ddl.Type{Name: ddl.Bool}, nil},
+		{"tinyint", nil, ddl.Type{Name: ddl.Int64}, []internal.SchemaIssue{internal.Widened}},
+		{"bigint", nil, ddl.Type{Name: ddl.Int64}, nil},
+		{"real", nil, ddl.Type{Name: ddl.Float64}, []internal.SchemaIssue{internal.Widened}},
+		{"decimal", []int64{10, 2}, ddl.Type{Name: ddl.Numeric}, nil},
+		{"smallmoney", nil, ddl.Type{Name: ddl.Numeric}, []internal.SchemaIssue{internal.Money}},
+		{"nvarchar", []int64{20}, ddl.Type{Name: ddl.String, Len: 20}, nil},
+		{"nvarchar", []int64{-1}, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil},
+		{"uniqueidentifier", nil, ddl.Type{Name: ddl.String, Len: 36}, nil},
+		{"varbinary", []int64{-1}, ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}, nil},
+		{"rowversion", nil, ddl.Type{Name: ddl.Bytes, Len: 8}, []internal.SchemaIssue{internal.RowVersion}},
+		{"datetime2", nil, ddl.Type{Name: ddl.Timestamp}, []internal.SchemaIssue{internal.DatetimeNoOffset}},
+		{"datetimeoffset", nil, ddl.Type{Name: ddl.Timestamp}, nil},
+		{"time", nil, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.Time}},
+		{"geography", nil, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.NoGoodType}},
+	}
+	for _, tc := range tc {
+		ty, issues := toSpannerType(nil, tc.srcType, tc.mods)
+		assert.Equal(t, tc.ty, ty, tc.srcType)
+		assert.Equal(t, tc.issues, issues, tc.srcType)
+	}
+}
+
+func TestRemapType(t *testing.T) {
+	tc := []struct {
+		srcType string
+		spType  string
+		ty      ddl.Type
+		issues  []internal.SchemaIssue
+	}{
+		{"bit", ddl.Int64, ddl.Type{Name: ddl.Int64}, []internal.SchemaIssue{internal.Widened}},
+		{"bit", ddl.String, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, []internal.SchemaIssue{internal.Widened}},
+		{"bit", ddl.Date, ddl.Type{Name: ddl.Bool}, nil},
+		{"nvarchar", ddl.Bytes, ddl.Type{Name: ddl.Bytes, Len: 20}, nil},
+		{"varbinary", ddl.String, ddl.Type{Name: ddl.String, Len: ddl.MaxLength}, nil},
+		{"uniqueidentifier", ddl.Bytes, ddl.Type{Name: ddl.String, Len: 36}, nil},
+		{"money", ddl.Float64, ddl.Type{Name: ddl.Numeric}, []internal.SchemaIssue{internal.Money}},
+	}
+	for _, tc := range tc {
+		ty, issues := remapType(tc.srcType, tc.spType, []int64{20})
+		assert.Equal(t, tc.ty, ty, tc.srcType+" to "+tc.spType)
+		assert.Equal(t, tc.issues, issues, tc.srcType+" to "+tc.spType)
+	}
+}
@@ -118,7 +118,7 @@ func TestIntegration_MYSQLDUMP_SimpleUse(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to open the test data file: %v", err)
 	}
-	err = cmd.CommandLine(conversion.MYSQLDUMP, projectID, instanceID, dbName, false, false, false, 0, "", &conversion.IOStreams{In: f, Out: os.Stdout}, filePrefix, now)
+	err = cmd.CommandLine(cmd.Config{Driver: conversion.MYSQLDUMP, ProjectID: projectID, InstanceID: instanceID, DBName: dbName, OutputFilePrefix: filePrefix}, &conversion.IOStreams{In: f, Out: os.Stdout}, now)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -140,7 +140,7 @@ func TestIntegration_MYSQL_SimpleUse(t *testing.T) {
 	dbPath := fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, dbName)
 	filePrefix := filepath.Join(tmpdir, dbName+".")
 
-	err := cmd.CommandLine(conversion.MYSQL, projectID, instanceID, dbName, false, false, false, 0, "", &conversion.IOStreams{Out: os.Stdout}, filePrefix, now)
+	err := cmd.CommandLine(cmd.Config{Driver: conversion.MYSQL, ProjectID: projectID, InstanceID: instanceID, DBName: dbName, OutputFilePrefix: filePrefix}, &conversion.IOStreams{Out: os.Stdout}, now)
 	if err != nil {
 		t.Fatal(err)
 	}
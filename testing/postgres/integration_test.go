@@ -120,7 +120,7 @@ func TestIntegration_PGDUMP_SimpleUse(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to open the test data file: %v", err)
 	}
-	err = cmd.CommandLine(conversion.PGDUMP, projectID, instanceID, dbName, false, false, false, 0, "", &conversion.IOStreams{In: f, Out: os.Stdout}, filePrefix, now)
+	err = cmd.CommandLine(cmd.Config{Driver: conversion.PGDUMP, ProjectID: projectID, InstanceID: instanceID, DBName: dbName, OutputFilePrefix: filePrefix}, &conversion.IOStreams{In: f, Out: os.Stdout}, now)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -177,7 +177,7 @@ func TestIntegration_POSTGRES_SimpleUse(t *testing.T) {
 	dbPath := fmt.Sprintf("projects/%s/instances/%s/databases/%s", projectID, instanceID, dbName)
 	filePrefix := filepath.Join(tmpdir, dbName+".")
 
-	err := cmd.CommandLine(conversion.POSTGRES, projectID, instanceID, dbName, false, false, false, 0, "", &conversion.IOStreams{Out: os.Stdout}, filePrefix, now)
+	err := cmd.CommandLine(cmd.Config{Driver: conversion.POSTGRES, ProjectID: projectID, InstanceID: instanceID, DBName: dbName, OutputFilePrefix: filePrefix}, &conversion.IOStreams{Out: os.Stdout}, now)
 	if err != nil {
 		t.Fatal(err)
 	}
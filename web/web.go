@@ -36,12 +36,9 @@ import (
 
 	"github.com/cloudspannerecosystem/harbourbridge/conversion"
 	"github.com/cloudspannerecosystem/harbourbridge/internal"
-	"github.com/cloudspannerecosystem/harbourbridge/mysql"
-	"github.com/cloudspannerecosystem/harbourbridge/postgres"
+	"github.com/cloudspannerecosystem/harbourbridge/source"
 	"github.com/cloudspannerecosystem/harbourbridge/spanner/ddl"
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/handlers"
-	_ "github.com/lib/pq"
 )
 
 // TODO:(searce):
@@ -53,8 +50,6 @@ import (
 // 6) Update schema conv after setting global datatypes and return conv. (setTypeMap)
 // 7) Add rateConversion() in schema conversion, ddl and report APIs.
 // 8) Add an overview in summary report API
-var mysqlTypeMap = make(map[string][]typeIssue)
-var postgresTypeMap = make(map[string][]typeIssue)
 
 // TODO:(searce) organize this file according to go style guidelines: generally
 // have public constants and public type definitions first, then public
@@ -85,17 +80,20 @@ func databaseConnection(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Request Body parse error : %v", err), http.StatusBadRequest)
 		return
 	}
-	var dataSourceName string
-	switch config.Driver {
-	case "postgres":
-		dataSourceName = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", config.Host, config.Port, config.User, config.Password, config.Database)
-	case "mysql":
-		dataSourceName = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", config.User, config.Password, config.Host, config.Port, config.Database)
-	default:
+	d, err := source.Get(config.Driver)
+	c, ok := d.(source.Connector)
+	if err != nil || !ok {
 		http.Error(w, fmt.Sprintf("Driver : '%s' is not supported", config.Driver), http.StatusBadRequest)
 		return
 	}
-	sourceDB, err := sql.Open(config.Driver, dataSourceName)
+	sqlDriver, dataSourceName := c.DataSourceName(source.Config{
+		Host:     config.Host,
+		Port:     config.Port,
+		User:     config.User,
+		Password: config.Password,
+		Database: config.Database,
+	})
+	sourceDB, err := sql.Open(sqlDriver, dataSourceName)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("SQL connection error : %v", err), http.StatusInternalServerError)
 		return
@@ -120,17 +118,13 @@ func convertSchemaSQL(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Database is not configured or Database connection is lost. Please set configuration and connect to database."), http.StatusNotFound)
 		return
 	}
-	conv := internal.MakeConv()
-	var err error
-	switch sessionState.driver {
-	case "mysql":
-		err = mysql.ProcessInfoSchema(conv, sessionState.sourceDB, sessionState.dbName)
-	case "postgres":
-		err = postgres.ProcessInfoSchema(conv, sessionState.sourceDB)
-	default:
+	d, err := source.Get(sessionState.driver)
+	if err != nil || d.Kind() != source.SQL {
 		http.Error(w, fmt.Sprintf("Driver : '%s' is not supported", sessionState.driver), http.StatusBadRequest)
 		return
 	}
+	conv := internal.MakeConv()
+	err = d.ProcessSchema(conv, source.Source{DB: sessionState.sourceDB, DBName: sessionState.dbName})
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Schema Conversion Error : %v", err), http.StatusNotFound)
 		return
@@ -236,28 +230,26 @@ func getTypeMap(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Schema is not converted or Driver is not configured properly. Please retry converting the database to Spanner."), http.StatusNotFound)
 		return
 	}
-	var typeMap map[string][]typeIssue
-	switch sessionState.driver {
-	case "mysql", "mysqldump":
-		typeMap = mysqlTypeMap
-	case "postgres", "pg_dump":
-		typeMap = postgresTypeMap
-	default:
+	d, err := source.Get(sessionState.driver)
+	if err != nil {
 		http.Error(w, fmt.Sprintf("Driver : '%s' is not supported", sessionState.driver), http.StatusBadRequest)
 		return
 	}
-	// Filter typeMap so it contains just the types SrcSchema uses.
-	filteredTypeMap := make(map[string][]typeIssue)
+	// Collect the types SrcSchema uses, along with the distinct sets of
+	// type modifiers used with each type (some mappings depend on mods
+	// e.g. MySQL's tinyint(1) can be mapped to BOOL).
+	mods := make(map[string][][]int64)
 	for _, srcTable := range sessionState.conv.SrcSchema {
 		for _, colDef := range srcTable.ColDefs {
-			if _, ok := filteredTypeMap[colDef.Type.Name]; ok {
-				continue
-			}
-			filteredTypeMap[colDef.Type.Name] = typeMap[colDef.Type.Name]
+			mods[colDef.Type.Name] = addMods(mods[colDef.Type.Name], colDef.Type.Mods)
 		}
 	}
+	typeMap := make(map[string][]typeIssue)
+	for srcType, l := range mods {
+		typeMap[srcType] = buildTypeList(d, srcType, l)
+	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(filteredTypeMap)
+	json.NewEncoder(w).Encode(typeMap)
 }
 
 // setTypeMapGlobal allows to change Spanner type globally.
@@ -834,6 +826,28 @@ func isPartOfFK(col, table string) bool {
 	return false
 }
 
+func isPartOfCheck(col, table string) (bool, string) {
+	for _, ck := range sessionState.conv.SpSchema[table].Checks {
+		for _, t := range ck.Expr {
+			if t.Kind == ddl.ExprColumn && t.Text == col {
+				return true, ck.Name
+			}
+		}
+	}
+	return false, ""
+}
+
+func isUsedByGeneratedColumn(col, table string) (bool, string) {
+	for _, cd := range sessionState.conv.SpSchema[table].ColDefs {
+		for _, t := range cd.Generated {
+			if t.Kind == ddl.ExprColumn && t.Text == col {
+				return true, cd.Name
+			}
+		}
+	}
+	return false, ""
+}
+
 // TODO: create a map to store referenced column to get
 // this information in O(1).
 // TODO:(searce) can have foreign key constraints between columns of the same table, as well as between same column on a given table.
@@ -866,6 +880,12 @@ func canRemoveColumn(colName, table string) (error, int) {
 	if isPartOfFK || isReferencedByFK {
 		return fmt.Errorf("column is part of foreign key relation, remove foreign key constraint before making the update"), http.StatusPreconditionFailed
 	}
+	if isPartOfCheck, _ := isPartOfCheck(colName, table); isPartOfCheck {
+		return fmt.Errorf("column is part of check constraint, remove check constraint before making the update"), http.StatusPreconditionFailed
+	}
+	if isUsedByGeneratedColumn, _ := isUsedByGeneratedColumn(colName, table); isUsedByGeneratedColumn {
+		return fmt.Errorf("column is used by generated column, remove generated column before making the update"), http.StatusPreconditionFailed
+	}
 	return nil, http.StatusOK
 }
 
@@ -926,6 +946,11 @@ func isUniqueName(name string) bool {
 				return false
 			}
 		}
+		for _, ck := range spSchema.Checks {
+			if ck.Name == name {
+				return false
+			}
+		}
 	}
 	return true
 }
@@ -978,19 +1003,35 @@ func renameColumn(newName, table, colName, srcTableName string) {
 	}
 	if _, found := sp.ColDefs[colName]; found {
 		sp.ColDefs[newName] = ddl.ColumnDef{
-			Name:    newName,
-			T:       sp.ColDefs[colName].T,
-			NotNull: sp.ColDefs[colName].NotNull,
-			Comment: sp.ColDefs[colName].Comment,
+			Name:      newName,
+			T:         sp.ColDefs[colName].T,
+			NotNull:   sp.ColDefs[colName].NotNull,
+			Default:   sp.ColDefs[colName].Default,
+			Generated: sp.ColDefs[colName].Generated,
+			Comment:   sp.ColDefs[colName].Comment,
 		}
 		delete(sp.ColDefs, colName)
 	}
+	for _, cd := range sp.ColDefs {
+		for i, t := range cd.Generated {
+			if t.Kind == ddl.ExprColumn && t.Text == colName {
+				cd.Generated[i].Text = newName
+			}
+		}
+	}
 	for i, pk := range sp.Pks {
 		if pk.Col == colName {
 			sp.Pks[i].Col = newName
 			break
 		}
 	}
+	for _, ck := range sp.Checks {
+		for i, t := range ck.Expr {
+			if t.Kind == ddl.ExprColumn && t.Text == colName {
+				ck.Expr[i].Text = newName
+			}
+		}
+	}
 	srcColName := sessionState.conv.ToSource[table].Cols[colName]
 	sessionState.conv.ToSpanner[srcTableName].Cols[srcColName] = newName
 	sessionState.conv.ToSource[table].Cols[newName] = srcColName
@@ -999,18 +1040,19 @@ func renameColumn(newName, table, colName, srcTableName string) {
 }
 
 func updateType(newType, table, colName, srcTableName string, w http.ResponseWriter) {
-	sp, ty, err := getType(newType, table, colName, srcTableName)
+	sp, ty, def, err := getType(newType, table, colName, srcTableName)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	colDef := sp.ColDefs[colName]
 	colDef.T = ty
+	colDef.Default = def
 	sp.ColDefs[colName] = colDef
 }
 
 func isTypeChanged(newType, table, colName, srcTableName string) (bool, error) {
-	sp, ty, err := getType(newType, table, colName, srcTableName)
+	sp, ty, _, err := getType(newType, table, colName, srcTableName)
 	if err != nil {
 		return false, err
 	}
@@ -1018,26 +1060,30 @@ func isTypeChanged(newType, table, colName, srcTableName string) (bool, error) {
 	return !reflect.DeepEqual(colDef.T, ty), nil
 }
 
-func getType(newType, table, colName string, srcTableName string) (ddl.CreateTable, ddl.Type, error) {
+// getType returns the Spanner type of column colName of table when
+// its type is changed to newType, and its default value translated to
+// that type.
+func getType(newType, table, colName string, srcTableName string) (ddl.CreateTable, ddl.Type, *ddl.Default, error) {
 	sp := sessionState.conv.SpSchema[table]
 	srcColName := sessionState.conv.ToSource[table].Cols[colName]
 	srcCol := sessionState.conv.SrcSchema[srcTableName].ColDefs[srcColName]
 	var ty ddl.Type
-	var issues []internal.SchemaIssue
-	switch sessionState.driver {
-	case "mysql", "mysqldump":
-		ty, issues = toSpannerTypeMySQL(srcCol.Type.Name, newType, srcCol.Type.Mods)
-	case "pg_dump", "postgres":
-		ty, issues = toSpannerTypePostgres(srcCol.Type.Name, newType, srcCol.Type.Mods)
-	default:
-		return sp, ty, fmt.Errorf("driver : '%s' is not supported", sessionState.driver)
+	d, err := source.Get(sessionState.driver)
+	if err != nil {
+		return sp, ty, nil, fmt.Errorf("driver : '%s' is not supported", sessionState.driver)
 	}
+	ty, issues := d.ToSpannerType(srcCol.Type.Name, newType, srcCol.Type.Mods)
 	if len(srcCol.Type.ArrayBounds) > 1 {
 		ty = ddl.Type{Name: ddl.String, Len: ddl.MaxLength}
 		issues = append(issues, internal.MultiDimensionalArray)
 	}
+	ty.IsArray = len(srcCol.Type.ArrayBounds) == 1
+	var def *ddl.Default
 	if srcCol.Ignored.Default {
-		issues = append(issues, internal.DefaultValue)
+		var ok bool
+		if def, ok = internal.ToSpannerDefault(srcCol.Default, ty); !ok {
+			issues = append(issues, internal.DefaultValue)
+		}
 	}
 	if srcCol.Ignored.AutoIncrement {
 		issues = append(issues, internal.AutoIncrement)
@@ -1045,8 +1091,7 @@ func getType(newType, table, colName string, srcTableName string) (ddl.CreateTab
 	if sessionState.conv.Issues != nil && len(issues) > 0 {
 		sessionState.conv.Issues[srcTableName][srcCol.Name] = issues
 	}
-	ty.IsArray = len(srcCol.Type.ArrayBounds) == 1
-	return sp, ty, nil
+	return sp, ty, def, nil
 }
 
 func updateNotNull(notNullChange, table, colName string) {
@@ -1119,42 +1164,39 @@ type typeIssue struct {
 	Brief string
 }
 
-func addTypeToList(convertedType string, spType string, issues []internal.SchemaIssue, l []typeIssue) []typeIssue {
-	if convertedType == spType {
-		if len(issues) > 0 {
+// buildTypeList returns the list of Spanner types that srcType can be
+// mapped to by driver d (along with a brief description of any issues),
+// for any of the type modifiers in mods.
+func buildTypeList(d source.Driver, srcType string, mods [][]int64) []typeIssue {
+	var l []typeIssue
+	for _, spType := range []string{ddl.Bool, ddl.Bytes, ddl.Date, ddl.Float64, ddl.Int64, ddl.String, ddl.Timestamp, ddl.Numeric, ddl.JSON} {
+		for _, m := range mods {
+			ty, issues := d.ToSpannerType(srcType, spType, m)
+			if ty.Name != spType {
+				continue
+			}
 			var briefs []string
 			for _, issue := range issues {
 				briefs = append(briefs, internal.IssueDB[issue].Brief)
 			}
-			l = append(l, typeIssue{T: spType, Brief: fmt.Sprintf(strings.Join(briefs, ", "))})
-		} else {
-			l = append(l, typeIssue{T: spType})
+			l = append(l, typeIssue{T: spType, Brief: strings.Join(briefs, ", ")})
+			break
 		}
 	}
 	return l
 }
-func init() {
-	// Initialize mysqlTypeMap.
-	for _, srcType := range []string{"bool", "boolean", "varchar", "char", "text", "tinytext", "mediumtext", "longtext", "set", "enum", "json", "bit", "binary", "varbinary", "blob", "tinyblob", "mediumblob", "longblob", "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "double", "float", "numeric", "decimal", "date", "datetime", "timestamp", "time", "year"} {
-		var l []typeIssue
-		for _, spType := range []string{ddl.Bool, ddl.Bytes, ddl.Date, ddl.Float64, ddl.Int64, ddl.String, ddl.Timestamp, ddl.Numeric} {
-			ty, issues := toSpannerTypeMySQL(srcType, spType, []int64{})
-			l = addTypeToList(ty.Name, spType, issues, l)
-		}
-		if srcType == "tinyint" {
-			l = append(l, typeIssue{T: ddl.Bool, Brief: "Only tinyint(1) can be converted to BOOL, for any other mods it will be converted to INT64"})
-		}
-		mysqlTypeMap[srcType] = l
-	}
-	// Initialize postgresTypeMap.
-	for _, srcType := range []string{"bool", "boolean", "bigserial", "bpchar", "character", "bytea", "date", "float8", "double precision", "float4", "real", "int8", "bigint", "int4", "integer", "int2", "smallint", "numeric", "serial", "text", "timestamptz", "timestamp with time zone", "timestamp", "timestamp without time zone", "varchar", "character varying"} {
-		var l []typeIssue
-		for _, spType := range []string{ddl.Bool, ddl.Bytes, ddl.Date, ddl.Float64, ddl.Int64, ddl.String, ddl.Timestamp, ddl.Numeric} {
-			ty, issues := toSpannerTypePostgres(srcType, spType, []int64{})
-			l = addTypeToList(ty.Name, spType, issues, l)
+
+// addMods adds m to l if l doesn't already contain it.
+func addMods(l [][]int64, m []int64) [][]int64 {
+	for _, x := range l {
+		if reflect.DeepEqual(x, m) {
+			return l
 		}
-		postgresTypeMap[srcType] = l
 	}
+	return append(l, m)
+}
+
+func init() {
 	sessionState.conv = internal.MakeConv()
 }
 
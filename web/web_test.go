@@ -850,7 +850,8 @@ func TestGetTypeMapMySQL(t *testing.T) {
 			typeIssue{T: ddl.String}},
 		"json": []typeIssue{
 			typeIssue{T: ddl.Bytes},
-			typeIssue{T: ddl.String}},
+			typeIssue{T: ddl.String},
+			typeIssue{T: ddl.JSON}},
 		"binary": []typeIssue{
 			typeIssue{T: ddl.Bytes},
 			typeIssue{T: ddl.String}},
@@ -971,7 +972,7 @@ func TestSetTypeMapGlobalLevelMySQL(t *testing.T) {
 					"d": ddl.ColumnDef{Name: "d", T: ddl.Type{Name: ddl.Bytes, Len: 6}},
 					"e": ddl.ColumnDef{Name: "e", T: ddl.Type{Name: ddl.Numeric}},
 					"f": ddl.ColumnDef{Name: "f", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
-					"g": ddl.ColumnDef{Name: "g", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+					"g": ddl.ColumnDef{Name: "g", T: ddl.Type{Name: ddl.JSON}},
 					"h": ddl.ColumnDef{Name: "h", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
 					"i": ddl.ColumnDef{Name: "i", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
 					"j": ddl.ColumnDef{Name: "j", T: ddl.Type{Name: ddl.Int64}},
@@ -2266,7 +2267,7 @@ func buildConvMySQL(conv *internal.Conv) {
 				"d": ddl.ColumnDef{Name: "d", T: ddl.Type{Name: ddl.String, Len: int64(6)}},
 				"e": ddl.ColumnDef{Name: "e", T: ddl.Type{Name: ddl.Numeric}},
 				"f": ddl.ColumnDef{Name: "f", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
-				"g": ddl.ColumnDef{Name: "g", T: ddl.Type{Name: ddl.String, Len: ddl.MaxLength}},
+				"g": ddl.ColumnDef{Name: "g", T: ddl.Type{Name: ddl.JSON}},
 				"h": ddl.ColumnDef{Name: "h", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
 				"i": ddl.ColumnDef{Name: "i", T: ddl.Type{Name: ddl.Bytes, Len: ddl.MaxLength}},
 				"j": ddl.ColumnDef{Name: "j", T: ddl.Type{Name: ddl.Int64}},